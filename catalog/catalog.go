@@ -26,13 +26,23 @@
 package catalog
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"os/exec"
+	"sort"
+	"strconv"
 	"sync"
 
 	"github.com/dnaeon/gru/graph"
 	"github.com/dnaeon/gru/resource"
 	"github.com/dnaeon/gru/utils"
+	"github.com/pborman/uuid"
 	"github.com/yuin/gopher-lua"
 	"layeh.com/gopher-luar"
 )
@@ -58,28 +68,162 @@ type Catalog struct {
 
 	// Configuration settings
 	config *Config `luar:"-"`
+
+	// SHA256 checksum of the loaded module
+	moduleDigest string `luar:"-"`
+
+	// Classification of the host using the hosts file
+	classification *Classification `luar:"-"`
+
+	// Variables overridden for the run
+	overrides *varOverrides `luar:"-"`
 }
 
 // Config type represents a set of settings to use when
 // creating and processing the catalog
 type Config struct {
-	// Name of the Lua module to load and execute
+	// Name of the Lua module to load and execute. Modules with an
+	// http:// or https:// location are fetched before being loaded.
 	Module string
 
+	// Optional checksum of a remote module in the form of
+	// "algorithm:digest", e.g. "sha256:<digest>"
+	ModuleChecksum string
+
 	// Do not take any actions, just report what would be done
 	DryRun bool
 
+	// Show the changes to be made to the content of
+	// resources supporting it, e.g. files, as a diff
+	ShowDiff bool
+
 	// Writer used to log events
 	Logger *log.Logger
 
 	// Path to the site repo containing module and data files
 	SiteRepo string
 
+	// Optional revision of the site repo, e.g. the Git commit it
+	// was fetched at, which is recorded in the run summary and
+	// in the emitted events
+	SiteRevision string
+
+	// Verify the files in the data directory of the site repo
+	// against the site manifest before processing any resources
+	VerifySiteManifest bool
+
+	// Optional digest of the site manifest. If not provided the
+	// manifest is verified against the digest file in the site repo
+	SiteManifestDigest string
+
 	// The Lua state
 	L *lua.LState
 
 	// Number of goroutines to use for concurrent processing
 	Concurrency int
+
+	// Limit of the total size of files being hashed concurrently,
+	// e.g. when verifying checksums of many files
+	HashInFlightBytes int64
+
+	// Level of events logged for resources, which do not
+	// override it. Defaults to resource.VerbosityNormal.
+	Verbosity resource.Verbosity
+
+	// Report file ownership mismatches as warnings instead of
+	// failures when not running as root
+	SkipOwnershipWhenUnprivileged bool
+
+	// Resolver used to look up the users and groups owning
+	// files. Defaults to utils.DefaultUserResolver.
+	UserResolver utils.UserResolver
+
+	// Unique id of the run. If not provided a random
+	// id is generated when creating the catalog
+	RunID string
+
+	// Variables which override the global variables
+	// declared by the module
+	Vars map[string]string
+
+	// Path to the hosts file classifying hosts into roles, e.g.
+	// DefaultHostsFile in the site repo. If set, the modules and
+	// variables of the roles of the host are loaded after the
+	// module, which is optional then.
+	HostsFile string
+
+	// Name of the host classified using the hosts file.
+	// Defaults to the hostname of the system.
+	Host string
+
+	// Path to a shell script executed before any resources are
+	// processed. The script receives the module name and number of
+	// planned changes as arguments. Processing is aborted if the
+	// script exits with a non-zero status.
+	PreApplyScript string
+
+	// Path to a shell script executed after resources have been
+	// processed, even if processing failed. The script receives the
+	// same arguments as the pre-apply script.
+	PostApplyScript string
+
+	// Directory in which remote sources of resources are cached,
+	// e.g. a temporary directory for the run. Required for
+	// fetching the sources ahead of time using PrefetchSources.
+	SourceCacheDir string
+
+	// Keep remote sources in the source cache directory between
+	// runs, and only download them again if they changed, which
+	// is determined using conditional requests.
+	RevalidateSources bool
+
+	// Path to the state file, in which the outcome of the run and
+	// the last known state of resources are recorded, e.g.
+	// DefaultStateFile. Nothing is recorded in dry-run mode.
+	StateFile string
+
+	// Only process the resources recorded as failed in the state
+	// file, along with their prerequisites. Resources, which
+	// converged during the previous run are skipped.
+	RetryFailed bool
+
+	// Number of runs kept in the history directory next to the
+	// state file, e.g. DefaultHistoryRetention. Each run recorded
+	// in the state file is copied to the history, from which the
+	// oldest runs are removed. No history is kept if zero.
+	HistoryRetention int
+
+	// Only process the resources whose title matches the given
+	// glob, e.g. "nginx*", along with their prerequisites. The
+	// glob is matched using path.Match, so a "*" does not match
+	// the "/" separator in titles of files.
+	TitleGlob string
+
+	// Collect the pending package updates and whether a reboot
+	// is required once resources have been processed. The updates
+	// are reported in the status, the state file and as classifiers,
+	// and never cause any changes by themselves.
+	CollectUpdates bool
+
+	// Path to the file, to which the plan for the run is written
+	// instead of processing any resources. The plan can be
+	// reviewed and applied later using Plan.
+	PlanFile string
+
+	// Plan to apply, e.g. as read using ReadPlan. The run is aborted
+	// before processing any resources if the catalog or the system
+	// has drifted from what was observed when creating the plan.
+	Plan *Plan
+
+	// Optional sink to which an event is emitted after each
+	// resource has been processed. No events are emitted in
+	// dry-run mode.
+	EventSink resource.EventSink
+
+	// Backends used to resolve the secrets referenced by the
+	// module using the secret() function, keyed by their name.
+	// Defaults to resource.DefaultSecretBackends.
+	SecretBackends map[string]resource.SecretBackend
 }
 
 // Status type contains status information about processed resources.
@@ -88,6 +232,25 @@ type Status struct {
 
 	// Items contain the status for resources after being processed.
 	Items map[string]*StatusItem
+
+	// Err contains any error encountered outside of resource
+	// processing, e.g. failed pre-apply or post-apply scripts.
+	Err error
+
+	// BytesWritten is the number of bytes written
+	// to files by resources during the run.
+	BytesWritten int64
+
+	// BytesPending is the number of bytes, which would have
+	// been written to files by resources in dry-run mode.
+	BytesPending int64
+
+	// SiteRevision is the revision of the site repo used for the run
+	SiteRevision string
+
+	// Updates contains the pending package updates collected
+	// after processing resources, if collecting them is enabled
+	Updates *utils.PendingUpdates
 }
 
 // StatusItem type represents a single item for a processed resource.
@@ -99,26 +262,167 @@ type StatusItem struct {
 	// Err contains any errors that were encountered during resource
 	// evaluation and processing.
 	Err error
+
+	// Action taken for the resource, e.g. "create". Empty if the
+	// resource failed before any action could be determined.
+	Action string
+
+	// BytesPending is the number of bytes, which would have been
+	// written to files by the resource in dry-run mode.
+	BytesPending int64
+
+	// Rescue contains the outcome of the rescue action run
+	// after the resource failed, if the resource has one.
+	Rescue *RescueResult
+
+	// RebootRequired specifies whether the resource reported that
+	// a reboot is required to activate changes made to the system.
+	RebootRequired bool
 }
 
-// Summary displays a summary of the resource status.
-func (s *Status) Summary(l *log.Logger) {
-	s.Lock()
-	defer s.Unlock()
+// Totals type contains the totals for processed resources.
+type Totals struct {
+	UpToDate       int                   `json:"up_to_date"`
+	Changed        int                   `json:"changed"`
+	Failed         int                   `json:"failed"`
+	BytesWritten   int64                 `json:"bytes_written"`
+	BytesPending   int64                 `json:"bytes_pending"`
+	RebootRequired int                   `json:"reboot_required,omitempty"`
+	SiteRevision   string                `json:"site_revision,omitempty"`
+	Updates        *utils.PendingUpdates `json:"updates,omitempty"`
+	Error          string                `json:"error,omitempty"`
+}
+
+// Totals returns the totals for processed resources.
+func (s *Status) Totals() Totals {
+	s.RLock()
+	defer s.RUnlock()
+
+	t := Totals{
+		BytesWritten: s.BytesWritten,
+		BytesPending: s.BytesPending,
+		SiteRevision: s.SiteRevision,
+		Updates:      s.Updates,
+	}
 
-	var changed, failed, uptodate int
 	for _, item := range s.Items {
 		switch {
 		case item.StateChanged == true && item.Err == nil:
-			changed++
+			t.Changed++
 		case item.StateChanged == false && item.Err == nil:
-			uptodate++
+			t.UpToDate++
 		default:
-			failed++
+			t.Failed++
+		}
+
+		if item.RebootRequired {
+			t.RebootRequired++
+		}
+	}
+
+	if s.Err != nil {
+		t.Error = s.Err.Error()
+	}
+
+	return t
+}
+
+// Summary displays a summary of the resource status.
+func (s *Status) Summary(l *log.Logger) {
+	t := s.Totals()
+
+	l.Printf("%d up-to-date, %d changed, %d failed\n", t.UpToDate, t.Changed, t.Failed)
+	switch {
+	case t.BytesWritten > 0:
+		l.Printf("%d bytes written\n", t.BytesWritten)
+	case t.BytesPending > 0:
+		l.Printf("%d bytes would be written\n", t.BytesPending)
+	}
+
+	if t.SiteRevision != "" {
+		l.Printf("site repo at revision %s\n", t.SiteRevision)
+	}
+
+	if t.RebootRequired > 0 {
+		l.Printf("%d resource(s) require a reboot\n", t.RebootRequired)
+	}
+
+	if u := t.Updates; u != nil {
+		l.Printf("%d pending updates, %d security updates\n", len(u.Packages), len(u.Security))
+		if u.RebootRequired {
+			l.Printf("reboot required\n")
+		}
+	}
+
+	if t.Error != "" {
+		l.Printf("%s\n", t.Error)
+	}
+}
+
+// WriteJSON writes the totals for processed resources to w as JSON.
+func (s *Status) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s.Totals())
+}
+
+// ResourceReport type contains the outcome of a processed resource.
+type ResourceReport struct {
+	ID      string        `json:"id"`
+	Action  string        `json:"action,omitempty"`
+	Changed bool          `json:"changed"`
+	Error   string        `json:"error,omitempty"`
+	Rescue  *RescueReport `json:"rescue,omitempty"`
+}
+
+// RescueReport type contains the outcome of a rescue action.
+type RescueReport struct {
+	Action string `json:"action"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report type contains the totals and the outcome
+// of each processed resource, sorted by resource id.
+type Report struct {
+	Totals
+	Resources []ResourceReport `json:"resources"`
+}
+
+// Report returns the report for processed resources.
+func (s *Status) Report() Report {
+	r := Report{
+		Totals:    s.Totals(),
+		Resources: make([]ResourceReport, 0),
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	for id, item := range s.Items {
+		rr := ResourceReport{
+			ID:      id,
+			Action:  item.Action,
+			Changed: item.StateChanged,
+		}
+		if item.Err != nil {
+			rr.Error = item.Err.Error()
 		}
+		if item.Rescue != nil {
+			rr.Rescue = &RescueReport{
+				Action: item.Rescue.Action,
+				Output: item.Rescue.Output,
+			}
+			if item.Rescue.Err != nil {
+				rr.Rescue.Error = item.Rescue.Err.Error()
+			}
+		}
+		r.Resources = append(r.Resources, rr)
 	}
 
-	l.Printf("%d up-to-date, %d changed, %d failed\n", uptodate, changed, failed)
+	sort.Slice(r.Resources, func(i, j int) bool {
+		return r.Resources[i].ID < r.Resources[j].ID
+	})
+
+	return r
 }
 
 // New creates a new empty catalog with the provided configuration
@@ -129,15 +433,56 @@ func New(config *Config) *Catalog {
 		sorted:     make([]*graph.Node, 0),
 		reversed:   graph.New(),
 		status: &Status{
-			Items: make(map[string]*StatusItem),
+			Items:        make(map[string]*StatusItem),
+			SiteRevision: config.SiteRevision,
 		},
 		Unsorted: make([]resource.Resource, 0),
 	}
 
+	if config.RunID == "" {
+		config.RunID = uuid.NewRandom().String()
+	}
+
+	// Cache user and group lookups for the run, starting with the
+	// current user, which is the default owner of files
+	users := utils.NewUserCache()
+	users.Resolver = config.UserResolver
+	if err := users.Prime(); err != nil {
+		config.Logger.Printf("Unable to cache current user: %s\n", err)
+	}
+
+	var sources *utils.SourceCache
+	switch {
+	case config.SourceCacheDir != "" && config.RevalidateSources:
+		sources = utils.NewConditionalSourceCache(config.SourceCacheDir)
+	case config.SourceCacheDir != "":
+		sources = utils.NewSourceCache(config.SourceCacheDir)
+	}
+
+	// The values of secrets are redacted from everything logged
+	// during the run, including diffs and errors
+	backends := config.SecretBackends
+	if backends == nil {
+		backends = resource.DefaultSecretBackends()
+	}
+	secrets := resource.NewSecrets(backends)
+	config.Logger = log.New(secrets.Writer(config.Logger.Writer()), config.Logger.Prefix(), config.Logger.Flags())
+
 	// Inject the configuration for resources
 	resource.DefaultConfig = &resource.Config{
-		Logger:   config.Logger,
-		SiteRepo: config.SiteRepo,
+		Logger:                        config.Logger,
+		SiteRepo:                      config.SiteRepo,
+		SkipOwnershipWhenUnprivileged: config.SkipOwnershipWhenUnprivileged,
+		RunID:                         config.RunID,
+		Module:                        config.Module,
+		UserCache:                     users,
+		FileCache:                     utils.NewFileCache(),
+		SourceCache:                   sources,
+		BytesWritten:                  utils.NewByteCounter(),
+		Concurrency:                   config.Concurrency,
+		HashInFlightBytes:             config.HashInFlightBytes,
+		Verbosity:                     config.Verbosity,
+		Secrets:                       secrets,
 	}
 
 	// Register the catalog type in Lua and also register
@@ -160,14 +505,77 @@ func (c *Catalog) Add(resources ...resource.Resource) {
 	}
 }
 
+// loadModule loads and executes the Lua module. Remote modules are
+// kept in memory only, so that they are never cached on disk.
+func (c *Catalog) loadModule() error {
+	if !utils.IsRemoteURL(c.config.Module) {
+		data, err := ioutil.ReadFile(c.config.Module)
+		if err != nil {
+			return err
+		}
+		c.moduleDigest = fmt.Sprintf("%x", sha256.Sum256(data))
+
+		return c.config.L.DoFile(c.config.Module)
+	}
+
+	var buf bytes.Buffer
+	if err := utils.Fetch(context.Background(), c.config.Module, c.config.ModuleChecksum, &buf); err != nil {
+		return err
+	}
+	c.moduleDigest = fmt.Sprintf("%x", sha256.Sum256(buf.Bytes()))
+
+	fn, err := c.config.L.Load(&buf, c.config.Module)
+	if err != nil {
+		return fmt.Errorf("unable to parse module %s: %s", c.config.Module, err)
+	}
+
+	c.config.L.Push(fn)
+	if err := c.config.L.PCall(0, lua.MultRet, nil); err != nil {
+		return fmt.Errorf("unable to execute module %s: %s", c.config.Module, err)
+	}
+
+	return nil
+}
+
 // Load loads resources into the catalog
 func (c *Catalog) Load() error {
 	// Register the resource providers and catalog in Lua
 	resource.LuaRegisterBuiltin(c.config.L)
-	if err := c.config.L.DoFile(c.config.Module); err != nil {
+	vars, err := c.classify()
+	if err != nil {
 		return err
 	}
 
+	overrides := newVarOverrides(c.config.L, vars)
+	if c.config.Module != "" || c.classification == nil {
+		if err := c.loadModule(); err != nil {
+			return err
+		}
+	}
+
+	// Load the modules of the roles of the host
+	if c.classification != nil {
+		for _, module := range c.classification.Modules {
+			if err := c.config.L.DoFile(module); err != nil {
+				return fmt.Errorf("unable to execute module %s: %s", module, err)
+			}
+		}
+	}
+
+	// Resolve the secrets used by resources
+	for _, r := range c.Unsorted {
+		if err := resource.DefaultConfig.Secrets.Resolve(r); err != nil {
+			return err
+		}
+	}
+
+	// Variables of the host need not be declared by the modules
+	for _, name := range overrides.undeclared() {
+		if _, ok := c.config.Vars[name]; ok {
+			c.config.Logger.Printf("Variable %s is not declared by the module\n", name)
+		}
+	}
+
 	// Perform a topological sort of the resources
 	collection, err := resource.CreateCollection(c.Unsorted)
 	if err != nil {
@@ -186,28 +594,183 @@ func (c *Catalog) Load() error {
 		return err
 	}
 
+	sorted, err = withoutRescueResources(collection, reversed, sorted)
+	if err != nil {
+		return err
+	}
+
 	// Set catalog fields
 	c.collection = collection
 	c.sorted = sorted
 	c.reversed = reversed
+	c.overrides = overrides
 
 	c.config.Logger.Printf("Loaded %d resources\n", len(c.sorted))
 
 	return nil
 }
 
-// Run processes the resources from catalog
+// Run processes the resources from catalog, running the pre-apply
+// and post-apply scripts before and after that, if configured.
+// If site data verification is enabled, no resources are processed
+// unless the site data matches the site manifest. When retrying
+// failed resources, only the resources which failed during the
+// previous run and their prerequisites are processed. When a title
+// glob is given, only the matching resources and their prerequisites
+// are processed. When a plan file is configured, the plan is written
+// to it instead of processing any resources, and when applying a plan,
+// no resources are processed unless the plan is still current.
 func (c *Catalog) Run() *Status {
+	if c.config.RetryFailed {
+		if err := c.selectFailed(); err != nil {
+			c.status.Err = fmt.Errorf("unable to select failed resources, aborting: %s", err)
+			return c.status
+		}
+	}
+
+	if c.config.TitleGlob != "" {
+		if err := c.selectTitles(); err != nil {
+			c.status.Err = fmt.Errorf("unable to select resources, aborting: %s", err)
+			return c.status
+		}
+	}
+
+	if c.config.VerifySiteManifest {
+		if err := c.verifySiteManifest(); err != nil {
+			c.status.Err = fmt.Errorf("site data verification failed, aborting: %s", err)
+			return c.status
+		}
+	}
+
+	if c.config.PlanFile != "" {
+		if err := c.savePlan(); err != nil {
+			c.status.Err = fmt.Errorf("unable to create plan: %s", err)
+		}
+		return c.status
+	}
+
+	if c.config.Plan != nil {
+		if err := c.verifyPlan(c.config.Plan); err != nil {
+			c.status.Err = fmt.Errorf("plan is stale, aborting: %s", err)
+			return c.status
+		}
+	}
+
+	if c.config.PreApplyScript == "" && c.config.PostApplyScript == "" {
+		return c.apply()
+	}
+
+	changes := c.plannedChanges()
+	if c.config.PreApplyScript != "" {
+		if err := c.runScript(c.config.PreApplyScript, changes); err != nil {
+			c.status.Err = fmt.Errorf("pre-apply script failed, aborting: %s", err)
+		}
+	}
+
+	if c.status.Err == nil {
+		c.apply()
+	}
+
+	if c.config.PostApplyScript != "" {
+		if err := c.runScript(c.config.PostApplyScript, changes); err != nil && c.status.Err == nil {
+			c.status.Err = fmt.Errorf("post-apply script failed: %s", err)
+		}
+	}
+
+	return c.status
+}
+
+// runScript executes a shell script with the module name and
+// the number of planned changes as arguments. The output of
+// the script is written to the catalog logger.
+func (c *Catalog) runScript(script string, changes int) error {
+	c.config.Logger.Printf("Running script %s\n", script)
+
+	cmd := exec.Command("/bin/sh", script, c.config.Module, strconv.Itoa(changes))
+	cmd.Stdout = c.config.Logger.Writer()
+	cmd.Stderr = c.config.Logger.Writer()
+
+	return cmd.Run()
+}
+
+// plannedChanges returns the number of resources, which are not in
+// their desired state. Resources which cannot be evaluated are
+// counted as changes as well.
+func (c *Catalog) plannedChanges() int {
+	changes := 0
+	for _, node := range c.sorted {
+		r := c.collection[node.Name]
+		changed, err := needsChange(r)
+		if changed || err != nil {
+			changes++
+		}
+	}
+
+	return changes
+}
+
+// needsChange evaluates a resource and returns a boolean indicating
+// whether the resource or any of its properties are out of date.
+func needsChange(r resource.Resource) (bool, error) {
+	if err := r.Validate(); err != nil {
+		return false, err
+	}
+
+	if err := r.Initialize(); err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	state, err := r.Evaluate()
+	if err != nil {
+		return false, err
+	}
+
+	want := utils.NewString(state.Want)
+	current := utils.NewString(state.Current)
+	present := utils.NewList(r.PresentStates()...)
+	absent := utils.NewList(r.AbsentStates()...)
+
+	switch {
+	case want.IsInList(present) && current.IsInList(absent):
+		return true, nil
+	case want.IsInList(absent) && current.IsInList(present):
+		return true, nil
+	case want.IsInList(absent):
+		return false, nil
+	}
+
+	name, err := outOfDateProperty(r)
+
+	return name != "", err
+}
+
+// apply processes the resources from catalog
+func (c *Catalog) apply() *Status {
 	// process executes a single resource
 	process := func(r resource.Resource) {
 		id := r.ID()
 		item := c.execute(r)
+		if item.Err != nil && c.hasFailedDependencies(r) == nil {
+			item.Rescue = c.rescue(r)
+		}
+		c.redact(item)
+
 		c.status.Lock()
 		defer c.status.Unlock()
 		c.status.Items[id] = item
 		if item.Err != nil {
 			c.config.Logger.Printf("%s %s\n", id, item.Err)
 		}
+
+		if c.config.EventSink != nil && item.Action != "" {
+			event := resource.NewResourceEvent(r, item.Action, item.StateChanged)
+			event.ResourceTitle = resource.DefaultConfig.Secrets.Redact(event.ResourceTitle)
+			event.SiteRevision = c.config.SiteRevision
+			if err := c.config.EventSink.Emit(event); err != nil {
+				c.config.Logger.Printf("%s unable to emit event: %s\n", id, err)
+			}
+		}
 	}
 
 	// Start goroutines for concurrent processing
@@ -219,7 +782,7 @@ func (c *Catalog) Run() *Status {
 		worker := func() {
 			defer wg.Done()
 			for r := range ch {
-				c.config.Logger.Printf("%s is concurrent", r.ID())
+				resource.Debugf(r, "is concurrent\n")
 				process(r)
 			}
 		}
@@ -231,7 +794,7 @@ func (c *Catalog) Run() *Status {
 		r := c.collection[node.Name]
 		switch {
 		// Resource is concurrent and is an isolated node
-		case r.IsConcurrent() && len(r.Dependencies()) == 0 && len(c.reversed.Nodes[r.ID()].Edges) == 0:
+		case r.IsConcurrent() && len(c.collection.Prerequisites(r)) == 0 && len(c.reversed.Nodes[r.ID()].Edges) == 0:
 			ch <- r
 			continue
 		// Resource is concurrent and has no reverse dependencies
@@ -246,10 +809,35 @@ func (c *Catalog) Run() *Status {
 
 	close(ch)
 	wg.Wait()
+	if c.config.CollectUpdates {
+		c.collectUpdates()
+	}
+	c.saveRunState()
+
+	c.status.Lock()
+	defer c.status.Unlock()
+	c.status.BytesWritten = resource.DefaultConfig.BytesWritten.Count()
+	c.status.BytesPending = 0
+	for _, item := range c.status.Items {
+		c.status.BytesPending += item.BytesPending
+	}
 
 	return c.status
 }
 
+// redact removes the values of secrets from the errors and
+// output of a processed resource, so that they are never
+// recorded in the report, the state file or events.
+func (c *Catalog) redact(item *StatusItem) {
+	secrets := resource.DefaultConfig.Secrets
+	item.Err = secrets.RedactError(item.Err)
+	if item.Rescue != nil {
+		item.Rescue.Action = secrets.Redact(item.Rescue.Action)
+		item.Rescue.Output = secrets.Redact(item.Rescue.Output)
+		item.Rescue.Err = secrets.RedactError(item.Rescue.Err)
+	}
+}
+
 // execute processes a single resource
 func (c *Catalog) execute(r resource.Resource) *StatusItem {
 	if err := c.hasFailedDependencies(r); err != nil {
@@ -260,6 +848,11 @@ func (c *Catalog) execute(r resource.Resource) *StatusItem {
 		return &StatusItem{Err: err}
 	}
 
+	if ro, ok := r.(resource.RefreshOnly); ok && ro.IsRefreshOnly() && !c.hasChangedSubscriptions(r) {
+		resource.Debugf(r, "refresh only and no subscribed resources have changed, skipping\n")
+		return &StatusItem{}
+	}
+
 	if err := r.Initialize(); err != nil {
 		return &StatusItem{Err: err}
 	}
@@ -270,10 +863,6 @@ func (c *Catalog) execute(r resource.Resource) *StatusItem {
 		return &StatusItem{Err: err}
 	}
 
-	if c.config.DryRun {
-		return &StatusItem{}
-	}
-
 	// Current and wanted states for the resource
 	want := utils.NewString(state.Want)
 	current := utils.NewString(state.Current)
@@ -282,16 +871,74 @@ func (c *Catalog) execute(r resource.Resource) *StatusItem {
 	present := utils.NewList(r.PresentStates()...)
 	absent := utils.NewList(r.AbsentStates()...)
 
+	if state.RebootRequired {
+		resource.Printf(r, "reboot required to activate pending changes\n")
+	}
+
+	// Resources which should be recreated on change are deleted and
+	// created again, instead of having their properties updated
+	recreate := false
+	if r.ShouldRecreateOnChange() && want.IsInList(present) && current.IsInList(present) {
+		name, err := outOfDateProperty(r)
+		if err != nil {
+			return &StatusItem{Err: err}
+		}
+
+		if name != "" {
+			recreate = true
+			if c.config.DryRun {
+				resource.Printf(r, "property '%s' is out of date, would recreate resource\n", name)
+			} else {
+				resource.Printf(r, "property '%s' is out of date, recreating resource\n", name)
+			}
+		}
+	}
+
+	if c.config.ShowDiff && want.IsInList(present) {
+		if d, ok := r.(resource.Differ); ok {
+			if _, err := d.Diff(c.config.Logger.Writer()); err != nil {
+				return &StatusItem{Err: err}
+			}
+		}
+	}
+
+	if c.config.DryRun {
+		switch {
+		case want.IsInList(present) && current.IsInList(absent):
+			resource.Printf(r, "is %s, should be %s, would create\n", current, want)
+		case want.IsInList(absent) && current.IsInList(present):
+			resource.Printf(r, "is %s, should be %s, would remove\n", current, want)
+		}
+
+		item := &StatusItem{RebootRequired: state.RebootRequired}
+		if w, ok := r.(resource.WriteSizer); ok && want.IsInList(present) {
+			n, err := w.PendingBytes()
+			if err != nil {
+				return &StatusItem{Err: err}
+			}
+			item.BytesPending = n
+		}
+
+		return item
+	}
+
 	// Process resource
-	id := r.ID()
 	var action func() error
+	actionName := resource.ActionNone
 	switch {
+	case recreate:
+		action = func() error {
+			return recreateResource(r)
+		}
+		actionName = resource.ActionRecreate
 	case want.IsInList(present) && current.IsInList(absent):
 		action = r.Create
-		c.config.Logger.Printf("%s is %s, should be %s\n", id, current, want)
+		actionName = resource.ActionCreate
+		resource.Printf(r, "is %s, should be %s\n", current, want)
 	case want.IsInList(absent) && current.IsInList(present):
 		action = r.Delete
-		c.config.Logger.Printf("%s is %s, should be %s\n", id, current, want)
+		actionName = resource.ActionDelete
+		resource.Printf(r, "is %s, should be %s\n", current, want)
 	default:
 		// No-op: resource is in sync
 	}
@@ -300,12 +947,18 @@ func (c *Catalog) execute(r resource.Resource) *StatusItem {
 	if action != nil {
 		stateChanged = true
 		if err := action(); err != nil {
-			return &StatusItem{StateChanged: true, Err: err}
+			return &StatusItem{StateChanged: true, Err: err, Action: actionName}
 		}
 	}
 
-	// Process resource properties
-	for _, p := range r.Properties() {
+	// Process resource properties. Properties of
+	// resources, which should be absent are not managed.
+	properties := r.Properties()
+	if want.IsInList(absent) {
+		properties = nil
+	}
+
+	for _, p := range properties {
 		synced, err := p.IsSynced()
 		if err != nil {
 			// Some properties make no sense if the resource is absent, e.g.
@@ -316,24 +969,64 @@ func (c *Catalog) execute(r resource.Resource) *StatusItem {
 				continue
 			}
 			e := fmt.Errorf("unable to evaluate property %s: %s\n", p.Name, err)
-			return &StatusItem{StateChanged: true, Err: e}
+			return &StatusItem{StateChanged: true, Err: e, Action: actionName}
 		}
 
 		if !synced {
 			stateChanged = true
-			c.config.Logger.Printf("%s property '%s' is out of date\n", id, p.Name())
+			if actionName == resource.ActionNone {
+				actionName = resource.ActionUpdate
+			}
+			resource.Printf(r, "property '%s' is out of date\n", p.Name())
 			if err := p.Set(); err != nil {
 				e := fmt.Errorf("unable to set property %s: %s\n", p.Name, err)
-				return &StatusItem{StateChanged: true, Err: e}
+				return &StatusItem{StateChanged: true, Err: e, Action: actionName}
 			}
 		}
 	}
 
 	if err := c.runTriggers(r); err != nil {
-		return &StatusItem{StateChanged: stateChanged, Err: err}
+		return &StatusItem{StateChanged: stateChanged, Err: err, Action: actionName}
+	}
+
+	return &StatusItem{StateChanged: stateChanged, Err: nil, Action: actionName, RebootRequired: state.RebootRequired}
+}
+
+// outOfDateProperty returns the name of the first property
+// of a resource, which is out of date, if any.
+func outOfDateProperty(r resource.Resource) (string, error) {
+	for _, p := range r.Properties() {
+		synced, err := p.IsSynced()
+		if err != nil {
+			if err == resource.ErrResourceAbsent {
+				continue
+			}
+			return "", fmt.Errorf("unable to evaluate property %s: %s", p.Name(), err)
+		}
+
+		if !synced {
+			return p.Name(), nil
+		}
+	}
+
+	return "", nil
+}
+
+// recreateResource deletes and creates the resource again. The
+// resource is evaluated once created, so that any properties
+// not set during creation can be processed afterwards.
+func recreateResource(r resource.Resource) error {
+	if err := r.Delete(); err != nil {
+		return err
 	}
 
-	return &StatusItem{StateChanged: stateChanged, Err: nil}
+	if err := r.Create(); err != nil {
+		return err
+	}
+
+	_, err := r.Evaluate()
+
+	return err
 }
 
 // runTriggers executes the triggers for each
@@ -343,12 +1036,12 @@ func (c *Catalog) runTriggers(r resource.Resource) error {
 	defer c.status.Unlock()
 
 	for subscribed, trigger := range r.SubscribedTo() {
-		item := c.status.Items[subscribed]
-		if !item.StateChanged {
+		item, ok := c.status.Items[subscribed]
+		if !ok || !item.StateChanged {
 			continue
 		}
 
-		c.config.Logger.Printf("%s running trigger, because %s has changed\n", r.ID(), subscribed)
+		resource.Printf(r, "running trigger, because %s has changed\n", subscribed)
 		c.config.L.Push(trigger)
 		if err := c.config.L.PCall(0, 0, nil); err != nil {
 			c.config.Logger.Printf("%s trigger exited with an error: %s\n", r.ID(), err)
@@ -359,14 +1052,29 @@ func (c *Catalog) runTriggers(r resource.Resource) error {
 	return nil
 }
 
-// hasFailedDependencies checks if a resource has failed dependencies.
+// hasChangedSubscriptions checks if any of the resources
+// to which a resource subscribes have changed.
+func (c *Catalog) hasChangedSubscriptions(r resource.Resource) bool {
+	c.status.Lock()
+	defer c.status.Unlock()
+
+	for subscribed := range r.SubscribedTo() {
+		if item, ok := c.status.Items[subscribed]; ok && item.StateChanged {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasFailedDependencies checks if any of the resources
+// processed before a resource have failed.
 func (c *Catalog) hasFailedDependencies(r resource.Resource) error {
 	c.status.Lock()
 	defer c.status.Unlock()
 
-	for _, dep := range r.Dependencies() {
-		item := c.status.Items[dep]
-		if item.Err != nil {
+	for _, dep := range c.collection.Prerequisites(r) {
+		if item, ok := c.status.Items[dep]; ok && item.Err != nil {
 			return fmt.Errorf("failed dependency for %s", dep)
 		}
 	}
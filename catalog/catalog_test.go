@@ -26,11 +26,19 @@
 package catalog
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/dnaeon/gru/resource"
+	"github.com/dnaeon/gru/utils"
 	"github.com/yuin/gopher-lua"
 )
 
@@ -77,3 +85,600 @@ func TestCatalog(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// fakeResource type is a resource, which keeps track of
+// the actions taken on it.
+type fakeResource struct {
+	resource.Base
+
+	synced      bool
+	refreshOnly bool
+	evalErr     error
+	actions     []string
+}
+
+func newFakeResource(name string) *fakeResource {
+	r := &fakeResource{
+		Base: resource.Base{
+			Name:              name,
+			Type:              "fake",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Subscribe:         make(resource.TriggerMap),
+		},
+	}
+
+	r.PropertyList = []resource.Property{
+		&resource.ResourceProperty{
+			PropertyName: "setting",
+			PropertySetFunc: func() error {
+				r.actions = append(r.actions, "set")
+				r.synced = true
+				return nil
+			},
+			PropertyIsSyncedFunc: func() (bool, error) {
+				return r.synced, nil
+			},
+		},
+	}
+
+	return r
+}
+
+func (r *fakeResource) Evaluate() (resource.State, error) {
+	if r.evalErr != nil {
+		return resource.State{}, r.evalErr
+	}
+
+	return resource.State{Current: "present", Want: r.State}, nil
+}
+
+func (r *fakeResource) Create() error {
+	r.actions = append(r.actions, "create")
+	r.synced = true
+	return nil
+}
+
+func (r *fakeResource) Delete() error {
+	r.actions = append(r.actions, "delete")
+	return nil
+}
+
+func (r *fakeResource) IsRefreshOnly() bool {
+	return r.refreshOnly
+}
+
+func TestRecreateOnChange(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	var buf bytes.Buffer
+	config := &Config{
+		DryRun: true,
+		Logger: log.New(&buf, "", 0),
+		L:      L,
+	}
+	katalog := New(config)
+
+	// Dry run only describes the recreate
+	r := newFakeResource("foo")
+	r.RecreateOnChange = true
+	item := katalog.execute(r)
+	if item.Err != nil {
+		t.Fatal(item.Err)
+	}
+
+	if len(r.actions) != 0 {
+		t.Errorf("want no actions in dry run mode, got %v", r.actions)
+	}
+
+	if !strings.Contains(buf.String(), "would recreate resource") {
+		t.Errorf("want recreate to be reported in dry run mode, got %q", buf.String())
+	}
+
+	config.DryRun = false
+	item = katalog.execute(r)
+	if item.Err != nil {
+		t.Fatal(item.Err)
+	}
+
+	if !item.StateChanged || strings.Join(r.actions, ",") != "delete,create" {
+		t.Errorf("want resource to be recreated, got %v", r.actions)
+	}
+
+	// Resources are updated in place by default
+	r = newFakeResource("bar")
+	item = katalog.execute(r)
+	if item.Err != nil {
+		t.Fatal(item.Err)
+	}
+
+	if !item.StateChanged || strings.Join(r.actions, ",") != "set" {
+		t.Errorf("want resource property to be set, got %v", r.actions)
+	}
+}
+
+func TestRefreshOnly(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	var buf bytes.Buffer
+	config := &Config{
+		Logger: log.New(&buf, "", 0),
+		L:      L,
+	}
+	katalog := New(config)
+
+	triggered := 0
+	trigger := L.NewFunction(func(L *lua.LState) int {
+		triggered++
+		return 0
+	})
+
+	pkg := newFakeResource("pkg")
+	pkg.synced = true
+	katalog.status.Items[pkg.ID()] = katalog.execute(pkg)
+
+	r := newFakeResource("migrate")
+	r.refreshOnly = true
+	r.Subscribe[pkg.ID()] = trigger
+
+	// Not processed, unless a subscribed resource has changed
+	item := katalog.execute(r)
+	if item.Err != nil {
+		t.Fatal(item.Err)
+	}
+
+	if item.StateChanged || len(r.actions) != 0 || triggered != 0 {
+		t.Errorf("want refresh only resource to be skipped, got %v", r.actions)
+	}
+
+	pkg.synced = false
+	katalog.status.Items[pkg.ID()] = katalog.execute(pkg)
+
+	item = katalog.execute(r)
+	if item.Err != nil {
+		t.Fatal(item.Err)
+	}
+
+	if !item.StateChanged || strings.Join(r.actions, ",") != "set" || triggered != 1 {
+		t.Errorf("want refresh only resource to be processed, got %v", r.actions)
+	}
+}
+
+// writeScript creates a shell script in dir with the given content.
+func writeScript(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestApplyScripts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	L := lua.NewState()
+	defer L.Close()
+
+	testCases := []struct {
+		pre     string
+		want    string
+		actions string
+		failed  bool
+	}{
+		{"echo pre $1 $2", "pre site 1\npost site 1\n", "set", false},
+		{"echo pre $1 $2; exit 1", "pre site 1\npost site 1\n", "", true},
+	}
+
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		config := &Config{
+			Module:          "site",
+			Logger:          log.New(&buf, "", 0),
+			L:               L,
+			PreApplyScript:  writeScript(t, dir, "pre.sh", tc.pre),
+			PostApplyScript: writeScript(t, dir, "post.sh", "echo post $1 $2"),
+		}
+		katalog := New(config)
+
+		r := newFakeResource("foo")
+		katalog.collection, err = resource.CreateCollection([]resource.Resource{r})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		g, err := katalog.collection.DependencyGraph()
+		if err != nil {
+			t.Fatal(err)
+		}
+		katalog.reversed = g.Reversed()
+		katalog.sorted, err = g.Sort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		status := katalog.Run()
+		if tc.failed != (status.Err != nil) {
+			t.Errorf("want failed %t, got %v", tc.failed, status.Err)
+		}
+
+		if got := strings.Join(r.actions, ","); got != tc.actions {
+			t.Errorf("want actions %q, got %q", tc.actions, got)
+		}
+
+		var output string
+		for _, line := range strings.SplitAfter(buf.String(), "\n") {
+			if strings.HasPrefix(line, "pre ") || strings.HasPrefix(line, "post ") {
+				output += line
+			}
+		}
+
+		if output != tc.want {
+			t.Errorf("want script output %q, got %q", tc.want, output)
+		}
+	}
+}
+
+func TestApplyScriptsDerivedContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "motd"), []byte("welcome\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code := `
+	motd = resource.file.new("` + filepath.Join(dir, "etc-motd") + `")
+	motd.source = "motd"
+	catalog:add(motd)
+
+	hosts = resource.file.new("` + filepath.Join(dir, "etc-hosts") + `")
+	hosts.lines = { "127.0.0.1 localhost" }
+	catalog:add(hosts)
+	`
+	module := filepath.Join(dir, "site.lua")
+	if err := ioutil.WriteFile(module, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+
+	var buf bytes.Buffer
+	config := &Config{
+		Module:         module,
+		SiteRepo:       dir,
+		Logger:         log.New(&buf, "", 0),
+		L:              L,
+		Concurrency:    1,
+		PreApplyScript: writeScript(t, dir, "pre.sh", "echo pre $1 $2"),
+	}
+	katalog := New(config)
+	if err := katalog.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resources are validated again after planning the changes
+	status := katalog.Run()
+	if status.Err != nil {
+		t.Fatal(status.Err)
+	}
+
+	if !strings.Contains(buf.String(), "pre "+module+" 2\n") {
+		t.Errorf("want 2 planned changes, got %q", buf.String())
+	}
+
+	for name, want := range map[string]string{"etc-motd": "welcome\n", "etc-hosts": "127.0.0.1 localhost\n"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Errorf("want content %q for %s, got %q", want, name, content)
+		}
+	}
+}
+
+// fakeEventSink type is an event sink, which keeps
+// track of the emitted events.
+type fakeEventSink struct {
+	events []resource.ResourceEvent
+}
+
+func (s *fakeEventSink) Emit(event resource.ResourceEvent) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestEventSink(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	sink := &fakeEventSink{}
+	config := &Config{
+		Logger:       log.New(ioutil.Discard, "", 0),
+		L:            L,
+		EventSink:    sink,
+		SiteRevision: "0123abcd",
+	}
+	katalog := New(config)
+
+	r := newFakeResource("foo")
+	katalog.collection, _ = resource.CreateCollection([]resource.Resource{r})
+	g, err := katalog.collection.DependencyGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	katalog.reversed = g.Reversed()
+	katalog.sorted, err = g.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The property is updated on the first run,
+	// and the resource is in sync on the second one
+	katalog.apply()
+	katalog.apply()
+
+	if len(sink.events) != 2 {
+		t.Fatalf("want 2 events, got %d", len(sink.events))
+	}
+
+	want := []struct {
+		action  string
+		changed bool
+	}{
+		{resource.ActionUpdate, true},
+		{resource.ActionNone, false},
+	}
+
+	for i, event := range sink.events {
+		if event.ResourceType != "fake" || event.ResourceTitle != "foo" {
+			t.Errorf("want event for fake[foo], got %s[%s]", event.ResourceType, event.ResourceTitle)
+		}
+
+		if event.Action != want[i].action || event.Changed != want[i].changed {
+			t.Errorf("want action %s and changed %t, got %s and %t", want[i].action, want[i].changed, event.Action, event.Changed)
+		}
+
+		if event.SiteRevision != "0123abcd" {
+			t.Errorf("want site revision 0123abcd, got %q", event.SiteRevision)
+		}
+	}
+
+	if totals := katalog.status.Totals(); totals.SiteRevision != "0123abcd" {
+		t.Errorf("want site revision 0123abcd in totals, got %q", totals.SiteRevision)
+	}
+
+	// No events are emitted in dry-run mode
+	config.DryRun = true
+	katalog.apply()
+	if len(sink.events) != 2 {
+		t.Errorf("want no events in dry run mode, got %d", len(sink.events)-2)
+	}
+}
+
+func TestLoadRemoteModule(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/site.lua":
+			io.WriteString(w, `foo = 42`)
+		case "/invalid.lua":
+			io.WriteString(w, `foo = `)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	testCases := []struct {
+		path         string
+		want         lua.LValue
+		wantFetchErr bool
+		wantErr      bool
+	}{
+		{"/site.lua", lua.LNumber(42), false, false},
+		{"/missing.lua", lua.LNil, true, true},
+		{"/invalid.lua", lua.LNil, false, true},
+	}
+
+	for _, tc := range testCases {
+		L := lua.NewState()
+		config := &Config{
+			Module: ts.URL + tc.path,
+			Logger: log.New(ioutil.Discard, "", 0),
+			L:      L,
+		}
+		katalog := New(config)
+		err := katalog.Load()
+
+		_, isFetchErr := err.(*utils.FetchError)
+		if isFetchErr != tc.wantFetchErr || (err != nil) != tc.wantErr {
+			t.Errorf("%s: unexpected error %v", tc.path, err)
+		}
+
+		if got := L.GetGlobal("foo"); got != tc.want {
+			t.Errorf("%s: want foo %v, got %v", tc.path, tc.want, got)
+		}
+		L.Close()
+	}
+}
+
+func TestBytesWritten(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	L := lua.NewState()
+	defer L.Close()
+
+	config := &Config{
+		Logger:      log.New(ioutil.Discard, "", 0),
+		L:           L,
+		DryRun:      true,
+		Concurrency: 2,
+	}
+	katalog := New(config)
+
+	resources := make([]resource.Resource, 0)
+	for _, name := range []string{"foo", "bar"} {
+		r, err := resource.NewFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.(*resource.File).Content = []byte("content\n")
+		resources = append(resources, r)
+	}
+
+	katalog.collection, _ = resource.CreateCollection(resources)
+	g, err := katalog.collection.DependencyGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	katalog.reversed = g.Reversed()
+	katalog.sorted, err = g.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		dryRun  bool
+		written int64
+		pending int64
+	}{
+		{true, 0, 16},
+		{false, 16, 0},
+		{false, 16, 0},
+		{true, 16, 0},
+	}
+
+	for i, tc := range testCases {
+		config.DryRun = tc.dryRun
+		totals := katalog.apply().Totals()
+		if totals.BytesWritten != tc.written || totals.BytesPending != tc.pending {
+			t.Errorf("run %d: want %d bytes written and %d pending, got %d and %d", i, tc.written, tc.pending, totals.BytesWritten, totals.BytesPending)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := katalog.status.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"up_to_date":2,"changed":0,"failed":0,"bytes_written":16,"bytes_pending":0}` + "\n"
+	if buf.String() != want {
+		t.Errorf("want JSON %s, got %s", want, buf.String())
+	}
+
+	report := katalog.status.Report()
+	if len(report.Resources) != 2 || report.UpToDate != 2 {
+		t.Fatalf("want report for 2 up-to-date resources, got %+v", report)
+	}
+
+	for i, name := range []string{"bar", "foo"} {
+		want := ResourceReport{ID: "file[" + filepath.Join(dir, name) + "]"}
+		if report.Resources[i] != want {
+			t.Errorf("want resource report %+v, got %+v", want, report.Resources[i])
+		}
+	}
+}
+
+// BenchmarkLoad loads a synthetic catalog of 10,000
+// resources, each requiring the previous one.
+func BenchmarkLoad(b *testing.B) {
+	dir, err := ioutil.TempDir("", "gru-catalog")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	code := `
+	local prev = nil
+	for i = 1, 10000 do
+	   local f = resource.file.new("/var/lib/gru/bench/file" .. i)
+	   f.content = "content " .. i
+	   if prev ~= nil then
+	      f.require = { prev:ID() }
+	   end
+	   catalog:add(f)
+	   prev = f
+	end
+	`
+
+	module := filepath.Join(dir, "bench.lua")
+	if err := ioutil.WriteFile(module, []byte(code), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		L := lua.NewState()
+		config := &Config{
+			Module: module,
+			Logger: log.New(ioutil.Discard, "", 0),
+			L:      L,
+		}
+
+		katalog := New(config)
+		if err := katalog.Load(); err != nil {
+			b.Fatal(err)
+		}
+
+		if len(katalog.sorted) != 10000 {
+			b.Fatalf("want 10000 resources, got %d", len(katalog.sorted))
+		}
+		L.Close()
+	}
+}
+
+func TestRemoveAbsent(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	var buf bytes.Buffer
+	config := &Config{
+		DryRun: true,
+		Logger: log.New(&buf, "", 0),
+		L:      L,
+	}
+	katalog := New(config)
+
+	r := newFakeResource("foo")
+	r.State = "absent"
+	item := katalog.execute(r)
+	if item.Err != nil {
+		t.Fatal(item.Err)
+	}
+
+	if len(r.actions) != 0 {
+		t.Errorf("want no actions in dry run mode, got %v", r.actions)
+	}
+
+	if !strings.Contains(buf.String(), "is present, should be absent, would remove") {
+		t.Errorf("want removal to be reported in dry run mode, got %q", buf.String())
+	}
+
+	// Properties of resources, which should be absent are not set
+	config.DryRun = false
+	item = katalog.execute(r)
+	if item.Err != nil {
+		t.Fatal(item.Err)
+	}
+
+	if !item.StateChanged || strings.Join(r.actions, ",") != "delete" {
+		t.Errorf("want resource to be removed, got %v", r.actions)
+	}
+}
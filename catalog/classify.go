@@ -0,0 +1,314 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dnaeon/gru/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultHostsFile is the name of the hosts file in the site repo.
+const DefaultHostsFile = "hosts.yaml"
+
+// Policies for hosts, which do not match any entry of the hosts file
+const (
+	// UnclassifiedWarn logs a warning and loads no roles
+	UnclassifiedWarn = "warn"
+
+	// UnclassifiedError fails loading the catalog
+	UnclassifiedError = "error"
+)
+
+// HostsFile type represents a file classifying hosts into roles, which
+// allows a single site repo to be used for many hosts.
+//
+// Each role imports the Lua modules declaring its resources. Variables
+// are declared globally, per role and per host, and override the
+// variables declared by the modules. Variables of hosts take precedence
+// over the ones of roles, which take precedence over global variables.
+// Variables given for a run, e.g. using the --var flag of gructl, take
+// precedence over all of them.
+//
+// Example:
+//   unclassified: error
+//   vars:
+//     env: production
+//   roles:
+//     web:
+//       import: ["roles/web/*.lua"]
+//       vars:
+//         port: 80
+//     db:
+//       import: ["roles/db/*.lua"]
+//   hosts:
+//     - match: "web*.example.org"
+//       roles: ["web"]
+//     - match: "web1.example.org"
+//       vars:
+//         port: 8080
+type HostsFile struct {
+	// Hosts contains the entries matching hosts to roles
+	Hosts []HostEntry `yaml:"hosts"`
+
+	// Roles contains the roles keyed by their names
+	Roles map[string]Role `yaml:"roles"`
+
+	// Vars contains the global variables
+	Vars map[string]string `yaml:"vars"`
+
+	// Unclassified is the policy for hosts, which do not match any
+	// entry, either "warn" or "error". Defaults to "warn".
+	Unclassified string `yaml:"unclassified"`
+}
+
+// HostEntry type represents an entry of the hosts file.
+type HostEntry struct {
+	// Match is either the name of a host, or a pattern
+	// matching host names, e.g. "web*.example.org"
+	Match string `yaml:"match"`
+
+	// Roles of the matching hosts
+	Roles []string `yaml:"roles"`
+
+	// Vars contains the variables of the matching hosts
+	Vars map[string]string `yaml:"vars"`
+}
+
+// Role type represents a role of hosts.
+type Role struct {
+	// Import contains the Lua modules declaring the resources of
+	// the role, as paths relative to the site repo, which may
+	// contain patterns, e.g. "roles/web/*.lua"
+	Import []string `yaml:"import"`
+
+	// Vars contains the variables of the role
+	Vars map[string]string `yaml:"vars"`
+}
+
+// Classification type represents the roles, variables and
+// modules, which a host has been classified to.
+type Classification struct {
+	// Host is the name of the classified host
+	Host string
+
+	// Matched specifies whether the host matched
+	// any entry of the hosts file
+	Matched bool
+
+	// Roles of the host in the order of the hosts file
+	Roles []string
+
+	// Vars contains the resolved variables of the host
+	Vars map[string]string
+
+	// Modules contains the paths to the Lua modules imported
+	// by the roles of the host, in the order they are loaded
+	Modules []string
+}
+
+// LoadHostsFile reads and validates a hosts file.
+func LoadHostsFile(path string) (*HostsFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hf := &HostsFile{}
+	if err := yaml.UnmarshalStrict(data, hf); err != nil {
+		return nil, fmt.Errorf("invalid hosts file %s: %s", path, err)
+	}
+
+	switch hf.Unclassified {
+	case "":
+		hf.Unclassified = UnclassifiedWarn
+	case UnclassifiedWarn, UnclassifiedError:
+	default:
+		return nil, fmt.Errorf("invalid hosts file %s: unknown unclassified policy '%s'", path, hf.Unclassified)
+	}
+
+	for _, entry := range hf.Hosts {
+		if _, err := filepath.Match(entry.Match, ""); err != nil || entry.Match == "" {
+			return nil, fmt.Errorf("invalid hosts file %s: invalid match '%s'", path, entry.Match)
+		}
+
+		for _, name := range entry.Roles {
+			if _, ok := hf.Roles[name]; !ok {
+				return nil, fmt.Errorf("invalid hosts file %s: unknown role '%s' for %s", path, name, entry.Match)
+			}
+		}
+	}
+
+	return hf, nil
+}
+
+// Classify resolves the roles, variables and modules of a host. Hosts
+// may match multiple entries, which are applied in the order of the
+// hosts file, so that variables of later entries override the ones of
+// earlier entries. The modules of the roles are looked up in the site
+// repo. A host matching no entry is an error if the hosts file says so.
+func (hf *HostsFile) Classify(host, siteRepo string) (*Classification, error) {
+	cl := &Classification{
+		Host:    host,
+		Roles:   make([]string, 0),
+		Vars:    make(map[string]string),
+		Modules: make([]string, 0),
+	}
+
+	hostVars := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, entry := range hf.Hosts {
+		if ok, _ := filepath.Match(entry.Match, host); !ok {
+			continue
+		}
+
+		cl.Matched = true
+		for _, name := range entry.Roles {
+			if !seen[name] {
+				seen[name] = true
+				cl.Roles = append(cl.Roles, name)
+			}
+		}
+
+		for name, value := range entry.Vars {
+			hostVars[name] = value
+		}
+	}
+
+	if !cl.Matched && hf.Unclassified == UnclassifiedError {
+		return nil, fmt.Errorf("host %s does not match any entry of the hosts file", host)
+	}
+
+	// Variables in the order of precedence
+	for name, value := range hf.Vars {
+		cl.Vars[name] = value
+	}
+
+	for _, name := range cl.Roles {
+		for varName, value := range hf.Roles[name].Vars {
+			cl.Vars[varName] = value
+		}
+	}
+
+	for name, value := range hostVars {
+		cl.Vars[name] = value
+	}
+
+	// Modules of the roles, each of them loaded only once
+	loaded := make(map[string]bool)
+	for _, name := range cl.Roles {
+		for _, pattern := range hf.Roles[name].Import {
+			modules, err := importModules(siteRepo, pattern)
+			if err != nil {
+				return nil, fmt.Errorf("role %s: %s", name, err)
+			}
+
+			for _, module := range modules {
+				if !loaded[module] {
+					loaded[module] = true
+					cl.Modules = append(cl.Modules, module)
+				}
+			}
+		}
+	}
+
+	return cl, nil
+}
+
+// importModules returns the sorted paths to the modules in the site
+// repo matching a pattern, which must match at least one module.
+func importModules(siteRepo, pattern string) ([]string, error) {
+	path, err := utils.SecureJoin(siteRepo, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	modules, err := filepath.Glob(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("no modules found for %s", pattern)
+	}
+	sort.Strings(modules)
+
+	return modules, nil
+}
+
+// classify classifies the host using the hosts file, if any, and
+// returns the variables overridden for the run, which are the
+// variables of the host merged with the variables of the run.
+func (c *Catalog) classify() (map[string]string, error) {
+	if c.config.HostsFile == "" {
+		return c.config.Vars, nil
+	}
+
+	hf, err := LoadHostsFile(c.config.HostsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	host := c.config.Host
+	if host == "" {
+		host, err = os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cl, err := hf.Classify(host, c.config.SiteRepo)
+	if err != nil {
+		return nil, err
+	}
+	c.classification = cl
+
+	if !cl.Matched {
+		c.config.Logger.Printf("Host %s does not match any entry of the hosts file\n", host)
+	}
+
+	vars := make(map[string]string)
+	for name, value := range cl.Vars {
+		vars[name] = value
+	}
+
+	for name, value := range c.config.Vars {
+		vars[name] = value
+	}
+
+	return vars, nil
+}
+
+// Classification returns the classification of the host, if the
+// catalog has been loaded using a hosts file, or nil otherwise.
+func (c *Catalog) Classification() *Classification {
+	return c.classification
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const testHostsFile = `
+vars:
+  env: production
+  port: 80
+roles:
+  web:
+    import: ["roles/web/*.lua"]
+    vars:
+      port: 8000
+      role: web
+  db:
+    import: ["roles/db/*.lua"]
+hosts:
+  - match: "web*.example.org"
+    roles: ["web"]
+  - match: "web1.example.org"
+    roles: ["web", "db"]
+    vars:
+      port: 8080
+`
+
+func TestClassify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-classify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	modules := map[string]string{
+		"roles/web/nginx.lua": `nginx = resource.file.new("/etc/nginx/port") nginx.content = tostring(port) catalog:add(nginx)`,
+		"roles/web/app.lua":   `app = resource.file.new("/etc/app/env") app.content = env catalog:add(app)`,
+		"roles/db/pg.lua":     `pg = resource.file.new("/etc/pg") catalog:add(pg)`,
+		"hosts.yaml":          testHostsFile,
+	}
+	for name, content := range modules {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hf, err := LoadHostsFile(filepath.Join(dir, "hosts.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		host    string
+		roles   []string
+		vars    map[string]string
+		modules []string
+	}{
+		{
+			host:    "web2.example.org",
+			roles:   []string{"web"},
+			vars:    map[string]string{"env": "production", "port": "8000", "role": "web"},
+			modules: []string{"roles/web/app.lua", "roles/web/nginx.lua"},
+		},
+		{
+			host:    "web1.example.org",
+			roles:   []string{"web", "db"},
+			vars:    map[string]string{"env": "production", "port": "8080", "role": "web"},
+			modules: []string{"roles/web/app.lua", "roles/web/nginx.lua", "roles/db/pg.lua"},
+		},
+		{
+			host:    "mail.example.org",
+			roles:   []string{},
+			vars:    map[string]string{"env": "production", "port": "80"},
+			modules: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		cl, err := hf.Classify(tc.host, dir)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.host, err)
+		}
+
+		modules := make([]string, 0)
+		for _, module := range cl.Modules {
+			rel, _ := filepath.Rel(dir, module)
+			modules = append(modules, filepath.ToSlash(rel))
+		}
+
+		if !reflect.DeepEqual(cl.Roles, tc.roles) || !reflect.DeepEqual(cl.Vars, tc.vars) || !reflect.DeepEqual(modules, tc.modules) {
+			t.Errorf("%s: want %v %v %v, got %v %v %v", tc.host, tc.roles, tc.vars, tc.modules, cl.Roles, cl.Vars, modules)
+		}
+	}
+
+	// Hosts matching no entry can be rejected
+	hf.Unclassified = UnclassifiedError
+	if _, err := hf.Classify("mail.example.org", dir); err == nil {
+		t.Error("want error for unclassified host")
+	}
+
+	// Only the resources of the roles of the host are loaded,
+	// and variables of the run take precedence over the host
+	L := lua.NewState()
+	defer L.Close()
+
+	var buf bytes.Buffer
+	config := &Config{
+		Logger:    log.New(&buf, "", 0),
+		SiteRepo:  dir,
+		L:         L,
+		HostsFile: filepath.Join(dir, "hosts.yaml"),
+		Host:      "web2.example.org",
+		Vars:      map[string]string{"env": "staging"},
+	}
+	katalog := New(config)
+	if err := katalog.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(katalog.Unsorted) != 2 {
+		t.Errorf("want 2 resources, got %d", len(katalog.Unsorted))
+	}
+	if got := L.GetGlobal("port").String(); got != "8000" {
+		t.Errorf("want port 8000, got %s", got)
+	}
+	if got := L.GetGlobal("env").String(); got != "staging" {
+		t.Errorf("want env staging, got %s", got)
+	}
+
+	// Undeclared variables are only reported for the run
+	if !strings.Contains(buf.String(), "Variable env is not declared") || strings.Contains(buf.String(), "Variable port") {
+		t.Errorf("unexpected warnings about undeclared variables: %s", buf.String())
+	}
+
+	for _, content := range []string{"unclassified: maybe", "hosts:\n  - match: web\n    roles: [mail]", "other: true"} {
+		path := filepath.Join(dir, "invalid.yaml")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadHostsFile(path); err == nil {
+			t.Errorf("%q: want error", content)
+		}
+	}
+}
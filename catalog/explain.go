@@ -0,0 +1,144 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dnaeon/gru/resource"
+)
+
+// Explanation type describes how a resource has been declared and
+// which checks are performed when evaluating it.
+type Explanation struct {
+	// ID of the resource
+	ID string `json:"id"`
+
+	// Attributes of the resource as loaded from the modules
+	Attributes map[string]interface{} `json:"attributes"`
+
+	// Defaults contains the names of the attributes,
+	// which have not been declared by the modules
+	Defaults []string `json:"defaults"`
+
+	// Variables contains the host variables and overridden
+	// variables, which have been read by the modules. Variables
+	// are tracked for all resources of the catalog, as they
+	// cannot be attributed to the individual resources.
+	Variables map[string]string `json:"variables"`
+
+	// Checks performed when evaluating the resource
+	Checks []resource.Check `json:"checks"`
+
+	// Guards which determine whether the resource is processed
+	Guards []resource.Guard `json:"guards"`
+
+	// Requires contains the resources required by the resource
+	Requires []string `json:"requires"`
+
+	// Subscribes contains the resources the resource subscribes to
+	Subscribes []string `json:"subscribes"`
+
+	// Dependents contains the resources, which
+	// require or subscribe to the resource
+	Dependents []string `json:"dependents"`
+}
+
+// Explain evaluates a resource of the loaded catalog without making
+// any changes and explains how it has been declared and evaluated.
+func (c *Catalog) Explain(id string) (*Explanation, error) {
+	r, ok := c.collection[id]
+	if !ok {
+		return nil, fmt.Errorf("resource %s not found in catalog", id)
+	}
+
+	defaults, err := resource.DefaultAttributes(r)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Explanation{
+		ID:         id,
+		Attributes: resource.Attributes(r),
+		Defaults:   defaults,
+		Variables:  make(map[string]string),
+		Checks:     make([]resource.Check, 0),
+		Guards:     make([]resource.Guard, 0),
+		Requires:   c.collection.Dependencies(r),
+		Subscribes: make([]string, 0),
+		Dependents: make([]string, 0),
+	}
+
+	if c.overrides != nil {
+		e.Variables = c.overrides.readValues()
+	}
+
+	for subscribed := range r.SubscribedTo() {
+		e.Subscribes = append(e.Subscribes, subscribed)
+	}
+	sort.Strings(e.Subscribes)
+
+	if node, ok := c.reversed.GetNode(id); ok {
+		for _, edge := range node.Edges {
+			e.Dependents = append(e.Dependents, edge.Name)
+		}
+		sort.Strings(e.Dependents)
+	}
+
+	if err := r.Validate(); err != nil {
+		return e, err
+	}
+
+	// Nothing has changed yet when explaining a resource, so
+	// refresh only resources would not be processed
+	if ro, ok := r.(resource.RefreshOnly); ok && ro.IsRefreshOnly() {
+		guard := resource.Guard{
+			Name:      "refresh_only",
+			Condition: "any of the subscribed resources has changed",
+			Passed:    false,
+		}
+		e.Guards = append(e.Guards, guard)
+	}
+
+	if g, ok := r.(resource.Guarder); ok {
+		guards, err := g.Guards()
+		if err != nil {
+			return e, err
+		}
+		e.Guards = append(e.Guards, guards...)
+	}
+
+	if err := r.Initialize(); err != nil {
+		return e, err
+	}
+	defer r.Close()
+
+	checks, err := resource.Explain(r)
+	e.Checks = append(e.Checks, checks...)
+
+	return e, err
+}
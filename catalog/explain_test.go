@@ -0,0 +1,151 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestExplain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-explain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.conf")
+	code := fmt.Sprintf(`
+	content = "default"
+
+	d = resource.directory.new(%[1]q)
+	catalog:add(d)
+
+	conf = resource.file.new(%[2]q)
+	conf.mode = tonumber("0600", 8)
+	conf.content = content
+	conf.require = { d:ID() }
+	catalog:add(conf)
+
+	reload = resource.shell.new("true")
+	reload.creates = %[2]q
+	reload.refresh_only = true
+	reload.require = { conf:ID() }
+	catalog:add(reload)
+	`, dir, path)
+
+	module := filepath.Join(dir, "site.lua")
+	if err := ioutil.WriteFile(module, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+
+	config := &Config{
+		Module: module,
+		Logger: log.New(ioutil.Discard, "", 0),
+		L:      L,
+		Vars:   map[string]string{"content": "override"},
+	}
+
+	katalog := New(config)
+	if err := katalog.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	id := fmt.Sprintf("file[%s]", path)
+	e, err := katalog.Explain(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("override"))); e.Attributes["content"] != want {
+		t.Errorf("want content attribute %s, got %v", want, e.Attributes["content"])
+	}
+
+	defaults := make(map[string]bool)
+	for _, name := range e.Defaults {
+		defaults[name] = true
+	}
+
+	if defaults["mode"] || defaults["content"] || defaults["require"] || !defaults["owner"] {
+		t.Errorf("unexpected default attributes %v", e.Defaults)
+	}
+
+	if !reflect.DeepEqual(e.Variables, map[string]string{"content": "override"}) {
+		t.Errorf("want variables map[content:override], got %v", e.Variables)
+	}
+
+	if !reflect.DeepEqual(e.Requires, []string{fmt.Sprintf("directory[%s]", dir)}) {
+		t.Errorf("unexpected requirements %v", e.Requires)
+	}
+
+	if !reflect.DeepEqual(e.Dependents, []string{"shell[true]"}) {
+		t.Errorf("unexpected dependents %v", e.Dependents)
+	}
+
+	if len(e.Checks) != 4 || e.Checks[0].Observed != "absent" || e.Checks[0].InSync {
+		t.Errorf("unexpected checks %v", e.Checks)
+	}
+
+	if len(e.Guards) != 0 {
+		t.Errorf("want no guards, got %v", e.Guards)
+	}
+
+	reload := katalog.collection["shell[true]"].(*resource.Shell)
+	reload.Subscribe[id] = L.NewFunction(func(L *lua.LState) int { return 0 })
+
+	e, err = katalog.Explain("shell[true]")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guards := []resource.Guard{
+		{Name: "refresh_only", Condition: "any of the subscribed resources has changed", Passed: false},
+		{Name: "creates", Condition: fmt.Sprintf("file %s does not exist", path), Passed: true},
+	}
+	if !reflect.DeepEqual(e.Guards, guards) {
+		t.Errorf("want guards %v, got %v", guards, e.Guards)
+	}
+
+	if !reflect.DeepEqual(e.Subscribes, []string{id}) {
+		t.Errorf("want subscriptions [%s], got %v", id, e.Subscribes)
+	}
+
+	if _, err := katalog.Explain("file[/nonexistent]"); err == nil {
+		t.Error("want error for resource not in catalog")
+	}
+}
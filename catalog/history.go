@@ -0,0 +1,299 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultHistoryRetention is the default number of runs kept in the history.
+const DefaultHistoryRetention = 30
+
+// historyTimeFormat is the format of the run time in the names of
+// history files, which makes them sort in the order of the runs.
+const historyTimeFormat = "20060102T150405.000000000Z"
+
+// HistoryDir returns the directory, in which the history
+// of runs recorded in the given state file is kept.
+func HistoryDir(stateFile string) string {
+	return filepath.Join(filepath.Dir(stateFile), "history")
+}
+
+// recordHistory copies the run state to the history of the state
+// file, and removes the oldest runs exceeding the retention.
+func recordHistory(stateFile string, state *RunState, retention int) error {
+	dir := HistoryDir(stateFile)
+	name := fmt.Sprintf("%s-%s.json", state.Time.UTC().Format(historyTimeFormat), state.RunID)
+	if err := WriteRunState(filepath.Join(dir, name), state); err != nil {
+		return err
+	}
+
+	names, err := historyFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for len(names) > retention {
+		if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+
+	return nil
+}
+
+// historyFiles returns the names of the files in the
+// history directory, sorted from the oldest run.
+func historyFiles(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, fi := range files {
+		if fi.Mode().IsRegular() && filepath.Ext(fi.Name()) == ".json" {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// ReadHistory reads the last n runs from the history of the given
+// state file, starting with the most recent one. All runs in the
+// history are read if n is not positive.
+func ReadHistory(stateFile string, n int) ([]*RunState, error) {
+	dir := HistoryDir(stateFile)
+	names, err := historyFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if n > 0 && len(names) > n {
+		names = names[len(names)-n:]
+	}
+
+	runs := make([]*RunState, 0, len(names))
+	for i := len(names) - 1; i >= 0; i-- {
+		state, err := ReadRunState(filepath.Join(dir, names[i]))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, state)
+	}
+
+	return runs, nil
+}
+
+// FindRun reads the run with the given id from the history of the
+// state file. The id may be abbreviated, as long as it is unique.
+func FindRun(stateFile, id string) (*RunState, error) {
+	runs, err := ReadHistory(stateFile, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *RunState
+	for _, run := range runs {
+		if run.RunID == id {
+			return run, nil
+		}
+		if id != "" && strings.HasPrefix(run.RunID, id) {
+			if found != nil {
+				return nil, fmt.Errorf("run id %s is ambiguous", id)
+			}
+			found = run
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("run %s not found in %s", id, HistoryDir(stateFile))
+	}
+
+	return found, nil
+}
+
+// ResourceChange type contains the outcome of
+// a resource, which changed or failed during a run.
+type ResourceChange struct {
+	// ID of the resource
+	ID string `json:"id"`
+
+	// Action taken for the resource, e.g. "create"
+	Action string `json:"action,omitempty"`
+
+	// Error encountered when processing the resource
+	Error string `json:"error,omitempty"`
+}
+
+// RunChanges type contains the resources
+// changed or failed during a recorded run.
+type RunChanges struct {
+	RunID        string           `json:"run_id"`
+	Module       string           `json:"module"`
+	ModuleDigest string           `json:"module_digest,omitempty"`
+	Time         time.Time        `json:"time"`
+	Changed      []ResourceChange `json:"changed"`
+	Failed       []ResourceChange `json:"failed"`
+}
+
+// Changes returns the resources changed or failed during the run,
+// which are the ones evaluated at the time the run finished at.
+// Resources carried over from previous runs are not included.
+func (s *RunState) Changes() *RunChanges {
+	rc := &RunChanges{
+		RunID:        s.RunID,
+		Module:       s.Module,
+		ModuleDigest: s.ModuleDigest,
+		Time:         s.Time,
+		Changed:      make([]ResourceChange, 0),
+		Failed:       make([]ResourceChange, 0),
+	}
+
+	ids := make([]string, 0, len(s.Resources))
+	for id := range s.Resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		rs := s.Resources[id]
+		if rs.LastEvaluated == nil || !rs.LastEvaluated.Equal(s.Time) {
+			continue
+		}
+
+		change := ResourceChange{ID: id, Action: rs.Action, Error: rs.Error}
+		switch rs.Status {
+		case ResourceChanged:
+			rc.Changed = append(rc.Changed, change)
+		case ResourceFailed:
+			rc.Failed = append(rc.Failed, change)
+		}
+	}
+
+	return rc
+}
+
+// AttributeDiff type contains an attribute
+// of a resource, which differs between runs.
+type AttributeDiff struct {
+	// ID of the resource
+	ID string `json:"id"`
+
+	// Name of the attribute
+	Attribute string `json:"attribute"`
+
+	// Old value of the attribute, nil if not set
+	Old interface{} `json:"old"`
+
+	// New value of the attribute, nil if not set
+	New interface{} `json:"new"`
+}
+
+// StateDiff type contains the differences
+// between the states of two recorded runs.
+type StateDiff struct {
+	// Added contains the sorted ids of resources,
+	// which are only declared in the new run
+	Added []string `json:"added"`
+
+	// Removed contains the sorted ids of resources,
+	// which are only declared in the old run
+	Removed []string `json:"removed"`
+
+	// Changed contains the attributes which differ, sorted
+	// by the resource id and the name of the attribute
+	Changed []AttributeDiff `json:"changed"`
+}
+
+// DiffRunStates compares the declared attributes of
+// resources between an old and a new recorded run.
+func DiffRunStates(older, newer *RunState) *StateDiff {
+	diff := &StateDiff{
+		Added:   make([]string, 0),
+		Removed: make([]string, 0),
+		Changed: make([]AttributeDiff, 0),
+	}
+
+	for id := range older.Resources {
+		if _, ok := newer.Resources[id]; !ok {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+
+	for id, rs := range newer.Resources {
+		prev, ok := older.Resources[id]
+		if !ok {
+			diff.Added = append(diff.Added, id)
+			continue
+		}
+
+		names := make(map[string]bool)
+		for name := range prev.Attributes {
+			names[name] = true
+		}
+		for name := range rs.Attributes {
+			names[name] = true
+		}
+
+		for name := range names {
+			if !reflect.DeepEqual(prev.Attributes[name], rs.Attributes[name]) {
+				ad := AttributeDiff{
+					ID:        id,
+					Attribute: name,
+					Old:       prev.Attributes[name],
+					New:       rs.Attributes[name],
+				}
+				diff.Changed = append(diff.Changed, ad)
+			}
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		a, b := diff.Changed[i], diff.Changed[j]
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Attribute < b.Attribute
+	})
+
+	return diff
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	L := lua.NewState()
+	defer L.Close()
+
+	stateFile := filepath.Join(dir, "state.json")
+	run := func(id string, resources ...resource.Resource) {
+		config := &Config{
+			Module:           "site",
+			Logger:           log.New(ioutil.Discard, "", 0),
+			L:                L,
+			Concurrency:      1,
+			StateFile:        stateFile,
+			RunID:            id,
+			HistoryRetention: 2,
+		}
+		katalog := New(config)
+
+		katalog.collection, err = resource.CreateCollection(resources)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		g, err := katalog.collection.DependencyGraph()
+		if err != nil {
+			t.Fatal(err)
+		}
+		katalog.reversed = g.Reversed()
+		katalog.sorted, err = g.Sort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		katalog.Run()
+	}
+
+	pkg := newFakeResource("pkg")
+	config := newFakeResource("config")
+	run("run-1", pkg, config)
+
+	// The second run changes the config only
+	pkg.synced = true
+	config.evalErr = errors.New("invalid template")
+	config.Require = []string{pkg.ID()}
+	service := newFakeResource("service")
+	run("run-2", pkg, config, service)
+
+	runs, err := ReadHistory(stateFile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runs) != 2 || runs[0].RunID != "run-2" || runs[1].RunID != "run-1" {
+		t.Fatalf("want runs run-2 and run-1, got %d runs", len(runs))
+	}
+
+	changes := runs[0].Changes()
+	wantChanged := []ResourceChange{{ID: service.ID(), Action: resource.ActionUpdate}}
+	if !reflect.DeepEqual(wantChanged, changes.Changed) {
+		t.Errorf("want changed resources %+v, got %+v", wantChanged, changes.Changed)
+	}
+
+	wantFailed := []ResourceChange{{ID: config.ID(), Error: "invalid template"}}
+	if !reflect.DeepEqual(wantFailed, changes.Failed) {
+		t.Errorf("want failed resources %+v, got %+v", wantFailed, changes.Failed)
+	}
+
+	diff := DiffRunStates(runs[1], runs[0])
+	if !reflect.DeepEqual([]string{service.ID()}, diff.Added) || len(diff.Removed) != 0 {
+		t.Errorf("want %s added, got %+v", service.ID(), diff)
+	}
+
+	if len(diff.Changed) != 1 || diff.Changed[0].ID != config.ID() || diff.Changed[0].Attribute != "require" {
+		t.Errorf("want require of %s changed, got %+v", config.ID(), diff.Changed)
+	}
+
+	// Runs are found by abbreviated ids, and only
+	// the configured number of runs is kept
+	run("run-3", pkg)
+	if _, err := FindRun(stateFile, "run-1"); err == nil {
+		t.Error("want run-1 removed from the history")
+	}
+
+	found, err := FindRun(stateFile, "run-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := found.Resources[service.ID()]; !ok {
+		t.Errorf("want %s carried over in run-3", service.ID())
+	}
+
+	if _, err := FindRun(stateFile, "run-"); err == nil {
+		t.Error("want error for ambiguous run id")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// Names of the site manifest files, which are kept in the site repo
+const (
+	// SiteManifestFile lists the files in the data directory
+	SiteManifestFile = "MANIFEST"
+
+	// SiteManifestDigestFile contains the digest of the manifest
+	// in the format used by sha256sum(1)
+	SiteManifestDigestFile = "MANIFEST.sha256"
+)
+
+// GenerateSiteManifest writes a manifest of the files in the data
+// directory of the site repo, along with the digest of the manifest,
+// and returns the digest.
+func GenerateSiteManifest(siteRepo string, opts utils.HashOptions) (string, error) {
+	m, err := utils.GenerateManifest(filepath.Join(siteRepo, "data"), opts)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	if err := ioutil.WriteFile(filepath.Join(siteRepo, SiteManifestFile), buf.Bytes(), 0644); err != nil {
+		return "", err
+	}
+
+	digest := m.Digest()
+	line := fmt.Sprintf("%s  %s\n", digest, SiteManifestFile)
+	if err := ioutil.WriteFile(filepath.Join(siteRepo, SiteManifestDigestFile), []byte(line), 0644); err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// VerifySiteManifest verifies the files in the data directory of the
+// site repo against the manifest. The manifest itself is verified
+// against the given digest, or against the digest file in the site
+// repo if no digest is given. All files which do not match the
+// manifest are reported in the returned error.
+func VerifySiteManifest(siteRepo, digest string, opts utils.HashOptions) error {
+	f, err := os.Open(filepath.Join(siteRepo, SiteManifestFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	want, err := utils.ParseManifest(f)
+	if err != nil {
+		return fmt.Errorf("invalid manifest: %s", err)
+	}
+
+	if digest == "" {
+		data, err := ioutil.ReadFile(filepath.Join(siteRepo, SiteManifestDigestFile))
+		if err != nil {
+			return err
+		}
+
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 {
+			return fmt.Errorf("empty manifest digest file %s", SiteManifestDigestFile)
+		}
+		digest = fields[0]
+	}
+
+	if want.Digest() != strings.ToLower(digest) {
+		return fmt.Errorf("manifest digest is %s, expected %s", want.Digest(), digest)
+	}
+
+	current, err := utils.GenerateManifest(filepath.Join(siteRepo, "data"), opts)
+	if err != nil {
+		return err
+	}
+
+	if paths := current.Compare(want); len(paths) > 0 {
+		return fmt.Errorf("%d file(s) do not match manifest: %s", len(paths), strings.Join(paths, ", "))
+	}
+
+	return nil
+}
+
+// verifySiteManifest verifies the site data before any resources are
+// processed, using the concurrency settings of the catalog.
+func (c *Catalog) verifySiteManifest() error {
+	c.config.Logger.Printf("Verifying site data against %s\n", SiteManifestFile)
+
+	opts := utils.HashOptions{
+		Concurrency:   c.config.Concurrency,
+		InFlightBytes: c.config.HashInFlightBytes,
+	}
+
+	return VerifySiteManifest(c.config.SiteRepo, c.config.SiteManifestDigest, opts)
+}
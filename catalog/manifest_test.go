@@ -0,0 +1,81 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestSiteManifest(t *testing.T) {
+	siteRepo, err := ioutil.TempDir("", "gru-site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(siteRepo)
+
+	dataDir := filepath.Join(siteRepo, "data")
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string]string{"foo": "foo", "bar": "bar"} {
+		if err := ioutil.WriteFile(filepath.Join(dataDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	digest, err := GenerateSiteManifest(siteRepo, utils.HashOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifySiteManifest(siteRepo, "", utils.HashOptions{}); err != nil {
+		t.Errorf("want site data to match manifest, got %s", err)
+	}
+
+	if err := VerifySiteManifest(siteRepo, strings.ToUpper(digest), utils.HashOptions{}); err != nil {
+		t.Errorf("want site data to match manifest with explicit digest, got %s", err)
+	}
+
+	if err := VerifySiteManifest(siteRepo, strings.Repeat("0", 64), utils.HashOptions{}); err == nil {
+		t.Errorf("want error for mismatched manifest digest")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dataDir, "foo"), []byte("qux"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = VerifySiteManifest(siteRepo, digest, utils.HashOptions{})
+	if err == nil || !strings.Contains(err.Error(), "1 file(s) do not match manifest: foo") {
+		t.Errorf("want error for modified file, got %v", err)
+	}
+}
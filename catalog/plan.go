@@ -0,0 +1,337 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/dnaeon/gru/utils"
+)
+
+// PlanVersion is the version of the plan file format. It is
+// incremented whenever the format changes incompatibly.
+const PlanVersion = 1
+
+// Actions planned for resources
+const (
+	ActionNone     = "none"
+	ActionCreate   = "create"
+	ActionDelete   = "delete"
+	ActionUpdate   = "update"
+	ActionRecreate = "recreate"
+)
+
+// Plan type contains the actions planned for the resources of a
+// catalog, along with everything observed when evaluating them.
+// A plan is applied only if nothing has changed since it was created.
+type Plan struct {
+	// Version of the plan file format
+	Version int `json:"version"`
+
+	// Time the plan was created at
+	Time time.Time `json:"time"`
+
+	// Host for which the plan was created
+	Host string `json:"host"`
+
+	// Module is the name of the module planned
+	Module string `json:"module"`
+
+	// ModuleDigest is the SHA256 checksum of the module planned
+	ModuleDigest string `json:"module_digest,omitempty"`
+
+	// SiteRevision is the revision of the site repo planned
+	SiteRevision string `json:"site_revision,omitempty"`
+
+	// Resources contains the planned resources in
+	// the order in which they are processed
+	Resources []*PlannedResource `json:"resources"`
+}
+
+// PlannedResource type contains the action planned for a resource.
+type PlannedResource struct {
+	// ID of the resource
+	ID string `json:"id"`
+
+	// Action planned for the resource, e.g. "create"
+	Action string `json:"action"`
+
+	// Attributes declared for the resource, with
+	// the values of sensitive attributes redacted
+	Attributes map[string]interface{} `json:"attributes"`
+
+	// Digest is the SHA256 checksum of the attributes, which
+	// includes the checksums of content read from source files
+	Digest string `json:"digest"`
+
+	// Checks performed when evaluating the resource, starting
+	// with its state, along with the observed values
+	Checks []resource.Check `json:"checks"`
+}
+
+// Changes returns the number of resources, for
+// which any action other than none is planned.
+func (p *Plan) Changes() int {
+	changes := 0
+	for _, pr := range p.Resources {
+		if pr.Action != ActionNone {
+			changes++
+		}
+	}
+
+	return changes
+}
+
+// ReadPlan reads a plan from the given file.
+func ReadPlan(path string) (*Plan, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("invalid plan file %s: %s", path, err)
+	}
+
+	if plan.Version != PlanVersion {
+		return nil, fmt.Errorf("unsupported plan file version %d", plan.Version)
+	}
+
+	return &plan, nil
+}
+
+// WritePlan writes a plan to the given file.
+func WritePlan(path string, plan *Plan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(utils.DefaultFileSystem, path, append(data, '\n'), 0644, -1, -1)
+}
+
+// Plan evaluates the resources of the catalog without making any
+// changes and returns the actions planned for them. Resources,
+// which cannot be evaluated cause the planning to fail.
+func (c *Catalog) Plan() (*Plan, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Version:      PlanVersion,
+		Time:         time.Now().UTC(),
+		Host:         host,
+		Module:       c.config.Module,
+		ModuleDigest: c.moduleDigest,
+		SiteRevision: c.config.SiteRevision,
+		Resources:    make([]*PlannedResource, 0, len(c.sorted)),
+	}
+
+	for _, node := range c.sorted {
+		pr, err := planResource(c.collection[node.Name])
+		if err != nil {
+			return nil, fmt.Errorf("unable to plan %s: %s", node.Name, err)
+		}
+		plan.Resources = append(plan.Resources, pr)
+	}
+
+	return plan, nil
+}
+
+// savePlan creates the plan for the catalog and
+// writes it to the configured plan file.
+func (c *Catalog) savePlan() error {
+	plan, err := c.Plan()
+	if err != nil {
+		return err
+	}
+
+	if err := WritePlan(c.config.PlanFile, plan); err != nil {
+		return err
+	}
+
+	c.config.Logger.Printf("Plan with %d changes written to %s\n", plan.Changes(), c.config.PlanFile)
+
+	return nil
+}
+
+// verifyPlan checks that the catalog and the system have not
+// drifted from what was observed when creating the plan, by
+// planning the catalog again and comparing the two plans.
+func (c *Catalog) verifyPlan(plan *Plan) error {
+	current, err := c.Plan()
+	if err != nil {
+		return err
+	}
+
+	if current.Host != plan.Host {
+		return fmt.Errorf("plan was created for host %s", plan.Host)
+	}
+
+	if current.ModuleDigest != plan.ModuleDigest {
+		return fmt.Errorf("module %s has changed", c.config.Module)
+	}
+
+	planned := make(map[string]*PlannedResource)
+	for _, pr := range plan.Resources {
+		planned[pr.ID] = pr
+	}
+
+	drifted := make([]string, 0)
+	for _, pr := range current.Resources {
+		old, ok := planned[pr.ID]
+		if !ok {
+			drifted = append(drifted, fmt.Sprintf("%s is not in the plan", pr.ID))
+			continue
+		}
+		delete(planned, pr.ID)
+
+		if reason := pr.drift(old); reason != "" {
+			drifted = append(drifted, fmt.Sprintf("%s %s", pr.ID, reason))
+		}
+	}
+
+	missing := make([]string, 0, len(planned))
+	for id := range planned {
+		missing = append(missing, fmt.Sprintf("%s is no longer declared", id))
+	}
+	sort.Strings(missing)
+	drifted = append(drifted, missing...)
+
+	if len(drifted) > 0 {
+		return errors.New(strings.Join(drifted, "; "))
+	}
+
+	return nil
+}
+
+// drift returns the reason why a resource has drifted from
+// the planned resource, or an empty string if it has not.
+func (pr *PlannedResource) drift(planned *PlannedResource) string {
+	if pr.Digest != planned.Digest {
+		return "has been declared differently"
+	}
+
+	if len(pr.Checks) != len(planned.Checks) {
+		return "has changed on the system"
+	}
+
+	for i, check := range pr.Checks {
+		if check != planned.Checks[i] {
+			return fmt.Sprintf("has changed on the system, %s is %q instead of %q", check.Name, check.Observed, planned.Checks[i].Observed)
+		}
+	}
+
+	if pr.Action != planned.Action {
+		return fmt.Sprintf("would %s instead of %s", pr.Action, planned.Action)
+	}
+
+	return ""
+}
+
+// planResource evaluates a resource and returns the action planned
+// for it, along with the checks performed when evaluating it.
+func planResource(r resource.Resource) (*PlannedResource, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := r.Initialize(); err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	checks, err := resource.Explain(r)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := resource.Attributes(r)
+	data, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &PlannedResource{
+		ID:         r.ID(),
+		Action:     plannedAction(r, checks),
+		Attributes: attrs,
+		Digest:     fmt.Sprintf("%x", sha256.Sum256(data)),
+		Checks:     checks,
+	}
+
+	return pr, nil
+}
+
+// plannedAction returns the action planned for a resource
+// based on the checks performed when evaluating it.
+func plannedAction(r resource.Resource, checks []resource.Check) string {
+	state := checks[0]
+	want := utils.NewString(state.Desired)
+	current := utils.NewString(state.Observed)
+	present := utils.NewList(r.PresentStates()...)
+	absent := utils.NewList(r.AbsentStates()...)
+
+	switch {
+	case want.IsInList(present) && current.IsInList(absent):
+		return ActionCreate
+	case want.IsInList(absent) && current.IsInList(present):
+		return ActionDelete
+	case want.IsInList(absent):
+		return ActionNone
+	}
+
+	for _, check := range checks[1:] {
+		if check.InSync {
+			continue
+		}
+
+		if r.ShouldRecreateOnChange() {
+			return ActionRecreate
+		}
+
+		return ActionUpdate
+	}
+
+	return ActionNone
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// newPlanCatalog loads a catalog with a file resource
+// with the given content in the given directory.
+func newPlanCatalog(t *testing.T, dir, content string) *Catalog {
+	code := fmt.Sprintf(`
+	d = resource.directory.new(%q)
+	d.mode = tonumber("0700", 8)
+	catalog:add(d)
+
+	f = resource.file.new(%q)
+	f.content = %q
+	f.require = { d:ID() }
+	catalog:add(f)
+	`, dir, filepath.Join(dir, "app.conf"), content)
+
+	module := filepath.Join(dir, "site.lua")
+	if err := ioutil.WriteFile(module, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	L := lua.NewState()
+	config := &Config{
+		Module:      module,
+		Logger:      log.New(ioutil.Discard, "", 0),
+		L:           L,
+		Concurrency: 1,
+	}
+
+	katalog := New(config)
+	if err := katalog.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	return katalog
+}
+
+func TestPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	katalog := newPlanCatalog(t, dir, "foo")
+	plan, err := katalog.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Resources) != 2 {
+		t.Fatalf("want 2 planned resources, got %d", len(plan.Resources))
+	}
+
+	path := filepath.Join(dir, "app.conf")
+	want := []struct {
+		id     string
+		action string
+	}{
+		{fmt.Sprintf("directory[%s]", dir), ActionNone},
+		{fmt.Sprintf("file[%s]", path), ActionCreate},
+	}
+
+	for i, w := range want {
+		pr := plan.Resources[i]
+		if pr.ID != w.id || pr.Action != w.action {
+			t.Errorf("want %s with action %s, got %s with action %s", w.id, w.action, pr.ID, pr.Action)
+		}
+	}
+	if plan.Changes() != 1 {
+		t.Errorf("want 1 planned change, got %d", plan.Changes())
+	}
+
+	planFile := filepath.Join(dir, "plan.json")
+	if err := WritePlan(planFile, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := ReadPlan(planFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := katalog.verifyPlan(saved); err != nil {
+		t.Errorf("want saved plan to be current, got %s", err)
+	}
+
+	// Changes on the system are detected
+	if err := ioutil.WriteFile(path, []byte("bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = katalog.verifyPlan(saved)
+	if err == nil || !strings.Contains(err.Error(), "has changed on the system, state is \"present\" instead of \"absent\"") {
+		t.Errorf("want drift of the state of the file, got %v", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes to the module are detected
+	katalog = newPlanCatalog(t, dir, "bar")
+	err = katalog.verifyPlan(saved)
+	if err == nil || !strings.Contains(err.Error(), "has changed") {
+		t.Errorf("want changed module, got %v", err)
+	}
+
+	// Changes to the declaration of resources are detected, even if
+	// the module is the same
+	saved.ModuleDigest = katalog.moduleDigest
+	err = katalog.verifyPlan(saved)
+	if err == nil || !strings.Contains(err.Error(), "has been declared differently") {
+		t.Errorf("want changed declaration, got %v", err)
+	}
+
+	// The plan is applied if it is current
+	katalog = newPlanCatalog(t, dir, "foo")
+	katalog.config.Plan = saved
+	status := katalog.Run()
+	if status.Err == nil {
+		t.Fatal("want stale plan to be rejected")
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("want no changes for stale plan, got %v", err)
+	}
+
+	saved, err = ReadPlan(planFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	katalog = newPlanCatalog(t, dir, "foo")
+	katalog.config.Plan = saved
+	status = katalog.Run()
+	if status.Err != nil {
+		t.Fatal(status.Err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "foo" {
+		t.Errorf("want content foo, got %q", content)
+	}
+}
+
+func TestSavePlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	katalog := newPlanCatalog(t, dir, "foo")
+	katalog.config.PlanFile = filepath.Join(dir, "plan.json")
+	status := katalog.Run()
+	if status.Err != nil {
+		t.Fatal(status.Err)
+	}
+
+	// Saving the plan makes no changes
+	if _, err := os.Stat(filepath.Join(dir, "app.conf")); !os.IsNotExist(err) {
+		t.Errorf("want file not to be created, got %v", err)
+	}
+
+	plan, err := ReadPlan(katalog.config.PlanFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Changes() != 1 {
+		t.Errorf("want 1 planned change, got %d", plan.Changes())
+	}
+
+	if err := ioutil.WriteFile(katalog.config.PlanFile, []byte(`{"version": 0}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadPlan(katalog.config.PlanFile); err == nil {
+		t.Error("want error for unsupported plan version")
+	}
+}
+
+func TestPlanSourceFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.conf.src"), []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "app.conf")
+	code := fmt.Sprintf(`
+	f = resource.file.new(%q)
+	f.source = "app.conf.src"
+	catalog:add(f)
+	`, path)
+
+	module := filepath.Join(dir, "site.lua")
+	if err := ioutil.WriteFile(module, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func() *Catalog {
+		config := &Config{
+			Module:      module,
+			SiteRepo:    dir,
+			Logger:      log.New(ioutil.Discard, "", 0),
+			L:           lua.NewState(),
+			Concurrency: 1,
+		}
+
+		katalog := New(config)
+		if err := katalog.Load(); err != nil {
+			t.Fatal(err)
+		}
+
+		return katalog
+	}
+
+	plan, err := load().Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	planFile := filepath.Join(dir, "plan.json")
+	if err := WritePlan(planFile, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := ReadPlan(planFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The resources are planned again when applying the plan
+	katalog := load()
+	katalog.config.Plan = saved
+	status := katalog.Run()
+	if status.Err != nil {
+		t.Fatal(status.Err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "foo" {
+		t.Errorf("want content foo, got %q", content)
+	}
+}
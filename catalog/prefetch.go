@@ -0,0 +1,110 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dnaeon/gru/resource"
+)
+
+// ErrNoSourceCache error is returned when prefetching sources
+// without a source cache directory being configured.
+var ErrNoSourceCache = errors.New("No source cache directory configured")
+
+// PrefetchSources concurrently fetches the remote sources of all
+// resources in the catalog into the source cache, using the given
+// number of workers, so that resources do not fetch them one at a
+// time while being processed. Content with a checksum is verified
+// before being cached. It must be called after the catalog has been
+// loaded. Sources which cannot be fetched are reported in the
+// returned error, and are fetched again when processing the
+// resources using them.
+func (c *Catalog) PrefetchSources(ctx context.Context, workers int) error {
+	cache := resource.DefaultConfig.SourceCache
+	if cache == nil {
+		return ErrNoSourceCache
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Resources may share the same sources
+	unique := make(map[string]resource.RemoteSource)
+	for _, r := range c.collection {
+		fetcher, ok := r.(resource.SourceFetcher)
+		if !ok {
+			continue
+		}
+
+		for _, source := range fetcher.RemoteSources() {
+			unique[cache.Path(source.URL, source.Checksum)] = source
+		}
+	}
+
+	if len(unique) == 0 {
+		return nil
+	}
+
+	c.config.Logger.Printf("Prefetching %d remote sources using %d workers\n", len(unique), workers)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := make([]string, 0)
+	ch := make(chan resource.RemoteSource)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for source := range ch {
+				if _, err := cache.Fetch(ctx, source.URL, source.Checksum); err != nil {
+					mu.Lock()
+					failed = append(failed, err.Error())
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, source := range unique {
+		ch <- source
+	}
+	close(ch)
+	wg.Wait()
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("unable to prefetch %d source(s): %s", len(failed), strings.Join(failed, "; "))
+	}
+
+	return nil
+}
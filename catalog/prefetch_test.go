@@ -0,0 +1,135 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestPrefetchSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-prefetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "content of %s\n", r.URL.Path)
+	}))
+	defer ts.Close()
+
+	L := lua.NewState()
+	defer L.Close()
+
+	config := &Config{
+		Logger:         log.New(ioutil.Discard, "", 0),
+		L:              L,
+		SourceCacheDir: filepath.Join(dir, "cache"),
+	}
+	katalog := New(config)
+
+	resources := make([]resource.Resource, 0)
+	for i, path := range []string{"/foo", "/bar", "/foo"} {
+		r, err := resource.NewFile(filepath.Join(dir, fmt.Sprintf("file%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.(*resource.File).Source = ts.URL + path
+		resources = append(resources, r)
+	}
+
+	katalog.collection, err = resource.CreateCollection(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := katalog.PrefetchSources(context.Background(), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests["/foo"] != 1 || requests["/bar"] != 1 {
+		t.Errorf("want each source to be fetched once, got %v", requests)
+	}
+
+	// Resources use the cached content
+	for _, r := range resources {
+		if err := r.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if requests["/foo"] != 1 || requests["/bar"] != 1 {
+		t.Errorf("want resources to use the cached sources, got %v", requests)
+	}
+
+	if got := string(resources[1].(*resource.File).Content); got != "content of /bar\n" {
+		t.Errorf("want cached content, got %q", got)
+	}
+
+	// Failed sources are reported
+	r, err := resource.NewFile(filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.(*resource.File).Source = ts.URL + "/missing"
+	katalog.collection, err = resource.CreateCollection(append(resources, r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = katalog.PrefetchSources(context.Background(), 4)
+	if err == nil || !strings.Contains(err.Error(), "unable to prefetch 1 source(s)") {
+		t.Errorf("want prefetch error, got %v", err)
+	}
+
+	resource.DefaultConfig.SourceCache = nil
+	if err := katalog.PrefetchSources(context.Background(), 4); err != ErrNoSourceCache {
+		t.Errorf("want %s, got %v", ErrNoSourceCache, err)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dnaeon/gru/graph"
+	"github.com/dnaeon/gru/resource"
+	"github.com/dnaeon/gru/utils"
+)
+
+// RescueResult type contains the outcome of a rescue action,
+// which is run when processing a resource fails.
+type RescueResult struct {
+	// Action is the id of the resource processed
+	// or the command executed as rescue action
+	Action string
+
+	// Output of the command executed as rescue action
+	Output string
+
+	// Err contains any error encountered by the rescue action.
+	// It never replaces the error of the rescued resource.
+	Err error
+}
+
+// rescueAction returns the rescue action of a resource, if any.
+func rescueAction(r resource.Resource) string {
+	if rr, ok := r.(resource.Rescuer); ok {
+		return rr.RescueAction()
+	}
+
+	return ""
+}
+
+// withoutRescueResources removes the resources, which are used as
+// rescue actions from the sorted resources, so that they are only
+// processed when the resources they rescue fail.
+func withoutRescueResources(collection resource.Collection, reversed *graph.Graph, sorted []*graph.Node) ([]*graph.Node, error) {
+	rescuers := make(map[string]bool)
+	for id, r := range collection {
+		action := rescueAction(r)
+		if _, ok := collection[action]; !ok {
+			continue
+		}
+
+		if action == id {
+			return nil, fmt.Errorf("%s cannot be its own rescue action", id)
+		}
+
+		if len(reversed.Nodes[action].Edges) > 0 {
+			return nil, fmt.Errorf("%s is a rescue action of %s and cannot be required by other resources", action, id)
+		}
+		rescuers[action] = true
+	}
+
+	result := make([]*graph.Node, 0, len(sorted))
+	for _, node := range sorted {
+		if !rescuers[node.Name] {
+			result = append(result, node)
+		}
+	}
+
+	return result, nil
+}
+
+// rescue runs the rescue action of a resource, which failed to be
+// processed. Returns nil if the resource has no rescue action.
+func (c *Catalog) rescue(r resource.Resource) *RescueResult {
+	action := rescueAction(r)
+	if action == "" {
+		return nil
+	}
+
+	if c.config.DryRun {
+		resource.Printf(r, "would run rescue action %s\n", action)
+		return nil
+	}
+
+	resource.Printf(r, "running rescue action %s\n", action)
+	result := &RescueResult{Action: action}
+	if rescuer, ok := c.collection[action]; ok {
+		result.Err = c.execute(rescuer).Err
+	} else {
+		out, err := utils.RunCommand(context.Background(), utils.CommandSpec{Shell: action})
+		result.Output = string(out.Stdout) + string(out.Stderr)
+		result.Err = err
+	}
+
+	if output := strings.TrimSpace(result.Output); output != "" {
+		c.config.Logger.Printf("%s rescue action output:\n%s\n", r.ID(), output)
+	}
+
+	if result.Err != nil {
+		c.config.Logger.Printf("%s rescue action failed: %s\n", r.ID(), result.Err)
+	}
+
+	return result
+}
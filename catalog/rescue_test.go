@@ -0,0 +1,137 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestRescue(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	config := &Config{
+		Logger:      log.New(ioutil.Discard, "", 0),
+		L:           L,
+		Concurrency: 1,
+	}
+	katalog := New(config)
+
+	// Resources used as rescue actions are
+	// only processed when a resource fails
+	logs := newFakeResource("logs")
+	service := newFakeResource("service")
+	service.evalErr = errors.New("unable to start")
+	service.Rescue = logs.ID()
+
+	db := newFakeResource("db")
+	db.evalErr = errors.New("unable to connect")
+	db.Rescue = "echo collected; exit 3"
+
+	app := newFakeResource("app")
+	app.Require = []string{service.ID()}
+	app.Rescue = "echo app"
+
+	other := newFakeResource("other")
+	other.Rescue = "false"
+
+	resources := []resource.Resource{logs, service, db, app, other}
+	katalog.collection, _ = resource.CreateCollection(resources)
+	g, err := katalog.collection.DependencyGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	katalog.reversed = g.Reversed()
+	katalog.sorted, err = g.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	katalog.sorted, err = withoutRescueResources(katalog.collection, katalog.reversed, katalog.sorted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(katalog.sorted) != 4 {
+		t.Errorf("want 4 resources to be processed, got %d", len(katalog.sorted))
+	}
+
+	status := katalog.apply()
+	if _, ok := status.Items[logs.ID()]; ok {
+		t.Errorf("want %s to be processed as rescue action only", logs.ID())
+	}
+	if got := strings.Join(logs.actions, ","); got != "set" {
+		t.Errorf("want %s to be processed once, got %q", logs.ID(), got)
+	}
+
+	// Rescue actions never mask the original error
+	item := status.Items[service.ID()]
+	if item.Err != service.evalErr {
+		t.Errorf("want error %q, got %v", service.evalErr, item.Err)
+	}
+	if item.Rescue == nil || item.Rescue.Action != logs.ID() || item.Rescue.Err != nil {
+		t.Errorf("want rescue action %s to succeed, got %+v", logs.ID(), item.Rescue)
+	}
+
+	report := status.Report()
+	for _, rr := range report.Resources {
+		switch rr.ID {
+		case db.ID():
+			if rr.Error != "unable to connect" {
+				t.Errorf("want error of %s, got %q", db.ID(), rr.Error)
+			}
+			if rr.Rescue == nil || rr.Rescue.Output != "collected\n" || rr.Rescue.Error == "" {
+				t.Errorf("want output and error of failed rescue action, got %+v", rr.Rescue)
+			}
+		case app.ID(), other.ID():
+			if rr.Rescue != nil {
+				t.Errorf("want no rescue action for %s, got %+v", rr.ID, rr.Rescue)
+			}
+		}
+	}
+
+	// Resources used as rescue actions cannot be required
+	other.Require = []string{logs.ID()}
+	collection, _ := resource.CreateCollection(resources)
+	g, err = collection.DependencyGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := g.Reversed()
+	sorted, err := g.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := withoutRescueResources(collection, reversed, sorted); err == nil {
+		t.Error("want error for required rescue resource")
+	}
+}
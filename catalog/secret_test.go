@@ -0,0 +1,117 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	module := filepath.Join(dir, "site.lua")
+	code := `
+	db = resource.shell.new("create db")
+	db.command = "gru-createuser-" .. secret("env:GRU_TEST_PASSWORD")
+	catalog:add(db)
+	`
+	if err := ioutil.WriteFile(module, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("GRU_TEST_PASSWORD", "s3cr3t")
+	defer os.Unsetenv("GRU_TEST_PASSWORD")
+
+	L := lua.NewState()
+	defer L.Close()
+
+	var buf bytes.Buffer
+	config := &Config{
+		Module:      module,
+		Logger:      log.New(&buf, "", 0),
+		L:           L,
+		Concurrency: 1,
+		StateFile:   filepath.Join(dir, "state.json"),
+	}
+	katalog := New(config)
+	if err := katalog.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	status := katalog.Run()
+	item := status.Items["shell[create db]"]
+	if item == nil || item.Err == nil {
+		t.Fatal("want shell[create db] to fail")
+	}
+
+	if strings.Contains(item.Err.Error(), "s3cr3t") || !strings.Contains(item.Err.Error(), "<redacted>") {
+		t.Errorf("want secret redacted from error, got %q", item.Err)
+	}
+
+	if strings.Contains(buf.String(), "s3cr3t") {
+		t.Errorf("want secret redacted from logs, got %q", buf.String())
+	}
+
+	state, err := ioutil.ReadFile(config.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(state), "s3cr3t") {
+		t.Errorf("want secret redacted from state file, got %s", state)
+	}
+
+	// Secrets which cannot be resolved fail loading
+	os.Unsetenv("GRU_TEST_PASSWORD")
+	L2 := lua.NewState()
+	defer L2.Close()
+
+	config = &Config{
+		Module: module,
+		Logger: log.New(ioutil.Discard, "", 0),
+		L:      L2,
+		SecretBackends: map[string]resource.SecretBackend{
+			"env": resource.EnvSecretBackend{},
+		},
+	}
+	err = New(config).Load()
+	want := "shell[create db] attribute command: unable to resolve secret env:GRU_TEST_PASSWORD: environment variable GRU_TEST_PASSWORD is not set"
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/dnaeon/gru/graph"
+)
+
+// selectResources returns the sorted resources with the given ids
+// along with their prerequisites and the resources they subscribe
+// to. Ids, which are not in the catalog are ignored.
+func (c *Catalog) selectResources(ids []string) []*graph.Node {
+	selected := make(map[string]bool)
+	var walk func(id string)
+	walk = func(id string) {
+		r, ok := c.collection[id]
+		if !ok || selected[id] {
+			return
+		}
+		selected[id] = true
+		for _, dep := range c.collection.Prerequisites(r) {
+			walk(dep)
+		}
+		for subscribed := range r.SubscribedTo() {
+			walk(subscribed)
+		}
+	}
+
+	for _, id := range ids {
+		walk(id)
+	}
+
+	sorted := make([]*graph.Node, 0, len(selected))
+	for _, node := range c.sorted {
+		if selected[node.Name] {
+			sorted = append(sorted, node)
+		}
+	}
+
+	return sorted
+}
+
+// selectTitles selects the resources whose title matches
+// the title glob, along with their prerequisites.
+func (c *Catalog) selectTitles() error {
+	pattern := c.config.TitleGlob
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid title glob '%s': %s", pattern, err)
+	}
+
+	var matched []string
+	for _, node := range c.sorted {
+		_, title := splitID(node.Name)
+		if ok, _ := path.Match(pattern, title); ok {
+			matched = append(matched, node.Name)
+		}
+	}
+
+	sorted := c.selectResources(matched)
+	if len(matched) == 0 {
+		c.config.Logger.Printf("Warning: no resources match title glob '%s', nothing to process\n", pattern)
+	} else {
+		c.config.Logger.Printf("Selected %d resources matching title glob '%s', processing %d of %d resources\n", len(matched), pattern, len(sorted), len(c.sorted))
+	}
+	c.sorted = sorted
+
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestTitleGlob(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	var buf bytes.Buffer
+	newCatalog := func(glob string, resources ...resource.Resource) *Catalog {
+		config := &Config{
+			Module:      "site",
+			Logger:      log.New(&buf, "", 0),
+			L:           L,
+			Concurrency: 1,
+			TitleGlob:   glob,
+		}
+		katalog := New(config)
+
+		var err error
+		katalog.collection, err = resource.CreateCollection(resources)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		g, err := katalog.collection.DependencyGraph()
+		if err != nil {
+			t.Fatal(err)
+		}
+		katalog.reversed = g.Reversed()
+		katalog.sorted, err = g.Sort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return katalog
+	}
+
+	// Matching resources are processed along with their prerequisites
+	pkg := newFakeResource("pkg")
+	config := newFakeResource("nginx-config")
+	config.Require = []string{pkg.ID()}
+	service := newFakeResource("nginx-service")
+	service.Require = []string{config.ID()}
+	other := newFakeResource("haproxy")
+
+	status := newCatalog("nginx*", pkg, config, service, other).Run()
+	if status.Err != nil {
+		t.Fatal(status.Err)
+	}
+
+	for _, r := range []*fakeResource{pkg, config, service} {
+		if _, ok := status.Items[r.ID()]; !ok {
+			t.Errorf("want %s to be processed", r.ID())
+		}
+	}
+
+	if _, ok := status.Items[other.ID()]; ok || len(other.actions) != 0 {
+		t.Errorf("want %s to be skipped, got %v", other.ID(), other.actions)
+	}
+
+	// A glob matching nothing warns and processes nothing
+	buf.Reset()
+	status = newCatalog("apache*", pkg, config, service, other).Run()
+	if status.Err != nil {
+		t.Fatal(status.Err)
+	}
+
+	if len(status.Items) != 0 {
+		t.Errorf("want no resources processed, got %d", len(status.Items))
+	}
+
+	if !strings.Contains(buf.String(), "no resources match title glob 'apache*'") {
+		t.Errorf("want warning about no matching resources, got %q", buf.String())
+	}
+
+	// Resources to which matching resources subscribe are processed
+	triggered := 0
+	trigger := L.NewFunction(func(L *lua.LState) int {
+		triggered++
+		return 0
+	})
+
+	conf := newFakeResource("nginx.conf")
+	daemon := newFakeResource("daemon")
+	daemon.Subscribe[conf.ID()] = trigger
+
+	status = newCatalog("daemon", conf, daemon, other).Run()
+	if status.Err != nil {
+		t.Fatal(status.Err)
+	}
+
+	if _, ok := status.Items[conf.ID()]; !ok {
+		t.Errorf("want %s to be processed", conf.ID())
+	}
+
+	if triggered != 1 {
+		t.Errorf("want trigger to run once, got %d", triggered)
+	}
+
+	// Invalid globs abort the run
+	status = newCatalog("nginx[", pkg, config, service, other).Run()
+	if status.Err == nil {
+		t.Error("want error for invalid title glob")
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/dnaeon/gru/utils"
+)
+
+// DefaultStateFile is the default path to the state file.
+const DefaultStateFile = "/var/lib/gru/state.json"
+
+// StateVersion is the version of the state file format. It is
+// incremented whenever the format changes incompatibly.
+const StateVersion = 2
+
+// StateRetention is the period for which resources, which are no
+// longer declared in the catalog are kept in the state file.
+const StateRetention = 7 * 24 * time.Hour
+
+// Resource statuses recorded in the state file
+const (
+	ResourceUpToDate = "up-to-date"
+	ResourceChanged  = "changed"
+	ResourceFailed   = "failed"
+)
+
+// RunState type contains the outcome of a run, which is
+// recorded in the state file between runs.
+type RunState struct {
+	// Version of the state file format
+	Version int `json:"version"`
+
+	// RunID is the unique id of the run
+	RunID string `json:"run_id"`
+
+	// Module is the name of the module applied
+	Module string `json:"module"`
+
+	// ModuleDigest is the SHA256 checksum of the module applied
+	ModuleDigest string `json:"module_digest,omitempty"`
+
+	// Time the run finished at
+	Time time.Time `json:"time"`
+
+	// Failed contains the sorted ids of resources,
+	// which did not converge during the run
+	Failed []string `json:"failed"`
+
+	// Updates contains the pending package updates collected
+	// after the run, if collecting them was enabled
+	Updates *utils.PendingUpdates `json:"updates,omitempty"`
+
+	// Resources contains the last known state of
+	// resources, keyed by their ids
+	Resources map[string]*ResourceState `json:"resources,omitempty"`
+}
+
+// ResourceState type contains the last known state of a resource.
+type ResourceState struct {
+	// Type of the resource, e.g. "pkg"
+	ResourceType string `json:"type"`
+
+	// Title of the resource, e.g. "nginx"
+	ResourceTitle string `json:"title"`
+
+	// Attributes declared for the resource, with
+	// the values of sensitive attributes redacted
+	Attributes map[string]interface{} `json:"attributes"`
+
+	// Status of the resource after it was last evaluated,
+	// which is one of "up-to-date", "changed" or "failed"
+	Status string `json:"status,omitempty"`
+
+	// Action last taken for the resource, e.g. "create"
+	Action string `json:"action,omitempty"`
+
+	// Error encountered when the resource was last processed
+	Error string `json:"error,omitempty"`
+
+	// Time the resource was last evaluated at
+	LastEvaluated *time.Time `json:"last_evaluated,omitempty"`
+
+	// Time the resource was last changed at
+	LastChanged *time.Time `json:"last_changed,omitempty"`
+
+	// Time the resource was last declared in the catalog at. Resources,
+	// which are not declared for longer than StateRetention are removed.
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// newResourceState creates the state of a resource
+// declared in the catalog at the given time.
+func newResourceState(r resource.Resource, now time.Time) *ResourceState {
+	rs := &ResourceState{
+		Attributes: resource.Attributes(r),
+		LastSeen:   now,
+	}
+	rs.ResourceType, rs.ResourceTitle = splitID(r.ID())
+
+	return rs
+}
+
+// splitID splits a resource id, e.g. "pkg[nginx]", into the type
+// and the title of the resource. Ids which are not in that form
+// are returned as the type.
+func splitID(id string) (string, string) {
+	if i := strings.Index(id, "["); i != -1 && strings.HasSuffix(id, "]") {
+		return id[:i], id[i+1 : len(id)-1]
+	}
+
+	return id, ""
+}
+
+// ReadRunState reads the run state from the given state file.
+func ReadRunState(path string) (*RunState, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state RunState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %s", path, err)
+	}
+
+	return &state, nil
+}
+
+// WriteRunState writes the run state to the given state file.
+func WriteRunState(path string, state *RunState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(utils.DefaultFileSystem, path, append(data, '\n'), 0600, -1, -1)
+}
+
+// saveRunState records the outcome of the run in the state file,
+// if one is configured. The state of resources, which were not
+// processed during the run is carried over from the previous run.
+func (c *Catalog) saveRunState() {
+	if c.config.StateFile == "" || c.config.DryRun {
+		return
+	}
+
+	now := time.Now().UTC()
+	state := &RunState{
+		Version:      StateVersion,
+		RunID:        c.config.RunID,
+		Module:       c.config.Module,
+		ModuleDigest: c.moduleDigest,
+		Time:         now,
+		Failed:       make([]string, 0),
+		Resources:    make(map[string]*ResourceState),
+	}
+
+	c.status.RLock()
+	state.Updates = c.status.Updates
+	c.status.RUnlock()
+
+	// Keep resources from the previous run, which
+	// are no longer declared for a limited time only
+	if prev, err := ReadRunState(c.config.StateFile); err == nil {
+		for id, rs := range prev.Resources {
+			if _, ok := c.collection[id]; ok || now.Sub(rs.LastSeen) < StateRetention {
+				state.Resources[id] = rs
+			}
+		}
+	}
+
+	for id, r := range c.collection {
+		rs := newResourceState(r, now)
+		if prev, ok := state.Resources[id]; ok {
+			rs.Status = prev.Status
+			rs.Action = prev.Action
+			rs.Error = prev.Error
+			rs.LastEvaluated = prev.LastEvaluated
+			rs.LastChanged = prev.LastChanged
+		}
+		state.Resources[id] = rs
+	}
+
+	c.status.RLock()
+	for id, item := range c.status.Items {
+		if item.Err != nil {
+			state.Failed = append(state.Failed, id)
+		}
+
+		rs, ok := state.Resources[id]
+		if !ok {
+			continue
+		}
+
+		rs.Action = item.Action
+		rs.Error = ""
+		rs.LastEvaluated = &now
+		switch {
+		case item.Err != nil:
+			rs.Status = ResourceFailed
+			rs.Error = item.Err.Error()
+		case item.StateChanged:
+			rs.Status = ResourceChanged
+			rs.LastChanged = &now
+		default:
+			rs.Status = ResourceUpToDate
+		}
+	}
+	c.status.RUnlock()
+	sort.Strings(state.Failed)
+
+	if err := WriteRunState(c.config.StateFile, state); err != nil {
+		c.config.Logger.Printf("Unable to write state file: %s\n", err)
+		return
+	}
+
+	if c.config.HistoryRetention > 0 {
+		if err := recordHistory(c.config.StateFile, state, c.config.HistoryRetention); err != nil {
+			c.config.Logger.Printf("Unable to record run history: %s\n", err)
+		}
+	}
+}
+
+// selectFailed limits the resources processed during the run to
+// the ones, which failed during the previous run recorded in the
+// state file, along with their prerequisites and the resources they
+// subscribe to. All resources are processed if there is no previous run.
+func (c *Catalog) selectFailed() error {
+	state, err := ReadRunState(c.config.StateFile)
+	if os.IsNotExist(err) {
+		c.config.Logger.Printf("No previous run found in %s, processing all resources\n", c.config.StateFile)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Failed resources, which are no longer in the catalog are ignored
+	sorted := c.selectResources(state.Failed)
+	c.config.Logger.Printf("Retrying %d failed resources, processing %d of %d resources\n", len(state.Failed), len(sorted), len(c.sorted))
+	c.sorted = sorted
+
+	return nil
+}
@@ -0,0 +1,292 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestRetryFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	L := lua.NewState()
+	defer L.Close()
+
+	stateFile := filepath.Join(dir, "state", "state.json")
+	newCatalog := func(retryFailed bool, resources ...resource.Resource) *Catalog {
+		config := &Config{
+			Module:      "site",
+			Logger:      log.New(ioutil.Discard, "", 0),
+			L:           L,
+			Concurrency: 1,
+			StateFile:   stateFile,
+			RetryFailed: retryFailed,
+		}
+		katalog := New(config)
+
+		katalog.collection, err = resource.CreateCollection(resources)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		g, err := katalog.collection.DependencyGraph()
+		if err != nil {
+			t.Fatal(err)
+		}
+		katalog.reversed = g.Reversed()
+		katalog.sorted, err = g.Sort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return katalog
+	}
+
+	// Without a previous run all resources are processed
+	pkg := newFakeResource("pkg")
+	config := newFakeResource("config")
+	config.Require = []string{pkg.ID()}
+	config.evalErr = errors.New("invalid template")
+	service := newFakeResource("service")
+	service.Require = []string{config.ID()}
+	other := newFakeResource("other")
+
+	status := newCatalog(true, pkg, config, service, other).Run()
+	if totals := status.Totals(); totals.Changed != 2 || totals.Failed != 2 {
+		t.Errorf("want 2 changed and 2 failed resources, got %+v", totals)
+	}
+
+	state, err := ReadRunState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{config.ID(), service.ID()}
+	if !reflect.DeepEqual(want, state.Failed) {
+		t.Errorf("want failed resources %v, got %v", want, state.Failed)
+	}
+
+	// Only failed resources and their prerequisites are processed
+	config.evalErr = nil
+	for _, r := range []*fakeResource{pkg, config, service, other} {
+		r.actions = nil
+	}
+
+	status = newCatalog(true, pkg, config, service, other).Run()
+	if status.Err != nil {
+		t.Fatal(status.Err)
+	}
+
+	for _, r := range []*fakeResource{pkg, config, service} {
+		if _, ok := status.Items[r.ID()]; !ok {
+			t.Errorf("want %s to be processed", r.ID())
+		}
+	}
+
+	if _, ok := status.Items[other.ID()]; ok || len(other.actions) != 0 {
+		t.Errorf("want %s to be skipped, got %v", other.ID(), other.actions)
+	}
+
+	if got := strings.Join(config.actions, ","); got != "set" {
+		t.Errorf("want config to be set, got %q", got)
+	}
+
+	state, err = ReadRunState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(state.Failed) != 0 {
+		t.Errorf("want no failed resources, got %v", state.Failed)
+	}
+
+	// Nothing is left to retry
+	status = newCatalog(true, pkg, config, service, other).Run()
+	if len(status.Items) != 0 {
+		t.Errorf("want no resources processed, got %d", len(status.Items))
+	}
+
+	// Resources to which failed resources subscribe are processed
+	triggered := 0
+	trigger := L.NewFunction(func(L *lua.LState) int {
+		triggered++
+		return 0
+	})
+
+	conf := newFakeResource("conf")
+	daemon := newFakeResource("daemon")
+	daemon.Subscribe[conf.ID()] = trigger
+	daemon.evalErr = errors.New("unable to connect")
+
+	newCatalog(false, conf, daemon).Run()
+	daemon.evalErr = nil
+	conf.synced = false
+
+	status = newCatalog(true, conf, daemon).Run()
+	if status.Err != nil {
+		t.Fatal(status.Err)
+	}
+
+	for _, r := range []*fakeResource{conf, daemon} {
+		if item, ok := status.Items[r.ID()]; !ok || item.Err != nil {
+			t.Errorf("want %s to be processed", r.ID())
+		}
+	}
+
+	if triggered != 1 {
+		t.Errorf("want trigger to run once, got %d", triggered)
+	}
+
+	// Invalid state files abort the run
+	if err := ioutil.WriteFile(stateFile, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	status = newCatalog(true, pkg).Run()
+	if status.Err == nil {
+		t.Error("want error for invalid state file")
+	}
+}
+
+func TestRunStateResources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	L := lua.NewState()
+	defer L.Close()
+
+	module := filepath.Join(dir, "site.lua")
+	if err := ioutil.WriteFile(module, []byte("-- site"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stateFile := filepath.Join(dir, "state.json")
+	run := func(resources ...resource.Resource) *RunState {
+		katalog := New(&Config{
+			Module:      module,
+			Logger:      log.New(ioutil.Discard, "", 0),
+			L:           L,
+			Concurrency: 1,
+			StateFile:   stateFile,
+		})
+		if err := katalog.Load(); err != nil {
+			t.Fatal(err)
+		}
+		katalog.collection, err = resource.CreateCollection(resources)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := katalog.collection.DependencyGraph()
+		if err != nil {
+			t.Fatal(err)
+		}
+		katalog.reversed = g.Reversed()
+		katalog.sorted, err = g.Sort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		katalog.Run()
+		state, err := ReadRunState(stateFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return state
+	}
+
+	pkg := newFakeResource("pkg")
+	config := newFakeResource("config")
+	config.evalErr = errors.New("invalid template")
+
+	state := run(pkg, config)
+	if state.Version != StateVersion {
+		t.Errorf("want version %d, got %d", StateVersion, state.Version)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte("-- site"))); state.ModuleDigest != want {
+		t.Errorf("want module digest %s, got %s", want, state.ModuleDigest)
+	}
+
+	rs, ok := state.Resources[pkg.ID()]
+	if !ok {
+		t.Fatalf("want %s in state file", pkg.ID())
+	}
+	if rs.ResourceType != "fake" || rs.ResourceTitle != "pkg" {
+		t.Errorf("want type fake and title pkg, got %s and %s", rs.ResourceType, rs.ResourceTitle)
+	}
+	if rs.Status != ResourceChanged || rs.LastChanged == nil || rs.LastEvaluated == nil {
+		t.Errorf("want %s to be changed, got %+v", pkg.ID(), rs)
+	}
+	if rs.Attributes["state"] != "present" {
+		t.Errorf("want state attribute, got %v", rs.Attributes)
+	}
+
+	rs = state.Resources[config.ID()]
+	if rs == nil || rs.Status != ResourceFailed || rs.Error != "invalid template" || rs.LastChanged != nil {
+		t.Errorf("want %s to be failed, got %+v", config.ID(), rs)
+	}
+
+	// Resources no longer declared are kept for a limited time
+	lastChanged := *state.Resources[pkg.ID()].LastChanged
+	state = run(pkg)
+	rs = state.Resources[pkg.ID()]
+	if rs.Status != ResourceUpToDate || !rs.LastChanged.Equal(lastChanged) {
+		t.Errorf("want %s to be up-to-date and changed at %s, got %+v", pkg.ID(), lastChanged, rs)
+	}
+	if _, ok := state.Resources[config.ID()]; !ok {
+		t.Errorf("want %s to be kept in state file", config.ID())
+	}
+
+	state.Resources[config.ID()].LastSeen = time.Now().Add(-StateRetention)
+	if err := WriteRunState(stateFile, state); err != nil {
+		t.Fatal(err)
+	}
+
+	state = run(pkg)
+	if _, ok := state.Resources[config.ID()]; ok {
+		t.Errorf("want %s to be removed from state file", config.ID())
+	}
+}
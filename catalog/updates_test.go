@@ -0,0 +1,126 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/classifier"
+	"github.com/dnaeon/gru/resource"
+	"github.com/dnaeon/gru/utils"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestCollectUpdates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake apt reporting a single security update
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		if strings.Join(spec.Args, " ") != "apt list --upgradable" {
+			return utils.CommandResult{ExitCode: -1}, utils.ErrCommandNotFound
+		}
+		out := "Listing...\nopenssl/jammy-security 3.0.2-0ubuntu1.10 amd64 [upgradable from: 3.0.2-0ubuntu1.9]\n"
+		return utils.CommandResult{Stdout: []byte(out)}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+	defer classifier.SetPendingUpdates(nil)
+
+	L := lua.NewState()
+	defer L.Close()
+
+	stateFile := filepath.Join(dir, "state.json")
+	config := &Config{
+		Module:         "site",
+		Logger:         log.New(ioutil.Discard, "", 0),
+		L:              L,
+		Concurrency:    1,
+		StateFile:      stateFile,
+		CollectUpdates: true,
+	}
+	katalog := New(config)
+
+	pkg := newFakeResource("pkg")
+	katalog.collection, err = resource.CreateCollection([]resource.Resource{pkg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := katalog.collection.DependencyGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	katalog.reversed = g.Reversed()
+	katalog.sorted, err = g.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := katalog.Run()
+	if status.Err != nil {
+		t.Fatal(status.Err)
+	}
+
+	want := &utils.PendingUpdates{
+		Manager:  "apt",
+		Packages: []string{"openssl"},
+		Security: []string{"openssl"},
+	}
+	if totals := status.Totals(); !reflect.DeepEqual(want, totals.Updates) {
+		t.Errorf("want updates %+v in totals, got %+v", want, totals.Updates)
+	}
+
+	state, err := ReadRunState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(want, state.Updates) {
+		t.Errorf("want updates %+v in state file, got %+v", want, state.Updates)
+	}
+
+	klassifier, err := classifier.Get("security_updates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if klassifier.Value != "1" {
+		t.Errorf("want 1 security update, got %s", klassifier.Value)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// varOverrides type contains the variables overridden for a run.
+//
+// Overridden variables are not stored in the Lua globals table,
+// but are provided by a metatable on it instead. This way any
+// assignment to an overridden global variable in a module is
+// intercepted, which allows the override to take precedence
+// over the value declared in the module.
+type varOverrides struct {
+	// Values of the overridden variables as provided
+	raw map[string]string
+
+	// Values of the overridden variables converted to Lua values
+	values map[string]lua.LValue
+
+	// Variables which have been declared by the module
+	declared map[string]bool
+
+	// Variables which have been read by the module
+	read map[string]bool
+}
+
+// newVarOverrides installs the overrides for the given variables
+// in the globals table of the Lua state.
+func newVarOverrides(L *lua.LState, vars map[string]string) *varOverrides {
+	vo := &varOverrides{
+		raw:      make(map[string]string),
+		values:   make(map[string]lua.LValue),
+		declared: make(map[string]bool),
+		read:     make(map[string]bool),
+	}
+
+	if len(vars) == 0 {
+		return vo
+	}
+
+	globals := L.G.Global
+	for name, value := range vars {
+		vo.raw[name] = value
+		vo.values[name] = guessLuaValue(value)
+		globals.RawSetString(name, lua.LNil)
+	}
+
+	mt := L.NewTable()
+	mt.RawSetString("__index", L.NewFunction(vo.luaIndex))
+	mt.RawSetString("__newindex", L.NewFunction(vo.luaNewIndex))
+	L.SetMetatable(globals, mt)
+
+	return vo
+}
+
+// luaIndex returns the value of an overridden variable.
+func (vo *varOverrides) luaIndex(L *lua.LState) int {
+	key := L.CheckAny(2)
+	if name, ok := key.(lua.LString); ok {
+		if value, ok := vo.values[string(name)]; ok {
+			vo.read[string(name)] = true
+			L.Push(value)
+			return 1
+		}
+	}
+
+	L.Push(lua.LNil)
+	return 1
+}
+
+// luaNewIndex ignores assignments to overridden variables and
+// converts the overridden value to the type of the assigned value.
+func (vo *varOverrides) luaNewIndex(L *lua.LState) int {
+	table := L.CheckTable(1)
+	key := L.CheckAny(2)
+	value := L.CheckAny(3)
+
+	name, ok := key.(lua.LString)
+	if !ok {
+		table.RawSet(key, value)
+		return 0
+	}
+
+	raw, ok := vo.raw[string(name)]
+	if !ok {
+		table.RawSet(key, value)
+		return 0
+	}
+
+	vo.declared[string(name)] = true
+	switch value.(type) {
+	case lua.LString:
+		vo.values[string(name)] = lua.LString(raw)
+	case lua.LNumber:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			L.RaiseError("variable %s: cannot use %q as a number", name, raw)
+		}
+		vo.values[string(name)] = lua.LNumber(n)
+	case lua.LBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			L.RaiseError("variable %s: cannot use %q as a boolean", name, raw)
+		}
+		vo.values[string(name)] = lua.LBool(b)
+	}
+
+	return 0
+}
+
+// undeclared returns the sorted names of the overridden
+// variables, which have not been declared by the module.
+func (vo *varOverrides) undeclared() []string {
+	names := make([]string, 0)
+	for name := range vo.raw {
+		if !vo.declared[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// readValues returns the provided values of the
+// overridden variables, which have been read by the module.
+func (vo *varOverrides) readValues() map[string]string {
+	values := make(map[string]string)
+	for name := range vo.read {
+		values[name] = vo.raw[name]
+	}
+
+	return values
+}
+
+// guessLuaValue converts the value of a variable, which has not
+// been declared yet, to a boolean or number if it looks like one.
+func guessLuaValue(value string) lua.LValue {
+	switch value {
+	case "true":
+		return lua.LTrue
+	case "false":
+		return lua.LFalse
+	}
+
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		return lua.LNumber(n)
+	}
+
+	return lua.LString(value)
+}
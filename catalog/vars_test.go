@@ -0,0 +1,95 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package catalog
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestVarOverrides(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	vars := map[string]string{
+		"port":    "8080",
+		"enabled": "false",
+		"name":    "123",
+		"extra":   "true",
+	}
+	overrides := newVarOverrides(L, vars)
+
+	code := `
+	port = 80
+	enabled = true
+	name = "default"
+	other = "other"
+
+	if port ~= 8080 then
+	   error("want port 8080, got " .. tostring(port))
+	end
+
+	if enabled ~= false then
+	   error("want enabled false, got " .. tostring(enabled))
+	end
+
+	if name ~= "123" then
+	   error("want name '123', got " .. tostring(name))
+	end
+
+	if extra ~= true then
+	   error("want extra true, got " .. tostring(extra))
+	end
+
+	if other ~= "other" then
+	   error("want other 'other', got " .. tostring(other))
+	end
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	undeclared := overrides.undeclared()
+	if len(undeclared) != 1 || undeclared[0] != "extra" {
+		t.Errorf("want undeclared [extra], got %v", undeclared)
+	}
+
+	if read := overrides.readValues(); len(read) != len(vars) {
+		t.Errorf("want all variables read, got %v", read)
+	}
+}
+
+func TestVarOverridesInvalidType(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	newVarOverrides(L, map[string]string{"port": "http"})
+	if err := L.DoString("port = 80"); err == nil {
+		t.Error("want error when overriding a number with a non-numeric value")
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package classifier
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// pendingUpdates contains the pending updates last collected
+// during a catalog run, if collecting updates is enabled
+var pendingUpdates struct {
+	sync.RWMutex
+	updates *utils.PendingUpdates
+}
+
+func init() {
+	Register("pending_updates", pendingUpdatesProvider)
+	Register("security_updates", securityUpdatesProvider)
+	Register("reboot_required", rebootRequiredProvider)
+}
+
+// SetPendingUpdates records the pending updates collected
+// during a catalog run, which are then reported as classifiers.
+func SetPendingUpdates(u *utils.PendingUpdates) {
+	pendingUpdates.Lock()
+	defer pendingUpdates.Unlock()
+
+	pendingUpdates.updates = u
+}
+
+// withPendingUpdates evaluates a classifier from the pending updates.
+// ErrClassifierNotFound is returned if no updates have been collected.
+func withPendingUpdates(f func(u *utils.PendingUpdates) string) (string, error) {
+	pendingUpdates.RLock()
+	defer pendingUpdates.RUnlock()
+
+	if pendingUpdates.updates == nil {
+		return "", ErrClassifierNotFound
+	}
+
+	return f(pendingUpdates.updates), nil
+}
+
+func pendingUpdatesProvider() (string, error) {
+	return withPendingUpdates(func(u *utils.PendingUpdates) string {
+		return strconv.Itoa(len(u.Packages))
+	})
+}
+
+func securityUpdatesProvider() (string, error) {
+	return withPendingUpdates(func(u *utils.PendingUpdates) string {
+		return strconv.Itoa(len(u.Security))
+	})
+}
+
+func rebootRequiredProvider() (string, error) {
+	return withPendingUpdates(func(u *utils.PendingUpdates) string {
+		return strconv.FormatBool(u.RebootRequired)
+	})
+}
@@ -66,4 +66,20 @@ type Client interface {
 
 	// Submits a new task to a minion
 	MinionSubmitTask(m uuid.UUID, t *task.Task) error
+
+	// Submits a catalog to be applied by the given minions
+	SubmitCatalog(r *task.CatalogRun, minions []uuid.UUID) error
+
+	// Submits a catalog to be applied by all minions
+	// classified with the given classifier value
+	SubmitCatalogWithClassifier(r *task.CatalogRun, key, value string) error
+
+	// Gets the catalogs pushed to a minion, which it has not applied yet
+	MinionPendingCatalogs(m uuid.UUID) ([]*task.CatalogRun, error)
+
+	// Gets the results of catalog runs of a minion, which have not expired yet
+	MinionCatalogResults(m uuid.UUID) ([]*task.CatalogResult, error)
+
+	// Gets the result of the last catalog run of a minion
+	MinionLastCatalogResult(m uuid.UUID) (*task.CatalogResult, error)
 }
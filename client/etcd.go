@@ -28,9 +28,12 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"sync"
 
@@ -380,3 +383,142 @@ func (c *etcdMinionClient) MinionSubmitTask(m uuid.UUID, t *task.Task) error {
 
 	return err
 }
+
+// submitCatalog stores a catalog under the given key in etcd
+func (c *etcdMinionClient) submitCatalog(r *task.CatalogRun, key string) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	opts := &etcdclient.SetOptions{
+		PrevExist: etcdclient.PrevIgnore,
+	}
+
+	_, err = c.kapi.Set(context.Background(), key, string(data), opts)
+
+	return err
+}
+
+// SubmitCatalog submits a catalog to be applied by the given minions.
+// Minions which are offline apply the catalog once they are back.
+func (c *etcdMinionClient) SubmitCatalog(r *task.CatalogRun, minions []uuid.UUID) error {
+	for _, m := range minions {
+		if err := c.submitCatalog(r, minion.EtcdMinionCatalogKey(m)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SubmitCatalogWithClassifier submits a catalog to be applied by all
+// minions classified with the given classifier value, including
+// minions classified with it later on
+func (c *etcdMinionClient) SubmitCatalogWithClassifier(r *task.CatalogRun, key, value string) error {
+	if key == "" || value == "" {
+		return errors.New("missing classifier key or value")
+	}
+
+	return c.submitCatalog(r, minion.EtcdClassifierCatalogKey(key, value))
+}
+
+// MinionPendingCatalogs returns the catalogs pushed to a minion,
+// either directly or through its classifiers, which the minion
+// has not applied yet
+func (c *etcdMinionClient) MinionPendingCatalogs(m uuid.UUID) ([]*task.CatalogRun, error) {
+	keys := []string{minion.EtcdMinionCatalogKey(m)}
+
+	classifierKeys, err := c.MinionClassifierKeys(m)
+	if err != nil && !etcdclient.IsKeyNotFound(err) {
+		return nil, err
+	}
+
+	for _, key := range classifierKeys {
+		klassifier, err := c.MinionClassifier(m, key)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, minion.EtcdClassifierCatalogKey(klassifier.Key, klassifier.Value))
+	}
+
+	var pending []*task.CatalogRun
+	for _, key := range keys {
+		resp, err := c.kapi.Get(context.Background(), key, nil)
+		if etcdclient.IsKeyNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := minion.EtcdUnmarshalCatalogRun(resp.Node)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err = c.kapi.Get(context.Background(), minion.EtcdAppliedCatalogKey(m, key), nil)
+		if err != nil && !etcdclient.IsKeyNotFound(err) {
+			return nil, err
+		}
+
+		if err == nil && resp.Node.Value == r.ID.String() {
+			continue
+		}
+
+		pending = append(pending, r)
+	}
+
+	return pending, nil
+}
+
+// MinionCatalogResults returns the results of catalog runs of a minion,
+// which have not expired yet, ordered by the time they were received
+func (c *etcdMinionClient) MinionCatalogResults(m uuid.UUID) ([]*task.CatalogResult, error) {
+	resultDir := filepath.Join(minion.EtcdResultSpace, m.String())
+	opts := &etcdclient.GetOptions{
+		Recursive: true,
+	}
+
+	resp, err := c.kapi.Get(context.Background(), resultDir, opts)
+	if etcdclient.IsKeyNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*task.CatalogResult
+	for _, node := range resp.Node.Nodes {
+		result, err := minion.EtcdUnmarshalCatalogResult(node)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].TimeReceived < results[j].TimeReceived
+	})
+
+	return results, nil
+}
+
+// MinionLastCatalogResult returns the result of the last catalog run of a minion
+func (c *etcdMinionClient) MinionLastCatalogResult(m uuid.UUID) (*task.CatalogResult, error) {
+	results, err := c.MinionCatalogResults(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no catalog results found for minion %s", m)
+	}
+
+	return results[len(results)-1], nil
+}
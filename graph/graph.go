@@ -29,9 +29,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
-
-	mapset "github.com/deckarep/golang-set"
 )
 
 // ErrCircularDependency is returned when the graph cannot be
@@ -77,7 +76,9 @@ func (g *Graph) GetNode(name string) (*Node, bool) {
 // https://en.wikipedia.org/wiki/Topological_sorting
 //
 // If the graph can be topologically sorted the result will
-// contain the sorted nodes.
+// contain the sorted nodes. Nodes at the same level, i.e. which
+// become ready at the same time, are sorted by name, so that
+// the result is the same for the same graph.
 //
 // If the graph cannot be sorted in case of circular dependencies,
 // then the result will contain the remaining nodes from the graph,
@@ -85,57 +86,97 @@ func (g *Graph) GetNode(name string) (*Node, bool) {
 func (g *Graph) Sort() ([]*Node, error) {
 	var sorted []*Node
 
-	// Iteratively find and remove nodes from the graph which have no edges.
-	// If at some point there are still nodes in the graph and we cannot find
-	// nodes without edges, that means we have a circular dependency
-	for len(g.Nodes) > 0 {
-		// Contains the ready nodes, which have no edges to other nodes
-		ready := mapset.NewSet()
-
-		// Find the nodes with no edges
-		for _, node := range g.Nodes {
-			if len(node.Edges) == 0 {
-				ready.Add(node)
-			}
+	// Number of distinct edges of each node to nodes, which have
+	// not been sorted yet, and the nodes having edges to each node
+	pending := make(map[*Node]int, len(g.Nodes))
+	dependents := make(map[*Node][]*Node, len(g.Nodes))
+	for _, node := range g.Nodes {
+		for _, edge := range uniqueNodes(node.Edges) {
+			pending[node]++
+			dependents[edge] = append(dependents[edge], node)
 		}
+	}
 
-		// If there aren't any ready nodes, then we have a cicular dependency
-		if ready.Cardinality() == 0 {
-			// The remaining nodes in the graph are the ones causing the
-			// circular dependency.
-			var remaining []*Node
-			for _, n := range g.Nodes {
-				remaining = append(remaining, n)
-			}
-			return remaining, ErrCircularDependency
+	// Find the nodes with no edges
+	var ready []*Node
+	for _, node := range g.Nodes {
+		if pending[node] == 0 {
+			ready = append(ready, node)
 		}
+	}
 
-		// Remove the ready nodes and add them to the sorted result
-		for item := range ready.Iter() {
-			node := item.(*Node)
+	// Iteratively remove the ready nodes from the graph, which makes
+	// the nodes having edges only to them ready in turn. If at some
+	// point there are still nodes in the graph and none of them are
+	// ready, that means we have a circular dependency
+	for len(ready) > 0 {
+		var next []*Node
+		sortByName(ready)
+		for _, node := range ready {
 			delete(g.Nodes, node.Name)
+			node.Edges = node.Edges[:0]
+			pending[node] = -1
 			sorted = append(sorted, node)
 		}
 
-		// Remove ready nodes from the remaining node edges as well
-		for _, node := range g.Nodes {
-			// Add the remaining nodes in a set
-			currentEdgeSet := mapset.NewSet()
-			for _, edge := range node.Edges {
-				currentEdgeSet.Add(edge)
+		for _, node := range ready {
+			for _, dependent := range dependents[node] {
+				pending[dependent]--
+				if pending[dependent] == 0 {
+					next = append(next, dependent)
+				}
 			}
+		}
+
+		ready = next
+	}
 
-			newEdgeSet := currentEdgeSet.Difference(ready)
-			node.Edges = make([]*Node, 0)
-			for edge := range newEdgeSet.Iter() {
-				node.Edges = append(node.Edges, edge.(*Node))
+	if len(g.Nodes) > 0 {
+		// The remaining nodes in the graph are the ones causing the
+		// circular dependency. Edges to sorted nodes are removed.
+		var remaining []*Node
+		for _, n := range g.Nodes {
+			edges := make([]*Node, 0, len(n.Edges))
+			for _, edge := range uniqueNodes(n.Edges) {
+				if pending[edge] != -1 {
+					edges = append(edges, edge)
+				}
 			}
+			n.Edges = edges
+			remaining = append(remaining, n)
 		}
+		sortByName(remaining)
+		return remaining, ErrCircularDependency
 	}
 
 	return sorted, nil
 }
 
+// sortByName sorts the nodes by their names.
+func sortByName(nodes []*Node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+}
+
+// uniqueNodes returns the distinct nodes from the given list.
+func uniqueNodes(nodes []*Node) []*Node {
+	if len(nodes) < 2 {
+		return nodes
+	}
+
+	seen := make(map[*Node]bool, len(nodes))
+	unique := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		if !seen[node] {
+			seen[node] = true
+			unique = append(unique, node)
+		}
+	}
+
+	return unique
+}
+
 // AsDot generates a DOT representation for the graph
 // https://en.wikipedia.org/wiki/DOT_(graph_description_language)
 func (g *Graph) AsDot(name string, w io.Writer) {
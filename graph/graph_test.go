@@ -27,6 +27,7 @@ package graph
 
 import (
 	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -124,8 +125,138 @@ func TestCircularGraph(t *testing.T) {
 	g.AddEdge(nodes["D"], nodes["E"])
 	g.AddEdge(nodes["E"], nodes["D"])
 
-	_, err := g.Sort()
+	remaining, err := g.Sort()
 	if err != ErrCircularDependency {
 		t.Errorf("want a circular dependency error, got %s", err)
 	}
+
+	// The remaining nodes keep their edges to each other only
+	wantEdges := map[string][]string{
+		"B": {"C"},
+		"C": {"D"},
+		"D": {"E"},
+		"E": {"D"},
+	}
+
+	gotEdges := make(map[string][]string)
+	for _, node := range remaining {
+		gotEdges[node.Name] = make([]string, 0)
+		for _, edge := range node.Edges {
+			gotEdges[node.Name] = append(gotEdges[node.Name], edge.Name)
+		}
+	}
+
+	if !reflect.DeepEqual(wantEdges, gotEdges) {
+		t.Errorf("want remaining nodes %q, got %q", wantEdges, gotEdges)
+	}
+}
+
+func TestSortLevels(t *testing.T) {
+	g := New()
+
+	nodes := make(map[string]*Node)
+	for _, name := range []string{"A", "B", "C", "D"} {
+		n := NewNode(name)
+		nodes[name] = n
+		g.AddNode(n)
+	}
+
+	// Connect the nodes in the graph, with a duplicate edge
+	//
+	// A
+	// B -> A
+	// C -> A, A
+	// D -> B, C
+	//
+	g.AddEdge(nodes["B"], nodes["A"])
+	g.AddEdge(nodes["C"], nodes["A"], nodes["A"])
+	g.AddEdge(nodes["D"], nodes["B"], nodes["C"])
+
+	sorted, err := g.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nodes are sorted level by level
+	levels := map[string]int{"A": 0, "B": 1, "C": 1, "D": 2}
+	if len(sorted) != len(levels) {
+		t.Fatalf("want %d nodes, got %d", len(levels), len(sorted))
+	}
+
+	for i := 1; i < len(sorted); i++ {
+		if levels[sorted[i-1].Name] > levels[sorted[i].Name] {
+			t.Errorf("node %s sorted before %s", sorted[i-1].Name, sorted[i].Name)
+		}
+	}
+
+	if len(g.Nodes) != 0 {
+		t.Errorf("want all nodes removed from the graph, got %d", len(g.Nodes))
+	}
+}
+
+func TestSortDeterministic(t *testing.T) {
+	// Connect the nodes in the graph
+	//
+	// A
+	// B
+	// C -> A
+	// D -> A
+	// E -> C, D
+	//
+	edges := map[string][]string{
+		"C": {"A"},
+		"D": {"A"},
+		"E": {"C", "D"},
+	}
+
+	want := []string{"A", "B", "C", "D", "E"}
+	for i := 0; i < 20; i++ {
+		g := New()
+		nodes := make(map[string]*Node)
+		for _, name := range []string{"E", "D", "C", "B", "A"} {
+			n := NewNode(name)
+			nodes[name] = n
+			g.AddNode(n)
+		}
+		for name, deps := range edges {
+			for _, dep := range deps {
+				g.AddEdge(nodes[name], nodes[dep])
+			}
+		}
+
+		sorted, err := g.Sort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, node := range sorted {
+			got = append(got, node.Name)
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+	}
+}
+
+func BenchmarkSortChain(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		g := New()
+		var prev *Node
+		for j := 0; j < 10000; j++ {
+			n := NewNode(strconv.Itoa(j))
+			g.AddNode(n)
+			if prev != nil {
+				g.AddEdge(n, prev)
+			}
+			prev = n
+		}
+		b.StartTimer()
+
+		if _, err := g.Sort(); err != nil {
+			b.Fatal(err)
+		}
+	}
 }
@@ -26,11 +26,19 @@
 package command
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
 
 	"github.com/dnaeon/gru/catalog"
+	"github.com/dnaeon/gru/remote"
+	"github.com/dnaeon/gru/resource"
+	"github.com/dnaeon/gru/utils"
 	"github.com/urfave/cli"
 	"github.com/yuin/gopher-lua"
 )
@@ -46,18 +54,166 @@ func NewApplyCommand() cli.Command {
 			cli.StringFlag{
 				Name:   "siterepo",
 				Value:  "",
-				Usage:  "path/url to the site repo",
+				Usage:  "path/url to the site repo, http(s) or s3 url to a .tar.gz archive of it, or git url with an optional #ref",
 				EnvVar: "GRU_SITEREPO",
 			},
+			cli.StringFlag{
+				Name:   "siterepo-token",
+				Usage:  "token used to authenticate when fetching the site repo from git over http(s)",
+				EnvVar: "GRU_SITEREPO_TOKEN",
+			},
+			cli.StringFlag{
+				Name:  "siterepo-cache",
+				Value: filepath.Join(os.TempDir(), "gru-siterepo-cache"),
+				Usage: "directory in which site repos fetched from git, or archives with a checksum, are cached between runs",
+			},
+			cli.IntFlag{
+				Name:  "siterepo-depth",
+				Usage: "depth of the history fetched from git, 0 fetches only the requested commit, -1 the full history",
+			},
+			cli.StringFlag{
+				Name:  "siterepo-checksum",
+				Usage: "checksum of the site repo archive, e.g. sha256:<digest>",
+			},
+			cli.BoolFlag{
+				Name:  "verify-site-manifest",
+				Usage: "verify the site data against the site manifest before applying",
+			},
+			cli.StringFlag{
+				Name:  "site-manifest-digest",
+				Usage: "expected sha256 digest of the site manifest",
+			},
+			cli.StringFlag{
+				Name:  "module-checksum",
+				Usage: "checksum of a module fetched over http(s), e.g. sha256:<digest>",
+			},
 			cli.BoolFlag{
 				Name:  "dry-run",
 				Usage: "just report what would be done, instead of doing it",
 			},
+			cli.BoolFlag{
+				Name:  "diff",
+				Usage: "show the changes to be made to files as a diff",
+			},
+			cli.BoolFlag{
+				Name:  "json-summary",
+				Usage: "write the summary of the run to stdout as JSON",
+			},
+			cli.StringFlag{
+				Name:  "verbosity",
+				Value: "normal",
+				Usage: "level of events logged for resources, either quiet, normal or debug",
+			},
 			cli.IntFlag{
 				Name:  "concurrency",
 				Usage: "number of goroutines used for concurrent processing",
 				Value: runtime.NumCPU(),
 			},
+			cli.IntFlag{
+				Name:  "prefetch-workers",
+				Usage: "number of workers used to prefetch remote file sources, 0 disables prefetching",
+			},
+			cli.StringFlag{
+				Name:  "source-cache",
+				Usage: "directory in which remote file sources are cached between runs, and only downloaded again if they changed",
+			},
+			cli.StringFlag{
+				Name:  "user-resolver",
+				Value: "os",
+				Usage: "resolver used to look up file owners, either os or getent to query all nsswitch databases",
+			},
+			cli.BoolFlag{
+				Name:  "skip-ownership-when-unprivileged",
+				Usage: "warn about file ownership mismatches instead of failing, when not running as root",
+			},
+			cli.StringFlag{
+				Name:  "pre-apply-script",
+				Usage: "shell script to execute before processing resources",
+			},
+			cli.StringFlag{
+				Name:  "post-apply-script",
+				Usage: "shell script to execute after processing resources",
+			},
+			cli.StringFlag{
+				Name:  "run-lock",
+				Usage: "path to the lock file held during the run, shared with minions serving runs",
+			},
+			cli.StringFlag{
+				Name:  "state-file",
+				Value: catalog.DefaultStateFile,
+				Usage: "record the outcome of the run and the state of resources in the given state file",
+			},
+			cli.IntFlag{
+				Name:  "history-retention",
+				Value: catalog.DefaultHistoryRetention,
+				Usage: "number of runs kept in the history next to the state file, 0 keeps no history",
+			},
+			cli.BoolFlag{
+				Name:  "retry-failed",
+				Usage: "only process the resources which failed during the previous run recorded in the state file",
+			},
+			cli.StringFlag{
+				Name:  "title",
+				Usage: "only process the resources whose title matches the given glob, e.g. nginx*, and their prerequisites",
+			},
+			cli.StringFlag{
+				Name:  "save-plan",
+				Usage: "write the actions planned for resources to the given file instead of applying them",
+			},
+			cli.StringFlag{
+				Name:  "plan",
+				Usage: "apply the plan saved to the given file, aborting if anything has changed since it was saved",
+			},
+			cli.BoolFlag{
+				Name:  "collect-updates",
+				Usage: "collect pending package updates and whether a reboot is required after processing resources",
+			},
+			cli.StringFlag{
+				Name:  "secrets-file",
+				Usage: "encrypted file from which secrets referenced as secret(\"file:name\") are resolved",
+			},
+			cli.StringFlag{
+				Name:  "secrets-key-file",
+				Usage: "file containing the key of the encrypted secrets file",
+			},
+			cli.StringFlag{
+				Name:  "hosts-file",
+				Usage: "hosts file classifying hosts into roles, whose modules are loaded after the optional module",
+			},
+			cli.StringFlag{
+				Name:  "host",
+				Usage: "name of the host classified using the hosts file, defaults to the hostname",
+			},
+			cli.StringSliceFlag{
+				Name:  "var",
+				Usage: "override a variable declared by the module, e.g. --var key=value",
+			},
+			cli.StringFlag{
+				Name:  "ssh",
+				Usage: "apply the configuration on remote hosts over ssh instead, e.g. --ssh admin@web1,web2:2222",
+			},
+			cli.IntFlag{
+				Name:  "forks",
+				Value: remote.DefaultForks,
+				Usage: "number of remote hosts processed concurrently",
+			},
+			cli.DurationFlag{
+				Name:  "ssh-timeout",
+				Usage: "timeout for processing a single remote host, 0 means no timeout",
+			},
+			cli.StringFlag{
+				Name:  "ssh-binary",
+				Usage: "local gructl binary copied to the remote hosts, if empty gructl must be installed there",
+			},
+			cli.StringFlag{
+				Name:  "ssh-host-key-checking",
+				Value: remote.HostKeyCheckingStrict,
+				Usage: "host key checking policy, either yes, accept-new or no",
+			},
+			cli.BoolFlag{
+				Name:  "ssh-no-sudo",
+				Usage: "do not use sudo when applying the configuration on remote hosts",
+			},
 		},
 	}
 
@@ -66,27 +222,150 @@ func NewApplyCommand() cli.Command {
 
 // Executes the "apply" command
 func execApplyCommand(c *cli.Context) error {
-	if len(c.Args()) < 1 {
+	if len(c.Args()) < 1 && c.String("hosts-file") == "" {
 		return cli.NewExitError(errNoModuleName.Error(), 64)
 	}
 
+	if c.Bool("retry-failed") && c.String("state-file") == "" {
+		return cli.NewExitError(errNoStateFile.Error(), 64)
+	}
+
+	if c.String("save-plan") != "" && c.String("plan") != "" {
+		return cli.NewExitError(errPlanConflict.Error(), 64)
+	}
+
+	if c.String("ssh") != "" {
+		if c.String("save-plan") != "" || c.String("plan") != "" {
+			return cli.NewExitError(errRemotePlan.Error(), 64)
+		}
+		return execRemoteApply(c)
+	}
+
+	var plan *catalog.Plan
+	if path := c.String("plan"); path != "" {
+		p, err := catalog.ReadPlan(path)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		plan = p
+	}
+
 	concurrency := c.Int("concurrency")
 	if concurrency < 0 {
 		concurrency = runtime.NumCPU()
 	}
 
+	vars, err := parseVars(c.StringSlice("var"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 64)
+	}
+
+	verbosity, err := resource.ParseVerbosity(c.String("verbosity"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 64)
+	}
+
+	users, err := utils.ParseUserResolver(c.String("user-resolver"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 64)
+	}
+
+	siteRepo := c.String("siterepo")
+	siteRevision := ""
+	switch {
+	case utils.IsGitURL(siteRepo):
+		source := utils.ParseGitSource(siteRepo)
+		source.Token = c.String("siterepo-token")
+		source.Depth = c.Int("siterepo-depth")
+
+		dir := source.CacheDir(c.String("siterepo-cache"))
+		siteRevision, err = source.Sync(context.Background(), dir)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		siteRepo = dir
+	case utils.IsRemoteURL(siteRepo) && c.String("siterepo-checksum") != "":
+		// Archives are cached by checksum, so that
+		// they are not fetched again on later runs
+		siteRevision = c.String("siterepo-checksum")
+		siteRepo, err = utils.FetchArchiveCached(context.Background(), siteRepo, siteRevision, c.String("siterepo-cache"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	case utils.IsRemoteURL(siteRepo):
+		// The archive is extracted into a private directory,
+		// which is removed once the configuration is applied
+		dir, err := ioutil.TempDir("", "gru-siterepo")
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		defer os.RemoveAll(dir)
+
+		if err := utils.FetchArchive(context.Background(), siteRepo, "", dir); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		siteRepo = dir
+	}
+
+	// Remote file sources are prefetched into a private
+	// directory, which is removed once the configuration is applied,
+	// unless they are cached between runs
+	prefetchWorkers := c.Int("prefetch-workers")
+	sourceCacheDir := c.String("source-cache")
+	if prefetchWorkers > 0 && sourceCacheDir == "" {
+		sourceCacheDir, err = ioutil.TempDir("", "gru-sources")
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		defer os.RemoveAll(sourceCacheDir)
+	}
+
+	secrets := resource.DefaultSecretBackends()
+	if path := c.String("secrets-file"); path != "" {
+		if c.String("secrets-key-file") == "" {
+			return cli.NewExitError(errNoSecretsKeyFile.Error(), 64)
+		}
+		secrets["file"] = &resource.FileSecretBackend{
+			Path:    path,
+			KeyFile: c.String("secrets-key-file"),
+		}
+	}
+
 	L := lua.NewState()
 	defer L.Close()
 
 	logger := log.New(os.Stdout, "", log.LstdFlags)
 
 	config := &catalog.Config{
-		Module:      c.Args()[0],
-		DryRun:      c.Bool("dry-run"),
-		Logger:      logger,
-		SiteRepo:    c.String("siterepo"),
-		L:           L,
-		Concurrency: concurrency,
+		Module:                        c.Args().First(),
+		ModuleChecksum:                c.String("module-checksum"),
+		DryRun:                        c.Bool("dry-run"),
+		ShowDiff:                      c.Bool("diff"),
+		Logger:                        logger,
+		SiteRepo:                      siteRepo,
+		SiteRevision:                  siteRevision,
+		VerifySiteManifest:            c.Bool("verify-site-manifest") || c.String("site-manifest-digest") != "",
+		SiteManifestDigest:            c.String("site-manifest-digest"),
+		L:                             L,
+		Concurrency:                   concurrency,
+		Verbosity:                     verbosity,
+		SkipOwnershipWhenUnprivileged: c.Bool("skip-ownership-when-unprivileged"),
+		UserResolver:                  users,
+		Vars:                          vars,
+		PreApplyScript:                c.String("pre-apply-script"),
+		PostApplyScript:               c.String("post-apply-script"),
+		SourceCacheDir:                sourceCacheDir,
+		RevalidateSources:             c.String("source-cache") != "",
+		StateFile:                     c.String("state-file"),
+		RetryFailed:                   c.Bool("retry-failed"),
+		HistoryRetention:              c.Int("history-retention"),
+		TitleGlob:                     c.String("title"),
+		CollectUpdates:                c.Bool("collect-updates"),
+		PlanFile:                      c.String("save-plan"),
+		Plan:                          plan,
+		SecretBackends:                secrets,
+		HostsFile:                     c.String("hosts-file"),
+		Host:                          c.String("host"),
 	}
 
 	katalog := catalog.New(config)
@@ -96,8 +375,99 @@ func execApplyCommand(c *cli.Context) error {
 		}
 	}
 
+	if prefetchWorkers > 0 {
+		if err := katalog.PrefetchSources(context.Background(), prefetchWorkers); err != nil {
+			logger.Printf("%s\n", err)
+		}
+	}
+
+	// Wait for runs of other processes using the same lock
+	if path := c.String("run-lock"); path != "" {
+		lock := utils.NewFileLock(path)
+		if err := lock.TryLock(); err != nil {
+			if !errors.Is(err, utils.ErrLocked) {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			logger.Printf("Waiting for run lock: %s\n", err)
+			if err := lock.Acquire(context.Background()); err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+		}
+		defer lock.Close()
+	}
+
 	status := katalog.Run()
-	status.Summary(logger)
+	if c.Bool("json-summary") {
+		if err := status.WriteJSON(os.Stdout); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	} else {
+		status.Summary(logger)
+	}
+	if status.Err != nil {
+		return cli.NewExitError("", 1)
+	}
+
+	return nil
+}
+
+// Applies the configuration on remote hosts over ssh
+func execRemoteApply(c *cli.Context) error {
+	if len(c.Args()) < 1 {
+		return cli.NewExitError(errNoModuleName.Error(), 64)
+	}
+
+	hosts, err := remote.ParseHosts(c.String("ssh"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 64)
+	}
+
+	if _, err := parseVars(c.StringSlice("var")); err != nil {
+		return cli.NewExitError(err.Error(), 64)
+	}
+
+	// Flags passed on as they are to the remote hosts
+	var args []string
+	for _, name := range []string{"siterepo-token", "siterepo-checksum", "site-manifest-digest", "module-checksum", "verbosity", "user-resolver", "pre-apply-script", "post-apply-script", "state-file", "title", "secrets-file", "secrets-key-file", "hosts-file"} {
+		if c.IsSet(name) {
+			args = append(args, "--"+name, c.String(name))
+		}
+	}
+	for _, name := range []string{"dry-run", "diff", "verify-site-manifest", "skip-ownership-when-unprivileged", "retry-failed", "collect-updates"} {
+		if c.Bool(name) {
+			args = append(args, "--"+name)
+		}
+	}
+	for _, name := range []string{"siterepo-depth", "concurrency", "prefetch-workers", "history-retention"} {
+		if c.IsSet(name) {
+			args = append(args, "--"+name, strconv.Itoa(c.Int(name)))
+		}
+	}
+	for _, v := range c.StringSlice("var") {
+		args = append(args, "--var", v)
+	}
+
+	config := &remote.Config{
+		Hosts:           hosts,
+		Forks:           c.Int("forks"),
+		Timeout:         c.Duration("ssh-timeout"),
+		Binary:          c.String("ssh-binary"),
+		HostKeyChecking: c.String("ssh-host-key-checking"),
+		Sudo:            !c.Bool("ssh-no-sudo"),
+		Module:          c.Args()[0],
+		SiteRepo:        c.String("siterepo"),
+		Args:            args,
+		Output:          os.Stdout,
+	}
+
+	results, err := remote.Apply(context.Background(), config)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if remote.Summary(os.Stdout, results) > 0 {
+		return cli.NewExitError("", 1)
+	}
 
 	return nil
 }
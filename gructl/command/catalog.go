@@ -0,0 +1,262 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dnaeon/gru/task"
+
+	"github.com/gosuri/uitable"
+	"github.com/pborman/uuid"
+	"github.com/urfave/cli"
+)
+
+// NewPushCatalogCommand creates a new sub-command for
+// pushing catalogs to minions through etcd
+func NewPushCatalogCommand() cli.Command {
+	cmd := cli.Command{
+		Name:   "push-catalog",
+		Usage:  "push catalog to minion(s)",
+		Action: execPushCatalogCommand,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "with-classifier",
+				Value: "",
+				Usage: "match minions with given classifier pattern",
+			},
+			cli.StringFlag{
+				Name:  "classifier",
+				Value: "",
+				Usage: "push to all minions classified with the given key=value, including future ones",
+			},
+			cli.StringFlag{
+				Name:  "site",
+				Value: "",
+				Usage: "location of the site data archive, e.g. https:// or s3:// URL",
+			},
+			cli.StringFlag{
+				Name:  "site-checksum",
+				Value: "",
+				Usage: "checksum of the site data archive, e.g. sha256:<digest>",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "do not take any actions, just report what would be done",
+			},
+			cli.StringSliceFlag{
+				Name:  "var",
+				Usage: "override a variable declared by the module, e.g. --var key=value",
+			},
+		},
+	}
+
+	return cmd
+}
+
+// Executes the "push-catalog" command
+func execPushCatalogCommand(c *cli.Context) error {
+	if len(c.Args()) < 1 {
+		return cli.NewExitError(errNoModuleName.Error(), 64)
+	}
+
+	vars, err := parseVars(c.StringSlice("var"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 64)
+	}
+
+	// Local modules are pushed along with the catalog,
+	// otherwise the module is loaded from the site data
+	module := c.Args()[0]
+	r := task.NewCatalogRun(module, "")
+	source, err := ioutil.ReadFile(module)
+	switch {
+	case err == nil:
+		r.Module = filepath.Base(module)
+		r.Source = string(source)
+	case !os.IsNotExist(err):
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	r.SiteURL = c.String("site")
+	r.SiteChecksum = c.String("site-checksum")
+	r.DryRun = c.Bool("dry-run")
+	r.Vars = vars
+	if err := r.Validate(); err != nil {
+		return cli.NewExitError(err.Error(), 64)
+	}
+
+	client := newEtcdMinionClientFromFlags(c)
+
+	if classifier := c.String("classifier"); classifier != "" {
+		kv := strings.SplitN(classifier, "=", 2)
+		if len(kv) != 2 {
+			return cli.NewExitError(errInvalidClassifier.Error(), 64)
+		}
+
+		if err := client.SubmitCatalogWithClassifier(r, kv[0], kv[1]); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		fmt.Printf("Pushed catalog run %s to minions classified with %s\n", r.ID, classifier)
+		return nil
+	}
+
+	minions, err := parseClassifierPattern(client, c.String("with-classifier"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if len(minions) == 0 {
+		return cli.NewExitError(errNoMinionFound.Error(), 1)
+	}
+
+	if err := client.SubmitCatalog(r, minions); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("Pushed catalog run %s to %d minion(s)\n", r.ID, len(minions))
+
+	return nil
+}
+
+// NewCatalogRunsCommand creates a new sub-command for listing
+// the pending and completed catalog runs of a minion
+func NewCatalogRunsCommand() cli.Command {
+	cmd := cli.Command{
+		Name:   "catalog-runs",
+		Usage:  "list pending and completed catalog runs of a minion",
+		Action: execCatalogRunsCommand,
+	}
+
+	return cmd
+}
+
+// Executes the "catalog-runs" command
+func execCatalogRunsCommand(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return cli.NewExitError(errNoMinion.Error(), 64)
+	}
+
+	minion := uuid.Parse(c.Args()[0])
+	if minion == nil {
+		return cli.NewExitError(errInvalidUUID.Error(), 64)
+	}
+
+	client := newEtcdMinionClientFromFlags(c)
+
+	pending, err := client.MinionPendingCatalogs(minion)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	results, err := client.MinionCatalogResults(minion)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	table := uitable.New()
+	table.MaxColWidth = 40
+	table.AddRow("RUN", "MODULE", "STATE", "SUBMITTED/RECEIVED")
+	for _, r := range pending {
+		table.AddRow(r.ID, r.Module, "pending", time.Unix(r.TimeSubmitted, 0))
+	}
+	for _, r := range results {
+		table.AddRow(r.RunID, "", r.State, time.Unix(r.TimeReceived, 0))
+	}
+
+	fmt.Println(table)
+
+	return nil
+}
+
+// NewCatalogResultCommand creates a new sub-command for
+// retrieving the result of the last catalog run of a minion
+func NewCatalogResultCommand() cli.Command {
+	cmd := cli.Command{
+		Name:   "catalog-result",
+		Usage:  "get result of the last catalog run of a minion",
+		Action: execCatalogResultCommand,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "details",
+				Usage: "display the log of the run",
+			},
+		},
+	}
+
+	return cmd
+}
+
+// Executes the "catalog-result" command
+func execCatalogResultCommand(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return cli.NewExitError(errNoMinion.Error(), 64)
+	}
+
+	minion := uuid.Parse(c.Args()[0])
+	if minion == nil {
+		return cli.NewExitError(errInvalidUUID.Error(), 64)
+	}
+
+	client := newEtcdMinionClientFromFlags(c)
+
+	result, err := client.MinionLastCatalogResult(minion)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if c.Bool("details") {
+		fmt.Println(result.Log)
+	}
+
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.Wrap = true
+	table.AddRow("RUN", result.RunID)
+	table.AddRow("STATE", result.State)
+	table.AddRow("PROCESSED", time.Unix(result.TimeProcessed, 0))
+	if result.Report != nil {
+		table.AddRow("TOTALS", fmt.Sprintf("%d up-to-date, %d changed, %d failed", result.Report.UpToDate, result.Report.Changed, result.Report.Failed))
+		for _, rr := range result.Report.Resources {
+			if rr.Error != "" {
+				table.AddRow(rr.ID, rr.Error)
+			}
+		}
+	}
+	if result.Truncated {
+		table.AddRow("TRUNCATED", true)
+	}
+
+	fmt.Println(table)
+
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dnaeon/gru/catalog"
+	"github.com/gosuri/uitable"
+	"github.com/urfave/cli"
+	"github.com/yuin/gopher-lua"
+)
+
+// NewClassifyCommand creates a new sub-command for showing
+// how a host is classified using the hosts file
+func NewClassifyCommand() cli.Command {
+	cmd := cli.Command{
+		Name:      "classify",
+		Usage:     "show the roles, variables and resources of a host",
+		ArgsUsage: "HOST",
+		Action:    execClassifyCommand,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "siterepo",
+				Value:  "",
+				Usage:  "path to the site repo",
+				EnvVar: "GRU_SITEREPO",
+			},
+			cli.StringFlag{
+				Name:  "hosts-file",
+				Usage: "hosts file classifying hosts into roles, defaults to hosts.yaml in the site repo",
+			},
+			cli.StringFlag{
+				Name:  "module",
+				Usage: "module loaded before the modules of the roles",
+			},
+			cli.StringSliceFlag{
+				Name:  "var",
+				Usage: "override a variable declared by the module, e.g. --var key=value",
+			},
+		},
+	}
+
+	return cmd
+}
+
+// Executes the "classify" command
+func execClassifyCommand(c *cli.Context) error {
+	if len(c.Args()) < 1 {
+		return cli.NewExitError(errNoHost.Error(), 64)
+	}
+
+	vars, err := parseVars(c.StringSlice("var"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 64)
+	}
+
+	hostsFile := c.String("hosts-file")
+	if hostsFile == "" {
+		hostsFile = filepath.Join(c.String("siterepo"), catalog.DefaultHostsFile)
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+
+	config := &catalog.Config{
+		Module:    c.String("module"),
+		DryRun:    true,
+		Logger:    log.New(ioutil.Discard, "", 0),
+		SiteRepo:  c.String("siterepo"),
+		L:         L,
+		Vars:      vars,
+		HostsFile: hostsFile,
+		Host:      c.Args()[0],
+	}
+
+	katalog := catalog.New(config)
+	if err := katalog.Load(); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	cl := katalog.Classification()
+	if !cl.Matched {
+		fmt.Printf("Warning: host %s does not match any entry of the hosts file\n", cl.Host)
+	}
+
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.AddRow("Host:", cl.Host)
+	table.AddRow("Roles:", strings.Join(cl.Roles, ", "))
+	table.AddRow("Modules:", strings.Join(cl.Modules, ", "))
+	table.AddRow("Resources:", len(katalog.Unsorted))
+	fmt.Println(table)
+
+	names := make([]string, 0, len(cl.Vars))
+	for name := range cl.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) > 0 {
+		fmt.Println()
+		table = uitable.New()
+		table.MaxColWidth = 80
+		table.AddRow("VARIABLE", "VALUE")
+		for _, name := range names {
+			value := cl.Vars[name]
+			if override, ok := vars[name]; ok {
+				value = override
+			}
+			table.AddRow(name, value)
+		}
+		fmt.Println(table)
+	}
+
+	return nil
+}
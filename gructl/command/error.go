@@ -36,4 +36,17 @@ var (
 	errNoTask            = errors.New("Missing task uuid")
 	errNoModuleName      = errors.New("Missing module name")
 	errNoSiteRepo        = errors.New("Missing site repo")
+	errInvalidVar        = errors.New("Invalid variable, expected key=value")
+	errNoStateFile       = errors.New("Missing state file")
+	errNoResourceType    = errors.New("Missing resource type")
+	errNoResourceName    = errors.New("Missing resource name")
+	errInvalidFormat     = errors.New("Invalid format, expected lua")
+	errNoHost            = errors.New("Missing host name")
+	errNoSecretsFile     = errors.New("Missing secrets input or output file")
+	errNoSecretsKeyFile  = errors.New("Missing secrets key file")
+	errInvalidSecrets    = errors.New("Invalid secrets, expected a json object of strings")
+	errNoRunID           = errors.New("Missing run ids to compare")
+	errNoResourceID      = errors.New("Missing resource id")
+	errPlanConflict      = errors.New("Cannot both save and apply a plan")
+	errRemotePlan        = errors.New("Plans cannot be used when applying over ssh")
 )
@@ -0,0 +1,210 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dnaeon/gru/catalog"
+	"github.com/dnaeon/gru/utils"
+	"github.com/gosuri/uitable"
+	"github.com/urfave/cli"
+	"github.com/yuin/gopher-lua"
+)
+
+// NewExplainCommand creates a new sub-command for explaining
+// how a resource has been declared and evaluated
+func NewExplainCommand() cli.Command {
+	cmd := cli.Command{
+		Name:      "explain",
+		Usage:     "show how a resource is declared and evaluated",
+		ArgsUsage: "RESOURCE-ID",
+		Action:    execExplainCommand,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "siterepo",
+				Value:  "",
+				Usage:  "path to the site repo",
+				EnvVar: "GRU_SITEREPO",
+			},
+			cli.StringFlag{
+				Name:  "module",
+				Usage: "module declaring the resource",
+			},
+			cli.StringFlag{
+				Name:  "hosts-file",
+				Usage: "hosts file classifying hosts into roles, whose modules are loaded after the optional module",
+			},
+			cli.StringFlag{
+				Name:  "host",
+				Usage: "name of the host classified using the hosts file, defaults to the hostname",
+			},
+			cli.StringSliceFlag{
+				Name:  "var",
+				Usage: "override a variable declared by the module, e.g. --var key=value",
+			},
+			cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the explanation as JSON",
+			},
+		},
+	}
+
+	return cmd
+}
+
+// Executes the "explain" command
+func execExplainCommand(c *cli.Context) error {
+	if len(c.Args()) < 1 {
+		return cli.NewExitError(errNoResourceID.Error(), 64)
+	}
+
+	if c.String("module") == "" && c.String("hosts-file") == "" {
+		return cli.NewExitError(errNoModuleName.Error(), 64)
+	}
+
+	vars, err := parseVars(c.StringSlice("var"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 64)
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+
+	config := &catalog.Config{
+		Module:    c.String("module"),
+		DryRun:    true,
+		Logger:    log.New(ioutil.Discard, "", 0),
+		SiteRepo:  c.String("siterepo"),
+		L:         L,
+		Vars:      vars,
+		HostsFile: c.String("hosts-file"),
+		Host:      c.String("host"),
+	}
+
+	katalog := catalog.New(config)
+	if err := katalog.Load(); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	e, err := katalog.Explain(c.Args()[0])
+	if e == nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if c.Bool("json") {
+		if err := json.NewEncoder(os.Stdout).Encode(e); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	} else {
+		printExplanation(e)
+	}
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// printExplanation prints an explanation of a resource as tables.
+func printExplanation(e *catalog.Explanation) {
+	fmt.Printf("Resource %s\n", e.ID)
+
+	defaults := utils.NewList(e.Defaults...)
+	names := make([]string, 0, len(e.Attributes))
+	for name := range e.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println()
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.AddRow("ATTRIBUTE", "VALUE", "SOURCE")
+	for _, name := range names {
+		value, _ := json.Marshal(e.Attributes[name])
+		source := "declared"
+		if utils.NewString(name).IsInList(defaults) {
+			source = "default"
+		}
+		table.AddRow(name, string(value), source)
+	}
+	fmt.Println(table)
+
+	if len(e.Variables) > 0 {
+		names = make([]string, 0, len(e.Variables))
+		for name := range e.Variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Println()
+		table = uitable.New()
+		table.MaxColWidth = 80
+		table.AddRow("VARIABLE", "VALUE")
+		for _, name := range names {
+			table.AddRow(name, e.Variables[name])
+		}
+		fmt.Println(table)
+	}
+
+	if len(e.Checks) > 0 {
+		fmt.Println()
+		table = uitable.New()
+		table.MaxColWidth = 80
+		table.AddRow("CHECK", "OBSERVED", "DESIRED", "IN-SYNC", "DETAIL")
+		for _, check := range e.Checks {
+			table.AddRow(check.Name, check.Observed, check.Desired, check.InSync, check.Detail)
+		}
+		fmt.Println(table)
+	}
+
+	if len(e.Guards) > 0 {
+		fmt.Println()
+		table = uitable.New()
+		table.MaxColWidth = 80
+		table.AddRow("GUARD", "CONDITION", "PASSED")
+		for _, guard := range e.Guards {
+			table.AddRow(guard.Name, guard.Condition, guard.Passed)
+		}
+		fmt.Println(table)
+	}
+
+	fmt.Println()
+	table = uitable.New()
+	table.MaxColWidth = 80
+	table.AddRow("Requires:", strings.Join(e.Requires, ", "))
+	table.AddRow("Subscribes:", strings.Join(e.Subscribes, ", "))
+	table.AddRow("Dependents:", strings.Join(e.Dependents, ", "))
+	fmt.Println(table)
+}
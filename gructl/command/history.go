@@ -0,0 +1,156 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dnaeon/gru/catalog"
+	"github.com/urfave/cli"
+)
+
+// NewHistoryCommand creates a new sub-command for showing
+// the changes made during the runs recorded in the history
+func NewHistoryCommand() cli.Command {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "state-file",
+			Value: catalog.DefaultStateFile,
+			Usage: "state file, next to which the history of runs is kept",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the history as JSON",
+		},
+	}
+
+	cmd := cli.Command{
+		Name:   "history",
+		Usage:  "show the resources changed during recent runs",
+		Action: execHistoryCommand,
+		Flags: append([]cli.Flag{
+			cli.IntFlag{
+				Name:  "runs",
+				Value: 10,
+				Usage: "number of recent runs to show, 0 shows all runs in the history",
+			},
+		}, flags...),
+		Subcommands: []cli.Command{
+			{
+				Name:      "diff",
+				Usage:     "show the attributes of resources, which differ between two runs",
+				ArgsUsage: "RUN-A RUN-B",
+				Action:    execHistoryDiffCommand,
+				Flags:     flags,
+			},
+		},
+	}
+
+	return cmd
+}
+
+// Executes the "history" command
+func execHistoryCommand(c *cli.Context) error {
+	runs, err := catalog.ReadHistory(c.String("state-file"), c.Int("runs"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	changes := make([]*catalog.RunChanges, 0, len(runs))
+	for _, run := range runs {
+		changes = append(changes, run.Changes())
+	}
+
+	if c.Bool("json") {
+		if err := json.NewEncoder(os.Stdout).Encode(changes); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	for _, rc := range changes {
+		fmt.Printf("%s run %s module %s", rc.Time.Format(time.RFC3339), rc.RunID, rc.Module)
+		if rc.ModuleDigest != "" {
+			fmt.Printf(" (sha256:%s)", rc.ModuleDigest)
+		}
+		fmt.Println()
+
+		for _, change := range rc.Changed {
+			fmt.Printf("  changed %s (%s)\n", change.ID, change.Action)
+		}
+		for _, change := range rc.Failed {
+			fmt.Printf("  failed  %s (%s): %s\n", change.ID, change.Action, change.Error)
+		}
+		if len(rc.Changed) == 0 && len(rc.Failed) == 0 {
+			fmt.Println("  no changes")
+		}
+	}
+
+	return nil
+}
+
+// Executes the "history diff" command
+func execHistoryDiffCommand(c *cli.Context) error {
+	if len(c.Args()) < 2 {
+		return cli.NewExitError(errNoRunID.Error(), 64)
+	}
+
+	stateFile := c.String("state-file")
+	older, err := catalog.FindRun(stateFile, c.Args()[0])
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	newer, err := catalog.FindRun(stateFile, c.Args()[1])
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	diff := catalog.DiffRunStates(older, newer)
+	if c.Bool("json") {
+		if err := json.NewEncoder(os.Stdout).Encode(diff); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	for _, id := range diff.Added {
+		fmt.Printf("+ %s\n", id)
+	}
+	for _, id := range diff.Removed {
+		fmt.Printf("- %s\n", id)
+	}
+	for _, ad := range diff.Changed {
+		oldValue, _ := json.Marshal(ad.Old)
+		newValue, _ := json.Marshal(ad.New)
+		fmt.Printf("~ %s %s: %s -> %s\n", ad.ID, ad.Attribute, oldValue, newValue)
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/urfave/cli"
+)
+
+// NewImportCommand creates a new sub-command for emitting
+// resource declarations from the current state of the system
+func NewImportCommand() cli.Command {
+	cmd := cli.Command{
+		Name:      "import",
+		Usage:     "emit resource declarations matching the current state of the system",
+		ArgsUsage: "TYPE NAME...",
+		Action:    execImportCommand,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "provider",
+				Usage: "use the given provider of the resource type, e.g. yum for package",
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "lua",
+				Usage: "catalog format of the declarations",
+			},
+			cli.StringFlag{
+				Name:   "siterepo",
+				Value:  "",
+				Usage:  "path to the site repo, in which captured content is stored",
+				EnvVar: "GRU_SITEREPO",
+			},
+			cli.BoolFlag{
+				Name:  "capture-content",
+				Usage: "capture the content of files into the data directory of the site repo",
+			},
+		},
+	}
+
+	return cmd
+}
+
+// Executes the "import" command
+func execImportCommand(c *cli.Context) error {
+	if len(c.Args()) < 1 {
+		return cli.NewExitError(errNoResourceType.Error(), 64)
+	}
+
+	if len(c.Args()) < 2 {
+		return cli.NewExitError(errNoResourceName.Error(), 64)
+	}
+
+	// Lua is the only catalog format at the moment
+	if c.String("format") != "lua" {
+		return cli.NewExitError(errInvalidFormat.Error(), 64)
+	}
+
+	if c.Bool("capture-content") && c.String("siterepo") == "" {
+		return cli.NewExitError(errNoSiteRepo.Error(), 64)
+	}
+
+	name := c.Args()[0]
+	if provider := c.String("provider"); provider != "" {
+		name = provider
+		if i := strings.LastIndex(c.Args()[0], "."); i != -1 {
+			name = c.Args()[0][:i+1] + provider
+		}
+	}
+
+	item, err := resource.LookupProvider(name)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	declarations := make([]string, 0)
+	for _, name := range c.Args()[1:] {
+		r, err := resource.Import(item, name)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("%s: %s", name, err), 1)
+		}
+
+		if f, ok := r.(*resource.File); ok && c.Bool("capture-content") && f.State == "present" {
+			source, err := captureContent(c.String("siterepo"), f.Path)
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			f.Source = source
+		}
+
+		declaration, err := resource.Declaration(item, r)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		declarations = append(declarations, declaration)
+	}
+
+	fmt.Print(strings.Join(declarations, "\n"))
+
+	return nil
+}
+
+// captureContent copies the content of a file into the data
+// directory of the site repo, and returns the path of the copy
+// relative to the site repo, for use as source of the file.
+func captureContent(siteRepo, name string) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(abs)
+	if err != nil {
+		return "", err
+	}
+
+	source := path.Join("data", filepath.ToSlash(abs))
+	dst := filepath.Join(siteRepo, filepath.FromSlash(source))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(dst, data, 0644); err != nil {
+		return "", err
+	}
+
+	return source, nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package command
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/dnaeon/gru/catalog"
+	"github.com/dnaeon/gru/utils"
+	"github.com/urfave/cli"
+)
+
+// NewManifestCommand creates a new sub-command for
+// generating the manifest of the site data
+func NewManifestCommand() cli.Command {
+	cmd := cli.Command{
+		Name:   "manifest",
+		Usage:  "generate manifest of the site data",
+		Action: execManifestCommand,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "siterepo",
+				Value:  "",
+				Usage:  "path to the site repo",
+				EnvVar: "GRU_SITEREPO",
+			},
+			cli.BoolFlag{
+				Name:  "verify",
+				Usage: "verify the site data against the manifest, instead of generating it",
+			},
+			cli.StringFlag{
+				Name:  "digest",
+				Usage: "expected sha256 digest of the manifest when verifying",
+			},
+		},
+	}
+
+	return cmd
+}
+
+// Executes the "manifest" command
+func execManifestCommand(c *cli.Context) error {
+	siteRepo := c.String("siterepo")
+	if siteRepo == "" {
+		return cli.NewExitError(errNoSiteRepo.Error(), 64)
+	}
+
+	opts := utils.HashOptions{
+		Concurrency: runtime.NumCPU(),
+	}
+
+	if c.Bool("verify") {
+		if err := catalog.VerifySiteManifest(siteRepo, c.String("digest"), opts); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	digest, err := catalog.GenerateSiteManifest(siteRepo, opts)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	fmt.Println(digest)
+
+	return nil
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/gosuri/uitable"
+	"github.com/urfave/cli"
+)
+
+// NewResourceListCommand creates a new sub-command for
+// listing the registered resource types
+func NewResourceListCommand() cli.Command {
+	cmd := cli.Command{
+		Name:   "resource-list",
+		Usage:  "list the available resource types",
+		Action: execResourceListCommand,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "json",
+				Usage: "write the resource types to stdout as JSON",
+			},
+		},
+	}
+
+	return cmd
+}
+
+// NewResourceDescribeCommand creates a new sub-command for
+// describing the attributes of a resource type
+func NewResourceDescribeCommand() cli.Command {
+	cmd := cli.Command{
+		Name:   "resource-describe",
+		Usage:  "describe the attributes of a resource type",
+		Action: execResourceDescribeCommand,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "json",
+				Usage: "write the description of the resource type to stdout as JSON",
+			},
+		},
+	}
+
+	return cmd
+}
+
+// NewResourceExampleCommand creates a new sub-command for
+// emitting a ready to edit declaration of a resource type
+func NewResourceExampleCommand() cli.Command {
+	cmd := cli.Command{
+		Name:   "resource-example",
+		Usage:  "emit a ready to edit declaration of a resource type",
+		Action: execResourceExampleCommand,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "provider",
+				Usage: "use the given provider of the resource type, e.g. yum for package",
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "lua",
+				Usage: "catalog format of the declaration",
+			},
+		},
+	}
+
+	return cmd
+}
+
+// Executes the "resource-list" command
+func execResourceListCommand(c *cli.Context) error {
+	// Resource types, which cannot be described on this
+	// system, e.g. without a package manager, are listed
+	// with the description provided at registration
+	schemas := make([]resource.Schema, 0)
+	for _, item := range resource.Providers() {
+		schema, err := resource.Describe(item)
+		if err != nil {
+			schema = resource.Schema{
+				Namespace:   item.Namespace,
+				Type:        item.Type,
+				Description: item.Description,
+			}
+		}
+		schema.Attributes = nil
+		schemas = append(schemas, schema)
+	}
+
+	if c.Bool("json") {
+		if err := json.NewEncoder(os.Stdout).Encode(schemas); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.AddRow("TYPE", "DESCRIPTION")
+	for _, schema := range schemas {
+		table.AddRow(schema.Namespace+"."+schema.Type, schema.Description)
+	}
+
+	fmt.Println(table)
+
+	return nil
+}
+
+// Executes the "resource-describe" command
+func execResourceDescribeCommand(c *cli.Context) error {
+	if len(c.Args()) < 1 {
+		return cli.NewExitError(errNoResourceType.Error(), 64)
+	}
+
+	item, err := resource.LookupProvider(c.Args()[0])
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	schema, err := resource.Describe(item)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if c.Bool("json") {
+		if err := json.NewEncoder(os.Stdout).Encode(schema); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	fmt.Printf("%s.%s: %s\n\n", schema.Namespace, schema.Type, schema.Description)
+
+	table := uitable.New()
+	table.MaxColWidth = 60
+	table.Wrap = true
+	table.AddRow("ATTRIBUTE", "TYPE", "DEFAULT", "REQUIRED", "DESCRIPTION")
+	for _, attr := range schema.Attributes {
+		required := "no"
+		if attr.Required {
+			required = "yes"
+		}
+		table.AddRow(attr.Name, attr.Type, attr.Default, required, attr.Description)
+	}
+
+	fmt.Println(table)
+	fmt.Printf("\nExample:\n%s", indent(schema.Example(), "  "))
+
+	return nil
+}
+
+// Executes the "resource-example" command
+func execResourceExampleCommand(c *cli.Context) error {
+	if len(c.Args()) < 1 {
+		return cli.NewExitError(errNoResourceType.Error(), 64)
+	}
+
+	// Lua is the only catalog format at the moment
+	if c.String("format") != "lua" {
+		return cli.NewExitError(errInvalidFormat.Error(), 64)
+	}
+
+	// Providers are registered as resource types in the
+	// same namespace as the resource type, e.g. resource.yum
+	name := c.Args()[0]
+	if provider := c.String("provider"); provider != "" {
+		name = provider
+		if i := strings.LastIndex(c.Args()[0], "."); i != -1 {
+			name = c.Args()[0][:i+1] + provider
+		}
+	}
+
+	item, err := resource.LookupProvider(name)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	schema, err := resource.Describe(item)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Print(schema.Skeleton())
+
+	return nil
+}
+
+// indent indents each line of the text with the given prefix
+func indent(text, prefix string) string {
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/urfave/cli"
+)
+
+// NewSealSecretsCommand creates a new sub-command for creating
+// encrypted files, from which secrets are resolved during runs
+func NewSealSecretsCommand() cli.Command {
+	cmd := cli.Command{
+		Name:      "seal-secrets",
+		Usage:     "encrypt a json object of secrets for use with --secrets-file",
+		ArgsUsage: "INPUT OUTPUT",
+		Action:    execSealSecretsCommand,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "key-file",
+				Usage: "file containing the key used to encrypt the secrets",
+			},
+		},
+	}
+
+	return cmd
+}
+
+// Executes the "seal-secrets" command
+func execSealSecretsCommand(c *cli.Context) error {
+	if len(c.Args()) < 2 {
+		return cli.NewExitError(errNoSecretsFile.Error(), 64)
+	}
+
+	if c.String("key-file") == "" {
+		return cli.NewExitError(errNoSecretsKeyFile.Error(), 64)
+	}
+
+	key, err := ioutil.ReadFile(c.String("key-file"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	data, err := ioutil.ReadFile(c.Args()[0])
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	var secrets map[string]string
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return cli.NewExitError(errInvalidSecrets.Error(), 1)
+	}
+
+	sealed, err := resource.SealSecrets(key, secrets)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if err := ioutil.WriteFile(c.Args()[1], sealed, 0600); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
+}
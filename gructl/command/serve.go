@@ -32,6 +32,7 @@ import (
 	"syscall"
 
 	"github.com/dnaeon/gru/minion"
+	"github.com/dnaeon/gru/task"
 	"github.com/urfave/cli"
 )
 
@@ -59,6 +60,55 @@ func NewServeCommand() cli.Command {
 				Usage:  "path/url to the site repo",
 				EnvVar: "GRU_SITEREPO",
 			},
+			cli.StringFlag{
+				Name:  "site-cache",
+				Value: "",
+				Usage: "directory in which the site data of pushed catalogs is cached",
+			},
+			cli.DurationFlag{
+				Name:  "result-ttl",
+				Value: minion.DefaultResultTTL,
+				Usage: "time after which results of catalog runs expire",
+			},
+			cli.IntFlag{
+				Name:  "max-result-size",
+				Value: task.DefaultMaxResultSize,
+				Usage: "max size in bytes of the results of catalog runs",
+			},
+			cli.StringFlag{
+				Name:  "run-lock",
+				Value: "",
+				Usage: "path to the lock file held while processing runs, shared with gructl apply",
+			},
+			cli.BoolFlag{
+				Name:  "collect-updates",
+				Usage: "collect pending package updates after catalog runs and report them as classifiers",
+			},
+			cli.BoolFlag{
+				Name:  "api",
+				Usage: "serve the HTTP API for triggering runs and querying their status",
+			},
+			cli.StringFlag{
+				Name:  "api-address",
+				Value: minion.DefaultAPIAddress,
+				Usage: "address of the HTTP API, either unix:///path/to/socket or tcp://host:port",
+			},
+			cli.StringFlag{
+				Name:  "api-tls-cert",
+				Value: "",
+				Usage: "path to the TLS certificate of the HTTP API, required for TCP addresses",
+			},
+			cli.StringFlag{
+				Name:  "api-tls-key",
+				Value: "",
+				Usage: "path to the TLS key of the HTTP API, required for TCP addresses",
+			},
+			cli.StringFlag{
+				Name:   "api-token",
+				Value:  "",
+				Usage:  "bearer token required by the HTTP API, required for TCP addresses",
+				EnvVar: "GRU_API_TOKEN",
+			},
 		},
 	}
 
@@ -88,10 +138,24 @@ func execServeCommand(c *cli.Context) error {
 
 	etcdCfg := etcdConfigFromFlags(c)
 	minionCfg := &minion.EtcdMinionConfig{
-		Concurrency: concurrency,
-		Name:        name,
-		SiteRepo:    c.String("siterepo"),
-		EtcdConfig:  etcdCfg,
+		Concurrency:    concurrency,
+		Name:           name,
+		SiteRepo:       c.String("siterepo"),
+		EtcdConfig:     etcdCfg,
+		SiteCacheDir:   c.String("site-cache"),
+		ResultTTL:      c.Duration("result-ttl"),
+		MaxResultSize:  c.Int("max-result-size"),
+		RunLockFile:    c.String("run-lock"),
+		CollectUpdates: c.Bool("collect-updates"),
+	}
+
+	if c.Bool("api") {
+		minionCfg.API = &minion.APIConfig{
+			Address:     c.String("api-address"),
+			TLSCertFile: c.String("api-tls-cert"),
+			TLSKeyFile:  c.String("api-tls-key"),
+			Token:       c.String("api-token"),
+		}
 	}
 
 	m, err := minion.NewEtcdMinion(minionCfg)
@@ -113,3 +113,17 @@ func parseClassifierPattern(klient client.Client, pattern string) ([]uuid.UUID,
 
 	return result, nil
 }
+
+// Parses variables given as 'key=value' pairs.
+func parseVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errInvalidVar
+		}
+		vars[kv[0]] = kv[1]
+	}
+
+	return vars, nil
+}
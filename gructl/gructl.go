@@ -30,6 +30,7 @@ import (
 	"time"
 
 	"github.com/dnaeon/gru/gructl/command"
+	"github.com/dnaeon/gru/resource"
 	"github.com/dnaeon/gru/version"
 	"github.com/urfave/cli"
 )
@@ -66,6 +67,25 @@ func Main() {
 			Usage:  "connection timeout per request",
 			EnvVar: "GRU_TIMEOUT",
 		},
+		cli.StringFlag{
+			Name:   "plugins",
+			Value:  "",
+			Usage:  "directory containing resource plugins to load",
+			EnvVar: "GRU_PLUGINS",
+		},
+	}
+
+	app.Before = func(c *cli.Context) error {
+		dir := c.String("plugins")
+		if dir == "" {
+			return nil
+		}
+
+		if err := resource.LoadPlugins(dir); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		return nil
 	}
 
 	app.Commands = []cli.Command{
@@ -74,6 +94,9 @@ func Main() {
 		command.NewInfoCommand(),
 		command.NewServeCommand(),
 		command.NewPushCommand(),
+		command.NewPushCatalogCommand(),
+		command.NewCatalogRunsCommand(),
+		command.NewCatalogResultCommand(),
 		command.NewClassifierCommand(),
 		command.NewReportCommand(),
 		command.NewQueueCommand(),
@@ -81,6 +104,15 @@ func Main() {
 		command.NewLastseenCommand(),
 		command.NewResultCommand(),
 		command.NewGraphCommand(),
+		command.NewManifestCommand(),
+		command.NewResourceListCommand(),
+		command.NewResourceDescribeCommand(),
+		command.NewResourceExampleCommand(),
+		command.NewImportCommand(),
+		command.NewSealSecretsCommand(),
+		command.NewClassifyCommand(),
+		command.NewHistoryCommand(),
+		command.NewExplainCommand(),
 	}
 
 	app.Run(os.Args)
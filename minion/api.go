@@ -0,0 +1,624 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package minion
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dnaeon/gru/catalog"
+	"github.com/dnaeon/gru/classifier"
+	"github.com/dnaeon/gru/task"
+
+	"github.com/pborman/uuid"
+)
+
+// DefaultAPIAddress is the default address the API of the minion listens on
+const DefaultAPIAddress = "unix:///var/run/gru/minion.sock"
+
+// maxRunHistory is the number of runs kept in memory, which can
+// be queried using the API
+const maxRunHistory = 100
+
+// apiQueueSize is the number of runs triggered using
+// the API, which can be waiting to be processed
+const apiQueueSize = 16
+
+// maxRunWait is the max time a request waits for a run to finish
+const maxRunWait = 5 * time.Minute
+
+// APIConfig type contains the settings of the HTTP API of
+// the minion, which is used for triggering runs and querying
+// their outcome, e.g. by deploy pipelines.
+type APIConfig struct {
+	// Address to listen on, either a unix socket in the form of
+	// unix:///path/to/socket or a TCP address in the form of
+	// tcp://host:port. Defaults to DefaultAPIAddress.
+	Address string
+
+	// Paths to the TLS certificate and key.
+	// Required when listening on a TCP address.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// Token, which clients must send as a bearer token.
+	// Required when listening on a TCP address.
+	Token string
+}
+
+// Validate validates the API settings.
+func (c *APIConfig) Validate() error {
+	switch {
+	case strings.HasPrefix(c.Address, "unix://"):
+		if strings.TrimPrefix(c.Address, "unix://") == "" {
+			return errors.New("missing path to API socket")
+		}
+	case strings.HasPrefix(c.Address, "tcp://"):
+		if c.TLSCertFile == "" || c.TLSKeyFile == "" {
+			return errors.New("TLS certificate and key are required for TCP API address")
+		}
+		if c.Token == "" {
+			return errors.New("token is required for TCP API address")
+		}
+	default:
+		return fmt.Errorf("invalid API address %s", c.Address)
+	}
+
+	return nil
+}
+
+// listen creates the listener of the API.
+func (c *APIConfig) listen() (net.Listener, error) {
+	if strings.HasPrefix(c.Address, "tcp://") {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+
+		return tls.Listen("tcp", strings.TrimPrefix(c.Address, "tcp://"), config)
+	}
+
+	// Bind the socket in a private directory, so that other users
+	// cannot connect before it is made accessible only to the user
+	// of the minion, and move it in place of any socket left behind
+	// by a previous minion
+	path := strings.TrimPrefix(c.Address, "unix://")
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := ioutil.TempDir(dir, ".gru-api")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpPath := filepath.Join(tmpDir, filepath.Base(path))
+	l, err := net.Listen("unix", tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(tmpPath, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// RunRequest type is the body of requests triggering a run.
+type RunRequest struct {
+	// Module to apply
+	Module string `json:"module"`
+
+	// Environment to use. Defaults to "production".
+	Environment string `json:"environment"`
+
+	// Do not take any actions, just report what would be done
+	DryRun bool `json:"dry_run"`
+}
+
+// RunInfo type contains the state of a run processed by the minion.
+type RunInfo struct {
+	// ID of the run
+	ID uuid.UUID `json:"id"`
+
+	// Module applied by the run
+	Module string `json:"module"`
+
+	// Environment used by the run, if any
+	Environment string `json:"environment,omitempty"`
+
+	// DryRun is true if no actions were taken
+	DryRun bool `json:"dry_run"`
+
+	// State of the run, e.g. "queued" or "success"
+	State string `json:"state"`
+
+	// Time when the run was received
+	TimeReceived int64 `json:"time_received"`
+
+	// Time when the run was processed
+	TimeProcessed int64 `json:"time_processed,omitempty"`
+
+	// Report contains the summary and the outcome of each
+	// processed resource, once the run is processed
+	Report *catalog.Report `json:"report,omitempty"`
+
+	// Error which prevented the run from being processed
+	Error string `json:"error,omitempty"`
+}
+
+// finished returns true if the run has been processed.
+func (ri RunInfo) finished() bool {
+	return ri.State != task.TaskStateQueued && ri.State != task.TaskStateProcessing
+}
+
+// runLog type contains the log of a run, which can be
+// read while the run is being processed.
+type runLog struct {
+	mu      sync.Mutex
+	data    []byte
+	closed  bool
+	changed chan struct{}
+}
+
+// newRunLog creates a new empty run log.
+func newRunLog() *runLog {
+	return &runLog{changed: make(chan struct{})}
+}
+
+// Write implements the io.Writer interface.
+func (l *runLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.data = append(l.data, p...)
+	close(l.changed)
+	l.changed = make(chan struct{})
+
+	return len(p), nil
+}
+
+// close marks the log as complete.
+func (l *runLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.closed {
+		l.closed = true
+		close(l.changed)
+	}
+}
+
+// read returns the log after the given offset, whether the log is
+// complete, and a channel which is closed once the log changes.
+func (l *runLog) read(offset int) ([]byte, bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.data[offset:], l.closed, l.changed
+}
+
+// run type is a run recorded in the run history.
+type run struct {
+	info RunInfo
+	log  *runLog
+	done chan struct{}
+}
+
+// runHistory type contains the recent runs of the minion.
+type runHistory struct {
+	mu      sync.Mutex
+	runs    map[string]*run
+	order   []string
+	current string
+	last    string
+}
+
+// newRunHistory creates a new empty run history.
+func newRunHistory() *runHistory {
+	return &runHistory{runs: make(map[string]*run)}
+}
+
+// add records a new run in the history, forgetting
+// the oldest run if the history is full.
+func (h *runHistory) add(info RunInfo) *run {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	id := info.ID.String()
+	if r, ok := h.runs[id]; ok {
+		return r
+	}
+
+	if len(h.order) >= maxRunHistory {
+		delete(h.runs, h.order[0])
+		h.order = h.order[1:]
+	}
+
+	r := &run{
+		info: info,
+		log:  newRunLog(),
+		done: make(chan struct{}),
+	}
+	h.runs[id] = r
+	h.order = append(h.order, id)
+
+	return r
+}
+
+// get returns the run with the given id.
+func (h *runHistory) get(id string) (*run, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.runs[id]
+
+	return r, ok
+}
+
+// info returns the state of a run.
+func (h *runHistory) info(r *run) RunInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return r.info
+}
+
+// start marks a run as being processed.
+func (h *runHistory) start(r *run) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r.info.State = task.TaskStateProcessing
+	h.current = r.info.ID.String()
+}
+
+// finish marks a run as processed.
+func (h *runHistory) finish(r *run, state string, report *catalog.Report, err string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r.info.State = state
+	r.info.Report = report
+	r.info.Error = err
+	r.info.TimeProcessed = time.Now().Unix()
+	r.log.close()
+	close(r.done)
+
+	h.current = ""
+	h.last = r.info.ID.String()
+}
+
+// status returns the ids of the run being processed and
+// the last processed run, and the number of queued runs.
+func (h *runHistory) status() (string, string, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	queued := 0
+	for _, r := range h.runs {
+		if r.info.State == task.TaskStateQueued {
+			queued++
+		}
+	}
+
+	return h.current, h.last, queued
+}
+
+// StatusInfo type contains the health of the minion.
+type StatusInfo struct {
+	// ID of the minion
+	ID uuid.UUID `json:"id"`
+
+	// Name of the minion
+	Name string `json:"name"`
+
+	// Uptime of the minion in seconds
+	Uptime int64 `json:"uptime"`
+
+	// Number of queued runs
+	Queued int `json:"queued"`
+
+	// Run being processed, if any
+	Current *RunInfo `json:"current,omitempty"`
+
+	// Last processed run, if any
+	LastRun *RunInfo `json:"last_run,omitempty"`
+}
+
+// apiHandler returns the handler of the API.
+func (m *etcdMinion) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", m.handleRun)
+	mux.HandleFunc("/runs/", m.handleRuns)
+	mux.HandleFunc("/status", m.handleStatus)
+	mux.HandleFunc("/facts", m.handleFacts)
+
+	token := ""
+	if m.config.API != nil {
+		token = m.config.API.Token
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				apiError(w, http.StatusUnauthorized, "invalid token")
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// serveAPI serves the API until the minion is stopped.
+func (m *etcdMinion) serveAPI(l net.Listener) {
+	server := &http.Server{Handler: m.apiHandler()}
+	go func() {
+		<-m.done
+		server.Close()
+	}()
+
+	log.Printf("API is listening on %s\n", m.config.API.Address)
+	if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+		log.Printf("API server failed: %s\n", err)
+	}
+}
+
+// apiError writes an error response.
+func apiError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// apiJSON writes a JSON response.
+func apiJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleRun queues a new run of a module.
+func (m *etcdMinion) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req RunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %s", err))
+		return
+	}
+
+	if req.Module == "" {
+		apiError(w, http.StatusBadRequest, "missing module")
+		return
+	}
+
+	if req.Environment == "" {
+		req.Environment = "production"
+	}
+
+	t := task.New(req.Module, req.Environment)
+	t.DryRun = req.DryRun
+	t.State = task.TaskStateQueued
+	t.TimeReceived = time.Now().Unix()
+
+	rr := m.runs.add(taskRunInfo(t))
+	select {
+	case m.apiQueue <- t:
+	default:
+		m.runs.finish(rr, task.TaskStateSkipped, nil, "too many queued runs")
+		apiError(w, http.StatusServiceUnavailable, "too many queued runs")
+		return
+	}
+
+	log.Printf("Received run %s of %s via API\n", t.ID, t.Command)
+
+	apiJSON(w, http.StatusAccepted, m.runs.info(rr))
+}
+
+// handleRuns returns the state of a run, or streams its log
+// as server-sent events if the path ends with /events.
+// Clients may wait for the run to finish using the
+// wait query parameter, e.g. ?wait=30s.
+func (m *etcdMinion) handleRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/runs/")
+	id := strings.TrimSuffix(path, "/events")
+	rr, ok := m.runs.get(id)
+	if !ok {
+		apiError(w, http.StatusNotFound, "run not found")
+		return
+	}
+
+	if strings.HasSuffix(path, "/events") {
+		m.streamRun(w, r, rr)
+		return
+	}
+
+	if v := r.URL.Query().Get("wait"); v != "" {
+		wait, err := time.ParseDuration(v)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, fmt.Sprintf("invalid wait duration: %s", err))
+			return
+		}
+		if wait > maxRunWait {
+			wait = maxRunWait
+		}
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-rr.done:
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	apiJSON(w, http.StatusOK, m.runs.info(rr))
+}
+
+// streamRun streams the log of a run as server-sent events, one
+// event per line, followed by a "done" event with the state of
+// the run once it is processed.
+func (m *etcdMinion) streamRun(w http.ResponseWriter, r *http.Request, rr *run) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apiError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	offset := 0
+	for {
+		data, closed, changed := rr.log.read(offset)
+
+		// Only complete lines are sent, unless the log is complete
+		n := strings.LastIndex(string(data), "\n") + 1
+		if closed {
+			n = len(data)
+		}
+
+		for _, line := range strings.Split(strings.TrimSuffix(string(data[:n]), "\n"), "\n") {
+			if n > 0 {
+				fmt.Fprintf(w, "data: %s\n\n", line)
+			}
+		}
+		offset += n
+
+		if closed {
+			info, _ := json.Marshal(m.runs.info(rr))
+			fmt.Fprintf(w, "event: done\ndata: %s\n\n", info)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleStatus returns the health of the minion and
+// the state of the current and last processed runs.
+func (m *etcdMinion) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	current, last, queued := m.runs.status()
+	status := StatusInfo{
+		ID:     m.id,
+		Name:   m.name,
+		Uptime: int64(time.Since(m.started) / time.Second),
+		Queued: queued,
+	}
+
+	if rr, ok := m.runs.get(current); ok {
+		info := m.runs.info(rr)
+		status.Current = &info
+	}
+
+	if rr, ok := m.runs.get(last); ok {
+		info := m.runs.info(rr)
+		status.LastRun = &info
+	}
+
+	apiJSON(w, http.StatusOK, status)
+}
+
+// handleFacts returns the classifiers of the minion.
+func (m *etcdMinion) handleFacts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	facts := make(map[string]string)
+	for key := range classifier.Registry {
+		klassifier, err := classifier.Get(key)
+		if err != nil {
+			continue
+		}
+		facts[klassifier.Key] = klassifier.Value
+	}
+
+	apiJSON(w, http.StatusOK, facts)
+}
+
+// taskRunInfo returns the state of a run for a task.
+func taskRunInfo(t *task.Task) RunInfo {
+	return RunInfo{
+		ID:           t.ID,
+		Module:       t.Command,
+		Environment:  t.Environment,
+		DryRun:       t.DryRun,
+		State:        task.TaskStateQueued,
+		TimeReceived: t.TimeReceived,
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package minion
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnaeon/gru/catalog"
+	"github.com/dnaeon/gru/task"
+	"github.com/pborman/uuid"
+)
+
+func newTestMinion() *etcdMinion {
+	return &etcdMinion{
+		config: &EtcdMinionConfig{
+			API: &APIConfig{Token: "secret"},
+		},
+		name:     "test",
+		id:       uuid.NewRandom(),
+		apiQueue: make(chan *task.Task, 1),
+		runs:     newRunHistory(),
+		started:  time.Now(),
+	}
+}
+
+func apiRequest(t *testing.T, ts *httptest.Server, method, path, body string, v interface{}) int {
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+func TestAPI(t *testing.T) {
+	m := newTestMinion()
+	ts := httptest.NewServer(m.apiHandler())
+	defer ts.Close()
+
+	// Requests without the token are rejected
+	resp, err := http.Get(ts.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("want status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	if code := apiRequest(t, ts, "POST", "/run", `{}`, nil); code != http.StatusBadRequest {
+		t.Errorf("want status %d for missing module, got %d", http.StatusBadRequest, code)
+	}
+
+	var info RunInfo
+	if code := apiRequest(t, ts, "POST", "/run", `{"module": "site.lua", "dry_run": true}`, &info); code != http.StatusAccepted {
+		t.Fatalf("want status %d, got %d", http.StatusAccepted, code)
+	}
+	if info.State != task.TaskStateQueued || info.Environment != "production" || !info.DryRun {
+		t.Errorf("want queued dry run in production, got %+v", info)
+	}
+
+	// The queue is full until the runner picks up the run
+	if code := apiRequest(t, ts, "POST", "/run", `{"module": "site.lua"}`, nil); code != http.StatusServiceUnavailable {
+		t.Errorf("want status %d for full queue, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	queued := <-m.apiQueue
+	if queued.ID.String() != info.ID.String() || queued.Command != "site.lua" {
+		t.Errorf("want task for run %s, got %+v", info.ID, queued)
+	}
+
+	// Stream the events of the run while it is being processed
+	rr, _ := m.runs.get(info.ID.String())
+	m.runs.start(rr)
+
+	req, _ := http.NewRequest("GET", ts.URL+"/runs/"+info.ID.String()+"/events", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+
+	go func() {
+		fmt.Fprintf(rr.log, "first line\n")
+		fmt.Fprintf(rr.log, "second ")
+		fmt.Fprintf(rr.log, "line\n")
+		report := &catalog.Report{Totals: catalog.Totals{Changed: 1}}
+		m.runs.finish(rr, task.TaskStateSuccess, report, "")
+	}()
+
+	var events []string
+	scanner := bufio.NewScanner(stream.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			events = append(events, line)
+		}
+	}
+
+	if len(events) != 4 || events[0] != "data: first line" || events[1] != "data: second line" || events[2] != "event: done" {
+		t.Errorf("unexpected events %q", events)
+	}
+
+	if code := apiRequest(t, ts, "GET", "/runs/"+info.ID.String()+"?wait=1s", "", &info); code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, code)
+	}
+	if info.State != task.TaskStateSuccess || info.Report == nil || info.Report.Changed != 1 {
+		t.Errorf("want successful run with report, got %+v", info)
+	}
+
+	var status StatusInfo
+	if code := apiRequest(t, ts, "GET", "/status", "", &status); code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, code)
+	}
+	if status.Name != "test" || status.Current != nil || status.LastRun == nil || status.LastRun.ID.String() != info.ID.String() {
+		t.Errorf("want last run %s in status, got %+v", info.ID, status)
+	}
+
+	if code := apiRequest(t, ts, "GET", "/runs/"+uuid.New(), "", nil); code != http.StatusNotFound {
+		t.Errorf("want status %d for unknown run, got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestRunHistory(t *testing.T) {
+	h := newRunHistory()
+	var first string
+	for i := 0; i < maxRunHistory+1; i++ {
+		rr := h.add(RunInfo{ID: uuid.NewRandom(), State: task.TaskStateQueued})
+		if i == 0 {
+			first = rr.info.ID.String()
+		}
+	}
+
+	if _, ok := h.get(first); ok {
+		t.Error("want oldest run to be forgotten")
+	}
+
+	if _, _, queued := h.status(); queued != maxRunHistory {
+		t.Errorf("want %d queued runs, got %d", maxRunHistory, queued)
+	}
+}
+
+func TestAPIConfigValidate(t *testing.T) {
+	for _, c := range []struct {
+		config APIConfig
+		valid  bool
+	}{
+		{APIConfig{Address: DefaultAPIAddress}, true},
+		{APIConfig{Address: "unix://"}, false},
+		{APIConfig{Address: "tcp://:8080"}, false},
+		{APIConfig{Address: "tcp://:8080", TLSCertFile: "cert.pem", TLSKeyFile: "key.pem"}, false},
+		{APIConfig{Address: "tcp://:8080", TLSCertFile: "cert.pem", TLSKeyFile: "key.pem", Token: "secret"}, true},
+		{APIConfig{Address: "http://:8080"}, false},
+	} {
+		if err := c.config.Validate(); (err == nil) != c.valid {
+			t.Errorf("%+v: want valid %v, got %v", c.config, c.valid, err)
+		}
+	}
+}
+
+func TestAPIListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-minion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A socket left behind by a previous minion is replaced
+	path := filepath.Join(dir, "minion.sock")
+	if err := ioutil.WriteFile(path, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &APIConfig{Address: "unix://" + path}
+	l, err := config.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		t.Errorf("want socket, got mode %s", fi.Mode())
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("want permissions 0600, got %#o", perm)
+	}
+
+	// The private directory the socket is bound in is removed
+	names, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Errorf("want only the socket in %s, got %d entries", dir, len(names))
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
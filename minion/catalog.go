@@ -0,0 +1,429 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package minion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dnaeon/backoff"
+	"github.com/dnaeon/gru/catalog"
+	"github.com/dnaeon/gru/classifier"
+	"github.com/dnaeon/gru/task"
+	"github.com/dnaeon/gru/utils"
+	"github.com/yuin/gopher-lua"
+
+	etcdclient "github.com/coreos/etcd/client"
+	"github.com/pborman/uuid"
+)
+
+// EtcdCatalogSpace is the keyspace in etcd holding the catalogs
+// pushed to minions, either to a single minion or to all minions
+// classified with a given classifier value
+const EtcdCatalogSpace = "/gru/catalog"
+
+// EtcdResultSpace is the keyspace in etcd holding
+// the results of catalog runs
+const EtcdResultSpace = "/gru/result"
+
+// DefaultResultTTL is the default time after which
+// results of catalog runs expire in etcd
+const DefaultResultTTL = 7 * 24 * time.Hour
+
+// pushedCatalog type is a catalog pushed to the minion
+// along with the etcd key it was pushed to.
+type pushedCatalog struct {
+	key string
+	run *task.CatalogRun
+}
+
+// EtcdMinionCatalogKey returns the key of the catalog pushed to a minion
+func EtcdMinionCatalogKey(m uuid.UUID) string {
+	return path.Join(EtcdCatalogSpace, "minion", m.String())
+}
+
+// EtcdClassifierCatalogKey returns the key of the catalog pushed to
+// all minions classified with the given classifier value
+func EtcdClassifierCatalogKey(key, value string) string {
+	return path.Join(EtcdCatalogSpace, "classifier", key, value)
+}
+
+// EtcdAppliedCatalogKey returns the key holding the id of the last
+// run a minion has applied from the given catalog key
+func EtcdAppliedCatalogKey(m uuid.UUID, catalogKey string) string {
+	rel := strings.TrimPrefix(catalogKey, EtcdCatalogSpace)
+
+	return path.Join(EtcdMinionSpace, m.String(), "applied", rel)
+}
+
+// EtcdCatalogResultKey returns the key of the result of a catalog run
+func EtcdCatalogResultKey(m, run uuid.UUID) string {
+	return path.Join(EtcdResultSpace, m.String(), run.String())
+}
+
+// EtcdUnmarshalCatalogRun unmarshals a catalog run from an etcd node
+func EtcdUnmarshalCatalogRun(node *etcdclient.Node) (*task.CatalogRun, error) {
+	run := new(task.CatalogRun)
+	if err := json.Unmarshal([]byte(node.Value), run); err != nil {
+		return nil, err
+	}
+
+	return run, run.Validate()
+}
+
+// EtcdUnmarshalCatalogResult unmarshals the result of a catalog run from an etcd node
+func EtcdUnmarshalCatalogResult(node *etcdclient.Node) (*task.CatalogResult, error) {
+	result := new(task.CatalogResult)
+	err := json.Unmarshal([]byte(node.Value), result)
+
+	return result, err
+}
+
+// catalogKeys returns the keys of the catalogs applied by the
+// minion, which are the minion's own key and the keys for
+// each of its classifier values.
+func (m *etcdMinion) catalogKeys() map[string]bool {
+	keys := map[string]bool{
+		EtcdMinionCatalogKey(m.id): true,
+	}
+
+	for key := range classifier.Registry {
+		klassifier, err := classifier.Get(key)
+		if err != nil {
+			continue
+		}
+		keys[EtcdClassifierCatalogKey(klassifier.Key, klassifier.Value)] = true
+	}
+
+	return keys
+}
+
+// isApplied returns a boolean indicating whether the
+// run was the last one applied from the given key.
+func (m *etcdMinion) isApplied(key string, run *task.CatalogRun) (bool, error) {
+	resp, err := m.kapi.Get(context.Background(), EtcdAppliedCatalogKey(m.id, key), nil)
+	if etcdclient.IsKeyNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return resp.Node.Value == run.ID.String(), nil
+}
+
+// queueCatalog sends the catalog in an etcd node for
+// processing, unless it has already been applied.
+func (m *etcdMinion) queueCatalog(node *etcdclient.Node) error {
+	run, err := EtcdUnmarshalCatalogRun(node)
+	if err != nil {
+		return fmt.Errorf("invalid catalog %s: %s", node.Key, err)
+	}
+
+	applied, err := m.isApplied(node.Key, run)
+	if err != nil || applied {
+		return err
+	}
+
+	log.Printf("Received catalog run %s from %s\n", run.ID, node.Key)
+	m.catalogQueue <- &pushedCatalog{key: node.Key, run: run}
+
+	return nil
+}
+
+// checkCatalogs sends the catalogs pushed to the minion, which have
+// not been applied yet, for processing, e.g. the ones pushed while
+// the minion was offline. It returns the etcd index, after which
+// changes to the catalogs should be watched.
+func (m *etcdMinion) checkCatalogs() (uint64, error) {
+	opts := &etcdclient.GetOptions{
+		Recursive: true,
+	}
+
+	resp, err := m.kapi.Get(context.Background(), EtcdCatalogSpace, opts)
+	if err != nil {
+		// No catalogs have been pushed yet
+		if eerr, ok := err.(etcdclient.Error); ok && eerr.Code == etcdclient.ErrorCodeKeyNotFound {
+			return eerr.Index, nil
+		}
+		return 0, err
+	}
+
+	// Collect the catalogs for the minion and process
+	// them in the order in which they were submitted
+	keys := m.catalogKeys()
+	var pending []*etcdclient.Node
+	var walk func(nodes etcdclient.Nodes)
+	walk = func(nodes etcdclient.Nodes) {
+		for _, node := range nodes {
+			if node.Dir {
+				walk(node.Nodes)
+			} else if keys[node.Key] {
+				pending = append(pending, node)
+			}
+		}
+	}
+	walk(resp.Node.Nodes)
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].ModifiedIndex < pending[j].ModifiedIndex
+	})
+
+	for _, node := range pending {
+		if err := m.queueCatalog(node); err != nil {
+			log.Printf("Unable to queue catalog: %s\n", err)
+		}
+	}
+
+	return resp.Index, nil
+}
+
+// catalogListener watches etcd for catalogs pushed to the minion.
+// Catalogs pushed while the minion was not watching, e.g. when
+// being offline, are processed when the watch is (re)established.
+func (m *etcdMinion) catalogListener() {
+	log.Printf("Catalog listener is watching %s\n", EtcdCatalogSpace)
+
+	b := backoff.Backoff{
+		Min:    1 * time.Second,
+		Max:    10 * time.Minute,
+		Factor: 2.0,
+		Jitter: true,
+	}
+
+	var watcher etcdclient.Watcher
+	for {
+		select {
+		case <-m.done:
+			return
+		default:
+		}
+
+		if watcher == nil {
+			index, err := m.checkCatalogs()
+			if err != nil {
+				duration := b.Duration()
+				log.Printf("Unable to check catalogs: %s, retrying in %s\n", err, duration)
+				time.Sleep(duration)
+				continue
+			}
+
+			opts := &etcdclient.WatcherOptions{
+				AfterIndex: index,
+				Recursive:  true,
+			}
+			watcher = m.kapi.Watcher(EtcdCatalogSpace, opts)
+		}
+
+		resp, err := watcher.Next(context.Background())
+		if err != nil {
+			// Catch up on any missed catalogs once reconnected
+			watcher = nil
+			duration := b.Duration()
+			log.Printf("%s, retrying in %s\n", err, duration)
+			time.Sleep(duration)
+			continue
+		}
+
+		b.Reset()
+
+		action := strings.ToLower(resp.Action)
+		if action != "set" && action != "create" && action != "update" && action != "compareandswap" {
+			continue
+		}
+
+		if !m.catalogKeys()[resp.Node.Key] {
+			continue
+		}
+
+		if err := m.queueCatalog(resp.Node); err != nil {
+			log.Printf("Unable to queue catalog: %s\n", err)
+		}
+	}
+}
+
+// saveCatalogResult stores the result of a catalog run in etcd. The
+// result is truncated to the max size and expires after the result TTL.
+func (m *etcdMinion) saveCatalogResult(result *task.CatalogResult) error {
+	data, err := result.Marshal(m.config.MaxResultSize)
+	if err != nil {
+		return err
+	}
+
+	opts := &etcdclient.SetOptions{
+		PrevExist: etcdclient.PrevIgnore,
+		TTL:       m.config.ResultTTL,
+	}
+
+	_, err = m.kapi.Set(context.Background(), EtcdCatalogResultKey(m.id, result.RunID), string(data), opts)
+
+	return err
+}
+
+// processCatalog applies a catalog pushed to the minion and
+// marks it as applied, so that it is not processed again.
+func (m *etcdMinion) processCatalog(pc *pushedCatalog) error {
+	// The catalog may have been queued more than once,
+	// e.g. when catching up after reconnecting
+	applied, err := m.isApplied(pc.key, pc.run)
+	if err != nil || applied {
+		return err
+	}
+
+	result := &task.CatalogResult{
+		RunID:        pc.run.ID,
+		Minion:       m.id,
+		State:        task.TaskStateProcessing,
+		TimeReceived: time.Now().Unix(),
+	}
+
+	rr := m.runs.add(RunInfo{
+		ID:           pc.run.ID,
+		Module:       pc.run.Module,
+		DryRun:       pc.run.DryRun,
+		State:        task.TaskStateQueued,
+		TimeReceived: result.TimeReceived,
+	})
+	m.runs.start(rr)
+
+	if err := m.saveCatalogResult(result); err != nil {
+		log.Printf("Unable to save result of catalog run %s: %s\n", pc.run.ID, err)
+	}
+
+	var buf bytes.Buffer
+	var report *catalog.Report
+	unlock, err := m.lockRun()
+	if err == nil {
+		report, err = m.applyCatalog(pc.run, log.New(io.MultiWriter(&buf, rr.log), "", log.LstdFlags))
+		unlock()
+	} else {
+		err = fmt.Errorf("unable to acquire run lock: %s", err)
+	}
+
+	switch {
+	case err != nil:
+		fmt.Fprintf(&buf, "%s\n", err)
+		result.State = task.TaskStateFailed
+	case report.Failed > 0 || report.Error != "":
+		result.State = task.TaskStateFailed
+	default:
+		result.State = task.TaskStateSuccess
+	}
+
+	result.Report = report
+	result.Log = buf.String()
+	result.TimeProcessed = time.Now().Unix()
+
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+	}
+	m.runs.finish(rr, result.State, report, errMsg)
+
+	if err := m.saveCatalogResult(result); err != nil {
+		log.Printf("Unable to save result of catalog run %s: %s\n", pc.run.ID, err)
+	}
+
+	opts := &etcdclient.SetOptions{
+		PrevExist: etcdclient.PrevIgnore,
+	}
+
+	_, err = m.kapi.Set(context.Background(), EtcdAppliedCatalogKey(m.id, pc.key), pc.run.ID.String(), opts)
+
+	return err
+}
+
+// applyCatalog fetches the site data of a catalog run and applies
+// the catalog, returning the report of the processed resources.
+func (m *etcdMinion) applyCatalog(run *task.CatalogRun, logger *log.Logger) (*catalog.Report, error) {
+	siteDir := ""
+	if run.SiteURL != "" {
+		logger.Printf("Fetching site data %s\n", run.SiteChecksum)
+		dir, err := utils.FetchArchiveCached(context.Background(), run.SiteURL, run.SiteChecksum, m.config.SiteCacheDir)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch site data: %s", err)
+		}
+		siteDir = dir
+	}
+
+	module := run.Module
+	if run.Source != "" {
+		dir, err := ioutil.TempDir("", "gru-catalog")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+
+		module = filepath.Join(dir, filepath.Base(run.Module))
+		if err := ioutil.WriteFile(module, []byte(run.Source), 0600); err != nil {
+			return nil, err
+		}
+	} else {
+		file, err := utils.SecureJoin(siteDir, run.Module)
+		if err != nil {
+			return nil, err
+		}
+		module = file
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+
+	config := &catalog.Config{
+		Module:         module,
+		DryRun:         run.DryRun,
+		Logger:         logger,
+		SiteRepo:       siteDir,
+		SiteRevision:   run.SiteChecksum,
+		L:              L,
+		Concurrency:    m.config.Concurrency,
+		RunID:          run.ID.String(),
+		Vars:           run.Vars,
+		CollectUpdates: m.config.CollectUpdates,
+	}
+
+	katalog := catalog.New(config)
+	if err := katalog.Load(); err != nil {
+		return nil, err
+	}
+
+	status := katalog.Run()
+	status.Summary(logger)
+	report := status.Report()
+
+	return &report, nil
+}
@@ -31,6 +31,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"os"
@@ -85,6 +86,21 @@ type etcdMinion struct {
 	// Channel over which tasks are sent for processing
 	taskQueue chan *task.Task
 
+	// Channel over which pushed catalogs are sent for processing
+	catalogQueue chan *pushedCatalog
+
+	// Channel over which runs triggered using the API are sent for processing
+	apiQueue chan *task.Task
+
+	// Recent runs, which can be queried using the API
+	runs *runHistory
+
+	// Lock held while processing runs, if any
+	runLock *utils.FileLock
+
+	// Time the minion was started
+	started time.Time
+
 	// The Git repository of the site repo
 	gitRepo *utils.GitRepo
 
@@ -106,6 +122,31 @@ type EtcdMinionConfig struct {
 
 	// EtcdConfig provides etcd-related configuration settings
 	EtcdConfig etcdclient.Config
+
+	// Directory in which the site data of pushed catalogs is
+	// cached by checksum. Defaults to "site-cache" in the
+	// current working directory.
+	SiteCacheDir string
+
+	// Time after which results of catalog runs expire in etcd.
+	// Defaults to DefaultResultTTL.
+	ResultTTL time.Duration
+
+	// Max size in bytes of the results of catalog runs.
+	// Defaults to task.DefaultMaxResultSize.
+	MaxResultSize int
+
+	// Path to the lock file held while processing runs, so that
+	// runs do not overlap with runs of gructl apply using the
+	// same lock file. No lock is used if empty.
+	RunLockFile string
+
+	// Collect the pending package updates after catalog runs,
+	// which are then reported as classifiers of the minion
+	CollectUpdates bool
+
+	// Settings of the HTTP API, which is not served if nil
+	API *APIConfig
 }
 
 // NewEtcdMinion creates a new minion with etcd backend
@@ -125,6 +166,32 @@ func NewEtcdMinion(config *EtcdMinionConfig) (Minion, error) {
 		return nil, err
 	}
 
+	if config.SiteCacheDir == "" {
+		config.SiteCacheDir = filepath.Join(cwd, "site-cache")
+	}
+
+	if config.ResultTTL == 0 {
+		config.ResultTTL = DefaultResultTTL
+	}
+
+	if config.MaxResultSize == 0 {
+		config.MaxResultSize = task.DefaultMaxResultSize
+	}
+
+	if config.API != nil {
+		if config.API.Address == "" {
+			config.API.Address = DefaultAPIAddress
+		}
+		if err := config.API.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var runLock *utils.FileLock
+	if config.RunLockFile != "" {
+		runLock = utils.NewFileLock(config.RunLockFile)
+	}
+
 	id := utils.GenerateUUID(config.Name)
 	rootDir := filepath.Join(EtcdMinionSpace, id.String())
 	m := &etcdMinion{
@@ -137,6 +204,10 @@ func NewEtcdMinion(config *EtcdMinionConfig) (Minion, error) {
 		id:            id,
 		kapi:          etcdclient.NewKeysAPI(c),
 		taskQueue:     make(chan *task.Task),
+		catalogQueue:  make(chan *pushedCatalog),
+		apiQueue:      make(chan *task.Task, apiQueueSize),
+		runs:          newRunHistory(),
+		runLock:       runLock,
 		gitRepo:       gitRepo,
 		done:          make(chan struct{}),
 	}
@@ -203,15 +274,56 @@ func (m *etcdMinion) periodicRunner() {
 	}
 }
 
+// lockRun acquires the run lock, if any, waiting for runs of other
+// processes to finish. It returns a function releasing the lock.
+func (m *etcdMinion) lockRun() (func(), error) {
+	if m.runLock == nil {
+		return func() {}, nil
+	}
+
+	if err := m.runLock.TryLock(); err != nil {
+		if !errors.Is(err, utils.ErrLocked) {
+			return nil, err
+		}
+
+		log.Printf("Waiting for run lock: %s\n", err)
+		if err := m.runLock.Acquire(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() { m.runLock.Close() }, nil
+}
+
 // Processes new tasks
 func (m *etcdMinion) processTask(t *task.Task) error {
+	rr := m.runs.add(taskRunInfo(t))
+	m.runs.start(rr)
+
+	var report *catalog.Report
 	defer func() {
 		t.TimeProcessed = time.Now().Unix()
 		m.SaveTaskResult(t)
+
+		errMsg := ""
+		if t.State != task.TaskStateSuccess {
+			errMsg = strings.TrimSpace(t.Result)
+		}
+		m.runs.finish(rr, t.State, report, errMsg)
 	}()
 
+	unlock, err := m.lockRun()
+	if err != nil {
+		msg := fmt.Sprintf("Unable to acquire run lock: %s\n", err)
+		log.Print(msg)
+		t.State = task.TaskStateSkipped
+		t.Result = msg
+		return err
+	}
+	defer unlock()
+
 	// Sync the module and data files, then process the task
-	err := m.Sync()
+	err = m.Sync()
 	if err != nil {
 		msg := fmt.Sprintf("Unable to sync site directory: %s\n", err)
 		log.Printf(msg)
@@ -239,12 +351,14 @@ func (m *etcdMinion) processTask(t *task.Task) error {
 	defer L.Close()
 
 	config := &catalog.Config{
-		Module:      t.Command,
-		DryRun:      t.DryRun,
-		Logger:      log.New(&buf, "", log.LstdFlags),
-		SiteRepo:    m.gitRepo.Path,
-		L:           L,
-		Concurrency: m.config.Concurrency,
+		Module:         t.Command,
+		DryRun:         t.DryRun,
+		Logger:         log.New(io.MultiWriter(&buf, rr.log), "", log.LstdFlags),
+		SiteRepo:       m.gitRepo.Path,
+		L:              L,
+		Concurrency:    m.config.Concurrency,
+		RunID:          t.ID.String(),
+		CollectUpdates: m.config.CollectUpdates,
 	}
 
 	katalog := catalog.New(config)
@@ -256,6 +370,8 @@ func (m *etcdMinion) processTask(t *task.Task) error {
 
 	status := katalog.Run()
 	status.Summary(config.Logger)
+	r := status.Report()
+	report = &r
 
 	t.Result = buf.String()
 	t.State = task.TaskStateSuccess
@@ -267,6 +383,9 @@ func (m *etcdMinion) processTask(t *task.Task) error {
 func (m *etcdMinion) classify() error {
 	for key := range classifier.Registry {
 		klassifier, err := classifier.Get(key)
+		if err == classifier.ErrClassifierNotFound {
+			continue
+		}
 
 		if err != nil {
 			log.Printf("Failed to get classifier %s: %s\n", key, err)
@@ -411,7 +530,7 @@ func (m *etcdMinion) TaskListener(c chan<- *task.Task) error {
 	return nil
 }
 
-// TaskRunner processes new tasks
+// TaskRunner processes new tasks and pushed catalogs
 func (m *etcdMinion) TaskRunner(c <-chan *task.Task) error {
 	log.Println("Starting task runner")
 
@@ -423,6 +542,16 @@ func (m *etcdMinion) TaskRunner(c <-chan *task.Task) error {
 			log.Printf("Processing task %s\n", t.ID)
 			m.processTask(t)
 			log.Printf("Finished processing task %s\n", t.ID)
+		case t := <-m.apiQueue:
+			log.Printf("Processing run %s\n", t.ID)
+			m.processTask(t)
+			log.Printf("Finished processing run %s\n", t.ID)
+		case pc := <-m.catalogQueue:
+			log.Printf("Processing catalog run %s\n", pc.run.ID)
+			if err := m.processCatalog(pc); err != nil {
+				log.Printf("Unable to process catalog run %s: %s\n", pc.run.ID, err)
+			}
+			log.Printf("Finished processing catalog run %s\n", pc.run.ID)
 		}
 	}
 
@@ -510,12 +639,24 @@ func (m *etcdMinion) Serve() error {
 		return err
 	}
 
+	// The API is only served once it is listening, so that
+	// failures are reported when starting the minion
+	if m.config.API != nil {
+		l, err := m.config.API.listen()
+		if err != nil {
+			return err
+		}
+		go m.serveAPI(l)
+	}
+	m.started = time.Now()
+
 	// Start minion services
 	go m.classify()
 	go m.checkQueue()
 	go m.periodicRunner()
 	go m.TaskRunner(m.taskQueue)
 	go m.TaskListener(m.taskQueue)
+	go m.catalogListener()
 
 	log.Printf("Minion %s is ready to serve", m.ID())
 
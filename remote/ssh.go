@@ -0,0 +1,680 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package remote applies catalogs on remote hosts over SSH, without
+// having a minion running on them.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dnaeon/gru/catalog"
+	"github.com/dnaeon/gru/utils"
+)
+
+// DefaultForks is the default number of hosts processed concurrently.
+const DefaultForks = 5
+
+// Host key checking policies, as understood by the
+// StrictHostKeyChecking option of OpenSSH.
+const (
+	HostKeyCheckingStrict    = "yes"
+	HostKeyCheckingAcceptNew = "accept-new"
+	HostKeyCheckingNone      = "no"
+)
+
+// sshUnreachableCode is the exit code of ssh(1) and sftp(1)
+// when the connection to the remote host fails.
+const sshUnreachableCode = 255
+
+// vcsDirs are not shipped as part of the site repo.
+var vcsDirs = []string{".git", ".hg", ".svn"}
+
+// ErrUnreachable is returned when a remote host cannot be connected to.
+var ErrUnreachable = errors.New("Host is unreachable")
+
+// Host type represents a remote host.
+type Host struct {
+	// User to login as, if empty the ssh(1) configuration is used
+	User string
+
+	// Name of the host
+	Name string
+
+	// Port of the SSH server, if empty the ssh(1) configuration is used
+	Port string
+}
+
+// String returns the host in the user@host:port form.
+func (h Host) String() string {
+	s := h.Name
+	if strings.Contains(s, ":") {
+		s = "[" + s + "]"
+	}
+	if h.User != "" {
+		s = h.User + "@" + s
+	}
+	if h.Port != "" {
+		s += ":" + h.Port
+	}
+
+	return s
+}
+
+// destination returns the host in the form accepted by ssh(1) and sftp(1).
+func (h Host) destination() string {
+	if h.User != "" {
+		return h.User + "@" + h.Name
+	}
+
+	return h.Name
+}
+
+// ParseHosts parses a comma separated list of hosts,
+// e.g. "admin@web1,web2:2222,[2001:db8::1]:22". Hosts without
+// a user login as the user of the preceding host.
+func ParseHosts(s string) ([]Host, error) {
+	var hosts []Host
+	user := ""
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		h := Host{Name: item}
+		if i := strings.LastIndex(item, "@"); i != -1 {
+			user = item[:i]
+			h.Name = item[i+1:]
+		}
+		h.User = user
+
+		switch {
+		case strings.HasPrefix(h.Name, "["):
+			end := strings.Index(h.Name, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("Invalid host %q", item)
+			}
+			rest := h.Name[end+1:]
+			h.Name = h.Name[1:end]
+			if rest != "" {
+				if !strings.HasPrefix(rest, ":") {
+					return nil, fmt.Errorf("Invalid host %q", item)
+				}
+				h.Port = rest[1:]
+			}
+		case strings.Count(h.Name, ":") == 1:
+			i := strings.Index(h.Name, ":")
+			h.Name, h.Port = h.Name[:i], h.Name[i+1:]
+		}
+
+		if h.Name == "" || strings.HasPrefix(h.Name, "-") {
+			return nil, fmt.Errorf("Invalid host %q", item)
+		}
+		if h.Port != "" {
+			if _, err := strconv.ParseUint(h.Port, 10, 16); err != nil {
+				return nil, fmt.Errorf("Invalid port in host %q", item)
+			}
+		}
+
+		hosts = append(hosts, h)
+	}
+
+	if len(hosts) == 0 {
+		return nil, errors.New("No hosts specified")
+	}
+
+	return hosts, nil
+}
+
+// Config type contains the settings for applying
+// a catalog on remote hosts.
+type Config struct {
+	// Hosts to apply the catalog on
+	Hosts []Host
+
+	// Forks is the number of hosts processed concurrently
+	Forks int
+
+	// Timeout for processing a single host, including the
+	// upload of files. Zero means no timeout.
+	Timeout time.Duration
+
+	// Binary is the path to a local gructl binary, which is
+	// copied to the remote hosts. If empty RemoteBinary is
+	// expected to be already installed there.
+	Binary string
+
+	// RemoteBinary is the gructl binary used on the remote
+	// hosts, when Binary is not specified.
+	RemoteBinary string
+
+	// HostKeyChecking is the policy for verifying host keys,
+	// either "yes", "accept-new" or "no".
+	HostKeyChecking string
+
+	// Sudo executes gructl on the remote hosts using sudo(8)
+	Sudo bool
+
+	// Module is the path to the module to apply, or an
+	// http(s) url which is fetched by the remote hosts
+	Module string
+
+	// SiteRepo is the path to the site repo, which is shipped
+	// to the remote hosts. Remote urls are fetched by the
+	// remote hosts instead.
+	SiteRepo string
+
+	// Args are additional arguments passed to "gructl apply"
+	Args []string
+
+	// Output is where the output of the remote
+	// hosts is written to, prefixed by the host
+	Output io.Writer
+
+	// SSH and SFTP are the ssh(1) and sftp(1) commands
+	SSH  string
+	SFTP string
+}
+
+// Validate validates the configuration and sets the
+// defaults for the unspecified settings.
+func (c *Config) Validate() error {
+	if len(c.Hosts) == 0 {
+		return errors.New("No hosts specified")
+	}
+
+	if c.Module == "" {
+		return errors.New("No module specified")
+	}
+
+	switch c.HostKeyChecking {
+	case "":
+		c.HostKeyChecking = HostKeyCheckingStrict
+	case HostKeyCheckingStrict, HostKeyCheckingAcceptNew, HostKeyCheckingNone:
+		break
+	default:
+		return fmt.Errorf("Invalid host key checking policy %q", c.HostKeyChecking)
+	}
+
+	if c.Forks < 1 {
+		c.Forks = DefaultForks
+	}
+
+	if c.RemoteBinary == "" {
+		c.RemoteBinary = "gructl"
+	}
+
+	if c.Output == nil {
+		c.Output = os.Stdout
+	}
+
+	if c.SSH == "" {
+		c.SSH = "ssh"
+	}
+
+	if c.SFTP == "" {
+		c.SFTP = "sftp"
+	}
+
+	return nil
+}
+
+// Result type contains the outcome of applying
+// the catalog on a remote host.
+type Result struct {
+	// Host the catalog was applied on
+	Host Host
+
+	// Unreachable is true when the host could not be connected to
+	Unreachable bool
+
+	// ExitCode of gructl on the remote host
+	ExitCode int
+
+	// Totals reported by the remote host, if any
+	Totals *catalog.Totals
+
+	// Err is the error, if any, which occurred
+	Err error
+}
+
+// Failed returns true if the catalog was not
+// applied successfully on the host.
+func (r Result) Failed() bool {
+	return r.Err != nil || r.ExitCode != 0
+}
+
+// Apply applies the catalog on the configured remote hosts and
+// returns the results in the order of the hosts. Unreachable and
+// failing hosts do not stop the processing of the other hosts.
+func Apply(ctx context.Context, c *Config) ([]Result, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	// The site repo is archived once and
+	// shipped as is to all remote hosts
+	var site string
+	if c.SiteRepo != "" && !isRemote(c.SiteRepo) {
+		f, err := ioutil.TempFile("", "gru-site")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(f.Name())
+
+		err = utils.CreateTarGz(f, c.SiteRepo, vcsDirs)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		site = f.Name()
+	}
+
+	out := &lockedWriter{w: c.Output}
+	results := make([]Result, len(c.Hosts))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+
+	forks := c.Forks
+	if forks > len(c.Hosts) {
+		forks = len(c.Hosts)
+	}
+
+	for i := 0; i < forks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = c.applyHost(ctx, c.Hosts[i], site, out)
+			}
+		}()
+	}
+
+	for i := range c.Hosts {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	return results, nil
+}
+
+// applyHost applies the catalog on a single remote host.
+func (c *Config) applyHost(ctx context.Context, h Host, site string, out *lockedWriter) Result {
+	result := Result{Host: h}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	prefix := h.String() + ": "
+	stdout := newPrefixWriter(out, prefix)
+	stderr := newPrefixWriter(out, prefix)
+	defer stdout.Flush()
+	defer stderr.Flush()
+
+	// Create a private directory for the uploaded files
+	var buf bytes.Buffer
+	code, err := c.run(ctx, c.sshCommand(h, "mktemp -d /tmp/gru.XXXXXXXX"), nil, &buf, stderr)
+	if err != nil || code != 0 {
+		result.Unreachable = code == sshUnreachableCode
+		result.Err = commandError(ctx, "create remote directory", code, err)
+		return result
+	}
+	dir := strings.TrimSpace(buf.String())
+	if !strings.HasPrefix(dir, "/tmp/gru.") || strings.ContainsAny(dir, "\n'") {
+		result.Err = fmt.Errorf("Unexpected remote directory %q", dir)
+		return result
+	}
+
+	batch, cmdline := c.plan(dir, site)
+	code, err = c.run(ctx, c.sftpCommand(h), strings.NewReader(batch), stdout, stderr)
+	if err != nil || code != 0 {
+		result.Unreachable = code == sshUnreachableCode
+		result.Err = commandError(ctx, "upload files", code, err)
+		c.cleanup(h, dir)
+		return result
+	}
+
+	// Remember the last JSON line, which is the summary of the run
+	var summary []byte
+	stdout.onLine = func(line []byte) bool {
+		if bytes.HasPrefix(line, []byte("{")) {
+			summary = append(summary[:0], line...)
+			return false
+		}
+		return true
+	}
+
+	code, err = c.run(ctx, c.sshCommand(h, cmdline), nil, stdout, stderr)
+	stdout.Flush()
+	if err != nil {
+		result.Err = commandError(ctx, "apply catalog", code, err)
+		c.cleanup(h, dir)
+		return result
+	}
+	if code == sshUnreachableCode {
+		result.Unreachable = true
+		result.Err = ErrUnreachable
+		c.cleanup(h, dir)
+		return result
+	}
+
+	result.ExitCode = code
+	if summary != nil {
+		var totals catalog.Totals
+		if err := json.Unmarshal(summary, &totals); err == nil {
+			result.Totals = &totals
+		}
+	}
+	if code != 0 {
+		result.Err = fmt.Errorf("Apply failed with exit code %d", code)
+	}
+
+	return result
+}
+
+// plan returns the sftp(1) batch which uploads the files to the
+// remote directory, and the command line applying the catalog.
+func (c *Config) plan(dir, site string) (string, string) {
+	var batch bytes.Buffer
+	var script []string
+	var args []string
+
+	bin := c.RemoteBinary
+	if c.Binary != "" {
+		bin = dir + "/gructl"
+		fmt.Fprintf(&batch, "put %s %s\n", sftpQuote(c.Binary), sftpQuote(bin))
+		fmt.Fprintf(&batch, "chmod 700 %s\n", sftpQuote(bin))
+	}
+
+	module := c.Module
+	if !isRemote(module) {
+		module = dir + "/module.lua"
+		fmt.Fprintf(&batch, "put %s %s\n", sftpQuote(c.Module), sftpQuote(module))
+	}
+
+	switch {
+	case site != "":
+		fmt.Fprintf(&batch, "put %s %s\n", sftpQuote(site), sftpQuote(dir+"/site.tar.gz"))
+		script = append(script, "mkdir site", "tar -xzf site.tar.gz -C site")
+		args = append(args, "--siterepo", dir+"/site")
+	case c.SiteRepo != "":
+		args = append(args, "--siterepo", c.SiteRepo)
+	}
+
+	args = append(args, "--json-summary")
+	args = append(args, c.Args...)
+	args = append(args, module)
+
+	apply := shellQuote(bin) + " apply"
+	if c.Sudo {
+		apply = "sudo -n " + apply
+	}
+	for _, arg := range args {
+		apply += " " + shellQuote(arg)
+	}
+
+	script = append([]string{"cd " + shellQuote(dir)}, script...)
+	script = append(script, apply)
+	cmdline := fmt.Sprintf("trap %s EXIT; %s", shellQuote("rm -rf "+shellQuote(dir)), strings.Join(script, " && "))
+
+	return batch.String(), cmdline
+}
+
+// cleanup removes the remote directory, after a failure
+// prevented the remote script from removing it.
+func (c *Config) cleanup(h Host, dir string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	c.run(ctx, c.sshCommand(h, "rm -rf "+shellQuote(dir)), nil, ioutil.Discard, ioutil.Discard)
+}
+
+// options returns the options common to ssh(1) and sftp(1).
+func (c *Config) options() []string {
+	return []string{
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=" + c.HostKeyChecking,
+	}
+}
+
+// sshCommand returns the ssh(1) command line executing
+// the given command on the remote host.
+func (c *Config) sshCommand(h Host, command string) []string {
+	args := append([]string{c.SSH}, c.options()...)
+	if h.Port != "" {
+		args = append(args, "-p", h.Port)
+	}
+
+	return append(args, "--", h.destination(), command)
+}
+
+// sftpCommand returns the sftp(1) command line executing
+// a batch read from stdin on the remote host.
+func (c *Config) sftpCommand(h Host) []string {
+	args := append([]string{c.SFTP, "-b", "-"}, c.options()...)
+	if h.Port != "" {
+		args = append(args, "-P", h.Port)
+	}
+
+	// sftp(1) treats colons in the host as a path
+	name := h.Name
+	if strings.Contains(name, ":") {
+		name = "[" + name + "]"
+	}
+	if h.User != "" {
+		name = h.User + "@" + name
+	}
+
+	return append(args, "--", name)
+}
+
+// run executes a command and returns its exit code. An error is
+// returned when the command could not be executed at all.
+func (c *Config) run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	return 0, nil
+}
+
+// commandError returns the error for a failed step.
+func commandError(ctx context.Context, step string, code int, err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("Timed out trying to %s", step)
+	case err != nil:
+		return fmt.Errorf("Unable to %s: %s", step, err)
+	case code == sshUnreachableCode:
+		return ErrUnreachable
+	default:
+		return fmt.Errorf("Unable to %s: exit code %d", step, code)
+	}
+}
+
+// isRemote returns true if the given path
+// is fetched by the remote hosts themselves.
+func isRemote(path string) bool {
+	return utils.IsRemoteURL(path) || utils.IsGitURL(path)
+}
+
+// shellQuote quotes a string for use in a POSIX shell.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:@,+%", r))
+	}) == -1 {
+		return s
+	}
+
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// sftpQuote quotes a path for use in an sftp(1) batch.
+func sftpQuote(s string) string {
+	s = filepath.ToSlash(s)
+	s = strings.Replace(s, `\`, `\\`, -1)
+
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
+
+// lockedWriter serializes the writes of concurrently processed hosts.
+type lockedWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.w.Write(p)
+}
+
+// prefixWriter writes complete lines to the underlying
+// writer, each of them prefixed by the given prefix.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+
+	// onLine is called for each line, and
+	// the line is written only if it returns true
+	onLine func(line []byte) bool
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: prefix}
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i == -1 {
+			break
+		}
+		p.writeLine(p.buf[:i])
+		p.buf = p.buf[i+1:]
+	}
+
+	return len(data), nil
+}
+
+// Flush writes any incomplete line left in the buffer.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(p.buf)
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	if p.onLine != nil && !p.onLine(line) {
+		return
+	}
+
+	p.w.Write([]byte(p.prefix + string(line) + "\n"))
+}
+
+// Summary writes a summary of the results and returns
+// the number of hosts which failed or were unreachable.
+func Summary(w io.Writer, results []Result) int {
+	failed := 0
+	var unreachable []string
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tSTATUS\tUP-TO-DATE\tCHANGED\tFAILED\tERROR")
+	for _, r := range results {
+		status := "ok"
+		switch {
+		case r.Unreachable:
+			status = "unreachable"
+			unreachable = append(unreachable, r.Host.String())
+		case r.Failed():
+			status = "failed"
+		}
+		if r.Failed() {
+			failed++
+		}
+
+		upToDate, changed, failedResources := "-", "-", "-"
+		if r.Totals != nil {
+			upToDate = strconv.Itoa(r.Totals.UpToDate)
+			changed = strconv.Itoa(r.Totals.Changed)
+			failedResources = strconv.Itoa(r.Totals.Failed)
+		}
+
+		msg := ""
+		if r.Err != nil {
+			msg = r.Err.Error()
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Host, status, upToDate, changed, failedResources, msg)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "%d host(s), %d ok, %d failed\n", len(results), len(results)-failed, failed)
+	if len(unreachable) > 0 {
+		sort.Strings(unreachable)
+		fmt.Fprintf(w, "Unreachable hosts: %s\n", strings.Join(unreachable, ", "))
+	}
+
+	return failed
+}
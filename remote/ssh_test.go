@@ -0,0 +1,269 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnaeon/gru/catalog"
+)
+
+// fakeSSH executes the remote command locally, and
+// fails to connect to hosts named "unreachable".
+const fakeSSH = `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-o|-p) shift 2 ;;
+	--) shift; break ;;
+	*) break ;;
+	esac
+done
+case "$1" in
+*unreachable*) echo "ssh: connect to host $1 port 22: Connection refused" >&2; exit 255 ;;
+esac
+exec sh -c "$2"
+`
+
+// fakeSFTP executes the put and chmod commands of the batch locally.
+const fakeSFTP = `#!/bin/sh
+while IFS= read -r line; do
+	eval "set -- $line"
+	case "$1" in
+	put) cp "$2" "$3" || exit 1 ;;
+	chmod) chmod "$2" "$3" || exit 1 ;;
+	*) exit 1 ;;
+	esac
+done
+`
+
+// fakeGructl prints the module and the site data it was given.
+const fakeGructl = `#!/bin/sh
+site=""
+while [ $# -gt 1 ]; do
+	case "$1" in
+	--siterepo) site="$2"; shift ;;
+	esac
+	shift
+done
+cat "$1"
+cat "$site/data/motd"
+echo '{"up_to_date":1,"changed":2,"failed":0,"bytes_written":0,"bytes_pending":0}'
+`
+
+func writeScript(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestParseHosts(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  []Host
+		isErr bool
+	}{
+		{
+			s:    "web1",
+			want: []Host{{Name: "web1"}},
+		},
+		{
+			s: "admin@web1, web2:2222,root@[2001:db8::1]:22,2001:db8::2",
+			want: []Host{
+				{User: "admin", Name: "web1"},
+				{User: "admin", Name: "web2", Port: "2222"},
+				{User: "root", Name: "2001:db8::1", Port: "22"},
+				{User: "root", Name: "2001:db8::2"},
+			},
+		},
+		{s: "", isErr: true},
+		{s: "web1:ssh", isErr: true},
+		{s: "[2001:db8::1", isErr: true},
+		{s: "user@-oProxyCommand=true", isErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseHosts(test.s)
+		if test.isErr != (err != nil) {
+			t.Errorf("%q: want error %t, got %v", test.s, test.isErr, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.want, got) {
+			t.Errorf("%q: want hosts %v, got %v", test.s, test.want, got)
+		}
+	}
+
+	h := Host{User: "root", Name: "2001:db8::1", Port: "22"}
+	if h.String() != "root@[2001:db8::1]:22" {
+		t.Errorf("want host root@[2001:db8::1]:22, got %s", h)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "gru-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	site := filepath.Join(tmpdir, "site")
+	if err := os.MkdirAll(filepath.Join(site, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(site, "data", "motd"), []byte("welcome\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	module := filepath.Join(tmpdir, "module.lua")
+	if err := ioutil.WriteFile(module, []byte("-- module\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	config := &Config{
+		Hosts: []Host{
+			{User: "admin", Name: "web1"},
+			{Name: "unreachable"},
+			{Name: "web2", Port: "2222"},
+		},
+		Forks:    2,
+		Timeout:  time.Minute,
+		Binary:   writeScript(t, tmpdir, "gructl", fakeGructl),
+		Module:   module,
+		SiteRepo: site,
+		Output:   &out,
+		SSH:      writeScript(t, tmpdir, "ssh", fakeSSH),
+		SFTP:     writeScript(t, tmpdir, "sftp", fakeSFTP),
+	}
+
+	results, err := Apply(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("want 3 results, got %d", len(results))
+	}
+
+	totals := &catalog.Totals{UpToDate: 1, Changed: 2}
+	for _, i := range []int{0, 2} {
+		r := results[i]
+		if r.Failed() || r.Unreachable {
+			t.Errorf("%s: want success, got %v", r.Host, r.Err)
+		}
+		if !reflect.DeepEqual(totals, r.Totals) {
+			t.Errorf("%s: want totals %v, got %v", r.Host, totals, r.Totals)
+		}
+	}
+
+	if !results[1].Unreachable || results[1].Err != ErrUnreachable {
+		t.Errorf("want host unreachable, got %v", results[1].Err)
+	}
+
+	for _, line := range []string{
+		"admin@web1: -- module\n",
+		"admin@web1: welcome\n",
+		"web2:2222: welcome\n",
+		"unreachable: ssh: connect to host unreachable port 22: Connection refused\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("want line %q in output, got %q", line, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "up_to_date") {
+		t.Errorf("want summary removed from output, got %q", out.String())
+	}
+
+	// Remote directories are removed once done
+	left, err := filepath.Glob("/tmp/gru.????????")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range left {
+		if _, err := os.Stat(filepath.Join(dir, "module.lua")); err == nil {
+			t.Errorf("want remote directory removed, found %s", dir)
+		}
+	}
+
+	var summary bytes.Buffer
+	if failed := Summary(&summary, results); failed != 1 {
+		t.Errorf("want 1 failed host, got %d", failed)
+	}
+	if !strings.Contains(summary.String(), "Unreachable hosts: unreachable\n") {
+		t.Errorf("want unreachable hosts in summary, got %q", summary.String())
+	}
+}
+
+func TestApplyFailure(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "gru-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	module := filepath.Join(tmpdir, "module.lua")
+	if err := ioutil.WriteFile(module, []byte("-- module\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		Hosts:        []Host{{Name: "web1"}},
+		RemoteBinary: writeScript(t, tmpdir, "gructl", "#!/bin/sh\necho 'Failed to apply'\nexit 1\n"),
+		Module:       module,
+		Output:       ioutil.Discard,
+		SSH:          writeScript(t, tmpdir, "ssh", fakeSSH),
+		SFTP:         writeScript(t, tmpdir, "sftp", fakeSFTP),
+	}
+
+	results, err := Apply(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := results[0]
+	if !r.Failed() || r.Unreachable || r.ExitCode != 1 || r.Totals != nil {
+		t.Errorf("want failed host with exit code 1, got %+v", r)
+	}
+
+	if config.HostKeyChecking != HostKeyCheckingStrict {
+		t.Errorf("want strict host key checking by default, got %s", config.HostKeyChecking)
+	}
+
+	config.HostKeyChecking = "maybe"
+	if _, err := Apply(context.Background(), config); err == nil {
+		t.Error("want error for invalid host key checking policy")
+	}
+}
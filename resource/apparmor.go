@@ -0,0 +1,362 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// appArmorConfigDir is the AppArmor profile directory.
+const appArmorConfigDir = "/etc/apparmor.d"
+
+// AppArmorProfile type is a resource which manages AppArmor profiles.
+//
+// The resource name is the name of the profile as declared in the
+// profile text, e.g. "/usr/sbin/ntpd". The profile is written to
+// /etc/apparmor.d using the conventional file name, e.g.
+// "usr.sbin.ntpd", and loaded using apparmor_parser(8).
+//
+// Profiles in complain mode are additionally linked from the
+// force-complain directory, so that they are loaded in complain
+// mode on boot as well.
+//
+// Example:
+//   ntpd = resource.apparmor_profile.new("/usr/sbin/ntpd")
+//   ntpd.state = "present"
+//   ntpd.profile = [[
+//   #include <tunables/global>
+//   /usr/sbin/ntpd {
+//     #include <abstractions/base>
+//     /etc/ntp.conf r,
+//   }
+//   ]]
+//   ntpd.enforce = false
+type AppArmorProfile struct {
+	Base
+
+	// Profile is the full text of the profile.
+	Profile string `luar:"profile"`
+
+	// Enforce specifies whether the profile is loaded in
+	// enforce mode, or in complain mode if false.
+	// Defaults to true.
+	Enforce bool `luar:"enforce"`
+
+	// The AppArmor profile directory
+	configDir string `luar:"-"`
+}
+
+// NewAppArmorProfile creates a new resource for managing AppArmor profiles.
+func NewAppArmorProfile(name string) (Resource, error) {
+	a := &AppArmorProfile{
+		Base: Base{
+			Name:              name,
+			Type:              "apparmor_profile",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        false,
+			Subscribe:         make(TriggerMap),
+		},
+		Enforce:   true,
+		configDir: appArmorConfigDir,
+	}
+
+	a.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "profile",
+			PropertySetFunc:      a.setProfile,
+			PropertyIsSyncedFunc: a.isProfileSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "mode",
+			PropertySetFunc:      a.setMode,
+			PropertyIsSyncedFunc: a.isModeSynced,
+		},
+	}
+
+	return a, nil
+}
+
+// Validate validates the resource.
+func (a *AppArmorProfile) Validate() error {
+	if err := a.Base.Validate(); err != nil {
+		return err
+	}
+
+	if strings.ContainsAny(a.Name, "\n") || a.fileName() == "" || strings.HasPrefix(a.fileName(), ".") {
+		return fmt.Errorf("invalid profile name '%s'", a.Name)
+	}
+
+	if a.State == "present" && strings.TrimSpace(a.Profile) == "" {
+		return errors.New("missing profile")
+	}
+
+	return nil
+}
+
+// fileName returns the conventional file name of the
+// profile, e.g. "usr.sbin.ntpd" for "/usr/sbin/ntpd".
+func (a *AppArmorProfile) fileName() string {
+	return strings.Replace(strings.TrimPrefix(a.Name, "/"), "/", ".", -1)
+}
+
+// path returns the path to the profile file.
+func (a *AppArmorProfile) path() string {
+	return filepath.Join(a.configDir, a.fileName())
+}
+
+// complainPath returns the path to the link in the force-complain
+// directory, which keeps the profile in complain mode on boot.
+func (a *AppArmorProfile) complainPath() string {
+	return filepath.Join(a.configDir, "force-complain", a.fileName())
+}
+
+// loadedMode returns the mode of the loaded profile as
+// reported by aa-status, or an empty string if the
+// profile is not loaded.
+func (a *AppArmorProfile) loadedMode() (string, error) {
+	spec := utils.CommandSpec{Args: []string{"aa-status", "--json"}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return "", fmt.Errorf("unable to get AppArmor status: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	var status struct {
+		Profiles map[string]string `json:"profiles"`
+	}
+
+	if err := json.Unmarshal(result.Stdout, &status); err != nil {
+		return "", fmt.Errorf("unable to parse AppArmor status: %s", err)
+	}
+
+	return status.Profiles[a.Name], nil
+}
+
+// wantMode returns the mode in which the profile should be loaded.
+func (a *AppArmorProfile) wantMode() string {
+	if a.Enforce {
+		return "enforce"
+	}
+
+	return "complain"
+}
+
+// Evaluate evaluates the state of the profile. The profile is
+// present if the profile file exists and the profile is loaded.
+func (a *AppArmorProfile) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    a.State,
+	}
+
+	fi, err := os.Stat(a.path())
+	if os.IsNotExist(err) {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return state, errors.New("path exists, but is not a regular file")
+	}
+
+	mode, err := a.loadedMode()
+	if err != nil {
+		return state, err
+	}
+
+	if mode == "" {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create writes the profile file and loads the profile.
+func (a *AppArmorProfile) Create() error {
+	a.Printf("creating %s\n", a.path())
+
+	if err := a.writeProfile(); err != nil {
+		return err
+	}
+
+	if err := a.writeComplainLink(); err != nil {
+		return err
+	}
+
+	return a.load()
+}
+
+// Delete unloads the profile and removes the profile file.
+func (a *AppArmorProfile) Delete() error {
+	a.Printf("unloading profile\n")
+
+	spec := utils.CommandSpec{Args: []string{"apparmor_parser", "-R", a.path()}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("unable to unload profile: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	a.Printf("removing %s\n", a.path())
+
+	if err := os.Remove(a.complainPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Remove(a.path())
+}
+
+// isProfileSynced checks whether the profile file is in sync.
+func (a *AppArmorProfile) isProfileSynced() (bool, error) {
+	data, err := ioutil.ReadFile(a.path())
+	if os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(data, []byte(a.Profile)), nil
+}
+
+// setProfile updates the profile file and reloads the profile.
+func (a *AppArmorProfile) setProfile() error {
+	a.Printf("updating %s\n", a.path())
+
+	if err := a.writeProfile(); err != nil {
+		return err
+	}
+
+	return a.load()
+}
+
+// isModeSynced checks whether the profile is loaded in the wanted mode.
+func (a *AppArmorProfile) isModeSynced() (bool, error) {
+	mode, err := a.loadedMode()
+	if err != nil {
+		return false, err
+	}
+
+	if mode == "" {
+		return false, ErrResourceAbsent
+	}
+
+	if mode != a.wantMode() {
+		a.Debugf("profile is in %s mode, should be in %s mode\n", mode, a.wantMode())
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// setMode reloads the profile in the wanted mode.
+func (a *AppArmorProfile) setMode() error {
+	a.Printf("setting mode to %s\n", a.wantMode())
+
+	if err := a.writeComplainLink(); err != nil {
+		return err
+	}
+
+	return a.load()
+}
+
+// writeProfile writes the profile file.
+func (a *AppArmorProfile) writeProfile() error {
+	if err := os.MkdirAll(a.configDir, 0755); err != nil {
+		return err
+	}
+
+	return writeFile(a.path(), []byte(a.Profile), 0644)
+}
+
+// writeComplainLink creates or removes the link in the
+// force-complain directory depending on the wanted mode.
+func (a *AppArmorProfile) writeComplainLink() error {
+	link := a.complainPath()
+	if a.Enforce {
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if _, err := os.Lstat(link); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return err
+	}
+
+	return os.Symlink(a.path(), link)
+}
+
+// load loads or replaces the profile in the wanted mode.
+func (a *AppArmorProfile) load() error {
+	args := []string{"apparmor_parser", "-r"}
+	if !a.Enforce {
+		args = append(args, "-C")
+	}
+	args = append(args, a.path())
+
+	a.Printf("loading profile in %s mode\n", a.wantMode())
+
+	result, err := utils.RunCommand(context.Background(), utils.CommandSpec{Args: args})
+	if err != nil {
+		return fmt.Errorf("unable to load profile: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "apparmor_profile",
+		Provider:  NewAppArmorProfile,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
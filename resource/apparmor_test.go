@@ -0,0 +1,197 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestAppArmorProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-apparmor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	// Loaded profiles and their modes
+	loaded := map[string]string{}
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		switch spec.Args[0] {
+		case "aa-status":
+			var profiles []string
+			for name, mode := range loaded {
+				profiles = append(profiles, fmt.Sprintf("%q: %q", name, mode))
+			}
+			out := fmt.Sprintf(`{"version": "1", "profiles": {%s}, "processes": {}}`, strings.Join(profiles, ", "))
+			return utils.CommandResult{Stdout: []byte(out)}, nil
+		case "apparmor_parser":
+			switch spec.Args[1] {
+			case "-R":
+				delete(loaded, "/usr/sbin/ntpd")
+			case "-r":
+				loaded["/usr/sbin/ntpd"] = "enforce"
+				if spec.Args[2] == "-C" {
+					loaded["/usr/sbin/ntpd"] = "complain"
+				}
+			}
+		}
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	r, err := NewAppArmorProfile("/usr/sbin/ntpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := r.(*AppArmorProfile)
+	errorIfNotEqual(t, "apparmor_profile", a.Type)
+	errorIfNotEqual(t, true, a.Enforce)
+
+	if err := a.Validate(); err == nil {
+		t.Error("want error for missing profile")
+	}
+
+	a.configDir = dir
+	a.Profile = "/usr/sbin/ntpd {\n  /etc/ntp.conf r,\n}\n"
+	a.Enforce = false
+	if err := a.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "usr.sbin.ntpd")
+	errorIfNotEqual(t, path, a.path())
+
+	state, err := a.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := a.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, a.Profile, string(content))
+
+	target, err := os.Readlink(filepath.Join(dir, "force-complain", "usr.sbin.ntpd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, path, target)
+
+	state, err = a.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+
+	for _, p := range a.Properties() {
+		synced, err := p.IsSynced()
+		if err != nil {
+			t.Fatal(err)
+		}
+		errorIfNotEqual(t, true, synced)
+	}
+
+	// Switching to enforce mode
+	a.Enforce = true
+	synced, err := a.isModeSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := a.setMode(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "enforce", loaded["/usr/sbin/ntpd"])
+
+	if _, err := os.Lstat(filepath.Join(dir, "force-complain", "usr.sbin.ntpd")); !os.IsNotExist(err) {
+		t.Errorf("want force-complain link to be removed, got %v", err)
+	}
+
+	// Updating the profile
+	a.Profile = "/usr/sbin/ntpd {\n  /etc/ntp.conf rw,\n}\n"
+	synced, err = a.isProfileSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := a.setProfile(); err != nil {
+		t.Fatal(err)
+	}
+
+	synced, err = a.isProfileSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	if err := a.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("want profile file to be removed, got %v", err)
+	}
+
+	want := []string{
+		"apparmor_parser -r -C " + path,
+		"aa-status --json",
+		"aa-status --json",
+		"aa-status --json",
+		"apparmor_parser -r " + path,
+		"apparmor_parser -r " + path,
+		"apparmor_parser -R " + path,
+	}
+	errorIfNotEqual(t, want, commands)
+}
@@ -0,0 +1,634 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// AWXNamespace is the table name in Lua where AWX resources are
+// being registered to.
+const AWXNamespace = "awx"
+
+// AWXJobTemplate type is a resource which manages job templates
+// in Ansible Tower and AWX using the AWX REST API.
+//
+// Job templates are identified by their name, which is the resource
+// name. The inventory, project and credentials of the job template
+// can be given either by their name or by their numeric id.
+//
+// Example:
+//   deploy = awx.job_template.new("deploy web")
+//   deploy.url = "https://awx.example.org"
+//   deploy.token = "my-awx-token"
+//   deploy.inventory = "production"
+//   deploy.project = "web"
+//   deploy.playbook = "deploy.yml"
+//   deploy.credentials = { "ssh-deploy" }
+//   deploy.extra_vars = { version = "1.2.0" }
+//   deploy.launch = true
+type AWXJobTemplate struct {
+	Base
+
+	// AWXURL is the URL of the AWX server. Required.
+	AWXURL string `luar:"url"`
+
+	// AWXToken is the OAuth2 token used to authenticate
+	// against the AWX REST API. Required.
+	AWXToken string `luar:"token" gru:"sensitive"`
+
+	// Inventory used by the job template. Required.
+	Inventory string `luar:"inventory"`
+
+	// Project containing the playbook. Required.
+	Project string `luar:"project"`
+
+	// Playbook executed by the job template. Required.
+	Playbook string `luar:"playbook"`
+
+	// Credentials attached to the job template.
+	Credentials []string `luar:"credentials"`
+
+	// ExtraVars passed to the playbook, which
+	// are serialized as JSON.
+	ExtraVars map[string]interface{} `luar:"extra_vars"`
+
+	// Launch specifies whether to launch a job from the job
+	// template after it has been created or updated.
+	// Defaults to false.
+	Launch bool `luar:"launch"`
+
+	// The job template as found in AWX
+	current *awxJobTemplate `luar:"-"`
+
+	client *http.Client `luar:"-"`
+}
+
+// awxJobTemplate type represents an AWX job template.
+type awxJobTemplate struct {
+	ID        int    `json:"id,omitempty"`
+	Name      string `json:"name"`
+	JobType   string `json:"job_type,omitempty"`
+	Inventory int    `json:"inventory"`
+	Project   int    `json:"project"`
+	Playbook  string `json:"playbook"`
+	ExtraVars string `json:"extra_vars"`
+}
+
+// awxObject type represents an AWX object, e.g. an inventory.
+type awxObject struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// NewAWXJobTemplate creates a new resource for managing
+// AWX job templates.
+func NewAWXJobTemplate(name string) (Resource, error) {
+	r := &AWXJobTemplate{
+		Base: Base{
+			Name:              name,
+			Type:              "job_template",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		Credentials: make([]string, 0),
+		ExtraVars:   make(map[string]interface{}),
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+
+	r.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "job_template",
+			PropertySetFunc:      r.setJobTemplate,
+			PropertyIsSyncedFunc: r.isJobTemplateSynced,
+		},
+	}
+
+	return r, nil
+}
+
+// Validate validates the resource.
+func (r *AWXJobTemplate) Validate() error {
+	if err := r.Base.Validate(); err != nil {
+		return err
+	}
+
+	if r.AWXURL == "" {
+		return errors.New("must provide AWX url")
+	}
+
+	if r.AWXToken == "" {
+		return errors.New("must provide AWX token")
+	}
+
+	if r.State == "present" {
+		if r.Inventory == "" {
+			return errors.New("must provide inventory")
+		}
+
+		if r.Project == "" {
+			return errors.New("must provide project")
+		}
+
+		if r.Playbook == "" {
+			return errors.New("must provide playbook")
+		}
+	}
+
+	if _, err := r.extraVars(); err != nil {
+		return fmt.Errorf("invalid extra vars: %s", err)
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the job template.
+func (r *AWXJobTemplate) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    r.State,
+	}
+
+	query := url.Values{}
+	query.Set("name", r.Name)
+
+	var out struct {
+		Results []awxJobTemplate `json:"results"`
+	}
+
+	if err := r.request("GET", "/api/v2/job_templates/", query, nil, &out); err != nil {
+		return state, err
+	}
+
+	r.current = nil
+	for _, jt := range out.Results {
+		if jt.Name == r.Name {
+			jt := jt
+			r.current = &jt
+			break
+		}
+	}
+
+	if r.current == nil {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create creates the job template.
+func (r *AWXJobTemplate) Create() error {
+	r.Printf("creating job template\n")
+
+	jt, err := r.jobTemplate()
+	if err != nil {
+		return err
+	}
+	jt.JobType = "run"
+
+	var out awxJobTemplate
+	if err := r.request("POST", "/api/v2/job_templates/", nil, jt, &out); err != nil {
+		return err
+	}
+	r.current = &out
+
+	if err := r.setCredentials(); err != nil {
+		return err
+	}
+
+	return r.launch()
+}
+
+// Delete deletes the job template.
+func (r *AWXJobTemplate) Delete() error {
+	r.Printf("removing job template\n")
+
+	if err := r.request("DELETE", r.jobTemplatePath(), nil, nil, nil); err != nil {
+		return err
+	}
+	r.current = nil
+
+	return nil
+}
+
+// jobTemplatePath returns the API path of the job template.
+func (r *AWXJobTemplate) jobTemplatePath() string {
+	return fmt.Sprintf("/api/v2/job_templates/%d/", r.current.ID)
+}
+
+// jobTemplate returns the job template as declared by the resource,
+// with the inventory and project resolved to their ids.
+func (r *AWXJobTemplate) jobTemplate() (*awxJobTemplate, error) {
+	inventory, err := r.lookup("inventories", r.Inventory)
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := r.lookup("projects", r.Project)
+	if err != nil {
+		return nil, err
+	}
+
+	vars, err := r.extraVars()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	jt := &awxJobTemplate{
+		Name:      r.Name,
+		Inventory: inventory,
+		Project:   project,
+		Playbook:  r.Playbook,
+		ExtraVars: string(data),
+	}
+
+	return jt, nil
+}
+
+// extraVars returns the extra vars, with tables
+// converted into values which can be encoded as JSON.
+func (r *AWXJobTemplate) extraVars() (map[string]interface{}, error) {
+	vars, err := normalizeAWXValue(r.ExtraVars)
+	if err != nil {
+		return nil, err
+	}
+
+	return vars.(map[string]interface{}), nil
+}
+
+// isJobTemplateSynced checks whether the job template
+// in AWX matches the job template declared by the resource.
+func (r *AWXJobTemplate) isJobTemplateSynced() (bool, error) {
+	if r.current == nil {
+		return false, ErrResourceAbsent
+	}
+
+	want, err := r.jobTemplate()
+	if err != nil {
+		return false, err
+	}
+
+	if r.current.Inventory != want.Inventory || r.current.Project != want.Project || r.current.Playbook != want.Playbook {
+		return false, nil
+	}
+
+	if !awxExtraVarsEqual(r.current.ExtraVars, want.ExtraVars) {
+		return false, nil
+	}
+
+	current, err := r.currentCredentials()
+	if err != nil {
+		return false, err
+	}
+
+	wantCredentials, err := r.credentials()
+	if err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(current, wantCredentials), nil
+}
+
+// setJobTemplate updates the job template in AWX.
+func (r *AWXJobTemplate) setJobTemplate() error {
+	r.Printf("updating job template\n")
+
+	jt, err := r.jobTemplate()
+	if err != nil {
+		return err
+	}
+
+	var out awxJobTemplate
+	if err := r.request("PATCH", r.jobTemplatePath(), nil, jt, &out); err != nil {
+		return err
+	}
+	r.current = &out
+
+	if err := r.setCredentials(); err != nil {
+		return err
+	}
+
+	return r.launch()
+}
+
+// credentials returns the sorted ids of the
+// credentials declared by the resource.
+func (r *AWXJobTemplate) credentials() ([]int, error) {
+	ids := make([]int, 0, len(r.Credentials))
+	for _, name := range r.Credentials {
+		id, err := r.lookup("credentials", name)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+// currentCredentials returns the sorted ids of the
+// credentials attached to the job template in AWX.
+func (r *AWXJobTemplate) currentCredentials() ([]int, error) {
+	var out struct {
+		Results []awxObject `json:"results"`
+	}
+
+	if err := r.request("GET", r.jobTemplatePath()+"credentials/", nil, nil, &out); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(out.Results))
+	for _, c := range out.Results {
+		ids = append(ids, c.ID)
+	}
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+// setCredentials attaches the credentials declared by the resource
+// to the job template and detaches any other credentials.
+func (r *AWXJobTemplate) setCredentials() error {
+	current, err := r.currentCredentials()
+	if err != nil {
+		return err
+	}
+
+	want, err := r.credentials()
+	if err != nil {
+		return err
+	}
+
+	path := r.jobTemplatePath() + "credentials/"
+	for _, id := range current {
+		if !awxContains(want, id) {
+			in := map[string]interface{}{"id": id, "disassociate": true}
+			if err := r.request("POST", path, nil, in, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, id := range want {
+		if !awxContains(current, id) {
+			in := map[string]interface{}{"id": id}
+			if err := r.request("POST", path, nil, in, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// launch launches a job from the job template, if requested.
+func (r *AWXJobTemplate) launch() error {
+	if !r.Launch {
+		return nil
+	}
+
+	var out struct {
+		Job int `json:"job"`
+	}
+
+	if err := r.request("POST", r.jobTemplatePath()+"launch/", nil, struct{}{}, &out); err != nil {
+		return err
+	}
+
+	r.Printf("launched job %d\n", out.Job)
+
+	return nil
+}
+
+// lookup returns the id of the object of the given kind, e.g.
+// "inventories", which is given either by its name or its id.
+func (r *AWXJobTemplate) lookup(kind, name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	query := url.Values{}
+	query.Set("name", name)
+
+	var out struct {
+		Results []awxObject `json:"results"`
+	}
+
+	if err := r.request("GET", "/api/v2/"+kind+"/", query, nil, &out); err != nil {
+		return 0, err
+	}
+
+	for _, obj := range out.Results {
+		if obj.Name == name {
+			return obj.ID, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unable to find %q in %s", name, kind)
+}
+
+// request sends a request to the AWX REST API and decodes
+// the response into out, if provided.
+func (r *AWXJobTemplate) request(method, path string, query url.Values, in, out interface{}) error {
+	u := strings.TrimSuffix(r.AWXURL, "/") + path
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.AWXToken)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, data)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// normalizeAWXValue converts Lua tables into maps with
+// string keys, so that values can be encoded as JSON.
+func normalizeAWXValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			normalized, err := normalizeAWXValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = normalized
+		}
+		return result, nil
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid key %v, must be a string", key)
+			}
+			normalized, err := normalizeAWXValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = normalized
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			normalized, err := normalizeAWXValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, normalized)
+		}
+		return result, nil
+	case *lua.LTable:
+		// Tables with a sequence are lists, others are maps
+		if v.MaxN() > 0 {
+			result := make([]interface{}, 0, v.MaxN())
+			for i := 1; i <= v.MaxN(); i++ {
+				result = append(result, v.RawGetInt(i))
+			}
+			return normalizeAWXValue(result)
+		}
+
+		result := make(map[interface{}]interface{})
+		var err error
+		v.ForEach(func(key, item lua.LValue) {
+			if key.Type() != lua.LTString {
+				err = fmt.Errorf("invalid key %v, must be a string", key)
+			}
+			result[key.String()] = item
+		})
+		if err != nil {
+			return nil, err
+		}
+		return normalizeAWXValue(result)
+	case lua.LString:
+		return string(v), nil
+	case lua.LNumber:
+		return float64(v), nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LValue:
+		return nil, fmt.Errorf("unsupported value of type %s", v.Type())
+	default:
+		return v, nil
+	}
+}
+
+// awxExtraVarsEqual checks whether the extra vars are equal,
+// regardless of the formatting of the JSON documents.
+func awxExtraVarsEqual(current, want string) bool {
+	var c, w interface{}
+	if strings.TrimSpace(current) == "" {
+		current = "{}"
+	}
+
+	if err := json.Unmarshal([]byte(current), &c); err != nil {
+		return false
+	}
+
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(c, w)
+}
+
+// awxContains checks whether the id is in the list of ids.
+func awxContains(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func init() {
+	jobTemplate := ProviderItem{
+		Type:      "job_template",
+		Provider:  NewAWXJobTemplate,
+		Namespace: AWXNamespace,
+	}
+
+	RegisterProvider(jobTemplate)
+}
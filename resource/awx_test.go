@@ -0,0 +1,248 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAWX is a minimal implementation of the
+// job template endpoints of the AWX REST API.
+type fakeAWX struct {
+	sync.Mutex
+	templates   map[int]*awxJobTemplate
+	credentials map[int][]int
+	launched    int
+	nextID      int
+}
+
+func (a *fakeAWX) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.Lock()
+	defer a.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	objects := map[string][]awxObject{
+		"inventories": {{ID: 1, Name: "production"}},
+		"projects":    {{ID: 2, Name: "web"}},
+		"credentials": {{ID: 3, Name: "ssh"}, {ID: 4, Name: "vault"}},
+	}
+
+	results := func(v interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": v})
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v2/"), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "job_templates" && r.Method == "GET":
+		found := make([]*awxJobTemplate, 0)
+		for _, jt := range a.templates {
+			if jt.Name == r.URL.Query().Get("name") {
+				found = append(found, jt)
+			}
+		}
+		results(found)
+	case len(parts) == 1 && parts[0] == "job_templates" && r.Method == "POST":
+		var jt awxJobTemplate
+		json.NewDecoder(r.Body).Decode(&jt)
+		a.nextID++
+		jt.ID = a.nextID
+		a.templates[jt.ID] = &jt
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(jt)
+	case len(parts) == 1 && r.Method == "GET":
+		found := make([]awxObject, 0)
+		for _, obj := range objects[parts[0]] {
+			if obj.Name == r.URL.Query().Get("name") {
+				found = append(found, obj)
+			}
+		}
+		results(found)
+	default:
+		id, _ := strconv.Atoi(parts[1])
+		jt, ok := a.templates[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch {
+		case len(parts) == 2 && r.Method == "PATCH":
+			json.NewDecoder(r.Body).Decode(jt)
+			json.NewEncoder(w).Encode(jt)
+		case len(parts) == 2 && r.Method == "DELETE":
+			delete(a.templates, id)
+			w.WriteHeader(http.StatusNoContent)
+		case parts[2] == "credentials" && r.Method == "GET":
+			found := make([]awxObject, 0)
+			for _, c := range a.credentials[id] {
+				found = append(found, awxObject{ID: c})
+			}
+			results(found)
+		case parts[2] == "credentials" && r.Method == "POST":
+			var in struct {
+				ID           int  `json:"id"`
+				Disassociate bool `json:"disassociate"`
+			}
+			json.NewDecoder(r.Body).Decode(&in)
+			creds := make([]int, 0)
+			for _, c := range a.credentials[id] {
+				if c != in.ID {
+					creds = append(creds, c)
+				}
+			}
+			if !in.Disassociate {
+				creds = append(creds, in.ID)
+			}
+			sort.Ints(creds)
+			a.credentials[id] = creds
+			w.WriteHeader(http.StatusNoContent)
+		case parts[2] == "launch" && r.Method == "POST":
+			a.launched++
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]int{"job": a.launched})
+		default:
+			http.Error(w, "unexpected request", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func TestAWXJobTemplate(t *testing.T) {
+	awx := &fakeAWX{
+		templates:   make(map[int]*awxJobTemplate),
+		credentials: make(map[int][]int),
+	}
+	ts := httptest.NewServer(awx)
+	defer ts.Close()
+
+	L := newLuaState()
+	defer L.Close()
+
+	code := `
+	deploy = awx.job_template.new("deploy web")
+	deploy.url = "` + ts.URL + `"
+	deploy.token = "secret"
+	deploy.inventory = "production"
+	deploy.project = "2"
+	deploy.playbook = "deploy.yml"
+	deploy.credentials = { "ssh" }
+	deploy.extra_vars = { version = "1.2.0", ports = { 80, 443 }, tls = { enabled = true } }
+	deploy.launch = true
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	jt := luaResource(L, "deploy").(*AWXJobTemplate)
+	if err := jt.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := jt.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	_, err = jt.isJobTemplateSynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	if err := jt.Create(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, 1, awx.launched)
+
+	created := awx.templates[1]
+	errorIfNotEqual(t, 1, created.Inventory)
+	errorIfNotEqual(t, 2, created.Project)
+	errorIfNotEqual(t, []int{3}, awx.credentials[1])
+
+	var vars map[string]interface{}
+	if err := json.Unmarshal([]byte(created.ExtraVars), &vars); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "1.2.0", vars["version"])
+	errorIfNotEqual(t, map[string]interface{}{"enabled": true}, vars["tls"])
+	errorIfNotEqual(t, []interface{}{float64(80), float64(443)}, vars["ports"])
+
+	// The job template is in sync after being created
+	state, err = jt.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+	errorIfNotEqual(t, []string{}, outOfSync(t, jt))
+
+	// Changing the credentials updates the job template
+	jt.Credentials = []string{"vault"}
+	errorIfNotEqual(t, []string{"job_template"}, outOfSync(t, jt))
+	if err := jt.setJobTemplate(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []int{4}, awx.credentials[1])
+	errorIfNotEqual(t, 2, awx.launched)
+
+	// Changing the playbook updates the job template
+	jt.Playbook = "site.yml"
+	jt.Launch = false
+	errorIfNotEqual(t, []string{"job_template"}, outOfSync(t, jt))
+	if err := jt.setJobTemplate(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "site.yml", awx.templates[1].Playbook)
+	errorIfNotEqual(t, 2, awx.launched)
+
+	// Unknown objects cannot be resolved
+	jt.Inventory = "staging"
+	if _, err := jt.isJobTemplateSynced(); err == nil {
+		t.Error("want error for unknown inventory")
+	}
+
+	if err := jt.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := awx.templates[1]; ok {
+		t.Error("want job template removed")
+	}
+}
+
+func TestAWXExtraVarsEqual(t *testing.T) {
+	errorIfNotEqual(t, true, awxExtraVarsEqual("", "{}"))
+	errorIfNotEqual(t, true, awxExtraVarsEqual(`{"a": 1, "b": [true]}`, `{"b":[true],"a":1}`))
+	errorIfNotEqual(t, false, awxExtraVarsEqual(`{"a": 1}`, `{"a":2}`))
+	errorIfNotEqual(t, false, awxExtraVarsEqual("a: 1", `{"a":1}`))
+}
@@ -0,0 +1,499 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// bind9ZoneDir is the directory containing the zone files.
+const bind9ZoneDir = "/var/lib/bind"
+
+// bind9SerialAuto is the serial for which the resource increments
+// the serial of the zone whenever its records change.
+const bind9SerialAuto = "auto"
+
+// bind9ZoneRegexp matches valid zone names, e.g. "example.org".
+var bind9ZoneRegexp = regexp.MustCompile(`^([a-zA-Z0-9_]([a-zA-Z0-9_-]*[a-zA-Z0-9_])?\.)*[a-zA-Z0-9_]([a-zA-Z0-9_-]*[a-zA-Z0-9_])?\.?$`)
+
+// DNSRecord type represents a resource record of a DNS zone.
+type DNSRecord struct {
+	// Name of the record relative to the zone, e.g. "www",
+	// or "@" for the zone apex.
+	Name string `luar:"name"`
+
+	// TTL of the record in seconds. Defaults to
+	// zero, which uses the TTL of the zone.
+	TTL int `luar:"ttl"`
+
+	// Class of the record. Defaults to "IN".
+	Class string `luar:"class"`
+
+	// Type of the record, e.g. "A" or "MX".
+	Type string `luar:"type"`
+
+	// Data of the record, e.g. "192.0.2.1" or "10 mail".
+	Data string `luar:"data"`
+}
+
+// BIND9Zone type is a resource which manages BIND9 zones.
+//
+// The records of master zones are written to the zone file, which
+// must include a single SOA record. The data of the SOA record omits
+// the serial, which is taken from the serial of the resource. Zones
+// are added using "rndc addzone", so named must be configured with
+// "allow-new-zones yes", and reloaded using "rndc reload" after the
+// zone file has been changed.
+//
+// Slave zones are added with the given masters, from
+// which named transfers the zone file on its own.
+//
+// Example:
+//   zone = resource.bind9_zone.new("example.org")
+//   zone.state = "present"
+//   zone.records = {
+//     { name = "@", type = "SOA", data = "ns1 hostmaster 3600 600 604800 300" },
+//     { name = "@", type = "NS", data = "ns1" },
+//     { name = "ns1", type = "A", data = "192.0.2.1" },
+//     { name = "www", ttl = 300, type = "A", data = "192.0.2.10" },
+//   }
+type BIND9Zone struct {
+	Base
+
+	// Zone is the name of the zone. Defaults to the resource name.
+	Zone string `luar:"zone"`
+
+	// ZoneType is the type of the zone, either "master" or
+	// "slave". Defaults to "master".
+	ZoneType string `luar:"type"`
+
+	// File is the path to the zone file.
+	// Defaults to /var/lib/bind/db.<zone>.
+	File string `luar:"file"`
+
+	// TTL is the default TTL of the records in seconds.
+	// Defaults to 3600.
+	TTL int `luar:"ttl"`
+
+	// Records of a master zone.
+	Records []DNSRecord `luar:"records"`
+
+	// Masters contains the addresses of the
+	// masters, from which a slave zone is transferred.
+	Masters []string `luar:"masters"`
+
+	// Serial of a master zone. Defaults to "auto", which
+	// increments the serial whenever the records change.
+	Serial string `luar:"serial"`
+}
+
+// NewBIND9Zone creates a new resource for managing BIND9 zones.
+func NewBIND9Zone(name string) (Resource, error) {
+	z := &BIND9Zone{
+		Base: Base{
+			Name:              name,
+			Type:              "bind9_zone",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		Zone:     name,
+		ZoneType: "master",
+		File:     filepath.Join(bind9ZoneDir, "db."+strings.TrimSuffix(name, ".")),
+		TTL:      3600,
+		Records:  make([]DNSRecord, 0),
+		Masters:  make([]string, 0),
+		Serial:   bind9SerialAuto,
+	}
+
+	z.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "records",
+			PropertySetFunc:      z.setRecords,
+			PropertyIsSyncedFunc: z.isRecordsSynced,
+		},
+	}
+
+	return z, nil
+}
+
+// Validate validates the resource.
+func (z *BIND9Zone) Validate() error {
+	if err := z.Base.Validate(); err != nil {
+		return err
+	}
+
+	if !bind9ZoneRegexp.MatchString(z.Zone) {
+		return fmt.Errorf("invalid zone '%s'", z.Zone)
+	}
+
+	if z.File == "" || !filepath.IsAbs(z.File) {
+		return fmt.Errorf("invalid zone file '%s'", z.File)
+	}
+
+	if z.TTL < 0 {
+		return fmt.Errorf("invalid ttl %d", z.TTL)
+	}
+
+	switch z.ZoneType {
+	case "master":
+		return z.validateRecords()
+	case "slave":
+		if len(z.Records) > 0 {
+			return errors.New("records cannot be given for slave zones")
+		}
+
+		if len(z.Masters) == 0 {
+			return errors.New("masters are required for slave zones")
+		}
+
+		for _, master := range z.Masters {
+			if net.ParseIP(master) == nil {
+				return fmt.Errorf("invalid master '%s'", master)
+			}
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("invalid zone type '%s'", z.ZoneType)
+}
+
+// validateRecords validates the records and serial of a master zone.
+func (z *BIND9Zone) validateRecords() error {
+	if z.Serial != bind9SerialAuto {
+		if _, err := strconv.ParseUint(z.Serial, 10, 32); err != nil {
+			return fmt.Errorf("invalid serial '%s'", z.Serial)
+		}
+	}
+
+	soa := 0
+	for _, record := range z.Records {
+		for _, value := range []string{record.Name, record.Class, record.Type, record.Data} {
+			if strings.ContainsAny(value, "\n\r;") {
+				return fmt.Errorf("record field '%s' contains invalid characters", value)
+			}
+		}
+
+		if record.Name == "" || strings.ContainsAny(record.Name, " \t") {
+			return fmt.Errorf("invalid record name '%s'", record.Name)
+		}
+
+		if record.Type == "" || strings.ContainsAny(record.Type, " \t") {
+			return fmt.Errorf("invalid type for record %s", record.Name)
+		}
+
+		if record.TTL < 0 {
+			return fmt.Errorf("invalid ttl for record %s", record.Name)
+		}
+
+		if strings.TrimSpace(record.Data) == "" {
+			return fmt.Errorf("missing data for record %s %s", record.Name, record.Type)
+		}
+
+		if strings.EqualFold(record.Type, "SOA") {
+			soa++
+			if len(strings.Fields(record.Data)) != 6 {
+				return errors.New("SOA data must be 'mname rname refresh retry expire minimum'")
+			}
+		}
+	}
+
+	if soa != 1 {
+		return fmt.Errorf("master zones require a single SOA record, got %d", soa)
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the zone. Master zones are considered
+// present if their zone file exists, and slave zones if named knows them.
+func (z *BIND9Zone) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    z.State,
+	}
+
+	if z.ZoneType == "slave" {
+		state.Current = "absent"
+		if z.zoneExists() {
+			state.Current = "present"
+		}
+		return state, nil
+	}
+
+	fi, err := os.Stat(z.File)
+	if os.IsNotExist(err) {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return state, errors.New("path exists, but is not a regular file")
+	}
+
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create creates the zone.
+func (z *BIND9Zone) Create() error {
+	z.Printf("creating zone %s\n", z.Zone)
+
+	if z.ZoneType == "slave" {
+		return z.rndc("addzone", z.Zone, z.zoneConfig())
+	}
+
+	return z.writeZone()
+}
+
+// Delete removes the zone and its zone file.
+func (z *BIND9Zone) Delete() error {
+	z.Printf("removing zone %s\n", z.Zone)
+
+	if z.zoneExists() {
+		if err := z.rndc("delzone", z.Zone); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(z.File); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// isRecordsSynced checks whether the zone file contains the records.
+// Automatic serials are ignored when comparing the zone files.
+func (z *BIND9Zone) isRecordsSynced() (bool, error) {
+	if z.ZoneType == "slave" {
+		return true, nil
+	}
+
+	data, err := ioutil.ReadFile(z.File)
+	if os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	serial := z.Serial
+	if serial == bind9SerialAuto {
+		serial = strconv.FormatUint(uint64(parseBIND9Serial(data)), 10)
+	}
+
+	return bytes.Equal(data, z.content(serial)), nil
+}
+
+// setRecords updates the records in the zone file.
+func (z *BIND9Zone) setRecords() error {
+	z.Printf("updating zone %s\n", z.Zone)
+
+	return z.writeZone()
+}
+
+// content returns the content of the zone file with the given serial.
+func (z *BIND9Zone) content(serial string) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("; Managed by gru, do not edit\n")
+	fmt.Fprintf(&buf, "$ORIGIN %s.\n", strings.TrimSuffix(z.Zone, "."))
+	fmt.Fprintf(&buf, "$TTL %d\n", z.TTL)
+
+	// The SOA record is the first record of the zone
+	records := make([]DNSRecord, 0, len(z.Records))
+	for _, record := range z.Records {
+		if strings.EqualFold(record.Type, "SOA") {
+			fields := strings.Fields(record.Data)
+			record.Data = strings.Join(append(fields[:2:2], append([]string{serial}, fields[2:]...)...), " ")
+			records = append([]DNSRecord{record}, records...)
+		} else {
+			records = append(records, record)
+		}
+	}
+
+	for _, record := range records {
+		class := record.Class
+		if class == "" {
+			class = "IN"
+		}
+
+		ttl := ""
+		if record.TTL > 0 {
+			ttl = strconv.Itoa(record.TTL)
+		}
+
+		fields := []string{record.Name}
+		if ttl != "" {
+			fields = append(fields, ttl)
+		}
+		fields = append(fields, strings.ToUpper(class), strings.ToUpper(record.Type), strings.TrimSpace(record.Data))
+		buf.WriteString(strings.Join(fields, " ") + "\n")
+	}
+
+	return buf.Bytes()
+}
+
+// nextSerial returns the serial for the zone file about to be
+// written. Automatic serials are date based, in the form of
+// YYYYMMDDnn, and always greater than the current serial.
+func (z *BIND9Zone) nextSerial() (string, error) {
+	if z.Serial != bind9SerialAuto {
+		return z.Serial, nil
+	}
+
+	var current uint32
+	data, err := ioutil.ReadFile(z.File)
+	switch {
+	case err == nil:
+		current = parseBIND9Serial(data)
+	case !os.IsNotExist(err):
+		return "", err
+	}
+
+	today, err := strconv.ParseUint(time.Now().Format("20060102")+"00", 10, 32)
+	if err != nil {
+		return "", err
+	}
+
+	next := uint64(current) + 1
+	if today > next {
+		next = today
+	}
+
+	if next > 1<<32-1 {
+		return "", fmt.Errorf("serial %d of zone %s cannot be incremented", current, z.Zone)
+	}
+
+	return strconv.FormatUint(next, 10), nil
+}
+
+// writeZone writes the zone file and reloads the zone,
+// adding it first if named does not know it yet.
+func (z *BIND9Zone) writeZone() error {
+	serial, err := z.nextSerial()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(z.File), 0755); err != nil {
+		return err
+	}
+
+	if err := writeFile(z.File, z.content(serial), 0644); err != nil {
+		return err
+	}
+
+	if !z.zoneExists() {
+		return z.rndc("addzone", z.Zone, z.zoneConfig())
+	}
+
+	return z.rndc("reload", z.Zone)
+}
+
+// zoneConfig returns the configuration used when adding the zone.
+func (z *BIND9Zone) zoneConfig() string {
+	config := fmt.Sprintf("{ type %s; file %q; ", z.ZoneType, z.File)
+	if z.ZoneType == "slave" {
+		config += fmt.Sprintf("masters { %s; }; ", strings.Join(z.Masters, "; "))
+	}
+
+	return config + "};"
+}
+
+// zoneExists returns a boolean indicating whether named knows the zone.
+func (z *BIND9Zone) zoneExists() bool {
+	spec := utils.CommandSpec{Args: []string{"rndc", "zonestatus", z.Zone}}
+	_, err := utils.RunCommand(context.Background(), spec)
+
+	return err == nil
+}
+
+// rndc executes an rndc(8) command.
+func (z *BIND9Zone) rndc(args ...string) error {
+	spec := utils.CommandSpec{Args: append([]string{"rndc"}, args...)}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("rndc %s failed: %s: %s", args[0], err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+// parseBIND9Serial returns the serial of the SOA record in a zone
+// file written by the resource, or zero if it cannot be found.
+func parseBIND9Serial(data []byte) uint32 {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if strings.EqualFold(field, "SOA") && i+3 < len(fields) {
+				serial, err := strconv.ParseUint(fields[i+3], 10, 32)
+				if err != nil {
+					return 0
+				}
+				return uint32(serial)
+			}
+		}
+	}
+
+	return 0
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "bind9_zone",
+		Provider:  NewBIND9Zone,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
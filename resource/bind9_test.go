@@ -0,0 +1,228 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestBIND9Zone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-bind9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	// Fake rndc keeping track of the zones known to named
+	zones := make(map[string]bool)
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		switch spec.Args[1] {
+		case "zonestatus":
+			if !zones[spec.Args[2]] {
+				return utils.CommandResult{Stderr: []byte("rndc: 'zonestatus' failed: not found\n"), ExitCode: 1}, errors.New("exit status 1")
+			}
+			return utils.CommandResult{}, nil
+		case "addzone":
+			zones[spec.Args[2]] = true
+		case "delzone":
+			delete(zones, spec.Args[2])
+		}
+		commands = append(commands, strings.Join(spec.Args, " "))
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	r, err := NewBIND9Zone("example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := r.(*BIND9Zone)
+	z.File = filepath.Join(dir, "db.example.org")
+	z.Records = []DNSRecord{
+		{Name: "@", Type: "NS", Data: "ns1"},
+		{Name: "@", Type: "SOA", Data: "ns1 hostmaster 3600 600 604800 300"},
+		{Name: "ns1", Type: "A", Data: "192.0.2.1"},
+		{Name: "www", TTL: 300, Type: "a", Data: "192.0.2.10"},
+	}
+	if err := z.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := z.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := z.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	serial := time.Now().Format("20060102") + "00"
+	want := `; Managed by gru, do not edit
+$ORIGIN example.org.
+$TTL 3600
+@ IN SOA ns1 hostmaster ` + serial + ` 3600 600 604800 300
+@ IN NS ns1
+ns1 IN A 192.0.2.1
+www 300 IN A 192.0.2.10
+`
+	data, err := ioutil.ReadFile(z.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, want, string(data))
+	errorIfNotEqual(t, []string{`rndc addzone example.org { type master; file "` + z.File + `"; };`}, commands)
+
+	// The serial is kept while the records are in sync
+	synced, err := z.isRecordsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	commands = nil
+	z.Records[3].Data = "192.0.2.20"
+	synced, err = z.isRecordsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := z.setRecords(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"rndc reload example.org"}, commands)
+
+	data, err = ioutil.ReadFile(z.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, parseBIND9Serial([]byte(want))+1, parseBIND9Serial(data))
+
+	// Fixed serials are part of the comparison
+	z.Serial = "42"
+	synced, err = z.isRecordsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	commands = nil
+	if err := z.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"rndc delzone example.org"}, commands)
+
+	state, err = z.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	// Slave zones are transferred by named
+	r, err = NewBIND9Zone("example.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slave := r.(*BIND9Zone)
+	slave.ZoneType = "slave"
+	slave.File = filepath.Join(dir, "db.example.net")
+	slave.Masters = []string{"192.0.2.1", "2001:db8::1"}
+	if err := slave.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	commands = nil
+	if err := slave.Create(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{`rndc addzone example.net { type slave; file "` + slave.File + `"; masters { 192.0.2.1; 2001:db8::1; }; };`}, commands)
+
+	state, err = slave.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+}
+
+func TestBIND9ZoneValidate(t *testing.T) {
+	soa := DNSRecord{Name: "@", Type: "SOA", Data: "ns1 hostmaster 3600 600 604800 300"}
+
+	tests := []struct {
+		zone    string
+		serial  string
+		records []DNSRecord
+		ok      bool
+	}{
+		{"example.org", "auto", []DNSRecord{soa}, true},
+		{"example.org.", "2017010100", []DNSRecord{soa}, true},
+		{"example..org", "auto", []DNSRecord{soa}, false},
+		{"example.org", "4294967296", []DNSRecord{soa}, false},
+		{"example.org", "auto", []DNSRecord{}, false},
+		{"example.org", "auto", []DNSRecord{soa, soa}, false},
+		{"example.org", "auto", []DNSRecord{{Name: "@", Type: "SOA", Data: "ns1 hostmaster 1 3600 600 604800 300"}}, false},
+		{"example.org", "auto", []DNSRecord{soa, {Name: "www", Type: "A", Data: "192.0.2.1\n@ IN A 192.0.2.2"}}, false},
+		{"example.org", "auto", []DNSRecord{soa, {Name: "www", Type: "A"}}, false},
+	}
+
+	for _, test := range tests {
+		r, err := NewBIND9Zone(test.zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		z := r.(*BIND9Zone)
+		z.Serial = test.serial
+		z.Records = test.records
+		err = z.Validate()
+		if test.ok != (err == nil) {
+			t.Errorf("%s %s %v: want valid %t, got %v", test.zone, test.serial, test.records, test.ok, err)
+		}
+	}
+}
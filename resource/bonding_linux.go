@@ -0,0 +1,622 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+// +build linux
+
+package resource
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// Paths used for evaluating and persisting bonding interfaces
+const (
+	bondingProcDir  = "/proc/net/bonding"
+	bondingNetplan  = "/etc/netplan"
+	bondingIfcfgDir = "/etc/sysconfig/network-scripts"
+)
+
+// bondingModes maps the bonding modes to their
+// descriptions in /proc/net/bonding.
+var bondingModes = map[string]string{
+	"balance-rr":    "load balancing (round-robin)",
+	"active-backup": "fault-tolerance (active-backup)",
+	"balance-xor":   "load balancing (xor)",
+	"broadcast":     "fault-tolerance (broadcast)",
+	"802.3ad":       "IEEE 802.3ad Dynamic link aggregation",
+	"balance-tlb":   "transmit load balancing",
+	"balance-alb":   "adaptive load balancing",
+}
+
+// Bonding type is a resource which manages network bonding
+// interfaces on a GNU/Linux system. The resource name is the
+// name of the bonding interface, e.g. "bond0".
+//
+// The interface is configured using ip(8), after loading the bonding
+// kernel module. When persistent, the configuration is also written
+// either as a netplan configuration in /etc/netplan, or as ifcfg files
+// in /etc/sysconfig/network-scripts for the bond and its members.
+//
+// Example:
+//   bond = resource.bonding.new("bond0")
+//   bond.state = "present"
+//   bond.mode = "active-backup"
+//   bond.members = { "eth0", "eth1" }
+//   bond.ip_address = "10.0.0.5/24"
+//   bond.gateway = "10.0.0.1"
+//   bond.persistent = true
+type Bonding struct {
+	Base
+
+	// Mode is the bonding mode, e.g. "balance-rr", "active-backup",
+	// "balance-xor", "broadcast", "802.3ad", "balance-tlb" or
+	// "balance-alb". Required.
+	Mode string `luar:"mode"`
+
+	// Members is the list of interfaces enslaved to the bond
+	Members []string `luar:"members"`
+
+	// IPAddress is the address of the bond in CIDR notation,
+	// e.g. "10.0.0.5/24". If empty the address is not managed.
+	IPAddress string `luar:"ip_address"`
+
+	// Gateway is the default gateway routed through the bond.
+	// If empty the default route is not managed.
+	Gateway string `luar:"gateway"`
+
+	// Persistent specifies whether the configuration is written,
+	// so that the bond is configured again on boot.
+	Persistent bool `luar:"persistent"`
+
+	// Config is the format of the persistent configuration, either
+	// "netplan" or "ifcfg". Defaults to "netplan" if /etc/netplan
+	// exists, and to "ifcfg" otherwise.
+	Config string `luar:"config"`
+
+	// Directory containing the status of bonding interfaces
+	procDir string `luar:"-"`
+
+	// Directories in which the configuration is persisted
+	netplanDir string `luar:"-"`
+	ifcfgDir   string `luar:"-"`
+}
+
+// NewBonding creates a new resource for managing bonding interfaces.
+func NewBonding(name string) (Resource, error) {
+	b := &Bonding{
+		Base: Base{
+			Name:              name,
+			Type:              "bonding",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// Interfaces can only be enslaved to a single bond
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		Members:    make([]string, 0),
+		procDir:    bondingProcDir,
+		netplanDir: bondingNetplan,
+		ifcfgDir:   bondingIfcfgDir,
+	}
+
+	b.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "mode",
+			PropertySetFunc:      b.setMode,
+			PropertyIsSyncedFunc: b.isModeSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "members",
+			PropertySetFunc:      b.setMembers,
+			PropertyIsSyncedFunc: b.isMembersSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "ip_address",
+			PropertySetFunc:      b.setIPAddress,
+			PropertyIsSyncedFunc: b.isIPAddressSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "gateway",
+			PropertySetFunc:      b.setGateway,
+			PropertyIsSyncedFunc: b.isGatewaySynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "persistent",
+			PropertySetFunc:      b.setPersistent,
+			PropertyIsSyncedFunc: b.isPersistentSynced,
+		},
+	}
+
+	return b, nil
+}
+
+// Validate validates the resource.
+func (b *Bonding) Validate() error {
+	if err := b.Base.Validate(); err != nil {
+		return err
+	}
+
+	if strings.ContainsAny(b.Name, "/ ") {
+		return fmt.Errorf("invalid interface name '%s'", b.Name)
+	}
+
+	if _, ok := bondingModes[b.Mode]; !ok {
+		return fmt.Errorf("invalid mode '%s'", b.Mode)
+	}
+
+	for _, member := range b.Members {
+		if member == "" || member == b.Name || strings.ContainsAny(member, "/ ") {
+			return fmt.Errorf("invalid member '%s'", member)
+		}
+	}
+
+	if b.IPAddress != "" {
+		if _, _, err := net.ParseCIDR(b.IPAddress); err != nil {
+			return fmt.Errorf("invalid ip address '%s'", b.IPAddress)
+		}
+	}
+
+	if b.Gateway != "" && net.ParseIP(b.Gateway) == nil {
+		return fmt.Errorf("invalid gateway '%s'", b.Gateway)
+	}
+
+	switch b.Config {
+	case "":
+		b.Config = "ifcfg"
+		if _, err := os.Stat(b.netplanDir); err == nil {
+			b.Config = "netplan"
+		}
+	case "netplan", "ifcfg":
+	default:
+		return fmt.Errorf("invalid config '%s'", b.Config)
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the bonding interface.
+func (b *Bonding) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    b.State,
+	}
+
+	_, err := os.Stat(b.statusPath())
+	switch {
+	case os.IsNotExist(err):
+		state.Current = "absent"
+	case err != nil:
+		return state, err
+	default:
+		state.Current = "present"
+	}
+
+	return state, nil
+}
+
+// Create creates the bonding interface.
+func (b *Bonding) Create() error {
+	b.Printf("creating bond in %s mode\n", b.Mode)
+
+	if err := b.run("modprobe", "bonding"); err != nil {
+		return err
+	}
+
+	if err := b.run("ip", "link", "add", b.Name, "type", "bond", "mode", b.Mode); err != nil {
+		return err
+	}
+
+	for _, member := range b.Members {
+		if err := b.enslave(member); err != nil {
+			return err
+		}
+	}
+
+	return b.run("ip", "link", "set", b.Name, "up")
+}
+
+// Delete removes the bonding interface, releasing its
+// members, along with any persistent configuration.
+func (b *Bonding) Delete() error {
+	b.Printf("removing bond\n")
+
+	if err := b.run("ip", "link", "delete", b.Name); err != nil {
+		return err
+	}
+
+	for path := range b.persistentFiles() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// statusPath returns the path to the status of the bond.
+func (b *Bonding) statusPath() string {
+	return filepath.Join(b.procDir, b.Name)
+}
+
+// status returns the mode and members of the bond as
+// reported in its status in /proc/net/bonding.
+func (b *Bonding) status() (string, []string, error) {
+	data, err := ioutil.ReadFile(b.statusPath())
+	if os.IsNotExist(err) {
+		return "", nil, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	mode := ""
+	members := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		value := strings.TrimSpace(kv[1])
+		switch kv[0] {
+		case "Bonding Mode":
+			for name, desc := range bondingModes {
+				if value == desc {
+					mode = name
+				}
+			}
+		case "Slave Interface":
+			members = append(members, value)
+		}
+	}
+
+	return mode, members, nil
+}
+
+// isModeSynced checks whether the bond uses the desired mode.
+func (b *Bonding) isModeSynced() (bool, error) {
+	mode, _, err := b.status()
+	if err != nil {
+		return false, err
+	}
+
+	return mode == b.Mode, nil
+}
+
+// setMode changes the mode of the bond, which requires the
+// bond to be down and its members to be released.
+func (b *Bonding) setMode() error {
+	b.Printf("setting mode to %s\n", b.Mode)
+
+	_, members, err := b.status()
+	if err != nil {
+		return err
+	}
+
+	if err := b.run("ip", "link", "set", b.Name, "down"); err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if err := b.run("ip", "link", "set", member, "nomaster"); err != nil {
+			return err
+		}
+	}
+
+	if err := b.run("ip", "link", "set", b.Name, "type", "bond", "mode", b.Mode); err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if err := b.enslave(member); err != nil {
+			return err
+		}
+	}
+
+	return b.run("ip", "link", "set", b.Name, "up")
+}
+
+// isMembersSynced checks whether the bond has the desired members.
+func (b *Bonding) isMembersSynced() (bool, error) {
+	_, members, err := b.status()
+	if err != nil {
+		return false, err
+	}
+
+	return utils.SameStrings(members, b.Members), nil
+}
+
+// setMembers enslaves missing members and releases
+// members, which should not be part of the bond.
+func (b *Bonding) setMembers() error {
+	_, members, err := b.status()
+	if err != nil {
+		return err
+	}
+
+	current := utils.NewList(members...)
+	want := utils.NewList(b.Members...)
+	for _, member := range b.Members {
+		if !utils.NewString(member).IsInList(current) {
+			b.Printf("adding member %s\n", member)
+			if err := b.enslave(member); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, member := range members {
+		if !utils.NewString(member).IsInList(want) {
+			b.Printf("removing member %s\n", member)
+			if err := b.run("ip", "link", "set", member, "nomaster"); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// enslave adds an interface to the bond, which
+// requires the interface to be down.
+func (b *Bonding) enslave(member string) error {
+	if err := b.run("ip", "link", "set", member, "down"); err != nil {
+		return err
+	}
+
+	return b.run("ip", "link", "set", member, "master", b.Name)
+}
+
+// addresses returns the addresses of the bond in CIDR notation.
+func (b *Bonding) addresses() ([]string, error) {
+	if _, err := os.Stat(b.statusPath()); os.IsNotExist(err) {
+		return nil, ErrResourceAbsent
+	}
+
+	out, err := b.output("ip", "-o", "addr", "show", "dev", b.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields)-1; i++ {
+			if fields[i] == "inet" || fields[i] == "inet6" {
+				addrs = append(addrs, fields[i+1])
+			}
+		}
+	}
+
+	return addrs, nil
+}
+
+// isIPAddressSynced checks whether the bond has the desired address.
+func (b *Bonding) isIPAddressSynced() (bool, error) {
+	addrs, err := b.addresses()
+	if err != nil || b.IPAddress == "" {
+		return err == nil, err
+	}
+
+	return utils.NewString(b.IPAddress).IsInList(utils.NewList(addrs...)), nil
+}
+
+// setIPAddress replaces the addresses of the bond with the desired one.
+func (b *Bonding) setIPAddress() error {
+	b.Printf("setting ip address to %s\n", b.IPAddress)
+
+	if err := b.run("ip", "addr", "flush", "dev", b.Name); err != nil {
+		return err
+	}
+
+	return b.run("ip", "addr", "add", b.IPAddress, "dev", b.Name)
+}
+
+// routeArgs returns the arguments of ip(8) for
+// the address family of the gateway.
+func (b *Bonding) routeArgs(args ...string) []string {
+	if strings.Contains(b.Gateway, ":") {
+		return append([]string{"-6", "route"}, args...)
+	}
+
+	return append([]string{"-4", "route"}, args...)
+}
+
+// isGatewaySynced checks whether the default route
+// is routed through the desired gateway.
+func (b *Bonding) isGatewaySynced() (bool, error) {
+	if _, err := os.Stat(b.statusPath()); os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if b.Gateway == "" {
+		return true, nil
+	}
+
+	out, err := b.output("ip", b.routeArgs("show", "default", "dev", b.Name)...)
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == "default" && fields[1] == "via" && fields[2] == b.Gateway {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// setGateway routes the default route through the gateway.
+func (b *Bonding) setGateway() error {
+	b.Printf("setting gateway to %s\n", b.Gateway)
+
+	return b.run("ip", b.routeArgs("replace", "default", "via", b.Gateway, "dev", b.Name)...)
+}
+
+// persistentFiles returns the content of the files in which
+// the configuration of the bond is persisted, keyed by path.
+func (b *Bonding) persistentFiles() map[string]string {
+	files := make(map[string]string)
+	header := "# Managed by gru, do not edit\n"
+
+	if b.Config == "netplan" {
+		var s strings.Builder
+		s.WriteString(header)
+		s.WriteString("network:\n  version: 2\n")
+		if len(b.Members) > 0 {
+			s.WriteString("  ethernets:\n")
+			for _, member := range b.Members {
+				fmt.Fprintf(&s, "    %s: {}\n", member)
+			}
+		}
+		fmt.Fprintf(&s, "  bonds:\n    %s:\n", b.Name)
+		fmt.Fprintf(&s, "      interfaces: [%s]\n", strings.Join(b.Members, ", "))
+		fmt.Fprintf(&s, "      parameters:\n        mode: %s\n", b.Mode)
+		if b.IPAddress != "" {
+			fmt.Fprintf(&s, "      addresses: [%s]\n", b.IPAddress)
+		}
+		if b.Gateway != "" {
+			fmt.Fprintf(&s, "      routes:\n        - to: default\n          via: %s\n", b.Gateway)
+		}
+		files[filepath.Join(b.netplanDir, "60-gru-"+b.Name+".yaml")] = s.String()
+
+		return files
+	}
+
+	var s strings.Builder
+	s.WriteString(header)
+	fmt.Fprintf(&s, "DEVICE=%s\nTYPE=Bond\nBONDING_MASTER=yes\n", b.Name)
+	fmt.Fprintf(&s, "BONDING_OPTS=\"mode=%s\"\nBOOTPROTO=none\nONBOOT=yes\n", b.Mode)
+	if b.IPAddress != "" {
+		ip, network, _ := net.ParseCIDR(b.IPAddress)
+		prefix, _ := network.Mask.Size()
+		fmt.Fprintf(&s, "IPADDR=%s\nPREFIX=%d\n", ip, prefix)
+	}
+	if b.Gateway != "" {
+		fmt.Fprintf(&s, "GATEWAY=%s\n", b.Gateway)
+	}
+	files[filepath.Join(b.ifcfgDir, "ifcfg-"+b.Name)] = s.String()
+
+	for _, member := range b.Members {
+		content := fmt.Sprintf("%sDEVICE=%s\nMASTER=%s\nSLAVE=yes\nBOOTPROTO=none\nONBOOT=yes\n", header, member, b.Name)
+		files[filepath.Join(b.ifcfgDir, "ifcfg-"+member)] = content
+	}
+
+	return files
+}
+
+// isPersistentSynced checks whether the configuration of the
+// bond is persisted, unless it should not be persisted.
+func (b *Bonding) isPersistentSynced() (bool, error) {
+	if _, err := os.Stat(b.statusPath()); os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if !b.Persistent {
+		return true, nil
+	}
+
+	for path, content := range b.persistentFiles() {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if string(data) != content {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// setPersistent writes the configuration of the bond.
+func (b *Bonding) setPersistent() error {
+	files := b.persistentFiles()
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		b.Printf("writing configuration to %s\n", path)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		if err := writeFile(path, []byte(files[path]), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// output executes a command and returns its output.
+func (b *Bonding) output(name string, args ...string) (string, error) {
+	spec := utils.CommandSpec{Args: append([]string{name}, args...)}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %s: %s", name, err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return string(result.Stdout), nil
+}
+
+// run executes a command.
+func (b *Bonding) run(name string, args ...string) error {
+	_, err := b.output(name, args...)
+
+	return err
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "bonding",
+		Provider:  NewBonding,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
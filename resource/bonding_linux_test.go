@@ -0,0 +1,219 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+// +build linux
+
+package resource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestBonding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-bonding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	proc := filepath.Join(dir, "bonding")
+	if err := os.MkdirAll(proc, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake the commands being executed
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		switch spec.Args[1] {
+		case "-o":
+			out := "5: bond0    inet 10.0.0.5/24 brd 10.0.0.255 scope global bond0\\       valid_lft forever preferred_lft forever\n"
+			return utils.CommandResult{Stdout: []byte(out)}, nil
+		case "-4":
+			out := "default via 10.0.0.1 proto static\n"
+			return utils.CommandResult{Stdout: []byte(out)}, nil
+		}
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	L := newLuaState()
+	defer L.Close()
+
+	code := `
+	bond0 = resource.bonding.new("bond0")
+	bond0.mode = "active-backup"
+	bond0.members = { "eth0", "eth1" }
+	bond0.ip_address = "10.0.0.5/24"
+	bond0.gateway = "10.0.0.1"
+	bond0.persistent = true
+	bond0.config = "ifcfg"
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	b := luaResource(L, "bond0").(*Bonding)
+	b.procDir = proc
+	b.ifcfgDir = filepath.Join(dir, "network-scripts")
+	if err := b.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := b.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+	_, err = b.isModeSynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	if err := b.Create(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"modprobe bonding",
+		"ip link add bond0 type bond mode active-backup",
+		"ip link set eth0 down",
+		"ip link set eth0 master bond0",
+		"ip link set eth1 down",
+		"ip link set eth1 master bond0",
+		"ip link set bond0 up",
+	}
+	errorIfNotEqual(t, want, commands)
+
+	// Fake the kernel reporting the bond with a single member
+	status := `Ethernet Channel Bonding Driver: v5.15.0
+
+Bonding Mode: fault-tolerance (active-backup)
+Primary Slave: None
+Currently Active Slave: eth0
+MII Status: up
+
+Slave Interface: eth0
+MII Status: up
+Permanent HW addr: 52:54:00:12:34:56
+`
+	if err := ioutil.WriteFile(filepath.Join(proc, "bond0"), []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = b.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+	errorIfNotEqual(t, []string{"members", "persistent"}, outOfSync(t, b))
+
+	commands = nil
+	if err := b.setMembers(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"ip link set eth1 down", "ip link set eth1 master bond0"}, commands)
+
+	if err := b.setPersistent(); err != nil {
+		t.Fatal(err)
+	}
+	synced, err := b.isPersistentSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	content, err := ioutil.ReadFile(filepath.Join(b.ifcfgDir, "ifcfg-bond0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantConfig := `# Managed by gru, do not edit
+DEVICE=bond0
+TYPE=Bond
+BONDING_MASTER=yes
+BONDING_OPTS="mode=active-backup"
+BOOTPROTO=none
+ONBOOT=yes
+IPADDR=10.0.0.5
+PREFIX=24
+GATEWAY=10.0.0.1
+`
+	errorIfNotEqual(t, wantConfig, string(content))
+
+	content, err = ioutil.ReadFile(filepath.Join(b.ifcfgDir, "ifcfg-eth1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "# Managed by gru, do not edit\nDEVICE=eth1\nMASTER=bond0\nSLAVE=yes\nBOOTPROTO=none\nONBOOT=yes\n", string(content))
+
+	// Mode changes are detected
+	b.Mode = "802.3ad"
+	errorIfNotEqual(t, []string{"mode", "members", "persistent"}, outOfSync(t, b))
+
+	// Netplan configuration
+	b.Config = "netplan"
+	b.netplanDir = filepath.Join(dir, "netplan")
+	wantNetplan := `# Managed by gru, do not edit
+network:
+  version: 2
+  ethernets:
+    eth0: {}
+    eth1: {}
+  bonds:
+    bond0:
+      interfaces: [eth0, eth1]
+      parameters:
+        mode: 802.3ad
+      addresses: [10.0.0.5/24]
+      routes:
+        - to: default
+          via: 10.0.0.1
+`
+	errorIfNotEqual(t, map[string]string{filepath.Join(b.netplanDir, "60-gru-bond0.yaml"): wantNetplan}, b.persistentFiles())
+
+	// Deleting the bond removes the persistent configuration
+	b.Config = "ifcfg"
+	commands = nil
+	if err := b.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"ip link delete bond0"}, commands)
+	if _, err := os.Stat(filepath.Join(b.ifcfgDir, "ifcfg-bond0")); !os.IsNotExist(err) {
+		t.Error("want ifcfg-bond0 removed")
+	}
+
+	// Invalid modes are rejected
+	b.Mode = "round-robin"
+	if err := b.Validate(); err == nil {
+		t.Error("want error for invalid mode")
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// manifestEntry type represents a single file listed in a checksum manifest.
+type manifestEntry struct {
+	// Path to the file, relative to the root directory
+	path string
+
+	// Expected checksum of the file
+	checksum string
+}
+
+// ChecksumManifest type is a resource which verifies that the files
+// listed in a checksum manifest, such as SHA256SUMS, match their
+// checksums.
+//
+// The resource only verifies files and reports all files which do
+// not match at once, unless a source tree is provided, in which case
+// files which do not match are restored from the source tree.
+//
+// Manifests use the format of the sha256sum(1) family of tools,
+// e.g. "<checksum>  <path>", or the BSD format, e.g.
+// "SHA256 (<path>) = <checksum>".
+//
+// Example:
+//   sums = resource.checksum_manifest.new("/usr/local/app/SHA256SUMS")
+//   sums.algorithm = "sha256"
+//
+// Restoring files from a source tree.
+//
+// Example:
+//   sums = resource.checksum_manifest.new("/usr/local/app/SHA256SUMS")
+//   sums.source = "/var/cache/app"
+type ChecksumManifest struct {
+	Base
+
+	// Manifest is the path to the checksum manifest.
+	// Defaults to the resource name.
+	Manifest string `luar:"manifest"`
+
+	// Root is the directory to which the paths in the manifest
+	// are relative. Defaults to the directory of the manifest.
+	Root string `luar:"root"`
+
+	// Algorithm used for the checksums in the manifest, either
+	// "md5", "sha1", "sha256" or "sha512". Defaults to "sha256".
+	Algorithm string `luar:"algorithm"`
+
+	// Source is an optional directory, from which files
+	// not matching the manifest are restored.
+	Source string `luar:"source"`
+
+	// The entries in the manifest
+	entries []manifestEntry `luar:"-"`
+
+	// The entries which do not match the manifest
+	mismatched []manifestEntry `luar:"-"`
+}
+
+// NewChecksumManifest creates a new resource for
+// verifying files against a checksum manifest.
+func NewChecksumManifest(name string) (Resource, error) {
+	cm := &ChecksumManifest{
+		Base: Base{
+			Name:              name,
+			Type:              "checksum_manifest",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		Manifest:  name,
+		Algorithm: "sha256",
+	}
+
+	cm.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "checksums",
+			PropertySetFunc:      cm.setChecksums,
+			PropertyIsSyncedFunc: cm.isChecksumsSynced,
+		},
+	}
+
+	return cm, nil
+}
+
+// Validate validates the resource.
+func (cm *ChecksumManifest) Validate() error {
+	if err := cm.Base.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := utils.NewHash(cm.Algorithm); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Initialize reads the entries from the manifest.
+func (cm *ChecksumManifest) Initialize() error {
+	if cm.Root == "" {
+		cm.Root = filepath.Dir(cm.Manifest)
+	}
+
+	data, err := ioutil.ReadFile(cm.Manifest)
+	if err != nil {
+		return err
+	}
+
+	entries, err := parseChecksumManifest(data)
+	if err != nil {
+		return fmt.Errorf("invalid manifest %s: %s", cm.Manifest, err)
+	}
+	cm.entries = entries
+
+	return nil
+}
+
+// Evaluate evaluates the state of the resource. The resource is
+// present once the manifest has been read, and the files listed in
+// it are verified by the checksums property.
+func (cm *ChecksumManifest) Evaluate() (State, error) {
+	state := State{
+		Current: "present",
+		Want:    cm.State,
+	}
+
+	return state, nil
+}
+
+// Create is not implemented, since the resource only verifies files.
+func (cm *ChecksumManifest) Create() error {
+	return ErrNotImplemented
+}
+
+// Delete is not implemented, since the resource only verifies files.
+func (cm *ChecksumManifest) Delete() error {
+	return ErrNotImplemented
+}
+
+// hashFiles computes the checksums of the files in the manifest
+// entries relative to root. The files are hashed concurrently,
+// using the limits from the resource configuration.
+func (cm *ChecksumManifest) hashFiles(root string, entries []manifestEntry) *utils.HashResult {
+	paths := make([]string, len(entries))
+	for i, entry := range entries {
+		paths[i] = filepath.Join(root, entry.path)
+	}
+
+	opts := utils.HashOptions{
+		Algorithm:     cm.Algorithm,
+		Concurrency:   DefaultConfig.Concurrency,
+		InFlightBytes: DefaultConfig.HashInFlightBytes,
+	}
+
+	return utils.HashFiles(paths, opts)
+}
+
+// verify returns the manifest entries, which do not match the files.
+func (cm *ChecksumManifest) verify(root string) ([]manifestEntry, error) {
+	result := cm.hashFiles(root, cm.entries)
+	mismatched := make([]manifestEntry, 0)
+	for _, entry := range cm.entries {
+		path := filepath.Join(root, entry.path)
+		err := result.Errors[path]
+		if os.IsNotExist(err) {
+			mismatched = append(mismatched, entry)
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Digests[path] != entry.checksum {
+			mismatched = append(mismatched, entry)
+		}
+	}
+
+	return mismatched, nil
+}
+
+// isChecksumsSynced checks whether all files match the manifest.
+// If no source tree is provided all files which do not match are
+// reported as an error.
+func (cm *ChecksumManifest) isChecksumsSynced() (bool, error) {
+	mismatched, err := cm.verify(cm.Root)
+	if err != nil {
+		return false, err
+	}
+	cm.mismatched = mismatched
+
+	if len(mismatched) == 0 {
+		return true, nil
+	}
+
+	paths := make([]string, len(mismatched))
+	for i, entry := range mismatched {
+		paths[i] = entry.path
+	}
+
+	if cm.Source == "" {
+		return false, fmt.Errorf("%d file(s) do not match manifest: %s", len(paths), strings.Join(paths, ", "))
+	}
+
+	cm.Printf("%d file(s) do not match manifest: %s\n", len(paths), strings.Join(paths, ", "))
+
+	return false, nil
+}
+
+// setChecksums restores the files, which do not match
+// the manifest from the source tree.
+func (cm *ChecksumManifest) setChecksums() error {
+	result := cm.hashFiles(cm.Source, cm.mismatched)
+	for _, entry := range cm.mismatched {
+		src := filepath.Join(cm.Source, entry.path)
+		if err := result.Errors[src]; err != nil {
+			return err
+		}
+
+		if result.Digests[src] != entry.checksum {
+			return fmt.Errorf("source file %s does not match manifest", src)
+		}
+
+		cm.Printf("restoring %s\n", entry.path)
+
+		dst := utils.NewFileUtil(filepath.Join(cm.Root, entry.path))
+		if err := os.MkdirAll(filepath.Dir(dst.Path), 0755); err != nil {
+			return err
+		}
+
+		if err := dst.CopyFrom(src, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseChecksumManifest parses the entries of a checksum manifest.
+func parseChecksumManifest(data []byte) ([]manifestEntry, error) {
+	entries := make([]manifestEntry, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, err := parseManifestLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// parseManifestLine parses a single line of a checksum manifest.
+func parseManifestLine(line string) (manifestEntry, error) {
+	var entry manifestEntry
+
+	// BSD format, e.g. "SHA256 (path) = checksum"
+	if i := strings.Index(line, " ("); i != -1 && strings.Contains(line, ") = ") {
+		j := strings.LastIndex(line, ") = ")
+		entry.path = line[i+2 : j]
+		entry.checksum = strings.ToLower(line[j+4:])
+	} else {
+		// GNU format, e.g. "checksum  path" or "checksum *path"
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return entry, errors.New("missing path")
+		}
+		entry.checksum = strings.ToLower(fields[0])
+		entry.path = strings.TrimPrefix(strings.TrimPrefix(fields[1], " "), "*")
+	}
+
+	if entry.path == "" {
+		return entry, errors.New("missing path")
+	}
+
+	rel := filepath.Clean(entry.path)
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return entry, fmt.Errorf("path %s is outside of root", entry.path)
+	}
+
+	for _, c := range entry.checksum {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return entry, fmt.Errorf("invalid checksum for %s", entry.path)
+		}
+	}
+
+	return entry, nil
+}
+
+func init() {
+	manifest := ProviderItem{
+		Type:      "checksum_manifest",
+		Provider:  NewChecksumManifest,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(manifest)
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseChecksumManifest(t *testing.T) {
+	data := []byte(`# comment
+d3b07384d113edec49eaa6238ad5ff00  foo
+C157A79031E1C40F85931829BC5FC552 *bar baz
+SHA256 (qux) = 2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae
+`)
+
+	entries, err := parseChecksumManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []manifestEntry{
+		{path: "foo", checksum: "d3b07384d113edec49eaa6238ad5ff00"},
+		{path: "bar baz", checksum: "c157a79031e1c40f85931829bc5fc552"},
+		{path: "qux", checksum: "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"},
+	}
+	errorIfNotEqual(t, want, entries)
+
+	for _, line := range []string{"abc", "xyz  foo", "abc  ../foo", "abc  /etc/passwd"} {
+		if _, err := parseChecksumManifest([]byte(line)); err == nil {
+			t.Errorf("want error for manifest line %q", line)
+		}
+	}
+}
+
+func TestChecksumManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	source := filepath.Join(dir, "source")
+	files := map[string]string{
+		"a":     "foo",
+		"b":     "bar",
+		"c/d/e": "qux",
+	}
+
+	var manifest []string
+	for name, content := range files {
+		for _, base := range []string{root, source} {
+			path := filepath.Join(base, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		manifest = append(manifest, fmt.Sprintf("%x  %s", sha256.Sum256([]byte(content)), name))
+	}
+
+	sums := filepath.Join(root, "SHA256SUMS")
+	if err := ioutil.WriteFile(sums, []byte(strings.Join(manifest, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewChecksumManifest(sums)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cm := r.(*ChecksumManifest)
+	if err := cm.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	synced, err := cm.isChecksumsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	// All mismatches are reported at once
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "c")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cm.isChecksumsSynced()
+	if err == nil || !strings.Contains(err.Error(), "2 file(s)") {
+		t.Fatalf("want error reporting 2 files, got %v", err)
+	}
+
+	// Files are restored when a source tree is provided
+	cm.Source = source
+	synced, err = cm.isChecksumsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := cm.setChecksums(); err != nil {
+		t.Fatal(err)
+	}
+
+	synced, err = cm.isChecksumsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// CloudflareNamespace is the table name in Lua where Cloudflare resources are
+// being registered to.
+const CloudflareNamespace = "cloudflare"
+
+// ErrNoAPIToken error is returned when no API token is provided for
+// authenticating against a remote API endpoint.
+var ErrNoAPIToken = errors.New("No API token provided")
+
+// CloudflareDNS type is a resource which manages DNS records in
+// Cloudflare zones.
+//
+// Multiple records with the same name and type, e.g. multiple A
+// records, are supported by using a separate resource for each record.
+// Records of such types are identified by their content. CNAME records
+// are identified by their name only, since there can be only one
+// CNAME record for a given name.
+//
+// Example:
+//   www1 = cloudflare.dns.new("www.example.org A 192.0.2.1")
+//   www1.api_token = "my-api-token"
+//   www1.zone = "example.org"
+//   www1.name = "www.example.org"
+//   www1.type = "A"
+//   www1.content = "192.0.2.1"
+//   www1.proxied = true
+type CloudflareDNS struct {
+	Base
+
+	// Zone is the name of the Cloudflare zone. Required.
+	Zone string `luar:"zone"`
+
+	// RecordName is the name of the DNS record.
+	// Defaults to the resource name.
+	RecordName string `luar:"name"`
+
+	// RecordType is the type of the DNS record.
+	// Valid types are A, AAAA, CNAME, TXT and MX.
+	RecordType string `luar:"type"`
+
+	// Content of the DNS record. Required.
+	Content string `luar:"content"`
+
+	// TTL of the DNS record in seconds.
+	// Defaults to 1, which means automatic.
+	TTL int `luar:"ttl"`
+
+	// Proxied specifies whether the record is proxied by Cloudflare.
+	// Defaults to false.
+	Proxied bool `luar:"proxied"`
+
+	// APIToken is the Cloudflare API token. Required.
+	APIToken string `luar:"api_token" gru:"sensitive"`
+
+	// The DNS record managed by the resource, if it exists
+	record *cloudflare.DNSRecord `luar:"-"`
+
+	zoneID  string             `luar:"-"`
+	ctx     context.Context    `luar:"-"`
+	cancel  context.CancelFunc `luar:"-"`
+	api     *cloudflare.API    `luar:"-"`
+	baseURL string             `luar:"-"`
+}
+
+// NewCloudflareDNS creates a new resource for managing
+// DNS records in Cloudflare zones.
+func NewCloudflareDNS(name string) (Resource, error) {
+	c := &CloudflareDNS{
+		Base: Base{
+			Name:              name,
+			Type:              "dns",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		RecordName: name,
+		TTL:        1,
+		Proxied:    false,
+	}
+
+	c.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "record",
+			PropertySetFunc:      c.setRecord,
+			PropertyIsSyncedFunc: c.isRecordSynced,
+		},
+	}
+
+	return c, nil
+}
+
+// Validate validates the resource.
+func (c *CloudflareDNS) Validate() error {
+	if err := c.Base.Validate(); err != nil {
+		return err
+	}
+
+	if c.APIToken == "" {
+		return ErrNoAPIToken
+	}
+
+	if c.Zone == "" {
+		return errors.New("must provide zone")
+	}
+
+	switch c.RecordType {
+	case "A", "AAAA", "CNAME", "TXT", "MX":
+		break
+	default:
+		return fmt.Errorf("invalid record type '%s'", c.RecordType)
+	}
+
+	if c.Content == "" {
+		return errors.New("must provide record content")
+	}
+
+	return nil
+}
+
+// Initialize creates the client for the Cloudflare API.
+func (c *CloudflareDNS) Initialize() error {
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	opts := make([]cloudflare.Option, 0)
+	if c.baseURL != "" {
+		opts = append(opts, cloudflare.BaseURL(c.baseURL))
+	}
+
+	api, err := cloudflare.NewWithAPIToken(c.APIToken, opts...)
+	if err != nil {
+		return err
+	}
+	c.api = api
+
+	zoneID, err := c.api.ZoneIDByName(c.Zone)
+	if err != nil {
+		return err
+	}
+	c.zoneID = zoneID
+
+	return nil
+}
+
+// Close cancels any pending requests to the Cloudflare API.
+func (c *CloudflareDNS) Close() error {
+	c.cancel()
+
+	return nil
+}
+
+// Evaluate evaluates the state of the DNS record.
+func (c *CloudflareDNS) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    c.State,
+	}
+
+	filter := cloudflare.DNSRecord{Name: c.RecordName, Type: c.RecordType}
+	records, err := c.api.DNSRecords(c.ctx, c.zoneID, filter)
+	if err != nil {
+		return state, err
+	}
+
+	for _, record := range records {
+		if c.RecordType == "CNAME" || record.Content == c.Content {
+			r := record
+			c.record = &r
+			state.Current = "present"
+			return state, nil
+		}
+	}
+
+	state.Current = "absent"
+
+	return state, nil
+}
+
+// Create creates the DNS record.
+func (c *CloudflareDNS) Create() error {
+	c.Printf("creating %s record %s\n", c.RecordType, c.RecordName)
+
+	resp, err := c.api.CreateDNSRecord(c.ctx, c.zoneID, c.desiredRecord())
+	if err != nil {
+		return err
+	}
+	c.record = &resp.Result
+
+	return nil
+}
+
+// Delete deletes the DNS record.
+func (c *CloudflareDNS) Delete() error {
+	c.Printf("removing %s record %s\n", c.RecordType, c.RecordName)
+
+	return c.api.DeleteDNSRecord(c.ctx, c.zoneID, c.record.ID)
+}
+
+// desiredRecord returns the DNS record as described by the resource.
+func (c *CloudflareDNS) desiredRecord() cloudflare.DNSRecord {
+	proxied := c.Proxied
+	record := cloudflare.DNSRecord{
+		Name:    c.RecordName,
+		Type:    c.RecordType,
+		Content: c.Content,
+		TTL:     c.TTL,
+		Proxied: &proxied,
+	}
+
+	return record
+}
+
+// isRecordSynced checks whether the DNS record settings are in sync.
+func (c *CloudflareDNS) isRecordSynced() (bool, error) {
+	if c.record == nil {
+		return false, ErrResourceAbsent
+	}
+
+	proxied := c.record.Proxied != nil && *c.record.Proxied
+	synced := c.record.Content == c.Content && c.record.TTL == c.TTL && proxied == c.Proxied
+
+	return synced, nil
+}
+
+// setRecord updates the DNS record settings.
+func (c *CloudflareDNS) setRecord() error {
+	c.Printf("updating %s record %s\n", c.RecordType, c.RecordName)
+
+	return c.api.UpdateDNSRecord(c.ctx, c.zoneID, c.record.ID, c.desiredRecord())
+}
+
+func init() {
+	dns := ProviderItem{
+		Type:      "dns",
+		Provider:  NewCloudflareDNS,
+		Namespace: CloudflareNamespace,
+	}
+
+	RegisterProvider(dns)
+}
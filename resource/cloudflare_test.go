@@ -0,0 +1,264 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// fakeCloudflare is a minimal implementation of the zone
+// and DNS record endpoints of the Cloudflare API.
+type fakeCloudflare struct {
+	sync.Mutex
+	records map[string]cloudflare.DNSRecord
+	nextID  int
+	updated int
+}
+
+func (c *fakeCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("Authorization") != "Bearer my-token" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"success": false, "errors": [{"code": 9109, "message": "Invalid access token"}]}`))
+		return
+	}
+
+	reply := func(result interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     true,
+			"errors":      []interface{}{},
+			"messages":    []interface{}{},
+			"result":      result,
+			"result_info": map[string]int{"page": 1, "per_page": 100, "total_pages": 1},
+		})
+	}
+
+	const prefix = "/zones/zone-1/dns_records"
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	record, ok := c.records[id]
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/zones":
+		zones := make([]map[string]string, 0)
+		if r.URL.Query().Get("name") == "example.org" {
+			zones = append(zones, map[string]string{"id": "zone-1", "name": "example.org"})
+		}
+		reply(zones)
+	case r.Method == "GET" && r.URL.Path == prefix:
+		query := r.URL.Query()
+		found := make([]cloudflare.DNSRecord, 0)
+		for _, record := range c.records {
+			if record.Name == query.Get("name") && record.Type == query.Get("type") {
+				found = append(found, record)
+			}
+		}
+		reply(found)
+	case r.Method == "POST" && r.URL.Path == prefix:
+		var in cloudflare.DNSRecord
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.nextID++
+		in.ID = fmt.Sprintf("record-%d", c.nextID)
+		c.records[in.ID] = in
+		reply(in)
+	case !ok || !strings.HasPrefix(r.URL.Path, prefix+"/"):
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"success": false, "errors": [{"code": 81044, "message": "Record not found"}]}`))
+	case r.Method == "GET":
+		reply(record)
+	case r.Method == "PATCH" || r.Method == "PUT":
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		record.ID = id
+		c.records[id] = record
+		c.updated++
+		reply(record)
+	case r.Method == "DELETE":
+		delete(c.records, id)
+		reply(map[string]string{"id": id})
+	default:
+		http.Error(w, "unexpected request", http.StatusMethodNotAllowed)
+	}
+}
+
+// newTestCloudflareDNS creates a Cloudflare DNS resource,
+// which manages the given record in the fake API.
+func newTestCloudflareDNS(t *testing.T, url, recordType, content string) *CloudflareDNS {
+	r, err := NewCloudflareDNS("www.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := r.(*CloudflareDNS)
+	c.APIToken = "my-token"
+	c.Zone = "example.org"
+	c.RecordType = recordType
+	c.Content = content
+	c.baseURL = url
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestCloudflareDNS(t *testing.T) {
+	cf := &fakeCloudflare{records: make(map[string]cloudflare.DNSRecord)}
+	ts := httptest.NewServer(cf)
+	defer ts.Close()
+
+	c := newTestCloudflareDNS(t, ts.URL, "A", "192.0.2.1")
+	defer c.Close()
+	errorIfNotEqual(t, "zone-1", c.zoneID)
+
+	state, err := c.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	_, err = c.isRecordSynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	if err := c.Create(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "192.0.2.1", cf.records["record-1"].Content)
+
+	// Records of the same name and type are identified by their content
+	other := newTestCloudflareDNS(t, ts.URL, "A", "192.0.2.2")
+	defer other.Close()
+
+	state, err = other.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	state, err = c.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+	errorIfNotEqual(t, []string{}, outOfSync(t, c))
+
+	// Changes made outside of the resource are detected
+	record := cf.records["record-1"]
+	proxied := true
+	record.Proxied = &proxied
+	record.TTL = 300
+	cf.records["record-1"] = record
+
+	if _, err := c.Evaluate(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"record"}, outOfSync(t, c))
+
+	if err := c.Properties()[0].Set(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, 1, cf.updated)
+	errorIfNotEqual(t, 1, cf.records["record-1"].TTL)
+	errorIfNotEqual(t, false, *cf.records["record-1"].Proxied)
+
+	if _, err := c.Evaluate(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{}, outOfSync(t, c))
+
+	// CNAME records are identified by their name only
+	cname := newTestCloudflareDNS(t, ts.URL, "CNAME", "web.example.org")
+	defer cname.Close()
+	if err := cname.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	cname.Content = "www.example.net"
+	if _, err := cname.Evaluate(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"record"}, outOfSync(t, cname))
+
+	if err := c.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = c.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+	errorIfNotEqual(t, 1, len(cf.records))
+}
+
+func TestCloudflareDNSValidate(t *testing.T) {
+	r, err := NewCloudflareDNS("www.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := r.(*CloudflareDNS)
+	errorIfNotEqual(t, "www.example.org", c.RecordName)
+	errorIfNotEqual(t, 1, c.TTL)
+
+	if err := c.Validate(); err != ErrNoAPIToken {
+		t.Errorf("want missing api token error, got %v", err)
+	}
+
+	c.APIToken = "my-token"
+	if err := c.Validate(); err == nil {
+		t.Error("want error for missing zone")
+	}
+
+	c.Zone = "example.org"
+	c.RecordType = "SRV"
+	if err := c.Validate(); err == nil {
+		t.Error("want error for unsupported record type")
+	}
+
+	c.RecordType = "A"
+	if err := c.Validate(); err == nil {
+		t.Error("want error for missing content")
+	}
+}
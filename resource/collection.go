@@ -27,10 +27,17 @@ package resource
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/dnaeon/gru/graph"
+	"github.com/dnaeon/gru/utils"
 )
 
+// wildcardSuffix is the suffix of requirements matching
+// all resources of a given type, e.g. "package[*]".
+const wildcardSuffix = "[*]"
+
 // Collection type is a map which keys are the
 // resource ids and their values are the actual resources
 type Collection map[string]Resource
@@ -64,12 +71,15 @@ func (c Collection) DependencyGraph() (*graph.Graph, error) {
 
 	// Connect the nodes in the graph
 	for id, r := range c {
-		// Create edges between the nodes and the ones
-		// required by it
-		for _, dep := range r.Dependencies() {
+		for _, dep := range c.Dependencies(r) {
 			if _, ok := c[dep]; !ok {
 				return g, fmt.Errorf("%s wants %s, which does not exist", id, dep)
 			}
+		}
+
+		// Create edges between the nodes and the ones
+		// processed before them
+		for _, dep := range c.Prerequisites(r) {
 			g.AddEdge(nodes[id], nodes[dep])
 		}
 
@@ -85,3 +95,94 @@ func (c Collection) DependencyGraph() (*graph.Graph, error) {
 
 	return g, nil
 }
+
+// Dependencies returns the ids of the resources required by a resource.
+// Requirements in the form of "type[*]" are expanded to all resources
+// of the given type in the collection, except for the resource itself.
+// Wildcards which do not match any resources are ignored.
+func (c Collection) Dependencies(r Resource) []string {
+	deps := make([]string, 0, len(r.Dependencies()))
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			deps = append(deps, id)
+		}
+	}
+
+	for _, dep := range r.Dependencies() {
+		if !strings.HasSuffix(dep, wildcardSuffix) {
+			add(dep)
+			continue
+		}
+
+		prefix := strings.TrimSuffix(dep, "*]")
+		matches := make([]string, 0)
+		for id := range c {
+			if strings.HasPrefix(id, prefix) && id != r.ID() {
+				matches = append(matches, id)
+			}
+		}
+		sort.Strings(matches)
+
+		for _, id := range matches {
+			add(id)
+		}
+	}
+
+	return deps
+}
+
+// Prerequisites returns the ids of the resources, which are processed
+// before a resource. These are the resources required by it, unless
+// both resources should be absent. Removals are processed in reverse
+// order instead, so that dependents are removed before the resources
+// they depend on.
+func (c Collection) Prerequisites(r Resource) []string {
+	removal := IsRemoval(r)
+	prereqs := make([]string, 0)
+	for _, dep := range c.Dependencies(r) {
+		if d, ok := c[dep]; ok && removal && IsRemoval(d) {
+			continue
+		}
+		prereqs = append(prereqs, dep)
+	}
+
+	if !removal {
+		return prereqs
+	}
+
+	ids := make([]string, 0, len(c))
+	for id := range c {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		dependent := c[id]
+		if id == r.ID() || !IsRemoval(dependent) {
+			continue
+		}
+
+		for _, dep := range c.Dependencies(dependent) {
+			if dep == r.ID() {
+				prereqs = append(prereqs, id)
+				break
+			}
+		}
+	}
+
+	return prereqs
+}
+
+// IsRemoval returns a boolean indicating whether a resource
+// has been declared to be absent. Resources, which do not
+// declare their desired state are never removals.
+func IsRemoval(r Resource) bool {
+	d, ok := r.(StateDeclarer)
+	if !ok {
+		return false
+	}
+
+	return utils.NewString(d.DesiredState()).IsInList(utils.NewList(r.AbsentStates()...))
+}
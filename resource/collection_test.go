@@ -0,0 +1,178 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"testing"
+
+	"github.com/dnaeon/gru/graph"
+)
+
+func TestCollectionWildcardDependencies(t *testing.T) {
+	resources := make([]Resource, 0)
+	for _, name := range []string{"foo", "bar", "baz"} {
+		r, err := NewShell(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resources = append(resources, r)
+	}
+
+	// Depends on the other shell resources and explicitly
+	// on one of them, which should not be duplicated
+	foo := resources[0].(*Shell)
+	foo.Require = []string{"shell[*]", "shell[bar]", "package[*]"}
+
+	c, err := CreateCollection(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"shell[bar]", "shell[baz]"}, c.Dependencies(foo))
+
+	g, err := c.DependencyGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sorted, err := g.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "shell[foo]", sorted[len(sorted)-1].Name)
+
+	// Wildcards expand before detecting cycles
+	bar := resources[1].(*Shell)
+	bar.Require = []string{"shell[*]"}
+	g, err = c.DependencyGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := g.Sort(); err != graph.ErrCircularDependency {
+		t.Errorf("want circular dependency error, got %v", err)
+	}
+}
+
+func TestCollectionSortDeterministic(t *testing.T) {
+	L := newLuaState()
+	defer L.Close()
+
+	code := `
+	pkg = resource.shell.new("pkg")
+	config = resource.shell.new("config")
+	config.require = { "shell[pkg]" }
+	logs = resource.shell.new("logs")
+	logs.require = { "shell[pkg]" }
+	service = resource.shell.new("service")
+	service.require = { "shell[config]", "shell[logs]" }
+	cron = resource.shell.new("cron")
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	var resources []Resource
+	for _, name := range []string{"pkg", "config", "logs", "service", "cron"} {
+		resources = append(resources, luaResource(L, name).(Resource))
+	}
+
+	c, err := CreateCollection(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resources at the same level are sorted by id
+	want := []string{"shell[cron]", "shell[pkg]", "shell[config]", "shell[logs]", "shell[service]"}
+	for i := 0; i < 20; i++ {
+		g, err := c.DependencyGraph()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sorted, err := g.Sort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, node := range sorted {
+			got = append(got, node.Name)
+		}
+		errorIfNotEqual(t, want, got)
+	}
+}
+
+func TestCollectionRemovalOrder(t *testing.T) {
+	L := newLuaState()
+	defer L.Close()
+
+	code := `
+	pkg = resource.shell.new("pkg")
+	pkg.state = "absent"
+	config = resource.shell.new("config")
+	config.state = "absent"
+	config.require = { "shell[pkg]" }
+	service = resource.shell.new("service")
+	service.require = { "shell[config]" }
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	var resources []Resource
+	for _, name := range []string{"pkg", "config", "service"} {
+		resources = append(resources, luaResource(L, name).(Resource))
+	}
+
+	c, err := CreateCollection(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Dependents are removed before their dependencies, while
+	// resources which should be present keep their order
+	errorIfNotEqual(t, []string{"shell[config]"}, c.Prerequisites(c["shell[pkg]"]))
+	errorIfNotEqual(t, []string{}, c.Prerequisites(c["shell[config]"]))
+	errorIfNotEqual(t, []string{"shell[config]"}, c.Prerequisites(c["shell[service]"]))
+
+	g, err := c.DependencyGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sorted, err := g.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, node := range sorted {
+		got = append(got, node.Name)
+	}
+	errorIfNotEqual(t, []string{"shell[config]", "shell[pkg]", "shell[service]"}, got)
+}
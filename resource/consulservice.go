@@ -0,0 +1,403 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConsulNamespace is the table name in Lua where Consul resources are
+// being registered to.
+const ConsulNamespace = "consul"
+
+// consulDefaultAddr is the address of the local Consul agent.
+const consulDefaultAddr = "http://127.0.0.1:8500"
+
+// consulChecksMetaKey is the service meta key holding the checksum of
+// the health checks, since the agent API does not return the check
+// definitions of registered services.
+const consulChecksMetaKey = "gru_checks_checksum"
+
+// ConsulCheck type represents a health check of a Consul service.
+type ConsulCheck struct {
+	// Name of the check.
+	Name string `luar:"name" json:"Name,omitempty"`
+
+	// HTTP is the url checked by an HTTP check.
+	HTTP string `luar:"http" json:"HTTP,omitempty"`
+
+	// TCP is the host:port checked by a TCP check.
+	TCP string `luar:"tcp" json:"TCP,omitempty"`
+
+	// Args is the command executed by a script check.
+	Args []string `luar:"args" json:"Args,omitempty"`
+
+	// Interval of the check, e.g. "10s".
+	Interval string `luar:"interval" json:"Interval,omitempty"`
+
+	// Timeout of the check, e.g. "5s".
+	Timeout string `luar:"timeout" json:"Timeout,omitempty"`
+
+	// TTL of a TTL check, e.g. "30s".
+	TTL string `luar:"ttl" json:"TTL,omitempty"`
+}
+
+// ConsulService type is a resource which manages service
+// registrations with the local Consul agent. The resource name
+// is used as the name of the service.
+//
+// Updates are made by registering the service again, which the
+// agent handles in place, so that changing the tags for example
+// does not deregister the service.
+//
+// Example:
+//   web = consul.service.new("web")
+//   web.port = 8080
+//   web.tags = { "production", "v2" }
+//   web.checks = {
+//     { name = "http", http = "http://localhost:8080/health", interval = "10s" },
+//   }
+type ConsulService struct {
+	Base
+
+	// ServiceID is the id of the service.
+	// Defaults to the resource name.
+	ServiceID string `luar:"id"`
+
+	// Port of the service.
+	Port int `luar:"port"`
+
+	// Tags of the service.
+	Tags []string `luar:"tags"`
+
+	// Address of the service. Defaults to the address of the agent.
+	Address string `luar:"address"`
+
+	// Checks are the health checks of the service.
+	Checks []ConsulCheck `luar:"checks"`
+
+	// Token is the ACL token used to authenticate against Consul.
+	// Defaults to the value of the CONSUL_HTTP_TOKEN environment variable.
+	Token string `luar:"token" gru:"sensitive"`
+
+	// ConsulAddr is the address of the Consul agent. Defaults to the
+	// value of the CONSUL_HTTP_ADDR environment variable, or to
+	// the agent listening on localhost.
+	ConsulAddr string `luar:"consul_address"`
+
+	// The service as registered with the agent
+	current *consulAgentService `luar:"-"`
+
+	client *http.Client `luar:"-"`
+}
+
+// consulAgentService type represents a service
+// registered with a Consul agent.
+type consulAgentService struct {
+	ID      string            `json:"ID"`
+	Service string            `json:"Service"`
+	Tags    []string          `json:"Tags"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Meta    map[string]string `json:"Meta"`
+}
+
+// consulServiceRegistration type is the payload
+// used for registering a service with a Consul agent.
+type consulServiceRegistration struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Tags    []string          `json:"Tags"`
+	Address string            `json:"Address,omitempty"`
+	Port    int               `json:"Port,omitempty"`
+	Meta    map[string]string `json:"Meta"`
+	Checks  []ConsulCheck     `json:"Checks,omitempty"`
+}
+
+// NewConsulService creates a new resource for managing
+// service registrations with a Consul agent.
+func NewConsulService(name string) (Resource, error) {
+	s := &ConsulService{
+		Base: Base{
+			Name:              name,
+			Type:              "service",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		ServiceID:  name,
+		Tags:       make([]string, 0),
+		Checks:     make([]ConsulCheck, 0),
+		Token:      os.Getenv("CONSUL_HTTP_TOKEN"),
+		ConsulAddr: os.Getenv("CONSUL_HTTP_ADDR"),
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+
+	s.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "tags",
+			PropertySetFunc:      s.register,
+			PropertyIsSyncedFunc: s.isTagsSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "endpoint",
+			PropertySetFunc:      s.register,
+			PropertyIsSyncedFunc: s.isEndpointSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "checks",
+			PropertySetFunc:      s.register,
+			PropertyIsSyncedFunc: s.isChecksSynced,
+		},
+	}
+
+	return s, nil
+}
+
+// Validate validates the resource.
+func (s *ConsulService) Validate() error {
+	if err := s.Base.Validate(); err != nil {
+		return err
+	}
+
+	if s.ServiceID == "" || strings.Contains(s.ServiceID, "/") {
+		return fmt.Errorf("invalid service id '%s'", s.ServiceID)
+	}
+
+	if s.Port < 0 || s.Port > 65535 {
+		return fmt.Errorf("invalid port %d", s.Port)
+	}
+
+	for _, check := range s.Checks {
+		kinds := 0
+		for _, v := range []string{check.HTTP, check.TCP, check.TTL} {
+			if v != "" {
+				kinds++
+			}
+		}
+		if len(check.Args) > 0 {
+			kinds++
+		}
+
+		if kinds != 1 {
+			return fmt.Errorf("check '%s' must specify exactly one of http, tcp, args or ttl", check.Name)
+		}
+
+		if check.TTL == "" && check.Interval == "" {
+			return fmt.Errorf("check '%s' must specify an interval", check.Name)
+		}
+	}
+
+	if s.ConsulAddr == "" {
+		s.ConsulAddr = consulDefaultAddr
+	}
+	if !strings.Contains(s.ConsulAddr, "://") {
+		s.ConsulAddr = "http://" + s.ConsulAddr
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the service.
+func (s *ConsulService) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    s.State,
+	}
+
+	var service consulAgentService
+	found, err := s.request("GET", "/v1/agent/service/"+url.PathEscape(s.ServiceID), nil, &service)
+	if err != nil {
+		return state, err
+	}
+
+	if !found {
+		s.current = nil
+		state.Current = "absent"
+		return state, nil
+	}
+
+	s.current = &service
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create registers the service.
+func (s *ConsulService) Create() error {
+	s.Printf("registering service\n")
+
+	return s.register()
+}
+
+// Delete deregisters the service.
+func (s *ConsulService) Delete() error {
+	s.Printf("deregistering service\n")
+
+	_, err := s.request("PUT", "/v1/agent/service/deregister/"+url.PathEscape(s.ServiceID), nil, nil)
+
+	return err
+}
+
+// register registers the service with the desired configuration.
+// Registering an already registered service updates it in place.
+func (s *ConsulService) register() error {
+	in := consulServiceRegistration{
+		ID:      s.ServiceID,
+		Name:    s.Name,
+		Tags:    s.Tags,
+		Address: s.Address,
+		Port:    s.Port,
+		Meta:    map[string]string{consulChecksMetaKey: s.checksChecksum()},
+		Checks:  s.Checks,
+	}
+
+	found, err := s.request("PUT", "/v1/agent/service/register", in, nil)
+	if err == nil && !found {
+		err = errors.New("service registration endpoint not found")
+	}
+
+	return err
+}
+
+// isTagsSynced checks whether the service tags are in sync.
+func (s *ConsulService) isTagsSynced() (bool, error) {
+	if s.current == nil {
+		return false, ErrResourceAbsent
+	}
+
+	current := append([]string{}, s.current.Tags...)
+	want := append([]string{}, s.Tags...)
+	sort.Strings(current)
+	sort.Strings(want)
+
+	if len(current) == 0 && len(want) == 0 {
+		return true, nil
+	}
+
+	return reflect.DeepEqual(current, want), nil
+}
+
+// isEndpointSynced checks whether the name, address
+// and port of the service are in sync.
+func (s *ConsulService) isEndpointSynced() (bool, error) {
+	if s.current == nil {
+		return false, ErrResourceAbsent
+	}
+
+	synced := s.current.Service == s.Name && s.current.Address == s.Address && s.current.Port == s.Port
+
+	return synced, nil
+}
+
+// isChecksSynced checks whether the health checks are in sync.
+func (s *ConsulService) isChecksSynced() (bool, error) {
+	if s.current == nil {
+		return false, ErrResourceAbsent
+	}
+
+	return s.current.Meta[consulChecksMetaKey] == s.checksChecksum(), nil
+}
+
+// checksChecksum returns the checksum of the health check definitions.
+func (s *ConsulService) checksChecksum() string {
+	data, _ := json.Marshal(s.Checks)
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// request sends a request to the Consul agent API and decodes the
+// response into out, if provided. The returned boolean is false
+// if the requested object was not found.
+func (s *ConsulService) request(method, path string, in, out interface{}) (bool, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return false, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(s.ConsulAddr, "/")+path, body)
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("X-Consul-Token", s.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return false, fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, bytes.TrimSpace(data))
+	}
+
+	if out == nil {
+		return true, nil
+	}
+
+	return true, json.NewDecoder(resp.Body).Decode(out)
+}
+
+func init() {
+	service := ProviderItem{
+		Type:      "service",
+		Provider:  NewConsulService,
+		Namespace: ConsulNamespace,
+	}
+
+	RegisterProvider(service)
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeConsulAgent is a minimal implementation of the
+// service endpoints of the Consul agent API.
+type fakeConsulAgent struct {
+	sync.Mutex
+	services     map[string]consulAgentService
+	registered   int
+	deregistered int
+	tokens       []string
+}
+
+func (a *fakeConsulAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.tokens = append(a.tokens, r.Header.Get("X-Consul-Token"))
+
+	switch {
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/agent/service/"):
+		service, ok := a.services[strings.TrimPrefix(r.URL.Path, "/v1/agent/service/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(service)
+	case r.Method == "PUT" && r.URL.Path == "/v1/agent/service/register":
+		var in consulServiceRegistration
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.services[in.ID] = consulAgentService{
+			ID:      in.ID,
+			Service: in.Name,
+			Tags:    in.Tags,
+			Address: in.Address,
+			Port:    in.Port,
+			Meta:    in.Meta,
+		}
+		a.registered++
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/")
+		if _, ok := a.services[id]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(a.services, id)
+		a.deregistered++
+	default:
+		http.Error(w, "unexpected request", http.StatusMethodNotAllowed)
+	}
+}
+
+// outOfSync returns the names of the properties which are out of sync.
+func outOfSync(t *testing.T, r Resource) []string {
+	names := make([]string, 0)
+	for _, p := range r.Properties() {
+		synced, err := p.IsSynced()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !synced {
+			names = append(names, p.Name())
+		}
+	}
+
+	return names
+}
+
+func TestConsulService(t *testing.T) {
+	agent := &fakeConsulAgent{services: make(map[string]consulAgentService)}
+	ts := httptest.NewServer(agent)
+	defer ts.Close()
+
+	L := newLuaState()
+	defer L.Close()
+
+	code := `
+	web = consul.service.new("web")
+	web.id = "web-1"
+	web.port = 8080
+	web.tags = { "production" }
+	web.token = "my-token"
+	web.consul_address = "` + strings.TrimPrefix(ts.URL, "http://") + `"
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	s := luaResource(L, "web").(*ConsulService)
+	s.Checks = []ConsulCheck{{Name: "http", HTTP: "http://localhost:8080/health", Interval: "10s"}}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := s.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := s.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Evaluate(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{}, outOfSync(t, s))
+	errorIfNotEqual(t, "web", agent.services["web-1"].Service)
+
+	// Changing the tags only registers the service again
+	s.Tags = []string{"v2", "production"}
+	errorIfNotEqual(t, []string{"tags"}, outOfSync(t, s))
+	if err := s.Properties()[0].Set(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check definitions are compared by checksum
+	s.Checks[0].Interval = "30s"
+	if _, err := s.Evaluate(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"checks"}, outOfSync(t, s))
+
+	errorIfNotEqual(t, 2, agent.registered)
+	errorIfNotEqual(t, 0, agent.deregistered)
+	errorIfNotEqual(t, []string{"v2", "production"}, agent.services["web-1"].Tags)
+
+	if err := s.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, 1, agent.deregistered)
+
+	state, err = s.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	for _, token := range agent.tokens {
+		errorIfNotEqual(t, "my-token", token)
+	}
+
+	s.Checks = []ConsulCheck{{Name: "both", HTTP: "http://localhost", TCP: "localhost:80", Interval: "10s"}}
+	if err := s.Validate(); err == nil {
+		t.Error("want error for check with multiple kinds")
+	}
+}
@@ -0,0 +1,472 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// corednsConfigPath is the path to the CoreDNS configuration file.
+const corednsConfigPath = "/etc/coredns/Corefile"
+
+// CoreDNSPlugin type represents a plugin enabled in a server block.
+type CoreDNSPlugin struct {
+	// Name of the plugin, e.g. "forward".
+	Name string `luar:"name"`
+
+	// Config contains the arguments and the optional block of
+	// the plugin, e.g. ". 8.8.8.8 8.8.4.4".
+	Config string `luar:"config"`
+}
+
+// CoreDNSConfig type is a resource which manages server blocks
+// in the CoreDNS configuration file.
+//
+// Each resource manages the server block of a zone and port, e.g.
+// "example.org:53". Other server blocks in the file are left
+// intact. CoreDNS is sent SIGUSR1 after the configuration has been
+// changed, which makes it reload the configuration.
+//
+// Example:
+//   zone = resource.coredns_config.new("example.org")
+//   zone.state = "present"
+//   zone.port = 53
+//   zone.plugins = {
+//     { name = "file", config = "/etc/coredns/db.example.org" },
+//     { name = "log" },
+//     { name = "errors" },
+//   }
+type CoreDNSConfig struct {
+	Base
+
+	// Zone of the server block. Defaults to the resource name.
+	Zone string `luar:"zone"`
+
+	// Port of the server block. Defaults to 53.
+	Port int `luar:"port"`
+
+	// Plugins enabled in the server block. The order of the
+	// plugins is not significant, as it is defined by CoreDNS.
+	Plugins []CoreDNSPlugin `luar:"plugins"`
+
+	// ConfigFile is the path to the CoreDNS configuration file.
+	// Defaults to /etc/coredns/Corefile.
+	ConfigFile string `luar:"config_file"`
+
+	// PidFile is the path to the pid file of CoreDNS. If not set
+	// the CoreDNS process is looked up by its name instead.
+	PidFile string `luar:"pid_file"`
+}
+
+// NewCoreDNSConfig creates a new resource for managing
+// server blocks in the CoreDNS configuration file.
+func NewCoreDNSConfig(name string) (Resource, error) {
+	c := &CoreDNSConfig{
+		Base: Base{
+			Name:              name,
+			Type:              "coredns_config",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// All server blocks are kept in the same file
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		Zone:       name,
+		Port:       53,
+		Plugins:    make([]CoreDNSPlugin, 0),
+		ConfigFile: corednsConfigPath,
+	}
+
+	c.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "plugins",
+			PropertySetFunc:      c.setPlugins,
+			PropertyIsSyncedFunc: c.isPluginsSynced,
+		},
+	}
+
+	return c, nil
+}
+
+// Validate validates the resource.
+func (c *CoreDNSConfig) Validate() error {
+	if err := c.Base.Validate(); err != nil {
+		return err
+	}
+
+	if c.Zone == "" || strings.ContainsAny(c.Zone, " \t\n{}#:") {
+		return fmt.Errorf("invalid zone '%s'", c.Zone)
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("invalid port %d", c.Port)
+	}
+
+	for _, p := range c.Plugins {
+		if p.Name == "" || strings.ContainsAny(p.Name, " \t\n{}#") {
+			return fmt.Errorf("invalid plugin name '%s'", p.Name)
+		}
+
+		if depth := corednsBraceDepth(p.Config); depth != 0 {
+			return fmt.Errorf("unbalanced braces in config of plugin %s", p.Name)
+		}
+	}
+
+	if c.ConfigFile == "" {
+		return errors.New("must provide path to configuration file")
+	}
+
+	return nil
+}
+
+// key returns the key of the server block.
+func (c *CoreDNSConfig) key() string {
+	return normalizeCoreDNSKey(c.Zone + ":" + strconv.Itoa(c.Port))
+}
+
+// Evaluate evaluates the state of the server block.
+func (c *CoreDNSConfig) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    c.State,
+	}
+
+	lines, err := c.readConfig()
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "absent"
+	if _, _, ok := findCoreDNSBlock(lines, c.key()); ok {
+		state.Current = "present"
+	}
+
+	return state, nil
+}
+
+// Create adds the server block to the configuration file.
+func (c *CoreDNSConfig) Create() error {
+	c.Printf("adding server block %s to %s\n", c.key(), c.ConfigFile)
+
+	lines, err := c.readConfig()
+	if err != nil {
+		return err
+	}
+
+	// Separate the block from the preceding one
+	if n := len(lines); n > 0 && strings.TrimSpace(lines[n-1]) != "" {
+		lines = append(lines, "")
+	}
+	lines = append(lines, c.block()...)
+
+	return c.writeConfig(lines)
+}
+
+// Delete removes the server block from the configuration file.
+func (c *CoreDNSConfig) Delete() error {
+	c.Printf("removing server block %s from %s\n", c.key(), c.ConfigFile)
+
+	lines, err := c.readConfig()
+	if err != nil {
+		return err
+	}
+
+	start, end, ok := findCoreDNSBlock(lines, c.key())
+	if !ok {
+		return nil
+	}
+
+	// Remove the blank line separating the block from the next one
+	if end < len(lines) && strings.TrimSpace(lines[end]) == "" {
+		end++
+	}
+	lines = append(lines[:start], lines[end:]...)
+
+	return c.writeConfig(lines)
+}
+
+// block returns the lines of the server block.
+func (c *CoreDNSConfig) block() []string {
+	lines := []string{c.Zone + ":" + strconv.Itoa(c.Port) + " {"}
+	for _, p := range c.Plugins {
+		config := strings.Split(strings.TrimSpace(p.Config), "\n")
+		lines = append(lines, strings.TrimRight("    "+p.Name+" "+strings.TrimSpace(config[0]), " "))
+		for _, line := range config[1:] {
+			lines = append(lines, "    "+line)
+		}
+	}
+
+	return append(lines, "}")
+}
+
+// isPluginsSynced checks whether the plugins of the server block are in sync.
+func (c *CoreDNSConfig) isPluginsSynced() (bool, error) {
+	lines, err := c.readConfig()
+	if err != nil {
+		return false, err
+	}
+
+	start, end, ok := findCoreDNSBlock(lines, c.key())
+	if !ok {
+		return false, ErrResourceAbsent
+	}
+
+	current := parseCoreDNSPlugins(lines[start+1 : end-1])
+	want := make([]string, 0, len(c.Plugins))
+	for _, p := range c.Plugins {
+		want = append(want, normalizeCoreDNSPlugin(p.Name+" "+p.Config))
+	}
+	sort.Strings(want)
+
+	return reflect.DeepEqual(current, want), nil
+}
+
+// setPlugins updates the plugins of the server block.
+func (c *CoreDNSConfig) setPlugins() error {
+	c.Printf("updating server block %s in %s\n", c.key(), c.ConfigFile)
+
+	lines, err := c.readConfig()
+	if err != nil {
+		return err
+	}
+
+	start, end, ok := findCoreDNSBlock(lines, c.key())
+	if !ok {
+		return ErrResourceAbsent
+	}
+
+	updated := append([]string{}, lines[:start]...)
+	updated = append(updated, c.block()...)
+	updated = append(updated, lines[end:]...)
+
+	return c.writeConfig(updated)
+}
+
+// readConfig reads the lines of the configuration file.
+// A missing file is treated as being empty.
+func (c *CoreDNSConfig) readConfig() ([]string, error) {
+	data, err := ioutil.ReadFile(c.ConfigFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	content := strings.TrimRight(string(data), "\n")
+	if content == "" {
+		return []string{}, nil
+	}
+
+	return strings.Split(content, "\n"), nil
+}
+
+// writeConfig writes the configuration file and
+// signals CoreDNS to reload it.
+func (c *CoreDNSConfig) writeConfig(lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(c.ConfigFile), 0755); err != nil {
+		return err
+	}
+
+	content := ""
+	if len(lines) > 0 {
+		content = strings.Join(lines, "\n") + "\n"
+	}
+
+	if err := writeFile(c.ConfigFile, []byte(content), 0644); err != nil {
+		return err
+	}
+
+	return c.reload()
+}
+
+// reload sends SIGUSR1 to CoreDNS, which makes it reload
+// the configuration, if it is running.
+func (c *CoreDNSConfig) reload() error {
+	args := []string{"pkill", "-USR1", "-x", "coredns"}
+	if c.PidFile != "" {
+		if _, err := os.Stat(c.PidFile); os.IsNotExist(err) {
+			c.Printf("coredns is not running, skipping reload\n")
+			return nil
+		}
+		args = []string{"pkill", "-USR1", "-F", c.PidFile}
+	}
+
+	spec := utils.CommandSpec{Args: args}
+	result, err := utils.RunCommand(context.Background(), spec)
+
+	// pkill(1) exits with 1 if no processes matched
+	if result.ExitCode == 1 {
+		c.Printf("coredns is not running, skipping reload\n")
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to reload coredns: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	c.Printf("sent SIGUSR1 to coredns\n")
+
+	return nil
+}
+
+// stripCoreDNSComment removes the comment from a line of the
+// configuration file. Quoted strings are not considered comments.
+func stripCoreDNSComment(line string) string {
+	quoted := false
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '#' && !quoted:
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// corednsBraceDepth returns the difference between the number of
+// opening and closing braces in the text, ignoring comments.
+func corednsBraceDepth(text string) int {
+	depth := 0
+	for _, line := range strings.Split(text, "\n") {
+		line = stripCoreDNSComment(line)
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+	}
+
+	return depth
+}
+
+// normalizeCoreDNSKey returns the key of a server block in a canonical
+// form, so that e.g. "dns://example.org.:53" and "example.org" compare equal.
+func normalizeCoreDNSKey(key string) string {
+	key = strings.ToLower(strings.TrimPrefix(key, "dns://"))
+	zone, port := key, "53"
+	if i := strings.LastIndex(key, ":"); i != -1 {
+		zone, port = key[:i], key[i+1:]
+	}
+
+	zone = strings.TrimSuffix(zone, ".")
+	if zone == "" {
+		zone = "."
+	}
+
+	return zone + ":" + port
+}
+
+// findCoreDNSBlock returns the index of the first line of the server
+// block with the given key, and the index following its last line.
+func findCoreDNSBlock(lines []string, key string) (int, int, bool) {
+	depth := 0
+	for i, line := range lines {
+		stripped := strings.TrimSpace(stripCoreDNSComment(line))
+		if depth == 0 && strings.HasSuffix(stripped, "{") {
+			found := false
+			for _, k := range strings.Fields(strings.TrimSuffix(stripped, "{")) {
+				if normalizeCoreDNSKey(strings.TrimSuffix(k, ",")) == key {
+					found = true
+				}
+			}
+
+			if found {
+				for j := i; j < len(lines); j++ {
+					depth += corednsBraceDepth(lines[j])
+					if depth <= 0 {
+						return i, j + 1, true
+					}
+				}
+				return 0, 0, false
+			}
+		}
+		depth += corednsBraceDepth(line)
+	}
+
+	return 0, 0, false
+}
+
+// parseCoreDNSPlugins returns the sorted and normalized plugin
+// directives found in the body of a server block.
+func parseCoreDNSPlugins(body []string) []string {
+	plugins := make([]string, 0)
+	depth := 0
+	current := ""
+	for _, line := range body {
+		stripped := strings.TrimSpace(stripCoreDNSComment(line))
+		if stripped == "" {
+			continue
+		}
+
+		if depth == 0 {
+			current = stripped
+		} else {
+			current += "\n" + stripped
+		}
+
+		depth += corednsBraceDepth(stripped)
+		if depth <= 0 {
+			plugins = append(plugins, normalizeCoreDNSPlugin(current))
+			depth = 0
+		}
+	}
+	sort.Strings(plugins)
+
+	return plugins
+}
+
+// normalizeCoreDNSPlugin returns a plugin directive in a canonical form,
+// so that directives differing only in whitespace compare equal.
+func normalizeCoreDNSPlugin(directive string) string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(directive, "\n") {
+		line = strings.Join(strings.Fields(stripCoreDNSComment(line)), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "coredns_config",
+		Provider:  NewCoreDNSConfig,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
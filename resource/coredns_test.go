@@ -0,0 +1,219 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestCoreDNSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-coredns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	corefile := `# Managed by hand
+. {
+    forward . 8.8.8.8
+    cache 30
+}
+
+example.org.:53 {
+    # Zone data
+    file /etc/coredns/db.example.org {
+        reload 10s
+    }
+    log
+}
+
+other.org {
+    errors
+}
+`
+	configFile := filepath.Join(dir, "Corefile")
+	if err := ioutil.WriteFile(configFile, []byte(corefile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	r, err := NewCoreDNSConfig("example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := r.(*CoreDNSConfig)
+	c.ConfigFile = configFile
+	c.Plugins = []CoreDNSPlugin{
+		{Name: "log"},
+		{Name: "file", Config: "/etc/coredns/db.example.org {\n    reload   10s\n}"},
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The existing block matches, regardless of order and whitespace
+	state, err := c.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+
+	synced, err := c.isPluginsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	// Changing the plugins rewrites only the managed block
+	c.Plugins = append(c.Plugins, CoreDNSPlugin{Name: "errors"})
+	synced, err = c.isPluginsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := c.setPlugins(); err != nil {
+		t.Fatal(err)
+	}
+	synced, err = c.isPluginsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+	errorIfNotEqual(t, []string{"pkill -USR1 -x coredns"}, commands)
+
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Managed by hand
+. {
+    forward . 8.8.8.8
+    cache 30
+}
+
+example.org:53 {
+    log
+    file /etc/coredns/db.example.org {
+        reload   10s
+    }
+    errors
+}
+
+other.org {
+    errors
+}
+`
+	errorIfNotEqual(t, want, string(data))
+
+	// Removing the block keeps the other blocks
+	if err := c.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	state, err = c.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	_, err = c.isPluginsSynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	data, err = ioutil.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `# Managed by hand
+. {
+    forward . 8.8.8.8
+    cache 30
+}
+
+other.org {
+    errors
+}
+`
+	errorIfNotEqual(t, want, string(data))
+
+	// Adding the block appends it to the end of the file
+	c.PidFile = filepath.Join(dir, "coredns.pid")
+	if err := ioutil.WriteFile(c.PidFile, []byte("1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	commands = nil
+	c.Plugins = []CoreDNSPlugin{{Name: "whoami"}}
+	if err := c.Create(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"pkill -USR1 -F " + c.PidFile}, commands)
+
+	data, err = ioutil.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, want+"\nexample.org:53 {\n    whoami\n}\n", string(data))
+}
+
+func TestCoreDNSConfigValidate(t *testing.T) {
+	r, err := NewCoreDNSConfig("example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := r.(*CoreDNSConfig)
+
+	c.Port = 0
+	errorIfNotEqual(t, true, c.Validate() != nil)
+
+	c.Port = 53
+	c.Plugins = []CoreDNSPlugin{{Name: "file", Config: "db.example.org {"}}
+	errorIfNotEqual(t, true, c.Validate() != nil)
+
+	c.Plugins = []CoreDNSPlugin{{Name: "file", Config: "db.example.org"}}
+	errorIfNotEqual(t, nil, c.Validate())
+}
+
+func TestNormalizeCoreDNSKey(t *testing.T) {
+	errorIfNotEqual(t, "example.org:53", normalizeCoreDNSKey("dns://example.org.:53"))
+	errorIfNotEqual(t, "example.org:53", normalizeCoreDNSKey("example.org"))
+	errorIfNotEqual(t, ".:1053", normalizeCoreDNSKey(".:1053"))
+	errorIfNotEqual(t, ".:53", normalizeCoreDNSKey("."))
+}
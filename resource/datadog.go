@@ -0,0 +1,349 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/DataDog/datadog-api-client-go/api/v1/datadog"
+	"github.com/dnaeon/gru/utils"
+)
+
+// DatadogNamespace is the table name in Lua where Datadog resources are
+// being registered to.
+const DatadogNamespace = "datadog"
+
+// ErrNoAppKey error is returned when no application key is provided
+// for the Datadog API.
+var ErrNoAppKey = errors.New("No application key provided")
+
+// DatadogMonitorOptions type represents the options of a Datadog monitor.
+// Options which are not set are left to the Datadog defaults.
+type DatadogMonitorOptions struct {
+	// NotifyNoData specifies whether to notify when data stops reporting.
+	NotifyNoData bool `luar:"notify_no_data"`
+
+	// NoDataTimeframe is the number of minutes before notifying
+	// when data stops reporting.
+	NoDataTimeframe int64 `luar:"no_data_timeframe"`
+
+	// RenotifyInterval is the number of minutes after the last
+	// notification before re-notifying on the current status.
+	RenotifyInterval int64 `luar:"renotify_interval"`
+
+	// IncludeTags specifies whether to include the triggering tags
+	// in the notification title.
+	IncludeTags bool `luar:"include_tags"`
+
+	// Critical threshold of the monitor.
+	Critical float64 `luar:"critical"`
+
+	// Warning threshold of the monitor.
+	Warning float64 `luar:"warning"`
+}
+
+// DatadogMonitor type is a resource which manages Datadog monitors.
+//
+// Monitors are identified by their name, which is the resource name.
+//
+// Example:
+//   mon = datadog.monitor.new("memcached is down")
+//   mon.api_key = "my-api-key"
+//   mon.app_key = "my-app-key"
+//   mon.type = "service check"
+//   mon.query = "\"process.up\".over(\"process:memcached\").last(2).count_by_status()"
+//   mon.message = "memcached is down @ops@example.org"
+//   mon.tags = { "service:memcached" }
+//   mon.options = {
+//     notify_no_data = true,
+//     no_data_timeframe = 10,
+//   }
+type DatadogMonitor struct {
+	Base
+
+	// MonitorType is the type of the monitor, e.g. "metric alert".
+	MonitorType string `luar:"type"`
+
+	// Query of the monitor. Required.
+	Query string `luar:"query"`
+
+	// Message to include in notifications for the monitor.
+	Message string `luar:"message"`
+
+	// Tags associated with the monitor.
+	Tags []string `luar:"tags"`
+
+	// Options of the monitor.
+	Options *DatadogMonitorOptions `luar:"options"`
+
+	// APIKey is the Datadog API key. Required.
+	APIKey string `luar:"api_key" gru:"sensitive"`
+
+	// AppKey is the Datadog application key. Required.
+	AppKey string `luar:"app_key" gru:"sensitive"`
+
+	// The monitor managed by the resource, if it exists
+	monitor *datadog.Monitor `luar:"-"`
+
+	ctx    context.Context    `luar:"-"`
+	cancel context.CancelFunc `luar:"-"`
+	client *datadog.APIClient `luar:"-"`
+}
+
+// NewDatadogMonitor creates a new resource for managing Datadog monitors.
+func NewDatadogMonitor(name string) (Resource, error) {
+	d := &DatadogMonitor{
+		Base: Base{
+			Name:              name,
+			Type:              "monitor",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		MonitorType: "metric alert",
+		Tags:        make([]string, 0),
+	}
+
+	d.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "monitor",
+			PropertySetFunc:      d.setMonitor,
+			PropertyIsSyncedFunc: d.isMonitorSynced,
+		},
+	}
+
+	return d, nil
+}
+
+// Validate validates the resource.
+func (d *DatadogMonitor) Validate() error {
+	if err := d.Base.Validate(); err != nil {
+		return err
+	}
+
+	if d.APIKey == "" {
+		return ErrNoAPIKey
+	}
+
+	if d.AppKey == "" {
+		return ErrNoAppKey
+	}
+
+	if _, err := datadog.NewMonitorTypeFromValue(d.MonitorType); err != nil {
+		return err
+	}
+
+	if d.Query == "" {
+		return errors.New("must provide monitor query")
+	}
+
+	return nil
+}
+
+// Initialize creates the client for the Datadog API.
+func (d *DatadogMonitor) Initialize() error {
+	keys := map[string]datadog.APIKey{
+		"apiKeyAuth": {Key: d.APIKey},
+		"appKeyAuth": {Key: d.AppKey},
+	}
+
+	ctx := context.WithValue(context.Background(), datadog.ContextAPIKeys, keys)
+	d.ctx, d.cancel = context.WithCancel(ctx)
+	d.client = datadog.NewAPIClient(datadog.NewConfiguration())
+
+	return nil
+}
+
+// Close cancels any pending requests to the Datadog API.
+func (d *DatadogMonitor) Close() error {
+	d.cancel()
+
+	return nil
+}
+
+// Evaluate evaluates the state of the monitor.
+func (d *DatadogMonitor) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    d.State,
+	}
+
+	params := datadog.NewListMonitorsOptionalParameters().WithName(d.Name)
+	monitors, _, err := d.client.MonitorsApi.ListMonitors(d.ctx, *params)
+	if err != nil {
+		return state, err
+	}
+
+	// The monitor name is used for substring matching by the API
+	for _, monitor := range monitors {
+		if monitor.GetName() == d.Name {
+			m := monitor
+			d.monitor = &m
+			state.Current = "present"
+			return state, nil
+		}
+	}
+
+	state.Current = "absent"
+
+	return state, nil
+}
+
+// Create creates the monitor.
+func (d *DatadogMonitor) Create() error {
+	d.Printf("creating monitor\n")
+
+	body := datadog.NewMonitor(d.Query, datadog.MonitorType(d.MonitorType))
+	body.SetName(d.Name)
+	body.SetMessage(d.Message)
+	body.SetTags(d.Tags)
+	body.SetOptions(d.monitorOptions())
+
+	monitor, _, err := d.client.MonitorsApi.CreateMonitor(d.ctx, *body)
+	if err != nil {
+		return err
+	}
+	d.monitor = &monitor
+
+	d.Printf("monitor id is %d\n", monitor.GetId())
+
+	return nil
+}
+
+// Delete deletes the monitor.
+func (d *DatadogMonitor) Delete() error {
+	d.Printf("removing monitor %d\n", d.monitor.GetId())
+
+	_, _, err := d.client.MonitorsApi.DeleteMonitor(d.ctx, d.monitor.GetId())
+
+	return err
+}
+
+// monitorOptions returns the monitor options for the Datadog API.
+func (d *DatadogMonitor) monitorOptions() datadog.MonitorOptions {
+	opts := datadog.NewMonitorOptionsWithDefaults()
+	if d.Options == nil {
+		return *opts
+	}
+
+	opts.SetNotifyNoData(d.Options.NotifyNoData)
+	opts.SetIncludeTags(d.Options.IncludeTags)
+
+	if d.Options.NoDataTimeframe != 0 {
+		opts.SetNoDataTimeframe(d.Options.NoDataTimeframe)
+	}
+
+	if d.Options.RenotifyInterval != 0 {
+		opts.SetRenotifyInterval(d.Options.RenotifyInterval)
+	}
+
+	thresholds := datadog.NewMonitorThresholds()
+	if d.Options.Critical != 0 {
+		thresholds.SetCritical(d.Options.Critical)
+	}
+
+	if d.Options.Warning != 0 {
+		thresholds.SetWarning(d.Options.Warning)
+	}
+	opts.SetThresholds(*thresholds)
+
+	return *opts
+}
+
+// isMonitorSynced checks whether the monitor settings are in sync.
+func (d *DatadogMonitor) isMonitorSynced() (bool, error) {
+	if d.monitor == nil {
+		return false, ErrResourceAbsent
+	}
+
+	m := d.monitor
+	if string(m.Type) != d.MonitorType || m.Query != d.Query || m.GetMessage() != d.Message {
+		return false, nil
+	}
+
+	if !utils.SameStrings(d.Tags, m.Tags) {
+		return false, nil
+	}
+
+	if d.Options == nil {
+		return true, nil
+	}
+
+	opts := m.GetOptions()
+	thresholds := opts.GetThresholds()
+	switch {
+	case opts.GetNotifyNoData() != d.Options.NotifyNoData:
+		return false, nil
+	case opts.GetIncludeTags() != d.Options.IncludeTags:
+		return false, nil
+	case d.Options.NoDataTimeframe != 0 && opts.GetNoDataTimeframe() != d.Options.NoDataTimeframe:
+		return false, nil
+	case d.Options.RenotifyInterval != 0 && opts.GetRenotifyInterval() != d.Options.RenotifyInterval:
+		return false, nil
+	case d.Options.Critical != 0 && thresholds.GetCritical() != d.Options.Critical:
+		return false, nil
+	case d.Options.Warning != 0 && thresholds.GetWarning() != d.Options.Warning:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// setMonitor updates the monitor settings.
+func (d *DatadogMonitor) setMonitor() error {
+	d.Printf("updating monitor %d\n", d.monitor.GetId())
+
+	body := datadog.NewMonitorUpdateRequest()
+	body.SetName(d.Name)
+	body.SetType(datadog.MonitorType(d.MonitorType))
+	body.SetQuery(d.Query)
+	body.SetMessage(d.Message)
+	body.SetTags(d.Tags)
+	body.SetOptions(d.monitorOptions())
+
+	monitor, _, err := d.client.MonitorsApi.UpdateMonitor(d.ctx, d.monitor.GetId(), *body)
+	if err != nil {
+		return fmt.Errorf("unable to update monitor: %s", err)
+	}
+	d.monitor = &monitor
+
+	return nil
+}
+
+func init() {
+	monitor := ProviderItem{
+		Type:      "monitor",
+		Provider:  NewDatadogMonitor,
+		Namespace: DatadogNamespace,
+	}
+
+	RegisterProvider(monitor)
+}
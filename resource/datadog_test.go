@@ -0,0 +1,217 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DataDog/datadog-api-client-go/api/v1/datadog"
+)
+
+// fakeDatadog is a minimal implementation of the
+// monitor endpoints of the Datadog API.
+type fakeDatadog struct {
+	sync.Mutex
+	monitors map[int64]map[string]interface{}
+	nextID   int64
+	updated  int
+}
+
+func (d *fakeDatadog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.Lock()
+	defer d.Unlock()
+
+	if r.Header.Get("DD-API-KEY") != "api-key" || r.Header.Get("DD-APPLICATION-KEY") != "app-key" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors": ["Forbidden"]}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v1/monitor/"), 10, 64)
+	monitor, ok := d.monitors[id]
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/api/v1/monitor":
+		found := make([]map[string]interface{}, 0)
+		for _, m := range d.monitors {
+			if strings.Contains(m["name"].(string), r.URL.Query().Get("name")) {
+				found = append(found, m)
+			}
+		}
+		json.NewEncoder(w).Encode(found)
+	case r.Method == "POST" && r.URL.Path == "/api/v1/monitor":
+		var in map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d.nextID++
+		in["id"] = d.nextID
+		d.monitors[d.nextID] = in
+		json.NewEncoder(w).Encode(in)
+	case r.Method == "PUT" && ok:
+		if err := json.NewDecoder(r.Body).Decode(&monitor); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d.updated++
+		json.NewEncoder(w).Encode(monitor)
+	case r.Method == "DELETE" && ok:
+		delete(d.monitors, id)
+		json.NewEncoder(w).Encode(map[string]interface{}{"deleted_monitor_id": id})
+	case !ok:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors": ["Monitor not found"]}`))
+	default:
+		http.Error(w, "unexpected request", http.StatusMethodNotAllowed)
+	}
+}
+
+func TestDatadogMonitor(t *testing.T) {
+	dd := &fakeDatadog{monitors: make(map[int64]map[string]interface{})}
+	ts := httptest.NewServer(dd)
+	defer ts.Close()
+
+	// Monitors are matched by their exact name
+	dd.nextID++
+	dd.monitors[dd.nextID] = map[string]interface{}{
+		"id":    dd.nextID,
+		"name":  "memcached is down in staging",
+		"type":  "service check",
+		"query": "\"process.up\".over(\"env:staging\").last(2).count_by_status()",
+	}
+
+	r, err := NewDatadogMonitor("memcached is down")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := r.(*DatadogMonitor)
+	errorIfNotEqual(t, "metric alert", d.MonitorType)
+
+	if err := d.Validate(); err != ErrNoAPIKey {
+		t.Errorf("want missing api key error, got %v", err)
+	}
+
+	d.APIKey = "api-key"
+	if err := d.Validate(); err != ErrNoAppKey {
+		t.Errorf("want missing app key error, got %v", err)
+	}
+
+	d.AppKey = "app-key"
+	d.MonitorType = "unknown"
+	if err := d.Validate(); err == nil {
+		t.Error("want error for invalid monitor type")
+	}
+
+	d.MonitorType = "service check"
+	if err := d.Validate(); err == nil {
+		t.Error("want error for missing query")
+	}
+
+	d.Query = "\"process.up\".over(\"process:memcached\").last(2).count_by_status()"
+	d.Message = "memcached is down @ops@example.org"
+	d.Tags = []string{"service:memcached", "team:ops"}
+	d.Options = &DatadogMonitorOptions{NotifyNoData: true, NoDataTimeframe: 10}
+	if err := d.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	// Requests are sent to the fake API
+	d.ctx = context.WithValue(d.ctx, datadog.ContextServerIndex, 1)
+	d.ctx = context.WithValue(d.ctx, datadog.ContextServerVariables, map[string]string{
+		"protocol": "http",
+		"name":     strings.TrimPrefix(ts.URL, "http://"),
+	})
+
+	state, err := d.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	_, err = d.isMonitorSynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, int64(2), d.monitor.GetId())
+
+	state, err = d.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+	errorIfNotEqual(t, []string{}, outOfSync(t, d))
+
+	// Tags are compared regardless of their order
+	d.Tags = []string{"team:ops", "service:memcached"}
+	errorIfNotEqual(t, []string{}, outOfSync(t, d))
+
+	d.Tags = []string{"service:memcached"}
+	errorIfNotEqual(t, []string{"monitor"}, outOfSync(t, d))
+
+	d.Tags = []string{"service:memcached", "team:ops"}
+	d.Options.NoDataTimeframe = 20
+	errorIfNotEqual(t, []string{"monitor"}, outOfSync(t, d))
+
+	d.Query = "\"process.up\".over(\"process:memcached\").last(3).count_by_status()"
+	if err := d.Properties()[0].Set(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, 1, dd.updated)
+	errorIfNotEqual(t, d.Query, dd.monitors[2]["query"])
+
+	if _, err := d.Evaluate(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{}, outOfSync(t, d))
+
+	if err := d.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = d.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+	errorIfNotEqual(t, 1, len(dd.monitors))
+}
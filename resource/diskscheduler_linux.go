@@ -0,0 +1,482 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+// +build linux
+
+package resource
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// diskSysfsPath is the sysfs directory containing the block devices
+const diskSysfsPath = "/sys/block"
+
+// diskRulesPath is the udev rules file in which the settings
+// of block devices are persisted.
+const diskRulesPath = "/etc/udev/rules.d/60-scheduler.rules"
+
+// DiskScheduler type is a resource which manages the I/O scheduler,
+// also known as elevator, and queue settings of a block device on a
+// GNU/Linux system.
+//
+// The settings are applied using sysfs, and when persistent, are also
+// written as a udev rule to /etc/udev/rules.d/60-scheduler.rules, so
+// that they are applied again on boot. Setting the state to "absent"
+// removes the udev rule of the device, while the settings in sysfs
+// are kept until the next reboot.
+//
+// Example:
+//   sda = resource.disk_scheduler.new("sda")
+//   sda.scheduler = "mq-deadline"
+//   sda.queue_depth = 256
+//   sda.read_ahead = 4096
+//   sda.persistent = true
+type DiskScheduler struct {
+	Base
+
+	// Device is the name of the block device, e.g. "sda".
+	// Defaults to the resource name.
+	Device string `luar:"device"`
+
+	// Scheduler is the I/O scheduler of the device, e.g.
+	// "mq-deadline", "bfq", "kyber" or "none". If empty
+	// the scheduler is not managed.
+	Scheduler string `luar:"scheduler"`
+
+	// QueueDepth is the number of requests, which can be queued
+	// for the device. If zero the queue depth is not managed.
+	QueueDepth int `luar:"queue_depth"`
+
+	// ReadAhead is the size in kilobytes read ahead on sequential
+	// reads from the device. If zero the read-ahead is not managed.
+	ReadAhead int `luar:"read_ahead"`
+
+	// Persistent specifies whether the settings are written
+	// as a udev rule, so that they persist across reboots.
+	Persistent bool `luar:"persistent"`
+
+	// Directory containing the block devices in sysfs
+	sysfs string `luar:"-"`
+
+	// Path to the udev rules file
+	rules string `luar:"-"`
+}
+
+// NewDiskScheduler creates a new resource for managing
+// the I/O scheduler of a block device.
+func NewDiskScheduler(name string) (Resource, error) {
+	d := &DiskScheduler{
+		Base: Base{
+			Name:              name,
+			Type:              "disk_scheduler",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// The udev rules of all devices are kept in the same file
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		Device: name,
+		sysfs:  diskSysfsPath,
+		rules:  diskRulesPath,
+	}
+
+	d.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "scheduler",
+			PropertySetFunc:      d.setScheduler,
+			PropertyIsSyncedFunc: d.isSchedulerSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "queue_depth",
+			PropertySetFunc:      d.setQueueDepth,
+			PropertyIsSyncedFunc: d.isQueueDepthSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "read_ahead",
+			PropertySetFunc:      d.setReadAhead,
+			PropertyIsSyncedFunc: d.isReadAheadSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "persistent",
+			PropertySetFunc:      d.setRule,
+			PropertyIsSyncedFunc: d.isRuleSynced,
+		},
+	}
+
+	return d, nil
+}
+
+// Validate validates the resource.
+func (d *DiskScheduler) Validate() error {
+	if err := d.Base.Validate(); err != nil {
+		return err
+	}
+
+	d.Device = strings.TrimPrefix(d.Device, "/dev/")
+	if d.Device == "" || strings.ContainsAny(d.Device, "/ \"") {
+		return fmt.Errorf("invalid device '%s'", d.Device)
+	}
+
+	if strings.ContainsAny(d.Scheduler, " \"") {
+		return fmt.Errorf("invalid scheduler '%s'", d.Scheduler)
+	}
+
+	if d.QueueDepth < 0 {
+		return fmt.Errorf("invalid queue depth %d", d.QueueDepth)
+	}
+
+	if d.ReadAhead < 0 {
+		return fmt.Errorf("invalid read-ahead %d", d.ReadAhead)
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the resource. The device must exist,
+// unless the resource is absent, in which case it is considered present
+// as long as the device has a udev rule.
+func (d *DiskScheduler) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    d.State,
+	}
+
+	rule, err := d.currentRule()
+	if err != nil {
+		return state, err
+	}
+
+	if d.State == "absent" {
+		state.Current = "absent"
+		if rule != "" {
+			state.Current = "present"
+		}
+		return state, nil
+	}
+
+	_, err = os.Stat(d.queuePath(""))
+	switch {
+	case os.IsNotExist(err):
+		return state, fmt.Errorf("block device %s not found", d.Device)
+	case err != nil:
+		return state, err
+	}
+
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create applies the settings of the device.
+func (d *DiskScheduler) Create() error {
+	for _, p := range d.PropertyList {
+		if err := p.Set(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the udev rule of the device.
+func (d *DiskScheduler) Delete() error {
+	d.Printf("removing udev rule\n")
+
+	return d.writeRule("")
+}
+
+// queuePath returns the path to a queue attribute of the device in sysfs.
+func (d *DiskScheduler) queuePath(name string) string {
+	return filepath.Join(d.sysfs, d.Device, "queue", name)
+}
+
+// readQueue reads a queue attribute of the device.
+func (d *DiskScheduler) readQueue(name string) (string, error) {
+	data, err := ioutil.ReadFile(d.queuePath(name))
+	if os.IsNotExist(err) {
+		return "", ErrResourceAbsent
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeQueue writes a queue attribute of the device. Attributes in sysfs
+// are written in place, instead of replacing the file.
+func (d *DiskScheduler) writeQueue(name, value string) error {
+	return ioutil.WriteFile(d.queuePath(name), []byte(value), 0644)
+}
+
+// currentScheduler returns the active scheduler of the device, which
+// is the one in brackets, e.g. "[mq-deadline] kyber bfq none", along
+// with the list of available schedulers.
+func (d *DiskScheduler) currentScheduler() (string, []string, error) {
+	value, err := d.readQueue("scheduler")
+	if err != nil {
+		return "", nil, err
+	}
+
+	current := ""
+	available := strings.Fields(value)
+	for i, name := range available {
+		if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+			current = name[1 : len(name)-1]
+			available[i] = current
+		}
+	}
+
+	return current, available, nil
+}
+
+// isSchedulerSynced checks whether the device uses the desired scheduler.
+// The settings of the device are not managed if the resource is absent.
+func (d *DiskScheduler) isSchedulerSynced() (bool, error) {
+	if d.State == "absent" {
+		return false, ErrResourceAbsent
+	}
+
+	if d.Scheduler == "" {
+		return true, nil
+	}
+
+	current, _, err := d.currentScheduler()
+	if err != nil {
+		return false, err
+	}
+
+	return current == d.Scheduler, nil
+}
+
+// setScheduler sets the scheduler of the device, which must be available.
+func (d *DiskScheduler) setScheduler() error {
+	if d.Scheduler == "" {
+		return nil
+	}
+
+	_, available, err := d.currentScheduler()
+	if err != nil {
+		return err
+	}
+
+	if !utils.NewString(d.Scheduler).IsInList(utils.NewList(available...)) {
+		return fmt.Errorf("scheduler %s is not available for %s", d.Scheduler, d.Device)
+	}
+
+	d.Printf("setting scheduler to %s\n", d.Scheduler)
+
+	return d.writeQueue("scheduler", d.Scheduler)
+}
+
+// isQueueDepthSynced checks whether the device has the desired queue depth.
+func (d *DiskScheduler) isQueueDepthSynced() (bool, error) {
+	return d.isQueueSynced("nr_requests", d.QueueDepth)
+}
+
+// setQueueDepth sets the queue depth of the device.
+func (d *DiskScheduler) setQueueDepth() error {
+	if d.QueueDepth == 0 {
+		return nil
+	}
+
+	d.Printf("setting queue depth to %d\n", d.QueueDepth)
+
+	return d.writeQueue("nr_requests", strconv.Itoa(d.QueueDepth))
+}
+
+// isReadAheadSynced checks whether the device has the desired read-ahead.
+func (d *DiskScheduler) isReadAheadSynced() (bool, error) {
+	return d.isQueueSynced("read_ahead_kb", d.ReadAhead)
+}
+
+// setReadAhead sets the read-ahead of the device.
+func (d *DiskScheduler) setReadAhead() error {
+	if d.ReadAhead == 0 {
+		return nil
+	}
+
+	d.Printf("setting read-ahead to %d KB\n", d.ReadAhead)
+
+	return d.writeQueue("read_ahead_kb", strconv.Itoa(d.ReadAhead))
+}
+
+// isQueueSynced checks whether a numeric queue attribute
+// has the desired value, unless it is not managed.
+func (d *DiskScheduler) isQueueSynced(name string, want int) (bool, error) {
+	if d.State == "absent" {
+		return false, ErrResourceAbsent
+	}
+
+	if want == 0 {
+		return true, nil
+	}
+
+	value, err := d.readQueue(name)
+	if err != nil {
+		return false, err
+	}
+
+	return value == strconv.Itoa(want), nil
+}
+
+// rule returns the udev rule applying the settings of the device.
+func (d *DiskScheduler) rule() string {
+	attrs := []string{
+		`ACTION=="add|change"`,
+		fmt.Sprintf(`KERNEL=="%s"`, d.Device),
+	}
+
+	if d.Scheduler != "" {
+		attrs = append(attrs, fmt.Sprintf(`ATTR{queue/scheduler}="%s"`, d.Scheduler))
+	}
+
+	// The queue depth depends on the scheduler,
+	// so it must be set after the scheduler
+	if d.QueueDepth != 0 {
+		attrs = append(attrs, fmt.Sprintf(`ATTR{queue/nr_requests}="%d"`, d.QueueDepth))
+	}
+
+	if d.ReadAhead != 0 {
+		attrs = append(attrs, fmt.Sprintf(`ATTR{queue/read_ahead_kb}="%d"`, d.ReadAhead))
+	}
+
+	return strings.Join(attrs, ", ")
+}
+
+// isDeviceRule returns a boolean indicating whether
+// a line of the rules file is the rule of the device.
+func (d *DiskScheduler) isDeviceRule(line string) bool {
+	return strings.Contains(line, fmt.Sprintf(`KERNEL=="%s"`, d.Device))
+}
+
+// currentRule returns the udev rule of the device, if any.
+func (d *DiskScheduler) currentRule() (string, error) {
+	data, err := ioutil.ReadFile(d.rules)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if d.isDeviceRule(line) {
+			return line, nil
+		}
+	}
+
+	return "", nil
+}
+
+// isRuleSynced checks whether the device has the desired udev rule.
+func (d *DiskScheduler) isRuleSynced() (bool, error) {
+	if d.State == "absent" {
+		return false, ErrResourceAbsent
+	}
+
+	rule, err := d.currentRule()
+	if err != nil {
+		return false, err
+	}
+
+	if !d.Persistent {
+		return rule == "", nil
+	}
+
+	return rule == d.rule(), nil
+}
+
+// setRule writes or removes the udev rule of the device.
+func (d *DiskScheduler) setRule() error {
+	if !d.Persistent {
+		d.Printf("removing udev rule\n")
+		return d.writeRule("")
+	}
+
+	d.Printf("writing udev rule\n")
+
+	return d.writeRule(d.rule())
+}
+
+// writeRule replaces the udev rule of the device in the rules file,
+// keeping the rules of other devices, and reloads the udev rules.
+// An empty rule removes the rule of the device.
+func (d *DiskScheduler) writeRule(rule string) error {
+	data, err := ioutil.ReadFile(d.rules)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	lines := []string{"# Managed by gru, do not edit"}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" || line == lines[0] || d.isDeviceRule(line) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if rule != "" {
+		lines = append(lines, rule)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.rules), 0755); err != nil {
+		return err
+	}
+
+	if err := writeFile(d.rules, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+
+	spec := utils.CommandSpec{Args: []string{"udevadm", "control", "--reload-rules"}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("udevadm failed: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "disk_scheduler",
+		Provider:  NewDiskScheduler,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+// +build linux
+
+package resource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestDiskScheduler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	queue := filepath.Join(dir, "block", "sda", "queue")
+	if err := os.MkdirAll(queue, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := map[string]string{
+		"scheduler":     "[mq-deadline] kyber bfq none\n",
+		"nr_requests":   "64\n",
+		"read_ahead_kb": "128\n",
+	}
+	for name, value := range attrs {
+		if err := ioutil.WriteFile(filepath.Join(queue, name), []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rules := filepath.Join(dir, "rules.d", "60-scheduler.rules")
+	other := `ACTION=="add|change", KERNEL=="sdb", ATTR{queue/scheduler}="none"`
+	if err := os.MkdirAll(filepath.Dir(rules), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(rules, []byte(other+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake the commands being executed
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	L := newLuaState()
+	defer L.Close()
+
+	code := `
+	sda = resource.disk_scheduler.new("sda")
+	sda.scheduler = "bfq"
+	sda.queue_depth = 256
+	sda.read_ahead = 4096
+	sda.persistent = true
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	d := luaResource(L, "sda").(*DiskScheduler)
+	d.sysfs = filepath.Join(dir, "block")
+	d.rules = rules
+	if err := d.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := d.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+	errorIfNotEqual(t, []string{"scheduler", "queue_depth", "read_ahead", "persistent"}, outOfSync(t, d))
+
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sysfs files keep the written value in tests, so fake the
+	// kernel reporting the active scheduler
+	data, err := ioutil.ReadFile(filepath.Join(queue, "scheduler"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "bfq", string(data))
+	if err := ioutil.WriteFile(filepath.Join(queue, "scheduler"), []byte("mq-deadline kyber [bfq] none\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{}, outOfSync(t, d))
+	errorIfNotEqual(t, []string{"udevadm control --reload-rules"}, commands)
+
+	content, err := ioutil.ReadFile(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Managed by gru, do not edit\n" + other + "\n" +
+		`ACTION=="add|change", KERNEL=="sda", ATTR{queue/scheduler}="bfq", ATTR{queue/nr_requests}="256", ATTR{queue/read_ahead_kb}="4096"` + "\n"
+	errorIfNotEqual(t, want, string(content))
+
+	// Schedulers which are not available are rejected
+	d.Scheduler = "cfq"
+	if err := d.setScheduler(); err == nil {
+		t.Error("want error for unavailable scheduler")
+	}
+
+	// Absent resources remove the udev rule only
+	d.State = "absent"
+	state, err = d.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+
+	if err := d.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err = ioutil.ReadFile(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "# Managed by gru, do not edit\n"+other+"\n", string(content))
+
+	state, err = d.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	_, err = d.isSchedulerSynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	// Missing devices are reported
+	d.State = "present"
+	d.Device = "sdz"
+	if _, err := d.Evaluate(); err == nil {
+		t.Error("want error for missing device")
+	}
+}
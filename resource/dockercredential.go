@@ -0,0 +1,316 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// ErrNoCredentials error is returned when no username
+// or password of a Docker registry is provided.
+var ErrNoCredentials = errors.New("No username or password provided")
+
+// DockerCredential type is a resource which manages the credentials
+// of a Docker registry in the ~/.docker/config.json file of a user.
+// The resource name is the registry, e.g. "ghcr.io". Other settings
+// and registries in the file are left untouched.
+//
+// Example:
+//   cred = resource.docker_credential.new("ghcr.io")
+//   cred.state = "present"
+//   cred.username = "deploy"
+//   cred.password = secret("vault:secret/docker#password")
+//   cred.user = "deploy"
+type DockerCredential struct {
+	Base
+
+	// Registry is the address of the registry as used by docker
+	// login, e.g. "https://index.docker.io/v1/" for Docker Hub.
+	// Defaults to the resource name.
+	Registry string `luar:"registry"`
+
+	// Username used to authenticate to the registry. Required.
+	Username string `luar:"username"`
+
+	// Password used to authenticate to the registry. Required.
+	Password string `luar:"password" gru:"sensitive"`
+
+	// User whose Docker configuration is managed.
+	// Defaults to the user running gru.
+	User string `luar:"user"`
+
+	// Path to the Docker configuration file, which is
+	// determined from the home directory of the user
+	configFile string `luar:"-"`
+
+	// Ids of the user owning the configuration file,
+	// -1 if the ownership is not changed
+	uid, gid int `luar:"-"`
+}
+
+// NewDockerCredential creates a resource for managing
+// the credentials of a Docker registry.
+func NewDockerCredential(name string) (Resource, error) {
+	d := &DockerCredential{
+		Base: Base{
+			Name:              name,
+			Type:              "docker_credential",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// Credentials of all registries are kept in the same file
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		Registry: name,
+		uid:      -1,
+		gid:      -1,
+	}
+
+	d.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "credentials",
+			PropertySetFunc:      d.setCredentials,
+			PropertyIsSyncedFunc: d.isCredentialsSynced,
+		},
+	}
+
+	return d, nil
+}
+
+// Validate validates the resource.
+func (d *DockerCredential) Validate() error {
+	if err := d.Base.Validate(); err != nil {
+		return err
+	}
+
+	if d.Registry == "" {
+		return fmt.Errorf("invalid registry '%s'", d.Registry)
+	}
+
+	if d.State == "present" && (d.Username == "" || d.Password == "") {
+		return ErrNoCredentials
+	}
+
+	return nil
+}
+
+// Initialize determines the configuration file from the home
+// directory of the user, which owns the file if it is created.
+func (d *DockerCredential) Initialize() error {
+	if d.User == "" {
+		u, err := DefaultConfig.UserCache.Current()
+		if err != nil {
+			return err
+		}
+		d.configFile = filepath.Join(u.HomeDir, ".docker", "config.json")
+
+		return nil
+	}
+
+	u, err := DefaultConfig.UserCache.Lookup(d.User)
+	if err != nil {
+		return err
+	}
+
+	if u.HomeDir == "" {
+		return fmt.Errorf("user %s has no home directory", d.User)
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return ErrOwnershipNotSupported
+	}
+
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return ErrOwnershipNotSupported
+	}
+
+	d.configFile = filepath.Join(u.HomeDir, ".docker", "config.json")
+	d.uid, d.gid = uid, gid
+
+	return nil
+}
+
+// Evaluate evaluates the state of the registry credentials.
+func (d *DockerCredential) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    d.State,
+	}
+
+	config, err := d.readConfig()
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "absent"
+	if _, ok := dockerAuths(config)[d.Registry]; ok {
+		state.Current = "present"
+	}
+
+	return state, nil
+}
+
+// Create adds the registry credentials.
+func (d *DockerCredential) Create() error {
+	d.Printf("adding credentials for %s\n", d.Username)
+
+	return d.updateConfig(func(auths map[string]interface{}) {
+		auths[d.Registry] = map[string]interface{}{"auth": d.auth()}
+	})
+}
+
+// Delete removes the registry credentials.
+func (d *DockerCredential) Delete() error {
+	d.Printf("removing credentials\n")
+
+	return d.updateConfig(func(auths map[string]interface{}) {
+		delete(auths, d.Registry)
+	})
+}
+
+// auth returns the encoded credentials as stored by docker login.
+func (d *DockerCredential) auth() string {
+	return base64.StdEncoding.EncodeToString([]byte(d.Username + ":" + d.Password))
+}
+
+// isCredentialsSynced checks whether the stored
+// credentials match the desired ones.
+func (d *DockerCredential) isCredentialsSynced() (bool, error) {
+	if d.State == "absent" {
+		return false, ErrResourceAbsent
+	}
+
+	config, err := d.readConfig()
+	if err != nil {
+		return false, err
+	}
+
+	entry, ok := dockerAuths(config)[d.Registry].(map[string]interface{})
+	if !ok {
+		return false, ErrResourceAbsent
+	}
+
+	return entry["auth"] == d.auth(), nil
+}
+
+// setCredentials replaces the stored credentials.
+func (d *DockerCredential) setCredentials() error {
+	d.Printf("updating credentials for %s\n", d.Username)
+
+	return d.updateConfig(func(auths map[string]interface{}) {
+		auths[d.Registry] = map[string]interface{}{"auth": d.auth()}
+	})
+}
+
+// readConfig reads the Docker configuration file. An empty
+// configuration is returned if the file does not exist.
+func (d *DockerCredential) readConfig() (map[string]interface{}, error) {
+	config := make(map[string]interface{})
+	data, err := ioutil.ReadFile(d.configFile)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The content is not part of the error, as it contains credentials
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid Docker configuration %s", d.configFile)
+	}
+
+	return config, nil
+}
+
+// updateConfig updates the registries in the Docker configuration
+// file, which is created readable by the user only if needed.
+func (d *DockerCredential) updateConfig(update func(auths map[string]interface{})) error {
+	config, err := d.readConfig()
+	if err != nil {
+		return err
+	}
+
+	auths := dockerAuths(config)
+	update(auths)
+	config["auths"] = auths
+
+	data, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(d.configFile)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		if d.uid != -1 {
+			if err := utils.ChownPaths([]string{dir}, d.uid, d.gid, utils.ChownOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := utils.WriteFileAtomic(DefaultConfig.fileSystem(), d.configFile, append(data, '\n'), 0600, d.uid, d.gid); err != nil {
+		return err
+	}
+	DefaultConfig.BytesWritten.Add(int64(len(data) + 1))
+
+	return nil
+}
+
+// dockerAuths returns the registries of a Docker configuration.
+func dockerAuths(config map[string]interface{}) map[string]interface{} {
+	auths, ok := config["auths"].(map[string]interface{})
+	if !ok {
+		return make(map[string]interface{})
+	}
+
+	return auths
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "docker_credential",
+		Provider:  NewDockerCredential,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDockerCredential(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	L := newLuaState()
+	defer L.Close()
+
+	code := `
+	cred = resource.docker_credential.new("ghcr.io")
+	cred.username = "deploy"
+	cred.password = "s3cr3t"
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	d := luaResource(L, "cred").(*DockerCredential)
+	if err := d.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	d.configFile = filepath.Join(dir, ".docker", "config.json")
+
+	var buf bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&buf, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	state, err := d.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = d.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+	errorIfNotEqual(t, []string{}, outOfSync(t, d))
+
+	fi, err := os.Stat(d.configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, os.FileMode(0600), fi.Mode().Perm())
+
+	// Other settings and registries are preserved
+	other := `{"auths": {"docker.io": {"auth": "b3RoZXI6b3RoZXI="}}, "credsStore": "pass"}`
+	if err := ioutil.WriteFile(d.configFile, []byte(other), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = d.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Password = "changed"
+	errorIfNotEqual(t, []string{"credentials"}, outOfSync(t, d))
+	if err := d.setCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{}, outOfSync(t, d))
+
+	config, err := d.readConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "pass", config["credsStore"])
+	errorIfNotEqual(t, map[string]interface{}{
+		"docker.io": map[string]interface{}{"auth": "b3RoZXI6b3RoZXI="},
+		"ghcr.io":   map[string]interface{}{"auth": "ZGVwbG95OmNoYW5nZWQ="},
+	}, config["auths"])
+
+	// Deleting removes the registry only
+	if err := d.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(d.configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = make(map[string]interface{})
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, 1, len(dockerAuths(config)))
+
+	// Passwords are never logged
+	for _, secret := range []string{"s3cr3t", "changed", d.auth()} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("want password not logged, got %q", buf.String())
+		}
+	}
+
+	// Credentials are required unless absent
+	d.Password = ""
+	if err := d.Validate(); err != ErrNoCredentials {
+		t.Errorf("want ErrNoCredentials, got %v", err)
+	}
+	d.State = "absent"
+	if err := d.Validate(); err != nil {
+		t.Error(err)
+	}
+}
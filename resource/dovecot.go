@@ -0,0 +1,466 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// dovecotConfigDir is the directory containing the
+// Dovecot configuration files included by dovecot.conf.
+const dovecotConfigDir = "/etc/dovecot/conf.d"
+
+// dovecotKeyRegexp matches valid setting names and block headers,
+// e.g. "mail_location", "protocol imap" or "namespace inbox".
+var dovecotKeyRegexp = regexp.MustCompile(`^[a-zA-Z0-9_/.-]+( [^{}=#\s]+)?$`)
+
+// DovecotConfig type is a resource which manages Dovecot
+// configuration files in /etc/dovecot/conf.d.
+//
+// The configuration file is named after the resource and contains only
+// the given settings. Nested tables are rendered as blocks, e.g.
+// "protocol imap { ... }", and lists as space separated values. The
+// configuration is validated using doveconf(1) after it has been
+// changed, and the previous configuration is restored if it is not
+// valid. Dovecot is reloaded once the new configuration is in place.
+//
+// Example:
+//   mail = resource.dovecot_config.new("90-mail")
+//   mail.state = "present"
+//   mail.settings = {
+//     mail_location = "maildir:~/Maildir",
+//     mail_plugins = { "quota" },
+//     ["protocol imap"] = {
+//       mail_plugins = "$mail_plugins imap_quota",
+//     },
+//   }
+type DovecotConfig struct {
+	Base
+
+	// Settings of the configuration file. Values are either
+	// strings, numbers, booleans, lists or nested tables for blocks.
+	Settings map[string]interface{} `luar:"settings"`
+
+	// The directory containing the configuration file
+	configDir string `luar:"-"`
+}
+
+// NewDovecotConfig creates a new resource for managing
+// Dovecot configuration files.
+func NewDovecotConfig(name string) (Resource, error) {
+	d := &DovecotConfig{
+		Base: Base{
+			Name:              name,
+			Type:              "dovecot_config",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// The configuration is validated and reloaded as a whole
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		Settings:  make(map[string]interface{}),
+		configDir: dovecotConfigDir,
+	}
+
+	d.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "settings",
+			PropertySetFunc:      d.setSettings,
+			PropertyIsSyncedFunc: d.isSettingsSynced,
+		},
+	}
+
+	return d, nil
+}
+
+// Validate validates the resource.
+func (d *DovecotConfig) Validate() error {
+	if err := d.Base.Validate(); err != nil {
+		return err
+	}
+
+	if d.Name == "" || strings.ContainsAny(d.Name, "/\\") || strings.HasPrefix(d.Name, ".") {
+		return fmt.Errorf("invalid configuration file name '%s'", d.Name)
+	}
+
+	if _, err := normalizeDovecotSettings(d.Settings); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// path returns the path to the configuration file.
+func (d *DovecotConfig) path() string {
+	return filepath.Join(d.configDir, d.Name+".conf")
+}
+
+// Evaluate evaluates the state of the configuration file.
+func (d *DovecotConfig) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    d.State,
+	}
+
+	fi, err := os.Stat(d.path())
+	if os.IsNotExist(err) {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return state, errors.New("path exists, but is not a regular file")
+	}
+
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create creates the configuration file.
+func (d *DovecotConfig) Create() error {
+	d.Printf("creating %s\n", d.path())
+
+	return d.writeConfig()
+}
+
+// Delete removes the configuration file.
+func (d *DovecotConfig) Delete() error {
+	d.Printf("removing %s\n", d.path())
+
+	previous, err := ioutil.ReadFile(d.path())
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(d.path()); err != nil {
+		return err
+	}
+
+	if err := d.validate(); err != nil {
+		if restoreErr := writeFile(d.path(), previous, 0644); restoreErr != nil {
+			return fmt.Errorf("%s, unable to restore %s: %s", err, d.path(), restoreErr)
+		}
+		return err
+	}
+
+	return d.reload()
+}
+
+// isSettingsSynced checks whether the settings in the
+// configuration file are in sync.
+func (d *DovecotConfig) isSettingsSynced() (bool, error) {
+	data, err := ioutil.ReadFile(d.path())
+	if os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	current, err := parseDovecotConfig(data)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse %s: %s", d.path(), err)
+	}
+
+	want, err := normalizeDovecotSettings(d.Settings)
+	if err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(current, want), nil
+}
+
+// setSettings updates the settings in the configuration file.
+func (d *DovecotConfig) setSettings() error {
+	d.Printf("updating %s\n", d.path())
+
+	return d.writeConfig()
+}
+
+// writeConfig writes the configuration file, validates the
+// resulting configuration and reloads Dovecot. The previous
+// configuration file is restored if validation fails.
+func (d *DovecotConfig) writeConfig() error {
+	settings, err := normalizeDovecotSettings(d.Settings)
+	if err != nil {
+		return err
+	}
+
+	previous, err := ioutil.ReadFile(d.path())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	existed := err == nil
+
+	if err := os.MkdirAll(d.configDir, 0755); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Managed by gru, do not edit\n")
+	renderDovecotSettings(&buf, settings, "")
+	if err := writeFile(d.path(), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	if err := d.validate(); err != nil {
+		var restoreErr error
+		if existed {
+			restoreErr = writeFile(d.path(), previous, 0644)
+		} else {
+			restoreErr = os.Remove(d.path())
+		}
+
+		if restoreErr != nil {
+			return fmt.Errorf("%s, unable to restore %s: %s", err, d.path(), restoreErr)
+		}
+		return err
+	}
+
+	return d.reload()
+}
+
+// validate validates the Dovecot configuration using doveconf(1).
+func (d *DovecotConfig) validate() error {
+	spec := utils.CommandSpec{Args: []string{"doveconf", "-n"}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("invalid dovecot configuration: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+// reload reloads the Dovecot configuration.
+func (d *DovecotConfig) reload() error {
+	d.Printf("reloading dovecot\n")
+
+	spec := utils.CommandSpec{Args: []string{"doveadm", "reload"}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("unable to reload dovecot: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+// normalizeDovecotSettings converts the settings into a map, which
+// values are either strings or nested maps for blocks, so that they
+// can be compared with the parsed settings of a configuration file.
+func normalizeDovecotSettings(settings interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+
+	set := func(key, value interface{}) error {
+		name, ok := key.(string)
+		if !ok || !dovecotKeyRegexp.MatchString(name) {
+			return fmt.Errorf("invalid setting name '%v'", key)
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}, map[interface{}]interface{}:
+			block, err := normalizeDovecotSettings(v)
+			if err != nil {
+				return err
+			}
+			result[name] = block
+			return nil
+		}
+
+		if strings.Contains(name, " ") {
+			return fmt.Errorf("invalid setting name '%s'", name)
+		}
+
+		s, err := dovecotValue(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for setting %s: %s", name, err)
+		}
+		result[name] = s
+
+		return nil
+	}
+
+	switch v := settings.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if err := set(key, value); err != nil {
+				return nil, err
+			}
+		}
+	case map[interface{}]interface{}:
+		for key, value := range v {
+			if err := set(key, value); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid settings %v", settings)
+	}
+
+	return result, nil
+}
+
+// dovecotValue converts a setting value to its string representation.
+func dovecotValue(value interface{}) (string, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case bool:
+		s = "no"
+		if v {
+			s = "yes"
+		}
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		s = strconv.Itoa(v)
+	case []string:
+		s = strings.Join(v, " ")
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			str, err := dovecotValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, str)
+		}
+		s = strings.Join(items, " ")
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+
+	if strings.ContainsAny(s, "\n\r{}") {
+		return "", fmt.Errorf("value '%s' contains invalid characters", s)
+	}
+
+	return strings.TrimSpace(s), nil
+}
+
+// renderDovecotSettings writes the settings in the Dovecot
+// configuration format, with the settings preceding the blocks.
+func renderDovecotSettings(buf *bytes.Buffer, settings map[string]interface{}, indent string) {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if value, ok := settings[key].(string); ok {
+			fmt.Fprintf(buf, "%s%s = %s\n", indent, key, value)
+		}
+	}
+
+	for _, key := range keys {
+		if block, ok := settings[key].(map[string]interface{}); ok {
+			fmt.Fprintf(buf, "%s%s {\n", indent, key)
+			renderDovecotSettings(buf, block, indent+"  ")
+			fmt.Fprintf(buf, "%s}\n", indent)
+		}
+	}
+}
+
+// parseDovecotConfig parses the settings and blocks of a Dovecot
+// configuration file. Comments and includes are ignored.
+func parseDovecotConfig(data []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	stack := []map[string]interface{}{root}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!include") {
+			continue
+		}
+
+		current := stack[len(stack)-1]
+		switch {
+		case line == "}":
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("line %d: unexpected '}'", lineno)
+			}
+			stack = stack[:len(stack)-1]
+		case strings.HasSuffix(line, "{"):
+			name := strings.Join(strings.Fields(strings.TrimSuffix(line, "{")), " ")
+			block, ok := current[name].(map[string]interface{})
+			if !ok {
+				block = make(map[string]interface{})
+				current[name] = block
+			}
+			stack = append(stack, block)
+		case strings.Contains(line, "="):
+			parts := strings.SplitN(line, "=", 2)
+			current[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		default:
+			return nil, fmt.Errorf("line %d: unable to parse '%s'", lineno, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(stack) != 1 {
+		return nil, errors.New("unterminated block")
+	}
+
+	return root, nil
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "dovecot_config",
+		Provider:  NewDovecotConfig,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestDovecotConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-dovecot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	var commands []string
+	valid := true
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		if spec.Args[0] == "doveconf" && !valid {
+			return utils.CommandResult{Stderr: []byte("Unknown setting: mail_plugin\n"), ExitCode: 89}, errors.New("exit status 89")
+		}
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	r, err := NewDovecotConfig("90-mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := r.(*DovecotConfig)
+	d.configDir = dir
+	d.Settings = map[string]interface{}{
+		"mail_location":               "maildir:~/Maildir",
+		"mail_plugins":                []interface{}{"quota", "acl"},
+		"mail_max_userip_connections": float64(20),
+		"protocol imap": map[interface{}]interface{}{
+			"mail_plugins":              "$mail_plugins imap_quota",
+			"imap_idle_notify_interval": "2 mins",
+		},
+	}
+	if err := d.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := d.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if _, err := d.isSettingsSynced(); err != ErrResourceAbsent {
+		t.Errorf("want ErrResourceAbsent, got %v", err)
+	}
+
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "90-mail.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# Managed by gru, do not edit
+mail_location = maildir:~/Maildir
+mail_max_userip_connections = 20
+mail_plugins = quota acl
+protocol imap {
+  imap_idle_notify_interval = 2 mins
+  mail_plugins = $mail_plugins imap_quota
+}
+`
+	errorIfNotEqual(t, want, string(data))
+	errorIfNotEqual(t, []string{"doveconf -n", "doveadm reload"}, commands)
+
+	synced, err := d.isSettingsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	// Formatting and comments do not affect the comparison
+	edited := `# Local notes
+protocol   imap {
+	mail_plugins =   $mail_plugins imap_quota
+	imap_idle_notify_interval = 2 mins
+}
+mail_plugins = quota acl
+mail_location = maildir:~/Maildir
+mail_max_userip_connections = 20
+`
+	if err := ioutil.WriteFile(d.path(), []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	synced, err = d.isSettingsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	// An invalid configuration is reverted
+	commands = nil
+	valid = false
+	d.Settings["mail_plugin"] = "quota"
+	err = d.setSettings()
+	if err == nil || !strings.Contains(err.Error(), "Unknown setting: mail_plugin") {
+		t.Errorf("want validation error, got %v", err)
+	}
+	errorIfNotEqual(t, []string{"doveconf -n"}, commands)
+
+	data, err = ioutil.ReadFile(d.path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, edited, string(data))
+
+	// A valid change is written
+	valid = true
+	delete(d.Settings, "mail_plugin")
+	d.Settings["mail_location"] = "mdbox:~/mdbox"
+	synced, err = d.isSettingsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := d.setSettings(); err != nil {
+		t.Fatal(err)
+	}
+
+	synced, err = d.isSettingsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	commands = nil
+	if err := d.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"doveconf -n", "doveadm reload"}, commands)
+
+	state, err = d.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+}
+
+func TestDovecotConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		ok       bool
+	}{
+		{"10-auth", map[string]interface{}{"disable_plaintext_auth": true}, true},
+		{"../auth", map[string]interface{}{}, false},
+		{"10-auth", map[string]interface{}{"bad key": "value"}, false},
+		{"10-auth", map[string]interface{}{"key": "multi\nline"}, false},
+		{"10-auth", map[string]interface{}{"passdb": map[string]interface{}{"driver": []interface{}{map[string]interface{}{}}}}, false},
+	}
+
+	for _, test := range tests {
+		r, err := NewDovecotConfig(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := r.(*DovecotConfig)
+		d.Settings = test.settings
+		err = d.Validate()
+		if test.ok != (err == nil) {
+			t.Errorf("%s %v: want valid %t, got %v", test.name, test.settings, test.ok, err)
+		}
+	}
+}
+
+func TestParseDovecotConfig(t *testing.T) {
+	data := []byte(`!include auth-system.conf.ext
+passdb {
+  driver = pam
+}
+passdb {
+  args = session=yes
+}
+service imap-login {
+  inet_listener imaps {
+    port = 993
+  }
+}
+`)
+
+	got, err := parseDovecotConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"passdb": map[string]interface{}{
+			"driver": "pam",
+			"args":   "session=yes",
+		},
+		"service imap-login": map[string]interface{}{
+			"inet_listener imaps": map[string]interface{}{
+				"port": "993",
+			},
+		},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if _, err := parseDovecotConfig([]byte("passdb {\n")); err == nil {
+		t.Error("want error for unterminated block")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"strings"
+	"time"
+)
+
+// Actions taken for resources, as reported in resource events
+const (
+	// ActionNone is used when the resource was in sync
+	ActionNone = "none"
+
+	// ActionCreate is used when the resource was created
+	ActionCreate = "create"
+
+	// ActionDelete is used when the resource was deleted
+	ActionDelete = "delete"
+
+	// ActionRecreate is used when the resource was
+	// deleted and created again
+	ActionRecreate = "recreate"
+
+	// ActionUpdate is used when only the properties
+	// of the resource were updated
+	ActionUpdate = "update"
+)
+
+// ResourceEvent type represents an event emitted
+// after a resource has been processed.
+type ResourceEvent struct {
+	// Timestamp is the time the resource was processed
+	Timestamp time.Time `json:"timestamp"`
+
+	// ResourceType is the type of the resource
+	ResourceType string `json:"resource_type"`
+
+	// ResourceTitle is the name of the resource
+	ResourceTitle string `json:"resource_title"`
+
+	// Action taken for the resource, e.g. "create"
+	Action string `json:"action"`
+
+	// Changed specifies whether the resource has changed
+	Changed bool `json:"changed"`
+
+	// SiteRevision is the revision of the site repo, from
+	// which the resource was applied, if known
+	SiteRevision string `json:"site_revision,omitempty"`
+}
+
+// EventSink is the interface type for sending resource
+// events to other systems, e.g. message queues.
+type EventSink interface {
+	// Emit sends a single resource event
+	Emit(event ResourceEvent) error
+}
+
+// NewResourceEvent creates a new event for a processed resource.
+// The type and name of the resource are taken from its id.
+func NewResourceEvent(r Resource, action string, changed bool) ResourceEvent {
+	id := r.ID()
+	event := ResourceEvent{
+		Timestamp:    time.Now(),
+		ResourceType: id,
+		Action:       action,
+		Changed:      changed,
+	}
+
+	if i := strings.Index(id, "["); i != -1 && strings.HasSuffix(id, "]") {
+		event.ResourceType = id[:i]
+		event.ResourceTitle = id[i+1 : len(id)-1]
+	}
+
+	return event
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// absentDetail is the detail of checks, which were not
+// performed because the resource is absent.
+const absentDetail = "not evaluated, resource is absent"
+
+// Check type contains a single check performed when evaluating a
+// resource, along with the observed and the desired values.
+type Check struct {
+	// Name of the check, usually the name of a property
+	Name string `json:"name"`
+
+	// Observed value on the system, if known
+	Observed string `json:"observed,omitempty"`
+
+	// Desired value of the resource, if known
+	Desired string `json:"desired,omitempty"`
+
+	// InSync specifies whether the observed value matches the desired one
+	InSync bool `json:"in_sync"`
+
+	// Detail contains any additional information about the check,
+	// e.g. which of multiple acceptable sources was matched
+	Detail string `json:"detail,omitempty"`
+}
+
+// Guard type contains the result of a condition, which
+// determines whether a resource is processed at all.
+type Guard struct {
+	// Name of the guard, usually the name of an attribute
+	Name string `json:"name"`
+
+	// Condition which must hold for the resource to be processed
+	Condition string `json:"condition"`
+
+	// Passed specifies whether the condition holds
+	Passed bool `json:"passed"`
+}
+
+// Explainer is the interface type for resources, which describe
+// the checks performed when evaluating their properties in more
+// detail than whether they are in sync. Implementing it is optional.
+type Explainer interface {
+	// Explain returns the checks performed for the
+	// properties of the resource
+	Explain() ([]Check, error)
+}
+
+// Guarder is the interface type for resources, which are processed
+// only if certain conditions hold. Implementing it is optional.
+type Guarder interface {
+	// Guards returns the conditions evaluated for the resource
+	Guards() ([]Guard, error)
+}
+
+// Explain evaluates a resource and returns the checks performed,
+// starting with the state of the resource. Properties are
+// explained only if the resource should be present. The resource
+// must have been validated and initialized.
+func Explain(r Resource) ([]Check, error) {
+	state, err := r.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+
+	want := utils.NewString(state.Want)
+	current := utils.NewString(state.Current)
+	present := utils.NewList(r.PresentStates()...)
+	absent := utils.NewList(r.AbsentStates()...)
+
+	checks := []Check{
+		{
+			Name:     "state",
+			Observed: state.Current,
+			Desired:  state.Want,
+			InSync:   state.Current == state.Want || (want.IsInList(present) && current.IsInList(present)) || (want.IsInList(absent) && current.IsInList(absent)),
+		},
+	}
+
+	if want.IsInList(absent) {
+		return checks, nil
+	}
+
+	if e, ok := r.(Explainer); ok {
+		explained, err := e.Explain()
+		return append(checks, explained...), err
+	}
+
+	explained, err := explainProperties(r.Properties())
+
+	return append(checks, explained...), err
+}
+
+// explainProperties returns a check for each of the given
+// properties, indicating only whether the property is in sync.
+func explainProperties(properties []Property) ([]Check, error) {
+	checks := make([]Check, 0, len(properties))
+	for _, p := range properties {
+		synced, err := p.IsSynced()
+		if err == ErrResourceAbsent {
+			checks = append(checks, Check{Name: p.Name(), Detail: absentDetail})
+			continue
+		}
+
+		if err != nil {
+			return checks, fmt.Errorf("unable to evaluate property %s: %s", p.Name(), err)
+		}
+
+		checks = append(checks, Check{Name: p.Name(), InSync: synced})
+	}
+
+	return checks, nil
+}
+
+// DefaultAttributes returns the sorted names of the attributes of a
+// resource, which still have the default value set by the provider
+// of the resource type, i.e. which have not been declared.
+func DefaultAttributes(r Resource) ([]string, error) {
+	id := r.ID()
+	i := strings.Index(id, "[")
+	if i == -1 || !strings.HasSuffix(id, "]") {
+		return nil, fmt.Errorf("invalid resource id %s", id)
+	}
+	typ, name := id[:i], id[i+1:len(id)-1]
+
+	for _, item := range providerRegistry {
+		if item.Type != typ {
+			continue
+		}
+
+		fresh, err := item.Provider(name)
+		if err != nil {
+			return nil, err
+		}
+
+		defaults := Attributes(fresh)
+		names := make([]string, 0)
+		for name, value := range Attributes(r) {
+			if def, ok := defaults[name]; ok && reflect.DeepEqual(value, def) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		return names, nil
+	}
+
+	return nil, fmt.Errorf("unknown resource type %s", typ)
+}
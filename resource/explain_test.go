@@ -0,0 +1,192 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestExplainFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-explain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{"new": "new\n", "old": "old\n"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldSiteRepo := DefaultConfig.SiteRepo
+	DefaultConfig.SiteRepo = dir
+	defer func() { DefaultConfig.SiteRepo = oldSiteRepo }()
+
+	path := filepath.Join(dir, "dst")
+	r, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := r.(*File)
+	f.Source = []interface{}{"new", "old"}
+	if err := f.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Properties are not evaluated while the file is absent
+	checks, err := Explain(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Check{
+		{Name: "state", Observed: "absent", Desired: "present"},
+		{Name: "mode", Desired: "0644", Detail: absentDetail},
+		{Name: "ownership", Desired: checks[2].Desired, Detail: absentDetail},
+		{Name: "content", Detail: absentDetail},
+	}
+	errorIfNotEqual(t, want, checks)
+
+	desired := fmt.Sprintf("md5:%x", md5.Sum([]byte("new\n")))
+	testCases := []struct {
+		content string
+		synced  bool
+		detail  string
+	}{
+		{"new\n", true, "matches canonical source new"},
+		{"old\n", true, "matches acceptable source old instead of canonical source new"},
+		{"other\n", false, "matches no source, canonical source new would be written"},
+	}
+
+	for _, tc := range testCases {
+		if err := ioutil.WriteFile(path, []byte(tc.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		checks, err := Explain(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(checks) != 4 {
+			t.Fatalf("content %q: want 4 checks, got %d", tc.content, len(checks))
+		}
+
+		errorIfNotEqual(t, Check{Name: "state", Observed: "present", Desired: "present", InSync: true}, checks[0])
+		errorIfNotEqual(t, Check{Name: "mode", Observed: "0600", Desired: "0644"}, checks[1])
+		errorIfNotEqual(t, true, checks[2].InSync)
+		errorIfNotEqual(t, checks[2].Desired, checks[2].Observed)
+
+		observed := fmt.Sprintf("md5:%x", md5.Sum([]byte(tc.content)))
+		errorIfNotEqual(t, Check{Name: "content", Observed: observed, Desired: desired, InSync: tc.synced, Detail: tc.detail}, checks[3])
+	}
+
+	// Properties are not explained when the file should be absent
+	f.State = "absent"
+	checks, err = Explain(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []Check{{Name: "state", Observed: "present", Desired: "absent"}}, checks)
+}
+
+func TestExplainProperties(t *testing.T) {
+	synced := true
+	properties := []Property{
+		&ResourceProperty{
+			PropertyName:         "foo",
+			PropertyIsSyncedFunc: func() (bool, error) { return synced, nil },
+		},
+		&ResourceProperty{
+			PropertyName:         "bar",
+			PropertyIsSyncedFunc: func() (bool, error) { return false, ErrResourceAbsent },
+		},
+	}
+
+	checks, err := explainProperties(properties)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Check{
+		{Name: "foo", InSync: true},
+		{Name: "bar", Detail: absentDetail},
+	}
+	errorIfNotEqual(t, want, checks)
+
+	properties[1].(*ResourceProperty).PropertyIsSyncedFunc = func() (bool, error) { return false, utils.ErrNotSupported }
+	if _, err := explainProperties(properties); err == nil {
+		t.Error("want error for property which cannot be evaluated")
+	}
+}
+
+func TestDefaultAttributes(t *testing.T) {
+	L := newLuaState()
+	defer L.Close()
+
+	const code = `
+	foo = resource.file.new("/tmp/foo")
+	foo.mode = tonumber("0600", 8)
+	foo.content = "foo"
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	defaults, err := DefaultAttributes(luaResource(L, "foo").(*File))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	declared := utils.NewList("mode", "content")
+	for _, name := range defaults {
+		if utils.NewString(name).IsInList(declared) {
+			t.Errorf("attribute %s was declared, but is reported as default", name)
+		}
+	}
+
+	for _, name := range []string{"state", "owner", "group", "source"} {
+		if !utils.NewString(name).IsInList(utils.NewList(defaults...)) {
+			t.Errorf("attribute %s should be reported as default, got %v", name, defaults)
+		}
+	}
+}
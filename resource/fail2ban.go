@@ -0,0 +1,322 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// fail2banConfigDir is the fail2ban configuration directory.
+const fail2banConfigDir = "/etc/fail2ban"
+
+// fail2banTimeRegexp matches fail2ban time values, e.g. "600", "10m" or "1h 30m".
+var fail2banTimeRegexp = regexp.MustCompile(`^-?\d+[a-z]*( \d+[a-z]*)*$`)
+
+// Fail2BanJail type is a resource which manages fail2ban jails.
+//
+// The jail configuration is written to /etc/fail2ban/jail.d/<name>.conf
+// and fail2ban is reloaded after the configuration has been changed.
+//
+// Example:
+//   sshd = resource.fail2ban_jail.new("sshd")
+//   sshd.state = "present"
+//   sshd.logpath = "/var/log/auth.log"
+//   sshd.maxretry = 3
+//   sshd.bantime = "1h"
+type Fail2BanJail struct {
+	Base
+
+	// Enabled specifies whether the jail is enabled.
+	// Defaults to true.
+	Enabled bool `luar:"enabled"`
+
+	// Filter used by the jail. Defaults to the jail name.
+	Filter string `luar:"filter"`
+
+	// LogPath is the path to the log file monitored by the jail.
+	LogPath string `luar:"logpath"`
+
+	// MaxRetry is the number of failures before a host is banned.
+	// Defaults to 5.
+	MaxRetry int `luar:"maxretry"`
+
+	// BanTime is the duration for which a host is banned.
+	// Defaults to "10m".
+	BanTime string `luar:"bantime"`
+
+	// FindTime is the window in which failures are counted.
+	// Defaults to "10m".
+	FindTime string `luar:"findtime"`
+
+	// Action taken when a host is banned. Multiple
+	// actions may be given on separate lines.
+	// Defaults to the action of the default jail.
+	Action string `luar:"action"`
+
+	// The fail2ban configuration directory
+	configDir string `luar:"-"`
+}
+
+// NewFail2BanJail creates a new resource for managing fail2ban jails.
+func NewFail2BanJail(name string) (Resource, error) {
+	f := &Fail2BanJail{
+		Base: Base{
+			Name:              name,
+			Type:              "fail2ban_jail",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		Enabled:   true,
+		Filter:    name,
+		MaxRetry:  5,
+		BanTime:   "10m",
+		FindTime:  "10m",
+		configDir: fail2banConfigDir,
+	}
+
+	f.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "config",
+			PropertySetFunc:      f.setConfig,
+			PropertyIsSyncedFunc: f.isConfigSynced,
+		},
+	}
+
+	return f, nil
+}
+
+// Validate validates the resource.
+func (f *Fail2BanJail) Validate() error {
+	if err := f.Base.Validate(); err != nil {
+		return err
+	}
+
+	if f.Name == "" || strings.ContainsAny(f.Name, "/[]\n") || f.Name == "." || f.Name == ".." {
+		return fmt.Errorf("invalid jail name '%s'", f.Name)
+	}
+
+	if f.MaxRetry < 1 {
+		return fmt.Errorf("invalid maxretry %d", f.MaxRetry)
+	}
+
+	for _, value := range []string{f.BanTime, f.FindTime} {
+		if !fail2banTimeRegexp.MatchString(value) {
+			return fmt.Errorf("invalid time '%s'", value)
+		}
+	}
+
+	if strings.ContainsAny(f.Filter+f.LogPath, "\n") {
+		return errors.New("filter and logpath cannot contain newlines")
+	}
+
+	// Missing filters are not fatal, since they may be
+	// installed by another resource
+	if f.Filter != "" && !f.filterExists() {
+		f.Printf("filter %s not found in %s\n", f.Filter, filepath.Join(f.configDir, "filter.d"))
+	}
+
+	return nil
+}
+
+// path returns the path to the jail configuration file.
+func (f *Fail2BanJail) path() string {
+	return filepath.Join(f.configDir, "jail.d", f.Name+".conf")
+}
+
+// filterExists returns a boolean indicating whether
+// the filter used by the jail exists.
+func (f *Fail2BanJail) filterExists() bool {
+	// Filters may be given options, e.g. "sshd[mode=aggressive]"
+	name := f.Filter
+	if i := strings.Index(name, "["); i >= 0 {
+		name = name[:i]
+	}
+
+	for _, ext := range []string{".conf", ".local"} {
+		if _, err := os.Stat(filepath.Join(f.configDir, "filter.d", name+ext)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Evaluate evaluates the state of the jail.
+func (f *Fail2BanJail) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    f.State,
+	}
+
+	fi, err := os.Stat(f.path())
+	if os.IsNotExist(err) {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return state, errors.New("path exists, but is not a regular file")
+	}
+
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create creates the jail configuration file.
+func (f *Fail2BanJail) Create() error {
+	f.Printf("creating %s\n", f.path())
+
+	if err := f.writeConfig(); err != nil {
+		return err
+	}
+
+	return f.reload()
+}
+
+// Delete removes the jail configuration file.
+func (f *Fail2BanJail) Delete() error {
+	f.Printf("removing %s\n", f.path())
+
+	if err := os.Remove(f.path()); err != nil {
+		return err
+	}
+
+	return f.reload()
+}
+
+// content returns the content of the jail configuration file.
+func (f *Fail2BanJail) content() []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("# Managed by gru, do not edit\n")
+	fmt.Fprintf(&buf, "[%s]\n", f.Name)
+	fmt.Fprintf(&buf, "enabled = %t\n", f.Enabled)
+
+	if f.Filter != "" {
+		fmt.Fprintf(&buf, "filter = %s\n", f.Filter)
+	}
+
+	if f.LogPath != "" {
+		fmt.Fprintf(&buf, "logpath = %s\n", f.LogPath)
+	}
+
+	fmt.Fprintf(&buf, "maxretry = %d\n", f.MaxRetry)
+	fmt.Fprintf(&buf, "bantime = %s\n", f.BanTime)
+	fmt.Fprintf(&buf, "findtime = %s\n", f.FindTime)
+
+	// Multiple actions are given as indented continuation lines
+	if action := strings.TrimSpace(f.Action); action != "" {
+		lines := strings.Split(action, "\n")
+		for i := range lines {
+			lines[i] = strings.TrimSpace(lines[i])
+		}
+		fmt.Fprintf(&buf, "action = %s\n", strings.Join(lines, "\n         "))
+	}
+
+	return buf.Bytes()
+}
+
+// isConfigSynced checks whether the jail configuration file is in sync.
+func (f *Fail2BanJail) isConfigSynced() (bool, error) {
+	data, err := ioutil.ReadFile(f.path())
+	if os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(data, f.content()), nil
+}
+
+// setConfig updates the jail configuration file.
+func (f *Fail2BanJail) setConfig() error {
+	f.Printf("updating %s\n", f.path())
+
+	if err := f.writeConfig(); err != nil {
+		return err
+	}
+
+	return f.reload()
+}
+
+// writeConfig writes the jail configuration file.
+func (f *Fail2BanJail) writeConfig() error {
+	if err := os.MkdirAll(filepath.Dir(f.path()), 0755); err != nil {
+		return err
+	}
+
+	return writeFile(f.path(), f.content(), 0644)
+}
+
+// reload reloads the fail2ban configuration, if fail2ban is running.
+func (f *Fail2BanJail) reload() error {
+	spec := utils.CommandSpec{Args: []string{"fail2ban-client", "ping"}}
+	if _, err := utils.RunCommand(context.Background(), spec); err != nil {
+		f.Printf("fail2ban is not running, skipping reload\n")
+		return nil
+	}
+
+	f.Printf("reloading fail2ban\n")
+
+	spec = utils.CommandSpec{Args: []string{"fail2ban-client", "reload"}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("unable to reload fail2ban: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "fail2ban_jail",
+		Provider:  NewFail2BanJail,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestFail2BanJail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-fail2ban")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	r, err := NewFail2BanJail("sshd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := r.(*Fail2BanJail)
+	f.configDir = dir
+	f.LogPath = "/var/log/auth.log"
+	f.MaxRetry = 3
+	f.BanTime = "1h"
+	f.Action = "iptables-multiport\nsendmail-whois"
+	if err := f.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(logs.String(), "filter sshd not found") {
+		t.Errorf("want warning about missing filter, got %q", logs.String())
+	}
+
+	state, err := f.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := f.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# Managed by gru, do not edit
+[sshd]
+enabled = true
+filter = sshd
+logpath = /var/log/auth.log
+maxretry = 3
+bantime = 1h
+findtime = 10m
+action = iptables-multiport
+         sendmail-whois
+`
+	content, err := ioutil.ReadFile(filepath.Join(dir, "jail.d", "sshd.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, want, string(content))
+	errorIfNotEqual(t, []string{"fail2ban-client ping", "fail2ban-client reload"}, commands)
+
+	synced, err := f.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	f.Enabled = false
+	synced, err = f.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	f.BanTime = "forever"
+	if err := f.Validate(); err == nil {
+		t.Error("want error for invalid bantime")
+	}
+}
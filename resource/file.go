@@ -26,153 +26,1117 @@
 package resource
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
-	"os/user"
-	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/dnaeon/gru/utils"
 )
 
+// geteuid returns the effective user id of the running process.
+// It is replaced in tests to run as an unprivileged user.
+var geteuid = os.Geteuid
+
+// ErrOwnershipNotSupported error is returned when the ownership of a
+// file is declared, but cannot be managed on the current platform.
+var ErrOwnershipNotSupported = errors.New("Ownership management not supported on this platform")
+
 // BaseFile type is the base type which is embedded by
 // File, Directory and Link resources.
 type BaseFile struct {
 	Base
 
-	// Path to the file. Defaults to the resource name.
-	Path string `luar:"-"`
+	// Path to the file. Defaults to the resource name.
+	Path string `luar:"-"`
+
+	// Permission bits to set on the file.
+	// For regular files defaults to 0644.
+	// For directories defaults to 0755.
+	Mode os.FileMode `luar:"mode"`
+
+	// Owner of the file. Defaults to the currently running user.
+	Owner string `luar:"owner"`
+
+	// Group of the file.
+	// Defaults to the group of the currently running user.
+	Group string `luar:"group"`
+
+	// Reference file from which to copy the permissions and ownership.
+	// Mode, owner and group which have been explicitly set take
+	// precedence over the ones of the reference file.
+	Reference string `luar:"reference"`
+
+	// Default mode, owner and group of the file, used to determine
+	// which of them have been set, when not assigned in Lua.
+	defaultMode  os.FileMode `luar:"-"`
+	defaultOwner string      `luar:"-"`
+	defaultGroup string      `luar:"-"`
+
+	// Fields assigned in Lua, keyed by their Lua name
+	assigned map[string]bool `luar:"-"`
+}
+
+// RecordField records that a field was assigned in Lua.
+func (bf *BaseFile) RecordField(name string) {
+	if bf.assigned == nil {
+		bf.assigned = make(map[string]bool)
+	}
+	bf.assigned[name] = true
+}
+
+// isDeclared returns a boolean indicating whether a field was explicitly
+// set, either by assigning it in Lua or by changing its default value.
+func (bf *BaseFile) isDeclared(name string, changed bool) bool {
+	return bf.assigned[name] || changed
+}
+
+// Initialize initializes the file resource by copying the permissions
+// and ownership from the reference file, if one was provided.
+func (bf *BaseFile) Initialize() error {
+	if bf.Reference == "" {
+		return nil
+	}
+
+	ref := newFileUtil(bf.Reference)
+	if !ref.Exists() {
+		return fmt.Errorf("reference file %s does not exist", bf.Reference)
+	}
+
+	modeDeclared := bf.isDeclared("mode", bf.Mode != bf.defaultMode)
+	ownerDeclared := bf.isDeclared("owner", bf.Owner != bf.defaultOwner)
+	groupDeclared := bf.isDeclared("group", bf.Group != bf.defaultGroup)
+
+	if !modeDeclared {
+		mode, err := ref.Mode()
+		if err != nil {
+			return err
+		}
+		bf.Mode = mode.Perm()
+	}
+
+	if !ownerDeclared || !groupDeclared {
+		owner, err := ref.Owner()
+		if errors.Is(err, utils.ErrNotSupported) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !ownerDeclared {
+			bf.Owner = owner.User.Username
+		}
+
+		if !groupDeclared {
+			bf.Group = owner.Group.Name
+		}
+	}
+
+	return nil
+}
+
+// isModeSynced returns a boolean indicating whether the
+// permissions of the file managed by the resource are in sync.
+func (bf *BaseFile) isModeSynced() (bool, error) {
+	dst := newFileUtil(bf.Path)
+
+	if !dst.Exists() {
+		return false, ErrResourceAbsent
+	}
+
+	mode, err := dst.Mode()
+	if err != nil {
+		return false, err
+	}
+
+	return mode.Perm() == bf.Mode, nil
+}
+
+// setMode sets the permissions on the file managed by the resource.
+func (bf *BaseFile) setMode() error {
+	bf.Printf("setting permissions to %s\n", utils.FormatFileMode(bf.Mode))
+
+	dst := newFileUtil(bf.Path)
+
+	return dst.Chmod(bf.Mode)
+}
+
+// isOwnerSynced checks whether the file ownership is correct.
+func (bf *BaseFile) isOwnerSynced() (bool, error) {
+	dst := newFileUtil(bf.Path)
+
+	if !dst.Exists() {
+		return false, ErrResourceAbsent
+	}
+
+	owner, err := dst.Owner()
+	if errors.Is(err, utils.ErrNotSupported) {
+		if bf.ownershipDeclared() {
+			return false, ErrOwnershipNotSupported
+		}
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	synced := owner.User.Username == bf.Owner && owner.Group.Name == bf.Group
+	if !synced && bf.skipOwnership() {
+		bf.Printf("ownership is %s:%s, should be %s:%s, skipping as not running as root\n", owner.User.Username, owner.Group.Name, bf.Owner, bf.Group)
+		return true, nil
+	}
+
+	return synced, nil
+}
+
+// setOwner sets the ownership of the file.
+func (bf *BaseFile) setOwner() error {
+	bf.Printf("setting ownership to %s:%s\n", bf.Owner, bf.Group)
+
+	dst := newFileUtil(bf.Path)
+
+	err := dst.SetOwner(bf.Owner, bf.Group)
+	if errors.Is(err, utils.ErrNotSupported) {
+		return ErrOwnershipNotSupported
+	}
+
+	if os.IsPermission(err) && DefaultConfig.SkipOwnershipWhenUnprivileged {
+		bf.Printf("unable to set ownership, skipping: %s\n", err)
+		return nil
+	}
+
+	return err
+}
+
+// explainMode returns the check of the permissions of the file.
+func (bf *BaseFile) explainMode() (Check, error) {
+	check := Check{Name: "mode", Desired: utils.FormatFileMode(bf.Mode)}
+
+	synced, err := bf.isModeSynced()
+	if err == ErrResourceAbsent {
+		check.Detail = absentDetail
+		return check, nil
+	}
+
+	if err != nil {
+		return check, err
+	}
+
+	mode, err := newFileUtil(bf.Path).Mode()
+	if err != nil {
+		return check, err
+	}
+	check.Observed = utils.FormatFileMode(mode.Perm())
+	check.InSync = synced
+
+	return check, nil
+}
+
+// explainOwner returns the check of the ownership of
+// the file, including the user and group ids.
+func (bf *BaseFile) explainOwner() (Check, error) {
+	check := Check{Name: "ownership", Desired: bf.Owner + ":" + bf.Group}
+
+	u, uerr := DefaultConfig.UserCache.Lookup(bf.Owner)
+	g, gerr := DefaultConfig.UserCache.LookupGroup(bf.Group)
+	if uerr == nil && gerr == nil {
+		check.Desired = formatOwner(&utils.FileOwner{User: u, Group: g})
+	}
+
+	synced, err := bf.isOwnerSynced()
+	switch {
+	case err == ErrResourceAbsent:
+		check.Detail = absentDetail
+		return check, nil
+	case err == ErrOwnershipNotSupported:
+		check.Detail = err.Error()
+		return check, nil
+	case err != nil:
+		return check, err
+	}
+	check.InSync = synced
+
+	owner, err := newFileUtil(bf.Path).Owner()
+	if errors.Is(err, utils.ErrNotSupported) {
+		check.Detail = "ownership not managed on this platform"
+		return check, nil
+	}
+
+	if err != nil {
+		return check, err
+	}
+	check.Observed = formatOwner(owner)
+
+	if synced && (owner.User.Username != bf.Owner || owner.Group.Name != bf.Group) {
+		check.Detail = "skipped, not running as root"
+	}
+
+	return check, nil
+}
+
+// formatOwner formats the ownership of a file as
+// "user:group (uid:gid)".
+func formatOwner(owner *utils.FileOwner) string {
+	return fmt.Sprintf("%s:%s (%s:%s)", owner.User.Username, owner.Group.Name, owner.User.Uid, owner.Group.Gid)
+}
+
+// newFileUtil creates a file utility for the given path, using
+// the user cache and file system of the current run.
+func newFileUtil(path string) *utils.FileUtil {
+	fu := utils.NewFileUtil(path)
+	fu.Users = DefaultConfig.UserCache
+	fu.FS = DefaultConfig.fileSystem()
+
+	return fu
+}
+
+// ownershipDeclared returns a boolean indicating whether the
+// owner or group of the file were explicitly declared.
+func (bf *BaseFile) ownershipDeclared() bool {
+	return bf.isDeclared("owner", bf.Owner != bf.defaultOwner) || bf.isDeclared("group", bf.Group != bf.defaultGroup)
+}
+
+// importAttributes sets the permissions and ownership of
+// the resource to the ones of the file on the system.
+func (bf *BaseFile) importAttributes() error {
+	dst := newFileUtil(bf.Path)
+
+	mode, err := dst.Mode()
+	if err != nil {
+		return err
+	}
+	bf.Mode = mode.Perm()
+
+	owner, err := dst.Owner()
+	if errors.Is(err, utils.ErrNotSupported) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	bf.Owner = owner.User.Username
+	bf.Group = owner.Group.Name
+
+	return nil
+}
+
+// skipOwnership returns a boolean indicating whether ownership
+// management should be skipped, because we are not running as root.
+func (bf *BaseFile) skipOwnership() bool {
+	return DefaultConfig.SkipOwnershipWhenUnprivileged && geteuid() != 0
+}
+
+// File resource manages files.
+//
+// Example:
+//   foo = resource.file.new("/tmp/foo")
+//   foo.state = "present"
+//   foo.mode = tonumber("0600", 8)
+//   foo.owner = "root"
+//   foo.group = "wheel"
+//   foo.content = "content of file foo"
+//
+// Using the permissions and ownership of another file.
+//
+// Example:
+//   bar = resource.file.new("/tmp/bar")
+//   bar.state = "present"
+//   bar.reference = "/etc/passwd"
+//
+// Recording the run which produced the file in a comment.
+//
+// Example:
+//   baz = resource.file.new("/etc/baz.conf")
+//   baz.state = "present"
+//   baz.source = "data/baz/baz.conf"
+//   baz.provenance = true
+//
+// Copying a sparse file, such as a VM image, without
+// materializing its holes at the destination.
+//
+// Example:
+//   img = resource.file.new("/var/lib/images/base.img")
+//   img.state = "present"
+//   img.source = "data/images/base.img"
+//   img.sparse = true
+//
+// Accepting either the old or the new version of a file during a
+// migration. The file is in sync if it matches any of the sources,
+// otherwise the first source is written.
+//
+// Example:
+//   motd = resource.file.new("/etc/motd")
+//   motd.state = "present"
+//   motd.source = { "data/motd/new", "data/motd/old" }
+//
+// Using remote content, which is verified against a checksum.
+//
+// Example:
+//   ca = resource.file.new("/etc/ssl/certs/internal-ca.pem")
+//   ca.state = "present"
+//   ca.source = "https://pki.example.org/ca.pem"
+//   ca.checksum = "sha256:<digest>"
+//
+// Comparing a source file by its git blob hash, and refusing to
+// deploy it with uncommitted changes.
+//
+// Example:
+//   nginx = resource.file.new("/etc/nginx/nginx.conf")
+//   nginx.state = "present"
+//   nginx.source = "data/nginx/nginx.conf"
+//   nginx.checksum = "git"
+//
+// Declaring the content as a list of lines.
+//
+// Example:
+//   hosts = resource.file.new("/etc/hosts")
+//   hosts.state = "present"
+//   hosts.lines = {
+//     "127.0.0.1 localhost",
+//     "::1 localhost",
+//   }
+//
+// Deploying the same certificate to multiple paths.
+//
+// Example:
+//   cert = resource.file.new("internal-ca")
+//   cert.state = "present"
+//   cert.source = "data/pki/internal-ca.pem"
+//   cert.paths = {
+//     "/etc/ssl/certs/internal-ca.pem",
+//     "/etc/nginx/ssl/internal-ca.pem",
+//   }
+type File struct {
+	BaseFile
+
+	// Content of file to set.
+	Content []byte `luar:"content"`
+
+	// Lines of the file to set, which are joined with newlines,
+	// including a trailing newline, to form the content.
+	Lines []string `luar:"lines"`
+
+	// Source file to use for the file content, relative to the
+	// site repo, or an http:// or https:// URL. A list of acceptable
+	// source files may be given instead, in which case the file is
+	// considered in sync if its content matches any of them. If none
+	// of them match, the first source in the list is written, so it
+	// should be the canonical one.
+	Source interface{} `luar:"source"`
+
+	// Checksum of a remote source in the form of "algorithm:digest",
+	// e.g. "sha256:<digest>". Remote content which does not match
+	// the checksum is not used. For source files in a site repo, which
+	// is a git work tree, it may be "git" instead, in which case the
+	// file is compared by its git blob hash, and sources with
+	// uncommitted changes are rejected. Source files outside of a
+	// git work tree are compared as usual.
+	Checksum string `luar:"checksum"`
+
+	// Provenance specifies whether to include a comment in the
+	// file with the run id, timestamp and source which produced it.
+	// The comment is ignored when checking whether the content
+	// of the file is in sync.
+	Provenance bool `luar:"provenance"`
+
+	// ProvenanceComment is the comment style used for the
+	// provenance block, e.g. "#", "//", ";", "--" or "<!--".
+	// Defaults to a style based on the file extension.
+	ProvenanceComment string `luar:"provenance_comment"`
+
+	// SizeLimit is the maximum size in bytes of the source file.
+	// Files exceeding the limit are not copied. Defaults to zero,
+	// which means no limit.
+	SizeLimit int64 `luar:"size_limit"`
+
+	// MaxSize is the maximum size in bytes of the content written to
+	// the file, including any provenance comment, e.g. to catch a
+	// runaway template. Content exceeding it is never written.
+	// Defaults to zero, which means no limit.
+	MaxSize int64 `luar:"max_size"`
+
+	// Sparse specifies how holes in the source file are handled when
+	// copying it. Valid values are true, false and "auto". When true,
+	// holes are always reproduced at the destination, skipping blocks
+	// of zeros where holes cannot be detected. When "auto", holes are
+	// reproduced only if they can be detected. Defaults to "auto".
+	Sparse interface{} `luar:"sparse"`
+
+	// Paths is a list of paths, which all get the same content,
+	// permissions and ownership. Each path is evaluated and updated
+	// on its own, and drift is reported per path. When given, the
+	// resource name is only used for identifying the resource.
+	Paths []string `luar:"paths"`
+
+	// ContinueOnError specifies whether or not to keep updating the
+	// remaining paths after a failure, when managing multiple paths.
+	// Defaults to false.
+	ContinueOnError bool `luar:"continue_on_error"`
+
+	// Force specifies whether a directory found at the path of the
+	// file is removed along with its contents, when the file should
+	// be absent. Defaults to false, in which case removal fails.
+	Force bool `luar:"force"`
+
+	// The parsed sparse mode
+	sparse utils.SparseMode `luar:"-"`
+
+	// The resources managing each of the paths
+	members []*File `luar:"-"`
+
+	// The parsed list of source files
+	sources []string `luar:"-"`
+
+	// Whether the content was set from the lines or source files
+	// when initializing the resource, rather than declared
+	derived bool `luar:"-"`
+
+	// Content of the acceptable source files, except for the first one
+	alternatives map[string][]byte `luar:"-"`
+
+	// Git blob hash of the canonical source file, if it
+	// is compared by the blob hash committed in git
+	blob string `luar:"-"`
+}
+
+// largeSourceSize is the size above which a warning is logged for
+// source files, since such sizes are unusual for configuration files.
+const largeSourceSize = 10 << 20
+
+// parseSources parses the source of a file resource, which is
+// either a single source file or a list of source files.
+func parseSources(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		sources := make([]string, len(v))
+		for i, item := range v {
+			source, ok := item.(string)
+			if !ok || source == "" {
+				return nil, fmt.Errorf("invalid source '%v'", item)
+			}
+			sources[i] = source
+		}
+		return sources, nil
+	}
+
+	return nil, fmt.Errorf("invalid source '%v'", v)
+}
+
+// joinLines joins the lines of a file with newlines,
+// including a trailing newline if there are any lines.
+func joinLines(lines []string) []byte {
+	if len(lines) == 0 {
+		return []byte{}
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// canonicalSource returns the source file, which is written
+// if the file does not match any of the sources.
+func (f *File) canonicalSource() string {
+	if len(f.sources) == 0 {
+		return ""
+	}
+
+	return f.sources[0]
+}
+
+// readSource reads a source file from the site repo, checking
+// its size against the size limit before reading it.
+// Remote sources are fetched, using the source cache if any.
+func (f *File) readSource(source string) ([]byte, error) {
+	if utils.IsRemoteURL(source) {
+		return f.fetchSource(source)
+	}
+
+	path, err := utils.SecureJoin(DefaultConfig.SiteRepo, source)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := DefaultConfig.fileSystem()
+	fi, err := fs.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.SizeLimit > 0 && fi.Size() > f.SizeLimit {
+		return nil, fmt.Errorf("source file %s is %d bytes, which exceeds the size limit of %d bytes", source, fi.Size(), f.SizeLimit)
+	}
+
+	if fi.Size() > largeSourceSize {
+		f.Printf("source file %s is %d bytes, which is unusually large for a configuration file\n", source, fi.Size())
+	}
+
+	return utils.ReadFile(fs, path)
+}
+
+// fetchSource fetches a remote source, checking its
+// size against the size limit once it has been fetched.
+func (f *File) fetchSource(url string) ([]byte, error) {
+	var data []byte
+	if cache := DefaultConfig.SourceCache; cache != nil {
+		path, err := cache.Fetch(context.Background(), url, f.Checksum)
+		if err != nil {
+			return nil, err
+		}
+
+		// The source cache always resides on the
+		// file system of the operating system
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return nil, err
+		}
+	} else {
+		var buf bytes.Buffer
+		if err := utils.Fetch(context.Background(), url, f.Checksum, &buf); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+	}
+
+	if f.SizeLimit > 0 && int64(len(data)) > f.SizeLimit {
+		return nil, fmt.Errorf("source file %s is %d bytes, which exceeds the size limit of %d bytes", url, len(data), f.SizeLimit)
+	}
+
+	return data, nil
+}
+
+// RemoteSources returns the remote sources of the file, so
+// that they can be fetched ahead of time.
+func (f *File) RemoteSources() []RemoteSource {
+	sources, err := parseSources(f.Source)
+	if err != nil {
+		return nil
+	}
+
+	remote := make([]RemoteSource, 0)
+	for _, source := range sources {
+		if utils.IsRemoteURL(source) {
+			remote = append(remote, RemoteSource{URL: source, Checksum: f.Checksum})
+		}
+	}
+
+	return remote
+}
+
+// matchingAlternative returns the acceptable source, other than the
+// canonical one, which the current content of the file matches.
+func (f *File) matchingAlternative() (string, error) {
+	if len(f.alternatives) == 0 {
+		return "", nil
+	}
+
+	// The file is read only if any of the sources has the same size,
+	// unless the provenance block has to be stripped from it first
+	if !f.Provenance {
+		fi, err := DefaultConfig.fileSystem().Stat(f.Path)
+		if err != nil {
+			return "", err
+		}
+
+		sized := false
+		for _, data := range f.alternatives {
+			sized = sized || int64(len(data)) == fi.Size()
+		}
+
+		if !sized {
+			return "", nil
+		}
+	}
+
+	content, err := utils.ReadFile(DefaultConfig.fileSystem(), f.Path)
+	if err != nil {
+		return "", err
+	}
+
+	if f.Provenance {
+		content = stripProvenance(content)
+	}
+
+	// Sources are checked in the given order
+	for _, source := range f.sources[1:] {
+		if bytes.Equal(content, f.alternatives[source]) {
+			return source, nil
+		}
+	}
+
+	return "", nil
+}
+
+// desiredContent returns the content to be written to the file.
+func (f *File) desiredContent() []byte {
+	if !f.Provenance {
+		return f.Content
+	}
+
+	source := f.canonicalSource()
+	if source == "" {
+		source = DefaultConfig.Module
+	}
+
+	style := provenanceCommentStyle(f.Path, f.ProvenanceComment)
+	block := provenanceBlock(style, DefaultConfig.RunID, source, time.Now())
+
+	return injectProvenance(f.Content, block)
+}
+
+// isContentSynced checks if the file content is in sync with the
+// given content, or with any of the acceptable source files.
+func (f *File) isContentSynced() (bool, error) {
+	synced, err := f.isCanonicalContentSynced()
+	if synced || err != nil {
+		return synced, err
+	}
+
+	source, err := f.matchingAlternative()
+	if err != nil || source == "" {
+		return false, err
+	}
+
+	f.Debugf("content matches acceptable source %s\n", source)
+
+	return true, nil
+}
+
+// isCanonicalContentSynced checks if the file content
+// is in sync with the given content.
+func (f *File) isCanonicalContentSynced() (bool, error) {
+	// We don't have a content, assume content is correct
+	if f.Content == nil {
+		return true, nil
+	}
+
+	fi, err := DefaultConfig.fileSystem().Stat(f.Path)
+	if os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	// The provenance block changes on every run, so
+	// compare the content without it
+	if f.Provenance {
+		content, err := utils.ReadFile(DefaultConfig.fileSystem(), f.Path)
+		if err != nil {
+			return false, err
+		}
+
+		return bytes.Equal(stripProvenance(content), f.Content), nil
+	}
+
+	// No need to compute checksums if sizes differ
+	if fi.Size() != int64(len(f.Content)) {
+		return false, nil
+	}
+
+	// Nor if comparing the file with the source file is
+	// conclusive, e.g. when both are the same file
+	src, err := f.localSourcePath()
+	if err != nil {
+		return false, err
+	}
+
+	if src != "" {
+		same, conclusive, err := newFileUtil(src).QuickCompare(f.Path)
+		if err != nil || conclusive {
+			return same, err
+		}
+	}
+
+	// Source files committed in git are compared by their blob hash
+	if f.blob != "" {
+		dstBlob, err := DefaultConfig.FileCache.Checksum(f.Path, utils.GitBlobAlgorithm)
+		if err != nil {
+			return false, err
+		}
+
+		return f.blob == dstBlob, nil
+	}
+
+	dstMd5, err := DefaultConfig.FileCache.Checksum(f.Path, "md5")
+	if err != nil {
+		return false, err
+	}
+
+	srcMd5 := fmt.Sprintf("%x", md5.Sum(f.Content))
+
+	return srcMd5 == dstMd5, nil
+}
+
+// Explain returns the checks performed when evaluating the
+// permissions, ownership and content of the file, including the
+// checksums of the content and which source has been selected.
+func (f *File) Explain() ([]Check, error) {
+	if len(f.members) > 0 {
+		return explainProperties(f.Properties())
+	}
+
+	checks := make([]Check, 0)
+	for _, explain := range []func() (Check, error){f.explainMode, f.explainOwner, f.explainContent} {
+		check, err := explain()
+		if err != nil {
+			return checks, fmt.Errorf("unable to evaluate property %s: %s", check.Name, err)
+		}
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
+
+// explainContent returns the check of the content of the file.
+// Checksums are computed using the same algorithm as when
+// checking whether the content is in sync.
+func (f *File) explainContent() (Check, error) {
+	check := Check{Name: "content"}
+
+	// We don't have a content, assume content is correct
+	if f.Content == nil {
+		check.InSync = true
+		check.Detail = "content is not managed"
+		return check, nil
+	}
+
+	synced, err := f.isCanonicalContentSynced()
+	if err == ErrResourceAbsent {
+		check.Detail = absentDetail
+		return check, nil
+	}
+
+	if err != nil {
+		return check, err
+	}
+
+	algorithm := "md5"
+	if f.blob != "" {
+		algorithm = utils.GitBlobAlgorithm
+	}
+	check.Desired = algorithm + ":" + contentChecksum(f.Content, algorithm)
+
+	var observed string
+	if f.Provenance {
+		content, err := utils.ReadFile(DefaultConfig.fileSystem(), f.Path)
+		if err != nil {
+			return check, err
+		}
+		observed = contentChecksum(stripProvenance(content), algorithm)
+	} else if observed, err = DefaultConfig.FileCache.Checksum(f.Path, algorithm); err != nil {
+		return check, err
+	}
+	check.Observed = algorithm + ":" + observed
+
+	switch source := f.canonicalSource(); {
+	case source == "" && f.Lines != nil:
+		check.Detail = "content from lines"
+	case source == "":
+		check.Detail = "inline content"
+	case synced:
+		check.Detail = fmt.Sprintf("matches canonical source %s", source)
+	default:
+		alternative, err := f.matchingAlternative()
+		if err != nil {
+			return check, err
+		}
+
+		if alternative != "" {
+			synced = true
+			check.Detail = fmt.Sprintf("matches acceptable source %s instead of canonical source %s", alternative, source)
+		} else {
+			check.Detail = fmt.Sprintf("matches no source, canonical source %s would be written", source)
+		}
+	}
+	check.InSync = synced
+
+	return check, nil
+}
+
+// contentChecksum returns the hex encoded checksum
+// of content using the given algorithm.
+func contentChecksum(content []byte, algorithm string) string {
+	if algorithm == utils.GitBlobAlgorithm {
+		return utils.GitBlobHash(content)
+	}
+
+	return fmt.Sprintf("%x", md5.Sum(content))
+}
+
+// Diff writes the difference between the current content of the
+// file and the content to be set to w in the unified format.
+func (f *File) Diff(w io.Writer) (bool, error) {
+	if len(f.members) > 0 {
+		return f.diffMembers(w)
+	}
+
+	// We don't have a content, assume content is correct
+	if f.Content == nil {
+		return false, nil
+	}
+
+	// Files matching any of the acceptable sources are not changed
+	fs := DefaultConfig.fileSystem()
+	if _, err := fs.Stat(f.Path); err == nil {
+		source, err := f.matchingAlternative()
+		if err != nil || source != "" {
+			return false, err
+		}
+	}
+
+	want := utils.DiffInput{
+		Name:   f.Path,
+		Reader: bytes.NewReader(f.Content),
+		Size:   int64(len(f.Content)),
+	}
+	if source := f.canonicalSource(); source != "" {
+		want.Name = source
+	}
+
+	current := utils.DiffInput{
+		Name:   "/dev/null",
+		Reader: bytes.NewReader(nil),
+	}
+
+	fi, err := fs.Stat(f.Path)
+	switch {
+	case os.IsNotExist(err):
+		return utils.Diff(w, current, want, utils.DiffOptions{})
+	case err != nil:
+		return false, err
+	}
+
+	file, err := fs.Open(f.Path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	current.Name = f.Path
+	current.Reader = file
+	current.Size = fi.Size()
+
+	// The provenance block changes on every run, so
+	// compare the content without it
+	if f.Provenance && current.Size <= utils.DefaultDiffMaxSize {
+		content, err := ioutil.ReadAll(file)
+		if err != nil {
+			return false, err
+		}
+		content = stripProvenance(content)
+		current.Reader = bytes.NewReader(content)
+		current.Size = int64(len(content))
+	}
+
+	return utils.Diff(w, current, want, utils.DiffOptions{})
+}
 
-	// Permission bits to set on the file.
-	// For regular files defaults to 0644.
-	// For directories defaults to 0755.
-	Mode os.FileMode `luar:"mode"`
+// setContent sets the content of the file.
+func (f *File) setContent() error {
+	dstMd5, err := DefaultConfig.FileCache.Checksum(f.Path, "md5")
+	if err != nil {
+		return err
+	}
 
-	// Owner of the file. Defaults to the currently running user.
-	Owner string `luar:"owner"`
+	f.Printf("setting content to md5:%s\n", dstMd5)
 
-	// Group of the file.
-	// Defaults to the group of the currently running user.
-	Group string `luar:"group"`
+	return f.writeContent()
 }
 
-// isModeSynced returns a boolean indicating whether the
-// permissions of the file managed by the resource are in sync.
-func (bf *BaseFile) isModeSynced() (bool, error) {
-	dst := utils.NewFileUtil(bf.Path)
+// writeContent writes the content to the file. Source files are
+// copied, so that any holes can be reproduced at the destination.
+// The written content is read back and verified before it replaces
+// the file, so that the previous content is kept if it is corrupted.
+func (f *File) writeContent() error {
+	defer DefaultConfig.InvalidatePath(f.Path)
 
-	if !dst.Exists() {
-		return false, ErrResourceAbsent
+	content := f.desiredContent()
+	if err := f.checkMaxSize(content); err != nil {
+		return err
 	}
 
-	mode, err := dst.Mode()
+	src, err := f.localSourcePath()
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	return mode.Perm() == bf.Mode, nil
-}
+	if src == "" || f.sparse == utils.SparseNever {
+		return f.writeFileAtomic(content)
+	}
 
-// setMode sets the permissions on the file managed by the resource.
-func (bf *BaseFile) setMode() error {
-	Logf("%s setting permissions to %#o\n", bf.ID(), bf.Mode)
+	// The copy is given the mode and ownership of the
+	// file before replacing it, as with any other content
+	dst := utils.NewFileUtil(f.Path)
+	dst.Sparse = f.sparse
+	uid, gid := f.contentOwnerIDs()
+	err = dst.CopyFromAs(src, f.Mode, uid, gid)
+	if f.retryWithoutOwnership(uid, err) {
+		err = dst.CopyFromAs(src, f.Mode, -1, -1)
+	}
 
-	dst := utils.NewFileUtil(bf.Path)
+	if err != nil {
+		return err
+	}
+	DefaultConfig.BytesWritten.Add(int64(len(f.Content)))
 
-	return dst.Chmod(bf.Mode)
+	return nil
 }
 
-// isOwnerSynced checks whether the file ownership is correct.
-func (bf *BaseFile) isOwnerSynced() (bool, error) {
-	dst := utils.NewFileUtil(bf.Path)
+// localSourcePath returns the path to the source file, from which the
+// content is read as is, if the file can be compared with it or copied
+// from it. Source files reside on the file system of the operating
+// system, so an empty path is returned when using any other one.
+func (f *File) localSourcePath() (string, error) {
+	source := f.canonicalSource()
+	if source == "" || utils.IsRemoteURL(source) || f.Provenance || !utils.IsOSFileSystem(DefaultConfig.fileSystem()) {
+		return "", nil
+	}
 
-	if !dst.Exists() {
-		return false, ErrResourceAbsent
+	return utils.SecureJoin(DefaultConfig.SiteRepo, source)
+}
+
+// writeFileAtomic writes the content to a temporary file, which is
+// created with the mode and ownership of the file, before renaming it to
+// the file, so that no broader permissions are ever observable, e.g.
+// when writing private keys.
+func (f *File) writeFileAtomic(content []byte) error {
+	uid, gid := f.contentOwnerIDs()
+	err := utils.WriteFileAtomic(DefaultConfig.fileSystem(), f.Path, content, f.Mode, uid, gid)
+	if f.retryWithoutOwnership(uid, err) {
+		err = utils.WriteFileAtomic(DefaultConfig.fileSystem(), f.Path, content, f.Mode, -1, -1)
 	}
 
-	owner, err := dst.Owner()
 	if err != nil {
-		return false, err
+		return err
 	}
+	DefaultConfig.BytesWritten.Add(int64(len(content)))
 
-	return owner.User.Username == bf.Owner && owner.Group.Name == bf.Group, nil
+	return nil
 }
 
-// setOwner sets the ownership of the file.
-func (bf *BaseFile) setOwner() error {
-	Logf("%s setting ownership to %s:%s\n", bf.ID(), bf.Owner, bf.Group)
-
-	dst := utils.NewFileUtil(bf.Path)
+// contentOwnerIDs returns the user and group ids owning new content
+// of the file, or -1 if they cannot be looked up, in which case the
+// ownership is taken care of by the owner property later.
+func (f *File) contentOwnerIDs() (int, int) {
+	uid, gid, err := newFileUtil(f.Path).LookupOwnerIDs(f.Owner, f.Group)
+	if err != nil {
+		f.Debugf("unable to look up ownership %s:%s: %s\n", f.Owner, f.Group, err)
+		return -1, -1
+	}
 
-	return dst.SetOwner(bf.Owner, bf.Group)
+	return uid, gid
 }
 
-// File resource manages files.
-//
-// Example:
-//   foo = resource.file.new("/tmp/foo")
-//   foo.state = "present"
-//   foo.mode = tonumber("0600", 8)
-//   foo.owner = "root"
-//   foo.group = "wheel"
-//   foo.content = "content of file foo"
-type File struct {
-	BaseFile
+// retryWithoutOwnership returns a boolean indicating whether writing
+// new content failed only because its ownership could not be set,
+// in which case it is written again without setting it.
+func (f *File) retryWithoutOwnership(uid int, err error) bool {
+	if uid == -1 || !(errors.Is(err, utils.ErrNotSupported) || os.IsPermission(err) && DefaultConfig.SkipOwnershipWhenUnprivileged) {
+		return false
+	}
 
-	// Content of file to set.
-	Content []byte `luar:"content"`
+	f.Debugf("unable to set ownership of new content, writing it without: %s\n", err)
 
-	// Source file to use for the file content.
-	Source string `luar:"source"`
+	return true
 }
 
-// isContentSynced checks if the file content is in sync with the
-// given content.
-func (f *File) isContentSynced() (bool, error) {
-	// We don't have a content, assume content is correct
-	if f.Content == nil {
-		return true, nil
+// checkMaxSize checks the size of the content to be
+// written against the maximum size of the file.
+func (f *File) checkMaxSize(content []byte) error {
+	if f.MaxSize > 0 && int64(len(content)) > f.MaxSize {
+		return fmt.Errorf("content is %d bytes, which exceeds the max size of %d bytes, refusing to write", len(content), f.MaxSize)
 	}
 
-	dst := utils.NewFileUtil(f.Path)
-	if !dst.Exists() {
-		return false, ErrResourceAbsent
+	return nil
+}
+
+// PendingBytes returns the number of bytes, which would be
+// written to bring the content of the file up to date.
+func (f *File) PendingBytes() (int64, error) {
+	if len(f.members) > 0 {
+		return f.pendingBytesMembers()
 	}
 
-	dstMd5, err := dst.Md5()
-	if err != nil {
-		return false, err
+	if f.Content == nil {
+		return 0, nil
 	}
 
-	srcMd5 := fmt.Sprintf("%x", md5.Sum(f.Content))
+	synced, err := f.isContentSynced()
+	switch {
+	case err == ErrResourceAbsent:
+		return int64(len(f.desiredContent())), nil
+	case err != nil:
+		return 0, err
+	case synced:
+		return 0, nil
+	}
 
-	return srcMd5 == dstMd5, nil
+	return int64(len(f.desiredContent())), nil
 }
 
-// setContent sets the content of the file.
-func (f *File) setContent() error {
-	dst := utils.NewFileUtil(f.Path)
-	dstMd5, err := dst.Md5()
-	if err != nil {
+// writeFile writes data to a file, like ioutil.WriteFile does, and
+// counts the bytes written towards the total for the current run.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if err := utils.WriteFile(DefaultConfig.fileSystem(), path, data, perm); err != nil {
 		return err
 	}
+	DefaultConfig.BytesWritten.Add(int64(len(data)))
+
+	return nil
+}
 
-	Logf("%s setting content to md5:%s\n", f.ID(), dstMd5)
+// parseSparseMode parses the sparse mode of a file resource.
+func parseSparseMode(v interface{}) (utils.SparseMode, error) {
+	switch v := v.(type) {
+	case nil:
+		return utils.SparseAuto, nil
+	case bool:
+		if v {
+			return utils.SparseAlways, nil
+		}
+		return utils.SparseNever, nil
+	case string:
+		switch v {
+		case "auto":
+			return utils.SparseAuto, nil
+		case "true":
+			return utils.SparseAlways, nil
+		case "false":
+			return utils.SparseNever, nil
+		}
+	}
 
-	return ioutil.WriteFile(f.Path, f.Content, f.Mode)
+	return utils.SparseNever, fmt.Errorf("invalid sparse mode '%v'", v)
 }
 
 // NewFile creates a resource for managing regular files.
 func NewFile(name string) (Resource, error) {
 	// Defaults for owner and group
-	currentUser, err := user.Current()
+	currentUser, err := DefaultConfig.UserCache.Current()
 	if err != nil {
 		return nil, err
 	}
 
-	currentGroup, err := user.LookupGroupId(currentUser.Gid)
+	currentGroup, err := DefaultConfig.UserCache.LookupGroupId(currentUser.Gid)
 	if err != nil {
 		return nil, err
 	}
@@ -190,17 +1154,28 @@ func NewFile(name string) (Resource, error) {
 				Concurrent:        true,
 				Subscribe:         make(TriggerMap),
 			},
-			Path:  name,
-			Mode:  0644,
-			Owner: currentUser.Username,
-			Group: currentGroup.Name,
+			Path:         name,
+			Mode:         0644,
+			Owner:        currentUser.Username,
+			Group:        currentGroup.Name,
+			defaultMode:  0644,
+			defaultOwner: currentUser.Username,
+			defaultGroup: currentGroup.Name,
 		},
 		Content: nil,
 		Source:  "",
+		Sparse:  "auto",
 	}
 
 	// Set resource properties
-	f.PropertyList = []Property{
+	f.PropertyList = f.properties()
+
+	return f, nil
+}
+
+// properties returns the properties of the file resource.
+func (f *File) properties() []Property {
+	properties := []Property{
 		&ResourceProperty{
 			PropertyName:         "mode",
 			PropertySetFunc:      f.setMode,
@@ -218,7 +1193,7 @@ func NewFile(name string) (Resource, error) {
 		},
 	}
 
-	return f, nil
+	return properties
 }
 
 // Validate validates the file resource.
@@ -227,38 +1202,172 @@ func (f *File) Validate() error {
 		return err
 	}
 
-	if f.Source != "" && f.Content != nil {
+	sources, err := parseSources(f.Source)
+	if err != nil {
+		return err
+	}
+	f.sources = sources
+
+	// The resource may be validated again after being initialized,
+	// so content set from the lines or source files is not declared
+	declared := f.Content != nil && !f.derived
+	if len(f.sources) > 0 && declared {
 		return errors.New("cannot use both 'source' and 'content'")
 	}
 
+	if f.Lines != nil && (len(f.sources) > 0 || declared) {
+		return errors.New("cannot use 'lines' with either 'source' or 'content'")
+	}
+
+	if f.Checksum == utils.GitBlobAlgorithm {
+		for _, source := range f.sources {
+			if utils.IsRemoteURL(source) {
+				return errors.New("git checksum can only be used with source files in the site repo")
+			}
+		}
+	} else if f.Checksum != "" && (len(f.sources) != 1 || !utils.IsRemoteURL(f.sources[0])) {
+		return errors.New("checksum can only be used with a single remote source")
+	}
+
+	if f.ProvenanceComment != "" {
+		if _, ok := commentStyles[f.ProvenanceComment]; !ok {
+			return fmt.Errorf("unknown provenance comment style '%s'", f.ProvenanceComment)
+		}
+	}
+
+	if f.SizeLimit < 0 {
+		return errors.New("size limit cannot be negative")
+	}
+
+	if f.MaxSize < 0 {
+		return errors.New("max size cannot be negative")
+	}
+
+	sparse, err := parseSparseMode(f.Sparse)
+	if err != nil {
+		return err
+	}
+	f.sparse = sparse
+
+	for _, path := range f.Paths {
+		if path == "" {
+			return errors.New("paths cannot be empty")
+		}
+	}
+
 	return nil
 }
 
 // Initialize initializes the file resource.
 func (f *File) Initialize() error {
-	// Set file content from the given source file if any.
+	if err := f.BaseFile.Initialize(); err != nil {
+		return err
+	}
+
+	sources, err := parseSources(f.Source)
+	if err != nil {
+		return err
+	}
+	f.sources = sources
+
+	if err := f.initializeContent(); err != nil {
+		return err
+	}
+
+	// Multiple paths share the content of the resource
+	f.initializeMembers()
+
+	return nil
+}
+
+// initializeContent sets the content of the file
+// from the given lines or source files, if any.
+func (f *File) initializeContent() error {
+	if f.Lines != nil {
+		f.Content = joinLines(f.Lines)
+		f.derived = true
+		return nil
+	}
+
+	// Set file content from the given source files if any.
 	// TODO: Currently this works only for files in the site repo.
 	// TODO: Implement a generic file content fetcher.
-	if f.Source != "" {
-		src := filepath.Join(DefaultConfig.SiteRepo, f.Source)
-		content, err := ioutil.ReadFile(src)
+	if len(f.sources) == 0 {
+		return nil
+	}
+
+	content, err := f.readSource(f.sources[0])
+	if err != nil {
+		return err
+	}
+
+	alternatives := make(map[string][]byte)
+	for _, source := range f.sources[1:] {
+		data, err := f.readSource(source)
 		if err != nil {
 			return err
 		}
-		f.Content = content
+		alternatives[source] = data
+	}
+
+	f.Content = content
+	f.derived = true
+	f.alternatives = alternatives
+
+	if f.Checksum == utils.GitBlobAlgorithm {
+		return f.initializeBlob()
+	}
+
+	return nil
+}
+
+// initializeBlob verifies that the source files are committed in
+// git, and sets the blob hash used for comparing the content of the
+// file. If the site repo is not a git work tree, the content of the
+// file is compared as usual.
+func (f *File) initializeBlob() error {
+	f.blob = ""
+	for i, source := range f.sources {
+		committed, err := utils.GitCommittedBlob(context.Background(), DefaultConfig.SiteRepo, source)
+		if err == utils.ErrNotGitWorkTree {
+			f.Debugf("site repo is not a git work tree, comparing content\n")
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("source file %s is not committed", source)
+		}
+
+		content := f.Content
+		if i > 0 {
+			content = f.alternatives[source]
+		}
+
+		if utils.GitBlobHash(content) != committed {
+			return fmt.Errorf("source file %s has uncommitted changes", source)
+		}
 	}
+	f.blob = utils.GitBlobHash(f.Content)
 
 	return nil
 }
 
 // Evaluate evaluates the state of the file resource.
 func (f *File) Evaluate() (State, error) {
+	if len(f.members) > 0 {
+		return f.evaluateMembers()
+	}
+
 	state := State{
 		Current: "unknown",
 		Want:    f.State,
 	}
 
-	fi, err := os.Stat(f.Path)
+	if f.SizeLimit > 0 && int64(len(f.Content)) > f.SizeLimit {
+		return state, fmt.Errorf("content is %d bytes, which exceeds the size limit of %d bytes", len(f.Content), f.SizeLimit)
+	}
+
+	fi, err := DefaultConfig.fileSystem().Stat(f.Path)
 	if os.IsNotExist(err) {
 		state.Current = "absent"
 		return state, nil
@@ -266,25 +1375,72 @@ func (f *File) Evaluate() (State, error) {
 
 	state.Current = "present"
 
-	if !fi.Mode().IsRegular() {
+	// Anything at the path of a file, which should be absent is
+	// removed, as long as removing it is allowed
+	if !fi.Mode().IsRegular() && !utils.NewString(f.State).IsInList(utils.NewList(f.AbsentStates()...)) {
 		return state, errors.New("path exists, but is not a regular file")
 	}
 
 	return state, nil
 }
 
+// Import sets the state, permissions and ownership of the resource
+// to the ones of the file. The content of the file is not managed.
+func (f *File) Import() error {
+	state, err := f.Evaluate()
+	if err != nil {
+		return err
+	}
+
+	f.State = state.Current
+	if f.State == "absent" {
+		return nil
+	}
+
+	return f.importAttributes()
+}
+
 // Create creates the file managed by the resource.
 func (f *File) Create() error {
-	Logf("%s creating file\n", f.ID())
+	if len(f.members) > 0 {
+		return f.createMembers()
+	}
+
+	f.Printf("creating file\n")
 
-	return ioutil.WriteFile(f.Path, f.Content, f.Mode)
+	return f.writeContent()
 }
 
 // Delete deletes the file managed by the resource.
 func (f *File) Delete() error {
-	Logf("%s removing file\n", f.ID())
+	if len(f.members) > 0 {
+		return f.deleteMembers()
+	}
+
+	fi, err := DefaultConfig.fileSystem().Lstat(f.Path)
+	if err != nil {
+		return err
+	}
+
+	defer DefaultConfig.InvalidatePath(f.Path)
+	if !fi.IsDir() {
+		f.Printf("removing file\n")
+		return DefaultConfig.fileSystem().Remove(f.Path)
+	}
+
+	if !f.Force {
+		return fmt.Errorf("path %s is a directory, set force to remove it", f.Path)
+	}
+
+	f.Printf("removing directory at path of file\n")
+	opts := utils.RemoveOptions{
+		Protected: []string{DefaultConfig.SiteRepo},
+	}
+
+	result, err := utils.SafeRemoveAll(f.Path, opts)
+	f.Printf("removed %d file(s) and %d directories\n", result.Files, result.Dirs)
 
-	return os.Remove(f.Path)
+	return err
 }
 
 // Directory resource manages directories.
@@ -295,23 +1451,44 @@ func (f *File) Delete() error {
 //   bar.mode = tonumber("0700", 8)
 //   bar.owner = "root"
 //   bar.group = "wheel"
+//
+// Managing the ownership of a directory and all of its contents.
+//
+// Example:
+//   www = resource.directory.new("/var/www")
+//   www.state = "present"
+//   www.owner = "www"
+//   www.group = "www"
+//   www.recursive = true
 type Directory struct {
 	BaseFile
 
 	// Parents flag specifies whether or not to create/delete
 	// parent directories. Defaults to false.
 	Parents bool `luar:"parents"`
+
+	// Recursive flag specifies whether or not to manage the
+	// ownership of the directory contents as well. Defaults to false.
+	Recursive bool `luar:"recursive"`
+
+	// ContinueOnError flag specifies whether or not to keep changing
+	// the ownership of the remaining files after a failure, when
+	// managing ownership recursively. Defaults to false.
+	ContinueOnError bool `luar:"continue_on_error"`
+
+	// Paths within the directory which need ownership changes
+	ownershipChanges []string `luar:"-"`
 }
 
 // NewDirectory creates a resource for managing directories.
 func NewDirectory(name string) (Resource, error) {
 	// Defaults for owner and group
-	currentUser, err := user.Current()
+	currentUser, err := DefaultConfig.UserCache.Current()
 	if err != nil {
 		return nil, err
 	}
 
-	currentGroup, err := user.LookupGroupId(currentUser.Gid)
+	currentGroup, err := DefaultConfig.UserCache.LookupGroupId(currentUser.Gid)
 	if err != nil {
 		return nil, err
 	}
@@ -329,10 +1506,13 @@ func NewDirectory(name string) (Resource, error) {
 				Concurrent:        true,
 				Subscribe:         make(TriggerMap),
 			},
-			Path:  name,
-			Mode:  0755,
-			Owner: currentUser.Username,
-			Group: currentGroup.Name,
+			Path:         name,
+			Mode:         0755,
+			Owner:        currentUser.Username,
+			Group:        currentGroup.Name,
+			defaultMode:  0755,
+			defaultOwner: currentUser.Username,
+			defaultGroup: currentGroup.Name,
 		},
 		Parents: false,
 	}
@@ -376,9 +1556,113 @@ func (d *Directory) Evaluate() (State, error) {
 	return state, nil
 }
 
+// Import sets the state, permissions and ownership
+// of the resource to the ones of the directory.
+func (d *Directory) Import() error {
+	state, err := d.Evaluate()
+	if err != nil {
+		return err
+	}
+
+	d.State = state.Current
+	if d.State == "absent" {
+		return nil
+	}
+
+	return d.importAttributes()
+}
+
+// isOwnerSynced checks whether the ownership of the directory
+// and its contents, if recursive, is correct.
+func (d *Directory) isOwnerSynced() (bool, error) {
+	if !d.Recursive {
+		return d.BaseFile.isOwnerSynced()
+	}
+
+	dst := utils.NewFileUtil(d.Path)
+	dst.Users = DefaultConfig.UserCache
+
+	if !dst.Exists() {
+		return false, ErrResourceAbsent
+	}
+
+	uid, gid, err := dst.LookupOwnerIDs(d.Owner, d.Group)
+	if err != nil {
+		return false, err
+	}
+
+	opts := utils.WalkOptions{Concurrency: DefaultConfig.Concurrency}
+	paths, err := utils.OwnershipChanges(d.Path, uid, gid, opts)
+	if errors.Is(err, utils.ErrNotSupported) {
+		if d.ownershipDeclared() {
+			return false, ErrOwnershipNotSupported
+		}
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+	d.ownershipChanges = paths
+
+	if len(paths) == 0 {
+		return true, nil
+	}
+
+	d.Printf("%d files need ownership changed to %s:%s\n", len(paths), d.Owner, d.Group)
+	if d.skipOwnership() {
+		d.Printf("skipping ownership changes as not running as root\n")
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// setOwner sets the ownership of the directory and its
+// contents, if recursive.
+func (d *Directory) setOwner() error {
+	if !d.Recursive {
+		return d.BaseFile.setOwner()
+	}
+
+	// The directory may have been created after being evaluated
+	if d.ownershipChanges == nil {
+		if _, err := d.isOwnerSynced(); err != nil {
+			return err
+		}
+	}
+
+	d.Printf("setting ownership of %d files to %s:%s\n", len(d.ownershipChanges), d.Owner, d.Group)
+
+	dst := utils.NewFileUtil(d.Path)
+	dst.Users = DefaultConfig.UserCache
+
+	uid, gid, err := dst.LookupOwnerIDs(d.Owner, d.Group)
+	if err != nil {
+		return err
+	}
+
+	opts := utils.ChownOptions{
+		Concurrency:     DefaultConfig.Concurrency,
+		ContinueOnError: d.ContinueOnError,
+	}
+
+	err = utils.ChownPaths(d.ownershipChanges, uid, gid, opts)
+	if errors.Is(err, utils.ErrNotSupported) {
+		return ErrOwnershipNotSupported
+	}
+
+	if err != nil {
+		return err
+	}
+	d.ownershipChanges = nil
+
+	return nil
+}
+
 // Create creates the directory.
 func (d *Directory) Create() error {
-	Logf("%s creating directory\n", d.ID())
+	d.Printf("creating directory\n")
 
 	if d.Parents {
 		return os.MkdirAll(d.Path, d.Mode)
@@ -389,10 +1673,17 @@ func (d *Directory) Create() error {
 
 // Delete removes the directory.
 func (d *Directory) Delete() error {
-	Logf("%s removing directory\n", d.ID())
+	d.Printf("removing directory\n")
 
 	if d.Parents {
-		return os.RemoveAll(d.Path)
+		opts := utils.RemoveOptions{
+			Protected: []string{DefaultConfig.SiteRepo},
+		}
+
+		result, err := utils.SafeRemoveAll(d.Path, opts)
+		d.Printf("removed %d file(s) and %d directories\n", result.Files, result.Dirs)
+
+		return err
 	}
 
 	return os.Remove(d.Path)
@@ -408,6 +1699,7 @@ type Link struct {
 	BaseFile
 
 	// Source file points to the file the link will be set to.
+	// Required.
 	Source string `luar:"source"`
 
 	// Hard flag specifies whether or not to create a hard link to the file.
@@ -477,7 +1769,7 @@ func (l *Link) Evaluate() (State, error) {
 
 // Create creates the link.
 func (l *Link) Create() error {
-	Logf("%s creating link\n", l.ID())
+	l.Printf("creating link\n")
 
 	if l.Hard {
 		return os.Link(l.Source, l.Path)
@@ -488,7 +1780,7 @@ func (l *Link) Create() error {
 
 // Delete removes the link.
 func (l *Link) Delete() error {
-	Logf("%s removing link\n", l.ID())
+	l.Printf("removing link\n")
 
 	return os.Remove(l.Path)
 }
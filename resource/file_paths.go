@@ -0,0 +1,225 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// initializeMembers creates the resources managing each of the
+// paths of a file resource with multiple paths. The resources share
+// the content, permissions and ownership of the file resource.
+func (f *File) initializeMembers() {
+	f.members = nil
+	f.PropertyList = f.properties()
+	if len(f.Paths) == 0 {
+		return
+	}
+
+	members := make([]*File, 0, len(f.Paths))
+	for _, path := range f.Paths {
+		m := *f
+		m.Name = path
+		m.Path = path
+		m.Paths = nil
+		m.members = nil
+		m.PropertyList = m.properties()
+		members = append(members, &m)
+	}
+
+	f.members = members
+	f.PropertyList = f.memberProperties()
+}
+
+// forEachMember calls fn for each of the paths of the resource.
+// Processing stops at the first error, unless the resource
+// continues on errors, in which case all errors are returned.
+func (f *File) forEachMember(fn func(m *File) error) error {
+	errs := make([]string, 0)
+	for _, m := range f.members {
+		if err := fn(m); err != nil {
+			if !f.ContinueOnError {
+				return fmt.Errorf("%s: %s", m.Path, err)
+			}
+			m.Printf("%s\n", err)
+			errs = append(errs, fmt.Sprintf("%s: %s", m.Path, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d paths failed: %s", len(errs), len(f.members), strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// evaluateMembers evaluates the state of each of the paths. When
+// the paths should be present, they are considered present only if
+// all of them are present. When the paths should be absent, they are
+// considered present if any of them is present.
+func (f *File) evaluateMembers() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    f.State,
+	}
+
+	present := 0
+	err := f.forEachMember(func(m *File) error {
+		s, err := m.Evaluate()
+		if err != nil {
+			return err
+		}
+
+		if s.Current == "present" {
+			present++
+		} else {
+			m.Debugf("is absent\n")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "present"
+	if present == 0 || f.State == "present" && present < len(f.members) {
+		state.Current = "absent"
+	}
+
+	return state, nil
+}
+
+// createMembers creates the files, which are absent.
+func (f *File) createMembers() error {
+	return f.forEachMember(func(m *File) error {
+		s, err := m.Evaluate()
+		if err != nil || s.Current == "present" {
+			return err
+		}
+
+		return m.Create()
+	})
+}
+
+// deleteMembers deletes the files, which are present.
+func (f *File) deleteMembers() error {
+	return f.forEachMember(func(m *File) error {
+		s, err := m.Evaluate()
+		if err != nil || s.Current == "absent" {
+			return err
+		}
+
+		return m.Delete()
+	})
+}
+
+// memberProperties returns the properties of a file resource with
+// multiple paths. A property is in sync only if it is in sync for
+// all of the paths, and is set only for the paths with drift.
+func (f *File) memberProperties() []Property {
+	properties := make([]Property, 0)
+	for i, p := range f.members[0].PropertyList {
+		i, name := i, p.Name()
+		property := &ResourceProperty{
+			PropertyName: name,
+			PropertyIsSyncedFunc: func() (bool, error) {
+				synced, absent := true, 0
+				for _, m := range f.members {
+					ok, err := m.PropertyList[i].IsSynced()
+					if err == ErrResourceAbsent {
+						absent++
+						continue
+					}
+
+					if err != nil {
+						return false, fmt.Errorf("%s: %s", m.Path, err)
+					}
+
+					if !ok {
+						m.Printf("property '%s' is out of date\n", name)
+						synced = false
+					}
+				}
+
+				if absent == len(f.members) {
+					return false, ErrResourceAbsent
+				}
+
+				return synced, nil
+			},
+			PropertySetFunc: func() error {
+				return f.forEachMember(func(m *File) error {
+					ok, err := m.PropertyList[i].IsSynced()
+					if err == ErrResourceAbsent || ok {
+						return nil
+					}
+
+					if err != nil {
+						return err
+					}
+
+					return m.PropertyList[i].Set()
+				})
+			},
+		}
+		properties = append(properties, property)
+	}
+
+	return properties
+}
+
+// diffMembers writes the differences of the content
+// for each of the paths to w.
+func (f *File) diffMembers(w io.Writer) (bool, error) {
+	changed := false
+	for _, m := range f.members {
+		ok, err := m.Diff(w)
+		if err != nil {
+			return changed, fmt.Errorf("%s: %s", m.Path, err)
+		}
+		changed = changed || ok
+	}
+
+	return changed, nil
+}
+
+// pendingBytesMembers returns the number of bytes, which would
+// be written to bring the content of all paths up to date.
+func (f *File) pendingBytesMembers() (int64, error) {
+	var total int64
+	for _, m := range f.members {
+		n, err := m.PendingBytes()
+		if err != nil {
+			return total, fmt.Errorf("%s: %s", m.Path, err)
+		}
+		total += n
+	}
+
+	return total, nil
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build ignore
+
+// The gendocs program generates the documentation of resource
+// types and their fields from the doc comments in the resource
+// package, which is used when describing the resource types.
+//
+// Usage:
+//   go run gendocs.go -output schema_docs.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// requiredRe matches a "Required." sentence in field doc comments.
+var requiredRe = regexp.MustCompile(`(^|\s)Required\.(\s|$)`)
+
+type fieldDoc struct {
+	name     string
+	doc      string
+	required bool
+}
+
+type typeDoc struct {
+	name     string
+	synopsis string
+	fields   []fieldDoc
+}
+
+func main() {
+	output := flag.String("output", "schema_docs.go", "file to write the generated docs to")
+	flag.Parse()
+
+	fset := token.NewFileSet()
+	notTest := func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != *output
+	}
+
+	pkgs, err := parser.ParseDir(fset, ".", notTest, parser.ParseComments)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pkg, ok := pkgs["resource"]
+	if !ok {
+		log.Fatal("package resource not found")
+	}
+
+	// Types declared in files for different platforms,
+	// e.g. services, are merged together
+	types := make(map[string]*typeDoc)
+	for _, f := range pkg.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			decl, ok := n.(*ast.GenDecl)
+			if !ok || decl.Tok != token.TYPE {
+				return true
+			}
+
+			for _, spec := range decl.Specs {
+				ts := spec.(*ast.TypeSpec)
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok || !ast.IsExported(ts.Name.Name) || !hasLuarTags(st) {
+					continue
+				}
+
+				text := ts.Doc.Text()
+				if text == "" {
+					text = decl.Doc.Text()
+				}
+
+				td, ok := types[ts.Name.Name]
+				if !ok {
+					td = &typeDoc{name: ts.Name.Name, synopsis: doc.Synopsis(text)}
+					types[ts.Name.Name] = td
+				}
+				td.fields = mergeFields(td.fields, structFields(st))
+			}
+
+			return false
+		})
+	}
+
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gendocs.go; DO NOT EDIT.\n\npackage resource\n\n")
+	buf.WriteString("var schemaDocs = map[string]typeDoc{\n")
+	for _, name := range names {
+		td := types[name]
+		fmt.Fprintf(&buf, "%q: {\nSynopsis: %q,\nFields: map[string]fieldDoc{\n", name, td.synopsis)
+		for _, fd := range td.fields {
+			fmt.Fprintf(&buf, "%q: {Doc: %q, Required: %t},\n", fd.name, fd.doc, fd.required)
+		}
+		buf.WriteString("},\n},\n")
+	}
+	buf.WriteString("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// hasLuarTags returns true if any of the struct fields has a luar
+// tag or is embedded, which tells resource types apart from other types.
+func hasLuarTags(st *ast.StructType) bool {
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			return true
+		}
+
+		if field.Tag == nil {
+			continue
+		}
+
+		tag, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := reflect.StructTag(tag).Lookup("luar"); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// structFields returns the documented fields of a struct,
+// which are exposed to Lua.
+func structFields(st *ast.StructType) []fieldDoc {
+	fields := make([]fieldDoc, 0)
+	for _, field := range st.Fields.List {
+		if field.Doc == nil || len(field.Names) == 0 {
+			continue
+		}
+
+		if field.Tag != nil {
+			tag, err := strconv.Unquote(field.Tag.Value)
+			if err == nil && reflect.StructTag(tag).Get("luar") == "-" {
+				continue
+			}
+		}
+
+		text := strings.Join(strings.Fields(field.Doc.Text()), " ")
+		for _, name := range field.Names {
+			if !name.IsExported() {
+				continue
+			}
+
+			fields = append(fields, fieldDoc{
+				name:     name.Name,
+				doc:      strings.Join(strings.Fields(requiredRe.ReplaceAllString(text, " ")), " "),
+				required: requiredRe.MatchString(text),
+			})
+		}
+	}
+
+	return fields
+}
+
+// mergeFields adds the fields, which are not yet documented.
+func mergeFields(fields, more []fieldDoc) []fieldDoc {
+	seen := make(map[string]bool)
+	for _, fd := range fields {
+		seen[fd.name] = true
+	}
+
+	for _, fd := range more {
+		if !seen[fd.name] {
+			fields = append(fields, fd)
+		}
+	}
+
+	return fields
+}
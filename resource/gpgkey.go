@@ -0,0 +1,306 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// DefaultKeyring is the keyring of the user running gpg.
+const DefaultKeyring = "default"
+
+// ErrNoKeySource error is returned when neither a URL,
+// nor the content of a GnuPG key is provided.
+var ErrNoKeySource = errors.New("No key URL or content provided")
+
+// GPGKey type is a resource which manages GnuPG public keys, e.g.
+// the keys used by package managers for verifying repositories.
+// The resource name is the id of the key, which may be the
+// fingerprint or the long key id.
+//
+// Keys are imported either into the default keyring of the user,
+// or dearmored into a dedicated keyring file, which contains the
+// key only, e.g. a keyring referenced by the signed-by option
+// of APT sources. Keys, whose fingerprint does not match the
+// key id are rejected.
+//
+// Example:
+//   key = resource.gpg_key.new("9DC858229FC7DD38854AE2D88D81803C0EBFCD88")
+//   key.state = "present"
+//   key.key_url = "https://download.docker.com/linux/ubuntu/gpg"
+//   key.keyring = "/etc/apt/keyrings/docker.gpg"
+type GPGKey struct {
+	Base
+
+	// KeyID is the fingerprint or the long id of the
+	// key. Defaults to the resource name.
+	KeyID string `luar:"key_id"`
+
+	// KeyURL is the URL from which the key is downloaded.
+	KeyURL string `luar:"key_url"`
+
+	// KeyContent is the ASCII-armored or binary key, which is
+	// used instead of downloading the key.
+	KeyContent string `luar:"key_content"`
+
+	// Keyring is the path to the keyring file, or "default" for
+	// the default keyring of the user. Defaults to "default".
+	Keyring string `luar:"keyring"`
+
+	// User whose keyring is managed, and as whom gpg is
+	// executed. Defaults to the user running gru.
+	User string `luar:"user"`
+}
+
+// NewGPGKey creates a new resource for managing GnuPG keys.
+func NewGPGKey(name string) (Resource, error) {
+	g := &GPGKey{
+		Base: Base{
+			Name:              name,
+			Type:              "gpg_key",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		KeyID:   name,
+		Keyring: DefaultKeyring,
+	}
+
+	return g, nil
+}
+
+// Validate validates the resource.
+func (g *GPGKey) Validate() error {
+	if err := g.Base.Validate(); err != nil {
+		return err
+	}
+
+	g.KeyID = strings.ToUpper(strings.Replace(strings.TrimPrefix(g.KeyID, "0x"), " ", "", -1))
+	if len(g.KeyID) < 16 || strings.Trim(g.KeyID, "0123456789ABCDEF") != "" {
+		return fmt.Errorf("invalid key id '%s', expected the fingerprint or long key id", g.KeyID)
+	}
+
+	if g.State == "present" && g.KeyURL == "" && g.KeyContent == "" {
+		return ErrNoKeySource
+	}
+
+	if g.KeyURL != "" && g.KeyContent != "" {
+		return errors.New("key URL and content are mutually exclusive")
+	}
+
+	if g.Keyring != DefaultKeyring && !filepath.IsAbs(g.Keyring) {
+		return fmt.Errorf("invalid keyring '%s', expected an absolute path or '%s'", g.Keyring, DefaultKeyring)
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the key.
+func (g *GPGKey) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    g.State,
+	}
+
+	// Listing keys of a missing keyring would create it
+	if g.Keyring != DefaultKeyring {
+		if _, err := os.Stat(g.Keyring); os.IsNotExist(err) {
+			state.Current = "absent"
+			return state, nil
+		}
+	}
+
+	// The exit status is 2 if the key is not found
+	result, err := g.gpg(nil, g.keyringArgs("--list-keys", "--with-colons", g.KeyID)...)
+	switch {
+	case err == nil:
+		state.Current = "present"
+	case result.ExitCode == 2:
+		state.Current = "absent"
+	default:
+		return state, err
+	}
+
+	return state, nil
+}
+
+// Create imports the key into the keyring.
+func (g *GPGKey) Create() error {
+	key, err := g.key()
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := g.fingerprint(key)
+	if err != nil {
+		return err
+	}
+
+	if g.Keyring == DefaultKeyring {
+		g.Printf("importing key %s\n", fingerprint)
+		_, err := g.gpg(key, "--import")
+
+		return err
+	}
+
+	// Keyring files contain binary keys
+	g.Printf("importing key %s into %s\n", fingerprint, g.Keyring)
+	if bytes.HasPrefix(bytes.TrimSpace(key), []byte("-----BEGIN")) {
+		result, err := g.gpg(key, "--dearmor")
+		if err != nil {
+			return err
+		}
+		key = result.Stdout
+	}
+
+	if err := os.MkdirAll(filepath.Dir(g.Keyring), 0755); err != nil {
+		return err
+	}
+
+	return writeFile(g.Keyring, key, 0644)
+}
+
+// Delete removes the key from the keyring. Keys are
+// deleted by fingerprint, as required in batch mode.
+func (g *GPGKey) Delete() error {
+	result, err := g.gpg(nil, g.keyringArgs("--list-keys", "--with-colons", g.KeyID)...)
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := g.matchFingerprint(result.Stdout)
+	if err != nil {
+		return err
+	}
+
+	g.Printf("removing key %s\n", fingerprint)
+	_, err = g.gpg(nil, g.keyringArgs("--delete-keys", fingerprint)...)
+
+	return err
+}
+
+// key returns the key material, downloading it if needed.
+func (g *GPGKey) key() ([]byte, error) {
+	if g.KeyContent != "" {
+		return []byte(g.KeyContent), nil
+	}
+
+	var buf bytes.Buffer
+	if err := utils.Fetch(context.Background(), g.KeyURL, "", &buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// fingerprint returns the fingerprint of the primary key in the
+// key material, which must match the key id of the resource.
+func (g *GPGKey) fingerprint(key []byte) (string, error) {
+	result, err := g.gpg(key, "--show-keys", "--with-colons")
+	if err != nil {
+		return "", err
+	}
+
+	return g.matchFingerprint(result.Stdout)
+}
+
+// matchFingerprint returns the fingerprint of the single primary key
+// listed by gpg, which must match the key id of the resource.
+func (g *GPGKey) matchFingerprint(output []byte) (string, error) {
+	var fingerprints []string
+	primary := false
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, ":")
+		switch {
+		case fields[0] == "pub":
+			primary = true
+		case fields[0] == "fpr" && primary && len(fields) > 9:
+			fingerprints = append(fingerprints, fields[9])
+			primary = false
+		}
+	}
+
+	if len(fingerprints) != 1 {
+		return "", fmt.Errorf("expected a single key, found %d keys", len(fingerprints))
+	}
+
+	if !strings.HasSuffix(fingerprints[0], g.KeyID) {
+		return "", fmt.Errorf("key %s does not match key id %s", fingerprints[0], g.KeyID)
+	}
+
+	return fingerprints[0], nil
+}
+
+// keyringArgs returns the arguments of gpg for using the
+// keyring of the resource, followed by the given ones.
+func (g *GPGKey) keyringArgs(args ...string) []string {
+	if g.Keyring == DefaultKeyring {
+		return args
+	}
+
+	return append([]string{"--no-default-keyring", "--keyring", g.Keyring}, args...)
+}
+
+// gpg executes gpg in batch mode with the given input. Errors
+// only include the standard error of gpg, as the standard
+// output may contain the key material.
+func (g *GPGKey) gpg(input []byte, args ...string) (utils.CommandResult, error) {
+	spec := utils.CommandSpec{
+		Args: append([]string{"gpg", "--batch", "--yes"}, args...),
+		User: g.User,
+	}
+	if input != nil {
+		spec.Stdin = bytes.NewReader(input)
+	}
+
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return result, fmt.Errorf("gpg failed: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return result, nil
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "gpg_key",
+		Provider:  NewGPGKey,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestGPGKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fingerprint := "9DC858229FC7DD38854AE2D88D81803C0EBFCD88"
+	armored := "-----BEGIN PGP PUBLIC KEY BLOCK-----\nmQINBFit2ioBEADhWpZ8\n-----END PGP PUBLIC KEY BLOCK-----\n"
+	colons := "pub:-:4096:1:8D81803C0EBFCD88:1487788586:::-:::scESPA::::::23::0:\n" +
+		"fpr:::::::::" + fingerprint + ":\n" +
+		"uid:-::::1487788586::::Docker Release (CE deb) <docker@docker.com>::::::::::0:\n" +
+		"sub:-:4096:1:7EA0A9C3F273FCD8:1487792064::::::s::::::23:\n" +
+		"fpr:::::::::D3306A018370199E527AE7997EA0A9C3F273FCD8:\n"
+
+	// Fake gpg, which lists the key once imported
+	var commands []string
+	imported := false
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		args := strings.Join(spec.Args, " ")
+		commands = append(commands, args)
+		switch {
+		case strings.Contains(args, "--show-keys"):
+			return utils.CommandResult{Stdout: []byte(colons)}, nil
+		case strings.Contains(args, "--dearmor"):
+			return utils.CommandResult{Stdout: []byte("binary key")}, nil
+		case strings.Contains(args, "--list-keys") && imported:
+			return utils.CommandResult{Stdout: []byte(colons)}, nil
+		case strings.Contains(args, "--list-keys"):
+			return utils.CommandResult{ExitCode: 2}, errors.New("exit status 2")
+		}
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	var buf bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&buf, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	keyring := filepath.Join(dir, "keyrings", "docker.gpg")
+	L := newLuaState()
+	defer L.Close()
+
+	code := `
+	key = resource.gpg_key.new("0x8D81803C0EBFCD88")
+	key.key_content = [[` + armored + `]]
+	key.keyring = "` + keyring + `"
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	g := luaResource(L, "key").(*GPGKey)
+	if err := g.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "8D81803C0EBFCD88", g.KeyID)
+
+	state, err := g.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := g.Create(); err != nil {
+		t.Fatal(err)
+	}
+	imported = true
+
+	data, err := ioutil.ReadFile(keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "binary key", string(data))
+
+	state, err = g.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+
+	commands = nil
+	if err := g.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"gpg --batch --yes --no-default-keyring --keyring " + keyring + " --list-keys --with-colons 8D81803C0EBFCD88",
+		"gpg --batch --yes --no-default-keyring --keyring " + keyring + " --delete-keys " + fingerprint,
+	}
+	errorIfNotEqual(t, want, commands)
+
+	// The fingerprint is logged, but not the key material
+	if !strings.Contains(buf.String(), fingerprint) {
+		t.Errorf("want fingerprint logged, got %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "mQINBFit2ioBEADhWpZ8") {
+		t.Errorf("want key material not logged, got %q", buf.String())
+	}
+
+	// Keys not matching the key id are rejected
+	g.KeyID = "0123456789ABCDEF"
+	if err := g.Create(); err == nil {
+		t.Error("want error for mismatching key")
+	}
+
+	// Default keyrings import the key
+	g.KeyID = fingerprint
+	g.Keyring = DefaultKeyring
+	commands = nil
+	if err := g.Create(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "gpg --batch --yes --import", commands[len(commands)-1])
+
+	// Invalid key ids and missing keys are rejected
+	g.KeyID = "EBFCD88"
+	if err := g.Validate(); err == nil {
+		t.Error("want error for short key id")
+	}
+
+	g.KeyID = fingerprint
+	g.KeyContent = ""
+	if err := g.Validate(); err != ErrNoKeySource {
+		t.Errorf("want ErrNoKeySource, got %v", err)
+	}
+}
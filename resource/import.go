@@ -0,0 +1,165 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Import creates a resource using the provider and populates it from
+// the current state of the system. An error is returned if the
+// resource type does not implement the Importer interface.
+func Import(item ProviderItem, name string) (Resource, error) {
+	r, err := item.Provider(name)
+	if err != nil {
+		return nil, err
+	}
+
+	importer, ok := r.(Importer)
+	if !ok {
+		return nil, fmt.Errorf("resource type %s.%s does not support importing", item.Namespace, item.Type)
+	}
+
+	if err := r.Initialize(); err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if err := importer.Import(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Declaration returns the declaration of a resource created by the
+// provider in Lua. Only attributes differing from the defaults of the
+// provider are declared, along with the state of the resource.
+// Sensitive attributes are never declared.
+func Declaration(item ProviderItem, r Resource) (string, error) {
+	v := reflect.ValueOf(r)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	name := v.FieldByName("Name").String()
+	defaults, err := item.Provider(name)
+	if err != nil {
+		return "", err
+	}
+
+	d := reflect.ValueOf(defaults)
+	for d.Kind() == reflect.Ptr {
+		d = d.Elem()
+	}
+
+	schema := Schema{Namespace: item.Namespace, Type: item.Type}
+	attrs := make([]string, 0)
+	declaredAttributes(v, d, &attrs)
+
+	varName := schema.varName()
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s = %s.%s.new(%q)\n", varName, item.Namespace, item.Type, name)
+	for _, attr := range attrs {
+		fmt.Fprintf(&b, "%s.%s\n", varName, attr)
+	}
+
+	return b.String(), nil
+}
+
+// declaredAttributes appends the attributes of a struct in the form of
+// "name = value", which differ from the ones in the struct of defaults.
+func declaredAttributes(v, defaults reflect.Value, attrs *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("luar")
+		if tag == "-" {
+			continue
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			declaredAttributes(v.Field(i), defaults.Field(i), attrs)
+			continue
+		}
+
+		if f.PkgPath != "" || f.Tag.Get("gru") == "sensitive" {
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = strings.ToLower(f.Name[:1]) + f.Name[1:]
+		}
+
+		// The state is always declared
+		if name != "state" && reflect.DeepEqual(v.Field(i).Interface(), defaults.Field(i).Interface()) {
+			continue
+		}
+
+		if value := luaValue(v.Field(i)); value != "" {
+			*attrs = append(*attrs, name+" = "+value)
+		}
+	}
+}
+
+// luaValue returns the value as a Lua expression, including zero
+// and empty values. Returns an empty string for values which cannot
+// be expressed in Lua, e.g. functions.
+func luaValue(v reflect.Value) string {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "nil"
+		}
+		v = v.Elem()
+	}
+
+	if literal := luaLiteral(v); literal != "" {
+		return literal
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return `""`
+	case reflect.Bool:
+		return "false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "0"
+	case reflect.Slice, reflect.Map:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return `""`
+		}
+		if v.Len() == 0 {
+			return "{}"
+		}
+	}
+
+	return ""
+}
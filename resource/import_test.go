@@ -0,0 +1,104 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nginx.conf")
+	if err := ioutil.WriteFile(path, []byte("worker_processes 4;\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := LookupProvider("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{path, filepath.Join(dir, "missing.conf")} {
+		r, err := Import(item, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		declaration, err := Declaration(item, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The declared resource is in sync with the system
+		L := newLuaState()
+		defer L.Close()
+		if err := L.DoString(declaration); err != nil {
+			t.Fatalf("%s: %s", declaration, err)
+		}
+
+		f := luaResource(L, "file").(*File)
+		if err := f.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+
+		state, err := f.Evaluate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		errorIfNotEqual(t, state.Want, state.Current)
+
+		if state.Current == "present" {
+			errorIfNotEqual(t, []string{}, outOfSync(t, f))
+			if !strings.Contains(declaration, `file.mode = tonumber("0600", 8)`) {
+				t.Errorf("want mode to be declared, got %q", declaration)
+			}
+		}
+	}
+
+	// Resource types must opt in
+	item, err = LookupProvider("shell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(item, "true"); err == nil {
+		t.Error("want error for resource type without importer")
+	}
+}
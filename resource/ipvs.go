@@ -0,0 +1,489 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// ipvsRulesFile is the file in which the IPVS rules are persisted,
+// so that they are restored on boot by the ipvsadm service.
+const ipvsRulesFile = "/etc/ipvsadm.rules"
+
+// ipvsSchedulers contains the supported scheduling algorithms.
+var ipvsSchedulers = []string{"rr", "lc", "wrr"}
+
+// ipvsProtocolFlags maps the supported protocols to
+// the ipvsadm flags selecting a virtual service.
+var ipvsProtocolFlags = map[string]string{
+	"tcp": "-t",
+	"udp": "-u",
+}
+
+// IPVSRealServer type represents a real server, to which
+// an IPVS virtual service forwards connections.
+type IPVSRealServer struct {
+	// Address of the real server in the form of "address:port".
+	// Defaults to the port of the virtual service if no port is given.
+	Address string `luar:"address"`
+
+	// Weight of the real server. Defaults to 1.
+	Weight int `luar:"weight"`
+}
+
+// IPVSVirtualService type is a resource which manages IPVS virtual
+// services and their real servers on a GNU/Linux system using
+// ipvsadm(8). The resource name is the address of the virtual
+// service, e.g. "10.0.0.10:80".
+//
+// Real servers are added, removed and updated individually, so that
+// connections to unchanged real servers are not affected. When
+// persistent, all IPVS rules are saved to /etc/ipvsadm.rules.
+//
+// Example:
+//   web = resource.ipvs_virtual_service.new("10.0.0.10:80")
+//   web.state = "present"
+//   web.scheduler = "wrr"
+//   web.real_servers = {
+//     { address = "10.0.0.11:80", weight = 2 },
+//     { address = "10.0.0.12:80", weight = 1 },
+//   }
+//   web.persistent = true
+type IPVSVirtualService struct {
+	Base
+
+	// VIP is the address of the virtual service in the form of
+	// "address:port". Defaults to the resource name.
+	VIP string `luar:"vip"`
+
+	// Protocol of the virtual service, either "tcp" or "udp".
+	// Defaults to "tcp".
+	Protocol string `luar:"protocol"`
+
+	// Scheduler is the scheduling algorithm, either "rr", "lc"
+	// or "wrr". Defaults to "rr".
+	Scheduler string `luar:"scheduler"`
+
+	// RealServers contains the real servers of the virtual service.
+	RealServers []IPVSRealServer `luar:"real_servers"`
+
+	// Persistent specifies whether the IPVS rules are saved,
+	// so that they are restored on boot.
+	Persistent bool `luar:"persistent"`
+
+	// File in which the rules are persisted
+	rulesFile string `luar:"-"`
+}
+
+// ipvsService type represents a virtual service
+// as listed by ipvsadm.
+type ipvsService struct {
+	scheduler string
+
+	// Weights of the real servers keyed by their address
+	realServers map[string]int
+}
+
+// NewIPVSVirtualService creates a new resource for
+// managing IPVS virtual services.
+func NewIPVSVirtualService(name string) (Resource, error) {
+	s := &IPVSVirtualService{
+		Base: Base{
+			Name:              name,
+			Type:              "ipvs_virtual_service",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// All rules are saved to a single file
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		VIP:         name,
+		Protocol:    "tcp",
+		Scheduler:   "rr",
+		RealServers: make([]IPVSRealServer, 0),
+		rulesFile:   ipvsRulesFile,
+	}
+
+	s.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "scheduler",
+			PropertySetFunc:      s.setScheduler,
+			PropertyIsSyncedFunc: s.isSchedulerSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "real_servers",
+			PropertySetFunc:      s.setRealServers,
+			PropertyIsSyncedFunc: s.isRealServersSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "persistent",
+			PropertySetFunc:      s.setPersistent,
+			PropertyIsSyncedFunc: s.isPersistentSynced,
+		},
+	}
+
+	return s, nil
+}
+
+// Validate validates the resource.
+func (s *IPVSVirtualService) Validate() error {
+	if err := s.Base.Validate(); err != nil {
+		return err
+	}
+
+	vip, err := normalizeIPVSAddress(s.VIP, "")
+	if err != nil {
+		return fmt.Errorf("invalid vip '%s'", s.VIP)
+	}
+	s.VIP = vip
+
+	if _, ok := ipvsProtocolFlags[s.Protocol]; !ok {
+		return fmt.Errorf("invalid protocol '%s'", s.Protocol)
+	}
+
+	if !utils.NewString(s.Scheduler).IsInList(utils.NewList(ipvsSchedulers...)) {
+		return fmt.Errorf("invalid scheduler '%s'", s.Scheduler)
+	}
+
+	_, port, _ := net.SplitHostPort(s.VIP)
+	seen := make(map[string]bool)
+	for i, rs := range s.RealServers {
+		address, err := normalizeIPVSAddress(rs.Address, port)
+		if err != nil {
+			return fmt.Errorf("invalid real server address '%s'", rs.Address)
+		}
+
+		if seen[address] {
+			return fmt.Errorf("duplicate real server '%s'", address)
+		}
+		seen[address] = true
+
+		if rs.Weight < 0 || rs.Weight > 65535 {
+			return fmt.Errorf("invalid weight %d for real server '%s'", rs.Weight, address)
+		}
+
+		if rs.Weight == 0 {
+			s.RealServers[i].Weight = 1
+		}
+		s.RealServers[i].Address = address
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the virtual service.
+func (s *IPVSVirtualService) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    s.State,
+	}
+
+	_, err := s.service()
+	switch err {
+	case nil:
+		state.Current = "present"
+	case ErrResourceAbsent:
+		state.Current = "absent"
+	default:
+		return state, err
+	}
+
+	return state, nil
+}
+
+// Create creates the virtual service and adds its real servers.
+func (s *IPVSVirtualService) Create() error {
+	s.Printf("creating virtual service with %s scheduler\n", s.Scheduler)
+
+	if err := s.run("-A", s.serviceFlag(), s.VIP, "-s", s.Scheduler); err != nil {
+		return err
+	}
+
+	for _, rs := range s.RealServers {
+		s.Printf("adding real server %s with weight %d\n", rs.Address, rs.Weight)
+		if err := s.run("-a", s.serviceFlag(), s.VIP, "-r", rs.Address, "-w", strconv.Itoa(rs.Weight)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the virtual service along with its real
+// servers, saving the remaining rules if persistent.
+func (s *IPVSVirtualService) Delete() error {
+	s.Printf("removing virtual service\n")
+
+	if err := s.run("-D", s.serviceFlag(), s.VIP); err != nil {
+		return err
+	}
+
+	if !s.Persistent {
+		return nil
+	}
+
+	return s.setPersistent()
+}
+
+// serviceFlag returns the ipvsadm flag selecting
+// the virtual service for its protocol.
+func (s *IPVSVirtualService) serviceFlag() string {
+	return ipvsProtocolFlags[s.Protocol]
+}
+
+// service returns the virtual service as listed by ipvsadm.
+func (s *IPVSVirtualService) service() (*ipvsService, error) {
+	out, err := s.output("ipvsadm", "-L", "-n")
+	if err != nil {
+		return nil, err
+	}
+
+	services := parseIPVSServices(out)
+	service, ok := services[s.Protocol+" "+s.VIP]
+	if !ok {
+		return nil, ErrResourceAbsent
+	}
+
+	return service, nil
+}
+
+// isSchedulerSynced checks whether the virtual
+// service uses the desired scheduler.
+func (s *IPVSVirtualService) isSchedulerSynced() (bool, error) {
+	service, err := s.service()
+	if err != nil {
+		return false, err
+	}
+
+	return service.scheduler == s.Scheduler, nil
+}
+
+// setScheduler changes the scheduler of the virtual service.
+func (s *IPVSVirtualService) setScheduler() error {
+	s.Printf("setting scheduler to %s\n", s.Scheduler)
+
+	return s.run("-E", s.serviceFlag(), s.VIP, "-s", s.Scheduler)
+}
+
+// isRealServersSynced checks whether the virtual service has
+// the desired real servers with the desired weights.
+func (s *IPVSVirtualService) isRealServersSynced() (bool, error) {
+	service, err := s.service()
+	if err != nil {
+		return false, err
+	}
+
+	if len(service.realServers) != len(s.RealServers) {
+		return false, nil
+	}
+
+	for _, rs := range s.RealServers {
+		if weight, ok := service.realServers[rs.Address]; !ok || weight != rs.Weight {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// setRealServers adds missing real servers, updates the weights of
+// existing ones and removes the ones, which should not be present.
+func (s *IPVSVirtualService) setRealServers() error {
+	service, err := s.service()
+	if err != nil {
+		return err
+	}
+
+	want := make(map[string]bool)
+	for _, rs := range s.RealServers {
+		want[rs.Address] = true
+
+		weight, ok := service.realServers[rs.Address]
+		switch {
+		case !ok:
+			s.Printf("adding real server %s with weight %d\n", rs.Address, rs.Weight)
+			err = s.run("-a", s.serviceFlag(), s.VIP, "-r", rs.Address, "-w", strconv.Itoa(rs.Weight))
+		case weight != rs.Weight:
+			s.Printf("setting weight of real server %s to %d\n", rs.Address, rs.Weight)
+			err = s.run("-e", s.serviceFlag(), s.VIP, "-r", rs.Address, "-w", strconv.Itoa(rs.Weight))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	addresses := make([]string, 0)
+	for address := range service.realServers {
+		if !want[address] {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+
+	for _, address := range addresses {
+		s.Printf("removing real server %s\n", address)
+		if err := s.run("-d", s.serviceFlag(), s.VIP, "-r", address); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isPersistentSynced checks whether the saved rules match the
+// current rules, unless the rules should not be persisted.
+func (s *IPVSVirtualService) isPersistentSynced() (bool, error) {
+	if _, err := s.service(); err != nil {
+		return false, err
+	}
+
+	if !s.Persistent {
+		return true, nil
+	}
+
+	rules, err := s.output("ipvsadm-save", "-n")
+	if err != nil {
+		return false, err
+	}
+
+	data, err := ioutil.ReadFile(s.rulesFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return string(data) == rules, nil
+}
+
+// setPersistent saves the current rules.
+func (s *IPVSVirtualService) setPersistent() error {
+	s.Printf("saving rules to %s\n", s.rulesFile)
+
+	rules, err := s.output("ipvsadm-save", "-n")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(s.rulesFile, []byte(rules), 0644)
+}
+
+// output executes a command and returns its output.
+func (s *IPVSVirtualService) output(name string, args ...string) (string, error) {
+	spec := utils.CommandSpec{Args: append([]string{name}, args...)}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %s: %s", name, err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return string(result.Stdout), nil
+}
+
+// run executes ipvsadm with the given arguments.
+func (s *IPVSVirtualService) run(args ...string) error {
+	_, err := s.output("ipvsadm", args...)
+
+	return err
+}
+
+// normalizeIPVSAddress normalizes an address in the form of
+// "address:port", as listed by ipvsadm. Addresses without a
+// port use the default port, if one is given.
+func normalizeIPVSAddress(address, defaultPort string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil && defaultPort != "" {
+		host, port, err = strings.Trim(address, "[]"), defaultPort, nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", fmt.Errorf("invalid ip address '%s'", host)
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid port '%s'", port)
+	}
+
+	return net.JoinHostPort(ip.String(), port), nil
+}
+
+// parseIPVSServices parses the output of "ipvsadm -L -n" and
+// returns the virtual services keyed by their protocol and address.
+func parseIPVSServices(out string) map[string]*ipvsService {
+	services := make(map[string]*ipvsService)
+
+	var current *ipvsService
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 4 && fields[0] == "->":
+			weight, err := strconv.Atoi(fields[3])
+			if current == nil || err != nil {
+				continue
+			}
+			current.realServers[fields[1]] = weight
+		case len(fields) >= 3 && (fields[0] == "TCP" || fields[0] == "UDP"):
+			current = &ipvsService{
+				scheduler:   fields[2],
+				realServers: make(map[string]int),
+			}
+			services[strings.ToLower(fields[0])+" "+fields[1]] = current
+		case len(fields) > 0 && fields[0] != "->":
+			current = nil
+		}
+	}
+
+	return services
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "ipvs_virtual_service",
+		Provider:  NewIPVSVirtualService,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
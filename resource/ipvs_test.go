@@ -0,0 +1,217 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestIPVSVirtualService(t *testing.T) {
+	L := newLuaState()
+	defer L.Close()
+
+	const code = `
+	web = resource.ipvs_virtual_service.new("10.0.0.10:80")
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	s := luaResource(L, "web").(*IPVSVirtualService)
+	errorIfNotEqual(t, "ipvs_virtual_service", s.Type)
+	errorIfNotEqual(t, "10.0.0.10:80", s.Name)
+	errorIfNotEqual(t, "present", s.State)
+	errorIfNotEqual(t, false, s.Concurrent)
+	errorIfNotEqual(t, "10.0.0.10:80", s.VIP)
+	errorIfNotEqual(t, "tcp", s.Protocol)
+	errorIfNotEqual(t, "rr", s.Scheduler)
+	errorIfNotEqual(t, []IPVSRealServer{}, s.RealServers)
+	errorIfNotEqual(t, false, s.Persistent)
+}
+
+func TestIPVSVirtualServiceValidate(t *testing.T) {
+	testCases := []struct {
+		vip         string
+		scheduler   string
+		realServers []IPVSRealServer
+		wantErr     bool
+	}{
+		{"10.0.0.10:80", "rr", []IPVSRealServer{{Address: "10.0.0.11:80"}}, false},
+		{"[fd00::10]:443", "wrr", []IPVSRealServer{{Address: "fd00::11"}}, false},
+		{"10.0.0.10", "rr", nil, true},
+		{"example.org:80", "rr", nil, true},
+		{"10.0.0.10:80", "sh", nil, true},
+		{"10.0.0.10:80", "lc", []IPVSRealServer{{Address: "10.0.0.11:http"}}, true},
+		{"10.0.0.10:80", "lc", []IPVSRealServer{{Address: "10.0.0.11:80", Weight: -1}}, true},
+		{"10.0.0.10:80", "lc", []IPVSRealServer{{Address: "10.0.0.11"}, {Address: "10.0.0.11:80"}}, true},
+	}
+
+	for _, tc := range testCases {
+		r, err := NewIPVSVirtualService(tc.vip)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := r.(*IPVSVirtualService)
+		s.Scheduler = tc.scheduler
+		s.RealServers = tc.realServers
+		if err := s.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("vip %s, scheduler %s, real servers %v: unexpected error %v", tc.vip, tc.scheduler, tc.realServers, err)
+		}
+	}
+
+	// Real servers default to the port of the virtual service and a weight of 1
+	r, err := NewIPVSVirtualService("[fd00::10]:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := r.(*IPVSVirtualService)
+	s.RealServers = []IPVSRealServer{{Address: "fd00::11"}, {Address: "[fd00::12]:8443", Weight: 3}}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []IPVSRealServer{{Address: "[fd00::11]:443", Weight: 1}, {Address: "[fd00::12]:8443", Weight: 3}}
+	errorIfNotEqual(t, want, s.RealServers)
+}
+
+func TestIPVSVirtualServiceProperties(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-ipvs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake the commands being executed
+	listing := ""
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		switch {
+		case spec.Args[0] == "ipvsadm-save":
+			return utils.CommandResult{Stdout: []byte("-A -t 10.0.0.10:80 -s wrr\n")}, nil
+		case len(spec.Args) > 1 && spec.Args[1] == "-L":
+			return utils.CommandResult{Stdout: []byte(listing)}, nil
+		}
+		commands = append(commands, strings.Join(spec.Args, " "))
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	r, err := NewIPVSVirtualService("10.0.0.10:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := r.(*IPVSVirtualService)
+	s.Scheduler = "wrr"
+	s.RealServers = []IPVSRealServer{{Address: "10.0.0.11", Weight: 2}, {Address: "10.0.0.12:80"}}
+	s.Persistent = true
+	s.rulesFile = filepath.Join(dir, "ipvsadm.rules")
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := s.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+	_, err = s.isPersistentSynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	if err := s.Create(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ipvsadm -A -t 10.0.0.10:80 -s wrr",
+		"ipvsadm -a -t 10.0.0.10:80 -r 10.0.0.11:80 -w 2",
+		"ipvsadm -a -t 10.0.0.10:80 -r 10.0.0.12:80 -w 1",
+	}
+	errorIfNotEqual(t, want, commands)
+
+	// Fake a service with a different scheduler and real servers
+	listing = `IP Virtual Server version 1.2.1 (size=4096)
+Prot LocalAddress:Port Scheduler Flags
+  -> RemoteAddress:Port           Forward Weight ActiveConn InActConn
+UDP  10.0.0.10:80 wrr
+  -> 10.0.0.13:80                 Route   1      0          0
+TCP  10.0.0.10:80 rr
+  -> 10.0.0.11:80                 Route   1      0          0
+  -> 10.0.0.13:80                 Route   1      0          0
+`
+
+	state, err = s.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+	errorIfNotEqual(t, []string{"scheduler", "real_servers", "persistent"}, outOfSync(t, s))
+
+	commands = nil
+	for _, p := range s.Properties() {
+		if err := p.Set(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want = []string{
+		"ipvsadm -E -t 10.0.0.10:80 -s wrr",
+		"ipvsadm -e -t 10.0.0.10:80 -r 10.0.0.11:80 -w 2",
+		"ipvsadm -a -t 10.0.0.10:80 -r 10.0.0.12:80 -w 1",
+		"ipvsadm -d -t 10.0.0.10:80 -r 10.0.0.13:80",
+	}
+	errorIfNotEqual(t, want, commands)
+
+	data, err := ioutil.ReadFile(s.rulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "-A -t 10.0.0.10:80 -s wrr\n", string(data))
+
+	// Fake the service being in sync
+	listing = `TCP  10.0.0.10:80 wrr
+  -> 10.0.0.11:80                 Route   2      0          0
+  -> 10.0.0.12:80                 Masq    1      0          0
+`
+	errorIfNotEqual(t, []string{}, outOfSync(t, s))
+
+	commands = nil
+	if err := s.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"ipvsadm -D -t 10.0.0.10:80"}, commands)
+}
@@ -0,0 +1,451 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// keepalivedConfigFile is the Keepalived configuration file.
+const keepalivedConfigFile = "/etc/keepalived/keepalived.conf"
+
+// keepalivedMaxAuthPass is the maximum length of the VRRP
+// password, since Keepalived ignores any further characters.
+const keepalivedMaxAuthPass = 8
+
+// KeepalivedVRRP type is a resource which manages
+// Keepalived VRRP instances.
+//
+// Only the vrrp_instance block of the instance is managed. Any other
+// content of the configuration file is preserved. Keepalived is
+// reloaded after the configuration file has been changed, if it is
+// running. The password of the instance is never logged.
+//
+// Example:
+//   vi = resource.keepalived_vrrp.new("VI_1")
+//   vi.state = "present"
+//   vi.interface = "eth0"
+//   vi.virtual_router_id = 51
+//   vi.priority = 150
+//   vi.virtual_ips = { "192.168.1.10/24" }
+//   vi.auth_pass = "s3cret"
+//   vi.notify_master = "/usr/local/bin/became-master.sh"
+type KeepalivedVRRP struct {
+	Base
+
+	// Interface on which the instance runs.
+	Interface string `luar:"interface"`
+
+	// VirtualRouterID is the id of the virtual router,
+	// which is shared by all nodes of the instance.
+	VirtualRouterID int `luar:"virtual_router_id"`
+
+	// Priority of the node in the election of the
+	// master. Defaults to 100.
+	Priority int `luar:"priority"`
+
+	// VirtualIPs contains the addresses of the instance,
+	// e.g. "192.168.1.10/24". Required.
+	VirtualIPs []string `luar:"virtual_ips"`
+
+	// AuthPass is the password used to authenticate the VRRP
+	// packets. Defaults to no authentication.
+	AuthPass string `luar:"auth_pass" gru:"sensitive"`
+
+	// NotifyMaster is the script executed when
+	// the node becomes the master.
+	NotifyMaster string `luar:"notify_master"`
+
+	// NotifyBackup is the script executed when
+	// the node becomes a backup.
+	NotifyBackup string `luar:"notify_backup"`
+
+	// NotifyFault is the script executed when
+	// the instance enters the fault state.
+	NotifyFault string `luar:"notify_fault"`
+
+	// ConfigFile is the path to the Keepalived configuration
+	// file. Defaults to /etc/keepalived/keepalived.conf.
+	ConfigFile string `luar:"config_file"`
+}
+
+// NewKeepalivedVRRP creates a new resource for
+// managing Keepalived VRRP instances.
+func NewKeepalivedVRRP(name string) (Resource, error) {
+	k := &KeepalivedVRRP{
+		Base: Base{
+			Name:              name,
+			Type:              "keepalived_vrrp",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// All instances are kept in the same file
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		Priority:   100,
+		VirtualIPs: make([]string, 0),
+		ConfigFile: keepalivedConfigFile,
+	}
+
+	k.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "config",
+			PropertySetFunc:      k.setConfig,
+			PropertyIsSyncedFunc: k.isConfigSynced,
+		},
+	}
+
+	return k, nil
+}
+
+// Validate validates the resource.
+func (k *KeepalivedVRRP) Validate() error {
+	if err := k.Base.Validate(); err != nil {
+		return err
+	}
+
+	if strings.ContainsAny(k.Name, " \t\n{}\"#!") {
+		return fmt.Errorf("invalid instance name '%s'", k.Name)
+	}
+
+	if k.State == "absent" {
+		return nil
+	}
+
+	if k.Interface == "" || strings.ContainsAny(k.Interface, " \t\n{}\"#!") {
+		return fmt.Errorf("invalid interface '%s'", k.Interface)
+	}
+
+	if k.VirtualRouterID < 1 || k.VirtualRouterID > 255 {
+		return fmt.Errorf("invalid virtual_router_id %d", k.VirtualRouterID)
+	}
+
+	if k.Priority < 1 || k.Priority > 255 {
+		return fmt.Errorf("invalid priority %d", k.Priority)
+	}
+
+	if len(k.VirtualIPs) == 0 {
+		return errors.New("at least one virtual ip is required")
+	}
+
+	for _, ip := range k.VirtualIPs {
+		if net.ParseIP(ip) == nil {
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				return fmt.Errorf("invalid virtual ip '%s'", ip)
+			}
+		}
+	}
+
+	// Do not include the password in the errors
+	if len(k.AuthPass) > keepalivedMaxAuthPass || strings.ContainsAny(k.AuthPass, " \t\n{}\"#!") {
+		return fmt.Errorf("invalid auth_pass, must be at most %d characters without whitespace, braces, quotes or comments", keepalivedMaxAuthPass)
+	}
+
+	for _, script := range []string{k.NotifyMaster, k.NotifyBackup, k.NotifyFault} {
+		if strings.ContainsAny(script, "\n\"") {
+			return fmt.Errorf("invalid notify script '%s'", script)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the instance.
+func (k *KeepalivedVRRP) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    k.State,
+	}
+
+	lines, err := k.readConfig()
+	if err != nil {
+		return state, err
+	}
+
+	start, _, err := k.findBlock(lines)
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "absent"
+	if start >= 0 {
+		state.Current = "present"
+	}
+
+	return state, nil
+}
+
+// Create adds the instance to the configuration file.
+func (k *KeepalivedVRRP) Create() error {
+	k.Printf("adding vrrp_instance %s to %s\n", k.Name, k.ConfigFile)
+
+	return k.setConfig()
+}
+
+// Delete removes the instance from the configuration file.
+func (k *KeepalivedVRRP) Delete() error {
+	k.Printf("removing vrrp_instance %s from %s\n", k.Name, k.ConfigFile)
+
+	lines, err := k.readConfig()
+	if err != nil {
+		return err
+	}
+
+	start, end, err := k.findBlock(lines)
+	if err != nil || start < 0 {
+		return err
+	}
+
+	// Remove the blank line separating the block, if any
+	result := append(lines[:start:start], lines[end+1:]...)
+	if start > 0 && strings.TrimSpace(result[start-1]) == "" && (start == len(result) || strings.TrimSpace(result[start]) == "") {
+		result = append(result[:start-1], result[start:]...)
+	}
+
+	if err := k.writeConfig(result); err != nil {
+		return err
+	}
+
+	return k.reload()
+}
+
+// block returns the lines of the vrrp_instance block of the instance.
+func (k *KeepalivedVRRP) block() []string {
+	block := []string{
+		fmt.Sprintf("vrrp_instance %s {", k.Name),
+		fmt.Sprintf("    interface %s", k.Interface),
+		fmt.Sprintf("    virtual_router_id %d", k.VirtualRouterID),
+		fmt.Sprintf("    priority %d", k.Priority),
+	}
+
+	if k.AuthPass != "" {
+		block = append(block,
+			"    authentication {",
+			"        auth_type PASS",
+			"        auth_pass "+k.AuthPass,
+			"    }",
+		)
+	}
+
+	block = append(block, "    virtual_ipaddress {")
+	for _, ip := range k.VirtualIPs {
+		block = append(block, "        "+ip)
+	}
+	block = append(block, "    }")
+
+	notify := []struct {
+		name   string
+		script string
+	}{
+		{"notify_master", k.NotifyMaster},
+		{"notify_backup", k.NotifyBackup},
+		{"notify_fault", k.NotifyFault},
+	}
+
+	for _, n := range notify {
+		if n.script != "" {
+			block = append(block, fmt.Sprintf("    %s %q", n.name, n.script))
+		}
+	}
+
+	return append(block, "}")
+}
+
+// findBlock returns the indices of the first and last lines of the
+// vrrp_instance block of the instance, or -1 if it does not exist.
+func (k *KeepalivedVRRP) findBlock(lines []string) (int, int, error) {
+	start, depth := -1, 0
+	for i, line := range lines {
+		// Comments start with either "#" or "!"
+		if j := strings.IndexAny(line, "#!"); j >= 0 {
+			line = line[:j]
+		}
+
+		fields := strings.Fields(line)
+		if start < 0 {
+			if len(fields) >= 2 && fields[0] == "vrrp_instance" && strings.TrimSuffix(fields[1], "{") == k.Name {
+				start = i
+			} else {
+				continue
+			}
+		}
+
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		if depth <= 0 && strings.Contains(line, "}") {
+			return start, i, nil
+		}
+	}
+
+	if start >= 0 {
+		return -1, -1, fmt.Errorf("unterminated vrrp_instance %s in %s", k.Name, k.ConfigFile)
+	}
+
+	return -1, -1, nil
+}
+
+// isConfigSynced checks whether the vrrp_instance block is in sync.
+// Indentation is ignored when comparing the blocks.
+func (k *KeepalivedVRRP) isConfigSynced() (bool, error) {
+	lines, err := k.readConfig()
+	if err != nil {
+		return false, err
+	}
+
+	start, end, err := k.findBlock(lines)
+	if err != nil {
+		return false, err
+	}
+
+	if start < 0 {
+		return false, ErrResourceAbsent
+	}
+
+	want := k.block()
+	current := lines[start : end+1]
+	if len(current) != len(want) {
+		return false, nil
+	}
+
+	// The lines are not logged, since they may contain the password
+	for i := range want {
+		if strings.Join(strings.Fields(current[i]), " ") != strings.Join(strings.Fields(want[i]), " ") {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// setConfig writes the vrrp_instance block in place of the
+// existing one, or at the end of the configuration file.
+func (k *KeepalivedVRRP) setConfig() error {
+	lines, err := k.readConfig()
+	if err != nil {
+		return err
+	}
+
+	start, end, err := k.findBlock(lines)
+	if err != nil {
+		return err
+	}
+
+	var result []string
+	if start >= 0 {
+		result = append(result, lines[:start]...)
+		result = append(result, k.block()...)
+		result = append(result, lines[end+1:]...)
+	} else {
+		result = append(result, lines...)
+		if len(result) > 0 && strings.TrimSpace(result[len(result)-1]) != "" {
+			result = append(result, "")
+		}
+		result = append(result, k.block()...)
+	}
+
+	if err := k.writeConfig(result); err != nil {
+		return err
+	}
+
+	return k.reload()
+}
+
+// readConfig returns the lines of the configuration file.
+// A missing file is treated as being empty.
+func (k *KeepalivedVRRP) readConfig() ([]string, error) {
+	data, err := ioutil.ReadFile(k.ConfigFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	content := strings.TrimSuffix(string(data), "\n")
+	if content == "" {
+		return nil, nil
+	}
+
+	return strings.Split(content, "\n"), nil
+}
+
+// writeConfig writes the lines of the configuration file.
+func (k *KeepalivedVRRP) writeConfig(lines []string) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.ConfigFile), 0755); err != nil {
+		return err
+	}
+
+	// The configuration contains the passwords
+	// of the instances, so it is not world-readable
+	return writeFile(k.ConfigFile, buf.Bytes(), 0640)
+}
+
+// reload reloads Keepalived, if it is running.
+func (k *KeepalivedVRRP) reload() error {
+	spec := utils.CommandSpec{Args: []string{"systemctl", "is-active", "--quiet", "keepalived"}}
+	if _, err := utils.RunCommand(context.Background(), spec); err != nil {
+		k.Printf("keepalived is not running, skipping reload\n")
+		return nil
+	}
+
+	k.Printf("reloading keepalived\n")
+
+	spec = utils.CommandSpec{Args: []string{"systemctl", "reload", "keepalived"}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("unable to reload keepalived: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "keepalived_vrrp",
+		Provider:  NewKeepalivedVRRP,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestKeepalivedVRRP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-keepalived")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	const config = `global_defs {
+    router_id LVS_1
+}
+
+vrrp_instance VI_2 { # other instance
+    interface eth1
+    virtual_router_id 52
+    virtual_ipaddress {
+        10.0.0.20
+    }
+}
+`
+	path := filepath.Join(dir, "keepalived.conf")
+	if err := ioutil.WriteFile(path, []byte(config), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewKeepalivedVRRP("VI_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := r.(*KeepalivedVRRP)
+	k.ConfigFile = path
+	k.Interface = "eth0"
+	k.VirtualRouterID = 51
+	k.Priority = 150
+	k.VirtualIPs = []string{"192.168.1.10/24"}
+	k.AuthPass = "s3cret"
+	k.NotifyMaster = "/usr/local/bin/became-master.sh"
+	if err := k.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := k.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := k.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := config + `
+vrrp_instance VI_1 {
+    interface eth0
+    virtual_router_id 51
+    priority 150
+    authentication {
+        auth_type PASS
+        auth_pass s3cret
+    }
+    virtual_ipaddress {
+        192.168.1.10/24
+    }
+    notify_master "/usr/local/bin/became-master.sh"
+}
+`
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, want, string(data))
+	errorIfNotEqual(t, []string{"systemctl is-active --quiet keepalived", "systemctl reload keepalived"}, commands)
+
+	state, err = k.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+
+	synced, err := k.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	// Changes are written in place of the existing block
+	k.Priority = 100
+	k.AuthPass = "n3wpass"
+	synced, err = k.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := k.setConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = strings.Replace(want, "priority 150", "priority 100", 1)
+	want = strings.Replace(want, "auth_pass s3cret", "auth_pass n3wpass", 1)
+	errorIfNotEqual(t, want, string(data))
+
+	if strings.Contains(logs.String(), "s3cret") || strings.Contains(logs.String(), "n3wpass") {
+		t.Errorf("want password not to be logged, got %q", logs.String())
+	}
+
+	// Other instances are preserved when deleting
+	if err := k.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, config, string(data))
+
+	// Keepalived is not reloaded if it is not running
+	commands = nil
+	runner = func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		return utils.CommandResult{ExitCode: 3}, errors.New("exit status 3")
+	}
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+
+	if err := k.Create(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"systemctl is-active --quiet keepalived"}, commands)
+}
+
+func TestKeepalivedVRRPValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		routerID int
+		ips      []string
+		authPass string
+		ok       bool
+	}{
+		{"VI_1", 51, []string{"192.168.1.10/24"}, "", true},
+		{"VI_1", 51, []string{"192.168.1.10", "fd00::10/64"}, "secret", true},
+		{"VI 1", 51, []string{"192.168.1.10"}, "", false},
+		{"VI_1", 256, []string{"192.168.1.10"}, "", false},
+		{"VI_1", 51, []string{}, "", false},
+		{"VI_1", 51, []string{"192.168.1.300"}, "", false},
+		{"VI_1", 51, []string{"192.168.1.10"}, "toolongpassword", false},
+	}
+
+	for _, test := range tests {
+		r, err := NewKeepalivedVRRP(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		k := r.(*KeepalivedVRRP)
+		k.Interface = "eth0"
+		k.VirtualRouterID = test.routerID
+		k.VirtualIPs = test.ips
+		k.AuthPass = test.authPass
+		err = k.Validate()
+		if test.ok != (err == nil) {
+			t.Errorf("%s %d %v: want valid %t, got %v", test.name, test.routerID, test.ips, test.ok, err)
+		}
+
+		if err != nil && test.authPass != "" && strings.Contains(err.Error(), test.authPass) {
+			t.Errorf("want password not to be included in error %q", err)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build linux
+
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// Paths to the files used for managing locales
+const (
+	localeGenPath     = "/etc/locale.gen"
+	localeDefaultPath = "/etc/default/locale"
+)
+
+// Locale type is a resource which manages locales on a
+// GNU/Linux system using locale-gen(8), e.g. on Debian.
+//
+// The locale is enabled in /etc/locale.gen and generated, and is
+// set as the default locale of the system. The locales are
+// generated again only when /etc/locale.gen has changed. Other
+// resources, e.g. services, can subscribe to the locale in order
+// to be restarted once it has changed.
+//
+// Example:
+//   locale = resource.locale.new("en_US.UTF-8")
+//   locale.state = "present"
+//   locale.default = true
+type Locale struct {
+	Base
+
+	// Charset of the locale, e.g. "UTF-8". Defaults to the
+	// codeset in the locale name, or "ISO-8859-1" if none.
+	Charset string `luar:"charset"`
+
+	// Default specifies whether the locale is set as the default
+	// locale of the system. Set to false for additional locales,
+	// which should only be generated. Defaults to true.
+	Default bool `luar:"default"`
+
+	// DefaultFile is the file in which the default locale is set.
+	// Set to an empty string in order to use localectl(1) instead,
+	// e.g. on systems using /etc/locale.conf.
+	// Defaults to /etc/default/locale.
+	DefaultFile string `luar:"default_file"`
+
+	// Path to the list of locales to generate
+	localeGen string `luar:"-"`
+
+	// Whether the locale is generated
+	generated bool `luar:"-"`
+}
+
+// NewLocale creates a new resource for managing locales.
+func NewLocale(name string) (Resource, error) {
+	l := &Locale{
+		Base: Base{
+			Name:              name,
+			Type:              "locale",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// Concurrent changes to /etc/locale.gen may be lost
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		Default:     true,
+		DefaultFile: localeDefaultPath,
+		localeGen:   localeGenPath,
+	}
+
+	l.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "enabled",
+			PropertySetFunc:      l.setEnabled,
+			PropertyIsSyncedFunc: l.isEnabledSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "default",
+			PropertySetFunc:      l.setDefault,
+			PropertyIsSyncedFunc: l.isDefaultSynced,
+		},
+	}
+
+	return l, nil
+}
+
+// Validate validates the resource.
+func (l *Locale) Validate() error {
+	if err := l.Base.Validate(); err != nil {
+		return err
+	}
+
+	if l.Name == "" || strings.ContainsAny(l.Name, " \t\n#=\"'") {
+		return fmt.Errorf("invalid locale '%s'", l.Name)
+	}
+
+	if l.Charset == "" {
+		l.Charset = "ISO-8859-1"
+		if i := strings.Index(l.Name, "."); i != -1 {
+			l.Charset = strings.SplitN(l.Name[i+1:], "@", 2)[0]
+		}
+	}
+
+	if strings.ContainsAny(l.Charset, " \t\n#") {
+		return fmt.Errorf("invalid charset '%s'", l.Charset)
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the locale.
+func (l *Locale) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    l.State,
+	}
+
+	spec := utils.CommandSpec{Args: []string{"locale", "-a"}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return state, fmt.Errorf("unable to list locales: %s", err)
+	}
+
+	l.generated = false
+	want := normalizeLocale(l.Name)
+	for _, name := range strings.Fields(string(result.Stdout)) {
+		if normalizeLocale(name) == want {
+			l.generated = true
+			break
+		}
+	}
+
+	state.Current = "absent"
+	if l.generated {
+		state.Current = "present"
+	}
+
+	return state, nil
+}
+
+// Create enables and generates the locale.
+func (l *Locale) Create() error {
+	l.Printf("generating locale\n")
+
+	if err := l.updateLocaleGen(true); err != nil {
+		return err
+	}
+
+	if err := l.generate(); err != nil {
+		return err
+	}
+	l.generated = true
+
+	return nil
+}
+
+// Delete disables the locale and generates the enabled locales again.
+func (l *Locale) Delete() error {
+	l.Printf("removing locale\n")
+
+	if err := l.updateLocaleGen(false); err != nil {
+		return err
+	}
+
+	if err := l.generate(); err != nil {
+		return err
+	}
+	l.generated = false
+
+	return nil
+}
+
+// generate generates the locales enabled in /etc/locale.gen.
+func (l *Locale) generate() error {
+	spec := utils.CommandSpec{Args: []string{"locale-gen"}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("unable to generate locales: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+// isLocaleGenEntry returns true if the line is an entry in
+// /etc/locale.gen for the locale, and whether it is enabled.
+func (l *Locale) isLocaleGenEntry(line string) (bool, bool) {
+	line = strings.TrimSpace(line)
+	enabled := !strings.HasPrefix(line, "#")
+	fields := strings.Fields(strings.TrimLeft(line, "# \t"))
+	if len(fields) != 2 || fields[0] != l.Name {
+		return false, false
+	}
+
+	return true, enabled
+}
+
+// readLocaleGen returns the lines of /etc/locale.gen.
+func (l *Locale) readLocaleGen() ([]string, error) {
+	data, err := ioutil.ReadFile(l.localeGen)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines, scanner.Err()
+}
+
+// updateLocaleGen enables or disables the locale in /etc/locale.gen.
+// Disabled entries are enabled in place, and new entries are
+// appended to the file. The file is written only if changed.
+func (l *Locale) updateLocaleGen(enable bool) error {
+	lines, err := l.readLocaleGen()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	found := false
+	for i, line := range lines {
+		ok, enabled := l.isLocaleGenEntry(line)
+		switch {
+		case ok && enabled && enable:
+			found = true
+		case ok && enabled && !enable:
+			lines[i] = "# " + strings.TrimSpace(line)
+			changed = true
+		}
+	}
+
+	if enable && !found {
+		for i, line := range lines {
+			if ok, _ := l.isLocaleGenEntry(line); ok {
+				lines[i] = l.Name + " " + l.Charset
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			lines = append(lines, l.Name+" "+l.Charset)
+		}
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	content := strings.Join(lines, "\n") + "\n"
+
+	return writeFile(l.localeGen, []byte(content), 0644)
+}
+
+// isEnabledSynced checks whether the locale is enabled in
+// /etc/locale.gen, so that it is kept when generating locales.
+func (l *Locale) isEnabledSynced() (bool, error) {
+	if !l.generated {
+		return false, ErrResourceAbsent
+	}
+
+	lines, err := l.readLocaleGen()
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range lines {
+		if ok, enabled := l.isLocaleGenEntry(line); ok && enabled {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// setEnabled enables the locale in /etc/locale.gen. The locale is
+// already generated, so there is no need to generate it again.
+func (l *Locale) setEnabled() error {
+	l.Printf("enabling locale in %s\n", l.localeGen)
+
+	return l.updateLocaleGen(true)
+}
+
+// currentDefault returns the current default locale of the system.
+func (l *Locale) currentDefault() (string, error) {
+	if l.DefaultFile == "" {
+		spec := utils.CommandSpec{Args: []string{"localectl", "status"}}
+		result, err := utils.RunCommand(context.Background(), spec)
+		if err != nil {
+			return "", fmt.Errorf("unable to get system locale: %s", err)
+		}
+
+		for _, field := range strings.Fields(string(result.Stdout)) {
+			if strings.HasPrefix(field, "LANG=") {
+				return strings.TrimPrefix(field, "LANG="), nil
+			}
+		}
+
+		return "", nil
+	}
+
+	data, err := ioutil.ReadFile(l.DefaultFile)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "LANG=") {
+			return strings.Trim(strings.TrimPrefix(line, "LANG="), `"'`), nil
+		}
+	}
+
+	return "", nil
+}
+
+// isDefaultSynced checks whether the locale is the default locale.
+func (l *Locale) isDefaultSynced() (bool, error) {
+	if !l.generated {
+		return false, ErrResourceAbsent
+	}
+
+	if !l.Default {
+		return true, nil
+	}
+
+	current, err := l.currentDefault()
+	if err != nil {
+		return false, err
+	}
+
+	return current == l.Name, nil
+}
+
+// setDefault sets the locale as the default locale. Other
+// settings in the default file, e.g. LC_TIME are preserved.
+func (l *Locale) setDefault() error {
+	l.Printf("setting default locale\n")
+
+	if l.DefaultFile == "" {
+		spec := utils.CommandSpec{Args: []string{"localectl", "set-locale", "LANG=" + l.Name}}
+		result, err := utils.RunCommand(context.Background(), spec)
+		if err != nil {
+			return fmt.Errorf("unable to set system locale: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+		}
+
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(l.DefaultFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	lines := make([]string, 0)
+	found := false
+	if len(data) > 0 {
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "LANG=") {
+				if found {
+					continue
+				}
+				line = "LANG=" + l.Name
+				found = true
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	if !found {
+		lines = append(lines, "LANG="+l.Name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.DefaultFile), 0755); err != nil {
+		return err
+	}
+
+	return writeFile(l.DefaultFile, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// normalizeLocale normalizes the name of a locale, so that e.g.
+// "en_US.UTF-8" and "en_US.utf8" as listed by locale -a are equal.
+func normalizeLocale(name string) string {
+	modifier := ""
+	if i := strings.Index(name, "@"); i != -1 {
+		name, modifier = name[:i], name[i:]
+	}
+
+	if i := strings.Index(name, "."); i != -1 {
+		codeset := strings.ToLower(name[i+1:])
+		codeset = strings.NewReplacer("-", "", "_", "").Replace(codeset)
+		name = name[:i] + "." + codeset
+	}
+
+	return name + modifier
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "locale",
+		Provider:  NewLocale,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build linux
+
+package resource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestLocale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-locale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	localeGen := filepath.Join(dir, "locale.gen")
+	defaultFile := filepath.Join(dir, "default", "locale")
+	if err := ioutil.WriteFile(localeGen, []byte("# en_US.UTF-8 UTF-8\n# de_DE.UTF-8 UTF-8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake locale-gen generating the enabled locales
+	generated := "C\nC.utf8\nPOSIX\n"
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		switch spec.Args[0] {
+		case "locale":
+			return utils.CommandResult{Stdout: []byte(generated)}, nil
+		case "locale-gen":
+			data, err := ioutil.ReadFile(localeGen)
+			if err != nil {
+				return utils.CommandResult{}, err
+			}
+			generated = "C\nC.utf8\nPOSIX\n"
+			for _, line := range strings.Split(string(data), "\n") {
+				if line != "" && !strings.HasPrefix(line, "#") {
+					generated += strings.Replace(strings.Fields(line)[0], "UTF-8", "utf8", 1) + "\n"
+				}
+			}
+		}
+
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	r, err := NewLocale("en_US.UTF-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := r.(*Locale)
+	l.DefaultFile = defaultFile
+	l.localeGen = localeGen
+	if err := l.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "UTF-8", l.Charset)
+
+	state, err := l.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := l.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(localeGen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "en_US.UTF-8 UTF-8\n# de_DE.UTF-8 UTF-8\n", string(content))
+
+	// Properties are processed once the locale is generated
+	synced, err := l.isEnabledSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	synced, err = l.isDefaultSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := l.setDefault(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = l.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+
+	synced, err = l.isDefaultSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	// Other settings in the default file are preserved
+	if err := ioutil.WriteFile(defaultFile, []byte("LANG=\"C\"\nLC_TIME=en_GB.UTF-8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.setDefault(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err = ioutil.ReadFile(defaultFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "LANG=en_US.UTF-8\nLC_TIME=en_GB.UTF-8\n", string(content))
+
+	if err := l.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err = ioutil.ReadFile(localeGen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "# en_US.UTF-8 UTF-8\n# de_DE.UTF-8 UTF-8\n", string(content))
+
+	// Locales are generated only when changed
+	want := []string{"locale -a", "locale-gen", "locale -a", "locale-gen"}
+	errorIfNotEqual(t, want, commands)
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{"en_US.UTF-8", "en_US.utf8"},
+		{"en_US.utf8", "en_US.utf8"},
+		{"de_DE.ISO-8859-15@euro", "de_DE.iso885915@euro"},
+		{"C", "C"},
+	}
+
+	for _, tc := range testCases {
+		errorIfNotEqual(t, tc.want, normalizeLocale(tc.name))
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// logwatchConfigPath is the path to the logwatch configuration file.
+const logwatchConfigPath = "/etc/logwatch/conf/logwatch.conf"
+
+// LogwatchConfig type is a resource which manages the
+// configuration of logwatch.
+//
+// Example:
+//   lw = resource.logwatch.new("logwatch")
+//   lw.state = "present"
+//   lw.detail = "Med"
+//   lw.range = "yesterday"
+//   lw.mail_to = "ops@example.org"
+//   lw.mailer = "/usr/sbin/sendmail -t"
+//   lw.log_groups = { "sshd", "sudo" }
+type LogwatchConfig struct {
+	Base
+
+	// Path to the logwatch configuration file.
+	// Defaults to /etc/logwatch/conf/logwatch.conf.
+	Path string `luar:"path"`
+
+	// LogFiles contains the logfile groups to process.
+	LogFiles []string `luar:"log_files"`
+
+	// LogGroups contains the service groups to report on.
+	// Defaults to all services.
+	LogGroups []string `luar:"log_groups"`
+
+	// Detail is the level of detail in reports, either
+	// "Low", "Med" or "High". Defaults to "Low".
+	Detail string `luar:"detail"`
+
+	// Range is the range of log entries to process, either
+	// "yesterday", "today" or "all". Defaults to "yesterday".
+	Range string `luar:"range"`
+
+	// Mailer is the command used to send reports.
+	Mailer string `luar:"mailer"`
+
+	// MailTo is the email address to send reports to.
+	MailTo string `luar:"mail_to"`
+}
+
+// NewLogwatchConfig creates a new resource for managing
+// the logwatch configuration.
+func NewLogwatchConfig(name string) (Resource, error) {
+	l := &LogwatchConfig{
+		Base: Base{
+			Name:              name,
+			Type:              "logwatch",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		Path:      logwatchConfigPath,
+		LogFiles:  make([]string, 0),
+		LogGroups: make([]string, 0),
+		Detail:    "Low",
+		Range:     "yesterday",
+	}
+
+	l.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "config",
+			PropertySetFunc:      l.setConfig,
+			PropertyIsSyncedFunc: l.isConfigSynced,
+		},
+	}
+
+	return l, nil
+}
+
+// Validate validates the resource.
+func (l *LogwatchConfig) Validate() error {
+	if err := l.Base.Validate(); err != nil {
+		return err
+	}
+
+	switch l.Detail {
+	case "Low", "Med", "High":
+	default:
+		return fmt.Errorf("invalid detail '%s'", l.Detail)
+	}
+
+	switch l.Range {
+	case "yesterday", "today", "all":
+	default:
+		return fmt.Errorf("invalid range '%s'", l.Range)
+	}
+
+	if l.MailTo != "" {
+		addr, err := mail.ParseAddress(l.MailTo)
+		if err != nil || addr.Address != l.MailTo || !strings.Contains(l.MailTo, "@") {
+			return fmt.Errorf("invalid email address '%s'", l.MailTo)
+		}
+	}
+
+	if strings.ContainsAny(l.Mailer, "\n\"") {
+		return errors.New("mailer cannot contain newlines or quotes")
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the logwatch configuration.
+func (l *LogwatchConfig) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    l.State,
+	}
+
+	fi, err := os.Stat(l.Path)
+	if os.IsNotExist(err) {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return state, errors.New("path exists, but is not a regular file")
+	}
+
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create creates the logwatch configuration file.
+func (l *LogwatchConfig) Create() error {
+	l.Printf("creating %s\n", l.Path)
+
+	return l.writeConfig()
+}
+
+// Delete removes the logwatch configuration file.
+func (l *LogwatchConfig) Delete() error {
+	l.Printf("removing %s\n", l.Path)
+
+	return os.Remove(l.Path)
+}
+
+// settings returns the logwatch settings managed by the resource.
+// Keys are lowercase, since logwatch settings are case-insensitive.
+func (l *LogwatchConfig) settings() map[string][]string {
+	settings := map[string][]string{
+		"detail":  {l.Detail},
+		"range":   {l.Range},
+		"logfile": l.LogFiles,
+		"service": l.LogGroups,
+	}
+
+	if len(l.LogGroups) == 0 {
+		settings["service"] = []string{"All"}
+	}
+
+	if l.Mailer != "" {
+		settings["mailer"] = []string{l.Mailer}
+	}
+
+	if l.MailTo != "" {
+		settings["mailto"] = []string{l.MailTo}
+	}
+
+	return settings
+}
+
+// isConfigSynced checks whether each setting in the
+// logwatch configuration file is in sync.
+func (l *LogwatchConfig) isConfigSynced() (bool, error) {
+	data, err := ioutil.ReadFile(l.Path)
+	if os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	current := parseLogwatchConfig(data)
+	for key, want := range l.settings() {
+		if !utils.SameStrings(current[key], want) {
+			l.Debugf("setting %s is out of date\n", key)
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// setConfig writes the logwatch configuration file.
+func (l *LogwatchConfig) setConfig() error {
+	l.Printf("updating %s\n", l.Path)
+
+	return l.writeConfig()
+}
+
+// writeConfig writes the logwatch configuration file.
+func (l *LogwatchConfig) writeConfig() error {
+	var buf bytes.Buffer
+
+	buf.WriteString("# Managed by gru, do not edit\n")
+	fmt.Fprintf(&buf, "Detail = %s\n", l.Detail)
+	fmt.Fprintf(&buf, "Range = %s\n", l.Range)
+
+	if l.MailTo != "" {
+		fmt.Fprintf(&buf, "MailTo = %s\n", l.MailTo)
+	}
+
+	if l.Mailer != "" {
+		fmt.Fprintf(&buf, "mailer = \"%s\"\n", l.Mailer)
+	}
+
+	for _, logfile := range l.LogFiles {
+		fmt.Fprintf(&buf, "LogFile = %s\n", logfile)
+	}
+
+	for _, service := range l.settings()["service"] {
+		fmt.Fprintf(&buf, "Service = %s\n", service)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0755); err != nil {
+		return err
+	}
+
+	return writeFile(l.Path, buf.Bytes(), 0644)
+}
+
+// parseLogwatchConfig parses the settings from a logwatch configuration
+// file. Keys are lowercase and settings which may be repeated, such as
+// LogFile and Service, contain all of their values.
+func parseLogwatchConfig(data []byte) map[string][]string {
+	settings := make(map[string][]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := strings.Trim(strings.TrimSpace(kv[1]), "\"")
+		settings[key] = append(settings[key], value)
+	}
+
+	return settings
+}
+
+func init() {
+	logwatch := ProviderItem{
+		Type:      "logwatch",
+		Provider:  NewLogwatchConfig,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(logwatch)
+}
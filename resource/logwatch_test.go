@@ -0,0 +1,107 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogwatchConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-logwatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewLogwatchConfig("logwatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := r.(*LogwatchConfig)
+	l.Path = filepath.Join(dir, "conf", "logwatch.conf")
+	l.Detail = "High"
+	l.MailTo = "ops@example.org"
+	l.Mailer = "/usr/sbin/sendmail -t"
+	l.LogGroups = []string{"sshd", "sudo"}
+	if err := l.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := l.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := l.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	synced, err := l.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	l.LogGroups = []string{"sshd"}
+	synced, err = l.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+}
+
+func TestLogwatchConfigValidate(t *testing.T) {
+	testCases := []struct {
+		mailTo string
+		detail string
+		valid  bool
+	}{
+		{"ops@example.org", "Low", true},
+		{"", "Med", true},
+		{"root", "Low", false},
+		{"Ops <ops@example.org>", "Low", false},
+		{"ops@example.org", "Verbose", false},
+	}
+
+	for _, tc := range testCases {
+		r, err := NewLogwatchConfig("logwatch")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l := r.(*LogwatchConfig)
+		l.MailTo = tc.mailTo
+		l.Detail = tc.detail
+		if err := l.Validate(); (err == nil) != tc.valid {
+			t.Errorf("mail_to %q, detail %q: want valid %t, got %v", tc.mailTo, tc.detail, tc.valid, err)
+		}
+	}
+}
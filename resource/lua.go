@@ -46,7 +46,8 @@ type FunctionItem struct {
 	// Name of the function to register in Lua
 	Name string
 
-	// Namespace is the Lua table where the function will be registered to
+	// Namespace is the Lua table where the function will be registered
+	// to. Functions without a namespace are registered as globals.
 	Namespace string
 
 	// Function to execute when called from Lua
@@ -62,6 +63,11 @@ func RegisterFunction(items ...FunctionItem) {
 func LuaRegisterBuiltin(L *lua.LState) {
 	// Register functions in Lua
 	for _, item := range functionRegistry {
+		if item.Namespace == "" {
+			L.SetGlobal(item.Name, luar.New(L, item.Function))
+			continue
+		}
+
 		namespace := L.GetGlobal(item.Namespace)
 		if lua.LVIsFalse(namespace) {
 			namespace = L.NewTable()
@@ -84,6 +90,10 @@ func LuaRegisterBuiltin(L *lua.LState) {
 					L.RaiseError(err.Error())
 				}
 
+				if fr, ok := r.(FieldRecorder); ok {
+					recordFields(L, fr)
+				}
+
 				L.Push(luar.New(L, r))
 				return 1 // Number of arguments returned to Lua
 			}
@@ -103,6 +113,37 @@ func LuaRegisterBuiltin(L *lua.LState) {
 	}
 }
 
+// recordFields wraps the metamethod assigning fields of the resource
+// type in Lua, so that assigned fields are recorded by the resources.
+func recordFields(L *lua.LState, fr FieldRecorder) {
+	mt := luar.MT(L, fr)
+	if mt.RawGetString("__gru_record_fields") != lua.LNil {
+		return
+	}
+
+	newindex, ok := mt.RawGetString("__newindex").(*lua.LFunction)
+	if !ok {
+		return
+	}
+
+	mt.RawSetString("__gru_record_fields", lua.LTrue)
+	mt.RawSetString("__newindex", L.NewFunction(func(L *lua.LState) int {
+		if ud, ok := L.Get(1).(*lua.LUserData); ok {
+			if r, ok := ud.Value.(FieldRecorder); ok {
+				r.RecordField(L.CheckString(2))
+			}
+		}
+
+		L.Push(newindex)
+		L.Push(L.Get(1))
+		L.Push(L.Get(2))
+		L.Push(L.Get(3))
+		L.Call(3, 0)
+
+		return 0
+	}))
+}
+
 func init() {
 	logf := FunctionItem{
 		Name:      "logf",
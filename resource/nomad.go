@@ -0,0 +1,372 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// NomadNamespace is the table name in Lua where Nomad resources are
+// being registered to.
+const NomadNamespace = "nomad"
+
+// nomadChecksumMetaKey is the job meta key holding the checksum
+// of the job spec, which the job was registered with.
+const nomadChecksumMetaKey = "gru_job_checksum"
+
+// nomadPollInterval is the interval at which the
+// status of evaluations and deployments is polled.
+const nomadPollInterval = 2 * time.Second
+
+// NomadJob type is a resource which manages jobs in Nomad.
+//
+// The job is identified by the id in the job spec. The checksum of
+// the job spec is stored in the job meta, so that the job is only
+// registered again when the job spec changes. Once registered, the
+// resource waits for the deployment of the job to complete, if any.
+//
+// Example:
+//   web = nomad.job.new("web")
+//   web.address = "http://nomad.example.org:4646"
+//   web.token = "my-nomad-token"
+//   web.job_spec = [[
+//   job "web" {
+//     datacenters = ["dc1"]
+//     group "web" {
+//       task "nginx" {
+//         driver = "docker"
+//         config {
+//           image = "nginx:1.25"
+//         }
+//       }
+//     }
+//   }
+//   ]]
+type NomadJob struct {
+	Base
+
+	// JobSpec is the job spec in either HCL or JSON format.
+	// Required.
+	JobSpec string `luar:"job_spec"`
+
+	// Token is the ACL token used to authenticate against Nomad.
+	// Defaults to the value of the NOMAD_TOKEN environment variable.
+	Token string `luar:"token" gru:"sensitive"`
+
+	// Region of the job. Defaults to the region of the agent.
+	Region string `luar:"region"`
+
+	// Namespace of the job. Defaults to the default namespace.
+	Namespace string `luar:"namespace"`
+
+	// NomadAddr is the address of the Nomad agent. Defaults to the
+	// value of the NOMAD_ADDR environment variable.
+	NomadAddr string `luar:"address"`
+
+	// Wait for the deployment of the job to complete after
+	// registering it. Defaults to true.
+	Wait bool `luar:"wait"`
+
+	// Timeout for the deployment to complete, e.g. "10m".
+	// Defaults to 10 minutes.
+	Timeout string `luar:"timeout"`
+
+	client   *api.Client `luar:"-"`
+	job      *api.Job    `luar:"-"`
+	checksum string      `luar:"-"`
+	current  *api.Job    `luar:"-"`
+}
+
+// NewNomadJob creates a new resource for managing Nomad jobs.
+func NewNomadJob(name string) (Resource, error) {
+	j := &NomadJob{
+		Base: Base{
+			Name:              name,
+			Type:              "job",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		Wait:    true,
+		Timeout: "10m",
+	}
+
+	j.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "job_spec",
+			PropertySetFunc:      j.setJobSpec,
+			PropertyIsSyncedFunc: j.isJobSpecSynced,
+		},
+	}
+
+	return j, nil
+}
+
+// Validate validates the resource.
+func (j *NomadJob) Validate() error {
+	if err := j.Base.Validate(); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(j.JobSpec) == "" {
+		return errors.New("must provide job spec")
+	}
+
+	if _, err := time.ParseDuration(j.Timeout); err != nil {
+		return fmt.Errorf("invalid timeout '%s'", j.Timeout)
+	}
+
+	return nil
+}
+
+// Initialize creates the client for the Nomad API and parses the job spec.
+func (j *NomadJob) Initialize() error {
+	config := api.DefaultConfig()
+	if j.NomadAddr != "" {
+		config.Address = j.NomadAddr
+	}
+	if j.Token != "" {
+		config.SecretID = j.Token
+	}
+	if j.Region != "" {
+		config.Region = j.Region
+	}
+	if j.Namespace != "" {
+		config.Namespace = j.Namespace
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return err
+	}
+	j.client = client
+
+	job, err := j.parseJobSpec()
+	if err != nil {
+		return fmt.Errorf("invalid job spec: %s", err)
+	}
+
+	if job.ID == nil || *job.ID == "" {
+		return errors.New("job spec has no job id")
+	}
+
+	// The checksum is stored in the job meta, so that it can be
+	// compared without reimplementing the canonicalization of jobs
+	sum := sha256.Sum256([]byte(j.JobSpec))
+	j.checksum = hex.EncodeToString(sum[:])
+	if job.Meta == nil {
+		job.Meta = make(map[string]string)
+	}
+	job.Meta[nomadChecksumMetaKey] = j.checksum
+	j.job = job
+
+	return nil
+}
+
+// parseJobSpec parses the job spec. Specs in HCL format are
+// parsed by the Nomad agent.
+func (j *NomadJob) parseJobSpec() (*api.Job, error) {
+	spec := strings.TrimSpace(j.JobSpec)
+	if !strings.HasPrefix(spec, "{") {
+		return j.client.Jobs().ParseHCL(spec, true)
+	}
+
+	// JSON job specs may be wrapped in a "Job" object, as
+	// expected by the API when registering jobs
+	var wrapped struct {
+		Job *api.Job
+	}
+	if err := json.Unmarshal([]byte(spec), &wrapped); err != nil {
+		return nil, err
+	}
+	if wrapped.Job != nil {
+		return wrapped.Job, nil
+	}
+
+	job := new(api.Job)
+	if err := json.Unmarshal([]byte(spec), job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Evaluate evaluates the state of the job.
+func (j *NomadJob) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    j.State,
+	}
+
+	job, _, err := j.client.Jobs().Info(*j.job.ID, nil)
+	if err != nil {
+		if strings.Contains(err.Error(), "404") {
+			state.Current = "absent"
+			return state, nil
+		}
+		return state, err
+	}
+
+	// Stopped jobs remain registered until garbage collected
+	if job.Stop != nil && *job.Stop {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	j.current = job
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create registers the job.
+func (j *NomadJob) Create() error {
+	j.Printf("registering job %s\n", *j.job.ID)
+
+	resp, _, err := j.client.Jobs().Register(j.job, nil)
+	if err != nil {
+		return err
+	}
+
+	return j.waitForDeployment(resp.EvalID)
+}
+
+// Delete deregisters the job.
+func (j *NomadJob) Delete() error {
+	j.Printf("deregistering job %s\n", *j.job.ID)
+
+	_, _, err := j.client.Jobs().Deregister(*j.job.ID, false, nil)
+
+	return err
+}
+
+// isJobSpecSynced checks whether the job was registered with the job spec.
+func (j *NomadJob) isJobSpecSynced() (bool, error) {
+	if j.current == nil {
+		return false, ErrResourceAbsent
+	}
+
+	return j.current.Meta[nomadChecksumMetaKey] == j.checksum, nil
+}
+
+// setJobSpec registers the job again with the job spec. The job is
+// only registered if it has not been modified since it was evaluated.
+func (j *NomadJob) setJobSpec() error {
+	j.Printf("updating job %s\n", *j.job.ID)
+
+	var index uint64
+	if j.current.JobModifyIndex != nil {
+		index = *j.current.JobModifyIndex
+	}
+
+	resp, _, err := j.client.Jobs().EnforceRegister(j.job, index, nil)
+	if err != nil {
+		return err
+	}
+
+	return j.waitForDeployment(resp.EvalID)
+}
+
+// waitForDeployment waits for the evaluation of the registered job to
+// complete, and then for the deployment it created to complete, if any.
+func (j *NomadJob) waitForDeployment(evalID string) error {
+	if !j.Wait || evalID == "" {
+		return nil
+	}
+
+	timeout, err := time.ParseDuration(j.Timeout)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+
+	var eval *api.Evaluation
+	for {
+		eval, _, err = j.client.Evaluations().Info(evalID, nil)
+		if err != nil {
+			return err
+		}
+
+		if eval.Status == "complete" {
+			break
+		}
+		if eval.Status == "failed" || eval.Status == "canceled" {
+			return fmt.Errorf("evaluation %s %s: %s", evalID, eval.Status, eval.StatusDescription)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for evaluation %s", evalID)
+		}
+		time.Sleep(nomadPollInterval)
+	}
+
+	// Jobs without an update strategy, e.g. batch jobs, have no deployments
+	if eval.DeploymentID == "" {
+		return nil
+	}
+
+	j.Printf("waiting for deployment %s\n", eval.DeploymentID)
+	for {
+		deployment, _, err := j.client.Deployments().Info(eval.DeploymentID, nil)
+		if err != nil {
+			return err
+		}
+
+		switch deployment.Status {
+		case "successful":
+			j.Printf("deployment %s successful\n", deployment.ID)
+			return nil
+		case "failed", "cancelled":
+			return fmt.Errorf("deployment %s %s: %s", deployment.ID, deployment.Status, deployment.StatusDescription)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for deployment %s, which is %s", deployment.ID, deployment.Status)
+		}
+		time.Sleep(nomadPollInterval)
+	}
+}
+
+func init() {
+	job := ProviderItem{
+		Type:      "job",
+		Provider:  NewNomadJob,
+		Namespace: NomadNamespace,
+	}
+
+	RegisterProvider(job)
+}
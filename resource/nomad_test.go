@@ -0,0 +1,305 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// fakeNomad is a minimal implementation of the job,
+// evaluation and deployment endpoints of the Nomad HTTP API.
+type fakeNomad struct {
+	sync.Mutex
+	jobs         map[string]*api.Job
+	index        uint64
+	registered   int
+	deregistered int
+	deployments  int
+	status       string
+	tokens       []string
+	namespaces   []string
+}
+
+func (n *fakeNomad) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.Lock()
+	defer n.Unlock()
+
+	n.tokens = append(n.tokens, r.Header.Get("X-Nomad-Token"))
+	n.namespaces = append(n.namespaces, r.URL.Query().Get("namespace"))
+
+	// The API client expects the query meta headers in every response
+	w.Header().Set("X-Nomad-Index", fmt.Sprintf("%d", n.index))
+	w.Header().Set("X-Nomad-LastContact", "0")
+	w.Header().Set("X-Nomad-KnownLeader", "true")
+
+	switch {
+	case r.Method == "PUT" && r.URL.Path == "/v1/jobs/parse":
+		var in api.JobsParseRequest
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m := regexp.MustCompile(`job "(\w+)"`).FindStringSubmatch(in.JobHCL)
+		if m == nil {
+			http.Error(w, "invalid job spec", http.StatusBadRequest)
+			return
+		}
+		jobType := "service"
+		if strings.Contains(in.JobHCL, `type = "batch"`) {
+			jobType = "batch"
+		}
+		json.NewEncoder(w).Encode(&api.Job{ID: &m[1], Name: &m[1], Type: &jobType})
+	case r.Method == "PUT" && r.URL.Path == "/v1/jobs":
+		var in api.RegisterJobRequest
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if current, ok := n.jobs[*in.Job.ID]; in.EnforceIndex && (!ok || *current.JobModifyIndex != in.JobModifyIndex) {
+			http.Error(w, "Enforcing job modify index: job exists with conflicting job modify index", http.StatusInternalServerError)
+			return
+		}
+		n.index++
+		n.registered++
+		index := n.index
+		in.Job.JobModifyIndex = &index
+		n.jobs[*in.Job.ID] = in.Job
+		json.NewEncoder(w).Encode(&api.JobRegisterResponse{EvalID: fmt.Sprintf("eval-%d", n.index)})
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/job/"):
+		job, ok := n.jobs[strings.TrimPrefix(r.URL.Path, "/v1/job/")]
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(job)
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/v1/job/"):
+		job, ok := n.jobs[strings.TrimPrefix(r.URL.Path, "/v1/job/")]
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		stop := true
+		job.Stop = &stop
+		n.index++
+		n.deregistered++
+		json.NewEncoder(w).Encode(&api.JobDeregisterResponse{EvalID: fmt.Sprintf("eval-%d", n.index)})
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/evaluation/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/evaluation/")
+		eval := &api.Evaluation{ID: id, Status: "complete"}
+
+		// Only the service jobs registered by the test are deployed
+		for _, job := range n.jobs {
+			if fmt.Sprintf("eval-%d", *job.JobModifyIndex) == id && job.Type != nil && *job.Type == "service" {
+				eval.DeploymentID = "deployment-" + strings.TrimPrefix(id, "eval-")
+			}
+		}
+		json.NewEncoder(w).Encode(eval)
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/deployment/"):
+		n.deployments++
+		json.NewEncoder(w).Encode(&api.Deployment{
+			ID:     strings.TrimPrefix(r.URL.Path, "/v1/deployment/"),
+			Status: n.status,
+		})
+	default:
+		http.Error(w, "unexpected request", http.StatusMethodNotAllowed)
+	}
+}
+
+// newTestNomadJob creates a Nomad job resource,
+// which manages the given job spec in the fake agent.
+func newTestNomadJob(t *testing.T, addr, spec string) *NomadJob {
+	r, err := NewNomadJob("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := r.(*NomadJob)
+	j.NomadAddr = addr
+	j.Token = "my-token"
+	j.Namespace = "apps"
+	j.JobSpec = spec
+	if err := j.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	return j
+}
+
+func TestNomadJob(t *testing.T) {
+	nomad := &fakeNomad{jobs: make(map[string]*api.Job), status: "successful"}
+	ts := httptest.NewServer(nomad)
+	defer ts.Close()
+
+	j := newTestNomadJob(t, ts.URL, `{"Job": {"ID": "web", "Name": "web", "Type": "service", "Datacenters": ["dc1"]}}`)
+
+	state, err := j.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	_, err = j.isJobSpecSynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	if err := j.Create(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, 1, nomad.registered)
+	errorIfNotEqual(t, 1, nomad.deployments)
+	errorIfNotEqual(t, j.checksum, nomad.jobs["web"].Meta[nomadChecksumMetaKey])
+
+	state, err = j.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+	errorIfNotEqual(t, []string{}, outOfSync(t, j))
+
+	// Changing the job spec registers the job again
+	j = newTestNomadJob(t, ts.URL, `{"ID": "web", "Name": "web", "Type": "service", "Datacenters": ["dc1", "dc2"]}`)
+	if _, err := j.Evaluate(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"job_spec"}, outOfSync(t, j))
+
+	if err := j.Properties()[0].Set(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, 2, nomad.registered)
+	errorIfNotEqual(t, []string{"dc1", "dc2"}, nomad.jobs["web"].Datacenters)
+
+	// Jobs modified since they were evaluated are not registered again
+	index := *nomad.jobs["web"].JobModifyIndex + 1
+	nomad.jobs["web"].JobModifyIndex = &index
+	if err := j.Properties()[0].Set(); err == nil {
+		t.Error("want error for job modified since evaluation")
+	}
+	errorIfNotEqual(t, 2, nomad.registered)
+
+	if err := j.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, 1, nomad.deregistered)
+
+	state, err = j.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	for _, token := range nomad.tokens {
+		errorIfNotEqual(t, "my-token", token)
+	}
+	for _, namespace := range nomad.namespaces {
+		errorIfNotEqual(t, "apps", namespace)
+	}
+}
+
+func TestNomadJobDeployment(t *testing.T) {
+	nomad := &fakeNomad{jobs: make(map[string]*api.Job), status: "failed"}
+	ts := httptest.NewServer(nomad)
+	defer ts.Close()
+
+	// Jobs in HCL format are parsed by the agent
+	j := newTestNomadJob(t, ts.URL, `job "web" { datacenters = ["dc1"] }`)
+	errorIfNotEqual(t, "web", *j.job.ID)
+
+	err := j.Create()
+	if err == nil || !strings.Contains(err.Error(), "deployment-1 failed") {
+		t.Errorf("want failed deployment error, got %v", err)
+	}
+
+	// Batch jobs have no deployments to wait for
+	j = newTestNomadJob(t, ts.URL, `job "backup" { type = "batch" }`)
+	if err := j.Create(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, 2, nomad.registered)
+	errorIfNotEqual(t, 1, nomad.deployments)
+
+	// Not waiting skips polling the evaluation altogether
+	j.Wait = false
+	if err := j.Create(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, 3, nomad.registered)
+	errorIfNotEqual(t, 1, nomad.deployments)
+}
+
+func TestNomadJobValidate(t *testing.T) {
+	nomad := &fakeNomad{jobs: make(map[string]*api.Job), status: "successful"}
+	ts := httptest.NewServer(nomad)
+	defer ts.Close()
+
+	r, err := NewNomadJob("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := r.(*NomadJob)
+	j.NomadAddr = ts.URL
+
+	if err := j.Validate(); err == nil {
+		t.Error("want error for missing job spec")
+	}
+
+	j.JobSpec = `{"ID": "web"}`
+	j.Timeout = "soon"
+	if err := j.Validate(); err == nil {
+		t.Error("want error for invalid timeout")
+	}
+
+	j.Timeout = "1m"
+	if err := j.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	j.JobSpec = `{"ID": "web"`
+	if err := j.Initialize(); err == nil || !strings.HasPrefix(err.Error(), "invalid job spec") {
+		t.Errorf("want invalid job spec error, got %v", err)
+	}
+
+	j.JobSpec = `{"Name": "web"}`
+	if err := j.Initialize(); err == nil || err.Error() != "job spec has no job id" {
+		t.Errorf("want missing job id error, got %v", err)
+	}
+
+	j.JobSpec = `group "web" {}`
+	if err := j.Initialize(); err == nil || !strings.HasPrefix(err.Error(), "invalid job spec") {
+		t.Errorf("want invalid job spec error, got %v", err)
+	}
+}
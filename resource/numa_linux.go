@@ -0,0 +1,410 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+// +build linux
+
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// numaOnlinePath is the path to the sysfs file listing the online NUMA nodes
+const numaOnlinePath = "/sys/devices/system/node/online"
+
+// numaStateDir is the directory where the policies
+// of files are recorded.
+const numaStateDir = "/var/lib/gru/numa"
+
+// numaNodeMask matches NUMA node masks, e.g. "0-1,3" or "all"
+var numaNodeMask = regexp.MustCompile(`^(all|\d+(-\d+)?(,\d+(-\d+)?)*)$`)
+
+// NUMAPolicy type is a resource which manages the NUMA memory
+// policy on a GNU/Linux system.
+//
+// The policy is persisted in a drop-in configuration file, which
+// depends on the scope of the policy. With the "system" scope, the
+// default policy of the systemd service manager is set in a drop-in
+// in /etc/systemd/system.conf.d, and the manager is re-executed. With
+// the "process" scope, the policy of the processes of the systemd
+// unit given as target is set in a drop-in for the unit, and takes
+// effect once the unit is restarted. With the "file" scope, the
+// policy of the file given as target, e.g. a file in a tmpfs, is set
+// using numactl(8) and is recorded in /var/lib/gru/numa.
+//
+// Example:
+//   numa = resource.numa_policy.new("postgresql")
+//   numa.state = "present"
+//   numa.policy = "bind"
+//   numa.node_mask = "0-1"
+//   numa.scope = "process"
+//   numa.target = "postgresql.service"
+type NUMAPolicy struct {
+	Base
+
+	// Policy is the memory policy, either "bind", "interleave"
+	// or "preferred". Required.
+	Policy string `luar:"policy"`
+
+	// Node is the preferred node with the "preferred" policy, and
+	// the node used when no node mask is given. Defaults to 0.
+	Node int `luar:"node"`
+
+	// NodeMask is the list of nodes used with the "bind" and
+	// "interleave" policies, e.g. "0-1,3" or "all".
+	NodeMask string `luar:"node_mask"`
+
+	// Scope of the policy, either "system", "process" or "file".
+	// Defaults to "system".
+	Scope string `luar:"scope"`
+
+	// Target is the systemd unit with the "process" scope,
+	// and the path to the file with the "file" scope.
+	Target string `luar:"target"`
+
+	// DropIn is the path to the drop-in file in which the policy
+	// is persisted. Defaults to a path depending on the scope.
+	DropIn string `luar:"drop_in"`
+
+	// Path to the file listing the online NUMA nodes
+	online string `luar:"-"`
+}
+
+// NewNUMAPolicy creates a new resource for managing NUMA memory policy.
+func NewNUMAPolicy(name string) (Resource, error) {
+	n := &NUMAPolicy{
+		Base: Base{
+			Name:              name,
+			Type:              "numa_policy",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// Applying the policy reloads the service manager
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		Scope:  "system",
+		online: numaOnlinePath,
+	}
+
+	n.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "policy",
+			PropertySetFunc:      n.setPolicy,
+			PropertyIsSyncedFunc: n.isPolicySynced,
+		},
+	}
+
+	return n, nil
+}
+
+// Validate validates the resource.
+func (n *NUMAPolicy) Validate() error {
+	if err := n.Base.Validate(); err != nil {
+		return err
+	}
+
+	switch n.Policy {
+	case "bind", "interleave", "preferred":
+	default:
+		return fmt.Errorf("invalid policy '%s'", n.Policy)
+	}
+
+	if n.Node < 0 {
+		return fmt.Errorf("invalid node %d", n.Node)
+	}
+
+	if n.NodeMask != "" && !numaNodeMask.MatchString(n.NodeMask) {
+		return fmt.Errorf("invalid node mask '%s'", n.NodeMask)
+	}
+
+	switch n.Scope {
+	case "system":
+	case "process", "file":
+		if n.Target == "" {
+			return fmt.Errorf("must provide target for %s scope", n.Scope)
+		}
+	default:
+		return fmt.Errorf("invalid scope '%s'", n.Scope)
+	}
+
+	if n.DropIn == "" {
+		n.DropIn = n.defaultDropIn()
+	}
+
+	return nil
+}
+
+// defaultDropIn returns the path to the drop-in
+// file in which the policy is persisted.
+func (n *NUMAPolicy) defaultDropIn() string {
+	switch n.Scope {
+	case "process":
+		unit := n.Target
+		if !strings.Contains(unit, ".") {
+			unit += ".service"
+		}
+		return filepath.Join("/etc/systemd/system", unit+".d", "gru-numa.conf")
+	case "file":
+		return filepath.Join(numaStateDir, url.PathEscape(filepath.Clean(n.Target))+".conf")
+	default:
+		return filepath.Join("/etc/systemd/system.conf.d", "gru-numa-"+url.PathEscape(n.Name)+".conf")
+	}
+}
+
+// nodes returns the nodes to which the policy applies.
+func (n *NUMAPolicy) nodes() string {
+	if n.Policy == "preferred" || n.NodeMask == "" {
+		return strconv.Itoa(n.Node)
+	}
+
+	return n.NodeMask
+}
+
+// content returns the content of the drop-in file.
+func (n *NUMAPolicy) content() string {
+	var b strings.Builder
+	b.WriteString("# Managed by gru, do not edit\n")
+	switch n.Scope {
+	case "system":
+		b.WriteString("[Manager]\n")
+	case "process":
+		b.WriteString("[Service]\n")
+	case "file":
+		fmt.Fprintf(&b, "# Policy of %s\n", n.Target)
+	}
+	fmt.Fprintf(&b, "NUMAPolicy=%s\n", n.Policy)
+	fmt.Fprintf(&b, "NUMAMask=%s\n", n.nodes())
+
+	return b.String()
+}
+
+// Evaluate evaluates the state of the policy. The policy is
+// considered present if its drop-in file exists.
+func (n *NUMAPolicy) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    n.State,
+	}
+
+	if err := n.checkNodes(); err != nil {
+		return state, err
+	}
+
+	_, err := os.Stat(n.DropIn)
+	switch {
+	case os.IsNotExist(err):
+		state.Current = "absent"
+	case err != nil:
+		return state, err
+	default:
+		state.Current = "present"
+	}
+
+	return state, nil
+}
+
+// Create persists and applies the policy.
+func (n *NUMAPolicy) Create() error {
+	n.Printf("setting %s policy on nodes %s\n", n.Policy, n.nodes())
+
+	return n.apply()
+}
+
+// Delete removes the policy, restoring the default policy.
+func (n *NUMAPolicy) Delete() error {
+	n.Printf("removing policy\n")
+
+	if err := os.Remove(n.DropIn); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if n.Scope == "file" {
+		if _, err := os.Stat(n.Target); os.IsNotExist(err) {
+			return nil
+		}
+		return n.run("numactl", "--file", n.Target, "--localalloc")
+	}
+
+	return n.reload()
+}
+
+// isPolicySynced checks whether the persisted policy is the desired one.
+func (n *NUMAPolicy) isPolicySynced() (bool, error) {
+	data, err := ioutil.ReadFile(n.DropIn)
+	if os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return string(data) == n.content(), nil
+}
+
+// setPolicy persists and applies the desired policy.
+func (n *NUMAPolicy) setPolicy() error {
+	n.Printf("updating policy to %s on nodes %s\n", n.Policy, n.nodes())
+
+	return n.apply()
+}
+
+// apply writes the drop-in file and applies the policy.
+func (n *NUMAPolicy) apply() error {
+	if n.Scope == "file" {
+		flag := "--interleave="
+		switch n.Policy {
+		case "bind":
+			flag = "--membind="
+		case "preferred":
+			flag = "--preferred="
+		}
+
+		if err := n.run("numactl", "--file", n.Target, flag+n.nodes()); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(n.DropIn), 0755); err != nil {
+		return err
+	}
+
+	if err := writeFile(n.DropIn, []byte(n.content()), 0644); err != nil {
+		return err
+	}
+
+	if n.Scope == "file" {
+		return nil
+	}
+
+	return n.reload()
+}
+
+// reload makes systemd pick up the changed drop-in file.
+func (n *NUMAPolicy) reload() error {
+	if n.Scope == "system" {
+		return n.run("systemctl", "daemon-reexec")
+	}
+
+	if err := n.run("systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	n.Printf("policy takes effect once %s is restarted\n", n.Target)
+
+	return nil
+}
+
+// checkNodes checks whether the nodes of the policy are online.
+func (n *NUMAPolicy) checkNodes() error {
+	data, err := ioutil.ReadFile(n.online)
+	if os.IsNotExist(err) {
+		return errors.New("NUMA is not supported on this system")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	online, err := parseNUMANodes(strings.TrimSpace(string(data)))
+	if err != nil {
+		return err
+	}
+
+	if n.nodes() == "all" {
+		return nil
+	}
+
+	want, err := parseNUMANodes(n.nodes())
+	if err != nil {
+		return err
+	}
+
+	for node := range want {
+		if !online[node] {
+			return fmt.Errorf("NUMA node %d is not online", node)
+		}
+	}
+
+	return nil
+}
+
+// run executes a command and logs any error output.
+func (n *NUMAPolicy) run(name string, args ...string) error {
+	spec := utils.CommandSpec{Args: append([]string{name}, args...)}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("%s failed: %s: %s", name, err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+// parseNUMANodes parses a list of NUMA nodes, e.g. "0-1,3".
+func parseNUMANodes(s string) (map[int]bool, error) {
+	nodes := make(map[int]bool)
+	for _, item := range strings.Split(s, ",") {
+		bounds := strings.SplitN(item, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid NUMA nodes '%s'", s)
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil || last < first {
+				return nil, fmt.Errorf("invalid NUMA nodes '%s'", s)
+			}
+		}
+
+		for node := first; node <= last; node++ {
+			nodes[node] = true
+		}
+	}
+
+	return nodes, nil
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "numa_policy",
+		Provider:  NewNUMAPolicy,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
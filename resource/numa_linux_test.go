@@ -0,0 +1,175 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+// +build linux
+
+package resource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestNUMAPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-numa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	online := filepath.Join(dir, "online")
+	if err := ioutil.WriteFile(online, []byte("0-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake the commands being executed
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	r, err := NewNUMAPolicy("postgresql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := r.(*NUMAPolicy)
+	n.Policy = "bind"
+	n.NodeMask = "0-1"
+	n.Scope = "process"
+	n.Target = "postgresql"
+	if err := n.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "/etc/systemd/system/postgresql.service.d/gru-numa.conf", n.DropIn)
+
+	n.DropIn = filepath.Join(dir, "postgresql.service.d", "gru-numa.conf")
+	n.online = online
+
+	state, err := n.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	_, err = n.isPolicySynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	if err := n.Create(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"systemctl daemon-reload"}, commands)
+
+	content, err := ioutil.ReadFile(n.DropIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "# Managed by gru, do not edit\n[Service]\nNUMAPolicy=bind\nNUMAMask=0-1\n", string(content))
+
+	state, err = n.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+	errorIfNotEqual(t, []string{}, outOfSync(t, n))
+
+	// The preferred policy uses a single node
+	n.Policy = "preferred"
+	n.Node = 1
+	errorIfNotEqual(t, []string{"policy"}, outOfSync(t, n))
+
+	// Nodes which are not online are rejected
+	n.Node = 2
+	if _, err := n.Evaluate(); err == nil {
+		t.Error("want error for node which is not online")
+	}
+
+	if err := n.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(n.DropIn); !os.IsNotExist(err) {
+		t.Error("want drop-in file removed")
+	}
+
+	// The policy of files is set using numactl
+	commands = nil
+	target := filepath.Join(dir, "shm")
+	if err := ioutil.WriteFile(target, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = NewNUMAPolicy("shm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := r.(*NUMAPolicy)
+	f.Policy = "interleave"
+	f.NodeMask = "all"
+	f.Scope = "file"
+	f.Target = target
+	f.DropIn = filepath.Join(dir, "shm.conf")
+	f.online = online
+	if err := f.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"numactl --file " + target + " --interleave=all",
+		"numactl --file " + target + " --localalloc",
+	}
+	errorIfNotEqual(t, want, commands)
+}
+
+func TestParseNUMANodes(t *testing.T) {
+	nodes, err := parseNUMANodes("0-2,5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, map[int]bool{0: true, 1: true, 2: true, 5: true}, nodes)
+
+	for _, s := range []string{"", "a", "3-1", "1-"} {
+		if _, err := parseNUMANodes(s); err == nil {
+			t.Errorf("want error for %q", s)
+		}
+	}
+}
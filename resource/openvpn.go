@@ -0,0 +1,641 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// Default paths used by the OpenVPN resources
+const (
+	openvpnConfigDir       = "/etc/openvpn"
+	openvpnClientConfigDir = "/etc/openvpn/ccd"
+)
+
+// openvpnDirective type represents a directive in an
+// OpenVPN configuration file.
+type openvpnDirective struct {
+	name string
+	args string
+}
+
+// key returns the key used for comparing the directive.
+// Pushed DNS servers are managed separately from any
+// other pushed options.
+func (d openvpnDirective) key() string {
+	if d.name == "push" && strings.HasPrefix(d.args, `"dhcp-option DNS `) {
+		return "push dhcp-option DNS"
+	}
+
+	return d.name
+}
+
+// String returns the directive as a line in the configuration file.
+func (d openvpnDirective) String() string {
+	if d.args == "" {
+		return d.name
+	}
+
+	return d.name + " " + d.args
+}
+
+// OpenVPNConfig type is a resource which manages the configuration
+// of an OpenVPN server.
+//
+// Only the directives declared by the resource are managed, any other
+// directives in the configuration file, e.g. the paths to keys and
+// certificates, are preserved. The OpenVPN service is reloaded after
+// the configuration has been changed.
+//
+// Example:
+//   vpn = resource.openvpn.new("server")
+//   vpn.state = "present"
+//   vpn.port = 1194
+//   vpn.protocol = "udp"
+//   vpn.subnet = "10.8.0.0/24"
+//   vpn.dns = { "10.8.0.1" }
+//   vpn.tls_version = "1.2"
+//   vpn.client_config_dir = "/etc/openvpn/ccd"
+type OpenVPNConfig struct {
+	Base
+
+	// ConfigFile is the path to the configuration file.
+	// Defaults to /etc/openvpn/<name>.conf.
+	ConfigFile string `luar:"config_file"`
+
+	// Port to listen on. Defaults to 1194.
+	Port int `luar:"port"`
+
+	// Protocol is either "udp" or "tcp". Defaults to "udp".
+	Protocol string `luar:"protocol"`
+
+	// Dev is the virtual network device, e.g. "tun" or "tap0".
+	// Defaults to "tun".
+	Dev string `luar:"dev"`
+
+	// Subnet from which addresses are assigned to clients,
+	// e.g. "10.8.0.0/24".
+	Subnet string `luar:"subnet"`
+
+	// DNS contains the DNS servers pushed to clients.
+	DNS []string `luar:"dns"`
+
+	// Cipher used for the data channel. Defaults to "AES-256-GCM".
+	Cipher string `luar:"cipher"`
+
+	// TLSVersion is the minimum TLS version, e.g. "1.2".
+	TLSVersion string `luar:"tls_version"`
+
+	// ClientConfigDir is the directory containing the
+	// client specific configuration files.
+	ClientConfigDir string `luar:"client_config_dir"`
+
+	// Systemd unit of the OpenVPN service
+	unit string `luar:"-"`
+}
+
+// NewOpenVPNConfig creates a new resource for managing
+// the configuration of an OpenVPN server.
+func NewOpenVPNConfig(name string) (Resource, error) {
+	o := &OpenVPNConfig{
+		Base: Base{
+			Name:              name,
+			Type:              "openvpn",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		ConfigFile: filepath.Join(openvpnConfigDir, name+".conf"),
+		Port:       1194,
+		Protocol:   "udp",
+		Dev:        "tun",
+		DNS:        make([]string, 0),
+		Cipher:     "AES-256-GCM",
+		unit:       fmt.Sprintf("openvpn@%s", name),
+	}
+
+	o.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "config",
+			PropertySetFunc:      o.setConfig,
+			PropertyIsSyncedFunc: o.isConfigSynced,
+		},
+	}
+
+	return o, nil
+}
+
+// Validate validates the resource.
+func (o *OpenVPNConfig) Validate() error {
+	if err := o.Base.Validate(); err != nil {
+		return err
+	}
+
+	if o.ConfigFile == "" {
+		return errors.New("must provide path to configuration file")
+	}
+
+	if o.Port < 1 || o.Port > 65535 {
+		return fmt.Errorf("invalid port %d", o.Port)
+	}
+
+	switch o.Protocol {
+	case "udp", "tcp":
+	default:
+		return fmt.Errorf("invalid protocol '%s'", o.Protocol)
+	}
+
+	if !strings.HasPrefix(o.Dev, "tun") && !strings.HasPrefix(o.Dev, "tap") {
+		return fmt.Errorf("invalid device '%s'", o.Dev)
+	}
+
+	if o.Subnet != "" {
+		if _, _, err := openvpnSubnet(o.Subnet); err != nil {
+			return err
+		}
+	}
+
+	for _, server := range o.DNS {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("invalid DNS server '%s'", server)
+		}
+	}
+
+	switch o.TLSVersion {
+	case "", "1.0", "1.1", "1.2", "1.3":
+	default:
+		return fmt.Errorf("invalid TLS version '%s'", o.TLSVersion)
+	}
+
+	for _, value := range []string{o.Cipher, o.ClientConfigDir} {
+		if strings.ContainsAny(value, " \t\n\"") {
+			return fmt.Errorf("invalid value '%s'", value)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the OpenVPN configuration.
+func (o *OpenVPNConfig) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    o.State,
+	}
+
+	fi, err := os.Stat(o.ConfigFile)
+	if os.IsNotExist(err) {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return state, errors.New("path exists, but is not a regular file")
+	}
+
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create creates the OpenVPN configuration file.
+func (o *OpenVPNConfig) Create() error {
+	o.Printf("creating %s\n", o.ConfigFile)
+
+	if err := o.writeConfig(nil); err != nil {
+		return err
+	}
+
+	return o.reload()
+}
+
+// Delete removes the OpenVPN configuration file.
+func (o *OpenVPNConfig) Delete() error {
+	o.Printf("removing %s\n", o.ConfigFile)
+
+	return os.Remove(o.ConfigFile)
+}
+
+// directives returns the directives managed by the resource,
+// in the order in which they are written to the configuration file.
+func (o *OpenVPNConfig) directives() []openvpnDirective {
+	directives := []openvpnDirective{
+		{"port", strconv.Itoa(o.Port)},
+		{"proto", o.Protocol},
+		{"dev", o.Dev},
+	}
+
+	if o.Subnet != "" {
+		network, mask, _ := openvpnSubnet(o.Subnet)
+		directives = append(directives, openvpnDirective{"server", network + " " + mask})
+	}
+
+	for _, server := range o.DNS {
+		directives = append(directives, openvpnDirective{"push", fmt.Sprintf(`"dhcp-option DNS %s"`, server)})
+	}
+
+	if o.Cipher != "" {
+		directives = append(directives, openvpnDirective{"cipher", o.Cipher})
+	}
+
+	if o.TLSVersion != "" {
+		directives = append(directives, openvpnDirective{"tls-version-min", o.TLSVersion})
+	}
+
+	if o.ClientConfigDir != "" {
+		directives = append(directives, openvpnDirective{"client-config-dir", o.ClientConfigDir})
+	}
+
+	return directives
+}
+
+// managedKeys returns the keys of the directives managed by the resource.
+// Directives which are not declared are not managed either, except for
+// pushed DNS servers, which are always managed.
+func (o *OpenVPNConfig) managedKeys() map[string]bool {
+	keys := map[string]bool{
+		"push dhcp-option DNS": true,
+	}
+
+	for _, d := range o.directives() {
+		keys[d.key()] = true
+	}
+
+	return keys
+}
+
+// isConfigSynced checks whether the managed directives
+// in the configuration file are in sync.
+func (o *OpenVPNConfig) isConfigSynced() (bool, error) {
+	data, err := ioutil.ReadFile(o.ConfigFile)
+	if os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	current := make(map[string][]string)
+	for _, d := range parseOpenVPNConfig(data) {
+		current[d.key()] = append(current[d.key()], d.args)
+	}
+
+	want := make(map[string][]string)
+	for _, d := range o.directives() {
+		want[d.key()] = append(want[d.key()], d.args)
+	}
+
+	for key := range o.managedKeys() {
+		if !utils.SameStrings(current[key], want[key]) {
+			o.Debugf("directive %s is out of date\n", key)
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// setConfig updates the managed directives in the configuration file.
+func (o *OpenVPNConfig) setConfig() error {
+	o.Printf("updating %s\n", o.ConfigFile)
+
+	data, err := ioutil.ReadFile(o.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	if err := o.writeConfig(parseOpenVPNConfig(data)); err != nil {
+		return err
+	}
+
+	return o.reload()
+}
+
+// writeConfig writes the configuration file with the managed
+// directives, followed by any other existing directives.
+func (o *OpenVPNConfig) writeConfig(existing []openvpnDirective) error {
+	var buf bytes.Buffer
+
+	buf.WriteString("# Managed by gru\n")
+	for _, d := range o.directives() {
+		fmt.Fprintf(&buf, "%s\n", d)
+	}
+
+	managed := o.managedKeys()
+	for _, d := range existing {
+		if !managed[d.key()] {
+			fmt.Fprintf(&buf, "%s\n", d)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(o.ConfigFile), 0755); err != nil {
+		return err
+	}
+
+	return writeFile(o.ConfigFile, buf.Bytes(), 0644)
+}
+
+// reload reloads the OpenVPN service, if it is running.
+func (o *OpenVPNConfig) reload() error {
+	spec := utils.CommandSpec{Args: []string{"systemctl", "is-active", "--quiet", o.unit}}
+	if _, err := utils.RunCommand(context.Background(), spec); err != nil {
+		o.Printf("%s is not running, skipping reload\n", o.unit)
+		return nil
+	}
+
+	o.Printf("reloading %s\n", o.unit)
+
+	spec = utils.CommandSpec{Args: []string{"systemctl", "reload", o.unit}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("unable to reload %s: %s: %s", o.unit, err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+// OpenVPNClientConfig type is a resource which manages the client
+// specific configuration of an OpenVPN server, which is read from
+// the client config directory when the client connects.
+//
+// The resource name is the common name of the client certificate.
+//
+// Example:
+//   laptop = resource.openvpn_client.new("laptop")
+//   laptop.state = "present"
+//   laptop.address = "10.8.0.10"
+//   laptop.netmask = "255.255.255.0"
+//   laptop.routes = { "192.168.10.0/24" }
+//   laptop.push = { "route 192.168.20.0 255.255.255.0" }
+type OpenVPNClientConfig struct {
+	Base
+
+	// ClientConfigDir is the client config directory.
+	// Defaults to /etc/openvpn/ccd.
+	ClientConfigDir string `luar:"client_config_dir"`
+
+	// Address is the static address assigned to the client.
+	Address string `luar:"address"`
+
+	// Netmask of the address assigned to the client.
+	// Defaults to "255.255.255.0".
+	Netmask string `luar:"netmask"`
+
+	// Routes contains the subnets routed through the client.
+	Routes []string `luar:"routes"`
+
+	// Push contains the options pushed to the client.
+	Push []string `luar:"push"`
+}
+
+// NewOpenVPNClientConfig creates a new resource for managing
+// the client specific configuration of an OpenVPN server.
+func NewOpenVPNClientConfig(name string) (Resource, error) {
+	o := &OpenVPNClientConfig{
+		Base: Base{
+			Name:              name,
+			Type:              "openvpn_client",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		ClientConfigDir: openvpnClientConfigDir,
+		Netmask:         "255.255.255.0",
+		Routes:          make([]string, 0),
+		Push:            make([]string, 0),
+	}
+
+	o.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "config",
+			PropertySetFunc:      o.setConfig,
+			PropertyIsSyncedFunc: o.isConfigSynced,
+		},
+	}
+
+	return o, nil
+}
+
+// Validate validates the resource.
+func (o *OpenVPNClientConfig) Validate() error {
+	if err := o.Base.Validate(); err != nil {
+		return err
+	}
+
+	if o.Name == "" || strings.ContainsAny(o.Name, "/\\") || o.Name == "." || o.Name == ".." {
+		return fmt.Errorf("invalid client name '%s'", o.Name)
+	}
+
+	if o.ClientConfigDir == "" {
+		return errors.New("must provide client config directory")
+	}
+
+	if o.Address != "" && net.ParseIP(o.Address) == nil {
+		return fmt.Errorf("invalid address '%s'", o.Address)
+	}
+
+	if net.ParseIP(o.Netmask) == nil {
+		return fmt.Errorf("invalid netmask '%s'", o.Netmask)
+	}
+
+	for _, route := range o.Routes {
+		if _, _, err := openvpnSubnet(route); err != nil {
+			return err
+		}
+	}
+
+	for _, option := range o.Push {
+		if strings.ContainsAny(option, "\n\"") {
+			return fmt.Errorf("invalid push option '%s'", option)
+		}
+	}
+
+	return nil
+}
+
+// path returns the path to the client configuration file.
+func (o *OpenVPNClientConfig) path() string {
+	return filepath.Join(o.ClientConfigDir, o.Name)
+}
+
+// Evaluate evaluates the state of the client configuration.
+func (o *OpenVPNClientConfig) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    o.State,
+	}
+
+	_, err := os.Stat(o.path())
+	if os.IsNotExist(err) {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create creates the client configuration file.
+func (o *OpenVPNClientConfig) Create() error {
+	o.Printf("creating %s\n", o.path())
+
+	return o.writeConfig()
+}
+
+// Delete removes the client configuration file.
+func (o *OpenVPNClientConfig) Delete() error {
+	o.Printf("removing %s\n", o.path())
+
+	return os.Remove(o.path())
+}
+
+// content returns the content of the client configuration file.
+func (o *OpenVPNClientConfig) content() []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("# Managed by gru, do not edit\n")
+	if o.Address != "" {
+		fmt.Fprintf(&buf, "ifconfig-push %s %s\n", o.Address, o.Netmask)
+	}
+
+	for _, route := range o.Routes {
+		network, mask, _ := openvpnSubnet(route)
+		fmt.Fprintf(&buf, "iroute %s %s\n", network, mask)
+	}
+
+	for _, option := range o.Push {
+		fmt.Fprintf(&buf, "push \"%s\"\n", option)
+	}
+
+	return buf.Bytes()
+}
+
+// isConfigSynced checks whether the client configuration file is in sync.
+func (o *OpenVPNClientConfig) isConfigSynced() (bool, error) {
+	data, err := ioutil.ReadFile(o.path())
+	if os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(data, o.content()), nil
+}
+
+// setConfig updates the client configuration file.
+func (o *OpenVPNClientConfig) setConfig() error {
+	o.Printf("updating %s\n", o.path())
+
+	return o.writeConfig()
+}
+
+// writeConfig writes the client configuration file.
+func (o *OpenVPNClientConfig) writeConfig() error {
+	if err := os.MkdirAll(o.ClientConfigDir, 0755); err != nil {
+		return err
+	}
+
+	return writeFile(o.path(), o.content(), 0644)
+}
+
+// openvpnSubnet returns the network address and netmask
+// of an IPv4 subnet in CIDR notation.
+func openvpnSubnet(subnet string) (string, string, error) {
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil || network.IP.To4() == nil {
+		return "", "", fmt.Errorf("invalid subnet '%s'", subnet)
+	}
+
+	return network.IP.String(), net.IP(network.Mask).String(), nil
+}
+
+// parseOpenVPNConfig parses the directives from an OpenVPN
+// configuration file, skipping any comments.
+func parseOpenVPNConfig(data []byte) []openvpnDirective {
+	directives := make([]openvpnDirective, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+
+		d := openvpnDirective{
+			name: fields[0],
+			args: strings.Join(fields[1:], " "),
+		}
+		directives = append(directives, d)
+	}
+
+	return directives
+}
+
+func init() {
+	openvpn := ProviderItem{
+		Type:      "openvpn",
+		Provider:  NewOpenVPNConfig,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	client := ProviderItem{
+		Type:      "openvpn_client",
+		Provider:  NewOpenVPNClientConfig,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(openvpn, client)
+}
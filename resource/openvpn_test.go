@@ -0,0 +1,177 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestOpenVPNConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-openvpn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	existing := `# Existing configuration
+port 1195
+proto udp
+dev tun
+ca /etc/openvpn/ca.crt
+cert /etc/openvpn/server.crt
+push "dhcp-option DNS 8.8.8.8"
+push "route 192.168.10.0 255.255.255.0"
+`
+	path := filepath.Join(dir, "server.conf")
+	if err := ioutil.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewOpenVPNConfig("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := r.(*OpenVPNConfig)
+	o.ConfigFile = path
+	o.Subnet = "10.8.0.0/24"
+	o.DNS = []string{"10.8.0.1"}
+	o.TLSVersion = "1.2"
+	if err := o.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	synced, err := o.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := o.setConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# Managed by gru
+port 1194
+proto udp
+dev tun
+server 10.8.0.0 255.255.255.0
+push "dhcp-option DNS 10.8.0.1"
+cipher AES-256-GCM
+tls-version-min 1.2
+ca /etc/openvpn/ca.crt
+cert /etc/openvpn/server.crt
+push "route 192.168.10.0 255.255.255.0"
+`
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, want, string(content))
+
+	synced, err = o.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	wantCommands := []string{
+		"systemctl is-active --quiet openvpn@server",
+		"systemctl reload openvpn@server",
+	}
+	errorIfNotEqual(t, wantCommands, commands)
+
+	o.Protocol = "icmp"
+	if err := o.Validate(); err == nil {
+		t.Error("want error for invalid protocol")
+	}
+}
+
+func TestOpenVPNClientConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-openvpn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewOpenVPNClientConfig("laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := r.(*OpenVPNClientConfig)
+	o.ClientConfigDir = filepath.Join(dir, "ccd")
+	o.Address = "10.8.0.10"
+	o.Routes = []string{"192.168.10.0/24"}
+	o.Push = []string{"route 192.168.20.0 255.255.255.0"}
+	if err := o.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := o.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := o.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# Managed by gru, do not edit
+ifconfig-push 10.8.0.10 255.255.255.0
+iroute 192.168.10.0 255.255.255.0
+push "route 192.168.20.0 255.255.255.0"
+`
+	content, err := ioutil.ReadFile(filepath.Join(dir, "ccd", "laptop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, want, string(content))
+
+	synced, err := o.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+}
@@ -0,0 +1,345 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) “AS IS” AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// ErrNoOSTreeDeployment is returned when rpm-ostree reports no deployments
+var ErrNoOSTreeDeployment = errors.New("No OSTree deployment found")
+
+// OSTreeLayeredPackage type is a resource which manages packages
+// layered on top of the base image of OSTree based systems, e.g.
+// Fedora Silverblue or RHEL CoreOS, using rpm-ostree(1).
+//
+// Layering packages creates a new deployment, which is activated on
+// the next boot. Packages are layered once requested by the default
+// deployment, even if it has not been booted yet, in which case the
+// state of the resource reports that a reboot is required.
+//
+// Example:
+//   tools = resource.ostree_layered_package.new("tools")
+//   tools.state = "present"
+//   tools.packages = { "htop", "tmux" }
+//   tools.versions = { htop = "3.2.2-1.fc38" }
+type OSTreeLayeredPackage struct {
+	Base
+
+	// Packages to layer. Defaults to the resource name.
+	Packages []string `luar:"packages"`
+
+	// Versions pins packages to the given version and optionally
+	// release, e.g. "3.2.2-1.fc38", keyed by the package name.
+	// Packages without a version are layered in any version.
+	Versions map[string]string `luar:"versions"`
+}
+
+// ostreeDeployment type represents a deployment
+// as reported by rpm-ostree.
+type ostreeDeployment struct {
+	// Booted specifies whether the deployment is the booted one
+	Booted bool `json:"booted"`
+
+	// Packages requested to be layered in the deployment
+	RequestedPackages []string `json:"requested-packages"`
+}
+
+// NewOSTreeLayeredPackage creates a new resource for managing
+// packages layered on OSTree based systems.
+func NewOSTreeLayeredPackage(name string) (Resource, error) {
+	p := &OSTreeLayeredPackage{
+		Base: Base{
+			Name:              name,
+			Type:              "ostree_layered_package",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// rpm-ostree runs a single transaction at a time
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		Packages: []string{name},
+		Versions: make(map[string]string),
+	}
+
+	p.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "packages",
+			PropertySetFunc:      p.Update,
+			PropertyIsSyncedFunc: p.isPackagesSynced,
+		},
+	}
+
+	return p, nil
+}
+
+// Validate validates the resource.
+func (p *OSTreeLayeredPackage) Validate() error {
+	if err := p.Base.Validate(); err != nil {
+		return err
+	}
+
+	if len(p.Packages) == 0 {
+		return errors.New("no packages specified")
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range p.Packages {
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return fmt.Errorf("invalid package name '%s'", name)
+		}
+
+		if seen[name] {
+			return fmt.Errorf("duplicate package '%s'", name)
+		}
+		seen[name] = true
+	}
+
+	for name, version := range p.Versions {
+		if !seen[name] {
+			return fmt.Errorf("version specified for unknown package '%s'", name)
+		}
+
+		if version == "" {
+			return fmt.Errorf("empty version for package '%s'", name)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the layered packages. The resource
+// is present if any of its packages is layered in the default deployment.
+func (p *OSTreeLayeredPackage) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    p.State,
+	}
+
+	d, err := p.deployment()
+	if err != nil {
+		return state, err
+	}
+
+	state.RebootRequired = !d.Booted
+	if len(p.layered(d)) > 0 {
+		state.Current = "present"
+	} else {
+		state.Current = "absent"
+	}
+
+	return state, nil
+}
+
+// Create layers the packages.
+func (p *OSTreeLayeredPackage) Create() error {
+	specs := make([]string, 0, len(p.Packages))
+	for _, name := range p.Packages {
+		specs = append(specs, p.spec(name))
+	}
+
+	p.Printf("layering packages %s\n", strings.Join(specs, ", "))
+	args := append([]string{"install", "--idempotent"}, specs...)
+
+	return p.run(args...)
+}
+
+// Delete removes the layered packages.
+func (p *OSTreeLayeredPackage) Delete() error {
+	d, err := p.deployment()
+	if err != nil {
+		return err
+	}
+
+	layered := p.layered(d)
+	specs := make([]string, 0, len(layered))
+	for _, name := range p.Packages {
+		if spec, ok := layered[name]; ok {
+			specs = append(specs, spec)
+		}
+	}
+
+	p.Printf("removing layered packages %s\n", strings.Join(specs, ", "))
+	args := append([]string{"uninstall", "--idempotent"}, specs...)
+
+	return p.run(args...)
+}
+
+// Update layers any missing packages and replaces packages layered
+// in a different version than the pinned one in a single transaction.
+func (p *OSTreeLayeredPackage) Update() error {
+	d, err := p.deployment()
+	if err != nil {
+		return err
+	}
+
+	layered := p.layered(d)
+	remove := make([]string, 0)
+	install := make([]string, 0)
+	for _, name := range p.Packages {
+		want := p.spec(name)
+		spec, ok := layered[name]
+		switch {
+		case !ok:
+			p.Printf("layering package %s\n", want)
+			install = append(install, want)
+		case spec != want:
+			p.Printf("replacing layered package %s with %s\n", spec, want)
+			remove = append(remove, spec)
+			install = append(install, want)
+		}
+	}
+
+	if len(remove) == 0 {
+		return p.run(append([]string{"install", "--idempotent"}, install...)...)
+	}
+
+	args := append([]string{"uninstall"}, remove...)
+	for _, spec := range install {
+		args = append(args, "--install", spec)
+	}
+
+	return p.run(args...)
+}
+
+// isPackagesSynced checks whether all packages are
+// layered in their desired versions.
+func (p *OSTreeLayeredPackage) isPackagesSynced() (bool, error) {
+	d, err := p.deployment()
+	if err != nil {
+		return false, err
+	}
+
+	layered := p.layered(d)
+	if len(layered) == 0 {
+		return false, ErrResourceAbsent
+	}
+
+	for _, name := range p.Packages {
+		if layered[name] != p.spec(name) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// spec returns the package specification requested
+// from rpm-ostree when layering a package.
+func (p *OSTreeLayeredPackage) spec(name string) string {
+	if version, ok := p.Versions[name]; ok {
+		return name + "-" + version
+	}
+
+	return name
+}
+
+// layered returns the package specifications requested by a
+// deployment for the packages of the resource, keyed by name.
+func (p *OSTreeLayeredPackage) layered(d *ostreeDeployment) map[string]string {
+	layered := make(map[string]string)
+	for _, spec := range d.RequestedPackages {
+		for _, name := range p.Packages {
+			if ostreePackageMatches(spec, name) {
+				layered[name] = spec
+			}
+		}
+	}
+
+	return layered
+}
+
+// deployment returns the default deployment, which
+// is the one activated on the next boot.
+func (p *OSTreeLayeredPackage) deployment() (*ostreeDeployment, error) {
+	spec := utils.CommandSpec{Args: []string{"rpm-ostree", "status", "--json"}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get rpm-ostree status: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	var status struct {
+		Deployments []*ostreeDeployment `json:"deployments"`
+	}
+
+	if err := json.Unmarshal(result.Stdout, &status); err != nil {
+		return nil, fmt.Errorf("unable to parse rpm-ostree status: %s", err)
+	}
+
+	if len(status.Deployments) == 0 {
+		return nil, ErrNoOSTreeDeployment
+	}
+
+	return status.Deployments[0], nil
+}
+
+// run executes rpm-ostree with the given arguments. A reboot
+// is required to activate the deployment created by it.
+func (p *OSTreeLayeredPackage) run(args ...string) error {
+	spec := utils.CommandSpec{Args: append([]string{"rpm-ostree"}, args...)}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("rpm-ostree %s failed: %s: %s", args[0], err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	p.Printf("reboot required to activate the deployment\n")
+
+	return nil
+}
+
+// ostreePackageMatches returns a boolean indicating whether a
+// package specification requested from rpm-ostree refers to
+// the named package, either by name or pinned to a version.
+func ostreePackageMatches(spec, name string) bool {
+	if spec == name {
+		return true
+	}
+
+	version := strings.TrimPrefix(spec, name+"-")
+	if version == spec || version == "" {
+		return false
+	}
+
+	return version[0] >= '0' && version[0] <= '9'
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "ostree_layered_package",
+		Provider:  NewOSTreeLayeredPackage,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
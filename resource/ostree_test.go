@@ -0,0 +1,181 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestOSTreeLayeredPackage(t *testing.T) {
+	L := newLuaState()
+	defer L.Close()
+
+	const code = `
+	htop = resource.ostree_layered_package.new("htop")
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	p := luaResource(L, "htop").(*OSTreeLayeredPackage)
+	errorIfNotEqual(t, "ostree_layered_package", p.Type)
+	errorIfNotEqual(t, "htop", p.Name)
+	errorIfNotEqual(t, "present", p.State)
+	errorIfNotEqual(t, false, p.Concurrent)
+	errorIfNotEqual(t, []string{"htop"}, p.Packages)
+	errorIfNotEqual(t, map[string]string{}, p.Versions)
+}
+
+func TestOSTreeLayeredPackageValidate(t *testing.T) {
+	testCases := []struct {
+		packages []string
+		versions map[string]string
+		wantErr  bool
+	}{
+		{[]string{"htop", "tmux"}, map[string]string{"htop": "3.2.2-1.fc38"}, false},
+		{[]string{}, nil, true},
+		{[]string{"htop", "htop"}, nil, true},
+		{[]string{"htop tmux"}, nil, true},
+		{[]string{"htop"}, map[string]string{"tmux": "3.3a"}, true},
+		{[]string{"htop"}, map[string]string{"htop": ""}, true},
+	}
+
+	for _, tc := range testCases {
+		r, err := NewOSTreeLayeredPackage("tools")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := r.(*OSTreeLayeredPackage)
+		p.Packages = tc.packages
+		p.Versions = tc.versions
+		if err := p.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("packages %v, versions %v: unexpected error %v", tc.packages, tc.versions, err)
+		}
+	}
+}
+
+func TestOSTreePackageMatches(t *testing.T) {
+	testCases := []struct {
+		spec string
+		name string
+		want bool
+	}{
+		{"htop", "htop", true},
+		{"htop-3.2.2-1.fc38", "htop", true},
+		{"htop-devel", "htop", false},
+		{"htop-", "htop", false},
+		{"tmux", "htop", false},
+	}
+
+	for _, tc := range testCases {
+		if got := ostreePackageMatches(tc.spec, tc.name); got != tc.want {
+			t.Errorf("%s matches %s: want %t, got %t", tc.spec, tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestOSTreeLayeredPackageEvaluate(t *testing.T) {
+	// Fake the commands being executed
+	status := `{"deployments": [{"booted": true, "requested-packages": []}]}`
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		if spec.Args[1] == "status" {
+			return utils.CommandResult{Stdout: []byte(status)}, nil
+		}
+		commands = append(commands, strings.Join(spec.Args, " "))
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	r, err := NewOSTreeLayeredPackage("tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := r.(*OSTreeLayeredPackage)
+	p.Packages = []string{"htop", "tmux"}
+	p.Versions = map[string]string{"htop": "3.2.2-1.fc38"}
+
+	state, err := p.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, State{Current: "absent", Want: "present"}, state)
+
+	if err := p.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Packages requested by a deployment, which is not booted yet
+	// are layered, but require a reboot
+	status = `{"deployments": [
+	  {"booted": false, "requested-packages": ["htop-3.2.1-1.fc38", "vim"]},
+	  {"booted": true, "requested-packages": []}
+	]}`
+
+	state, err = p.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, State{Current: "present", Want: "present", RebootRequired: true}, state)
+
+	synced, err := p.isPackagesSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := p.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	p.State = "absent"
+	if err := p.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"rpm-ostree install --idempotent htop-3.2.2-1.fc38 tmux",
+		"rpm-ostree uninstall htop-3.2.1-1.fc38 --install htop-3.2.2-1.fc38 --install tmux",
+		"rpm-ostree uninstall --idempotent htop-3.2.1-1.fc38",
+	}
+	errorIfNotEqual(t, want, commands)
+
+	// Packages are absent if no deployment requests them
+	status = `{"deployments": [{"booted": true, "requested-packages": ["vim"]}]}`
+	if _, err := p.isPackagesSynced(); err != ErrResourceAbsent {
+		t.Errorf("want %v, got %v", ErrResourceAbsent, err)
+	}
+}
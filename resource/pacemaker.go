@@ -0,0 +1,561 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// pacemakerIDRegexp matches valid ids of cluster resources.
+var pacemakerIDRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.-]*$`)
+
+// PacemakerOp type represents an operation of a cluster resource.
+type PacemakerOp struct {
+	// Name of the operation, e.g. "monitor".
+	Name string `luar:"name"`
+
+	// Interval of the operation, e.g. "10s".
+	Interval string `luar:"interval"`
+
+	// Timeout of the operation, e.g. "20s".
+	Timeout string `luar:"timeout"`
+}
+
+// PacemakerResource type is a resource which manages
+// primitive resources of a Pacemaker cluster.
+//
+// The name of the resource is the id of the cluster resource.
+// Parameters not declared by the resource are removed from the
+// cluster resource, while meta attributes not declared are left
+// untouched, as they are also set by the cluster, e.g. when
+// stopping the resource using "crm resource stop".
+//
+// Example:
+//   vip = resource.pacemaker_resource.new("vip")
+//   vip.class = "ocf"
+//   vip.provider = "heartbeat"
+//   vip.type = "IPaddr2"
+//   vip.params = { ip = "192.0.2.10", cidr_netmask = "24" }
+//   vip.operations = {
+//     { name = "monitor", interval = "10s", timeout = "20s" },
+//   }
+//   vip.meta_attrs = { ["resource-stickiness"] = "100" }
+type PacemakerResource struct {
+	Base
+
+	// Class of the resource agent, either "ocf",
+	// "lsb" or "systemd". Defaults to "ocf".
+	Class string `luar:"class"`
+
+	// Provider of the resource agent, e.g. "heartbeat".
+	// Only valid for the "ocf" class.
+	Provider string `luar:"provider"`
+
+	// AgentType is the type of the resource agent, e.g. "IPaddr2".
+	AgentType string `luar:"type"`
+
+	// Params contains the parameters of the resource.
+	Params map[string]string `luar:"params"`
+
+	// Operations of the resource.
+	Operations []PacemakerOp `luar:"operations"`
+
+	// MetaAttrs contains the meta attributes of the resource.
+	MetaAttrs map[string]string `luar:"meta_attrs"`
+}
+
+// pacemakerNVPair type represents a name-value pair in the CIB.
+type pacemakerNVPair struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// pacemakerPrimitive type represents a primitive resource in the CIB.
+type pacemakerPrimitive struct {
+	Class    string            `xml:"class,attr"`
+	Provider string            `xml:"provider,attr"`
+	Type     string            `xml:"type,attr"`
+	Params   []pacemakerNVPair `xml:"instance_attributes>nvpair"`
+	Meta     []pacemakerNVPair `xml:"meta_attributes>nvpair"`
+	Ops      []struct {
+		Name     string `xml:"name,attr"`
+		Interval string `xml:"interval,attr"`
+		Timeout  string `xml:"timeout,attr"`
+	} `xml:"operations>op"`
+}
+
+// NewPacemakerResource creates a new resource for
+// managing resources of a Pacemaker cluster.
+func NewPacemakerResource(name string) (Resource, error) {
+	p := &PacemakerResource{
+		Base: Base{
+			Name:              name,
+			Type:              "pacemaker_resource",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// Concurrent changes to the cluster configuration may fail
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		Class:      "ocf",
+		Params:     make(map[string]string),
+		Operations: make([]PacemakerOp, 0),
+		MetaAttrs:  make(map[string]string),
+	}
+
+	p.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "agent",
+			PropertySetFunc:      p.setAgent,
+			PropertyIsSyncedFunc: p.isAgentSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "params",
+			PropertySetFunc:      p.setParams,
+			PropertyIsSyncedFunc: p.isParamsSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "meta_attrs",
+			PropertySetFunc:      p.setMetaAttrs,
+			PropertyIsSyncedFunc: p.isMetaAttrsSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "operations",
+			PropertySetFunc:      p.setOperations,
+			PropertyIsSyncedFunc: p.isOperationsSynced,
+		},
+	}
+
+	return p, nil
+}
+
+// Validate validates the resource.
+func (p *PacemakerResource) Validate() error {
+	if err := p.Base.Validate(); err != nil {
+		return err
+	}
+
+	if !pacemakerIDRegexp.MatchString(p.Name) {
+		return fmt.Errorf("invalid resource id '%s'", p.Name)
+	}
+
+	switch p.Class {
+	case "ocf":
+		if p.Provider == "" {
+			return errors.New("provider is required for ocf resources")
+		}
+	case "lsb", "systemd":
+		if p.Provider != "" {
+			return fmt.Errorf("provider cannot be given for %s resources", p.Class)
+		}
+	default:
+		return fmt.Errorf("invalid class '%s'", p.Class)
+	}
+
+	if p.AgentType == "" || strings.ContainsAny(p.AgentType, ": \t") {
+		return fmt.Errorf("invalid type '%s'", p.AgentType)
+	}
+
+	for _, attrs := range []map[string]string{p.Params, p.MetaAttrs} {
+		for name := range attrs {
+			if !pacemakerIDRegexp.MatchString(name) {
+				return fmt.Errorf("invalid attribute name '%s'", name)
+			}
+		}
+	}
+
+	for _, op := range p.Operations {
+		if !pacemakerIDRegexp.MatchString(op.Name) {
+			return fmt.Errorf("invalid operation name '%s'", op.Name)
+		}
+
+		for _, value := range []string{op.Interval, op.Timeout} {
+			if strings.ContainsAny(value, " \t\n\"'") {
+				return fmt.Errorf("invalid value '%s' for operation %s", value, op.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the cluster resource.
+func (p *PacemakerResource) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    p.State,
+	}
+
+	primitive, err := p.query()
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "absent"
+	if primitive != nil {
+		state.Current = "present"
+	}
+
+	return state, nil
+}
+
+// Create creates the cluster resource.
+func (p *PacemakerResource) Create() error {
+	p.Printf("creating resource %s\n", p.agent())
+
+	args := append([]string{"crm", "configure", "primitive"}, p.definition()...)
+	_, err := p.run(utils.CommandSpec{Args: args})
+
+	return err
+}
+
+// Delete removes the cluster resource.
+func (p *PacemakerResource) Delete() error {
+	p.Printf("removing resource\n")
+
+	_, err := p.run(utils.CommandSpec{Args: []string{"crm_resource", "--resource", p.Name, "--delete", "--resource-type", "primitive"}})
+
+	return err
+}
+
+// isAgentSynced checks whether the resource agent is in sync.
+func (p *PacemakerResource) isAgentSynced() (bool, error) {
+	primitive, err := p.queryPresent()
+	if err != nil {
+		return false, err
+	}
+
+	return primitive.Class == p.Class && primitive.Provider == p.Provider && primitive.Type == p.AgentType, nil
+}
+
+// setAgent recreates the cluster resource, as
+// the agent of a resource cannot be changed.
+func (p *PacemakerResource) setAgent() error {
+	p.Printf("agent is out of date, recreating resource\n")
+
+	if err := p.Delete(); err != nil {
+		return err
+	}
+
+	return p.Create()
+}
+
+// isParamsSynced checks whether the parameters are in sync.
+func (p *PacemakerResource) isParamsSynced() (bool, error) {
+	primitive, err := p.queryPresent()
+	if err != nil {
+		return false, err
+	}
+
+	current := pacemakerAttrs(primitive.Params)
+	if len(current) != len(p.Params) {
+		return false, nil
+	}
+
+	for name, value := range p.Params {
+		if v, ok := current[name]; !ok || v != value {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// setParams sets the parameters, removing the ones not declared.
+func (p *PacemakerResource) setParams() error {
+	primitive, err := p.queryPresent()
+	if err != nil {
+		return err
+	}
+
+	return p.setAttrs(pacemakerAttrs(primitive.Params), p.Params, false)
+}
+
+// isMetaAttrsSynced checks whether the declared meta attributes are in sync.
+func (p *PacemakerResource) isMetaAttrsSynced() (bool, error) {
+	primitive, err := p.queryPresent()
+	if err != nil {
+		return false, err
+	}
+
+	current := pacemakerAttrs(primitive.Meta)
+	for name, value := range p.MetaAttrs {
+		if v, ok := current[name]; !ok || v != value {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// setMetaAttrs sets the declared meta attributes.
+func (p *PacemakerResource) setMetaAttrs() error {
+	primitive, err := p.queryPresent()
+	if err != nil {
+		return err
+	}
+
+	return p.setAttrs(pacemakerAttrs(primitive.Meta), p.MetaAttrs, true)
+}
+
+// isOperationsSynced checks whether the operations are in sync.
+func (p *PacemakerResource) isOperationsSynced() (bool, error) {
+	primitive, err := p.queryPresent()
+	if err != nil {
+		return false, err
+	}
+
+	current := make([]PacemakerOp, 0, len(primitive.Ops))
+	for _, op := range primitive.Ops {
+		current = append(current, PacemakerOp{Name: op.Name, Interval: op.Interval, Timeout: op.Timeout})
+	}
+
+	return reflect.DeepEqual(sortedPacemakerOps(current), sortedPacemakerOps(p.Operations)), nil
+}
+
+// setOperations updates the operations by loading the
+// definition of the resource into the cluster configuration,
+// as operations cannot be set using crm_resource(8).
+func (p *PacemakerResource) setOperations() error {
+	p.Printf("updating operations\n")
+
+	definition := "primitive " + strings.Join(p.definition(), " ") + "\n"
+	spec := utils.CommandSpec{
+		Args:  []string{"crm", "configure", "load", "update", "-"},
+		Stdin: strings.NewReader(definition),
+	}
+	_, err := p.run(spec)
+
+	return err
+}
+
+// setAttrs sets the differing parameters or meta attributes of
+// the cluster resource. Parameters not declared are removed.
+func (p *PacemakerResource) setAttrs(current, want map[string]string, meta bool) error {
+	resourceArgs := []string{"crm_resource", "--resource", p.Name}
+	if meta {
+		resourceArgs = append(resourceArgs, "--meta")
+	}
+
+	for _, name := range sortedStringKeys(want) {
+		if v, ok := current[name]; ok && v == want[name] {
+			continue
+		}
+
+		p.Printf("setting %s to %s\n", name, want[name])
+		args := append(append([]string{}, resourceArgs...), "--set-parameter", name, "--parameter-value", want[name])
+		if _, err := p.run(utils.CommandSpec{Args: args}); err != nil {
+			return err
+		}
+	}
+
+	if meta {
+		return nil
+	}
+
+	for _, name := range sortedStringKeys(current) {
+		if _, ok := want[name]; ok {
+			continue
+		}
+
+		p.Printf("removing %s\n", name)
+		args := append(append([]string{}, resourceArgs...), "--delete-parameter", name)
+		if _, err := p.run(utils.CommandSpec{Args: args}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// agent returns the specification of the resource
+// agent, e.g. "ocf:heartbeat:IPaddr2".
+func (p *PacemakerResource) agent() string {
+	if p.Provider == "" {
+		return p.Class + ":" + p.AgentType
+	}
+
+	return p.Class + ":" + p.Provider + ":" + p.AgentType
+}
+
+// definition returns the definition of the resource in the
+// syntax of crm(8), without the leading "primitive" keyword.
+func (p *PacemakerResource) definition() []string {
+	args := []string{p.Name, p.agent()}
+
+	if len(p.Params) > 0 {
+		args = append(args, "params")
+		for _, name := range sortedStringKeys(p.Params) {
+			args = append(args, name+"="+crmQuote(p.Params[name]))
+		}
+	}
+
+	if len(p.MetaAttrs) > 0 {
+		args = append(args, "meta")
+		for _, name := range sortedStringKeys(p.MetaAttrs) {
+			args = append(args, name+"="+crmQuote(p.MetaAttrs[name]))
+		}
+	}
+
+	for _, op := range p.Operations {
+		args = append(args, "op", op.Name)
+		if op.Interval != "" {
+			args = append(args, "interval="+op.Interval)
+		}
+		if op.Timeout != "" {
+			args = append(args, "timeout="+op.Timeout)
+		}
+	}
+
+	return args
+}
+
+// query returns the primitive from the cluster
+// configuration, or nil if it does not exist.
+func (p *PacemakerResource) query() (*pacemakerPrimitive, error) {
+	spec := utils.CommandSpec{Args: []string{"crm_resource", "--resource", p.Name, "--query-xml"}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		// Exit status 105 (no such object) is used by recent
+		// versions and 6 (ENXIO) by older ones
+		stderr := string(result.Stderr)
+		if result.ExitCode == 105 || result.ExitCode == 6 || strings.Contains(stderr, "not found") {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("crm_resource failed: %s: %s", err, strings.TrimSpace(stderr))
+	}
+
+	return parsePacemakerPrimitive(result.Stdout)
+}
+
+// queryPresent returns the primitive from the cluster configuration,
+// or ErrResourceAbsent if it does not exist.
+func (p *PacemakerResource) queryPresent() (*pacemakerPrimitive, error) {
+	primitive, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+
+	if primitive == nil {
+		return nil, ErrResourceAbsent
+	}
+
+	return primitive, nil
+}
+
+// run executes a command changing the cluster configuration.
+func (p *PacemakerResource) run(spec utils.CommandSpec) (utils.CommandResult, error) {
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return result, fmt.Errorf("%s failed: %s: %s", spec.Args[0], err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return result, nil
+}
+
+// parsePacemakerPrimitive parses the output of "crm_resource --query-xml",
+// which may contain text surrounding the XML of the primitive.
+func parsePacemakerPrimitive(data []byte) (*pacemakerPrimitive, error) {
+	i := bytes.Index(data, []byte("<primitive"))
+	if i == -1 {
+		return nil, errors.New("no primitive found in output of crm_resource")
+	}
+
+	primitive := new(pacemakerPrimitive)
+	if err := xml.NewDecoder(bytes.NewReader(data[i:])).Decode(primitive); err != nil {
+		return nil, fmt.Errorf("unable to parse output of crm_resource: %s", err)
+	}
+
+	return primitive, nil
+}
+
+// pacemakerAttrs returns the name-value pairs as a map.
+func pacemakerAttrs(pairs []pacemakerNVPair) map[string]string {
+	attrs := make(map[string]string)
+	for _, pair := range pairs {
+		attrs[pair.Name] = pair.Value
+	}
+
+	return attrs
+}
+
+// sortedPacemakerOps returns a copy of the operations sorted
+// by name and interval, as their order is not significant.
+func sortedPacemakerOps(ops []PacemakerOp) []PacemakerOp {
+	sorted := append([]PacemakerOp{}, ops...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Interval < sorted[j].Interval
+	})
+
+	return sorted
+}
+
+// crmQuote quotes a value for crm(8), if needed.
+func crmQuote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\"'\\") {
+		return value
+	}
+
+	return strconv.Quote(value)
+}
+
+// sortedStringKeys returns the sorted keys of a map.
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "pacemaker_resource",
+		Provider:  NewPacemakerResource,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestPacemakerResource(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	// Fake cluster returning the given primitive, if any
+	primitive := ""
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		if spec.Args[len(spec.Args)-1] == "--query-xml" {
+			if primitive == "" {
+				return utils.CommandResult{Stderr: []byte("Resource 'vip' not found\n"), ExitCode: 105}, errors.New("exit status 105")
+			}
+			return utils.CommandResult{Stdout: []byte("resource vip is NOT running\nxml:\n" + primitive)}, nil
+		}
+
+		command := strings.Join(spec.Args, " ")
+		if spec.Stdin != nil {
+			data, _ := ioutil.ReadAll(spec.Stdin)
+			command += " < " + string(data)
+		}
+		commands = append(commands, command)
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	r, err := NewPacemakerResource("vip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := r.(*PacemakerResource)
+	p.Provider = "heartbeat"
+	p.AgentType = "IPaddr2"
+	p.Params = map[string]string{"ip": "192.0.2.10", "cidr_netmask": "24"}
+	p.MetaAttrs = map[string]string{"description": "floating ip"}
+	p.Operations = []PacemakerOp{{Name: "monitor", Interval: "10s", Timeout: "20s"}}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create
+	state, err := p.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	_, err = p.isParamsSynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	if err := p.Create(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{`crm configure primitive vip ocf:heartbeat:IPaddr2 params cidr_netmask=24 ip=192.0.2.10 meta description="floating ip" op monitor interval=10s timeout=20s`}, commands)
+
+	primitive = `<primitive id="vip" class="ocf" provider="heartbeat" type="IPaddr2">
+  <instance_attributes id="vip-instance_attributes">
+    <nvpair id="vip-instance_attributes-cidr_netmask" name="cidr_netmask" value="24"/>
+    <nvpair id="vip-instance_attributes-ip" name="ip" value="192.0.2.10"/>
+  </instance_attributes>
+  <meta_attributes id="vip-meta_attributes">
+    <nvpair id="vip-meta_attributes-description" name="description" value="floating ip"/>
+    <nvpair id="vip-meta_attributes-target-role" name="target-role" value="Stopped"/>
+  </meta_attributes>
+  <operations>
+    <op id="vip-monitor-interval-10s" interval="10s" name="monitor" timeout="20s"/>
+  </operations>
+</primitive>
+`
+	state, err = p.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+
+	// Meta attributes set by the cluster are ignored
+	for _, prop := range p.Properties() {
+		synced, err := prop.IsSynced()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !synced {
+			t.Errorf("want property %s to be in sync", prop.Name())
+		}
+	}
+
+	// Drift
+	commands = nil
+	p.Params = map[string]string{"ip": "192.0.2.11", "nic": "eth0"}
+	p.MetaAttrs = map[string]string{"description": "floating ip", "resource-stickiness": "100"}
+	p.Operations = []PacemakerOp{{Name: "monitor", Interval: "30s", Timeout: "20s"}}
+	for _, prop := range p.Properties() {
+		synced, err := prop.IsSynced()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prop.Name() == "agent" {
+			errorIfNotEqual(t, true, synced)
+			continue
+		}
+		errorIfNotEqual(t, false, synced)
+		if err := prop.Set(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"crm_resource --resource vip --set-parameter ip --parameter-value 192.0.2.11",
+		"crm_resource --resource vip --set-parameter nic --parameter-value eth0",
+		"crm_resource --resource vip --delete-parameter cidr_netmask",
+		"crm_resource --resource vip --meta --set-parameter resource-stickiness --parameter-value 100",
+		`crm configure load update - < primitive vip ocf:heartbeat:IPaddr2 params ip=192.0.2.11 nic=eth0 meta description="floating ip" resource-stickiness=100 op monitor interval=30s timeout=20s` + "\n",
+	}
+	errorIfNotEqual(t, want, commands)
+
+	// Agent drift
+	commands = nil
+	p.AgentType = "IPaddr"
+	synced, err := p.isAgentSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := p.setAgent(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "crm_resource --resource vip --delete --resource-type primitive", commands[0])
+	errorIfNotEqual(t, true, strings.HasPrefix(commands[1], "crm configure primitive vip ocf:heartbeat:IPaddr params"))
+}
+
+func TestPacemakerResourceValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		class    string
+		provider string
+		agent    string
+		params   map[string]string
+		valid    bool
+	}{
+		{"vip", "ocf", "heartbeat", "IPaddr2", nil, true},
+		{"web", "systemd", "", "nginx", nil, true},
+		{"web", "systemd", "heartbeat", "nginx", nil, false},
+		{"vip", "ocf", "", "IPaddr2", nil, false},
+		{"vip", "stonith", "", "fence_ipmilan", nil, false},
+		{"1vip", "ocf", "heartbeat", "IPaddr2", nil, false},
+		{"vip", "ocf", "heartbeat", "", nil, false},
+		{"vip", "ocf", "heartbeat", "IPaddr2", map[string]string{"ip addr": "192.0.2.10"}, false},
+	}
+
+	for _, tc := range testCases {
+		r, err := NewPacemakerResource(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := r.(*PacemakerResource)
+		p.Class = tc.class
+		p.Provider = tc.provider
+		p.AgentType = tc.agent
+		p.Params = tc.params
+		if err := p.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%s %s:%s:%s: want valid %t, got error %v", tc.name, tc.class, tc.provider, tc.agent, tc.valid, err)
+		}
+	}
+}
@@ -90,16 +90,28 @@ func (bp *BasePackage) Evaluate() (State, error) {
 	return s, nil
 }
 
+// Import sets the state of the resource to whether
+// the package is installed or not.
+func (bp *BasePackage) Import() error {
+	state, err := bp.Evaluate()
+	if err != nil {
+		return err
+	}
+	bp.State = state.Current
+
+	return nil
+}
+
 // Create installs the package
 func (bp *BasePackage) Create() error {
-	Logf("%s installing package\n", bp.ID())
+	bp.Printf("installing package\n")
 
 	bp.installArgs = append(bp.installArgs, bp.Package)
 	cmd := exec.Command(bp.manager, bp.installArgs...)
 	out, err := cmd.CombinedOutput()
 
 	for _, line := range strings.Split(string(out), "\n") {
-		Logf("%s %s\n", bp.ID(), line)
+		bp.Printf("%s\n", line)
 	}
 
 	return err
@@ -107,14 +119,14 @@ func (bp *BasePackage) Create() error {
 
 // Delete deletes the package
 func (bp *BasePackage) Delete() error {
-	Logf("%s removing package\n", bp.ID())
+	bp.Printf("removing package\n")
 
 	bp.deinstallArgs = append(bp.deinstallArgs, bp.Package)
 	cmd := exec.Command(bp.manager, bp.deinstallArgs...)
 	out, err := cmd.CombinedOutput()
 
 	for _, line := range strings.Split(string(out), "\n") {
-		Logf("%s %s\n", bp.ID(), line)
+		bp.Printf("%s\n", line)
 	}
 
 	return err
@@ -122,14 +134,14 @@ func (bp *BasePackage) Delete() error {
 
 // Update updates the package
 func (bp *BasePackage) Update() error {
-	Logf("%s updating package\n", bp.ID())
+	bp.Printf("updating package\n")
 
 	bp.updateArgs = append(bp.updateArgs, bp.Package)
 	cmd := exec.Command(bp.manager, bp.updateArgs...)
 	out, err := cmd.CombinedOutput()
 
 	for _, line := range strings.Split(string(out), "\n") {
-		Logf("%s %s\n", bp.ID(), line)
+		bp.Printf("%s\n", line)
 	}
 
 	return err
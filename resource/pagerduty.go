@@ -0,0 +1,333 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// PagerDutyNamespace is the table name in Lua where PagerDuty resources are
+// being registered to.
+const PagerDutyNamespace = "pagerduty"
+
+// pagerDutyEndpoint is the PagerDuty REST API endpoint.
+const pagerDutyEndpoint = "https://api.pagerduty.com"
+
+// ErrNoAPIKey error is returned when no API key is provided for
+// authenticating against a remote API endpoint.
+var ErrNoAPIKey = errors.New("No API key provided")
+
+// PagerDutyMaintenance type is a resource which manages maintenance
+// windows for PagerDuty services.
+//
+// The maintenance window is opened when the resource is created and is
+// closed when the resource is deleted. In order to suppress alerts while
+// changes are being made, other resources should require the maintenance
+// resource, so that the window is opened before they are processed.
+// Closing the window once changes are done can be achieved by using a
+// trigger on the last resource being changed.
+//
+// Example:
+//   maint = pagerduty.pagerduty_maintenance.new("deploying memcached")
+//   maint.service_id = "PABC123"
+//   maint.api_key = "my-api-key"
+//   maint.from = "ops@example.org"
+//   maint.duration = "30m"
+//
+//   svc = resource.service.new("memcached")
+//   svc.require = { maint:ID() }
+//   svc.subscribe[maint:ID()] = function()
+//      maint:Delete()
+//   end
+type PagerDutyMaintenance struct {
+	Base
+
+	// ServiceID is the id of the PagerDuty service for which
+	// to manage the maintenance window. Required.
+	ServiceID string `luar:"service_id"`
+
+	// APIKey is the PagerDuty REST API key. Required.
+	APIKey string `luar:"api_key" gru:"sensitive"`
+
+	// From is the email address of a valid PagerDuty user, which is
+	// required by the API when creating maintenance windows.
+	// Required.
+	From string `luar:"from"`
+
+	// Duration of the maintenance window, e.g. "30m".
+	// Defaults to "1h".
+	Duration string `luar:"duration"`
+
+	// Description of the maintenance window.
+	// Defaults to the resource name.
+	Description string `luar:"description"`
+
+	// The id of the maintenance window managed by the resource
+	windowID string `luar:"-"`
+
+	// The parsed duration of the maintenance window
+	duration time.Duration `luar:"-"`
+
+	client   *http.Client `luar:"-"`
+	endpoint string       `luar:"-"`
+}
+
+// pagerDutyWindow type represents a PagerDuty maintenance window.
+type pagerDutyWindow struct {
+	ID          string                `json:"id,omitempty"`
+	Type        string                `json:"type"`
+	StartTime   string                `json:"start_time"`
+	EndTime     string                `json:"end_time"`
+	Description string                `json:"description"`
+	Services    []pagerDutyServiceRef `json:"services"`
+}
+
+// pagerDutyServiceRef type represents a reference to a PagerDuty service.
+type pagerDutyServiceRef struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// NewPagerDutyMaintenance creates a new resource for managing
+// PagerDuty maintenance windows.
+func NewPagerDutyMaintenance(name string) (Resource, error) {
+	p := &PagerDutyMaintenance{
+		Base: Base{
+			Name:              name,
+			Type:              "pagerduty_maintenance",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		Duration:    "1h",
+		Description: name,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		endpoint:    pagerDutyEndpoint,
+	}
+
+	return p, nil
+}
+
+// Validate validates the resource.
+func (p *PagerDutyMaintenance) Validate() error {
+	if err := p.Base.Validate(); err != nil {
+		return err
+	}
+
+	if p.ServiceID == "" {
+		return errors.New("must provide service id")
+	}
+
+	if p.APIKey == "" {
+		return ErrNoAPIKey
+	}
+
+	if p.From == "" {
+		return errors.New("must provide the email address of a PagerDuty user")
+	}
+
+	d, err := time.ParseDuration(p.Duration)
+	if err != nil {
+		return err
+	}
+
+	if d <= 0 {
+		return fmt.Errorf("invalid duration '%s'", p.Duration)
+	}
+	p.duration = d
+
+	return nil
+}
+
+// Evaluate evaluates the state of the maintenance window.
+func (p *PagerDutyMaintenance) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    p.State,
+	}
+
+	window, err := p.ongoingWindow()
+	if err != nil {
+		return state, err
+	}
+
+	if window == nil {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	p.windowID = window.ID
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create opens a new maintenance window.
+func (p *PagerDutyMaintenance) Create() error {
+	p.Printf("opening maintenance window for %s\n", p.Duration)
+
+	now := time.Now().UTC()
+	window := pagerDutyWindow{
+		Type:        "maintenance_window",
+		StartTime:   now.Format(time.RFC3339),
+		EndTime:     now.Add(p.duration).Format(time.RFC3339),
+		Description: p.Description,
+		Services: []pagerDutyServiceRef{
+			{ID: p.ServiceID, Type: "service_reference"},
+		},
+	}
+
+	in := map[string]pagerDutyWindow{"maintenance_window": window}
+	var out struct {
+		MaintenanceWindow pagerDutyWindow `json:"maintenance_window"`
+	}
+
+	if err := p.request("POST", "/maintenance_windows", nil, in, &out); err != nil {
+		return err
+	}
+
+	p.windowID = out.MaintenanceWindow.ID
+	p.Printf("maintenance window id is %s\n", p.windowID)
+
+	return nil
+}
+
+// Delete closes the maintenance window.
+func (p *PagerDutyMaintenance) Delete() error {
+	// The resource can be deleted from a trigger,
+	// in which case the window may not have been evaluated yet.
+	if p.windowID == "" {
+		window, err := p.ongoingWindow()
+		if err != nil {
+			return err
+		}
+
+		if window == nil {
+			return nil
+		}
+		p.windowID = window.ID
+	}
+
+	p.Printf("closing maintenance window %s\n", p.windowID)
+
+	if err := p.request("DELETE", "/maintenance_windows/"+p.windowID, nil, nil, nil); err != nil {
+		return err
+	}
+	p.windowID = ""
+
+	return nil
+}
+
+// ongoingWindow returns the ongoing maintenance window for the
+// service matching the resource description, or nil if none is found.
+func (p *PagerDutyMaintenance) ongoingWindow() (*pagerDutyWindow, error) {
+	query := url.Values{}
+	query.Set("service_ids[]", p.ServiceID)
+	query.Set("filter", "ongoing")
+	query.Set("query", p.Description)
+
+	var out struct {
+		MaintenanceWindows []pagerDutyWindow `json:"maintenance_windows"`
+	}
+
+	if err := p.request("GET", "/maintenance_windows", query, nil, &out); err != nil {
+		return nil, err
+	}
+
+	for _, window := range out.MaintenanceWindows {
+		if window.Description == p.Description {
+			return &window, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// request sends a request to the PagerDuty REST API and decodes
+// the response into out, if provided.
+func (p *PagerDutyMaintenance) request(method, path string, query url.Values, in, out interface{}) error {
+	u := p.endpoint + path
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token token="+p.APIKey)
+	req.Header.Set("From", p.From)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, data)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func init() {
+	maintenance := ProviderItem{
+		Type:      "pagerduty_maintenance",
+		Provider:  NewPagerDutyMaintenance,
+		Namespace: PagerDutyNamespace,
+	}
+
+	RegisterProvider(maintenance)
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakePagerDuty is a minimal implementation of the
+// maintenance window endpoints of the PagerDuty REST API.
+type fakePagerDuty struct {
+	sync.Mutex
+	windows map[string]pagerDutyWindow
+	nextID  int
+	froms   []string
+}
+
+func (p *fakePagerDuty) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.Lock()
+	defer p.Unlock()
+
+	if r.Header.Get("Authorization") != "Token token=secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	p.froms = append(p.froms, r.Header.Get("From"))
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/maintenance_windows":
+		query := r.URL.Query()
+		found := make([]pagerDutyWindow, 0)
+		for _, window := range p.windows {
+			if window.Services[0].ID == query.Get("service_ids[]") && strings.Contains(window.Description, query.Get("query")) {
+				found = append(found, window)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"maintenance_windows": found})
+	case r.Method == "POST" && r.URL.Path == "/maintenance_windows":
+		var in struct {
+			MaintenanceWindow pagerDutyWindow `json:"maintenance_window"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p.nextID++
+		in.MaintenanceWindow.ID = fmt.Sprintf("PW%d", p.nextID)
+		p.windows[in.MaintenanceWindow.ID] = in.MaintenanceWindow
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(in)
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/maintenance_windows/"):
+		id := strings.TrimPrefix(r.URL.Path, "/maintenance_windows/")
+		if _, ok := p.windows[id]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(p.windows, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request", http.StatusMethodNotAllowed)
+	}
+}
+
+func TestPagerDutyMaintenance(t *testing.T) {
+	pd := &fakePagerDuty{windows: make(map[string]pagerDutyWindow)}
+	ts := httptest.NewServer(pd)
+	defer ts.Close()
+
+	L := newLuaState()
+	defer L.Close()
+
+	code := `
+	maint = pagerduty.pagerduty_maintenance.new("deploying memcached")
+	maint.service_id = "PABC123"
+	maint.api_key = "secret"
+	maint.duration = "30m"
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	p := luaResource(L, "maint").(*PagerDutyMaintenance)
+	errorIfNotEqual(t, "pagerduty_maintenance[deploying memcached]", p.ID())
+	errorIfNotEqual(t, "deploying memcached", p.Description)
+
+	if err := p.Validate(); err == nil || !strings.Contains(err.Error(), "email address") {
+		t.Errorf("want error for missing from, got %v", err)
+	}
+
+	p.From = "ops@example.org"
+	p.Duration = "-5m"
+	if err := p.Validate(); err == nil {
+		t.Error("want error for invalid duration")
+	}
+
+	p.Duration = "30m"
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	p.endpoint = ts.URL
+
+	state, err := p.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := p.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	window, ok := pd.windows["PW1"]
+	if !ok {
+		t.Fatal("want maintenance window to be opened")
+	}
+	errorIfNotEqual(t, "deploying memcached", window.Description)
+	errorIfNotEqual(t, []pagerDutyServiceRef{{ID: "PABC123", Type: "service_reference"}}, window.Services)
+
+	state, err = p.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+
+	// Windows are looked up when deleted from a trigger
+	// without being evaluated
+	p.windowID = ""
+	if err := p.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, 0, len(pd.windows))
+
+	state, err = p.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	// Deleting a closed window is a no-op
+	if err := p.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, from := range pd.froms {
+		errorIfNotEqual(t, "ops@example.org", from)
+	}
+
+	// Errors returned by the API are reported
+	p.APIKey = "invalid"
+	if _, err := p.Evaluate(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("want unauthorized error, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"sort"
+)
+
+// PluginSymbol is the name of the function, which plugins must
+// export in order to register their resource providers.
+//
+// A plugin is a Go package built with "go build -buildmode=plugin",
+// which exports a function with the following signature.
+//
+// Example:
+//   func Register() {
+//     resource.RegisterProvider(resource.ProviderItem{
+//       Type:      "widget",
+//       Provider:  NewWidget,
+//       Namespace: "acme",
+//     })
+//   }
+//
+// The function is called once, after the plugin has been loaded
+// and before any Lua modules are evaluated. Plugins must be built
+// with the same Go version and package versions as gru.
+const PluginSymbol = "Register"
+
+// LoadPlugin loads the plugin at the given path
+// and registers the providers from it.
+func LoadPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to load plugin %s: %s", path, err)
+	}
+
+	sym, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return fmt.Errorf("unable to load plugin %s: %s", path, err)
+	}
+
+	register, ok := sym.(func())
+	if !ok {
+		return fmt.Errorf("unable to load plugin %s: symbol %s is %T, want func()", path, PluginSymbol, sym)
+	}
+
+	register()
+
+	return nil
+}
+
+// LoadPlugins loads all plugins with the ".so" extension from
+// the given directory. Plugins are loaded in lexical order.
+func LoadPlugins(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := LoadPlugin(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
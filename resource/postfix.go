@@ -0,0 +1,527 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// postfixConfigDir is the default Postfix configuration directory.
+const postfixConfigDir = "/etc/postfix"
+
+// postfixParameterRegexp matches valid main.cf parameter names.
+var postfixParameterRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// postfixServiceTypes contains the valid master.cf service types.
+var postfixServiceTypes = []string{"inet", "unix", "unix-dgram", "fifo", "pass"}
+
+// PostfixMasterEntry type represents a service in master.cf.
+// Empty columns default to "-", which selects the built-in
+// default of Postfix.
+type PostfixMasterEntry struct {
+	// Service name, e.g. "smtp" or "submission".
+	Service string `luar:"service"`
+
+	// Type of the service, e.g. "inet" or "unix".
+	Type string `luar:"type"`
+
+	// Private specifies whether access to the service is restricted.
+	Private string `luar:"private"`
+
+	// Unprivileged specifies whether the service runs
+	// with the privileges of the mail_owner.
+	Unprivileged string `luar:"unprivileged"`
+
+	// Chroot specifies whether the service runs chrooted.
+	Chroot string `luar:"chroot"`
+
+	// Wakeup is the automatic wake up time of the service.
+	Wakeup string `luar:"wakeup"`
+
+	// MaxProc is the maximum number of processes of the service.
+	MaxProc string `luar:"maxproc"`
+
+	// Command and its arguments, e.g. "smtpd -o smtpd_tls_security_level=encrypt".
+	Command string `luar:"command"`
+}
+
+// key returns the service/type key of the entry used by postconf(1).
+func (e PostfixMasterEntry) key() string {
+	return e.Service + "/" + e.Type
+}
+
+// line returns the entry as a master.cf line,
+// with single spaces between the columns.
+func (e PostfixMasterEntry) line() string {
+	columns := []string{e.Service, e.Type}
+	for _, column := range []string{e.Private, e.Unprivileged, e.Chroot, e.Wakeup, e.MaxProc} {
+		if column == "" {
+			column = "-"
+		}
+		columns = append(columns, column)
+	}
+	columns = append(columns, strings.Fields(e.Command)...)
+
+	return strings.Join(columns, " ")
+}
+
+// PostfixConfig type is a resource which manages settings in the
+// Postfix main.cf and services in master.cf using postconf(1).
+//
+// Only the given settings and services are managed, any others are
+// left untouched. The configuration is checked and Postfix is
+// reloaded, if running, after it has been changed. Removing the
+// resource reverts the settings to their defaults and removes the
+// services.
+//
+// Example:
+//   mail = resource.postfix_config.new("mail")
+//   mail.state = "present"
+//   mail.settings = {
+//     myhostname = "mail.example.org",
+//     smtpd_tls_security_level = "may",
+//   }
+//   mail.master_entries = {
+//     {
+//       service = "submission",
+//       type = "inet",
+//       private = "n",
+//       chroot = "y",
+//       command = "smtpd -o smtpd_tls_security_level=encrypt",
+//     },
+//   }
+type PostfixConfig struct {
+	Base
+
+	// Settings maps main.cf parameters to their values.
+	Settings map[string]string `luar:"settings"`
+
+	// MasterEntries contains the services in master.cf.
+	MasterEntries []PostfixMasterEntry `luar:"master_entries"`
+
+	// ConfigDir is the Postfix configuration directory.
+	// Defaults to /etc/postfix.
+	ConfigDir string `luar:"config_dir"`
+}
+
+// NewPostfixConfig creates a new resource for managing
+// the Postfix main.cf and master.cf settings.
+func NewPostfixConfig(name string) (Resource, error) {
+	p := &PostfixConfig{
+		Base: Base{
+			Name:              name,
+			Type:              "postfix_config",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// postconf(1) rewrites the whole configuration files
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		Settings:      make(map[string]string),
+		MasterEntries: make([]PostfixMasterEntry, 0),
+		ConfigDir:     postfixConfigDir,
+	}
+
+	p.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "settings",
+			PropertySetFunc:      p.setSettings,
+			PropertyIsSyncedFunc: p.isSettingsSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "master_entries",
+			PropertySetFunc:      p.setMasterEntries,
+			PropertyIsSyncedFunc: p.isMasterEntriesSynced,
+		},
+	}
+
+	return p, nil
+}
+
+// Validate validates the resource.
+func (p *PostfixConfig) Validate() error {
+	if err := p.Base.Validate(); err != nil {
+		return err
+	}
+
+	if len(p.Settings) == 0 && len(p.MasterEntries) == 0 {
+		return errors.New("no settings or master entries specified")
+	}
+
+	for name, value := range p.Settings {
+		if !postfixParameterRegexp.MatchString(name) {
+			return fmt.Errorf("invalid parameter name '%s'", name)
+		}
+
+		if strings.ContainsAny(value, "\n\r") {
+			return fmt.Errorf("invalid value for parameter %s", name)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range p.MasterEntries {
+		if entry.Service == "" || strings.ContainsAny(entry.Service, " \t\n/") {
+			return fmt.Errorf("invalid service name '%s'", entry.Service)
+		}
+
+		if !utils.NewList(postfixServiceTypes...).Contains(entry.Type) {
+			return fmt.Errorf("invalid type '%s' for service %s", entry.Type, entry.Service)
+		}
+
+		if strings.TrimSpace(entry.Command) == "" || strings.ContainsAny(entry.Command, "\n\r") {
+			return fmt.Errorf("invalid command for service %s", entry.key())
+		}
+
+		if seen[entry.key()] {
+			return fmt.Errorf("duplicate master entry %s", entry.key())
+		}
+		seen[entry.key()] = true
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the Postfix configuration. It is
+// considered present, if any of the settings or services exist.
+func (p *PostfixConfig) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    p.State,
+	}
+
+	settings, err := p.currentSettings()
+	if err != nil {
+		return state, err
+	}
+
+	entries, err := p.currentMasterEntries()
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "absent"
+	for name := range p.Settings {
+		if _, ok := settings[name]; ok {
+			state.Current = "present"
+		}
+	}
+
+	for _, entry := range p.MasterEntries {
+		if _, ok := entries[entry.key()]; ok {
+			state.Current = "present"
+		}
+	}
+
+	return state, nil
+}
+
+// Create applies the settings and services.
+func (p *PostfixConfig) Create() error {
+	p.Printf("configuring postfix\n")
+
+	if err := p.postconf(p.settingArgs(p.settingNames())...); err != nil {
+		return err
+	}
+
+	for _, entry := range p.MasterEntries {
+		if err := p.postconf("-Me", entry.key()+"="+entry.line()); err != nil {
+			return err
+		}
+	}
+
+	return p.reload()
+}
+
+// Delete reverts the settings to their defaults and removes the services.
+func (p *PostfixConfig) Delete() error {
+	p.Printf("removing postfix settings\n")
+
+	if len(p.Settings) > 0 {
+		if err := p.postconf(append([]string{"-X"}, p.settingNames()...)...); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range p.MasterEntries {
+		if err := p.postconf("-MX", entry.key()); err != nil {
+			return err
+		}
+	}
+
+	return p.reload()
+}
+
+// settingNames returns the sorted names of the managed settings.
+func (p *PostfixConfig) settingNames() []string {
+	names := make([]string, 0, len(p.Settings))
+	for name := range p.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// settingArgs returns the postconf(1) arguments for
+// setting the given parameters to their managed values.
+func (p *PostfixConfig) settingArgs(names []string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+
+	args := []string{"-e"}
+	for _, name := range names {
+		args = append(args, name+"="+p.Settings[name])
+	}
+
+	return args
+}
+
+// outOfDateSettings returns the names of the settings, which are out of date.
+func (p *PostfixConfig) outOfDateSettings() ([]string, error) {
+	current, err := p.currentSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range p.settingNames() {
+		value, ok := current[name]
+		if !ok || value != normalizePostfixValue(p.Settings[name]) {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// isSettingsSynced checks whether the main.cf settings are in sync.
+func (p *PostfixConfig) isSettingsSynced() (bool, error) {
+	names, err := p.outOfDateSettings()
+	if err != nil {
+		return false, err
+	}
+
+	for _, name := range names {
+		p.Debugf("setting %s is out of date\n", name)
+	}
+
+	return len(names) == 0, nil
+}
+
+// setSettings sets the main.cf settings, which are out of date.
+func (p *PostfixConfig) setSettings() error {
+	names, err := p.outOfDateSettings()
+	if err != nil {
+		return err
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	p.Printf("setting %s\n", strings.Join(names, ", "))
+	if err := p.postconf(p.settingArgs(names)...); err != nil {
+		return err
+	}
+
+	return p.reload()
+}
+
+// outOfDateMasterEntries returns the services, which are out of date.
+func (p *PostfixConfig) outOfDateMasterEntries() ([]PostfixMasterEntry, error) {
+	current, err := p.currentMasterEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []PostfixMasterEntry
+	for _, entry := range p.MasterEntries {
+		if current[entry.key()] != entry.line() {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// isMasterEntriesSynced checks whether the master.cf services are in sync.
+func (p *PostfixConfig) isMasterEntriesSynced() (bool, error) {
+	entries, err := p.outOfDateMasterEntries()
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		p.Debugf("master entry %s is out of date\n", entry.key())
+	}
+
+	return len(entries) == 0, nil
+}
+
+// setMasterEntries sets the master.cf services, which are out of date.
+func (p *PostfixConfig) setMasterEntries() error {
+	entries, err := p.outOfDateMasterEntries()
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	for _, entry := range entries {
+		p.Printf("setting master entry %s\n", entry.key())
+		if err := p.postconf("-Me", entry.key()+"="+entry.line()); err != nil {
+			return err
+		}
+	}
+
+	return p.reload()
+}
+
+// currentSettings returns the settings in main.cf,
+// which are not at their default values.
+func (p *PostfixConfig) currentSettings() (map[string]string, error) {
+	out, err := p.postconfOutput("-n")
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		settings[strings.TrimSpace(parts[0])] = normalizePostfixValue(parts[1])
+	}
+
+	return settings, nil
+}
+
+// currentMasterEntries returns the services in master.cf
+// as lines with single spaces between the columns.
+func (p *PostfixConfig) currentMasterEntries() (map[string]string, error) {
+	out, err := p.postconfOutput("-M")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		entries[fields[0]+"/"+fields[1]] = strings.Join(fields, " ")
+	}
+
+	return entries, nil
+}
+
+// postconfOutput executes postconf(1) and returns its output.
+func (p *PostfixConfig) postconfOutput(args ...string) (string, error) {
+	spec := utils.CommandSpec{Args: append([]string{"postconf", "-c", p.ConfigDir}, args...)}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return "", fmt.Errorf("unable to execute postconf %s: %s: %s", strings.Join(args, " "), err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return string(result.Stdout), nil
+}
+
+// postconf executes postconf(1) to change the configuration. Unknown
+// parameters are only reported as warnings by postconf(1), so any
+// warnings about them are treated as errors.
+func (p *PostfixConfig) postconf(args ...string) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	spec := utils.CommandSpec{Args: append([]string{"postconf", "-c", p.ConfigDir}, args...)}
+	result, err := utils.RunCommand(context.Background(), spec)
+	stderr := strings.TrimSpace(string(result.Stderr))
+	if err != nil {
+		return fmt.Errorf("unable to execute postconf %s: %s: %s", args[0], err, stderr)
+	}
+
+	for _, line := range strings.Split(stderr, "\n") {
+		if strings.Contains(line, "unused parameter") {
+			return fmt.Errorf("postconf %s failed: %s", args[0], line)
+		}
+	}
+
+	return nil
+}
+
+// reload checks the configuration and reloads Postfix, if running.
+func (p *PostfixConfig) reload() error {
+	spec := utils.CommandSpec{Args: []string{"postfix", "-c", p.ConfigDir, "check"}}
+	if result, err := utils.RunCommand(context.Background(), spec); err != nil {
+		return fmt.Errorf("postfix configuration check failed: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	spec = utils.CommandSpec{Args: []string{"postfix", "-c", p.ConfigDir, "status"}}
+	if _, err := utils.RunCommand(context.Background(), spec); err != nil {
+		p.Printf("postfix is not running, skipping reload\n")
+		return nil
+	}
+
+	p.Printf("reloading postfix\n")
+
+	spec = utils.CommandSpec{Args: []string{"postfix", "-c", p.ConfigDir, "reload"}}
+	if result, err := utils.RunCommand(context.Background(), spec); err != nil {
+		return fmt.Errorf("unable to reload postfix: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+// normalizePostfixValue normalizes the whitespace of a
+// parameter value, so that values can be compared.
+func normalizePostfixValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "postfix_config",
+		Provider:  NewPostfixConfig,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
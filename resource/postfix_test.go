@@ -0,0 +1,225 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// fakePostconf emulates postconf(1) and postfix(1).
+type fakePostconf struct {
+	settings map[string]string
+	entries  map[string]string
+	running  bool
+	commands []string
+}
+
+func (f *fakePostconf) run(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+	cmd := strings.Join(spec.Args, " ")
+	f.commands = append(f.commands, cmd)
+
+	var stdout, stderr bytes.Buffer
+	args := spec.Args[3:]
+	switch {
+	case spec.Args[0] == "postfix" && args[0] == "status" && !f.running:
+		return utils.CommandResult{ExitCode: 1}, errors.New("exit status 1")
+	case spec.Args[0] == "postfix":
+	case args[0] == "-n":
+		names := make([]string, 0)
+		for name := range f.settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&stdout, "%s = %s\n", name, f.settings[name])
+		}
+	case args[0] == "-M":
+		for _, line := range f.entries {
+			fmt.Fprintf(&stdout, "%s\n", line)
+		}
+	case args[0] == "-e":
+		for _, arg := range args[1:] {
+			parts := strings.SplitN(arg, "=", 2)
+			if strings.HasPrefix(parts[0], "bogus") {
+				fmt.Fprintf(&stderr, "postconf: warning: /etc/postfix/main.cf: unused parameter: %s\n", arg)
+			}
+			f.settings[parts[0]] = parts[1]
+		}
+	case args[0] == "-X":
+		for _, name := range args[1:] {
+			delete(f.settings, name)
+		}
+	case args[0] == "-Me":
+		parts := strings.SplitN(args[1], "=", 2)
+		f.entries[parts[0]] = strings.Replace(parts[1], " ", "  ", -1)
+	case args[0] == "-MX":
+		delete(f.entries, args[1])
+	}
+
+	return utils.CommandResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}, nil
+}
+
+func TestPostfixConfig(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	fake := &fakePostconf{
+		settings: map[string]string{"compatibility_level": "2"},
+		entries:  map[string]string{"smtp/inet": "smtp      inet  n       -       y       -       -       smtpd"},
+		running:  true,
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(fake.run)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	r, err := NewPostfixConfig("mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := r.(*PostfixConfig)
+	p.Settings = map[string]string{
+		"myhostname":               "mail.example.org",
+		"smtpd_tls_security_level": "may",
+	}
+	p.MasterEntries = []PostfixMasterEntry{
+		{
+			Service: "submission",
+			Type:    "inet",
+			Private: "n",
+			Chroot:  "y",
+			Command: "smtpd -o smtpd_tls_security_level=encrypt",
+		},
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := p.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	fake.commands = nil
+	if err := p.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"postconf -c /etc/postfix -e myhostname=mail.example.org smtpd_tls_security_level=may",
+		"postconf -c /etc/postfix -Me submission/inet=submission inet n - y - - smtpd -o smtpd_tls_security_level=encrypt",
+		"postfix -c /etc/postfix check",
+		"postfix -c /etc/postfix status",
+		"postfix -c /etc/postfix reload",
+	}
+	errorIfNotEqual(t, want, fake.commands)
+
+	for _, prop := range p.Properties() {
+		synced, err := prop.IsSynced()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !synced {
+			t.Errorf("want property %s to be synced", prop.Name())
+		}
+	}
+
+	// Only the settings which are out of date are changed,
+	// and postfix is not reloaded if it is not running
+	fake.settings["smtpd_tls_security_level"] = "none"
+	fake.running = false
+	fake.commands = nil
+
+	synced, err := p.isSettingsSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := p.setSettings(); err != nil {
+		t.Fatal(err)
+	}
+
+	want = []string{
+		"postconf -c /etc/postfix -n",
+		"postconf -c /etc/postfix -n",
+		"postconf -c /etc/postfix -e smtpd_tls_security_level=may",
+		"postfix -c /etc/postfix check",
+		"postfix -c /etc/postfix status",
+	}
+	errorIfNotEqual(t, want, fake.commands)
+
+	// Unknown parameters are reported as errors
+	p.Settings["bogus_parameter"] = "yes"
+	if err := p.setSettings(); err == nil || !strings.Contains(err.Error(), "unused parameter") {
+		t.Errorf("want unused parameter error, got %v", err)
+	}
+	delete(p.Settings, "bogus_parameter")
+
+	if err := p.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = p.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+	errorIfNotEqual(t, map[string]string{"compatibility_level": "2", "bogus_parameter": "yes"}, fake.settings)
+
+	// Invalid settings and entries are rejected
+	invalid := []func(p *PostfixConfig){
+		func(p *PostfixConfig) { p.Settings = map[string]string{"my-host=name": "x"} },
+		func(p *PostfixConfig) { p.Settings = map[string]string{"myhostname": "a\nb"} },
+		func(p *PostfixConfig) { p.MasterEntries[0].Type = "tcp" },
+		func(p *PostfixConfig) { p.MasterEntries[0].Command = "" },
+		func(p *PostfixConfig) { p.MasterEntries = append(p.MasterEntries, p.MasterEntries[0]) },
+		func(p *PostfixConfig) { p.Settings = nil; p.MasterEntries = nil },
+	}
+
+	for i, f := range invalid {
+		r, _ := NewPostfixConfig("mail")
+		p := r.(*PostfixConfig)
+		p.MasterEntries = []PostfixMasterEntry{{Service: "smtp", Type: "inet", Command: "smtpd"}}
+		f(p)
+		if err := p.Validate(); err == nil {
+			t.Errorf("case %d: want validation error", i)
+		}
+	}
+}
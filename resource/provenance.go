@@ -0,0 +1,158 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Markers used to delimit the provenance block in managed files
+const (
+	provenanceBegin = "BEGIN gru provenance"
+	provenanceEnd   = "END gru provenance"
+)
+
+// commentStyle type represents the way comments are
+// written in a file.
+type commentStyle struct {
+	prefix string
+	suffix string
+}
+
+// commentStyles contains the supported comment styles for
+// provenance blocks, keyed by their opening sequence.
+var commentStyles = map[string]commentStyle{
+	"#":    {prefix: "# "},
+	"//":   {prefix: "// "},
+	";":    {prefix: "; "},
+	"--":   {prefix: "-- "},
+	"<!--": {prefix: "<!-- ", suffix: " -->"},
+}
+
+// commentStyleByExt maps file extensions to the comment style
+// used by them. Files with unknown extensions use "#" comments.
+var commentStyleByExt = map[string]string{
+	".c":    "//",
+	".h":    "//",
+	".cpp":  "//",
+	".go":   "//",
+	".js":   "//",
+	".java": "//",
+	".ini":  ";",
+	".lua":  "--",
+	".sql":  "--",
+	".xml":  "<!--",
+	".html": "<!--",
+}
+
+// provenanceCommentStyle returns the comment style to
+// use for the provenance block of the given file.
+func provenanceCommentStyle(path, style string) string {
+	if style != "" {
+		return style
+	}
+
+	if s, ok := commentStyleByExt[strings.ToLower(filepath.Ext(path))]; ok {
+		return s
+	}
+
+	return "#"
+}
+
+// provenanceBlock returns a comment block describing the run
+// and source which produced a file.
+func provenanceBlock(style, runID, source string, t time.Time) []byte {
+	cs := commentStyles[style]
+	lines := []string{
+		provenanceBegin,
+		fmt.Sprintf("run: %s", runID),
+		fmt.Sprintf("time: %s", t.UTC().Format(time.RFC3339)),
+		fmt.Sprintf("source: %s", source),
+		provenanceEnd,
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(cs.prefix + line + cs.suffix + "\n")
+	}
+
+	return buf.Bytes()
+}
+
+// injectProvenance inserts the provenance block in content.
+// The block is placed at the top of the content, unless the
+// first line is an interpreter or XML declaration, in which
+// case it is placed right after it.
+func injectProvenance(content, block []byte) []byte {
+	var head []byte
+	if bytes.HasPrefix(content, []byte("#!")) || bytes.HasPrefix(content, []byte("<?xml")) {
+		i := bytes.IndexByte(content, '\n')
+		if i == -1 {
+			content = append(content, '\n')
+			i = len(content) - 1
+		}
+		head, content = content[:i+1], content[i+1:]
+	}
+
+	result := make([]byte, 0, len(head)+len(block)+len(content))
+	result = append(result, head...)
+	result = append(result, block...)
+	result = append(result, content...)
+
+	return result
+}
+
+// stripProvenance removes the provenance block from content,
+// so that it can be compared against the desired content.
+func stripProvenance(content []byte) []byte {
+	begin := bytes.Index(content, []byte(provenanceBegin))
+	if begin == -1 {
+		return content
+	}
+
+	end := bytes.Index(content[begin:], []byte(provenanceEnd))
+	if end == -1 {
+		return content
+	}
+	end += begin
+
+	// Remove the full lines containing the markers
+	start := bytes.LastIndexByte(content[:begin], '\n') + 1
+	stop := len(content)
+	if i := bytes.IndexByte(content[end:], '\n'); i != -1 {
+		stop = end + i + 1
+	}
+
+	result := make([]byte, 0, len(content)-(stop-start))
+	result = append(result, content[:start]...)
+	result = append(result, content[stop:]...)
+
+	return result
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProvenance(t *testing.T) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		style   string
+		content string
+		want    string
+	}{
+		{
+			"#",
+			"foo\n",
+			"# BEGIN gru provenance\n# run: id\n# time: 2017-01-02T03:04:05Z\n# source: src\n# END gru provenance\nfoo\n",
+		},
+		{
+			"#",
+			"#!/bin/sh\necho foo\n",
+			"#!/bin/sh\n# BEGIN gru provenance\n# run: id\n# time: 2017-01-02T03:04:05Z\n# source: src\n# END gru provenance\necho foo\n",
+		},
+		{
+			"<!--",
+			"<?xml version=\"1.0\"?>\n<foo/>\n",
+			"<?xml version=\"1.0\"?>\n<!-- BEGIN gru provenance -->\n<!-- run: id -->\n<!-- time: 2017-01-02T03:04:05Z -->\n<!-- source: src -->\n<!-- END gru provenance -->\n<foo/>\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		block := provenanceBlock(tc.style, "id", "src", now)
+		got := injectProvenance([]byte(tc.content), block)
+		errorIfNotEqual(t, tc.want, string(got))
+		errorIfNotEqual(t, tc.content, string(stripProvenance(got)))
+	}
+
+	errorIfNotEqual(t, "//", provenanceCommentStyle("/tmp/foo.go", ""))
+	errorIfNotEqual(t, "#", provenanceCommentStyle("/tmp/foo.conf", ""))
+	errorIfNotEqual(t, ";", provenanceCommentStyle("/tmp/foo.conf", ";"))
+}
+
+func TestProvenanceContentSynced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-provenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewFile(filepath.Join(dir, "foo.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := r.(*File)
+	f.Content = []byte("foo = bar\n")
+	f.Provenance = true
+	if err := f.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new provenance block should not cause the file to drift
+	synced, err := f.isContentSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	f.Content = []byte("foo = baz\n")
+	synced, err = f.isContentSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+}
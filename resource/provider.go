@@ -43,6 +43,11 @@ type ProviderItem struct {
 	// Namespace represents the Lua table that the
 	// provider will be registered in
 	Namespace string
+
+	// Description is a one-line description of the resource type.
+	// Defaults to the first sentence of the documentation of
+	// built-in resource types.
+	Description string
 }
 
 // RegisterProvider registers a provider to the registry.
@@ -0,0 +1,424 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// Defaults used by the Redis Sentinel resource
+const (
+	redisSentinelConfigFile = "/etc/redis/sentinel.conf"
+	redisSentinelPort       = "26379"
+)
+
+// redisSentinelDirectives contains the per-master directives
+// managed by the Redis Sentinel resource.
+var redisSentinelDirectives = []string{"monitor", "down-after-milliseconds", "failover-timeout"}
+
+// RedisSentinel type is a resource which manages the masters
+// monitored by Redis Sentinel.
+//
+// Only the directives of the monitored master are managed. Any other
+// directives in the configuration file, including the ones rewritten
+// by Sentinel itself, e.g. known replicas and sentinels, are preserved.
+// Sentinel is reset for the master after the configuration has been
+// changed.
+//
+// Example:
+//   cache = resource.redis_sentinel.new("cache")
+//   cache.state = "present"
+//   cache.master_ip = "10.0.0.10"
+//   cache.master_port = 6379
+//   cache.quorum = 2
+//   cache.sentinels = 3
+//   cache.down_after_milliseconds = 5000
+type RedisSentinel struct {
+	Base
+
+	// MasterName is the name of the monitored master.
+	// Defaults to the resource name.
+	MasterName string `luar:"master_name"`
+
+	// MasterIP is the address of the master.
+	MasterIP string `luar:"master_ip"`
+
+	// MasterPort is the port of the master. Defaults to 6379.
+	MasterPort int `luar:"master_port"`
+
+	// Quorum is the number of sentinels which need to agree that
+	// the master is down, before failing over. Defaults to 2.
+	Quorum int `luar:"quorum"`
+
+	// Sentinels is the number of sentinels monitoring the master,
+	// which the quorum cannot exceed. Defaults to the number of
+	// sentinels known to the local sentinel, including itself.
+	Sentinels int `luar:"sentinels"`
+
+	// DownAfterMilliseconds is the time after which an unreachable
+	// master is considered to be down. Defaults to 30000.
+	DownAfterMilliseconds int `luar:"down_after_milliseconds"`
+
+	// FailoverTimeout is the failover timeout in milliseconds.
+	// Defaults to 180000.
+	FailoverTimeout int `luar:"failover_timeout"`
+
+	// ConfigFile is the path to the Sentinel configuration file.
+	// Defaults to /etc/redis/sentinel.conf.
+	ConfigFile string `luar:"config_file"`
+}
+
+// NewRedisSentinel creates a new resource for managing
+// the masters monitored by Redis Sentinel.
+func NewRedisSentinel(name string) (Resource, error) {
+	r := &RedisSentinel{
+		Base: Base{
+			Name:              name,
+			Type:              "redis_sentinel",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// All masters are kept in the same file
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		MasterName:            name,
+		MasterPort:            6379,
+		Quorum:                2,
+		DownAfterMilliseconds: 30000,
+		FailoverTimeout:       180000,
+		ConfigFile:            redisSentinelConfigFile,
+	}
+
+	r.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "config",
+			PropertySetFunc:      r.setConfig,
+			PropertyIsSyncedFunc: r.isConfigSynced,
+		},
+	}
+
+	return r, nil
+}
+
+// Validate validates the resource.
+func (r *RedisSentinel) Validate() error {
+	if err := r.Base.Validate(); err != nil {
+		return err
+	}
+
+	if r.MasterName == "" || strings.ContainsAny(r.MasterName, " \t\n\"") {
+		return fmt.Errorf("invalid master name '%s'", r.MasterName)
+	}
+
+	if r.State == "absent" {
+		return nil
+	}
+
+	if r.MasterIP == "" || strings.ContainsAny(r.MasterIP, " \t\n\"") {
+		return fmt.Errorf("invalid master address '%s'", r.MasterIP)
+	}
+
+	if r.MasterPort < 1 || r.MasterPort > 65535 {
+		return fmt.Errorf("invalid master port %d", r.MasterPort)
+	}
+
+	if r.DownAfterMilliseconds < 1 {
+		return fmt.Errorf("invalid down_after_milliseconds %d", r.DownAfterMilliseconds)
+	}
+
+	if r.FailoverTimeout < 1 {
+		return fmt.Errorf("invalid failover_timeout %d", r.FailoverTimeout)
+	}
+
+	sentinels, err := r.sentinelCount()
+	if err != nil {
+		return err
+	}
+
+	// A quorum which can never be reached prevents failovers
+	if r.Quorum < 1 || r.Quorum > sentinels {
+		return fmt.Errorf("invalid quorum %d, must be between 1 and the number of sentinels (%d)", r.Quorum, sentinels)
+	}
+
+	return nil
+}
+
+// sentinelCount returns the number of sentinels monitoring the master.
+func (r *RedisSentinel) sentinelCount() (int, error) {
+	if r.Sentinels > 0 {
+		return r.Sentinels, nil
+	}
+
+	lines, err := r.readConfig()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 1
+	for _, line := range lines {
+		if directive, master, _ := parseRedisSentinelLine(line); directive == "known-sentinel" && master == r.MasterName {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Evaluate evaluates the state of the monitored master.
+func (r *RedisSentinel) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    r.State,
+	}
+
+	lines, err := r.readConfig()
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "absent"
+	if _, ok := r.current(lines)["monitor"]; ok {
+		state.Current = "present"
+	}
+
+	return state, nil
+}
+
+// Create adds the master to the configuration file.
+func (r *RedisSentinel) Create() error {
+	r.Printf("adding master %s to %s\n", r.MasterName, r.ConfigFile)
+
+	return r.setConfig()
+}
+
+// Delete removes the master from the configuration file.
+func (r *RedisSentinel) Delete() error {
+	r.Printf("removing master %s from %s\n", r.MasterName, r.ConfigFile)
+
+	lines, err := r.readConfig()
+	if err != nil {
+		return err
+	}
+
+	// Remove all directives of the master, including
+	// the ones rewritten by Sentinel itself
+	var kept []string
+	for _, line := range lines {
+		if _, master, _ := parseRedisSentinelLine(line); master != r.MasterName {
+			kept = append(kept, line)
+		}
+	}
+
+	if err := r.writeConfig(kept); err != nil {
+		return err
+	}
+
+	return r.sentinelCommand("REMOVE")
+}
+
+// directives returns the managed directives of the master.
+func (r *RedisSentinel) directives() map[string]string {
+	return map[string]string{
+		"monitor":                 fmt.Sprintf("%s %d %d", r.MasterIP, r.MasterPort, r.Quorum),
+		"down-after-milliseconds": strconv.Itoa(r.DownAfterMilliseconds),
+		"failover-timeout":        strconv.Itoa(r.FailoverTimeout),
+	}
+}
+
+// current returns the managed directives of
+// the master found in the configuration file.
+func (r *RedisSentinel) current(lines []string) map[string]string {
+	current := make(map[string]string)
+	for _, line := range lines {
+		directive, master, args := parseRedisSentinelLine(line)
+		if master == r.MasterName {
+			current[directive] = args
+		}
+	}
+
+	return current
+}
+
+// isConfigSynced checks whether the managed directives are in sync.
+func (r *RedisSentinel) isConfigSynced() (bool, error) {
+	lines, err := r.readConfig()
+	if err != nil {
+		return false, err
+	}
+
+	current := r.current(lines)
+	if _, ok := current["monitor"]; !ok {
+		return false, ErrResourceAbsent
+	}
+
+	for directive, want := range r.directives() {
+		if current[directive] != want {
+			r.Debugf("directive %s is out of date\n", directive)
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// setConfig writes the managed directives of the master in place
+// of the existing ones, or at the end of the configuration file.
+func (r *RedisSentinel) setConfig() error {
+	lines, err := r.readConfig()
+	if err != nil {
+		return err
+	}
+
+	// Sentinel requires the monitor directive to
+	// precede any other directives of the master
+	directives := r.directives()
+	var block []string
+	for _, directive := range redisSentinelDirectives {
+		block = append(block, fmt.Sprintf("sentinel %s %s %s", directive, r.MasterName, directives[directive]))
+	}
+
+	var result []string
+	inserted := false
+	for _, line := range lines {
+		directive, master, _ := parseRedisSentinelLine(line)
+		if master != r.MasterName || !utils.NewList(redisSentinelDirectives...).Contains(directive) {
+			result = append(result, line)
+			continue
+		}
+
+		if directive == "monitor" && !inserted {
+			result = append(result, block...)
+			inserted = true
+		}
+	}
+
+	if !inserted {
+		result = append(result, block...)
+	}
+
+	if err := r.writeConfig(result); err != nil {
+		return err
+	}
+
+	return r.sentinelCommand("RESET")
+}
+
+// readConfig returns the lines of the configuration file.
+// A missing file is treated as being empty.
+func (r *RedisSentinel) readConfig() ([]string, error) {
+	data, err := ioutil.ReadFile(r.ConfigFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	content := strings.TrimSuffix(string(data), "\n")
+	if content == "" {
+		return nil, nil
+	}
+
+	return strings.Split(content, "\n"), nil
+}
+
+// writeConfig writes the lines of the configuration file.
+func (r *RedisSentinel) writeConfig(lines []string) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.ConfigFile), 0755); err != nil {
+		return err
+	}
+
+	// Sentinel rewrites its configuration file,
+	// so it should not be readable by others
+	return writeFile(r.ConfigFile, buf.Bytes(), 0640)
+}
+
+// sentinelCommand executes a SENTINEL command for
+// the master, if Sentinel is running.
+func (r *RedisSentinel) sentinelCommand(command string) error {
+	spec := utils.CommandSpec{Args: []string{"redis-cli", "-p", redisSentinelPort, "PING"}}
+	if _, err := utils.RunCommand(context.Background(), spec); err != nil {
+		r.Printf("sentinel is not running, skipping %s\n", strings.ToLower(command))
+		return nil
+	}
+
+	r.Printf("executing SENTINEL %s %s\n", command, r.MasterName)
+
+	spec = utils.CommandSpec{Args: []string{"redis-cli", "-p", redisSentinelPort, "SENTINEL", command, r.MasterName}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("unable to execute SENTINEL %s: %s: %s", command, err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	// redis-cli exits successfully on command errors
+	if out := strings.TrimSpace(string(result.Stdout)); strings.Contains(out, "ERR") {
+		return errors.New(out)
+	}
+
+	return nil
+}
+
+// parseRedisSentinelLine parses a per-master directive, e.g.
+// "sentinel monitor mymaster 127.0.0.1 6379 2", returning the
+// directive, the master name and the remaining arguments.
+// Empty strings are returned for any other lines.
+func parseRedisSentinelLine(line string) (string, string, string) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || strings.ToLower(fields[0]) != "sentinel" {
+		return "", "", ""
+	}
+
+	return strings.ToLower(fields[1]), fields[2], strings.Join(fields[3:], " ")
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "redis_sentinel",
+		Provider:  NewRedisSentinel,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
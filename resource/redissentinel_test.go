@@ -0,0 +1,164 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestRedisSentinel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-redis-sentinel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		return utils.CommandResult{Stdout: []byte("OK\n")}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	const config = `port 26379
+sentinel myid 0123456789abcdef
+sentinel monitor other 10.0.0.20 6379 1
+sentinel known-sentinel cache 10.0.0.11 26379 abc
+sentinel known-sentinel cache 10.0.0.12 26379 def
+`
+	path := filepath.Join(dir, "sentinel.conf")
+	if err := ioutil.WriteFile(path, []byte(config), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRedisSentinel("cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := r.(*RedisSentinel)
+	s.ConfigFile = path
+	s.MasterIP = "10.0.0.10"
+	s.Quorum = 2
+	s.DownAfterMilliseconds = 5000
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two known sentinels and the local one
+	s.Quorum = 4
+	if err := s.Validate(); err == nil || !strings.Contains(err.Error(), "invalid quorum") {
+		t.Errorf("want quorum error, got %v", err)
+	}
+
+	s.Sentinels = 5
+	if err := s.Validate(); err != nil {
+		t.Errorf("want quorum within declared sentinels to be valid, got %v", err)
+	}
+	s.Sentinels = 0
+	s.Quorum = 2
+
+	state, err := s.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := s.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	block := `sentinel monitor cache 10.0.0.10 6379 2
+sentinel down-after-milliseconds cache 5000
+sentinel failover-timeout cache 180000
+`
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, config+block, string(content))
+	errorIfNotEqual(t, []string{"redis-cli -p 26379 PING", "redis-cli -p 26379 SENTINEL RESET cache"}, commands)
+
+	synced, err := s.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	// Directives are updated in place, before any
+	// directives rewritten by Sentinel for the master
+	rewritten := strings.Replace(string(content), "sentinel failover-timeout cache 180000\n", "sentinel known-replica cache 10.0.0.13 6379\n", 1)
+	rewritten = strings.Replace(rewritten, "sentinel monitor cache", "sentinel monitor  cache", 1)
+	if err := ioutil.WriteFile(path, []byte(rewritten), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	synced, err = s.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := s.setConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, config+block+"sentinel known-replica cache 10.0.0.13 6379\n", string(content))
+
+	// All directives of the master are removed
+	commands = nil
+	if err := s.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "port 26379\nsentinel myid 0123456789abcdef\nsentinel monitor other 10.0.0.20 6379 1\n", string(content))
+	errorIfNotEqual(t, []string{"redis-cli -p 26379 PING", "redis-cli -p 26379 SENTINEL REMOVE cache"}, commands)
+}
@@ -28,6 +28,7 @@ package resource
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 
@@ -68,6 +69,11 @@ type State struct {
 
 	// Wanted state of the resource
 	Want string
+
+	// RebootRequired specifies whether a reboot is required to
+	// activate changes already made by the resource, e.g. a
+	// pending OSTree deployment
+	RebootRequired bool
 }
 
 // Resource is the interface type for resources.
@@ -116,6 +122,11 @@ type Resource interface {
 	// Properties returns the list of properties for the resource.
 	Properties() []Property
 
+	// ShouldRecreateOnChange returns a boolean, which indicates
+	// whether the resource should be deleted and created again,
+	// instead of having its out of date properties updated.
+	ShouldRecreateOnChange() bool
+
 	// SubscribedTo returns a map of the resource ids for which the
 	// current resource subscribes for changes to. The keys of the
 	// map are resource ids and their values are the functions to be
@@ -130,11 +141,209 @@ type Config struct {
 
 	// Logger used by the resources to log events
 	Logger *log.Logger
+
+	// SkipOwnershipWhenUnprivileged specifies whether file ownership
+	// mismatches should be reported as warnings instead of failures,
+	// when not running with sufficient privileges to change ownership.
+	SkipOwnershipWhenUnprivileged bool
+
+	// RunID is the unique id of the current run
+	RunID string
+
+	// Module is the Lua module being processed in the current run
+	Module string
+
+	// UserCache caches user and group lookups during the current run
+	UserCache *utils.UserCache
+
+	// FileCache caches file checksums during the current run
+	FileCache *utils.FileCache
+
+	// FileSystem is used by resources managing files, so that they
+	// can be tested against a fake file system, e.g. a
+	// utils.MemFileSystem. If nil, the file system of the operating
+	// system is used.
+	FileSystem utils.FileSystem
+
+	// SourceCache caches remote sources, which have been fetched
+	// ahead of time. If nil, remote sources are fetched directly.
+	SourceCache *utils.SourceCache
+
+	// BytesWritten counts the bytes written to files by
+	// resources during the current run
+	BytesWritten *utils.ByteCounter
+
+	// Concurrency is the number of goroutines resources may use
+	// for operations on many files, e.g. recursive ownership changes
+	Concurrency int
+
+	// HashInFlightBytes limits the total size of files being hashed
+	// concurrently by resources. Defaults to utils.DefaultHashInFlightBytes.
+	HashInFlightBytes int64
+
+	// Verbosity is the level of events logged for resources,
+	// which do not override it. Defaults to VerbosityNormal.
+	Verbosity Verbosity
+
+	// Secrets keeps track of the secrets used by resources
+	// during the current run, so that they can be redacted
+	Secrets *Secrets
+}
+
+// Verbosity type represents the level of events logged for resources.
+type Verbosity int
+
+// Verbosity levels
+const (
+	// VerbosityQuiet logs no events, except for errors
+	VerbosityQuiet Verbosity = iota - 1
+
+	// VerbosityNormal logs the changes made to resources
+	VerbosityNormal
+
+	// VerbosityDebug additionally logs details about
+	// why resources are considered out of date
+	VerbosityDebug
+)
+
+// ParseVerbosity parses a verbosity level, which is
+// either "quiet", "normal" or "debug".
+func ParseVerbosity(s string) (Verbosity, error) {
+	switch s {
+	case "quiet":
+		return VerbosityQuiet, nil
+	case "normal":
+		return VerbosityNormal, nil
+	case "debug":
+		return VerbosityDebug, nil
+	}
+
+	return VerbosityNormal, fmt.Errorf("Invalid verbosity '%s'", s)
+}
+
+// EventLogger is the interface type for resources, which log their
+// events according to their own verbosity. It is implemented by Base.
+type EventLogger interface {
+	// Printf logs an event for the resource, prefixed with its id,
+	// unless the resource verbosity is quiet.
+	Printf(format string, a ...interface{})
+
+	// Debugf logs a debug event for the resource, prefixed with
+	// its id, if the resource verbosity is debug.
+	Debugf(format string, a ...interface{})
+}
+
+// Differ is the interface type for resources, which can show the
+// changes to be made to them as a diff. Implementing it is optional.
+type Differ interface {
+	// Diff writes the difference between the current and the wanted
+	// content of the resource to w and returns a boolean indicating
+	// whether they differ.
+	Diff(w io.Writer) (bool, error)
+}
+
+// WriteSizer is the interface type for resources, which write content
+// to files and can tell how much they would write when brought up to
+// date, e.g. in dry-run mode. Implementing it is optional.
+type WriteSizer interface {
+	// PendingBytes returns the number of bytes, which would be
+	// written to bring the resource up to date
+	PendingBytes() (int64, error)
+}
+
+// Importer is the interface type for resources, which can be
+// populated from the current state of the system, e.g. when
+// onboarding a host configured by hand. Implementing it is optional.
+type Importer interface {
+	// Import sets the attributes of the resource, including its
+	// state, to the ones of the system, so that the resource is
+	// in sync when being processed afterwards.
+	Import() error
+}
+
+// Rescuer is the interface type for resources, which declare an
+// action run when processing them fails. It is implemented by Base.
+type Rescuer interface {
+	// RescueAction returns either the id of another resource
+	// or a command, or an empty string if there is none.
+	RescueAction() string
+}
+
+// RefreshOnly is the interface type for resources, which may be
+// processed only when any of the resources they subscribe to have
+// changed. Implementing it is optional.
+type RefreshOnly interface {
+	// IsRefreshOnly returns a boolean indicating whether the
+	// resource is processed only when notified by a change
+	IsRefreshOnly() bool
+}
+
+// FieldRecorder is the interface type for resources, which keep track
+// of the fields assigned to them in Lua, e.g. to tell fields declared
+// with their default value apart from fields, which were not declared.
+// Implementing it is optional.
+type FieldRecorder interface {
+	// RecordField records that the field with the given Lua name was assigned
+	RecordField(name string)
+}
+
+// StateDeclarer is the interface type for resources, which declare
+// their desired state, so that it is known before evaluating them.
+// It is implemented by Base.
+type StateDeclarer interface {
+	// DesiredState returns the state declared for the resource
+	DesiredState() string
+}
+
+// RemoteSource type represents remote content used by a resource.
+type RemoteSource struct {
+	// URL of the content
+	URL string
+
+	// Checksum of the content in the form of "algorithm:digest".
+	// Empty if the content is not verified.
+	Checksum string
+}
+
+// SourceFetcher is the interface type for resources using remote
+// content, which can be fetched ahead of time into the source
+// cache. Implementing it is optional.
+type SourceFetcher interface {
+	// RemoteSources returns the remote content used by the resource
+	RemoteSources() []RemoteSource
 }
 
 // DefaultConfig is the default configuration used by the resources
 var DefaultConfig = &Config{
-	Logger: log.New(os.Stdout, "", log.LstdFlags),
+	Logger:       log.New(os.Stdout, "", log.LstdFlags),
+	UserCache:    utils.NewUserCache(),
+	FileCache:    utils.NewFileCache(),
+	BytesWritten: utils.NewByteCounter(),
+	Secrets:      NewSecrets(DefaultSecretBackends()),
+}
+
+// InvalidatePath removes any cached data about path, and about the
+// files below it if path is a directory, from the caches of the
+// current run. Resources which modify files managed by other
+// resources, e.g. by executing commands, should invalidate them,
+// so that dependent resources see the changes.
+func (c *Config) InvalidatePath(path string) {
+	c.FileCache.InvalidatePath(path)
+}
+
+// fileSystem returns the file system used by resources.
+func (c *Config) fileSystem() utils.FileSystem {
+	if c.FileSystem == nil {
+		return utils.DefaultFileSystem
+	}
+
+	return c.FileSystem
+}
+
+// InvalidateCache removes all cached data about
+// files from the caches of the current run.
+func (c *Config) InvalidateCache() {
+	c.FileCache.Invalidate()
 }
 
 // Logf writes an event to the default logger.
@@ -142,6 +351,34 @@ func Logf(format string, a ...interface{}) {
 	DefaultConfig.Logger.Printf(format, a...)
 }
 
+// Printf logs an event for a resource, prefixed with its id. Resources,
+// which do not implement EventLogger, are logged unless the global
+// verbosity is quiet.
+func Printf(r Resource, format string, a ...interface{}) {
+	if l, ok := r.(EventLogger); ok {
+		l.Printf(format, a...)
+		return
+	}
+
+	if DefaultConfig.Verbosity >= VerbosityNormal {
+		Logf(r.ID()+" "+format, a...)
+	}
+}
+
+// Debugf logs a debug event for a resource, prefixed with its id.
+// Resources, which do not implement EventLogger, are logged if the
+// global verbosity is debug.
+func Debugf(r Resource, format string, a ...interface{}) {
+	if l, ok := r.(EventLogger); ok {
+		l.Debugf(format, a...)
+		return
+	}
+
+	if DefaultConfig.Verbosity >= VerbosityDebug {
+		Logf(r.ID()+" "+format, a...)
+	}
+}
+
 // Base is the base resource type for all resources
 // The purpose of this type is to be embedded into other resources
 // Partially implements the Resource interface
@@ -155,7 +392,9 @@ type Base struct {
 	// Desired state of the resource
 	State string `luar:"state"`
 
-	// Require contains the resource dependencies
+	// Require contains the resource dependencies.
+	// Dependencies in the form of "type[*]" match
+	// all resources of the given type.
 	Require []string `luar:"require"`
 
 	// PresentStatesList contains the list of states, for which the
@@ -182,6 +421,22 @@ type Base struct {
 	// current resource to the one that is being monitored, so that the
 	// monitored resource is evaluated and processed first.
 	Subscribe map[string]*lua.LFunction `luar:"subscribe"`
+
+	// RecreateOnChange specifies whether the resource should be
+	// deleted and created again when any of its properties are out
+	// of date, instead of updating the properties in place.
+	RecreateOnChange bool `luar:"recreate_on_change"`
+
+	// Verbosity overrides the level of events logged for the
+	// resource, either "quiet", "normal" or "debug".
+	// Defaults to the global verbosity.
+	Verbosity string `luar:"verbosity"`
+
+	// Rescue is an action run when processing the resource fails,
+	// e.g. for collecting logs. It is either the id of another
+	// resource, which is then only processed as a rescue action,
+	// or a command executed by /bin/sh.
+	Rescue string `luar:"rescue"`
 }
 
 // ID returns the unique resource id
@@ -215,9 +470,45 @@ func (b *Base) Validate() error {
 		return fmt.Errorf("Invalid state '%s'", b.State)
 	}
 
+	if b.Verbosity != "" {
+		if _, err := ParseVerbosity(b.Verbosity); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// verbosity returns the level of events logged for the resource.
+func (b *Base) verbosity() Verbosity {
+	if v, err := ParseVerbosity(b.Verbosity); err == nil {
+		return v
+	}
+
+	return DefaultConfig.Verbosity
+}
+
+// RescueAction returns the action run when processing the resource fails
+func (b *Base) RescueAction() string {
+	return b.Rescue
+}
+
+// Printf logs an event for the resource, prefixed with its id,
+// unless the resource verbosity is quiet.
+func (b *Base) Printf(format string, a ...interface{}) {
+	if b.verbosity() >= VerbosityNormal {
+		Logf(b.ID()+" "+format, a...)
+	}
+}
+
+// Debugf logs a debug event for the resource, prefixed with
+// its id, if the resource verbosity is debug.
+func (b *Base) Debugf(format string, a ...interface{}) {
+	if b.verbosity() >= VerbosityDebug {
+		Logf(b.ID()+" "+format, a...)
+	}
+}
+
 // Dependencies returns the list of resource dependencies.
 func (b *Base) Dependencies() []string {
 	return b.Require
@@ -235,6 +526,11 @@ func (b *Base) AbsentStates() []string {
 	return b.AbsentStatesList
 }
 
+// DesiredState returns the state declared for the resource.
+func (b *Base) DesiredState() string {
+	return b.State
+}
+
 // IsConcurrent returns a boolean indicating whether
 // multiple instances of the same resource type can be
 // processed concurrently.
@@ -242,6 +538,12 @@ func (b *Base) IsConcurrent() bool {
 	return b.Concurrent
 }
 
+// ShouldRecreateOnChange returns a boolean indicating whether
+// the resource should be recreated when its properties are out of date.
+func (b *Base) ShouldRecreateOnChange() bool {
+	return b.RecreateOnChange
+}
+
 // SubscribedTo returns a map of resources for which the
 // resource is subscribed for changes to.
 func (b *Base) SubscribedTo() TriggerMap {
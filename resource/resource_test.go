@@ -0,0 +1,114 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestVerbosity(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	defaultVerbosity := DefaultConfig.Verbosity
+	defer func() { DefaultConfig.Verbosity = defaultVerbosity }()
+
+	testCases := []struct {
+		global    Verbosity
+		verbosity string
+		want      string
+	}{
+		{VerbosityNormal, "", "file[foo] event\n"},
+		{VerbosityQuiet, "", ""},
+		{VerbosityDebug, "", "file[foo] event\nfile[foo] details\n"},
+		{VerbosityQuiet, "debug", "file[foo] event\nfile[foo] details\n"},
+		{VerbosityDebug, "quiet", ""},
+		{VerbosityNormal, "normal", "file[foo] event\n"},
+	}
+
+	for _, tc := range testCases {
+		logs.Reset()
+		DefaultConfig.Verbosity = tc.global
+		b := &Base{Type: "file", Name: "foo", Verbosity: tc.verbosity}
+		b.Printf("event\n")
+		b.Debugf("details\n")
+		if logs.String() != tc.want {
+			t.Errorf("global %d, verbosity %q: want %q, got %q", tc.global, tc.verbosity, tc.want, logs.String())
+		}
+	}
+
+	b := &Base{Type: "file", Name: "foo", State: "present", PresentStatesList: []string{"present"}, Verbosity: "loud"}
+	if err := b.Validate(); err == nil {
+		t.Error("want error for invalid verbosity")
+	}
+}
+
+// plainResource type is a resource,
+// which does not implement EventLogger.
+type plainResource struct {
+	Resource
+}
+
+func TestVerbosityEventLogger(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	defaultVerbosity := DefaultConfig.Verbosity
+	defer func() { DefaultConfig.Verbosity = defaultVerbosity }()
+
+	r, err := NewFile("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.(*File).Verbosity = "debug"
+
+	testCases := []struct {
+		global Verbosity
+		r      Resource
+		want   string
+	}{
+		{VerbosityQuiet, r, "file[foo] event\nfile[foo] details\n"},
+		{VerbosityQuiet, plainResource{r}, ""},
+		{VerbosityNormal, plainResource{r}, "file[foo] event\n"},
+		{VerbosityDebug, plainResource{r}, "file[foo] event\nfile[foo] details\n"},
+	}
+
+	for _, tc := range testCases {
+		logs.Reset()
+		DefaultConfig.Verbosity = tc.global
+		Printf(tc.r, "event\n")
+		Debugf(tc.r, "details\n")
+		if logs.String() != tc.want {
+			t.Errorf("global %d, resource %T: want %q, got %q", tc.global, tc.r, tc.want, logs.String())
+		}
+	}
+}
@@ -0,0 +1,425 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/dnaeon/gru/utils"
+)
+
+// Route53Namespace is the table name in Lua where Route53 resources are
+// being registered to.
+const Route53Namespace = "route53"
+
+// Route53AliasTarget type represents the target of a Route53 alias record.
+type Route53AliasTarget struct {
+	// DNSName is the DNS name of the alias target, e.g. the
+	// DNS name of an ELB load balancer.
+	DNSName string `luar:"dns_name"`
+
+	// HostedZoneID is the hosted zone id of the alias target.
+	HostedZoneID string `luar:"hosted_zone_id"`
+
+	// EvaluateTargetHealth specifies whether the alias record
+	// inherits the health of the alias target.
+	EvaluateTargetHealth bool `luar:"evaluate_target_health"`
+}
+
+// Route53Record type is a resource which manages DNS records in
+// AWS Route53 hosted zones.
+//
+// Credentials for the AWS API are loaded from the environment,
+// the shared configuration files or the instance profile.
+//
+// Example:
+//   www = route53.record.new("www.example.org")
+//   www.zone = "example.org"
+//   www.type = "A"
+//   www.ttl = 300
+//   www.records = { "192.0.2.1", "192.0.2.2" }
+//
+// An alias record.
+//
+// Example:
+//   app = route53.record.new("app.example.org")
+//   app.zone = "Z1D633PJN98FT9"
+//   app.type = "A"
+//   app.alias_target = {
+//     dns_name = "my-elb-1234567890.us-east-1.elb.amazonaws.com",
+//     hosted_zone_id = "Z35SXDOTRQ7X7K",
+//     evaluate_target_health = true,
+//   }
+type Route53Record struct {
+	Base
+
+	// Zone is the id or name of the hosted zone. Required.
+	Zone string `luar:"zone"`
+
+	// RecordName is the name of the DNS record.
+	// Defaults to the resource name.
+	RecordName string `luar:"name"`
+
+	// RecordType is the type of the DNS record, e.g. "A". Required.
+	RecordType string `luar:"type"`
+
+	// TTL of the DNS record in seconds. Defaults to 300.
+	// Not used for alias records.
+	TTL int64 `luar:"ttl"`
+
+	// Records contains the values of the DNS record.
+	Records []string `luar:"records"`
+
+	// HealthCheckID is the id of a health check to associate
+	// with the DNS record.
+	HealthCheckID string `luar:"health_check_id"`
+
+	// Weight of the DNS record, used for weighted routing.
+	Weight int64 `luar:"weight"`
+
+	// SetIdentifier differentiates records with the same name
+	// and type, e.g. when using weighted routing.
+	SetIdentifier string `luar:"set_identifier"`
+
+	// AliasTarget is the target of an alias record.
+	AliasTarget *Route53AliasTarget `luar:"alias_target"`
+
+	// Region of the AWS API endpoint. Defaults to the
+	// region from the environment or shared configuration.
+	Region string `luar:"region"`
+
+	// The record set managed by the resource, if it exists
+	recordSet *types.ResourceRecordSet `luar:"-"`
+
+	zoneID string             `luar:"-"`
+	ctx    context.Context    `luar:"-"`
+	cancel context.CancelFunc `luar:"-"`
+	client *route53.Client    `luar:"-"`
+}
+
+// NewRoute53Record creates a new resource for managing
+// DNS records in AWS Route53.
+func NewRoute53Record(name string) (Resource, error) {
+	r := &Route53Record{
+		Base: Base{
+			Name:              name,
+			Type:              "record",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		RecordName: name,
+		TTL:        300,
+		Records:    make([]string, 0),
+	}
+
+	r.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "record",
+			PropertySetFunc:      r.setRecord,
+			PropertyIsSyncedFunc: r.isRecordSynced,
+		},
+	}
+
+	return r, nil
+}
+
+// Validate validates the resource.
+func (r *Route53Record) Validate() error {
+	if err := r.Base.Validate(); err != nil {
+		return err
+	}
+
+	if r.Zone == "" {
+		return errors.New("must provide hosted zone")
+	}
+
+	if r.RecordType == "" {
+		return errors.New("must provide record type")
+	}
+
+	if r.AliasTarget == nil && len(r.Records) == 0 {
+		return errors.New("must provide either records or alias target")
+	}
+
+	if r.AliasTarget != nil && len(r.Records) > 0 {
+		return errors.New("cannot use both 'records' and 'alias_target'")
+	}
+
+	if r.Weight != 0 && r.SetIdentifier == "" {
+		return errors.New("must provide set identifier for weighted records")
+	}
+
+	return nil
+}
+
+// Initialize creates the client for the AWS Route53 API and
+// determines the id of the hosted zone.
+func (r *Route53Record) Initialize() error {
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	var opts []func(*config.LoadOptions) error
+	if r.Region != "" {
+		opts = append(opts, config.WithRegion(r.Region))
+	}
+
+	cfg, err := config.LoadDefaultConfig(r.ctx, opts...)
+	if err != nil {
+		return err
+	}
+	r.client = route53.NewFromConfig(cfg)
+
+	zoneID, err := r.hostedZoneID()
+	if err != nil {
+		return err
+	}
+	r.zoneID = zoneID
+
+	return nil
+}
+
+// Close cancels any pending requests to the AWS Route53 API.
+func (r *Route53Record) Close() error {
+	r.cancel()
+
+	return nil
+}
+
+// hostedZoneID returns the id of the hosted zone. Zones
+// can be provided either by their id or by their name.
+func (r *Route53Record) hostedZoneID() (string, error) {
+	if !strings.Contains(r.Zone, ".") {
+		return strings.TrimPrefix(r.Zone, "/hostedzone/"), nil
+	}
+
+	input := &route53.ListHostedZonesByNameInput{
+		DNSName:  aws.String(r.Zone),
+		MaxItems: aws.Int32(1),
+	}
+
+	resp, err := r.client.ListHostedZonesByName(r.ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	for _, zone := range resp.HostedZones {
+		if route53Name(aws.ToString(zone.Name)) == route53Name(r.Zone) {
+			return strings.TrimPrefix(aws.ToString(zone.Id), "/hostedzone/"), nil
+		}
+	}
+
+	return "", fmt.Errorf("hosted zone %s not found", r.Zone)
+}
+
+// Evaluate evaluates the state of the DNS record.
+func (r *Route53Record) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    r.State,
+	}
+
+	input := &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(r.zoneID),
+		StartRecordName: aws.String(r.RecordName),
+		StartRecordType: types.RRType(r.RecordType),
+	}
+
+	for {
+		resp, err := r.client.ListResourceRecordSets(r.ctx, input)
+		if err != nil {
+			return state, err
+		}
+
+		for _, rrs := range resp.ResourceRecordSets {
+			// Record sets are sorted by name and type, so once we reach
+			// a different name or type there are no more candidates.
+			if route53Name(aws.ToString(rrs.Name)) != route53Name(r.RecordName) || string(rrs.Type) != r.RecordType {
+				state.Current = "absent"
+				return state, nil
+			}
+
+			if aws.ToString(rrs.SetIdentifier) == r.SetIdentifier {
+				set := rrs
+				r.recordSet = &set
+				state.Current = "present"
+				return state, nil
+			}
+		}
+
+		if !resp.IsTruncated {
+			break
+		}
+
+		input.StartRecordName = resp.NextRecordName
+		input.StartRecordType = resp.NextRecordType
+		input.StartRecordIdentifier = resp.NextRecordIdentifier
+	}
+
+	state.Current = "absent"
+
+	return state, nil
+}
+
+// Create creates the DNS record.
+func (r *Route53Record) Create() error {
+	r.Printf("creating %s record %s\n", r.RecordType, r.RecordName)
+
+	return r.change(types.ChangeActionCreate, r.desiredRecordSet())
+}
+
+// Delete deletes the DNS record.
+func (r *Route53Record) Delete() error {
+	r.Printf("removing %s record %s\n", r.RecordType, r.RecordName)
+
+	// The record set must match the existing one in order to be deleted
+	return r.change(types.ChangeActionDelete, r.recordSet)
+}
+
+// change submits a change for a record set in the hosted zone.
+func (r *Route53Record) change(action types.ChangeAction, rrs *types.ResourceRecordSet) error {
+	input := &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(r.zoneID),
+		ChangeBatch: &types.ChangeBatch{
+			Comment: aws.String(fmt.Sprintf("Managed by gru: %s", r.ID())),
+			Changes: []types.Change{
+				{Action: action, ResourceRecordSet: rrs},
+			},
+		},
+	}
+
+	resp, err := r.client.ChangeResourceRecordSets(r.ctx, input)
+	if err != nil {
+		return err
+	}
+
+	r.Printf("change %s is %s\n", aws.ToString(resp.ChangeInfo.Id), resp.ChangeInfo.Status)
+
+	return nil
+}
+
+// desiredRecordSet returns the record set as described by the resource.
+func (r *Route53Record) desiredRecordSet() *types.ResourceRecordSet {
+	rrs := &types.ResourceRecordSet{
+		Name: aws.String(r.RecordName),
+		Type: types.RRType(r.RecordType),
+	}
+
+	if r.AliasTarget != nil {
+		rrs.AliasTarget = &types.AliasTarget{
+			DNSName:              aws.String(r.AliasTarget.DNSName),
+			HostedZoneId:         aws.String(r.AliasTarget.HostedZoneID),
+			EvaluateTargetHealth: r.AliasTarget.EvaluateTargetHealth,
+		}
+	} else {
+		rrs.TTL = aws.Int64(r.TTL)
+		for _, value := range r.Records {
+			rrs.ResourceRecords = append(rrs.ResourceRecords, types.ResourceRecord{Value: aws.String(value)})
+		}
+	}
+
+	if r.HealthCheckID != "" {
+		rrs.HealthCheckId = aws.String(r.HealthCheckID)
+	}
+
+	if r.SetIdentifier != "" {
+		rrs.SetIdentifier = aws.String(r.SetIdentifier)
+		rrs.Weight = aws.Int64(r.Weight)
+	}
+
+	return rrs
+}
+
+// isRecordSynced checks whether the DNS record settings are in sync.
+func (r *Route53Record) isRecordSynced() (bool, error) {
+	if r.recordSet == nil {
+		return false, ErrResourceAbsent
+	}
+
+	rrs := r.recordSet
+	if aws.ToString(rrs.HealthCheckId) != r.HealthCheckID {
+		return false, nil
+	}
+
+	if r.SetIdentifier != "" && aws.ToInt64(rrs.Weight) != r.Weight {
+		return false, nil
+	}
+
+	if r.AliasTarget != nil {
+		alias := rrs.AliasTarget
+		synced := alias != nil &&
+			route53Name(aws.ToString(alias.DNSName)) == route53Name(r.AliasTarget.DNSName) &&
+			aws.ToString(alias.HostedZoneId) == r.AliasTarget.HostedZoneID &&
+			alias.EvaluateTargetHealth == r.AliasTarget.EvaluateTargetHealth
+
+		return synced, nil
+	}
+
+	if rrs.AliasTarget != nil || aws.ToInt64(rrs.TTL) != r.TTL {
+		return false, nil
+	}
+
+	values := make([]string, 0, len(rrs.ResourceRecords))
+	for _, record := range rrs.ResourceRecords {
+		values = append(values, aws.ToString(record.Value))
+	}
+
+	return utils.SameStrings(values, r.Records), nil
+}
+
+// setRecord updates the DNS record settings.
+func (r *Route53Record) setRecord() error {
+	r.Printf("updating %s record %s\n", r.RecordType, r.RecordName)
+
+	return r.change(types.ChangeActionUpsert, r.desiredRecordSet())
+}
+
+// route53Name normalizes a DNS name as returned by Route53,
+// so that it can be compared with other names.
+func route53Name(name string) string {
+	name = strings.Replace(name, `\052`, "*", -1)
+
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+func init() {
+	record := ProviderItem{
+		Type:      "record",
+		Provider:  NewRoute53Record,
+		Namespace: Route53Namespace,
+	}
+
+	RegisterProvider(record)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+func TestRoute53RecordSynced(t *testing.T) {
+	r, err := NewRoute53Record("www.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := r.(*Route53Record)
+	rec.Zone = "example.org"
+	rec.RecordType = "A"
+	rec.Records = []string{"192.0.2.1", "192.0.2.2"}
+	if err := rec.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = rec.isRecordSynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	// Record sets as returned by the API
+	recordSet := func(ttl int64, values ...string) *types.ResourceRecordSet {
+		rrs := &types.ResourceRecordSet{
+			Name: aws.String("www.example.org."),
+			Type: types.RRTypeA,
+			TTL:  aws.Int64(ttl),
+		}
+		for _, value := range values {
+			rrs.ResourceRecords = append(rrs.ResourceRecords, types.ResourceRecord{Value: aws.String(value)})
+		}
+
+		return rrs
+	}
+
+	testCases := []struct {
+		recordSet *types.ResourceRecordSet
+		want      bool
+	}{
+		{recordSet(300, "192.0.2.1", "192.0.2.2"), true},
+		{recordSet(300, "192.0.2.2", "192.0.2.1"), true},
+		{recordSet(60, "192.0.2.1", "192.0.2.2"), false},
+		{recordSet(300, "192.0.2.1"), false},
+		{recordSet(300, "192.0.2.1", "192.0.2.1"), false},
+		{recordSet(300, "192.0.2.1", "192.0.2.3"), false},
+	}
+
+	for _, tc := range testCases {
+		rec.recordSet = tc.recordSet
+		synced, err := rec.isRecordSynced()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if synced != tc.want {
+			t.Errorf("want synced %t for record set with ttl %d and %d records", tc.want, *tc.recordSet.TTL, len(tc.recordSet.ResourceRecords))
+		}
+	}
+
+	// Health checks and weights are compared as well
+	rec.recordSet = recordSet(300, "192.0.2.1", "192.0.2.2")
+	rec.HealthCheckID = "hc-1"
+	errorIfNotEqual(t, []string{"record"}, outOfSync(t, rec))
+
+	rec.recordSet.HealthCheckId = aws.String("hc-1")
+	rec.SetIdentifier = "blue"
+	rec.Weight = 10
+	rec.recordSet.SetIdentifier = aws.String("blue")
+	rec.recordSet.Weight = aws.Int64(20)
+	errorIfNotEqual(t, []string{"record"}, outOfSync(t, rec))
+
+	rec.recordSet.Weight = aws.Int64(10)
+	errorIfNotEqual(t, []string{}, outOfSync(t, rec))
+
+	// Records are out of sync with alias record sets
+	rec.recordSet.AliasTarget = &types.AliasTarget{DNSName: aws.String("elb.amazonaws.com.")}
+	errorIfNotEqual(t, []string{"record"}, outOfSync(t, rec))
+}
+
+func TestRoute53RecordAlias(t *testing.T) {
+	r, err := NewRoute53Record("app.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := r.(*Route53Record)
+	rec.Zone = "Z1D633PJN98FT9"
+	rec.RecordType = "A"
+	rec.AliasTarget = &Route53AliasTarget{
+		DNSName:              "My-ELB.us-east-1.elb.amazonaws.com",
+		HostedZoneID:         "Z35SXDOTRQ7X7K",
+		EvaluateTargetHealth: true,
+	}
+	if err := rec.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alias record sets have no TTL and are compared by normalized name
+	rrs := rec.desiredRecordSet()
+	if rrs.TTL != nil || len(rrs.ResourceRecords) != 0 {
+		t.Errorf("want alias record set without ttl and records, got %v", rrs)
+	}
+
+	rrs.AliasTarget.DNSName = aws.String("my-elb.us-east-1.elb.amazonaws.com.")
+	rec.recordSet = rrs
+	errorIfNotEqual(t, []string{}, outOfSync(t, rec))
+
+	rec.AliasTarget.EvaluateTargetHealth = false
+	errorIfNotEqual(t, []string{"record"}, outOfSync(t, rec))
+
+	rec.Records = []string{"192.0.2.1"}
+	if err := rec.Validate(); err == nil {
+		t.Error("want error for both records and alias target")
+	}
+}
+
+func TestRoute53Name(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{"www.example.org.", "www.example.org"},
+		{"WWW.Example.org", "www.example.org"},
+		{`\052.example.org.`, "*.example.org"},
+	}
+
+	for _, tc := range testCases {
+		errorIfNotEqual(t, tc.want, route53Name(tc.name))
+	}
+}
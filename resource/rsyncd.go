@@ -0,0 +1,480 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// rsyncdConfigPath is the path to the rsync daemon configuration file.
+const rsyncdConfigPath = "/etc/rsyncd.conf"
+
+// RsyncModule type is a resource which manages rsync daemon modules.
+//
+// Modules are managed as sections of /etc/rsyncd.conf. Global settings
+// and other modules in the file are left intact. The rsync daemon is
+// sent SIGHUP after the configuration has been changed, if its pid
+// file is declared in the global settings.
+//
+// Example:
+//   backup = resource.rsync_module.new("backup")
+//   backup.state = "present"
+//   backup.path = "/srv/backup"
+//   backup.comment = "Nightly backups"
+//   backup.read_only = false
+//   backup.auth_users = { "backup" }
+//   backup.hosts = { "10.0.0.0/8" }
+//   backup.max_connections = 4
+type RsyncModule struct {
+	Base
+
+	// Path is the directory served by the module.
+	Path string `luar:"path"`
+
+	// Comment describes the module to clients listing modules.
+	Comment string `luar:"comment"`
+
+	// ReadOnly specifies whether clients are not allowed
+	// to upload files. Defaults to true.
+	ReadOnly bool `luar:"read_only"`
+
+	// AuthUsers contains the users allowed to connect to the module.
+	// Defaults to no authentication.
+	AuthUsers []string `luar:"auth_users"`
+
+	// Hosts contains the hosts allowed to connect to the module.
+	// Defaults to all hosts.
+	Hosts []string `luar:"hosts"`
+
+	// MaxConnections is the maximum number of simultaneous
+	// connections. Defaults to zero, which means no limit.
+	MaxConnections int `luar:"max_connections"`
+
+	// Path to the rsync daemon configuration file
+	configPath string `luar:"-"`
+}
+
+// NewRsyncModule creates a new resource for managing rsync daemon modules.
+func NewRsyncModule(name string) (Resource, error) {
+	m := &RsyncModule{
+		Base: Base{
+			Name:              name,
+			Type:              "rsync_module",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			// All modules are kept in the same file
+			Concurrent: false,
+			Subscribe:  make(TriggerMap),
+		},
+		ReadOnly:   true,
+		AuthUsers:  make([]string, 0),
+		Hosts:      make([]string, 0),
+		configPath: rsyncdConfigPath,
+	}
+
+	m.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "config",
+			PropertySetFunc:      m.setConfig,
+			PropertyIsSyncedFunc: m.isConfigSynced,
+		},
+	}
+
+	return m, nil
+}
+
+// Validate validates the resource.
+func (m *RsyncModule) Validate() error {
+	if err := m.Base.Validate(); err != nil {
+		return err
+	}
+
+	if strings.ContainsAny(m.Name, "[]\n") || strings.TrimSpace(m.Name) != m.Name {
+		return fmt.Errorf("invalid module name '%s'", m.Name)
+	}
+
+	if m.State == "present" && m.Path == "" {
+		return errors.New("missing module path")
+	}
+
+	if m.MaxConnections < 0 {
+		return fmt.Errorf("invalid max_connections %d", m.MaxConnections)
+	}
+
+	values := append([]string{m.Path, m.Comment}, m.AuthUsers...)
+	values = append(values, m.Hosts...)
+	for _, value := range values {
+		if strings.Contains(value, "\n") {
+			return errors.New("module settings cannot contain newlines")
+		}
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the module.
+func (m *RsyncModule) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    m.State,
+	}
+
+	sections, err := m.readConfig()
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "absent"
+	if findRsyncdSection(sections, m.Name) != nil {
+		state.Current = "present"
+	}
+
+	return state, nil
+}
+
+// Create adds the module to the configuration file.
+func (m *RsyncModule) Create() error {
+	m.Printf("adding module to %s\n", m.configPath)
+
+	sections, err := m.readConfig()
+	if err != nil {
+		return err
+	}
+
+	// Separate the module from the preceding section
+	last := sections[len(sections)-1]
+	if n := len(last.lines); n > 0 && strings.TrimSpace(last.lines[n-1]) != "" {
+		last.lines = append(last.lines, "\n")
+	}
+	sections = append(sections, &rsyncdSection{name: m.Name, lines: m.lines()})
+
+	return m.writeConfig(sections)
+}
+
+// Delete removes the module from the configuration file.
+func (m *RsyncModule) Delete() error {
+	m.Printf("removing module from %s\n", m.configPath)
+
+	sections, err := m.readConfig()
+	if err != nil {
+		return err
+	}
+
+	s := findRsyncdSection(sections, m.Name)
+	if s == nil {
+		return nil
+	}
+
+	// Keep any comments belonging to the next section, but not
+	// the blank lines separating it from the removed module
+	trailer := s.trailer()
+	for len(trailer) > 0 && strings.TrimSpace(trailer[0]) == "" {
+		trailer = trailer[1:]
+	}
+	s.lines = trailer
+
+	return m.writeConfig(sections)
+}
+
+// options returns the module options managed by the resource.
+func (m *RsyncModule) options() map[string]string {
+	options := map[string]string{
+		"path":      m.Path,
+		"read only": "no",
+	}
+
+	if m.ReadOnly {
+		options["read only"] = "yes"
+	}
+
+	if m.Comment != "" {
+		options["comment"] = m.Comment
+	}
+
+	if len(m.AuthUsers) > 0 {
+		options["auth users"] = strings.Join(m.AuthUsers, ", ")
+	}
+
+	if len(m.Hosts) > 0 {
+		options["hosts allow"] = strings.Join(m.Hosts, " ")
+	}
+
+	if m.MaxConnections > 0 {
+		options["max connections"] = strconv.Itoa(m.MaxConnections)
+	}
+
+	return options
+}
+
+// lines returns the lines of the module section.
+func (m *RsyncModule) lines() []string {
+	options := m.options()
+	lines := []string{fmt.Sprintf("[%s]\n", m.Name)}
+	for _, key := range []string{"path", "comment", "read only", "auth users", "hosts allow", "max connections"} {
+		if value, ok := options[key]; ok {
+			lines = append(lines, fmt.Sprintf("    %s = %s\n", key, value))
+		}
+	}
+
+	return lines
+}
+
+// isConfigSynced checks whether the options of the module are in sync.
+func (m *RsyncModule) isConfigSynced() (bool, error) {
+	sections, err := m.readConfig()
+	if err != nil {
+		return false, err
+	}
+
+	s := findRsyncdSection(sections, m.Name)
+	if s == nil {
+		return false, ErrResourceAbsent
+	}
+
+	current := normalizeRsyncdOptions(s.options())
+	want := normalizeRsyncdOptions(m.options())
+
+	return reflect.DeepEqual(current, want), nil
+}
+
+// setConfig updates the options of the module.
+func (m *RsyncModule) setConfig() error {
+	m.Printf("updating module in %s\n", m.configPath)
+
+	sections, err := m.readConfig()
+	if err != nil {
+		return err
+	}
+
+	s := findRsyncdSection(sections, m.Name)
+	if s == nil {
+		return ErrResourceAbsent
+	}
+	s.lines = append(m.lines(), s.trailer()...)
+
+	return m.writeConfig(sections)
+}
+
+// readConfig reads and parses the configuration file.
+// A missing file is treated as being empty.
+func (m *RsyncModule) readConfig() ([]*rsyncdSection, error) {
+	data, err := ioutil.ReadFile(m.configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return parseRsyncdConfig(data), nil
+}
+
+// writeConfig writes the configuration file and
+// signals the rsync daemon to reload it.
+func (m *RsyncModule) writeConfig(sections []*rsyncdSection) error {
+	var buf bytes.Buffer
+	for _, s := range sections {
+		for _, line := range s.lines {
+			buf.WriteString(line)
+		}
+	}
+
+	if err := writeFile(m.configPath, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	return m.reload(sections[0])
+}
+
+// reload sends SIGHUP to the rsync daemon. The daemon is found using
+// the pid file declared in the global settings, if any.
+func (m *RsyncModule) reload(global *rsyncdSection) error {
+	pidFile := global.options()["pid file"]
+	if pidFile == "" {
+		m.Printf("no pid file declared in %s, skipping reload\n", m.configPath)
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(pidFile)
+	if os.IsNotExist(err) {
+		m.Printf("rsyncd is not running, skipping reload\n")
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("invalid pid in %s: %s", pidFile, err)
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	m.Printf("sending SIGHUP to rsyncd\n")
+
+	return p.Signal(syscall.SIGHUP)
+}
+
+// rsyncdSection type represents a section of the rsync daemon
+// configuration file. The lines preceding the first module contain
+// the global settings and are kept in a section without a name.
+type rsyncdSection struct {
+	// Name of the module
+	name string
+
+	// Lines of the section, including the header and trailing newlines
+	lines []string
+}
+
+// options returns the options declared in the section.
+// Keys are lowercase with words separated by single spaces.
+func (s *rsyncdSection) options() map[string]string {
+	options := make(map[string]string)
+	for _, line := range s.lines {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' || line[0] == '[' {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key := strings.ToLower(strings.Replace(kv[0], "_", " ", -1))
+		key = strings.Join(strings.Fields(key), " ")
+		options[key] = strings.TrimSpace(kv[1])
+	}
+
+	return options
+}
+
+// trailer returns the comments and blank lines following the last
+// option of the section, which usually belong to the next section.
+func (s *rsyncdSection) trailer() []string {
+	i := len(s.lines)
+	for i > 0 {
+		line := strings.TrimSpace(s.lines[i-1])
+		if line != "" && line[0] != '#' && line[0] != ';' {
+			break
+		}
+		i--
+	}
+
+	return s.lines[i:]
+}
+
+// parseRsyncdConfig splits the rsync daemon configuration file into
+// sections. The first section always contains the global settings.
+func parseRsyncdConfig(data []byte) []*rsyncdSection {
+	sections := []*rsyncdSection{{}}
+	if len(data) == 0 {
+		return sections
+	}
+
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			name := strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			sections = append(sections, &rsyncdSection{name: name})
+		}
+
+		s := sections[len(sections)-1]
+		s.lines = append(s.lines, line)
+	}
+
+	// Terminate the last line, so that sections can be appended
+	s := sections[len(sections)-1]
+	if n := len(s.lines); n > 0 && !strings.HasSuffix(s.lines[n-1], "\n") {
+		s.lines[n-1] += "\n"
+	}
+
+	return sections
+}
+
+// findRsyncdSection returns the section of the given module, if any.
+func findRsyncdSection(sections []*rsyncdSection, name string) *rsyncdSection {
+	for _, s := range sections[1:] {
+		if s.name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// normalizeRsyncdOptions returns the options with values in a canonical
+// form, so that equivalent values written differently compare equal.
+func normalizeRsyncdOptions(options map[string]string) map[string]string {
+	normalized := make(map[string]string, len(options))
+	for key, value := range options {
+		switch key {
+		case "read only":
+			switch strings.ToLower(value) {
+			case "yes", "true", "1":
+				value = "yes"
+			default:
+				value = "no"
+			}
+		case "auth users", "hosts allow":
+			fields := strings.FieldsFunc(value, func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t'
+			})
+			sort.Strings(fields)
+			value = strings.Join(fields, " ")
+		}
+		normalized[key] = value
+	}
+
+	return normalized
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "rsync_module",
+		Provider:  NewRsyncModule,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRsyncModule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-rsyncd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	const config = `# global settings
+uid = nobody
+pid file = /nonexistent/rsyncd.pid
+
+[pub]
+    path = /srv/pub
+    read only = yes
+
+# mirror of upstream
+[mirror]
+    path = /srv/mirror
+`
+	path := filepath.Join(dir, "rsyncd.conf")
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRsyncModule("backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := r.(*RsyncModule)
+	m.configPath = path
+	m.Path = "/srv/backup"
+	m.Comment = "Nightly backups"
+	m.ReadOnly = false
+	m.AuthUsers = []string{"backup", "admin"}
+	m.Hosts = []string{"10.0.0.0/8"}
+	m.MaxConnections = 4
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := m.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := m.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	module := `[backup]
+    path = /srv/backup
+    comment = Nightly backups
+    read only = no
+    auth users = backup, admin
+    hosts allow = 10.0.0.0/8
+    max connections = 4
+`
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, config+"\n"+module, string(content))
+
+	state, err = m.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+
+	synced, err := m.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	// Equivalent values written differently are in sync
+	edited := bytes.Replace(content, []byte("auth users = backup, admin"), []byte("auth_users = admin backup"), 1)
+	if err := ioutil.WriteFile(path, edited, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	synced, err = m.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	// Modules are updated in place
+	r, err = NewRsyncModule("pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub := r.(*RsyncModule)
+	pub.configPath = path
+	pub.Path = "/srv/pub"
+	pub.MaxConnections = 10
+
+	synced, err = pub.isConfigSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	if err := pub.setConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubModule := "[pub]\n    path = /srv/pub\n    read only = yes\n"
+	want := strings.Replace(string(edited), pubModule, pubModule+"    max connections = 10\n", 1)
+	errorIfNotEqual(t, want, string(content))
+
+	// Removing a module leaves the others intact
+	if err := pub.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = strings.Replace(string(edited), pubModule+"\n", "", 1)
+	errorIfNotEqual(t, want, string(content))
+
+	m.Name = "bad]name"
+	if err := m.Validate(); err == nil {
+		t.Error("want error for invalid module name")
+	}
+}
@@ -0,0 +1,473 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+//go:generate go run gendocs.go -output schema_docs.go
+
+// schemaExampleName is the name of the resources created
+// when describing resource types.
+const schemaExampleName = "example"
+
+// typeDoc type contains the documentation of a resource type.
+type typeDoc struct {
+	// Synopsis is the first sentence of the type documentation
+	Synopsis string
+
+	// Fields contains the documentation of the fields
+	Fields map[string]fieldDoc
+}
+
+// fieldDoc type contains the documentation of a field.
+type fieldDoc struct {
+	// Doc is the documentation of the field
+	Doc string
+
+	// Required is true if the field must be provided
+	Required bool
+}
+
+// Schema type describes a resource type and the attributes it accepts.
+type Schema struct {
+	// Namespace is the Lua table the provider is registered in
+	Namespace string `json:"namespace"`
+
+	// Type name of the provider
+	Type string `json:"type"`
+
+	// Description of the resource type
+	Description string `json:"description"`
+
+	// Attributes accepted by resources of the type
+	Attributes []AttributeSchema `json:"attributes"`
+}
+
+// AttributeSchema type describes an attribute of a resource.
+type AttributeSchema struct {
+	// Name of the attribute in Lua
+	Name string `json:"name"`
+
+	// Type of the attribute in Lua, e.g. "string"
+	Type string `json:"type"`
+
+	// Default value of the attribute as a Lua expression,
+	// empty if the attribute has no default value
+	Default string `json:"default,omitempty"`
+
+	// Required is true if the attribute must be provided
+	Required bool `json:"required"`
+
+	// Description of the attribute
+	Description string `json:"description,omitempty"`
+}
+
+// Providers returns the registered providers sorted by namespace
+// and type. Providers registered more than once under the same
+// name are returned only once, as the last one registered is used.
+func Providers() []ProviderItem {
+	seen := make(map[string]int)
+	items := make([]ProviderItem, 0, len(providerRegistry))
+	for _, item := range providerRegistry {
+		name := item.Namespace + "." + item.Type
+		if i, ok := seen[name]; ok {
+			items[i] = item
+			continue
+		}
+		seen[name] = len(items)
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Namespace != items[j].Namespace {
+			return items[i].Namespace < items[j].Namespace
+		}
+		return items[i].Type < items[j].Type
+	})
+
+	return items
+}
+
+// LookupProvider returns the provider with the given name, either
+// in the "namespace.type" form or just the type for providers in
+// the default resource namespace.
+func LookupProvider(name string) (ProviderItem, error) {
+	if !strings.Contains(name, ".") {
+		name = DefaultResourceNamespace + "." + name
+	}
+
+	for _, item := range Providers() {
+		if item.Namespace+"."+item.Type == name {
+			return item, nil
+		}
+	}
+
+	return ProviderItem{}, fmt.Errorf("unknown resource type %s", name)
+}
+
+// Describe describes the resource type of the provider, by
+// inspecting a resource created by it.
+func Describe(item ProviderItem) (Schema, error) {
+	schema := Schema{
+		Namespace:   item.Namespace,
+		Type:        item.Type,
+		Description: item.Description,
+		Attributes:  make([]AttributeSchema, 0),
+	}
+
+	r, err := item.Provider(schemaExampleName)
+	if err != nil {
+		return schema, err
+	}
+
+	v := reflect.ValueOf(r)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if schema.Description == "" {
+		schema.Description = schemaDocs[v.Type().Name()].Synopsis
+	}
+
+	if v.Kind() == reflect.Struct {
+		schema.Attributes = describeFields(v, schema.Attributes)
+	}
+
+	return schema, nil
+}
+
+// describeFields appends the attributes for the fields of a struct,
+// including the fields of embedded structs. Fields of embedded
+// structs come first, as they are common to many resource types.
+func describeFields(v reflect.Value, attrs []AttributeSchema) []AttributeSchema {
+	t := v.Type()
+	docs := schemaDocs[t.Name()]
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("luar")
+		if tag == "-" {
+			continue
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			attrs = describeFields(v.Field(i), attrs)
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = strings.ToLower(f.Name[:1]) + f.Name[1:]
+		}
+
+		fd := docs.Fields[f.Name]
+		attrs = append(attrs, AttributeSchema{
+			Name:        name,
+			Type:        luaTypeName(f.Type),
+			Default:     luaLiteral(v.Field(i)),
+			Required:    fd.Required,
+			Description: fd.Doc,
+		})
+	}
+
+	return attrs
+}
+
+// redactedValue replaces the values of sensitive attributes, which
+// are declared using the `gru:"sensitive"` struct tag or use secrets.
+const redactedValue = "<redacted>"
+
+// Attributes returns the attributes of a resource keyed by their names
+// in Lua, as values which can be encoded as JSON, e.g. for recording
+// them in the state file. Sensitive attributes, including the ones
+// using secrets resolved from secret backends, are redacted, content
+// is replaced by its checksum, and functions are left out.
+func Attributes(r Resource) map[string]interface{} {
+	attrs := make(map[string]interface{})
+
+	v := reflect.ValueOf(r)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct {
+		collectAttributes(v, attrs)
+	}
+
+	for name := range attrs {
+		if DefaultConfig.Secrets.IsSensitive(r, name) {
+			attrs[name] = redactedValue
+		}
+	}
+
+	return attrs
+}
+
+// collectAttributes adds the attributes for the fields of a
+// struct, including the fields of embedded structs.
+func collectAttributes(v reflect.Value, attrs map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("luar")
+		if tag == "-" {
+			continue
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			collectAttributes(v.Field(i), attrs)
+			continue
+		}
+
+		if f.PkgPath != "" || strings.Contains(luaTypeName(f.Type), "function") {
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = strings.ToLower(f.Name[:1]) + f.Name[1:]
+		}
+
+		switch {
+		case f.Tag.Get("gru") == "sensitive":
+			attrs[name] = redactedValue
+		default:
+			attrs[name] = attributeValue(v.Field(i))
+		}
+	}
+}
+
+// attributeValue returns the value of an attribute,
+// as a value which can be encoded as JSON.
+func attributeValue(v reflect.Value) interface{} {
+	switch {
+	case v.Type() == fileModeType:
+		return fmt.Sprintf("%04o", v.Uint())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		if v.IsNil() {
+			return nil
+		}
+		return fmt.Sprintf("sha256:%x", sha256.Sum256(v.Bytes()))
+	case v.Kind() == reflect.Interface && !v.IsNil():
+		if lv, ok := v.Interface().(lua.LValue); ok {
+			return lv.String()
+		}
+	}
+
+	// Values which cannot be encoded are recorded as text
+	value := v.Interface()
+	if _, err := json.Marshal(value); err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return value
+}
+
+// luaFunctionType is the type of Lua functions.
+var luaFunctionType = reflect.TypeOf(&lua.LFunction{})
+
+// fileModeType is the type of file permission bits.
+var fileModeType = reflect.TypeOf(os.FileMode(0))
+
+// luaTypeName returns the name of the Lua type
+// corresponding to the given Go type.
+func luaTypeName(t reflect.Type) string {
+	if t == luaFunctionType {
+		return "function"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		return "list of " + luaTypeName(t.Elem())
+	case reflect.Map:
+		return "map of " + luaTypeName(t.Key()) + " to " + luaTypeName(t.Elem())
+	case reflect.Ptr:
+		return luaTypeName(t.Elem())
+	case reflect.Struct:
+		return "table"
+	case reflect.Func:
+		return "function"
+	default:
+		return "any"
+	}
+}
+
+// luaLiteral returns the value as a Lua expression,
+// or an empty string for zero and empty values.
+func luaLiteral(v reflect.Value) string {
+	if !v.IsValid() || v.IsZero() {
+		return ""
+	}
+
+	// Permission bits are declared in octal in Lua
+	if v.Type() == fileModeType {
+		return fmt.Sprintf("tonumber(\"%04o\", 8)", v.Uint())
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return ""
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return strconv.Quote(string(v.Bytes()))
+		}
+
+		items := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item := luaLiteral(v.Index(i))
+			if item == "" {
+				return ""
+			}
+			items = append(items, item)
+		}
+		return "{ " + strings.Join(items, ", ") + " }"
+	case reflect.Map:
+		if v.Len() == 0 {
+			return ""
+		}
+
+		items := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			key, value := luaLiteral(k), luaLiteral(v.MapIndex(k))
+			if key == "" || value == "" {
+				return ""
+			}
+			items = append(items, "["+key+"] = "+value)
+		}
+		sort.Strings(items)
+		return "{ " + strings.Join(items, ", ") + " }"
+	default:
+		return ""
+	}
+}
+
+// luaPlaceholder returns a placeholder value for an
+// attribute of the given Lua type, used in examples.
+func luaPlaceholder(typ string) string {
+	switch {
+	case typ == "string":
+		return `"..."`
+	case typ == "number":
+		return "0"
+	case typ == "boolean":
+		return "true"
+	case strings.HasPrefix(typ, "list of "):
+		return "{ " + luaPlaceholder(strings.TrimPrefix(typ, "list of ")) + " }"
+	default:
+		return "{}"
+	}
+}
+
+// varName returns the name of the Lua variable used in examples.
+func (s Schema) varName() string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s.Type)
+}
+
+// Example returns a short example of declaring a resource
+// of the type in Lua, setting the required attributes.
+func (s Schema) Example() string {
+	v := s.varName()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s = %s.%s.new(%q)\n", v, s.Namespace, s.Type, schemaExampleName)
+	for _, attr := range s.Attributes {
+		if attr.Required {
+			fmt.Fprintf(&b, "%s.%s = %s\n", v, attr.Name, luaPlaceholder(attr.Type))
+		}
+	}
+	fmt.Fprintf(&b, "%s.state = \"present\"\n", v)
+
+	return b.String()
+}
+
+// Skeleton returns a ready to edit declaration of a resource of
+// the type in Lua, listing every attribute. Required attributes
+// are set to placeholder values, while optional attributes are
+// commented out and set to their default values, if any.
+func (s Schema) Skeleton() string {
+	v := s.varName()
+
+	var b strings.Builder
+	if s.Description != "" {
+		fmt.Fprintf(&b, "-- %s\n", s.Description)
+	}
+	fmt.Fprintf(&b, "%s = %s.%s.new(%q)\n", v, s.Namespace, s.Type, schemaExampleName)
+	for _, attr := range s.Attributes {
+		switch {
+		case attr.Required:
+			fmt.Fprintf(&b, "%s.%s = %s -- %s, required\n", v, attr.Name, luaPlaceholder(attr.Type), attr.Type)
+		case attr.Default != "":
+			fmt.Fprintf(&b, "-- %s.%s = %s -- %s, default\n", v, attr.Name, attr.Default, attr.Type)
+		case attr.Type == "boolean":
+			fmt.Fprintf(&b, "-- %s.%s = false -- %s, default\n", v, attr.Name, attr.Type)
+		default:
+			fmt.Fprintf(&b, "-- %s.%s = %s -- %s\n", v, attr.Name, luaPlaceholder(attr.Type), attr.Type)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	// Built-in resource types must be documented, which fails if
+	// the docs have not been generated again. Providers may fail
+	// on systems they do not support, e.g. without a package manager.
+	for _, item := range Providers() {
+		schema, err := Describe(item)
+		if err != nil {
+			continue
+		}
+
+		if schema.Description == "" {
+			t.Errorf("%s.%s: no description, run go generate", item.Namespace, item.Type)
+		}
+	}
+
+	item, err := LookupProvider("link")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := Describe(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := make(map[string]AttributeSchema)
+	for _, attr := range schema.Attributes {
+		attrs[attr.Name] = attr
+	}
+
+	want := AttributeSchema{
+		Name:        "state",
+		Type:        "string",
+		Default:     `"present"`,
+		Description: "Desired state of the resource",
+	}
+	errorIfNotEqual(t, want, attrs["state"])
+	errorIfNotEqual(t, "list of string", attrs["require"].Type)
+	errorIfNotEqual(t, "map of string to function", attrs["subscribe"].Type)
+	errorIfNotEqual(t, true, attrs["source"].Required)
+	errorIfNotEqual(t, "Source file points to the file the link will be set to.", attrs["source"].Description)
+
+	example := `link = resource.link.new("example")
+link.source = "..."
+link.state = "present"
+`
+	errorIfNotEqual(t, example, schema.Example())
+
+	item, err = LookupProvider("directory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err = Describe(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, attr := range schema.Attributes {
+		if attr.Name == "mode" {
+			errorIfNotEqual(t, `tonumber("0755", 8)`, attr.Default)
+		}
+	}
+
+	item, err = LookupProvider("vault.kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "kv", item.Type)
+
+	if _, err := LookupProvider("vault.file"); err == nil {
+		t.Error("want error for unknown resource type")
+	}
+
+	providers := Providers()
+	for i := 1; i < len(providers); i++ {
+		prev, cur := providers[i-1], providers[i]
+		if prev.Namespace+"."+prev.Type >= cur.Namespace+"."+cur.Type && prev.Namespace == cur.Namespace {
+			t.Errorf("want providers sorted, got %s.%s before %s.%s", prev.Namespace, prev.Type, cur.Namespace, cur.Type)
+		}
+	}
+}
+
+func TestSchemaExample(t *testing.T) {
+	schema := Schema{
+		Attributes: []AttributeSchema{
+			{Name: "tags", Type: "list of string", Required: true},
+		},
+	}
+	if !strings.Contains(schema.Example(), `.tags = { "..." }`) {
+		t.Errorf("want placeholder for list attribute, got %q", schema.Example())
+	}
+}
+
+func TestSchemaSkeleton(t *testing.T) {
+	// Skeletons must be valid catalogs once the placeholders of
+	// the required attributes are filled in, e.g. with an existing file
+	source, err := ioutil.TempFile("", "gru-skeleton")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.Close()
+	defer os.Remove(source.Name())
+
+	for _, name := range []string{"link", "file", "yum", "coredns_config"} {
+		item, err := LookupProvider(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		schema, err := Describe(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		L := newLuaState()
+		defer L.Close()
+
+		skeleton := strings.Replace(schema.Skeleton(), `= "..."`, "= "+strconv.Quote(source.Name()), -1)
+		if err := L.DoString(skeleton); err != nil {
+			t.Fatalf("%s: %s\n%s", name, err, skeleton)
+		}
+
+		r := luaResource(L, schema.varName()).(Resource)
+		if err := r.Validate(); err != nil {
+			t.Errorf("%s: %s\n%s", name, err, skeleton)
+		}
+	}
+
+	item, err := LookupProvider("link")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := Describe(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	skeleton := schema.Skeleton()
+	for _, line := range []string{
+		`link.source = "..." -- string, required`,
+		`-- link.state = "present" -- string, default`,
+		`-- link.require = { "..." } -- list of string`,
+	} {
+		if !strings.Contains(skeleton, line+"\n") {
+			t.Errorf("want line %q in skeleton, got %q", line, skeleton)
+		}
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	for _, item := range Providers() {
+		// Providers may not be available on the system
+		r, err := item.Provider("foo")
+		if err != nil {
+			continue
+		}
+
+		if _, err := json.Marshal(Attributes(r)); err != nil {
+			t.Errorf("%s.%s: %s", item.Namespace, item.Type, err)
+		}
+	}
+
+	r, err := NewFile("/tmp/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := r.(*File)
+	f.Content = []byte("foo")
+	f.Require = []string{"pkg[bar]"}
+
+	attrs := Attributes(f)
+	errorIfNotEqual(t, "0644", attrs["mode"])
+	errorIfNotEqual(t, "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", attrs["content"])
+	errorIfNotEqual(t, []string{"pkg[bar]"}, attrs["require"])
+	errorIfNotEqual(t, "present", attrs["state"])
+	if _, ok := attrs["subscribe"]; ok {
+		t.Error("want functions to be left out")
+	}
+
+	r, err = NewKeepalivedVRRP("VI_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.(*KeepalivedVRRP).AuthPass = "secret"
+	errorIfNotEqual(t, redactedValue, Attributes(r)["auth_pass"])
+}
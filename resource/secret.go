@@ -0,0 +1,601 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// SecretBackend is the interface type for external sources of
+// secrets, which are referenced from modules using the secret()
+// function, e.g. secret("vault:kv/data/app#db_password").
+type SecretBackend interface {
+	// Secret returns the value of the secret with the given
+	// reference, which is the part following the backend name.
+	// Errors must not contain the value of the secret.
+	Secret(ref string) (string, error)
+}
+
+// EnvSecretBackend resolves secrets from environment
+// variables, e.g. secret("env:DB_PASSWORD").
+type EnvSecretBackend struct{}
+
+// Secret returns the value of an environment variable.
+func (EnvSecretBackend) Secret(ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+
+	return value, nil
+}
+
+// VaultSecretBackend resolves secrets from Vault, using references
+// in the form of "path#field", e.g. "kv/data/app#db_password".
+// The fields of secrets in the KV secrets engine version 2 are
+// looked up in the data of the secret.
+type VaultSecretBackend struct {
+	// Address of the Vault server. Defaults to the
+	// value of the VAULT_ADDR environment variable.
+	Address string
+
+	// Token used to authenticate against Vault. Defaults
+	// to the value of the VAULT_TOKEN environment variable.
+	Token string
+}
+
+// Secret reads a field of a secret from Vault.
+func (b VaultSecretBackend) Secret(ref string) (string, error) {
+	i := strings.LastIndex(ref, "#")
+	if i == -1 {
+		return "", errors.New("expected reference in the form of path#field")
+	}
+	path, field := ref[:i], ref[i+1:]
+
+	config := api.DefaultConfig()
+	if config.Error != nil {
+		return "", config.Error
+	}
+
+	if b.Address != "" {
+		config.Address = b.Address
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return "", err
+	}
+
+	if b.Token != "" {
+		client.SetToken(b.Token)
+	}
+
+	secret, err := client.Logical().Read(path)
+	if err != nil {
+		return "", err
+	}
+
+	if secret == nil || secret.Data == nil {
+		return "", fmt.Errorf("secret %s not found", path)
+	}
+
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	switch value := data[field].(type) {
+	case string:
+		return value, nil
+	case nil:
+		return "", fmt.Errorf("secret %s has no field %s", path, field)
+	default:
+		return "", fmt.Errorf("field %s of secret %s is not a string", field, path)
+	}
+}
+
+// FileSecretBackend resolves secrets from a local file, which contains
+// a JSON object of secret names and values encrypted with AES-256-GCM,
+// e.g. secret("file:db_password"). The encryption key is derived from
+// the contents of a key file, which should only be readable by root.
+// Files can be created using SealSecrets.
+type FileSecretBackend struct {
+	// Path to the encrypted file
+	Path string
+
+	// Path to the file containing the encryption key
+	KeyFile string
+
+	once    sync.Once
+	secrets map[string]string
+	err     error
+}
+
+// Secret returns the value of a secret from the encrypted file,
+// which is decrypted once when the first secret is resolved.
+func (b *FileSecretBackend) Secret(ref string) (string, error) {
+	b.once.Do(func() {
+		b.secrets, b.err = b.open()
+	})
+
+	if b.err != nil {
+		return "", b.err
+	}
+
+	value, ok := b.secrets[ref]
+	if !ok {
+		return "", fmt.Errorf("secret %s not found in %s", ref, b.Path)
+	}
+
+	return value, nil
+}
+
+// open decrypts the file containing the secrets.
+func (b *FileSecretBackend) open() (map[string]string, error) {
+	key, err := ioutil.ReadFile(b.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(b.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := secretCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid secrets file %s", b.Path)
+	}
+
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt secrets file %s", b.Path)
+	}
+
+	var secrets map[string]string
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("invalid secrets file %s", b.Path)
+	}
+
+	return secrets, nil
+}
+
+// SealSecrets encrypts the given secrets using a key, e.g. the contents
+// of a key file, in the format read by the FileSecretBackend.
+func SealSecrets(key []byte, secrets map[string]string) ([]byte, error) {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := secretCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+// secretCipher creates the AES-256-GCM cipher for the given key,
+// which may contain trailing whitespace, e.g. a newline.
+func secretCipher(key []byte) (cipher.AEAD, error) {
+	key = []byte(strings.TrimSpace(string(key)))
+	if len(key) == 0 {
+		return nil, errors.New("empty encryption key")
+	}
+
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// DefaultSecretBackends returns the secret backends, which need no
+// configuration, i.e. the "env" backend and the "vault" backend
+// using the VAULT_ADDR and VAULT_TOKEN environment variables.
+func DefaultSecretBackends() map[string]SecretBackend {
+	return map[string]SecretBackend{
+		"env":   EnvSecretBackend{},
+		"vault": VaultSecretBackend{},
+	}
+}
+
+// secretPattern matches the placeholders returned by the secret()
+// function, which are replaced by the values of the secrets once
+// the module has been loaded.
+var secretPattern = regexp.MustCompile("\x00secret:([0-9]+)\x00")
+
+// Secrets type keeps track of the secrets used by the resources
+// during a run, so that their values can be redacted.
+type Secrets struct {
+	sync.RWMutex
+
+	// Backends used to resolve secrets, keyed by their name
+	backends map[string]SecretBackend
+
+	// References of the secrets, indexed by their placeholders
+	refs []string
+
+	// Values of the resolved secrets, keyed by their references
+	values map[string]string
+
+	// Names of the attributes using secrets, keyed by resource id
+	sensitive map[string]map[string]bool
+}
+
+// NewSecrets creates a new set of secrets resolved
+// using the given backends.
+func NewSecrets(backends map[string]SecretBackend) *Secrets {
+	s := &Secrets{
+		backends:  backends,
+		refs:      make([]string, 0),
+		values:    make(map[string]string),
+		sensitive: make(map[string]map[string]bool),
+	}
+
+	return s
+}
+
+// Placeholder returns the placeholder for a secret, which is assigned to
+// attributes in place of its value until the secret has been resolved.
+func (s *Secrets) Placeholder(ref string) string {
+	s.Lock()
+	defer s.Unlock()
+
+	s.refs = append(s.refs, ref)
+
+	return fmt.Sprintf("\x00secret:%d\x00", len(s.refs)-1)
+}
+
+// Resolve replaces the placeholders of secrets in the attributes of a
+// resource with the values of the secrets, and marks these attributes as
+// sensitive. Errors name the attribute and the secret reference, but
+// never any part of the value of the secret.
+func (s *Secrets) Resolve(r Resource) error {
+	v := reflect.ValueOf(r)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	names := make([]string, 0)
+	if err := s.resolveFields(v, &names); err != nil {
+		return fmt.Errorf("%s %s", r.ID(), s.Redact(err.Error()))
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	id := r.ID()
+	if s.sensitive[id] == nil {
+		s.sensitive[id] = make(map[string]bool)
+	}
+	for _, name := range names {
+		s.sensitive[id][name] = true
+	}
+
+	return nil
+}
+
+// resolveFields resolves the secrets in the fields of a struct,
+// including the fields of embedded structs, and records the
+// names of the attributes using secrets.
+func (s *Secrets) resolveFields(v reflect.Value, names *[]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("luar")
+		if tag == "-" || f.PkgPath != "" {
+			continue
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if err := s.resolveFields(v.Field(i), names); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = strings.ToLower(f.Name[:1]) + f.Name[1:]
+		}
+
+		value, found, err := s.resolveValue(v.Field(i))
+		if err != nil {
+			return fmt.Errorf("attribute %s: %s", name, err)
+		}
+
+		if found {
+			v.Field(i).Set(value)
+			*names = append(*names, name)
+		}
+	}
+
+	return nil
+}
+
+// resolveValue returns the given value with the placeholders of secrets
+// replaced, and a boolean indicating whether any placeholders were found.
+// Strings are replaced, while slices and maps are updated in place.
+func (s *Secrets) resolveValue(v reflect.Value) (reflect.Value, bool, error) {
+	switch v.Kind() {
+	case reflect.String:
+		text, found, err := s.expand(v.String())
+		if err != nil || !found {
+			return v, false, err
+		}
+		return reflect.ValueOf(text).Convert(v.Type()), true, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			text, found, err := s.expand(string(v.Bytes()))
+			if err != nil || !found {
+				return v, false, err
+			}
+			return reflect.ValueOf([]byte(text)).Convert(v.Type()), true, nil
+		}
+
+		found := false
+		for i := 0; i < v.Len(); i++ {
+			elem, ok, err := s.resolveValue(v.Index(i))
+			if err != nil {
+				return v, false, err
+			}
+			if ok {
+				v.Index(i).Set(elem)
+				found = true
+			}
+		}
+		return v, found, nil
+	case reflect.Map:
+		found := false
+		for _, key := range v.MapKeys() {
+			elem, ok, err := s.resolveValue(v.MapIndex(key))
+			if err != nil {
+				return v, false, err
+			}
+			if ok {
+				v.SetMapIndex(key, elem)
+				found = true
+			}
+		}
+		return v, found, nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, false, nil
+		}
+		elem, found, err := s.resolveValue(v.Elem())
+		if err != nil || !found {
+			return v, false, err
+		}
+		value := reflect.New(v.Type()).Elem()
+		value.Set(elem)
+		return value, true, nil
+	}
+
+	return v, false, nil
+}
+
+// expand replaces the placeholders of secrets in text.
+func (s *Secrets) expand(text string) (string, bool, error) {
+	if !strings.Contains(text, "\x00secret:") {
+		return text, false, nil
+	}
+
+	var err error
+	result := secretPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if err != nil {
+			return ""
+		}
+
+		i, _ := strconv.Atoi(secretPattern.FindStringSubmatch(placeholder)[1])
+		s.RLock()
+		ref := ""
+		if i < len(s.refs) {
+			ref = s.refs[i]
+		}
+		s.RUnlock()
+
+		var value string
+		value, err = s.lookup(ref)
+		if err != nil {
+			err = fmt.Errorf("unable to resolve secret %s: %s", ref, err)
+		}
+
+		return value
+	})
+
+	return result, true, err
+}
+
+// lookup returns the value of a secret, which is
+// fetched from its backend only once per run.
+func (s *Secrets) lookup(ref string) (string, error) {
+	s.RLock()
+	value, ok := s.values[ref]
+	s.RUnlock()
+	if ok {
+		return value, nil
+	}
+
+	i := strings.Index(ref, ":")
+	if i == -1 {
+		return "", errors.New("expected reference in the form of backend:ref")
+	}
+
+	backend, ok := s.backends[ref[:i]]
+	if !ok {
+		return "", fmt.Errorf("unknown secret backend %s", ref[:i])
+	}
+
+	value, err := backend.Secret(ref[i+1:])
+	if err != nil {
+		return "", err
+	}
+
+	s.Lock()
+	s.values[ref] = value
+	s.Unlock()
+
+	return value, nil
+}
+
+// IsSensitive returns a boolean indicating whether the
+// attribute with the given name of a resource uses secrets.
+func (s *Secrets) IsSensitive(r Resource, name string) bool {
+	if s == nil {
+		return false
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.sensitive[r.ID()][name]
+}
+
+// Redact replaces the values of the resolved secrets in text,
+// e.g. in log messages or errors, with a placeholder.
+func (s *Secrets) Redact(text string) string {
+	if s == nil {
+		return text
+	}
+
+	s.RLock()
+	values := make([]string, 0, len(s.values))
+	for _, value := range s.values {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	s.RUnlock()
+
+	// Longer values first, so that secrets containing
+	// other secrets are redacted as a whole
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+
+	for _, value := range values {
+		text = strings.Replace(text, value, redactedValue, -1)
+	}
+
+	return text
+}
+
+// RedactError returns an error with the values of the
+// resolved secrets in its message redacted.
+func (s *Secrets) RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if msg := s.Redact(err.Error()); msg != err.Error() {
+		return errors.New(msg)
+	}
+
+	return err
+}
+
+// Writer returns a writer, which redacts the values of the
+// resolved secrets before writing to w, e.g. for logging.
+func (s *Secrets) Writer(w io.Writer) io.Writer {
+	return &redactWriter{w: w, secrets: s}
+}
+
+// redactWriter type redacts the values of secrets from the
+// data written to the underlying writer.
+type redactWriter struct {
+	w       io.Writer
+	secrets *Secrets
+}
+
+// Write writes p to the underlying writer with secrets redacted.
+func (rw *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, rw.secrets.Redact(string(p))); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Secret returns a value referencing a secret from one of the
+// secret backends, e.g. secret("vault:kv/data/app#db_password"),
+// which can be used in any attribute of a resource. Secrets are
+// resolved once the module has been loaded, and the attributes
+// using them are redacted in logs, diffs and the state file.
+func Secret(ref string) string {
+	if DefaultConfig.Secrets == nil {
+		DefaultConfig.Secrets = NewSecrets(DefaultSecretBackends())
+	}
+
+	return DefaultConfig.Secrets.Placeholder(ref)
+}
+
+func init() {
+	secret := FunctionItem{
+		Name:     "secret",
+		Function: Secret,
+	}
+
+	RegisterFunction(secret)
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSecretBackend type resolves secrets from a map.
+type fakeSecretBackend map[string]string
+
+func (b fakeSecretBackend) Secret(ref string) (string, error) {
+	value, ok := b[ref]
+	if !ok {
+		return "", errors.New("not found")
+	}
+
+	return value, nil
+}
+
+func TestSecrets(t *testing.T) {
+	defaultSecrets := DefaultConfig.Secrets
+	defer func() { DefaultConfig.Secrets = defaultSecrets }()
+
+	secrets := NewSecrets(map[string]SecretBackend{
+		"fake": fakeSecretBackend{"app#password": "s3cr3t", "app#user": "admin"},
+	})
+	DefaultConfig.Secrets = secrets
+
+	L := newLuaState()
+	defer L.Close()
+
+	code := `
+	conf = resource.file.new("/etc/app.conf")
+	conf.content = "user=" .. secret("fake:app#user") .. "\npassword=" .. secret("fake:app#password") .. "\n"
+	conf.mode = 384
+
+	db = resource.shell.new("create db")
+	db.command = "createuser -p " .. secret("fake:app#password")
+	db.rescue = "echo " .. secret("fake:app#password")
+
+	missing = resource.shell.new("missing")
+	missing.command = secret("fake:app#token")
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := luaResource(L, "conf").(*File)
+	if err := secrets.Resolve(conf); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "user=admin\npassword=s3cr3t\n", string(conf.Content))
+
+	db := luaResource(L, "db").(*Shell)
+	if err := secrets.Resolve(db); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "createuser -p s3cr3t", db.Command)
+	errorIfNotEqual(t, "echo s3cr3t", db.Rescue)
+
+	// Attributes using secrets are redacted
+	attrs := Attributes(db)
+	errorIfNotEqual(t, redactedValue, attrs["command"])
+	errorIfNotEqual(t, redactedValue, attrs["rescue"])
+	errorIfNotEqual(t, "present", attrs["state"])
+	errorIfNotEqual(t, redactedValue, Attributes(conf)["content"])
+	errorIfNotEqual(t, "0600", Attributes(conf)["mode"])
+
+	errorIfNotEqual(t, "password <redacted> for user <redacted>", secrets.Redact("password s3cr3t for user admin"))
+
+	var buf strings.Builder
+	secrets.Writer(&buf).Write([]byte("running createuser -p s3cr3t\n"))
+	errorIfNotEqual(t, "running createuser -p <redacted>\n", buf.String())
+
+	// Errors name the resource and attribute
+	missing := luaResource(L, "missing").(*Shell)
+	err := secrets.Resolve(missing)
+	errorIfNotEqual(t, "shell[missing] attribute command: unable to resolve secret fake:app#token: not found", err.Error())
+}
+
+func TestSecretBackends(t *testing.T) {
+	os.Setenv("GRU_TEST_SECRET", "from-env")
+	defer os.Unsetenv("GRU_TEST_SECRET")
+
+	dir, err := ioutil.TempDir("", "gru-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("passphrase\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := SealSecrets([]byte("passphrase"), map[string]string{"db_password": "from-file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "secrets")
+	if err := ioutil.WriteFile(path, sealed, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	backends := DefaultSecretBackends()
+	backends["file"] = &FileSecretBackend{Path: path, KeyFile: keyFile}
+	secrets := NewSecrets(backends)
+
+	testCases := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{"env:GRU_TEST_SECRET", "from-env", ""},
+		{"env:GRU_TEST_MISSING", "", "environment variable GRU_TEST_MISSING is not set"},
+		{"file:db_password", "from-file", ""},
+		{"file:api_token", "", "secret api_token not found in " + path},
+		{"vault:kv/data/app", "", "expected reference in the form of path#field"},
+		{"unknown:foo", "", "unknown secret backend unknown"},
+		{"foo", "", "expected reference in the form of backend:ref"},
+	}
+
+	for _, tc := range testCases {
+		got, err := secrets.lookup(tc.ref)
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("%s: want error %q, got %v", tc.ref, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tc.ref, err)
+		}
+		errorIfNotEqual(t, tc.want, got)
+	}
+
+	// A wrong key does not decrypt the file
+	if err := ioutil.WriteFile(keyFile, []byte("wrong"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backend := &FileSecretBackend{Path: path, KeyFile: keyFile}
+	if _, err := backend.Secret("db_password"); err == nil {
+		t.Error("want error for wrong key")
+	}
+}
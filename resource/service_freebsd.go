@@ -101,31 +101,42 @@ func (s *Service) Evaluate() (State, error) {
 
 // Create starts the service.
 func (s *Service) Create() error {
-	Logf("%s starting service\n", s.ID())
+	s.Printf("starting service\n")
 
 	return exec.Command("service", s.Name, "onestart").Run()
 }
 
 // Delete stops the service.
 func (s *Service) Delete() error {
-	Logf("%s stopping service\n", s.ID())
+	s.Printf("stopping service\n")
 
 	return exec.Command("service", s.Name, "onestop").Run()
 }
 
+// isEnabled checks whether the service is enabled during boot-time.
+func (s *Service) isEnabled() bool {
+	err := exec.Command("service", s.Name, "enabled").Run()
+
+	return err == nil
+}
+
 // isEnableSynced checks whether the service is in the desired state.
 func (s *Service) isEnableSynced() (bool, error) {
-	var enabled bool
+	return s.isEnabled() == s.Enable, nil
+}
 
-	err := exec.Command("service", s.Name, "enabled").Run()
-	switch err {
-	case nil:
-		enabled = true
-	default:
-		enabled = false
+// Import sets the state of the resource to whether the service
+// is running, and whether it is enabled during boot-time.
+func (s *Service) Import() error {
+	state, err := s.Evaluate()
+	if err != nil {
+		return err
 	}
 
-	return enabled == s.Enable, nil
+	s.State = state.Current
+	s.Enable = s.isEnabled()
+
+	return nil
 }
 
 // setEnable enables or disables the service during boot-time.
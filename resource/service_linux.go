@@ -130,7 +130,7 @@ func (s *Service) Evaluate() (State, error) {
 
 // Create starts the service.
 func (s *Service) Create() error {
-	Logf("%s starting service\n", s.ID())
+	s.Printf("starting service\n")
 
 	ch := make(chan string)
 	jobID, err := s.conn.StartUnit(s.unit, "replace", ch)
@@ -139,14 +139,14 @@ func (s *Service) Create() error {
 	}
 
 	result := <-ch
-	Logf("%s systemd job id %d result: %s\n", s.ID(), jobID, result)
+	s.Printf("systemd job id %d result: %s\n", jobID, result)
 
 	return nil
 }
 
 // Delete stops the service.
 func (s *Service) Delete() error {
-	Logf("%s stopping service\n", s.ID())
+	s.Printf("stopping service\n")
 
 	ch := make(chan string)
 	jobID, err := s.conn.StopUnit(s.unit, "replace", ch)
@@ -155,7 +155,7 @@ func (s *Service) Delete() error {
 	}
 
 	result := <-ch
-	Logf("%s systemd job id %d result: %s\n", s.ID(), jobID, result)
+	s.Printf("systemd job id %d result: %s\n", jobID, result)
 
 	return nil
 }
@@ -169,7 +169,7 @@ func (s *Service) Close() error {
 
 // enableUnit enables the service unit during boot-time
 func (s *Service) enableUnit() error {
-	Logf("%s enabling service\n", s.ID())
+	s.Printf("enabling service\n")
 
 	units := []string{s.unit}
 	_, changes, err := s.conn.EnableUnitFiles(units, false, false)
@@ -178,7 +178,7 @@ func (s *Service) enableUnit() error {
 	}
 
 	for _, change := range changes {
-		Logf("%s %s %s -> %s\n", s.ID(), change.Type, change.Filename, change.Destination)
+		s.Printf("%s %s -> %s\n", change.Type, change.Filename, change.Destination)
 	}
 
 	return nil
@@ -186,7 +186,7 @@ func (s *Service) enableUnit() error {
 
 // disableUnit disables the service unit during boot-time
 func (s *Service) disableUnit() error {
-	Logf("%s disabling service\n", s.ID())
+	s.Printf("disabling service\n")
 
 	units := []string{s.unit}
 	changes, err := s.conn.DisableUnitFiles(units, false)
@@ -195,35 +195,61 @@ func (s *Service) disableUnit() error {
 	}
 
 	for _, change := range changes {
-		Logf("%s %s %s\n", s.ID(), change.Type, change.Filename)
+		s.Printf("%s %s\n", change.Type, change.Filename)
 	}
 
 	return nil
 }
 
-// isEnableSynced determines whether the property is synced.
-func (s *Service) isEnableSynced() (bool, error) {
+// isEnabled determines whether the service unit is enabled during boot-time.
+func (s *Service) isEnabled() (bool, error) {
 	unitState, err := s.conn.GetUnitProperty(s.unit, "UnitFileState")
 	if err != nil {
 		return false, err
 	}
 
-	var enabled bool
 	value := unitState.Value.Value().(string)
 	switch value {
 	case "enabled", "static", "enabled-runtime", "linked", "linked-runtime":
-		enabled = true
+		return true, nil
 	case "disabled", "masked", "masked-runtime":
-		enabled = false
+		return false, nil
 	case "invalid":
 		fallthrough
 	default:
 		return false, errors.New("Invalid unit state")
 	}
+}
+
+// isEnableSynced determines whether the property is synced.
+func (s *Service) isEnableSynced() (bool, error) {
+	enabled, err := s.isEnabled()
+	if err != nil {
+		return false, err
+	}
 
 	return s.Enable == enabled, nil
 }
 
+// Import sets the state of the resource to whether the service
+// is running, and whether it is enabled during boot-time.
+func (s *Service) Import() error {
+	state, err := s.Evaluate()
+	if err != nil {
+		return err
+	}
+
+	enabled, err := s.isEnabled()
+	if err != nil {
+		return err
+	}
+
+	s.State = state.Current
+	s.Enable = enabled
+
+	return nil
+}
+
 // setEnable sets the property to it's desired state.
 func (s *Service) setEnable() error {
 	var action func() error
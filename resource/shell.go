@@ -26,6 +26,8 @@
 package resource
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"strings"
@@ -48,6 +50,26 @@ import (
 //   sh = resource.shell.new("creates the /tmp/foo file")
 //   sh.command = "/usr/bin/touch /tmp/foo"
 //   sh.creates = "/tmp/foo"
+//
+// Commands modifying files managed by other resources should
+// invalidate them, so that the resources see the changes.
+//
+// Example:
+//   sh = resource.shell.new("/usr/sbin/update-ca-certificates")
+//   sh.invalidates = { "/etc/ssl/certs" }
+//
+// Commands which should be executed only when other resources have
+// changed, e.g. migrations after upgrading a package, are marked as
+// refresh only and subscribe to the resources which notify them.
+// Idempotency is then delegated to the subscribed resources.
+//
+// Example:
+//   pkg = resource.package.new("myapp")
+//   pkg.version = "2.1.0"
+//
+//   sh = resource.shell.new("/usr/bin/myapp-migrate")
+//   sh.refresh_only = true
+//   sh.subscribe[pkg:ID()] = function() end
 type Shell struct {
 	Base
 
@@ -60,6 +82,17 @@ type Shell struct {
 	// Mute flag indicates whether output from the command should be
 	// dislayed or suppressed
 	Mute bool `luar:"mute"`
+
+	// Invalidates lists the paths modified by the command, for which
+	// any cached data is invalidated after the command has been
+	// executed. Directories invalidate all files below them, so
+	// "/" invalidates everything.
+	Invalidates []string `luar:"invalidates"`
+
+	// RefreshOnly specifies whether the command is executed only
+	// when any of the resources it subscribes to have changed,
+	// instead of on every run.
+	RefreshOnly bool `luar:"refresh_only"`
 }
 
 // NewShell creates a new resource for executing shell commands
@@ -83,6 +116,42 @@ func NewShell(name string) (Resource, error) {
 	return s, nil
 }
 
+// Validate validates the resource
+func (s *Shell) Validate() error {
+	if err := s.Base.Validate(); err != nil {
+		return err
+	}
+
+	if s.RefreshOnly && len(s.Subscribe) == 0 {
+		return errors.New("refresh only commands must subscribe to other resources")
+	}
+
+	return nil
+}
+
+// IsRefreshOnly returns a boolean indicating whether the command
+// is executed only when any of the resources it subscribes to have changed.
+func (s *Shell) IsRefreshOnly() bool {
+	return s.RefreshOnly
+}
+
+// Guards returns the guard of the command, which is executed
+// only if the file it creates does not exist yet.
+func (s *Shell) Guards() ([]Guard, error) {
+	if s.Creates == "" {
+		return nil, nil
+	}
+
+	_, err := os.Stat(s.Creates)
+	guard := Guard{
+		Name:      "creates",
+		Condition: fmt.Sprintf("file %s does not exist", s.Creates),
+		Passed:    os.IsNotExist(err),
+	}
+
+	return []Guard{guard}, nil
+}
+
 // Evaluate evaluates the state of the resource
 func (s *Shell) Evaluate() (State, error) {
 	// Assumes that the command to be executed is idempotent
@@ -112,15 +181,20 @@ func (s *Shell) Evaluate() (State, error) {
 
 // Create executes the shell command
 func (s *Shell) Create() error {
-	Logf("%s executing command\n", s.ID())
+	s.Printf("executing command\n")
 
 	args := strings.Fields(s.Command)
 	cmd := exec.Command(args[0], args[1:]...)
 	out, err := cmd.CombinedOutput()
 
+	// The command may have modified files even if it failed
+	for _, path := range s.Invalidates {
+		DefaultConfig.InvalidatePath(path)
+	}
+
 	if !s.Mute {
 		for _, line := range strings.Split(string(out), "\n") {
-			Logf("%s %s\n", s.ID(), line)
+			s.Printf("%s\n", line)
 		}
 	}
 
@@ -25,7 +25,18 @@
 
 package resource
 
-import "testing"
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dnaeon/gru/utils"
+	"github.com/yuin/gopher-lua"
+)
 
 func TestShell(t *testing.T) {
 	L := newLuaState()
@@ -52,3 +63,99 @@ func TestShell(t *testing.T) {
 	errorIfNotEqual(t, "touch /tmp/foo", sh.Command)
 	errorIfNotEqual(t, "/tmp/foo", sh.Creates)
 }
+
+func TestShellInvalidates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-shell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var logs bytes.Buffer
+	defaultConfig := DefaultConfig
+	DefaultConfig = &Config{
+		Logger:    log.New(&logs, "", 0),
+		FileCache: utils.NewFileCache(),
+	}
+	defer func() { DefaultConfig = defaultConfig }()
+
+	// Rewrites the file keeping its size and modification
+	// time, which is not detected by the cache on its own
+	path := filepath.Join(dir, "foo")
+	mtime := time.Unix(1500000000, 0)
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := r.(*File)
+	f.Content = []byte("foo")
+
+	write("foo")
+	synced, err := f.isContentSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	r, err = NewShell("true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh := r.(*Shell)
+	sh.Invalidates = []string{dir}
+
+	write("bar")
+	synced, err = f.isContentSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	if err := sh.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	synced, err = f.isContentSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+}
+
+func TestShellRefreshOnly(t *testing.T) {
+	L := newLuaState()
+	defer L.Close()
+
+	const code = `
+	pkg = resource.file.new("/etc/myapp.conf")
+	sh = resource.shell.new("/usr/bin/myapp-migrate")
+	sh.refresh_only = true
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	sh := luaResource(L, "sh").(*Shell)
+	errorIfNotEqual(t, true, sh.IsRefreshOnly())
+
+	if err := sh.Validate(); err == nil {
+		t.Error("want error for refresh only command without subscriptions")
+	}
+
+	pkg := luaResource(L, "pkg").(*File)
+	sh.Subscribe[pkg.ID()] = L.NewFunction(func(L *lua.LState) int { return 0 })
+
+	if err := sh.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,476 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build linux
+
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// Paths to the files used for evaluating the state of swap
+const (
+	swapsPath = "/proc/swaps"
+	fstabPath = "/etc/fstab"
+)
+
+// Swap type is a resource which manages swap files and partitions
+// on a GNU/Linux system.
+//
+// A swap file is allocated and formatted if it does not exist.
+// Existing swap files and partitions are formatted only if they
+// do not contain a swap signature already. The swap is
+// enabled and an entry for it is added to /etc/fstab, so that
+// it is enabled during boot-time as well.
+//
+// Example:
+//   swap = resource.swap.new("/swapfile")
+//   swap.state = "present"
+//   swap.size = "2G"
+//   swap.priority = 10
+type Swap struct {
+	Base
+
+	// Path to the swap file or partition.
+	// Defaults to the resource name.
+	Path string `luar:"path"`
+
+	// Size of the swap file, e.g. "512M" or "2G".
+	// Ignored for swap partitions.
+	Size string `luar:"size"`
+
+	// Priority of the swap. Defaults to -1, which
+	// leaves the priority to be set by the kernel.
+	Priority int `luar:"priority"`
+
+	// Fstab is the path to the fstab file.
+	// Defaults to /etc/fstab.
+	Fstab string `luar:"fstab"`
+
+	// The size of the swap file in bytes
+	size int64 `luar:"-"`
+
+	// Path to the file listing the active swaps
+	swaps string `luar:"-"`
+}
+
+// NewSwap creates a new resource for managing swap.
+func NewSwap(name string) (Resource, error) {
+	s := &Swap{
+		Base: Base{
+			Name:              name,
+			Type:              "swap",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        false,
+			Subscribe:         make(TriggerMap),
+		},
+		Path:     name,
+		Priority: -1,
+		Fstab:    fstabPath,
+		swaps:    swapsPath,
+	}
+
+	s.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "size",
+			PropertySetFunc:      s.setSize,
+			PropertyIsSyncedFunc: s.isSizeSynced,
+		},
+	}
+
+	return s, nil
+}
+
+// Validate validates the resource.
+func (s *Swap) Validate() error {
+	if err := s.Base.Validate(); err != nil {
+		return err
+	}
+
+	if s.Path == "" {
+		return errors.New("must provide path to swap")
+	}
+
+	if s.Size != "" {
+		size, err := parseSwapSize(s.Size)
+		if err != nil {
+			return err
+		}
+		s.size = size
+	}
+
+	if s.Priority < -1 || s.Priority > 32767 {
+		return fmt.Errorf("invalid priority %d", s.Priority)
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the swap. The swap is
+// considered present, if it is active and has an entry in fstab.
+func (s *Swap) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    s.State,
+	}
+
+	active, err := s.isActive()
+	if err != nil {
+		return state, err
+	}
+
+	persistent, err := s.inFstab()
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "absent"
+	if active && persistent {
+		state.Current = "present"
+	}
+
+	return state, nil
+}
+
+// Create allocates, formats and enables the swap.
+func (s *Swap) Create() error {
+	s.Printf("creating swap\n")
+
+	_, err := os.Stat(s.Path)
+	switch {
+	case os.IsNotExist(err):
+		if err := s.allocate(); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		if err := s.format(); err != nil {
+			return err
+		}
+	}
+
+	active, err := s.isActive()
+	if err != nil {
+		return err
+	}
+
+	if !active {
+		if err := s.enable(); err != nil {
+			return err
+		}
+	}
+
+	persistent, err := s.inFstab()
+	if err != nil {
+		return err
+	}
+
+	if !persistent {
+		s.Printf("adding swap to %s\n", s.Fstab)
+		return s.updateFstab(true)
+	}
+
+	return nil
+}
+
+// Delete disables the swap and removes it from fstab.
+// Swap files are removed as well.
+func (s *Swap) Delete() error {
+	s.Printf("removing swap\n")
+
+	active, err := s.isActive()
+	if err != nil {
+		return err
+	}
+
+	if active {
+		if err := s.run("swapoff", s.Path); err != nil {
+			return err
+		}
+	}
+
+	s.Printf("removing swap from %s\n", s.Fstab)
+	if err := s.updateFstab(false); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	return os.Remove(s.Path)
+}
+
+// isSizeSynced checks whether the swap file is of the desired size.
+func (s *Swap) isSizeSynced() (bool, error) {
+	fi, err := os.Stat(s.Path)
+	if os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	// Size is managed only for swap files
+	if s.Size == "" || !fi.Mode().IsRegular() {
+		return true, nil
+	}
+
+	return fi.Size() == s.size, nil
+}
+
+// setSize re-creates the swap file with the desired size.
+func (s *Swap) setSize() error {
+	s.Printf("resizing swap file to %s\n", s.Size)
+
+	active, err := s.isActive()
+	if err != nil {
+		return err
+	}
+
+	if active {
+		if err := s.run("swapoff", s.Path); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(s.Path); err != nil {
+		return err
+	}
+
+	if err := s.allocate(); err != nil {
+		return err
+	}
+
+	return s.enable()
+}
+
+// allocate allocates and formats the swap file. Space is allocated
+// using fallocate(1), falling back to dd(1) for filesystems which
+// do not support swap files allocated by fallocate(1).
+func (s *Swap) allocate() error {
+	if s.Size == "" {
+		return errors.New("must provide size of swap file")
+	}
+
+	s.Printf("allocating %s for swap file\n", s.Size)
+
+	size := strconv.FormatInt(s.size, 10)
+	if err := s.run("fallocate", "-l", size, s.Path); err != nil {
+		s.Printf("unable to allocate using fallocate, falling back to dd: %s\n", err)
+
+		// Remove any partially allocated file
+		os.Remove(s.Path)
+
+		count := strconv.FormatInt((s.size+(1<<20)-1)>>20, 10)
+		if err := s.run("dd", "if=/dev/zero", "of="+s.Path, "bs=1M", "count="+count); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Chmod(s.Path, 0600); err != nil {
+		return err
+	}
+
+	return s.run("mkswap", s.Path)
+}
+
+// format formats an existing swap file or partition,
+// unless it already contains a swap signature.
+func (s *Swap) format() error {
+	spec := utils.CommandSpec{Args: []string{"blkid", "-o", "value", "-s", "TYPE", s.Path}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err == nil && strings.TrimSpace(string(result.Stdout)) == "swap" {
+		return nil
+	}
+
+	return s.run("mkswap", s.Path)
+}
+
+// enable enables the swap.
+func (s *Swap) enable() error {
+	args := []string{s.Path}
+	if s.Priority >= 0 {
+		args = []string{"-p", strconv.Itoa(s.Priority), s.Path}
+	}
+
+	return s.run("swapon", args...)
+}
+
+// run executes a command and logs any error output.
+func (s *Swap) run(name string, args ...string) error {
+	spec := utils.CommandSpec{Args: append([]string{name}, args...)}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("%s failed: %s: %s", name, err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+// isActive returns a boolean indicating whether the swap is active.
+func (s *Swap) isActive() (bool, error) {
+	content, err := ioutil.ReadFile(s.swaps)
+	if err != nil {
+		return false, err
+	}
+
+	// Skip the header line
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[0] == s.Path {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// inFstab returns a boolean indicating whether
+// an entry for the swap exists in fstab.
+func (s *Swap) inFstab() (bool, error) {
+	content, err := ioutil.ReadFile(s.Fstab)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if s.isFstabEntry(line) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// isFstabEntry returns a boolean indicating whether
+// the fstab line is an entry for the swap.
+func (s *Swap) isFstabEntry(line string) bool {
+	fields := strings.Fields(line)
+
+	return len(fields) >= 3 && fields[0] == s.Path && fields[2] == "swap"
+}
+
+// updateFstab adds or removes the entry for the swap in fstab.
+// Any other entries are preserved as is.
+func (s *Swap) updateFstab(add bool) error {
+	content, err := ioutil.ReadFile(s.Fstab)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	lines := make([]string, 0)
+	if len(content) > 0 {
+		for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+			if !s.isFstabEntry(line) {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	if add {
+		options := "sw"
+		if s.Priority >= 0 {
+			options = fmt.Sprintf("sw,pri=%d", s.Priority)
+		}
+		lines = append(lines, fmt.Sprintf("%s none swap %s 0 0", s.Path, options))
+	}
+
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(s.Fstab); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	return writeFile(s.Fstab, []byte(strings.Join(lines, "\n")+"\n"), mode)
+}
+
+// parseSwapSize parses a size such as "512M" or "2G"
+// and returns the size in bytes.
+func parseSwapSize(size string) (int64, error) {
+	units := map[byte]uint{
+		'K': 10,
+		'M': 20,
+		'G': 30,
+		'T': 40,
+	}
+
+	value := strings.ToUpper(strings.TrimSpace(size))
+	value = strings.TrimSuffix(value, "B")
+	shift := uint(0)
+	if len(value) > 0 {
+		if s, ok := units[value[len(value)-1]]; ok {
+			shift = s
+			value = value[:len(value)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 || n > (1<<62)>>shift {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+
+	return n << shift, nil
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "swap",
+		Provider:  NewSwap,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build linux
+
+package resource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+const swapsHeader = "Filename\t\t\t\tType\t\tSize\tUsed\tPriority\n"
+
+func TestSwap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-swap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	swaps := filepath.Join(dir, "swaps")
+	fstab := filepath.Join(dir, "fstab")
+	rootEntry := "/dev/sda1 / ext4 defaults 0 1\n"
+	if err := ioutil.WriteFile(swaps, []byte(swapsHeader), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(fstab, []byte(rootEntry), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake the commands being executed
+	var commands []string
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		path := spec.Args[len(spec.Args)-1]
+		switch spec.Args[0] {
+		case "fallocate":
+			return utils.CommandResult{}, ioutil.WriteFile(path, make([]byte, 4096), 0644)
+		case "swapon":
+			return utils.CommandResult{}, ioutil.WriteFile(swaps, []byte(swapsHeader+path+"\tfile\t4\t0\t5\n"), 0644)
+		case "swapoff":
+			return utils.CommandResult{}, ioutil.WriteFile(swaps, []byte(swapsHeader), 0644)
+		}
+
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	path := filepath.Join(dir, "swapfile")
+	r, err := NewSwap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := r.(*Swap)
+	s.Size = "4K"
+	s.Priority = 5
+	s.Fstab = fstab
+	s.swaps = swaps
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := s.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := s.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"fallocate -l 4096 " + path,
+		"mkswap " + path,
+		"swapon -p 5 " + path,
+	}
+	errorIfNotEqual(t, want, commands)
+
+	content, err := ioutil.ReadFile(fstab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, rootEntry+path+" none swap sw,pri=5 0 0\n", string(content))
+
+	state, err = s.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+
+	synced, err := s.isSizeSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	s.Size = "8K"
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	synced, err = s.isSizeSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, false, synced)
+
+	commands = nil
+	if err := s.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, []string{"swapoff " + path}, commands)
+
+	content, err = ioutil.ReadFile(fstab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, rootEntry, string(content))
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("swap file should be removed")
+	}
+}
+
+func TestParseSwapSize(t *testing.T) {
+	testCases := []struct {
+		size string
+		want int64
+		err  bool
+	}{
+		{"4096", 4096, false},
+		{"512M", 512 << 20, false},
+		{"2G", 2 << 30, false},
+		{"2gb", 2 << 30, false},
+		{"1T", 1 << 40, false},
+		{"0", 0, true},
+		{"-1G", 0, true},
+		{"G", 0, true},
+		{"lots", 0, true},
+	}
+
+	for _, tc := range testCases {
+		got, err := parseSwapSize(tc.size)
+		if tc.err != (err != nil) {
+			t.Errorf("size %q: want error %t, got %v", tc.size, tc.err, err)
+			continue
+		}
+
+		if got != tc.want {
+			t.Errorf("size %q: want %d, got %d", tc.size, tc.want, got)
+		}
+	}
+}
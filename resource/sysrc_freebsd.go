@@ -95,21 +95,21 @@ func (s *SysRC) Evaluate() (State, error) {
 
 // Create adds variable to rc.conf.
 func (s *SysRC) Create() error {
-	Logf("%s adding rcvar\n", s.ID())
+	s.Printf("adding rcvar\n")
 
 	return exec.Command("sysrc", fmt.Sprintf("%s=%s", s.Name, s.Value)).Run()
 }
 
 // Delete removes variable from rc.conf.
 func (s *SysRC) Delete() error {
-	Logf("%s removing rcvar\n", s.ID())
+	s.Printf("removing rcvar\n")
 
 	return exec.Command("sysrc", "-x", s.Name).Run()
 }
 
 // Update sets variable in rc.conf to s.Value.
 func (s *SysRC) Update() error {
-	Logf("%s setting rcvar to %s\n", s.ID(), s.Value)
+	s.Printf("setting rcvar to %s\n", s.Value)
 
 	return exec.Command("sysrc", fmt.Sprintf("%s=%s", s.Name, s.Value)).Run()
 }
@@ -0,0 +1,252 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/dnaeon/gru/classifier"
+	"github.com/dnaeon/gru/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrOutsideSiteRepo error is returned when a template function
+// attempts to access a path outside of the site repo.
+var ErrOutsideSiteRepo = errors.New("path is outside of the site repo")
+
+// templateFuncMap returns the functions available to templates.
+// Functions accessing files are confined to the given site repo.
+//
+// The following functions are provided.
+//
+// Example:
+//   {{ fact "os" }}
+//   {{ env "HOME" "/root" }}
+//   {{ file "data/snippets/header" }}
+//   {{ .Port | default 8080 }}
+//   {{ .Servers | join ", " }}
+//   {{ split "," "a,b,c" }}
+//   {{ file "data/snippets/body" | indent 4 }}
+//   {{ toJSON .Config }}
+//   {{ toYAML .Config }}
+//   {{ cidrhost "10.0.0.0/24" 5 }}
+//   {{ sha256 "content" }}
+func templateFuncMap(siteRepo string) template.FuncMap {
+	return template.FuncMap{
+		"fact":     templateFact,
+		"env":      templateEnv,
+		"file":     func(path string) (string, error) { return templateFile(siteRepo, path) },
+		"default":  templateDefault,
+		"join":     templateJoin,
+		"split":    templateSplit,
+		"indent":   templateIndent,
+		"toJSON":   templateToJSON,
+		"toYAML":   templateToYAML,
+		"cidrhost": templateCIDRHost,
+		"sha256":   templateSHA256,
+	}
+}
+
+// templateFact returns the value of the classifier with the given key.
+func templateFact(key string) (string, error) {
+	c, err := classifier.Get(key)
+	if err != nil {
+		return "", fmt.Errorf("fact %s: %s", key, err)
+	}
+
+	return c.Value, nil
+}
+
+// templateEnv returns the value of an environment variable, or
+// the optional default value if the variable is not set.
+func templateEnv(name string, def ...string) (string, error) {
+	if len(def) > 1 {
+		return "", fmt.Errorf("env %s: expected at most one default value, got %d", name, len(def))
+	}
+
+	if value, ok := os.LookupEnv(name); ok {
+		return value, nil
+	}
+
+	if len(def) == 1 {
+		return def[0], nil
+	}
+
+	return "", nil
+}
+
+// templateFile returns the content of a file in the site repo.
+func templateFile(siteRepo, path string) (string, error) {
+	resolved, err := utils.SecureJoin(siteRepo, path)
+	if _, ok := err.(*utils.PathEscapeError); ok {
+		return "", fmt.Errorf("file %s: %s", path, ErrOutsideSiteRepo)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(resolved)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// templateDefault returns value, or def if value is empty.
+func templateDefault(def, value interface{}) interface{} {
+	if value == nil {
+		return def
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.String:
+		if v.Len() == 0 {
+			return def
+		}
+	default:
+		if v.IsZero() {
+			return def
+		}
+	}
+
+	return value
+}
+
+// templateJoin joins the elements of a list using sep.
+func templateJoin(sep string, list interface{}) (string, error) {
+	if s, ok := list.([]string); ok {
+		return strings.Join(s, sep), nil
+	}
+
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: expected a list, got %T", list)
+	}
+
+	elems := make([]string, v.Len())
+	for i := range elems {
+		elems[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+
+	return strings.Join(elems, sep), nil
+}
+
+// templateSplit splits s into a list using sep.
+func templateSplit(sep, s string) []string {
+	if s == "" {
+		return []string{}
+	}
+
+	return strings.Split(s, sep)
+}
+
+// templateIndent indents each non-empty line of s with n spaces.
+func templateIndent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// templateToJSON returns the JSON encoding of value.
+func templateToJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("toJSON: %s", err)
+	}
+
+	return string(data), nil
+}
+
+// templateToYAML returns the YAML encoding of value.
+func templateToYAML(value interface{}) (string, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("toYAML: %s", err)
+	}
+
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// templateCIDRHost returns the address of the given host number
+// in a network prefix. Negative host numbers are counted
+// backwards from the end of the network.
+func templateCIDRHost(prefix string, num int) (string, error) {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return "", fmt.Errorf("cidrhost: %s", err)
+	}
+
+	ip := network.IP
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+
+	ones, bits := network.Mask.Size()
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+
+	host := big.NewInt(int64(num))
+	if num < 0 {
+		host.Add(host, size)
+	}
+
+	if host.Sign() < 0 || host.Cmp(size) >= 0 {
+		return "", fmt.Errorf("cidrhost: prefix %s has no host number %d", prefix, num)
+	}
+
+	addr := new(big.Int).SetBytes(ip)
+	addr.Add(addr, host)
+
+	// Pad the address back to its original length
+	b := addr.Bytes()
+	result := make(net.IP, len(ip))
+	copy(result[len(result)-len(b):], b)
+
+	return result.String(), nil
+}
+
+// templateSHA256 returns the hex encoded SHA-256 checksum of s.
+func templateSHA256(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
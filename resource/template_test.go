@@ -0,0 +1,267 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// executeTemplate renders text using the template functions
+// confined to the given site repo.
+func executeTemplate(siteRepo, text string, data interface{}) (string, error) {
+	tmpl, err := template.New("test").Funcs(templateFuncMap(siteRepo)).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func TestTemplateFact(t *testing.T) {
+	got, err := templateFact("os")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, runtime.GOOS, got)
+
+	if _, err := templateFact("no-such-fact"); err == nil {
+		t.Error("expected error for unknown fact")
+	}
+}
+
+func TestTemplateEnv(t *testing.T) {
+	os.Setenv("GRU_TEMPLATE_TEST", "foo")
+	defer os.Unsetenv("GRU_TEMPLATE_TEST")
+	os.Unsetenv("GRU_TEMPLATE_UNSET")
+
+	testCases := []struct {
+		name string
+		def  []string
+		want string
+	}{
+		{"GRU_TEMPLATE_TEST", nil, "foo"},
+		{"GRU_TEMPLATE_TEST", []string{"bar"}, "foo"},
+		{"GRU_TEMPLATE_UNSET", nil, ""},
+		{"GRU_TEMPLATE_UNSET", []string{"bar"}, "bar"},
+	}
+
+	for _, tc := range testCases {
+		got, err := templateEnv(tc.name, tc.def...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errorIfNotEqual(t, tc.want, got)
+	}
+
+	if _, err := templateEnv("GRU_TEMPLATE_UNSET", "a", "b"); err == nil {
+		t.Error("expected error for multiple default values")
+	}
+}
+
+func TestTemplateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	site := filepath.Join(dir, "site")
+	snippets := filepath.Join(site, "data", "snippets")
+	if err := os.MkdirAll(snippets, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(snippets, "header"), []byte("header"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(secret, filepath.Join(snippets, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := templateFile(site, "data/snippets/header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "header", got)
+
+	got, err = templateFile(site, "data/snippets/../snippets/header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "header", got)
+
+	for _, path := range []string{secret, "../secret", "data/../../secret", "data/snippets/link"} {
+		if _, err := templateFile(site, path); err == nil || !strings.Contains(err.Error(), ErrOutsideSiteRepo.Error()) {
+			t.Errorf("file %q: expected %q error, got %v", path, ErrOutsideSiteRepo, err)
+		}
+	}
+
+	if _, err := templateFile(site, "data/snippets/missing"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestTemplateDefault(t *testing.T) {
+	testCases := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{nil, "def"},
+		{"", "def"},
+		{0, "def"},
+		{false, "def"},
+		{[]string{}, "def"},
+		{map[string]string{}, "def"},
+		{"foo", "foo"},
+		{1, 1},
+		{true, true},
+		{[]string{"foo"}, []string{"foo"}},
+	}
+
+	for _, tc := range testCases {
+		errorIfNotEqual(t, tc.want, templateDefault("def", tc.value))
+	}
+}
+
+func TestTemplateJoinSplit(t *testing.T) {
+	got, err := templateJoin(", ", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "a, b", got)
+
+	got, err = templateJoin("-", []interface{}{"a", 1, true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "a-1-true", got)
+
+	if _, err := templateJoin(",", "foo"); err == nil {
+		t.Error("expected error when joining a non-list")
+	}
+
+	errorIfNotEqual(t, []string{"a", "b", "c"}, templateSplit(",", "a,b,c"))
+	errorIfNotEqual(t, []string{}, templateSplit(",", ""))
+}
+
+func TestTemplateIndent(t *testing.T) {
+	errorIfNotEqual(t, "  foo\n\n  bar\n", templateIndent(2, "foo\n\nbar\n"))
+	errorIfNotEqual(t, "foo", templateIndent(0, "foo"))
+}
+
+func TestTemplateToJSONYAML(t *testing.T) {
+	value := map[string]interface{}{
+		"name":  "foo",
+		"ports": []int{80, 443},
+	}
+
+	got, err := templateToJSON(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, `{"name":"foo","ports":[80,443]}`, got)
+
+	got, err = templateToYAML(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "name: foo\nports:\n- 80\n- 443", got)
+
+	if _, err := templateToJSON(make(chan int)); err == nil {
+		t.Error("expected error when encoding a channel")
+	}
+}
+
+func TestTemplateCIDRHost(t *testing.T) {
+	testCases := []struct {
+		prefix string
+		num    int
+		want   string
+	}{
+		{"10.0.0.0/24", 0, "10.0.0.0"},
+		{"10.0.0.0/24", 5, "10.0.0.5"},
+		{"10.0.0.0/24", -1, "10.0.0.255"},
+		{"10.0.0.17/28", 3, "10.0.0.19"},
+		{"10.0.0.0/16", 300, "10.0.1.44"},
+		{"fd00::/64", 1, "fd00::1"},
+		{"fd00::/120", -2, "fd00::fe"},
+	}
+
+	for _, tc := range testCases {
+		got, err := templateCIDRHost(tc.prefix, tc.num)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errorIfNotEqual(t, tc.want, got)
+	}
+
+	for _, num := range []int{256, -257} {
+		if _, err := templateCIDRHost("10.0.0.0/24", num); err == nil {
+			t.Errorf("expected error for host number %d", num)
+		}
+	}
+
+	if _, err := templateCIDRHost("10.0.0.0", 1); err == nil {
+		t.Error("expected error for invalid prefix")
+	}
+}
+
+func TestTemplateSHA256(t *testing.T) {
+	want := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	errorIfNotEqual(t, want, templateSHA256("foo"))
+}
+
+func TestTemplateFuncMap(t *testing.T) {
+	data := map[string]interface{}{
+		"Servers": []string{"a", "b"},
+		"Port":    0,
+	}
+
+	const text = `{{ fact "os" }} {{ .Servers | join "," }} {{ .Port | default 8080 }} {{ cidrhost "10.0.0.0/8" 1 }}`
+	got, err := executeTemplate(".", text, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, runtime.GOOS+" a,b 8080 10.0.0.1", got)
+}
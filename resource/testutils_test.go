@@ -32,6 +32,7 @@ import (
 	"runtime"
 	"testing"
 
+	"github.com/dnaeon/gru/utils"
 	"github.com/yuin/gopher-lua"
 )
 
@@ -61,3 +62,35 @@ func errorIfNotEqual(t *testing.T, v1, v2 interface{}) {
 		t.Errorf("%v want '%v', got '%v'", positionString(1), v1, v2)
 	}
 }
+
+// useFileSystem makes resources use the given file system, e.g. a
+// utils.MemFileSystem, and returns a function restoring the previous one.
+func useFileSystem(fs utils.FileSystem) func() {
+	defaultFileSystem := DefaultConfig.FileSystem
+	defaultFileCache := DefaultConfig.FileCache
+
+	cache := utils.NewFileCache()
+	cache.FS = fs
+	DefaultConfig.FileSystem = fs
+	DefaultConfig.FileCache = cache
+
+	return func() {
+		DefaultConfig.FileSystem = defaultFileSystem
+		DefaultConfig.FileCache = defaultFileCache
+	}
+}
+
+// useUserResolver makes resources look up users and groups using the
+// given resolver, e.g. a utils.MemUserResolver, and returns a function
+// restoring the previous user cache.
+func useUserResolver(r utils.UserResolver) func() {
+	defaultUserCache := DefaultConfig.UserCache
+
+	users := utils.NewUserCache()
+	users.Resolver = r
+	DefaultConfig.UserCache = users
+
+	return func() {
+		DefaultConfig.UserCache = defaultUserCache
+	}
+}
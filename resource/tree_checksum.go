@@ -0,0 +1,237 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// treeChecksumStateDir is the directory where the baseline
+// checksums of file trees are recorded.
+const treeChecksumStateDir = "/var/lib/gru/tree_checksum"
+
+// TreeChecksum type is a resource which detects changes to a file
+// tree, e.g. for tamper detection.
+//
+// Creating the resource records a checksum of the file tree, covering
+// the paths, modes and content of all files, directories and symbolic
+// links in it, as the baseline in a state file. On subsequent runs the
+// tree is verified against the baseline and any paths which have been
+// added, removed or modified since are reported as an error. The
+// resource only verifies the tree and never changes it, so recording
+// a new baseline requires removing the resource first.
+//
+// Example:
+//   ssh = resource.tree_checksum.new("/etc/ssh")
+//   ssh.state = "present"
+//   ssh.exclude = { "*.pub" }
+type TreeChecksum struct {
+	Base
+
+	// Path to the root of the file tree.
+	// Defaults to the resource name.
+	Path string `luar:"path"`
+
+	// Algorithm used for the checksums, either "md5", "sha1",
+	// "sha256" or "sha512". Defaults to "sha256".
+	Algorithm string `luar:"algorithm"`
+
+	// Exclude contains patterns matched against the names of files
+	// and directories, which are left out of the checksum.
+	Exclude []string `luar:"exclude"`
+
+	// StateFile is the path to the file in which the baseline is
+	// recorded. Defaults to a file named after the path in
+	// /var/lib/gru/tree_checksum.
+	StateFile string `luar:"state_file"`
+}
+
+// NewTreeChecksum creates a new resource for
+// detecting changes to a file tree.
+func NewTreeChecksum(name string) (Resource, error) {
+	tc := &TreeChecksum{
+		Base: Base{
+			Name:              name,
+			Type:              "tree_checksum",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		Path:      name,
+		Algorithm: "sha256",
+		Exclude:   make([]string, 0),
+		StateFile: filepath.Join(treeChecksumStateDir, url.PathEscape(filepath.Clean(name))+".json"),
+	}
+
+	tc.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "checksum",
+			PropertySetFunc:      tc.setChecksum,
+			PropertyIsSyncedFunc: tc.isChecksumSynced,
+		},
+	}
+
+	return tc, nil
+}
+
+// Validate validates the resource.
+func (tc *TreeChecksum) Validate() error {
+	if err := tc.Base.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := utils.NewHash(tc.Algorithm); err != nil {
+		return err
+	}
+
+	for _, pattern := range tc.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern '%s'", pattern)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the resource. The resource
+// is present once a baseline has been recorded for the tree.
+func (tc *TreeChecksum) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    tc.State,
+	}
+
+	_, err := os.Stat(tc.StateFile)
+	if os.IsNotExist(err) {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create records the checksum of the tree as the baseline.
+func (tc *TreeChecksum) Create() error {
+	checksum, err := tc.compute()
+	if err != nil {
+		return err
+	}
+
+	tc.Printf("recording baseline %s:%s with %d paths\n", checksum.Algorithm, checksum.Digest, len(checksum.Entries))
+
+	data, err := json.MarshalIndent(checksum, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(tc.StateFile), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(tc.StateFile, data, 0600)
+}
+
+// Delete removes the recorded baseline.
+func (tc *TreeChecksum) Delete() error {
+	tc.Printf("removing baseline %s\n", tc.StateFile)
+
+	return os.Remove(tc.StateFile)
+}
+
+// compute computes the checksum of the tree, using
+// the limits from the resource configuration.
+func (tc *TreeChecksum) compute() (*utils.TreeChecksum, error) {
+	opts := utils.HashOptions{
+		Algorithm:     tc.Algorithm,
+		Concurrency:   DefaultConfig.Concurrency,
+		InFlightBytes: DefaultConfig.HashInFlightBytes,
+	}
+
+	return utils.ComputeTreeChecksum(tc.Path, tc.Exclude, opts)
+}
+
+// isChecksumSynced verifies the tree against the recorded baseline
+// and reports any paths which have changed since as an error.
+func (tc *TreeChecksum) isChecksumSynced() (bool, error) {
+	data, err := ioutil.ReadFile(tc.StateFile)
+	if os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	var baseline utils.TreeChecksum
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return false, fmt.Errorf("invalid state file %s: %s", tc.StateFile, err)
+	}
+
+	checksum, err := tc.compute()
+	if err != nil {
+		return false, err
+	}
+
+	changed := checksum.Changed(&baseline)
+	if len(changed) == 0 {
+		return true, nil
+	}
+
+	return false, fmt.Errorf("%d path(s) changed since the baseline was recorded: %s", len(changed), strings.Join(changed, ", "))
+}
+
+// setChecksum is not implemented, since the resource only verifies
+// the tree. Changes are reported when checking the checksum instead.
+func (tc *TreeChecksum) setChecksum() error {
+	return ErrNotImplemented
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "tree_checksum",
+		Provider:  NewTreeChecksum,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
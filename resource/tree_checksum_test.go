@@ -0,0 +1,122 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTreeChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-tree-checksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	root := filepath.Join(dir, "tree")
+	if err := os.MkdirAll(filepath.Join(root, "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"main.conf", "conf.d/extra.conf"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewTreeChecksum(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc := r.(*TreeChecksum)
+	if !strings.HasPrefix(tc.StateFile, treeChecksumStateDir) {
+		t.Errorf("want default state file in %s, got %s", treeChecksumStateDir, tc.StateFile)
+	}
+	tc.StateFile = filepath.Join(dir, "state", "tree.json")
+	if err := tc.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := tc.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	_, err = tc.isChecksumSynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	if err := tc.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = tc.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+
+	synced, err := tc.isChecksumSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "conf.d/extra.conf"), []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "conf.d/new.conf"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tc.isChecksumSynced()
+	if err == nil || !strings.HasSuffix(err.Error(), "2 path(s) changed since the baseline was recorded: conf.d/extra.conf, conf.d/new.conf") {
+		t.Errorf("want changed paths to be reported, got %v", err)
+	}
+
+	if err := tc.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = tc.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+}
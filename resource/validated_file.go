@@ -0,0 +1,201 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// ValidatedFile resource manages files, which content is validated
+// before being put in place.
+//
+// The content of the file is written to a temporary file in the same
+// directory as the managed file, and the validation command is executed
+// against it. The temporary file is renamed to the managed file only if
+// the validation command succeeds, otherwise the existing file is left
+// untouched. The "%s" placeholder in the validation command is replaced
+// with the path to the temporary file. If no placeholder is present the
+// path is appended to the command.
+//
+// Example:
+//   sudoers = resource.validated_file.new("/etc/sudoers.d/ops")
+//   sudoers.state = "present"
+//   sudoers.mode = tonumber("0440", 8)
+//   sudoers.content = "%ops ALL=(ALL) NOPASSWD: ALL\n"
+//   sudoers.validate = "visudo -c -f %s"
+type ValidatedFile struct {
+	File
+
+	// ValidateCmd is the command used to validate the file content.
+	// Required.
+	ValidateCmd string `luar:"validate"`
+}
+
+// NewValidatedFile creates a resource for managing
+// files with validated content.
+func NewValidatedFile(name string) (Resource, error) {
+	r, err := NewFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &ValidatedFile{
+		File:        *r.(*File),
+		ValidateCmd: "",
+	}
+	v.Type = "validated_file"
+
+	// Properties need to be bound to the new resource
+	v.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "mode",
+			PropertySetFunc:      v.setMode,
+			PropertyIsSyncedFunc: v.isModeSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "ownership",
+			PropertySetFunc:      v.setOwner,
+			PropertyIsSyncedFunc: v.isOwnerSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "content",
+			PropertySetFunc:      v.setContent,
+			PropertyIsSyncedFunc: v.isContentSynced,
+		},
+	}
+
+	return v, nil
+}
+
+// Validate validates the resource.
+func (v *ValidatedFile) Validate() error {
+	if err := v.File.Validate(); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(v.ValidateCmd) == "" {
+		return errors.New("must provide validation command")
+	}
+
+	return nil
+}
+
+// Create creates the file managed by the resource.
+func (v *ValidatedFile) Create() error {
+	v.Printf("creating file\n")
+
+	return v.writeValidated()
+}
+
+// setContent sets the content of the file.
+func (v *ValidatedFile) setContent() error {
+	v.Printf("setting content\n")
+
+	return v.writeValidated()
+}
+
+// writeValidated writes the content to a temporary file, validates it
+// and then renames the temporary file to the managed file.
+func (v *ValidatedFile) writeValidated() error {
+	defer DefaultConfig.InvalidatePath(v.Path)
+
+	data := v.desiredContent()
+	if err := v.checkMaxSize(data); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(v.Path), "."+filepath.Base(v.Path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), v.Mode); err != nil {
+		return err
+	}
+
+	if err := v.runValidateCmd(tmp.Name()); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), v.Path); err != nil {
+		return err
+	}
+	DefaultConfig.BytesWritten.Add(int64(len(data)))
+
+	return nil
+}
+
+// runValidateCmd executes the validation command against the given file.
+func (v *ValidatedFile) runValidateCmd(path string) error {
+	args := strings.Fields(v.ValidateCmd)
+	placeholder := false
+	for i, arg := range args {
+		if strings.Contains(arg, "%s") {
+			args[i] = strings.Replace(arg, "%s", path, -1)
+			placeholder = true
+		}
+	}
+
+	if !placeholder {
+		args = append(args, path)
+	}
+
+	spec := utils.CommandSpec{Args: args}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("validation failed: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "validated_file",
+		Provider:  NewValidatedFile,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// VaultNamespace is the table name in Lua where Vault resources are
+// being registered to.
+const VaultNamespace = "vault"
+
+// BaseVault type is the base type for all Vault related resources.
+type BaseVault struct {
+	Base
+
+	// VaultAddr is the address of the Vault server. Defaults to
+	// the value of the VAULT_ADDR environment variable.
+	VaultAddr string `luar:"address"`
+
+	// VaultToken is the token used to authenticate against Vault.
+	// Defaults to the value of the VAULT_TOKEN environment variable.
+	VaultToken string `luar:"token" gru:"sensitive"`
+
+	ctx    context.Context    `luar:"-"`
+	cancel context.CancelFunc `luar:"-"`
+	client *api.Client        `luar:"-"`
+}
+
+// Initialize creates the client for the Vault API.
+func (bv *BaseVault) Initialize() error {
+	bv.ctx, bv.cancel = context.WithCancel(context.Background())
+
+	config := api.DefaultConfig()
+	if config.Error != nil {
+		return config.Error
+	}
+
+	if bv.VaultAddr != "" {
+		config.Address = bv.VaultAddr
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return err
+	}
+
+	if bv.VaultToken != "" {
+		client.SetToken(bv.VaultToken)
+	}
+	bv.client = client
+
+	return nil
+}
+
+// Close cancels any pending requests to the Vault API.
+func (bv *BaseVault) Close() error {
+	bv.cancel()
+
+	return nil
+}
@@ -0,0 +1,431 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vaultAppRoleStateDir is the directory where the role ids
+// of AppRole authentication roles are written to.
+const vaultAppRoleStateDir = "/var/lib/gru/vault_approle"
+
+// VaultAppRole type is a resource which manages roles of the
+// Vault AppRole authentication method.
+//
+// Roles are identified by their name, which is the resource name.
+// The role id of the role is written to the state directory
+// as <name>.role_id, so that it can be used by applications
+// logging in with the role.
+//
+// Example:
+//   web = vault.approle.new("web")
+//   web.address = "https://vault.example.org:8200"
+//   web.token = "my-vault-token"
+//   web.policies = { "web" }
+//   web.secret_id_ttl = "24h"
+//   web.token_ttl = "1h"
+//   web.token_max_ttl = "4h"
+type VaultAppRole struct {
+	BaseVault
+
+	// Policies attached to tokens issued for the role.
+	Policies []string `luar:"policies"`
+
+	// SecretIDTTL is the duration after which secret ids of
+	// the role expire, e.g. "24h". Zero means no expiration.
+	SecretIDTTL string `luar:"secret_id_ttl"`
+
+	// TokenTTL is the lifetime of tokens issued for the role,
+	// e.g. "1h". Zero means the default lifetime of Vault.
+	TokenTTL string `luar:"token_ttl"`
+
+	// TokenMaxTTL is the maximum lifetime of tokens issued for
+	// the role, e.g. "4h". Zero means the default of Vault.
+	TokenMaxTTL string `luar:"token_max_ttl"`
+
+	// SecretIDNumUses is the number of times secret ids of the
+	// role can be used. Zero means unlimited uses.
+	SecretIDNumUses int `luar:"secret_id_num_uses"`
+
+	// Mount is the path where the AppRole authentication
+	// method is mounted. Defaults to "approle".
+	Mount string `luar:"mount"`
+
+	// StateDir is the directory where the role id is written
+	// to. Defaults to /var/lib/gru/vault_approle.
+	StateDir string `luar:"state_dir"`
+
+	// The configuration of the role as found in Vault
+	current *vaultAppRoleConfig `luar:"-"`
+}
+
+// vaultAppRoleConfig type contains the configuration of
+// an AppRole, with the durations in seconds.
+type vaultAppRoleConfig struct {
+	Policies        []string
+	SecretIDTTL     int64
+	TokenTTL        int64
+	TokenMaxTTL     int64
+	SecretIDNumUses int64
+}
+
+// NewVaultAppRole creates a new resource for managing
+// roles of the Vault AppRole authentication method.
+func NewVaultAppRole(name string) (Resource, error) {
+	r := &VaultAppRole{
+		BaseVault: BaseVault{
+			Base: Base{
+				Name:              name,
+				Type:              "approle",
+				State:             "present",
+				Require:           make([]string, 0),
+				PresentStatesList: []string{"present"},
+				AbsentStatesList:  []string{"absent"},
+				Concurrent:        true,
+				Subscribe:         make(TriggerMap),
+			},
+		},
+		Policies: make([]string, 0),
+		Mount:    "approle",
+		StateDir: vaultAppRoleStateDir,
+	}
+
+	r.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "config",
+			PropertySetFunc:      r.setConfig,
+			PropertyIsSyncedFunc: r.isConfigSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "role_id",
+			PropertySetFunc:      r.setRoleID,
+			PropertyIsSyncedFunc: r.isRoleIDSynced,
+		},
+	}
+
+	return r, nil
+}
+
+// Validate validates the resource.
+func (r *VaultAppRole) Validate() error {
+	if err := r.Base.Validate(); err != nil {
+		return err
+	}
+
+	if r.Name == "" || strings.ContainsAny(r.Name, "/ ") {
+		return fmt.Errorf("invalid role name '%s'", r.Name)
+	}
+
+	if strings.Trim(r.Mount, "/") == "" {
+		return errors.New("must provide mount path")
+	}
+
+	if r.StateDir == "" {
+		return errors.New("must provide state directory")
+	}
+
+	if r.SecretIDNumUses < 0 {
+		return errors.New("number of secret id uses must not be negative")
+	}
+
+	if _, err := r.config(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// rolePath returns the API path of the role.
+func (r *VaultAppRole) rolePath() string {
+	return fmt.Sprintf("auth/%s/role/%s", strings.Trim(r.Mount, "/"), r.Name)
+}
+
+// roleIDFile returns the path to the file containing the role id.
+func (r *VaultAppRole) roleIDFile() string {
+	return filepath.Join(r.StateDir, r.Name+".role_id")
+}
+
+// config returns the wanted configuration of the role.
+func (r *VaultAppRole) config() (*vaultAppRoleConfig, error) {
+	c := &vaultAppRoleConfig{
+		Policies:        normalizeVaultPolicies(r.Policies),
+		SecretIDNumUses: int64(r.SecretIDNumUses),
+	}
+
+	ttls := []struct {
+		name  string
+		value string
+		dst   *int64
+	}{
+		{"secret_id_ttl", r.SecretIDTTL, &c.SecretIDTTL},
+		{"token_ttl", r.TokenTTL, &c.TokenTTL},
+		{"token_max_ttl", r.TokenMaxTTL, &c.TokenMaxTTL},
+	}
+
+	for _, ttl := range ttls {
+		seconds, err := parseVaultTTL(ttl.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s'", ttl.name, ttl.value)
+		}
+		*ttl.dst = seconds
+	}
+
+	return c, nil
+}
+
+// Evaluate evaluates the state of the role.
+func (r *VaultAppRole) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    r.State,
+	}
+
+	secret, err := r.client.Logical().ReadWithContext(r.ctx, r.rolePath())
+	if err != nil {
+		return state, err
+	}
+
+	if secret == nil || secret.Data == nil {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	// Vault versions before 1.2 return the policies as "policies"
+	policies, ok := secret.Data["token_policies"].([]interface{})
+	if !ok {
+		policies, _ = secret.Data["policies"].([]interface{})
+	}
+
+	current := &vaultAppRoleConfig{
+		Policies: make([]string, 0, len(policies)),
+	}
+	for _, p := range policies {
+		current.Policies = append(current.Policies, fmt.Sprint(p))
+	}
+	current.Policies = normalizeVaultPolicies(current.Policies)
+
+	numbers := map[string]*int64{
+		"secret_id_ttl":      &current.SecretIDTTL,
+		"token_ttl":          &current.TokenTTL,
+		"token_max_ttl":      &current.TokenMaxTTL,
+		"secret_id_num_uses": &current.SecretIDNumUses,
+	}
+	for key, dst := range numbers {
+		if v, ok := secret.Data[key]; ok && v != nil {
+			n, err := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+			if err != nil {
+				return state, fmt.Errorf("invalid %s in role: %s", key, err)
+			}
+			*dst = n
+		}
+	}
+
+	r.current = current
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create creates the role and writes the role id.
+func (r *VaultAppRole) Create() error {
+	r.Printf("creating role\n")
+
+	if err := r.write(); err != nil {
+		return err
+	}
+
+	return r.setRoleID()
+}
+
+// Delete deletes the role and removes the role id.
+func (r *VaultAppRole) Delete() error {
+	r.Printf("removing role\n")
+
+	if _, err := r.client.Logical().DeleteWithContext(r.ctx, r.rolePath()); err != nil {
+		return err
+	}
+
+	if err := os.Remove(r.roleIDFile()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// write writes the configuration of the role to Vault.
+func (r *VaultAppRole) write() error {
+	c, err := r.config()
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"token_policies":     c.Policies,
+		"secret_id_ttl":      c.SecretIDTTL,
+		"token_ttl":          c.TokenTTL,
+		"token_max_ttl":      c.TokenMaxTTL,
+		"secret_id_num_uses": c.SecretIDNumUses,
+	}
+
+	if _, err := r.client.Logical().WriteWithContext(r.ctx, r.rolePath(), data); err != nil {
+		return err
+	}
+	r.current = c
+
+	return nil
+}
+
+// isConfigSynced checks whether the configuration of the role is in sync.
+func (r *VaultAppRole) isConfigSynced() (bool, error) {
+	if r.current == nil {
+		return false, ErrResourceAbsent
+	}
+
+	want, err := r.config()
+	if err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(r.current, want), nil
+}
+
+// setConfig updates the configuration of the role.
+func (r *VaultAppRole) setConfig() error {
+	r.Printf("updating role configuration\n")
+
+	return r.write()
+}
+
+// roleID reads the role id of the role from Vault.
+func (r *VaultAppRole) roleID() (string, error) {
+	secret, err := r.client.Logical().ReadWithContext(r.ctx, r.rolePath()+"/role-id")
+	if err != nil {
+		return "", err
+	}
+
+	if secret == nil || secret.Data == nil {
+		return "", ErrResourceAbsent
+	}
+
+	roleID, _ := secret.Data["role_id"].(string)
+	if roleID == "" {
+		return "", errors.New("no role id found for role")
+	}
+
+	return roleID, nil
+}
+
+// isRoleIDSynced checks whether the role id file is in sync.
+func (r *VaultAppRole) isRoleIDSynced() (bool, error) {
+	if r.current == nil {
+		return false, ErrResourceAbsent
+	}
+
+	roleID, err := r.roleID()
+	if err != nil {
+		return false, err
+	}
+
+	data, err := ioutil.ReadFile(r.roleIDFile())
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(string(data)) == roleID, nil
+}
+
+// setRoleID writes the role id to the state directory.
+func (r *VaultAppRole) setRoleID() error {
+	roleID, err := r.roleID()
+	if err != nil {
+		return err
+	}
+
+	r.Printf("writing role id to %s\n", r.roleIDFile())
+
+	if err := os.MkdirAll(r.StateDir, 0755); err != nil {
+		return err
+	}
+
+	return writeFile(r.roleIDFile(), []byte(roleID+"\n"), 0600)
+}
+
+// normalizeVaultPolicies returns the sorted policies without duplicates.
+func normalizeVaultPolicies(policies []string) []string {
+	seen := make(map[string]bool, len(policies))
+	result := make([]string, 0, len(policies))
+	for _, p := range policies {
+		if !seen[p] {
+			seen[p] = true
+			result = append(result, p)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// parseVaultTTL parses a duration in the format accepted by Vault,
+// either as seconds or as a Go duration string, e.g. "1h".
+func parseVaultTTL(ttl string) (int64, error) {
+	if ttl == "" {
+		return 0, nil
+	}
+
+	if seconds, err := strconv.ParseInt(ttl, 10, 64); err == nil && seconds >= 0 {
+		return seconds, nil
+	}
+
+	d, err := time.ParseDuration(ttl)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration '%s'", ttl)
+	}
+
+	return int64(d / time.Second), nil
+}
+
+func init() {
+	approle := ProviderItem{
+		Type:      "approle",
+		Provider:  NewVaultAppRole,
+		Namespace: VaultNamespace,
+	}
+
+	RegisterProvider(approle)
+}
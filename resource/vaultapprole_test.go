@@ -0,0 +1,178 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVaultAppRole is a minimal implementation of the
+// role endpoints of the Vault AppRole authentication method.
+type fakeVaultAppRole struct {
+	sync.Mutex
+	roles  map[string]map[string]interface{}
+	writes int
+}
+
+func (v *fakeVaultAppRole) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.Lock()
+	defer v.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/auth/approle/role/")
+	name := strings.TrimSuffix(path, "/role-id")
+	role, ok := v.roles[name]
+
+	switch {
+	case r.Method == "GET" && !ok:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+	case r.Method == "GET" && strings.HasSuffix(path, "/role-id"):
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"role_id": "role-id-" + name},
+		})
+	case r.Method == "GET":
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": role})
+	case r.Method == "PUT" || r.Method == "POST":
+		var data map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		v.roles[name] = data
+		v.writes++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "DELETE":
+		delete(v.roles, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request", http.StatusMethodNotAllowed)
+	}
+}
+
+func TestVaultAppRole(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-approle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	vault := &fakeVaultAppRole{roles: make(map[string]map[string]interface{})}
+	ts := httptest.NewServer(vault)
+	defer ts.Close()
+
+	r, err := NewVaultAppRole("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role := r.(*VaultAppRole)
+	role.VaultAddr = ts.URL
+	role.VaultToken = "root"
+	role.StateDir = dir
+	role.Policies = []string{"web", "common"}
+	role.SecretIDTTL = "24h"
+	role.TokenTTL = "3600"
+	if err := role.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := role.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer role.Close()
+
+	state, err := role.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	_, err = role.isConfigSynced()
+	errorIfNotEqual(t, ErrResourceAbsent, err)
+
+	if err := role.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "web.role_id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "role-id-web\n", string(data))
+
+	// The role is in sync after being created
+	state, err = role.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+	errorIfNotEqual(t, []string{}, outOfSync(t, role))
+	errorIfNotEqual(t, float64(86400), vault.roles["web"]["secret_id_ttl"])
+
+	// Changing the policies updates the role
+	role.Policies = []string{"web"}
+	errorIfNotEqual(t, []string{"config"}, outOfSync(t, role))
+	if err := role.setConfig(); err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, 2, vault.writes)
+
+	// A missing role id file is written again
+	os.Remove(filepath.Join(dir, "web.role_id"))
+	errorIfNotEqual(t, []string{"role_id"}, outOfSync(t, role))
+
+	if err := role.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := vault.roles["web"]; ok {
+		t.Error("want role removed")
+	}
+}
+
+func TestParseVaultTTL(t *testing.T) {
+	for ttl, want := range map[string]int64{
+		"":      0,
+		"0":     0,
+		"3600":  3600,
+		"1h30m": 5400,
+	} {
+		seconds, err := parseVaultTTL(ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errorIfNotEqual(t, want, seconds)
+	}
+
+	if _, err := parseVaultTTL("-1h"); err == nil {
+		t.Error("want error for negative duration")
+	}
+}
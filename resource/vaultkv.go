@@ -0,0 +1,268 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VaultKV type is a resource which manages secrets in the
+// Vault KV secrets engine. Both versions 1 and 2 of the
+// KV secrets engine are supported.
+//
+// Secret values are never logged, only the names of
+// the keys which are out of sync.
+//
+// Example:
+//   db = vault.kv.new("ops/database")
+//   db.address = "https://vault.example.org:8200"
+//   db.token = "my-vault-token"
+//   db.mount = "secret"
+//   db.data = {
+//     username = "ops",
+//     password = "s3cr3t",
+//   }
+type VaultKV struct {
+	BaseVault
+
+	// Path of the secret, relative to the mount.
+	// Defaults to the resource name.
+	Path string `luar:"path"`
+
+	// Data contains the key/value pairs of the secret.
+	Data map[string]string `luar:"data" gru:"sensitive"`
+
+	// Mount is the path where the KV secrets engine is mounted.
+	// Defaults to "secret".
+	Mount string `luar:"mount"`
+
+	// Version of the KV secrets engine. Defaults to 2.
+	Version int `luar:"version"`
+
+	// The data of the secret as found in Vault
+	current map[string]string `luar:"-"`
+}
+
+// NewVaultKV creates a new resource for managing
+// secrets in the Vault KV secrets engine.
+func NewVaultKV(name string) (Resource, error) {
+	kv := &VaultKV{
+		BaseVault: BaseVault{
+			Base: Base{
+				Name:              name,
+				Type:              "kv",
+				State:             "present",
+				Require:           make([]string, 0),
+				PresentStatesList: []string{"present"},
+				AbsentStatesList:  []string{"absent"},
+				Concurrent:        true,
+				Subscribe:         make(TriggerMap),
+			},
+		},
+		Path:    name,
+		Data:    make(map[string]string),
+		Mount:   "secret",
+		Version: 2,
+	}
+
+	kv.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "data",
+			PropertySetFunc:      kv.setData,
+			PropertyIsSyncedFunc: kv.isDataSynced,
+		},
+	}
+
+	return kv, nil
+}
+
+// Validate validates the resource.
+func (kv *VaultKV) Validate() error {
+	if err := kv.Base.Validate(); err != nil {
+		return err
+	}
+
+	if strings.Trim(kv.Path, "/") == "" {
+		return errors.New("must provide secret path")
+	}
+
+	if strings.Trim(kv.Mount, "/") == "" {
+		return errors.New("must provide mount path")
+	}
+
+	if kv.Version != 1 && kv.Version != 2 {
+		return fmt.Errorf("unsupported KV version %d", kv.Version)
+	}
+
+	return nil
+}
+
+// dataPath returns the API path used for reading
+// and writing the secret data.
+func (kv *VaultKV) dataPath() string {
+	mount := strings.Trim(kv.Mount, "/")
+	path := strings.Trim(kv.Path, "/")
+
+	if kv.Version == 1 {
+		return fmt.Sprintf("%s/%s", mount, path)
+	}
+
+	return fmt.Sprintf("%s/data/%s", mount, path)
+}
+
+// Evaluate evaluates the state of the secret.
+func (kv *VaultKV) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    kv.State,
+	}
+
+	secret, err := kv.client.Logical().ReadWithContext(kv.ctx, kv.dataPath())
+	if err != nil {
+		return state, err
+	}
+
+	if secret == nil || secret.Data == nil {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	data := secret.Data
+	if kv.Version == 2 {
+		// The data of deleted secrets in KV version 2 is null
+		data, _ = secret.Data["data"].(map[string]interface{})
+		if data == nil {
+			state.Current = "absent"
+			return state, nil
+		}
+	}
+
+	kv.current = make(map[string]string, len(data))
+	for k, v := range data {
+		kv.current[k] = fmt.Sprint(v)
+	}
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create creates the secret.
+func (kv *VaultKV) Create() error {
+	kv.Printf("creating secret with keys %s\n", strings.Join(vaultKVKeys(kv.Data), ", "))
+
+	return kv.write()
+}
+
+// Delete deletes the secret.
+func (kv *VaultKV) Delete() error {
+	kv.Printf("removing secret\n")
+
+	_, err := kv.client.Logical().DeleteWithContext(kv.ctx, kv.dataPath())
+
+	return err
+}
+
+// write writes the secret data to Vault.
+func (kv *VaultKV) write() error {
+	data := make(map[string]interface{}, len(kv.Data))
+	for k, v := range kv.Data {
+		data[k] = v
+	}
+
+	if kv.Version == 2 {
+		data = map[string]interface{}{"data": data}
+	}
+
+	_, err := kv.client.Logical().WriteWithContext(kv.ctx, kv.dataPath(), data)
+
+	return err
+}
+
+// isDataSynced checks whether the secret data is in sync.
+func (kv *VaultKV) isDataSynced() (bool, error) {
+	if kv.current == nil {
+		return false, ErrResourceAbsent
+	}
+
+	changed := vaultKVChangedKeys(kv.current, kv.Data)
+	if len(changed) > 0 {
+		kv.Printf("keys out of sync: %s\n", strings.Join(changed, ", "))
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// setData updates the secret data.
+func (kv *VaultKV) setData() error {
+	kv.Printf("updating secret\n")
+
+	return kv.write()
+}
+
+// vaultKVKeys returns the sorted keys of a secret.
+func vaultKVKeys(data map[string]string) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// vaultKVChangedKeys returns the sorted keys which are either
+// missing, extra or have different values in the two secrets.
+func vaultKVChangedKeys(current, want map[string]string) []string {
+	changed := make([]string, 0)
+	for k, v := range want {
+		if cv, ok := current[k]; !ok || cv != v {
+			changed = append(changed, k)
+		}
+	}
+
+	for k := range current {
+		if _, ok := want[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed
+}
+
+func init() {
+	kv := ProviderItem{
+		Type:      "kv",
+		Provider:  NewVaultKV,
+		Namespace: VaultNamespace,
+	}
+
+	RegisterProvider(kv)
+}
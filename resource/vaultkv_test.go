@@ -0,0 +1,59 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import "testing"
+
+func TestVaultKVChangedKeys(t *testing.T) {
+	current := map[string]string{
+		"username": "ops",
+		"password": "old",
+		"extra":    "foo",
+	}
+
+	want := map[string]string{
+		"username": "ops",
+		"password": "new",
+		"host":     "db.example.org",
+	}
+
+	errorIfNotEqual(t, []string{"extra", "host", "password"}, vaultKVChangedKeys(current, want))
+	errorIfNotEqual(t, []string{}, vaultKVChangedKeys(want, want))
+}
+
+func TestVaultKVDataPath(t *testing.T) {
+	r, err := NewVaultKV("/ops/database")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kv := r.(*VaultKV)
+	errorIfNotEqual(t, "secret/data/ops/database", kv.dataPath())
+
+	kv.Mount = "/kv/"
+	kv.Version = 1
+	errorIfNotEqual(t, "kv/ops/database", kv.dataPath())
+}
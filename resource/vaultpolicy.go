@@ -0,0 +1,232 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// VaultPolicy type is a resource which manages Vault ACL policies.
+//
+// Policies are identified by their name, which is the resource name.
+// Policies are normalized before being compared, so that the order
+// of path blocks and trailing whitespace do not result in updates.
+//
+// Example:
+//   ops = vault.policy.new("ops")
+//   ops.address = "https://vault.example.org:8200"
+//   ops.token = "my-vault-token"
+//   ops.policy = [[
+//   path "secret/data/ops/*" {
+//     capabilities = ["read", "list"]
+//   }
+//   ]]
+type VaultPolicy struct {
+	BaseVault
+
+	// Policy is the content of the policy in HCL format.
+	Policy string `luar:"policy"`
+
+	// The content of the policy as found in Vault
+	current string `luar:"-"`
+}
+
+// NewVaultPolicy creates a new resource for managing Vault policies.
+func NewVaultPolicy(name string) (Resource, error) {
+	p := &VaultPolicy{
+		BaseVault: BaseVault{
+			Base: Base{
+				Name:              name,
+				Type:              "policy",
+				State:             "present",
+				Require:           make([]string, 0),
+				PresentStatesList: []string{"present"},
+				AbsentStatesList:  []string{"absent"},
+				Concurrent:        true,
+				Subscribe:         make(TriggerMap),
+			},
+		},
+	}
+
+	p.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "policy",
+			PropertySetFunc:      p.setPolicy,
+			PropertyIsSyncedFunc: p.isPolicySynced,
+		},
+	}
+
+	return p, nil
+}
+
+// Validate validates the resource.
+func (p *VaultPolicy) Validate() error {
+	if err := p.Base.Validate(); err != nil {
+		return err
+	}
+
+	if p.State == "present" && strings.TrimSpace(p.Policy) == "" {
+		return errors.New("must provide policy content")
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the policy.
+func (p *VaultPolicy) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    p.State,
+	}
+
+	// An empty policy is returned if the policy does not exist
+	policy, err := p.client.Sys().GetPolicyWithContext(p.ctx, p.Name)
+	if err != nil {
+		return state, err
+	}
+
+	if policy == "" {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	p.current = policy
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create creates the policy.
+func (p *VaultPolicy) Create() error {
+	p.Printf("creating policy\n")
+
+	return p.client.Sys().PutPolicyWithContext(p.ctx, p.Name, p.Policy)
+}
+
+// Delete deletes the policy.
+func (p *VaultPolicy) Delete() error {
+	p.Printf("removing policy\n")
+
+	return p.client.Sys().DeletePolicyWithContext(p.ctx, p.Name)
+}
+
+// isPolicySynced checks whether the policy content is in sync.
+func (p *VaultPolicy) isPolicySynced() (bool, error) {
+	if p.current == "" {
+		return false, ErrResourceAbsent
+	}
+
+	return normalizeVaultPolicy(p.current) == normalizeVaultPolicy(p.Policy), nil
+}
+
+// setPolicy updates the policy content.
+func (p *VaultPolicy) setPolicy() error {
+	p.Printf("updating policy\n")
+
+	if err := p.client.Sys().PutPolicyWithContext(p.ctx, p.Name, p.Policy); err != nil {
+		return err
+	}
+	p.current = p.Policy
+
+	return nil
+}
+
+// normalizeVaultPolicy returns the policy with trailing whitespace
+// and empty lines removed, and with the top-level blocks sorted.
+// Comments preceding a block are kept together with the block.
+func normalizeVaultPolicy(policy string) string {
+	var blocks []string
+	var block []string
+	depth := 0
+
+	for _, line := range strings.Split(policy, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			continue
+		}
+
+		block = append(block, line)
+		depth += hclBraceDepth(line)
+		if depth <= 0 && !isHCLComment(line) {
+			blocks = append(blocks, strings.Join(block, "\n"))
+			block = nil
+			depth = 0
+		}
+	}
+
+	// Unterminated blocks or trailing comments
+	if len(block) > 0 {
+		blocks = append(blocks, strings.Join(block, "\n"))
+	}
+
+	sort.Strings(blocks)
+
+	return strings.Join(blocks, "\n")
+}
+
+// isHCLComment returns true if the line contains only a comment.
+func isHCLComment(line string) bool {
+	line = strings.TrimSpace(line)
+
+	return strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//")
+}
+
+// hclBraceDepth returns the change in brace nesting for a line of
+// HCL, ignoring braces in strings and comments.
+func hclBraceDepth(line string) int {
+	depth := 0
+	inString := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '#', c == '/' && i+1 < len(line) && line[i+1] == '/':
+			return depth
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		}
+	}
+
+	return depth
+}
+
+func init() {
+	policy := ProviderItem{
+		Type:      "policy",
+		Provider:  NewVaultPolicy,
+		Namespace: VaultNamespace,
+	}
+
+	RegisterProvider(policy)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import "testing"
+
+func TestNormalizeVaultPolicy(t *testing.T) {
+	policy := `
+# Read access to ops secrets
+path "secret/data/ops/*" {
+  capabilities = ["read", "list"]
+}
+
+path "auth/token/lookup-self" {
+  capabilities = ["read"] # needed by clients
+}
+`
+
+	reordered := `path "auth/token/lookup-self" {   
+  capabilities = ["read"] # needed by clients
+}
+# Read access to ops secrets
+path "secret/data/ops/*" {
+  capabilities = ["read", "list"]	
+}`
+
+	errorIfNotEqual(t, normalizeVaultPolicy(policy), normalizeVaultPolicy(reordered))
+
+	changed := `path "secret/data/ops/*" {
+  capabilities = ["read"]
+}
+path "auth/token/lookup-self" {
+  capabilities = ["read"]
+}`
+
+	if normalizeVaultPolicy(policy) == normalizeVaultPolicy(changed) {
+		t.Error("policies with different capabilities should not be equal")
+	}
+
+	// Braces in strings and comments should not affect blocks
+	braces := `path "secret/{foo}" { # {
+  capabilities = ["read"]
+}
+path "a" { capabilities = ["deny"] }`
+
+	want := "path \"a\" { capabilities = [\"deny\"] }\npath \"secret/{foo}\" { # {\n  capabilities = [\"read\"]\n}"
+	errorIfNotEqual(t, want, normalizeVaultPolicy(braces))
+}
@@ -65,7 +65,7 @@ type BaseVSphere struct {
 
 	// Password to use when connecting to the vSphere endpoint.
 	// Defaults to an empty string.
-	Password string `luar:"password"`
+	Password string `luar:"password" gru:"sensitive"`
 
 	// Endpoint to the VMware vSphere API. Defaults to an empty string.
 	Endpoint string `luar:"endpoint"`
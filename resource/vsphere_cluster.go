@@ -114,7 +114,7 @@ func (c *Cluster) isClusterConfigSynced() (bool, error) {
 
 // setClusterConfig sets the cluster configuration to the desired state.
 func (c *Cluster) setClusterConfig() error {
-	Logf("%s setting cluster config\n", c.ID())
+	c.Printf("setting cluster config\n")
 
 	spec := types.ClusterConfigSpec{
 		DasConfig: &types.ClusterDasConfigInfo{
@@ -201,7 +201,7 @@ func (c *Cluster) Evaluate() (State, error) {
 
 // Create creates a new cluster.
 func (c *Cluster) Create() error {
-	Logf("%s creating cluster\n", c.ID())
+	c.Printf("creating cluster\n")
 
 	folder, err := c.finder.Folder(c.ctx, c.Path)
 	if err != nil {
@@ -215,7 +215,7 @@ func (c *Cluster) Create() error {
 
 // Delete removes the cluster.
 func (c *Cluster) Delete() error {
-	Logf("%s removing cluster\n", c.ID())
+	c.Printf("removing cluster\n")
 
 	obj, err := c.finder.ClusterComputeResource(c.ctx, path.Join(c.Path, c.Name))
 	if err != nil {
@@ -53,7 +53,7 @@ type ClusterHost struct {
 
 	// EsxiPassword is the password used to connect to the
 	// remote ESXi host. Defaults to an empty string.
-	EsxiPassword string `luar:"esxi_password"`
+	EsxiPassword string `luar:"esxi_password" gru:"sensitive"`
 
 	// SSL thumbprint of the host. Defaults to an empty string.
 	SslThumbprint string `luar:"ssl_thumbprint"`
@@ -128,7 +128,7 @@ func (ch *ClusterHost) Evaluate() (State, error) {
 
 // Create adds the host to the cluster.
 func (ch *ClusterHost) Create() error {
-	Logf("%s adding host to %s\n", ch.ID(), ch.Path)
+	ch.Printf("adding host to %s\n", ch.Path)
 
 	obj, err := ch.finder.ClusterComputeResource(ch.ctx, ch.Path)
 	if err != nil {
@@ -155,7 +155,7 @@ func (ch *ClusterHost) Create() error {
 
 // Delete disconnects the host and then removes it.
 func (ch *ClusterHost) Delete() error {
-	Logf("%s removing host from %s\n", ch.ID(), ch.Path)
+	ch.Printf("removing host from %s\n", ch.Path)
 
 	obj, err := ch.finder.HostSystem(ch.ctx, path.Join(ch.Path, ch.Name))
 	if err != nil {
@@ -94,7 +94,7 @@ func (d *Datacenter) Evaluate() (State, error) {
 
 // Create creates a new datacenter.
 func (d *Datacenter) Create() error {
-	Logf("%s creating datacenter in %s\n", d.ID(), d.Path)
+	d.Printf("creating datacenter in %s\n", d.Path)
 
 	folder, err := d.finder.FolderOrDefault(d.ctx, d.Path)
 	if err != nil {
@@ -108,7 +108,7 @@ func (d *Datacenter) Create() error {
 
 // Delete removes the datacenter.
 func (d *Datacenter) Delete() error {
-	Logf("%s removing datacenter from %s\n", d.ID(), d.Path)
+	d.Printf("removing datacenter from %s\n", d.Path)
 
 	dc, err := d.finder.Datacenter(d.ctx, d.Name)
 	if err != nil {
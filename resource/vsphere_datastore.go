@@ -80,7 +80,7 @@ type DatastoreNfs struct {
 
 // mountOn mounts the NFS datastore on an ESXi host.
 func (ds *DatastoreNfs) mountOn(host string) error {
-	Logf("%s mounting datastore on %s\n", ds.ID(), path.Base(host))
+	ds.Printf("mounting datastore on %s\n", path.Base(host))
 
 	obj, err := ds.finder.HostSystem(ds.ctx, host)
 	if err != nil {
@@ -139,7 +139,7 @@ func (ds *DatastoreNfs) isHostsPropertySynced() (bool, error) {
 	}
 
 	for _, host := range ds.shouldMountOnHosts {
-		Logf("%s datastore should be mounted on %s\n", ds.ID(), path.Base(host))
+		ds.Printf("datastore should be mounted on %s\n", path.Base(host))
 	}
 
 	return isSynced, nil
@@ -254,7 +254,7 @@ func (ds *DatastoreNfs) Delete() error {
 	}
 
 	for _, host := range ds.Hosts {
-		Logf("%s unmounting datastore from %s\n", ds.ID(), path.Base(host))
+		ds.Printf("unmounting datastore from %s\n", path.Base(host))
 		obj, err := ds.finder.HostSystem(ds.ctx, host)
 		if err != nil {
 			return err
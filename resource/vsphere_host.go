@@ -153,7 +153,7 @@ func (h *Host) isDnsConfigSynced() (bool, error) {
 
 // setDnsConfig configures the DNS settings on the ESXi host.
 func (h *Host) setDnsConfig() error {
-	Logf("%s configuring dns settings\n", h.ID())
+	h.Printf("configuring dns settings\n")
 
 	obj, err := h.finder.HostSystem(h.ctx, path.Join(h.Path, h.Name))
 	if err != nil {
@@ -223,7 +223,7 @@ func (h *Host) setLockdown() error {
 		return fmt.Errorf("host is at version %s, setting lockdown requires %s or above", productVersion, minVersion)
 	}
 
-	Logf("%s setting lockdown mode to %s\n", h.ID(), h.LockdownMode)
+	h.Printf("setting lockdown mode to %s\n", h.LockdownMode)
 
 	var accessManager mo.HostAccessManager
 	if err := obj.Properties(h.ctx, *host.ConfigManager.HostAccessManager, nil, &accessManager); err != nil {
@@ -313,7 +313,7 @@ func (h *Host) Create() error {
 
 // Delete disconnects the host and then removes it.
 func (h *Host) Delete() error {
-	Logf("%s removing host from %s\n", h.ID(), h.Path)
+	h.Printf("removing host from %s\n", h.Path)
 
 	obj, err := h.finder.HostSystem(h.ctx, path.Join(h.Path, h.Name))
 	if err != nil {
@@ -241,7 +241,7 @@ func (vm *VirtualMachine) isVmHardwareSynced() (bool, error) {
 
 // setVmHardware configures the virtual machine hardware.
 func (vm *VirtualMachine) setVmHardware() error {
-	Logf("%s configuring hardware\n", vm.ID())
+	vm.Printf("configuring hardware\n")
 
 	obj, err := vm.finder.VirtualMachine(vm.ctx, path.Join(vm.Path, vm.Name))
 	if err != nil {
@@ -294,7 +294,7 @@ func (vm *VirtualMachine) isVmExtraConfigSynced() (bool, error) {
 
 // setVmExtraConfig configures extra settings of the virtual machine.
 func (vm *VirtualMachine) setVmExtraConfig() error {
-	Logf("%s configuring extra settings\n", vm.ID())
+	vm.Printf("configuring extra settings\n")
 
 	obj, err := vm.finder.VirtualMachine(vm.ctx, path.Join(vm.Path, vm.Name))
 	if err != nil {
@@ -336,7 +336,7 @@ func (vm *VirtualMachine) isVmAnnotationSynced() (bool, error) {
 
 // setVmAnnotation sets the annotation property of the virtual machine.
 func (vm *VirtualMachine) setVmAnnotation() error {
-	Logf("%s setting annotation\n", vm.ID())
+	vm.Printf("setting annotation\n")
 
 	obj, err := vm.finder.VirtualMachine(vm.ctx, path.Join(vm.Path, vm.Name))
 	if err != nil {
@@ -383,7 +383,7 @@ func (vm *VirtualMachine) isVmPowerStateSynced() (bool, error) {
 // setVmPowerState sets the power state of the virtual machine in the
 // desired state.
 func (vm *VirtualMachine) setVmPowerState() error {
-	Logf("%s setting power state to %s\n", vm.ID(), vm.PowerState)
+	vm.Printf("setting power state to %s\n", vm.PowerState)
 
 	obj, err := vm.finder.VirtualMachine(vm.ctx, path.Join(vm.Path, vm.Name))
 	if err != nil {
@@ -412,12 +412,12 @@ func (vm *VirtualMachine) setVmPowerState() error {
 	}
 
 	if vm.WaitForIP && vm.PowerState == types.VirtualMachinePowerStatePoweredOn {
-		Logf("%s waiting for IP address\n", vm.ID())
+		vm.Printf("waiting for IP address\n")
 		ip, err := obj.WaitForIP(vm.ctx)
 		if err != nil {
 			return err
 		}
-		Logf("%s virtual machine IP address is %s\n", vm.ID(), ip)
+		vm.Printf("virtual machine IP address is %s\n", ip)
 	}
 
 	return nil
@@ -537,7 +537,7 @@ func (vm *VirtualMachine) newVm(f *object.Folder, p *object.ResourcePool, ds *ob
 		return errors.New("Missing hardware configuration")
 	}
 
-	Logf("%s creating virtual machine\n", vm.ID())
+	vm.Printf("creating virtual machine\n")
 
 	spec := types.VirtualMachineConfigSpec{
 		Name:              vm.Name,
@@ -563,7 +563,7 @@ func (vm *VirtualMachine) newVm(f *object.Folder, p *object.ResourcePool, ds *ob
 
 // cloneVm creates the virtual machine using a template.
 func (vm *VirtualMachine) cloneVm(f *object.Folder, p *object.ResourcePool, ds *object.Datastore, h *object.HostSystem) error {
-	Logf("%s cloning virtual machine from %s\n", vm.ID(), vm.TemplateConfig.Use)
+	vm.Printf("cloning virtual machine from %s\n", vm.TemplateConfig.Use)
 
 	obj, err := vm.finder.VirtualMachine(vm.ctx, vm.TemplateConfig.Use)
 	if err != nil {
@@ -635,7 +635,7 @@ func (vm *VirtualMachine) Create() error {
 
 // Delete removes the virtual machine.
 func (vm *VirtualMachine) Delete() error {
-	Logf("%s removing virtual machine\n", vm.ID())
+	vm.Printf("removing virtual machine\n")
 
 	obj, err := vm.finder.VirtualMachine(vm.ctx, path.Join(vm.Path, vm.Name))
 	if err != nil {
@@ -649,7 +649,7 @@ func (vm *VirtualMachine) Delete() error {
 
 	// Power off the virtual machine if it is not already
 	if powerState != types.VirtualMachinePowerStatePoweredOff {
-		Logf("%s powering off virtual machine\n", vm.ID())
+		vm.Printf("powering off virtual machine\n")
 		task, err := obj.PowerOff(vm.ctx)
 		if err != nil {
 			return err
@@ -0,0 +1,191 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WaitForFile type is a resource which waits for a file to be created
+// by an external process, e.g. a sentinel file written once some step
+// completes, so that resources depending on it are processed afterwards.
+// The resource name is the path to the file.
+//
+// Waiting for the file to appear succeeds once it exists, and
+// fails if it does not appear within the timeout. When the state is
+// absent the resource waits for the file to be removed instead.
+//
+// Example:
+//   ready = resource.wait_for_file.new("/var/run/migrations.done")
+//   ready.timeout = "10m"
+//   ready.interval = "5s"
+type WaitForFile struct {
+	Base
+
+	// Path to the file. Defaults to the resource name.
+	Path string `luar:"path"`
+
+	// Timeout for waiting for the file, e.g. "5m".
+	// Defaults to "5m".
+	Timeout string `luar:"timeout"`
+
+	// Interval at which the existence of the file is
+	// checked, e.g. "1s". Defaults to "1s".
+	Interval string `luar:"interval"`
+}
+
+// NewWaitForFile creates a new resource waiting for a file.
+func NewWaitForFile(name string) (Resource, error) {
+	w := &WaitForFile{
+		Base: Base{
+			Name:              name,
+			Type:              "wait_for_file",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		Path:     name,
+		Timeout:  "5m",
+		Interval: "1s",
+	}
+
+	return w, nil
+}
+
+// Validate validates the resource.
+func (w *WaitForFile) Validate() error {
+	if err := w.Base.Validate(); err != nil {
+		return err
+	}
+
+	if !filepath.IsAbs(w.Path) {
+		return fmt.Errorf("invalid path '%s', expected an absolute path", w.Path)
+	}
+
+	if d, err := time.ParseDuration(w.Timeout); err != nil || d < 0 {
+		return fmt.Errorf("invalid timeout '%s'", w.Timeout)
+	}
+
+	if d, err := time.ParseDuration(w.Interval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid interval '%s'", w.Interval)
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the state of the file without waiting for it.
+func (w *WaitForFile) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    w.State,
+	}
+
+	exists, err := w.exists()
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "absent"
+	if exists {
+		state.Current = "present"
+	}
+
+	return state, nil
+}
+
+// Create waits for the file to appear.
+func (w *WaitForFile) Create() error {
+	w.Printf("waiting for file to appear\n")
+
+	return w.wait(true)
+}
+
+// Delete waits for the file to be removed.
+func (w *WaitForFile) Delete() error {
+	w.Printf("waiting for file to be removed\n")
+
+	return w.wait(false)
+}
+
+// exists returns a boolean indicating whether the file exists.
+func (w *WaitForFile) exists() (bool, error) {
+	_, err := os.Stat(w.Path)
+	switch {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// wait polls the file until its existence matches the
+// given one, or returns an error once the timeout elapses.
+func (w *WaitForFile) wait(exists bool) error {
+	timeout, err := time.ParseDuration(w.Timeout)
+	if err != nil {
+		return err
+	}
+
+	interval, err := time.ParseDuration(w.Interval)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := w.exists()
+		if err != nil {
+			return err
+		}
+
+		if ok == exists {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for %s", timeout, w.Path)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "wait_for_file",
+		Provider:  NewWaitForFile,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitForFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	L := newLuaState()
+	defer L.Close()
+
+	path := filepath.Join(dir, "ready")
+	code := `
+	ready = resource.wait_for_file.new("` + path + `")
+	ready.timeout = "5s"
+	ready.interval = "10ms"
+	`
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+
+	w := luaResource(L, "ready").(*WaitForFile)
+	if err := w.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := w.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	// Another process creates the file while waiting
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ioutil.WriteFile(path, []byte("done"), 0644)
+	}()
+
+	if err := w.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = w.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "present", state.Current)
+
+	// Waiting for the file to be removed times out
+	w.Timeout = "50ms"
+	if err := w.Delete(); err == nil {
+		t.Error("want timeout error")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	w.Interval = "0s"
+	if err := w.Validate(); err == nil {
+		t.Error("want error for invalid interval")
+	}
+}
@@ -0,0 +1,565 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+// wireguardConfigDir is the directory containing the
+// WireGuard interface configuration files.
+const wireguardConfigDir = "/etc/wireguard"
+
+// wireguardInterfaceRegexp matches valid WireGuard interface names.
+var wireguardInterfaceRegexp = regexp.MustCompile(`^[a-zA-Z0-9_=+.-]{1,15}$`)
+
+// WireGuardPeer type represents a peer of a WireGuard interface.
+type WireGuardPeer struct {
+	// PublicKey of the peer.
+	PublicKey string `luar:"public_key"`
+
+	// AllowedIPs contains the addresses, from which traffic
+	// is allowed from the peer and to which traffic is routed
+	// to the peer, e.g. "10.0.0.2/32".
+	AllowedIPs []string `luar:"allowed_ips"`
+
+	// Endpoint of the peer, e.g. "vpn.example.org:51820".
+	Endpoint string `luar:"endpoint"`
+
+	// PersistentKeepalive is the interval in seconds at which
+	// keepalive packets are sent to the peer. Defaults to
+	// zero, which disables keepalive packets.
+	PersistentKeepalive int `luar:"persistent_keepalive"`
+}
+
+// WireGuard type is a resource which manages WireGuard interfaces
+// using wg-quick(8).
+//
+// The private key of the interface is never logged.
+//
+// Example:
+//   wg = resource.wireguard.new("wg0")
+//   wg.state = "present"
+//   wg.address = "10.0.0.1/24"
+//   wg.private_key = "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="
+//   wg.listen_port = 51820
+//   wg.peers = {
+//     {
+//       public_key = "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=",
+//       allowed_ips = { "10.0.0.2/32" },
+//       endpoint = "peer.example.org:51820",
+//       persistent_keepalive = 25,
+//     },
+//   }
+type WireGuard struct {
+	Base
+
+	// Interface is the name of the WireGuard interface.
+	// Defaults to the resource name.
+	Interface string `luar:"interface"`
+
+	// Address contains the comma-separated addresses
+	// of the interface, e.g. "10.0.0.1/24".
+	Address string `luar:"address"`
+
+	// PrivateKey of the interface.
+	PrivateKey string `luar:"private_key" gru:"sensitive"`
+
+	// ListenPort is the port to listen on. Defaults to
+	// zero, which chooses a port randomly.
+	ListenPort int `luar:"listen_port"`
+
+	// Peers of the interface.
+	Peers []WireGuardPeer `luar:"peers"`
+
+	// Directory containing the interface configuration files
+	configDir string `luar:"-"`
+}
+
+// NewWireGuard creates a new resource for managing WireGuard interfaces.
+func NewWireGuard(name string) (Resource, error) {
+	w := &WireGuard{
+		Base: Base{
+			Name:              name,
+			Type:              "wireguard",
+			State:             "present",
+			Require:           make([]string, 0),
+			PresentStatesList: []string{"present"},
+			AbsentStatesList:  []string{"absent"},
+			Concurrent:        true,
+			Subscribe:         make(TriggerMap),
+		},
+		Interface: name,
+		Peers:     make([]WireGuardPeer, 0),
+		configDir: wireguardConfigDir,
+	}
+
+	w.PropertyList = []Property{
+		&ResourceProperty{
+			PropertyName:         "config",
+			PropertySetFunc:      w.setConfig,
+			PropertyIsSyncedFunc: w.isConfigSynced,
+		},
+		&ResourceProperty{
+			PropertyName:         "interface",
+			PropertySetFunc:      w.setInterface,
+			PropertyIsSyncedFunc: w.isInterfaceSynced,
+		},
+	}
+
+	return w, nil
+}
+
+// Validate validates the resource.
+func (w *WireGuard) Validate() error {
+	if err := w.Base.Validate(); err != nil {
+		return err
+	}
+
+	if !wireguardInterfaceRegexp.MatchString(w.Interface) {
+		return fmt.Errorf("invalid interface name '%s'", w.Interface)
+	}
+
+	// Do not include the private key in the error
+	if !isWireGuardKey(w.PrivateKey) {
+		return errors.New("invalid private key")
+	}
+
+	for _, address := range splitWireGuardList(w.Address) {
+		if _, _, err := net.ParseCIDR(address); err != nil {
+			return fmt.Errorf("invalid address '%s'", address)
+		}
+	}
+
+	if w.ListenPort < 0 || w.ListenPort > 65535 {
+		return fmt.Errorf("invalid listen port %d", w.ListenPort)
+	}
+
+	for _, peer := range w.Peers {
+		if !isWireGuardKey(peer.PublicKey) {
+			return fmt.Errorf("invalid public key '%s'", peer.PublicKey)
+		}
+
+		for _, allowed := range peer.AllowedIPs {
+			if _, _, err := net.ParseCIDR(allowed); err != nil {
+				return fmt.Errorf("invalid allowed ip '%s'", allowed)
+			}
+		}
+
+		if peer.Endpoint != "" {
+			if _, _, err := net.SplitHostPort(peer.Endpoint); err != nil {
+				return fmt.Errorf("invalid endpoint '%s'", peer.Endpoint)
+			}
+		}
+
+		if peer.PersistentKeepalive < 0 || peer.PersistentKeepalive > 65535 {
+			return fmt.Errorf("invalid persistent keepalive %d", peer.PersistentKeepalive)
+		}
+	}
+
+	return nil
+}
+
+// path returns the path to the interface configuration file.
+func (w *WireGuard) path() string {
+	return filepath.Join(w.configDir, w.Interface+".conf")
+}
+
+// Evaluate evaluates the state of the WireGuard interface.
+// The interface is considered present if its configuration exists.
+func (w *WireGuard) Evaluate() (State, error) {
+	state := State{
+		Current: "unknown",
+		Want:    w.State,
+	}
+
+	_, err := os.Stat(w.path())
+	if os.IsNotExist(err) {
+		state.Current = "absent"
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	state.Current = "present"
+
+	return state, nil
+}
+
+// Create writes the interface configuration and brings the interface up.
+func (w *WireGuard) Create() error {
+	w.Printf("creating interface %s\n", w.Interface)
+
+	if err := w.writeConfig(); err != nil {
+		return err
+	}
+
+	return w.wgQuick("up")
+}
+
+// Delete brings the interface down and removes its configuration.
+func (w *WireGuard) Delete() error {
+	w.Printf("removing interface %s\n", w.Interface)
+
+	if _, err := w.showConf(); err == nil {
+		if err := w.wgQuick("down"); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(w.path())
+}
+
+// config returns the configuration of the interface as declared
+// by the resource. Keys are lowercase, since they are case-insensitive.
+func (w *WireGuard) config() *wireguardConfig {
+	c := &wireguardConfig{
+		settings: map[string]string{
+			"privatekey": w.PrivateKey,
+		},
+		peers: make(map[string]map[string]string),
+	}
+
+	if w.Address != "" {
+		c.settings["address"] = normalizeWireGuardList(w.Address)
+	}
+
+	if w.ListenPort != 0 {
+		c.settings["listenport"] = strconv.Itoa(w.ListenPort)
+	}
+
+	for _, peer := range w.Peers {
+		settings := map[string]string{
+			"publickey": peer.PublicKey,
+		}
+
+		if len(peer.AllowedIPs) > 0 {
+			settings["allowedips"] = normalizeWireGuardList(strings.Join(peer.AllowedIPs, ","))
+		}
+
+		if peer.Endpoint != "" {
+			settings["endpoint"] = peer.Endpoint
+		}
+
+		if peer.PersistentKeepalive != 0 {
+			settings["persistentkeepalive"] = strconv.Itoa(peer.PersistentKeepalive)
+		}
+
+		c.peers[peer.PublicKey] = settings
+	}
+
+	return c
+}
+
+// content returns the content of the interface configuration file.
+func (w *WireGuard) content() []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("# Managed by gru, do not edit\n")
+	buf.WriteString("[Interface]\n")
+	if w.Address != "" {
+		fmt.Fprintf(&buf, "Address = %s\n", w.Address)
+	}
+
+	if w.ListenPort != 0 {
+		fmt.Fprintf(&buf, "ListenPort = %d\n", w.ListenPort)
+	}
+	fmt.Fprintf(&buf, "PrivateKey = %s\n", w.PrivateKey)
+
+	for _, peer := range w.Peers {
+		buf.WriteString("\n[Peer]\n")
+		fmt.Fprintf(&buf, "PublicKey = %s\n", peer.PublicKey)
+
+		if len(peer.AllowedIPs) > 0 {
+			fmt.Fprintf(&buf, "AllowedIPs = %s\n", strings.Join(peer.AllowedIPs, ", "))
+		}
+
+		if peer.Endpoint != "" {
+			fmt.Fprintf(&buf, "Endpoint = %s\n", peer.Endpoint)
+		}
+
+		if peer.PersistentKeepalive != 0 {
+			fmt.Fprintf(&buf, "PersistentKeepalive = %d\n", peer.PersistentKeepalive)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// isConfigSynced checks whether the interface configuration file is in sync.
+func (w *WireGuard) isConfigSynced() (bool, error) {
+	data, err := ioutil.ReadFile(w.path())
+	if os.IsNotExist(err) {
+		return false, ErrResourceAbsent
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return w.config().equal(w, parseWireGuardConfig(data), false), nil
+}
+
+// setConfig writes the interface configuration file.
+func (w *WireGuard) setConfig() error {
+	w.Printf("updating %s\n", w.path())
+
+	return w.writeConfig()
+}
+
+// writeConfig writes the interface configuration file, which is
+// readable only by its owner, since it contains the private key.
+func (w *WireGuard) writeConfig() error {
+	if err := os.MkdirAll(w.configDir, 0700); err != nil {
+		return err
+	}
+
+	// WriteFile does not change the permissions of existing files
+	if err := writeFile(w.path(), w.content(), 0600); err != nil {
+		return err
+	}
+
+	return os.Chmod(w.path(), 0600)
+}
+
+// isInterfaceSynced checks whether the interface is up and its
+// runtime configuration, as reported by wg-showconf(8), is in sync.
+func (w *WireGuard) isInterfaceSynced() (bool, error) {
+	data, err := w.showConf()
+	if err != nil {
+		w.Printf("interface %s is down\n", w.Interface)
+		return false, nil
+	}
+
+	return w.config().equal(w, parseWireGuardConfig(data), true), nil
+}
+
+// setInterface brings the interface up using the current configuration.
+func (w *WireGuard) setInterface() error {
+	if _, err := w.showConf(); err == nil {
+		if err := w.wgQuick("down"); err != nil {
+			return err
+		}
+	}
+
+	return w.wgQuick("up")
+}
+
+// showConf returns the runtime configuration of the interface.
+// The output contains the private key and must not be logged.
+func (w *WireGuard) showConf() ([]byte, error) {
+	spec := utils.CommandSpec{Args: []string{"wg", "showconf", w.Interface}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Stdout, nil
+}
+
+// wgQuick brings the interface up or down using wg-quick(8).
+func (w *WireGuard) wgQuick(action string) error {
+	w.Printf("bringing interface %s %s\n", w.Interface, action)
+
+	spec := utils.CommandSpec{Args: []string{"wg-quick", action, w.path()}}
+	result, err := utils.RunCommand(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("wg-quick %s failed: %s: %s", action, err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+// wireguardConfig type contains the settings of a WireGuard
+// interface and its peers, keyed by their public keys.
+type wireguardConfig struct {
+	settings map[string]string
+	peers    map[string]map[string]string
+}
+
+// equal returns a boolean indicating whether the current configuration
+// is the same as the wanted one. When comparing against the runtime
+// configuration, settings which are specific to wg-quick(8) and
+// endpoints which are not resolved yet are ignored.
+// Values are not logged, since they include the private key.
+func (want *wireguardConfig) equal(r Resource, current *wireguardConfig, runtime bool) bool {
+	for key, value := range want.settings {
+		if runtime && key == "address" {
+			continue
+		}
+
+		if current.settings[key] != value {
+			Debugf(r, "interface setting %s is out of date\n", key)
+			return false
+		}
+	}
+
+	if len(current.peers) != len(want.peers) {
+		Debugf(r, "peers are out of date\n")
+		return false
+	}
+
+	for publicKey, settings := range want.peers {
+		peer, ok := current.peers[publicKey]
+		if !ok {
+			Debugf(r, "peer %s is missing\n", publicKey)
+			return false
+		}
+
+		for key, value := range settings {
+			if runtime && key == "endpoint" && !isResolvedEndpoint(value) {
+				continue
+			}
+
+			if peer[key] != value {
+				Debugf(r, "peer %s setting %s is out of date\n", publicKey, key)
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// parseWireGuardConfig parses a WireGuard configuration.
+// Keys are lowercase and lists of addresses are normalized.
+func parseWireGuardConfig(data []byte) *wireguardConfig {
+	c := &wireguardConfig{
+		settings: make(map[string]string),
+		peers:    make(map[string]map[string]string),
+	}
+
+	var section map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.EqualFold(line, "[Interface]"):
+			section = c.settings
+			continue
+		case strings.EqualFold(line, "[Peer]"):
+			section = make(map[string]string)
+			c.peers[fmt.Sprintf("peer-%d", len(c.peers))] = section
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if section == nil || len(kv) != 2 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := strings.TrimSpace(kv[1])
+		switch key {
+		case "address", "allowedips":
+			// Lists may be given on multiple lines
+			if section[key] != "" {
+				value = section[key] + "," + value
+			}
+			value = normalizeWireGuardList(value)
+		}
+		section[key] = value
+	}
+
+	// Key the peers by their public keys
+	peers := make(map[string]map[string]string)
+	for _, peer := range c.peers {
+		peers[peer["publickey"]] = peer
+	}
+	c.peers = peers
+
+	return c
+}
+
+// splitWireGuardList splits a comma-separated list.
+func splitWireGuardList(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// normalizeWireGuardList returns a sorted comma-separated list.
+func normalizeWireGuardList(list string) string {
+	items := splitWireGuardList(list)
+	sort.Strings(items)
+
+	return strings.Join(items, ",")
+}
+
+// isWireGuardKey returns a boolean indicating whether
+// the key is a valid base64-encoded WireGuard key.
+func isWireGuardKey(key string) bool {
+	data, err := base64.StdEncoding.DecodeString(key)
+
+	return err == nil && len(data) == 32
+}
+
+// isResolvedEndpoint returns a boolean indicating whether
+// the host of the endpoint is an IP address.
+func isResolvedEndpoint(endpoint string) bool {
+	host, _, err := net.SplitHostPort(endpoint)
+
+	return err == nil && net.ParseIP(host) != nil
+}
+
+func init() {
+	item := ProviderItem{
+		Type:      "wireguard",
+		Provider:  NewWireGuard,
+		Namespace: DefaultResourceNamespace,
+	}
+
+	RegisterProvider(item)
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/utils"
+)
+
+func TestWireGuard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-wireguard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const privateKey = "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="
+	const publicKey = "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg="
+
+	// Capture the log output in order to check for the private key
+	var logs bytes.Buffer
+	defaultLogger := DefaultConfig.Logger
+	DefaultConfig.Logger = log.New(&logs, "", 0)
+	defer func() { DefaultConfig.Logger = defaultLogger }()
+
+	// Fake the interface being brought up and down
+	var commands []string
+	var showconf []byte
+	runner := func(ctx context.Context, spec utils.CommandSpec) (utils.CommandResult, error) {
+		commands = append(commands, strings.Join(spec.Args, " "))
+		switch spec.Args[0] {
+		case "wg":
+			if showconf == nil {
+				return utils.CommandResult{}, errors.New("no such device")
+			}
+			return utils.CommandResult{Stdout: showconf}, nil
+		case "wg-quick":
+			if spec.Args[1] == "down" {
+				showconf = nil
+				return utils.CommandResult{}, nil
+			}
+
+			// wg-quick settings are not part of the runtime configuration
+			data, err := ioutil.ReadFile(spec.Args[2])
+			if err != nil {
+				return utils.CommandResult{}, err
+			}
+			showconf = bytes.Replace(data, []byte("Address = 10.0.0.1/24\n"), nil, 1)
+			showconf = bytes.Replace(showconf, []byte("peer.example.org"), []byte("192.0.2.1"), 1)
+		}
+
+		return utils.CommandResult{}, nil
+	}
+
+	defaultRunner := utils.DefaultCommandRunner
+	utils.DefaultCommandRunner = utils.CommandRunnerFunc(runner)
+	defer func() { utils.DefaultCommandRunner = defaultRunner }()
+
+	r, err := NewWireGuard("wg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := r.(*WireGuard)
+	w.configDir = dir
+	w.Address = "10.0.0.1/24"
+	w.PrivateKey = privateKey
+	w.ListenPort = 51820
+	w.Peers = []WireGuardPeer{
+		{
+			PublicKey:           publicKey,
+			AllowedIPs:          []string{"10.0.0.2/32", "10.0.1.0/24"},
+			Endpoint:            "peer.example.org:51820",
+			PersistentKeepalive: 25,
+		},
+	}
+	if err := w.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := w.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, "absent", state.Current)
+
+	if err := w.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, "wg0.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, os.FileMode(0600), fi.Mode().Perm())
+
+	for _, isSynced := range []func() (bool, error){w.isConfigSynced, w.isInterfaceSynced} {
+		synced, err := isSynced()
+		if err != nil {
+			t.Fatal(err)
+		}
+		errorIfNotEqual(t, true, synced)
+	}
+
+	// Changing a peer restarts the interface
+	w.Peers[0].AllowedIPs = []string{"10.0.0.2/32"}
+	for _, p := range w.Properties() {
+		synced, err := p.IsSynced()
+		if err != nil {
+			t.Fatal(err)
+		}
+		errorIfNotEqual(t, false, synced)
+
+		if err := p.Set(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	synced, err := w.isInterfaceSynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfNotEqual(t, true, synced)
+
+	if err := w.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"wg-quick up " + filepath.Join(dir, "wg0.conf"),
+		"wg showconf wg0",
+		"wg showconf wg0",
+		"wg showconf wg0",
+		"wg-quick down " + filepath.Join(dir, "wg0.conf"),
+		"wg-quick up " + filepath.Join(dir, "wg0.conf"),
+		"wg showconf wg0",
+		"wg showconf wg0",
+		"wg-quick down " + filepath.Join(dir, "wg0.conf"),
+	}
+	errorIfNotEqual(t, want, commands)
+
+	if strings.Contains(logs.String(), privateKey) {
+		t.Error("private key must not be logged")
+	}
+
+	w.PrivateKey = "secret"
+	if err := w.Validate(); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("want error without private key, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource_amqp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dnaeon/gru/resource"
+	"github.com/streadway/amqp"
+)
+
+type published struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+type fakeChannel struct {
+	messages []published
+	closed   bool
+}
+
+func (c *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	c.messages = append(c.messages, published{exchange, key, msg})
+	return nil
+}
+
+func (c *fakeChannel) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestAMQPEventSink(t *testing.T) {
+	ch := &fakeChannel{}
+	s := &AMQPEventSink{Exchange: "gru", ch: ch}
+
+	event := resource.ResourceEvent{
+		Timestamp:     time.Unix(1500000000, 0).UTC(),
+		ResourceType:  "file",
+		ResourceTitle: "/etc/motd",
+		Action:        resource.ActionCreate,
+		Changed:       true,
+	}
+
+	if err := s.Emit(event); err != nil {
+		t.Fatal(err)
+	}
+
+	s.RoutingKey = "events"
+	if err := s.Emit(event); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ch.messages) != 2 {
+		t.Fatalf("want 2 published messages, got %d", len(ch.messages))
+	}
+
+	for i, key := range []string{"file.create", "events"} {
+		m := ch.messages[i]
+		if m.exchange != "gru" || m.key != key {
+			t.Errorf("want exchange gru and key %s, got %s and %s", key, m.exchange, m.key)
+		}
+
+		var got resource.ResourceEvent
+		if err := json.Unmarshal(m.msg.Body, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got != event {
+			t.Errorf("want event %v, got %v", event, got)
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ch.closed {
+		t.Errorf("want channel to be closed")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package resource_kafka provides an event sink, which publishes
+// resource events to a Kafka topic.
+//
+// The sink lives in a separate package, so that the Kafka client
+// is only required by programs which make use of it.
+package resource_kafka
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/dnaeon/gru/resource"
+)
+
+// KafkaEventSink type is an event sink, which publishes
+// resource events as JSON messages to a Kafka topic.
+//
+// Messages are keyed by the resource id, so that all events
+// for a resource end up in the same partition and are
+// consumed in order.
+type KafkaEventSink struct {
+	// Topic to which events are published
+	Topic string
+
+	producer sarama.SyncProducer
+}
+
+// NewKafkaEventSink connects to the given Kafka brokers and
+// creates a new event sink publishing to the given topic.
+func NewKafkaEventSink(brokers []string, topic string) (*KafkaEventSink, error) {
+	config := sarama.NewConfig()
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &KafkaEventSink{
+		Topic:    topic,
+		producer: producer,
+	}
+
+	return s, nil
+}
+
+// Emit publishes a single resource event.
+func (s *KafkaEventSink) Emit(event resource.ResourceEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic:     s.Topic,
+		Key:       sarama.StringEncoder(fmt.Sprintf("%s[%s]", event.ResourceType, event.ResourceTitle)),
+		Value:     sarama.ByteEncoder(body),
+		Timestamp: event.Timestamp,
+	}
+
+	_, _, err = s.producer.SendMessage(msg)
+
+	return err
+}
+
+// Close closes the producer.
+func (s *KafkaEventSink) Close() error {
+	return s.producer.Close()
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package resource_kafka
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/dnaeon/gru/resource"
+)
+
+func TestKafkaEventSink(t *testing.T) {
+	event := resource.ResourceEvent{
+		Timestamp:     time.Unix(1500000000, 0).UTC(),
+		ResourceType:  "file",
+		ResourceTitle: "/etc/motd",
+		Action:        resource.ActionUpdate,
+		Changed:       true,
+	}
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(value []byte) error {
+		var got resource.ResourceEvent
+		if err := json.Unmarshal(value, &got); err != nil {
+			return err
+		}
+
+		if got != event {
+			t.Errorf("want event %v, got %v", event, got)
+		}
+
+		return nil
+	})
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+
+	s := &KafkaEventSink{Topic: "gru", producer: producer}
+
+	if err := s.Emit(event); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Emit(event); err != sarama.ErrOutOfBrokers {
+		t.Errorf("want error %s, got %v", sarama.ErrOutOfBrokers, err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
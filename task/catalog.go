@@ -0,0 +1,219 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dnaeon/gru/catalog"
+	"github.com/pborman/uuid"
+)
+
+// DefaultMaxResultSize is the default maximum size in bytes of a
+// serialized catalog result, which is well below the default
+// size limit of values in etcd.
+const DefaultMaxResultSize = 512 * 1024
+
+// truncatedMarker is prepended to logs, which have been truncated
+const truncatedMarker = "[truncated]\n"
+
+// CatalogRun type represents a catalog, which is pushed to minions
+// and applied by them. The catalog is the source of a Lua module,
+// while the site data it refers to is fetched from an archive,
+// which is identified by its checksum.
+type CatalogRun struct {
+	// Unique id of the run
+	ID uuid.UUID `json:"id"`
+
+	// Name of the module. If no source is provided, the
+	// module is loaded from the site data using this name.
+	Module string `json:"module"`
+
+	// Lua source of the module
+	Source string `json:"source,omitempty"`
+
+	// Location of the archive containing the site data,
+	// e.g. an https:// or s3:// URL
+	SiteURL string `json:"siteUrl,omitempty"`
+
+	// Checksum of the site archive in the form of "algorithm:digest",
+	// which is used for caching the site data on minions
+	SiteChecksum string `json:"siteChecksum,omitempty"`
+
+	// Do not take any actions, just report what would be done
+	DryRun bool `json:"dryRun"`
+
+	// Variables which override the global variables
+	// declared by the module
+	Vars map[string]string `json:"vars,omitempty"`
+
+	// Time when the catalog was submitted
+	TimeSubmitted int64 `json:"timeSubmitted"`
+}
+
+// NewCatalogRun creates a new catalog run for the given module.
+func NewCatalogRun(module, source string) *CatalogRun {
+	r := &CatalogRun{
+		ID:            uuid.NewRandom(),
+		Module:        module,
+		Source:        source,
+		TimeSubmitted: time.Now().Unix(),
+	}
+
+	return r
+}
+
+// Validate validates the catalog run.
+func (r *CatalogRun) Validate() error {
+	if r.ID == nil {
+		return errors.New("missing run id")
+	}
+
+	if r.Module == "" {
+		return errors.New("missing module name")
+	}
+
+	if r.Source == "" && r.SiteURL == "" {
+		return errors.New("either module source or site archive must be provided")
+	}
+
+	if r.SiteURL != "" && r.SiteChecksum == "" {
+		return errors.New("missing checksum of site archive")
+	}
+
+	return nil
+}
+
+// CatalogResult type represents the result of
+// a catalog run, as reported by a minion.
+type CatalogResult struct {
+	// Unique id of the run
+	RunID uuid.UUID `json:"runId"`
+
+	// Minion which processed the run
+	Minion uuid.UUID `json:"minion"`
+
+	// State of the run, e.g. TaskStateSuccess
+	State string `json:"state"`
+
+	// Time when the catalog was received
+	TimeReceived int64 `json:"timeReceived"`
+
+	// Time when the catalog was processed
+	TimeProcessed int64 `json:"timeProcessed"`
+
+	// Totals and outcome of each resource
+	Report *catalog.Report `json:"report,omitempty"`
+
+	// Log of the run
+	Log string `json:"log"`
+
+	// Truncated specifies whether the log or the resource
+	// outcomes were truncated due to the size limit
+	Truncated bool `json:"truncated"`
+}
+
+// Marshal serializes the result as JSON, limiting it to max bytes.
+// Results exceeding the limit are truncated, by dropping the head of
+// the log first and then the outcomes of up-to-date resources,
+// followed by changed and failed ones. The totals are always kept.
+func (r *CatalogResult) Marshal(max int) ([]byte, error) {
+	data, err := json.Marshal(r)
+	if err != nil || max <= 0 || len(data) <= max {
+		return data, err
+	}
+
+	res := *r
+	res.Truncated = true
+
+	// Keep the tail of the log, which contains the summary
+	for len(data) > max && res.Log != "" {
+		i := len(data) - max + len(truncatedMarker)
+		if i >= len(res.Log) {
+			res.Log = ""
+		} else {
+			for i < len(res.Log) && !utf8.RuneStart(res.Log[i]) {
+				i++
+			}
+			res.Log = truncatedMarker + res.Log[i:]
+		}
+
+		if data, err = json.Marshal(&res); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(data) > max && res.Report != nil {
+		report := *res.Report
+		report.Resources = append([]catalog.ResourceReport(nil), report.Resources...)
+		sort.SliceStable(report.Resources, func(i, j int) bool {
+			return reportPriority(report.Resources[i]) > reportPriority(report.Resources[j])
+		})
+		res.Report = &report
+
+		for len(data) > max && len(report.Resources) > 0 {
+			excess := len(data) - max
+			n := len(report.Resources)
+			for n > 0 && excess > 0 {
+				n--
+				item, err := json.Marshal(report.Resources[n])
+				if err != nil {
+					return nil, err
+				}
+				excess -= len(item) + 1
+			}
+			report.Resources = report.Resources[:n]
+
+			if data, err = json.Marshal(&res); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(data) > max {
+		return nil, fmt.Errorf("result of %d bytes exceeds the max size of %d bytes", len(data), max)
+	}
+
+	return data, nil
+}
+
+// reportPriority returns the priority of a resource outcome
+// to be kept when truncating results.
+func reportPriority(rr catalog.ResourceReport) int {
+	switch {
+	case rr.Error != "":
+		return 2
+	case rr.Changed:
+		return 1
+	default:
+		return 0
+	}
+}
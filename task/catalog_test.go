@@ -0,0 +1,145 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dnaeon/gru/catalog"
+	"github.com/pborman/uuid"
+)
+
+func TestCatalogRunValidate(t *testing.T) {
+	testCases := []struct {
+		run   *CatalogRun
+		valid bool
+	}{
+		{NewCatalogRun("site", "print('hello')"), true},
+		{NewCatalogRun("", "print('hello')"), false},
+		{NewCatalogRun("site", ""), false},
+		{&CatalogRun{ID: uuid.NewRandom(), Module: "site", SiteURL: "s3://bucket/site.tar.gz"}, false},
+		{&CatalogRun{ID: uuid.NewRandom(), Module: "site", SiteURL: "s3://bucket/site.tar.gz", SiteChecksum: "sha256:0123"}, true},
+	}
+
+	for i, tc := range testCases {
+		if err := tc.run.Validate(); (err == nil) != tc.valid {
+			t.Errorf("case %d: want valid %t, got error %v", i, tc.valid, err)
+		}
+	}
+}
+
+func TestCatalogResultMarshal(t *testing.T) {
+	report := &catalog.Report{
+		Totals: catalog.Totals{UpToDate: 50, Changed: 49, Failed: 1},
+	}
+	for i := 0; i < 100; i++ {
+		rr := catalog.ResourceReport{ID: fmt.Sprintf("file[/etc/gru/%03d]", i)}
+		switch {
+		case i == 42:
+			rr.Error = "permission denied"
+		case i%2 == 0:
+			rr.Changed = true
+			rr.Action = "update"
+		}
+		report.Resources = append(report.Resources, rr)
+	}
+
+	result := &CatalogResult{
+		RunID:  uuid.NewRandom(),
+		Minion: uuid.NewRandom(),
+		State:  TaskStateSuccess,
+		Report: report,
+		Log:    strings.Repeat("processing resources\n", 1000) + "50 up-to-date, 49 changed, 1 failed\n",
+	}
+
+	// Within the limit
+	data, err := result.Marshal(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full := len(data)
+	data, err = result.Marshal(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != full {
+		t.Errorf("want %d bytes, got %d", full, len(data))
+	}
+
+	// Log truncated
+	data, err = result.Marshal(full - 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got CatalogResult
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > full-1000 || !got.Truncated || len(got.Report.Resources) != 100 {
+		t.Errorf("want truncated log only, got %d bytes and %d resources", len(data), len(got.Report.Resources))
+	}
+	if !strings.HasPrefix(got.Log, truncatedMarker) || !strings.HasSuffix(got.Log, "1 failed\n") {
+		t.Errorf("want tail of log, got %q", got.Log)
+	}
+
+	// Log and outcomes of up-to-date resources dropped
+	data, err = result.Marshal(2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got = CatalogResult{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > 2000 || got.Log != "" || got.Report.Failed != 1 || got.Report.UpToDate != 50 {
+		t.Errorf("want truncated result with totals, got %d bytes: %+v", len(data), got)
+	}
+
+	if len(got.Report.Resources) == 0 || got.Report.Resources[0].Error != "permission denied" {
+		t.Fatalf("want failed resource to be kept, got %+v", got.Report.Resources)
+	}
+	for _, rr := range got.Report.Resources[1:] {
+		if !rr.Changed {
+			t.Errorf("want only changed resources to be kept, got %+v", rr)
+		}
+	}
+
+	// The original result is left unchanged
+	if result.Truncated || len(result.Report.Resources) != 100 || result.Report.Resources[0].ID != "file[/etc/gru/000]" {
+		t.Error("want original result to be unchanged")
+	}
+
+	// Too small
+	if _, err := result.Marshal(100); err == nil {
+		t.Error("want error for result exceeding max size")
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractTarGz extracts a gzip compressed tar archive into dir.
+// Entries which would be extracted outside of dir, such as absolute
+// paths or paths containing "..", are rejected, as are links pointing
+// outside of dir. Only directories, regular files and symbolic links
+// are extracted.
+func ExtractTarGz(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	// Links are checked against the resolved directory, since
+	// the paths of the entries are resolved by archivePath
+	root, err := resolvePath(dir)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		path, err := archivePath(root, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := extractFile(tr, path, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			target := hdr.Linkname
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(path), target)
+			}
+
+			if !isWithin(root, target) && !isWithin(dir, target) {
+				return fmt.Errorf("link %s points outside of archive", hdr.Name)
+			}
+
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry %s of type %c", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+// CreateTarGz writes a gzip compressed tar archive of the content of
+// dir to w, which can be extracted using ExtractTarGz. Entries with
+// a base name in exclude are skipped, e.g. ".git". Only directories,
+// regular files and symbolic links are archived.
+func CreateTarGz(w io.Writer, dir string, exclude []string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	skip := make(map[string]bool)
+	for _, name := range exclude {
+		skip[name] = true
+	}
+
+	walkFn := func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		if skip[fi.Name()] {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		link := ""
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case !fi.IsDir() && !fi.Mode().IsRegular():
+			return fmt.Errorf("unsupported file %s of type %s", path, fi.Mode().Type())
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+
+		return err
+	}
+
+	if err := filepath.Walk(dir, walkFn); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// archivePath returns the path to which an archive entry
+// is extracted, ensuring that it is within dir, even if
+// links extracted earlier are part of the path. The last
+// component is not resolved, so that links are not written
+// through when extracting the entry.
+func archivePath(dir, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("entry %s has an absolute path", name)
+	}
+
+	rel := filepath.Clean(name)
+	parent, err := SecureJoin(dir, filepath.Dir(rel))
+	if _, ok := err.(*PathEscapeError); ok {
+		return "", fmt.Errorf("entry %s is outside of archive", name)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(parent, filepath.Base(rel))
+	if !isWithin(dir, path) {
+		return "", fmt.Errorf("entry %s is outside of archive", name)
+	}
+
+	return path, nil
+}
+
+// isWithin returns a boolean indicating whether path is within dir.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// extractFile extracts a regular file from an archive. Existing
+// files are not overwritten, so that files cannot be written
+// through symbolic links extracted earlier.
+func extractFile(r io.Reader, path string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCreateTarGz(t *testing.T) {
+	src, err := ioutil.TempDir("", "gru-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	files := map[string]string{
+		"code/site.lua":          "print('hello')\n",
+		"data/motd":              "welcome\n",
+		".git/HEAD":              "ref: refs/heads/master\n",
+		"data/.git/config":       "[core]\n",
+		"data/nested/empty.conf": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink("motd", filepath.Join(src, "data", "issue")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := CreateTarGz(&buf, src, []string{".git"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := ioutil.TempDir("", "gru-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	if err := ExtractTarGz(&buf, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err = filepath.Walk(dst, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dst, path)
+		got = append(got, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+
+	want := []string{"code/site.lua", "data/issue", "data/motd", "data/nested/empty.conf"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want files %v, got %v", want, got)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dst, "data", "issue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "welcome\n" {
+		t.Errorf("want content of link target, got %q", content)
+	}
+
+	fi, err := os.Stat(filepath.Join(dst, "code", "site.lua"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Errorf("want mode 0640, got %s", fi.Mode())
+	}
+}
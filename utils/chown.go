@@ -0,0 +1,167 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ChownOptions type contains settings used when changing the
+// ownership of multiple files.
+type ChownOptions struct {
+	// Concurrency is the number of goroutines used for changing
+	// ownership. Defaults to the number of CPUs.
+	Concurrency int
+
+	// ContinueOnError specifies whether to keep changing the
+	// ownership of the remaining files after an error.
+	// By default the first error stops any further changes.
+	ContinueOnError bool
+}
+
+// ChownError type contains the errors encountered while
+// changing the ownership of files.
+type ChownError struct {
+	// Errors contains the errors encountered for each path
+	Errors map[string]error
+}
+
+// Error implements the error interface.
+func (ce *ChownError) Error() string {
+	paths := make([]string, 0, len(ce.Errors))
+	for path := range ce.Errors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	msgs := make([]string, len(paths))
+	for i, path := range paths {
+		msgs[i] = fmt.Sprintf("%s: %s", path, ce.Errors[path])
+	}
+
+	return fmt.Sprintf("%d errors while changing ownership: %s", len(msgs), strings.Join(msgs, "; "))
+}
+
+// OwnershipChanges walks the file tree rooted at root once and
+// returns the paths, which are not owned by the given user and group
+// ids. Symbolic links are not followed, but are returned as well if
+// the ownership of the link itself differs.
+func OwnershipChanges(root string, uid, gid int, opts WalkOptions) ([]string, error) {
+	if !ownershipSupported {
+		return nil, &NotSupportedError{Op: "file ownership"}
+	}
+
+	wantUID := strconv.Itoa(uid)
+	wantGID := strconv.Itoa(gid)
+
+	var mu sync.Mutex
+	paths := make([]string, 0)
+	walkFn := func(path string, info os.FileInfo) error {
+		fileUID, fileGID, err := fileOwnerIDs(info)
+		if err != nil {
+			return err
+		}
+
+		if fileUID != wantUID || fileGID != wantGID {
+			mu.Lock()
+			paths = append(paths, path)
+			mu.Unlock()
+		}
+
+		return nil
+	}
+
+	if err := Walk(root, opts, walkFn); err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// ChownPaths changes the ownership of the given paths concurrently.
+// Symbolic links are not followed, instead the ownership of the link
+// itself is changed. Unless opts.ContinueOnError is set, no further
+// changes are made after the first error.
+func ChownPaths(paths []string, uid, gid int, opts ChownOptions) error {
+	if !ownershipSupported {
+		return &NotSupportedError{Op: "file ownership"}
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU()
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(errs) > 0 && !opts.ContinueOnError
+	}
+
+	ch := make(chan string, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range ch {
+				if failed() {
+					continue
+				}
+
+				if err := lchownFile(path, uid, gid); err != nil {
+					mu.Lock()
+					errs[path] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		if failed() {
+			break
+		}
+		ch <- path
+	}
+	close(ch)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &ChownError{Errors: errs}
+	}
+
+	return nil
+}
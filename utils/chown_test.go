@@ -0,0 +1,171 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build !windows
+
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// createTree creates a directory with the given number of files,
+// spread across sub-directories of one hundred files each.
+func createTree(t testing.TB, files int) string {
+	dir, err := ioutil.TempDir("", "gru-chown")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < files; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("dir-%d", i/100))
+		if i%100 == 0 {
+			if err := os.Mkdir(sub, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		writeTempFile(t, sub, fmt.Sprintf("file-%d", i), nil)
+	}
+
+	return dir
+}
+
+func TestOwnershipChanges(t *testing.T) {
+	dir := createTree(t, 250)
+	defer os.RemoveAll(dir)
+
+	uid, gid := os.Getuid(), os.Getgid()
+	paths, err := OwnershipChanges(dir, uid, gid, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 0 {
+		t.Errorf("want no ownership changes, got %d", len(paths))
+	}
+
+	// Root directory, three sub-directories and their files
+	paths, err = OwnershipChanges(dir, uid+1, gid, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 254 {
+		t.Errorf("want 254 ownership changes, got %d", len(paths))
+	}
+
+	if err := ChownPaths(paths, uid, gid, ChownOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChownPathsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-chown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths := []string{
+		writeTempFile(t, dir, "foo", nil),
+		filepath.Join(dir, "missing-1"),
+		filepath.Join(dir, "missing-2"),
+		filepath.Join(dir, "missing-3"),
+	}
+
+	testCases := []struct {
+		continueOnError bool
+		want            int
+	}{
+		{false, 1},
+		{true, 3},
+	}
+
+	for _, tc := range testCases {
+		opts := ChownOptions{Concurrency: 1, ContinueOnError: tc.continueOnError}
+		err := ChownPaths(paths, os.Getuid(), os.Getgid(), opts)
+		ce, ok := err.(*ChownError)
+		if !ok {
+			t.Fatalf("want *ChownError, got %v", err)
+		}
+
+		if len(ce.Errors) != tc.want {
+			t.Errorf("continue on error %t: want %d errors, got %d", tc.continueOnError, tc.want, len(ce.Errors))
+		}
+	}
+}
+
+func BenchmarkChownTreeSequential(b *testing.B) {
+	dir := createTree(b, 10000)
+	defer os.RemoveAll(dir)
+
+	owner, err := NewUserCache().Current()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	group, err := NewUserCache().LookupGroupId(owner.Gid)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		paths, err := WalkPath(dir, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for _, path := range paths {
+			fu := NewFileUtil(path)
+			if err := fu.SetOwner(owner.Username, group.Name); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkChownTreeBatched(b *testing.B) {
+	dir := createTree(b, 10000)
+	defer os.RemoveAll(dir)
+
+	uid, gid := os.Getuid(), os.Getgid()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		paths, err := OwnershipChanges(dir, uid+1, gid, WalkOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err := ChownPaths(paths, uid, gid, ChownOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// ErrCommandNotFound error is returned when the command to be
+// executed cannot be found.
+var ErrCommandNotFound = errors.New("Command not found")
+
+// DefaultOutputLimit is the default number of bytes captured
+// from the standard output and error of a command.
+const DefaultOutputLimit = 1 << 20
+
+// truncatedMarker is appended to captured output that was truncated.
+const truncatedMarker = "\n[... output truncated ...]\n"
+
+// CommandSpec type describes a command to be executed.
+type CommandSpec struct {
+	// Args contains the command and it's arguments.
+	// Ignored if Shell is not empty.
+	Args []string
+
+	// Shell is a command to be executed by /bin/sh.
+	Shell string
+
+	// Dir is the working directory of the command.
+	// Defaults to the current working directory.
+	Dir string
+
+	// Env contains additional environment variables in
+	// the form "key=value".
+	Env []string
+
+	// ReplaceEnv specifies whether Env replaces the environment
+	// of the current process instead of being merged with it.
+	ReplaceEnv bool
+
+	// User is the name of the user to run the command as.
+	// Defaults to the currently running user.
+	User string
+
+	// Stdin is used as the standard input of the command.
+	Stdin io.Reader
+
+	// Timeout after which the command and any processes started
+	// by it are killed. Zero means no timeout.
+	Timeout time.Duration
+
+	// OutputLimit is the maximum number of bytes captured
+	// from each of the standard output and error of the command.
+	// Defaults to DefaultOutputLimit.
+	OutputLimit int
+}
+
+// CommandResult type contains the result of an executed command.
+type CommandResult struct {
+	// ExitCode of the command, -1 if it did not exit normally
+	ExitCode int
+
+	// Duration of the command execution
+	Duration time.Duration
+
+	// Captured standard output of the command
+	Stdout []byte
+
+	// Captured standard error of the command
+	Stderr []byte
+}
+
+// CommandRunner is the interface type for executing commands.
+// Resources should execute commands using a CommandRunner,
+// so that they can be tested without executing real commands.
+type CommandRunner interface {
+	// Run executes a command
+	Run(ctx context.Context, spec CommandSpec) (CommandResult, error)
+}
+
+// CommandRunnerFunc type is an adapter allowing the use of
+// ordinary functions as a CommandRunner.
+type CommandRunnerFunc func(ctx context.Context, spec CommandSpec) (CommandResult, error)
+
+// Run executes the command by calling f(ctx, spec).
+func (f CommandRunnerFunc) Run(ctx context.Context, spec CommandSpec) (CommandResult, error) {
+	return f(ctx, spec)
+}
+
+// DefaultCommandRunner is the CommandRunner used by RunCommand.
+var DefaultCommandRunner CommandRunner = CommandRunnerFunc(runCommand)
+
+// RunCommand executes a command using the DefaultCommandRunner.
+//
+// An error is returned if the command cannot be started, if it exits
+// with a non-zero exit code or if it times out. ErrCommandNotFound is
+// returned if the command is not found.
+func RunCommand(ctx context.Context, spec CommandSpec) (CommandResult, error) {
+	return DefaultCommandRunner.Run(ctx, spec)
+}
+
+// runCommand executes a command on the local system.
+func runCommand(ctx context.Context, spec CommandSpec) (CommandResult, error) {
+	result := CommandResult{ExitCode: -1}
+
+	args := spec.Args
+	if spec.Shell != "" {
+		args = []string{"/bin/sh", "-c", spec.Shell}
+	}
+
+	if len(args) == 0 {
+		return result, errors.New("no command specified")
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return result, ErrCommandNotFound
+	}
+
+	limit := spec.OutputLimit
+	if limit <= 0 {
+		limit = DefaultOutputLimit
+	}
+	stdout := &limitedBuffer{limit: limit}
+	stderr := &limitedBuffer{limit: limit}
+
+	cmd := exec.Command(path, args[1:]...)
+	cmd.Dir = spec.Dir
+	cmd.Stdin = spec.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = spec.Env
+	if !spec.ReplaceEnv {
+		cmd.Env = append(os.Environ(), spec.Env...)
+	}
+
+	if err := setCommandAttr(cmd, spec.User); err != nil {
+		return result, err
+	}
+
+	if spec.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, spec.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return result, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		killCommand(cmd)
+		<-done
+		err = fmt.Errorf("command killed: %s", ctx.Err())
+	}
+
+	result.Duration = time.Since(start)
+	result.Stdout = stdout.Bytes()
+	result.Stderr = stderr.Bytes()
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	return result, err
+}
+
+// limitedBuffer type is a buffer which stores up to limit bytes
+// and discards the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write implements the io.Writer interface.
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if left := lb.limit - lb.buf.Len(); n > left {
+		p = p[:left]
+		lb.truncated = true
+	}
+	lb.buf.Write(p)
+
+	// Pretend the whole input has been written, so
+	// that the command does not fail on a short write.
+	return n, nil
+}
+
+// Bytes returns the buffered bytes, followed by a marker
+// if the output has been truncated.
+func (lb *limitedBuffer) Bytes() []byte {
+	if lb.truncated {
+		return append(lb.buf.Bytes(), truncatedMarker...)
+	}
+
+	return lb.buf.Bytes()
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build !windows
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCommand(t *testing.T) {
+	spec := CommandSpec{
+		Args:  []string{"cat"},
+		Stdin: strings.NewReader("foo"),
+	}
+
+	result, err := RunCommand(context.Background(), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(result.Stdout) != "foo" {
+		t.Errorf("want stdout 'foo', got '%s'", result.Stdout)
+	}
+
+	if result.ExitCode != 0 {
+		t.Errorf("want exit code 0, got %d", result.ExitCode)
+	}
+}
+
+func TestRunCommandFailed(t *testing.T) {
+	spec := CommandSpec{
+		Shell: "echo bar >&2; exit 3",
+	}
+
+	result, err := RunCommand(context.Background(), spec)
+	if err == nil {
+		t.Fatal("want error for failed command")
+	}
+
+	if result.ExitCode != 3 {
+		t.Errorf("want exit code 3, got %d", result.ExitCode)
+	}
+
+	if string(result.Stderr) != "bar\n" {
+		t.Errorf("want stderr 'bar', got '%s'", result.Stderr)
+	}
+}
+
+func TestRunCommandNotFound(t *testing.T) {
+	spec := CommandSpec{
+		Args: []string{"/non/existing/command"},
+	}
+
+	if _, err := RunCommand(context.Background(), spec); err != ErrCommandNotFound {
+		t.Errorf("want ErrCommandNotFound, got %v", err)
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	// The child process should be killed as well
+	spec := CommandSpec{
+		Shell:   "sleep 10 & sleep 10; wait",
+		Timeout: 100 * time.Millisecond,
+	}
+
+	result, err := RunCommand(context.Background(), spec)
+	if err == nil {
+		t.Fatal("want error for timed out command")
+	}
+
+	if result.Duration > 5*time.Second {
+		t.Errorf("command was not killed after %s", result.Duration)
+	}
+}
+
+func TestRunCommandEnv(t *testing.T) {
+	spec := CommandSpec{
+		Shell: "echo -n $FOO$HOME",
+		Env:   []string{"FOO=foo"},
+	}
+
+	result, err := RunCommand(context.Background(), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(result.Stdout), "foo") || string(result.Stdout) == "foo" {
+		t.Errorf("want merged environment, got '%s'", result.Stdout)
+	}
+
+	spec.ReplaceEnv = true
+	result, err = RunCommand(context.Background(), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(result.Stdout) != "foo" {
+		t.Errorf("want replaced environment, got '%s'", result.Stdout)
+	}
+}
+
+func TestRunCommandOutputLimit(t *testing.T) {
+	spec := CommandSpec{
+		Args:        []string{"cat"},
+		Stdin:       bytes.NewReader(bytes.Repeat([]byte("x"), 100)),
+		OutputLimit: 10,
+	}
+
+	result, err := RunCommand(context.Background(), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Repeat("x", 10) + truncatedMarker
+	if string(result.Stdout) != want {
+		t.Errorf("want stdout '%s', got '%s'", want, result.Stdout)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"io"
+	"os"
+)
+
+// copyFile copies size bytes of content from src to dst using the
+// fastest method available. The content is cloned first, e.g. on
+// btrfs and XFS, which shares the data between the two files.
+// Otherwise the content is copied in-kernel where supported,
+// falling back to a buffered copy.
+func copyFile(dst, src *os.File, size int64, mode SparseMode) error {
+	if err := cloneFile(dst, src); err == nil {
+		return nil
+	}
+
+	return copyContent(dst, src, size, mode)
+}
+
+// copyN copies n bytes from the current offset of src to the
+// current offset of dst, using an in-kernel copy where supported
+// and a buffered copy for any remaining bytes.
+func copyN(dst, src *os.File, n int64) error {
+	copied, err := copyRange(dst, src, n)
+	if err == nil && copied == n {
+		return nil
+	}
+
+	return bufferedCopyN(dst, src, n-copied)
+}
+
+// bufferedCopyN copies n bytes from src to dst through a buffer.
+// The writer is wrapped, so that io.Copy does not delegate the
+// copy to any ReadFrom method of dst.
+func bufferedCopyN(dst io.Writer, src io.Reader, n int64) error {
+	_, err := io.CopyN(struct{ io.Writer }{dst}, src, n)
+
+	return err
+}
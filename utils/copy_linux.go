@@ -0,0 +1,72 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build linux
+
+package utils
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxCopyRange is the maximum number of bytes copied
+// by a single call to copy_file_range(2).
+const maxCopyRange = 1 << 30
+
+// cloneFile clones the content of src into dst using the FICLONE ioctl.
+// Cloning is supported only within the same filesystem and only by
+// filesystems supporting reflinks, such as btrfs and XFS.
+func cloneFile(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
+
+// copyRange copies n bytes from the current offset of src to the
+// current offset of dst using copy_file_range(2), which avoids copying
+// the data through userspace. The number of bytes copied is returned,
+// which may be less than n, in case of an error.
+func copyRange(dst, src *os.File, n int64) (int64, error) {
+	var copied int64
+	for copied < n {
+		length := n - copied
+		if length > maxCopyRange {
+			length = maxCopyRange
+		}
+
+		c, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, int(length), 0)
+		if err != nil {
+			return copied, err
+		}
+
+		// End of file reached
+		if c == 0 {
+			break
+		}
+		copied += int64(c)
+	}
+
+	return copied, nil
+}
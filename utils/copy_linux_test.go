@@ -0,0 +1,129 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build linux
+
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// benchmarkCopy copies a large file using the given copy function.
+func benchmarkCopy(b *testing.B, copyFn func(dst, src *os.File, size int64) error) {
+	dir, err := ioutil.TempDir("", "gru-copy")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const size = 64 << 20
+	src, err := os.Open(writeTempFile(b, dir, "src", bytes.Repeat([]byte("gru!"), size/4)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer src.Close()
+
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := src.Seek(0, 0); err != nil {
+			b.Fatal(err)
+		}
+
+		dst, err := os.Create(filepath.Join(dir, "dst"))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err := copyFn(dst, src, size); err != nil {
+			dst.Close()
+			b.Skipf("copy not supported: %s", err)
+		}
+		dst.Close()
+	}
+}
+
+func BenchmarkCopyClone(b *testing.B) {
+	benchmarkCopy(b, func(dst, src *os.File, size int64) error {
+		return cloneFile(dst, src)
+	})
+}
+
+func BenchmarkCopyFileRange(b *testing.B) {
+	benchmarkCopy(b, func(dst, src *os.File, size int64) error {
+		_, err := copyRange(dst, src, size)
+		return err
+	})
+}
+
+func BenchmarkCopyBuffered(b *testing.B) {
+	benchmarkCopy(b, func(dst, src *os.File, size int64) error {
+		return bufferedCopyN(dst, src, size)
+	})
+}
+
+func TestCopyN(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("gru"), 1<<16)
+	src, err := os.Open(writeTempFile(t, dir, "src", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(filepath.Join(dir, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	if err := copyN(dst, src, int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(dst.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, content) {
+		t.Error("content differs after copying")
+	}
+
+	// Copying more than available fails
+	if err := copyN(dst, src, 1); err == nil {
+		t.Error("want error when copying past the end of file")
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import "sync/atomic"
+
+// ByteCounter type counts bytes, e.g. the number of bytes written
+// to files during a run. A ByteCounter is safe for concurrent use.
+// A nil *ByteCounter counts nothing.
+type ByteCounter struct {
+	n int64
+}
+
+// NewByteCounter creates a new byte counter.
+func NewByteCounter() *ByteCounter {
+	return &ByteCounter{}
+}
+
+// Add adds n bytes to the counter.
+func (c *ByteCounter) Add(n int64) {
+	if c == nil {
+		return
+	}
+
+	atomic.AddInt64(&c.n, n)
+}
+
+// Count returns the number of bytes counted so far.
+func (c *ByteCounter) Count() int64 {
+	if c == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&c.n)
+}
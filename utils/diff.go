@@ -0,0 +1,467 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// DefaultDiffMaxSize is the default size above which
+// inputs are not diffed, but only reported as different.
+const DefaultDiffMaxSize = 16 << 20
+
+// DefaultDiffWindow is the default number of lines from each
+// input which are kept in memory when looking for common lines.
+const DefaultDiffWindow = 1000
+
+// DefaultDiffContext is the default number of
+// context lines around changes.
+const DefaultDiffContext = 3
+
+// binarySniffSize is the size of the leading part of
+// the inputs which is inspected for binary content.
+const binarySniffSize = 8000
+
+// diffBufferSize is the size of the buffers used for reading inputs.
+const diffBufferSize = 64 << 10
+
+// nearbyAnchorDistance is the number of changed lines up to which
+// common lines are looked for by comparing lines directly, which is
+// faster than indexing the window when changes are small.
+const nearbyAnchorDistance = 16
+
+// DiffOptions type contains the options used when diffing inputs.
+type DiffOptions struct {
+	// MaxSize is the size in bytes of an input above which no diff
+	// is computed. Defaults to DefaultDiffMaxSize.
+	MaxSize int64
+
+	// Window is the number of lines of each input kept in memory when
+	// looking for common lines. Changes spanning more lines than the
+	// window are reported as a deletion followed by an addition.
+	// Defaults to DefaultDiffWindow.
+	Window int
+
+	// Context is the number of unchanged lines shown around changes.
+	// Defaults to DefaultDiffContext. A negative value means that
+	// no unchanged lines are shown.
+	Context int
+}
+
+// DiffInput type represents one of the inputs being diffed.
+type DiffInput struct {
+	// Name of the input, used in the diff header
+	Name string
+
+	// Reader from which the input is read
+	Reader io.Reader
+
+	// Size of the input, or a negative value if unknown. Inputs of
+	// unknown size are diffed until they exceed the maximum size.
+	Size int64
+}
+
+// Diff writes a line-based diff of two inputs to w in the unified
+// format and returns a boolean indicating whether the inputs differ.
+//
+// The inputs are streamed, so that memory is bounded by the window
+// size, instead of the size of the inputs. Inputs larger than the
+// maximum size are only reported as being different, as are inputs
+// with binary content, which is detected early by looking for null
+// bytes and invalid UTF-8 sequences in the leading part of the inputs.
+func Diff(w io.Writer, a, b DiffInput, opts DiffOptions) (bool, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultDiffMaxSize
+	}
+
+	if opts.Window <= 0 {
+		opts.Window = DefaultDiffWindow
+	}
+
+	switch {
+	case opts.Context == 0:
+		opts.Context = DefaultDiffContext
+	case opts.Context < 0:
+		opts.Context = 0
+	}
+
+	if a.Size > opts.MaxSize || b.Size > opts.MaxSize {
+		return true, writeDiffSummary(w, a, b, "files differ (too large to diff)")
+	}
+
+	ra := bufio.NewReaderSize(a.Reader, diffBufferSize)
+	rb := bufio.NewReaderSize(b.Reader, diffBufferSize)
+	binA, err := isBinary(ra)
+	if err != nil {
+		return false, err
+	}
+
+	binB, err := isBinary(rb)
+	if err != nil {
+		return false, err
+	}
+
+	if binA || binB {
+		return true, writeDiffSummary(w, a, b, "binary files differ")
+	}
+
+	d := &differ{
+		w:    w,
+		a:    a,
+		b:    b,
+		ra:   &lineReader{r: ra, max: opts.MaxSize},
+		rb:   &lineReader{r: rb, max: opts.MaxSize},
+		opts: opts,
+	}
+
+	return d.run()
+}
+
+// writeDiffSummary writes a diff header followed by a summary line.
+func writeDiffSummary(w io.Writer, a, b DiffInput, summary string) error {
+	_, err := fmt.Fprintf(w, "--- %s\n+++ %s\n%s\n", a.Name, b.Name, summary)
+
+	return err
+}
+
+// isBinary returns a boolean indicating whether the leading part of
+// the input contains null bytes or invalid UTF-8 sequences.
+func isBinary(r *bufio.Reader) (bool, error) {
+	buf, err := r.Peek(binarySniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false, err
+	}
+
+	if bytes.IndexByte(buf, 0) >= 0 {
+		return true, nil
+	}
+
+	// Ignore a multi-byte sequence cut off at the end of the sniffed data
+	if len(buf) == binarySniffSize {
+		for i := 0; i < utf8.UTFMax && i < len(buf); i++ {
+			if utf8.RuneStart(buf[len(buf)-1-i]) {
+				if !utf8.FullRune(buf[len(buf)-1-i:]) {
+					buf = buf[:len(buf)-1-i]
+				}
+				break
+			}
+		}
+	}
+
+	return !utf8.Valid(buf), nil
+}
+
+// errDiffTooLarge error is returned by lineReader
+// when the input exceeds the maximum size.
+var errDiffTooLarge = errors.New("Input too large to diff")
+
+// lineReader type reads lines from an input,
+// bounding the total number of bytes read.
+type lineReader struct {
+	r    *bufio.Reader
+	max  int64
+	read int64
+	eof  bool
+}
+
+// next returns the next line without the trailing newline.
+// It returns io.EOF once the input is exhausted.
+func (lr *lineReader) next() (string, error) {
+	if lr.eof {
+		return "", io.EOF
+	}
+
+	var line []byte
+	for {
+		chunk, err := lr.r.ReadSlice('\n')
+		lr.read += int64(len(chunk))
+		if lr.read > lr.max {
+			return "", errDiffTooLarge
+		}
+		line = append(line, chunk...)
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		if err == io.EOF {
+			lr.eof = true
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+			return string(line), nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		return string(line[:len(line)-1]), nil
+	}
+}
+
+// differ type computes a windowed diff of two inputs.
+type differ struct {
+	w      io.Writer
+	a, b   DiffInput
+	ra, rb *lineReader
+	opts   DiffOptions
+
+	// Lines of the inputs which are yet to be processed
+	bufA, bufB []string
+
+	// Line numbers of the first lines in bufA and bufB
+	lineA, lineB int
+
+	// Unchanged lines preceding the next hunk
+	leading []string
+
+	// The hunk being built
+	hunk           []string
+	startA, startB int
+	countA, countB int
+	trailing       int
+
+	changed bool
+}
+
+// fill reads lines from r into buf, until the window is full.
+func (d *differ) fill(buf []string, r *lineReader) ([]string, error) {
+	for len(buf) < d.opts.Window {
+		line, err := r.next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return buf, err
+		}
+		buf = append(buf, line)
+	}
+
+	return buf, nil
+}
+
+// run computes the diff of the inputs.
+func (d *differ) run() (bool, error) {
+	d.lineA, d.lineB = 1, 1
+	for {
+		var err error
+		if d.bufA, err = d.fill(d.bufA, d.ra); err != nil {
+			return d.abort(err)
+		}
+
+		if d.bufB, err = d.fill(d.bufB, d.rb); err != nil {
+			return d.abort(err)
+		}
+
+		if len(d.bufA) == 0 && len(d.bufB) == 0 {
+			break
+		}
+
+		// Consume common lines
+		n := 0
+		for n < len(d.bufA) && n < len(d.bufB) && d.bufA[n] == d.bufB[n] {
+			if err := d.common(d.bufA[n]); err != nil {
+				return d.changed, err
+			}
+			n++
+		}
+
+		if n > 0 {
+			d.bufA, d.bufB = d.bufA[n:], d.bufB[n:]
+			continue
+		}
+
+		// Report the lines up to the nearest common line within the
+		// window as changed, or the whole window if there is none.
+		i, j := d.anchor()
+		for _, line := range d.bufA[:i] {
+			if err := d.change('-', line); err != nil {
+				return d.changed, err
+			}
+		}
+
+		for _, line := range d.bufB[:j] {
+			if err := d.change('+', line); err != nil {
+				return d.changed, err
+			}
+		}
+		d.bufA, d.bufB = d.bufA[i:], d.bufB[j:]
+	}
+
+	return d.changed, d.flush()
+}
+
+// abort stops the diff after an error. Inputs which turn out to
+// exceed the maximum size are reported as being different.
+func (d *differ) abort(err error) (bool, error) {
+	if err != errDiffTooLarge {
+		return d.changed, err
+	}
+
+	if err := d.flush(); err != nil {
+		return true, err
+	}
+
+	if !d.changed {
+		return true, writeDiffSummary(d.w, d.a, d.b, "files differ (too large to diff)")
+	}
+
+	_, err = io.WriteString(d.w, "files differ (too large to diff)\n")
+
+	return true, err
+}
+
+// anchor returns the positions in bufA and bufB of the nearest common
+// line, i.e. the one with the fewest changed lines preceding it.
+// If there is no common line the lengths of the buffers are returned.
+func (d *differ) anchor() (int, int) {
+	for k := 1; k <= nearbyAnchorDistance; k++ {
+		for i := 0; i <= k; i++ {
+			j := k - i
+			if i < len(d.bufA) && j < len(d.bufB) && d.bufA[i] == d.bufB[j] {
+				return i, j
+			}
+		}
+	}
+
+	index := make(map[string]int, len(d.bufB))
+	for j := len(d.bufB) - 1; j >= 0; j-- {
+		index[d.bufB[j]] = j
+	}
+
+	bestA, bestB := len(d.bufA), len(d.bufB)
+	for i := 0; i < len(d.bufA) && i < bestA+bestB; i++ {
+		j, ok := index[d.bufA[i]]
+		if ok && i+j < bestA+bestB {
+			bestA, bestB = i, j
+		}
+	}
+
+	return bestA, bestB
+}
+
+// common processes a line which is present in both inputs.
+func (d *differ) common(line string) error {
+	d.lineA++
+	d.lineB++
+
+	if d.hunk != nil && d.trailing >= d.opts.Context {
+		if err := d.flush(); err != nil {
+			return err
+		}
+	}
+
+	if d.hunk == nil {
+		d.leading = append(d.leading, line)
+		if len(d.leading) > d.opts.Context {
+			d.leading = d.leading[1:]
+		}
+		return nil
+	}
+
+	d.hunk = append(d.hunk, " "+line)
+	d.countA++
+	d.countB++
+	d.trailing++
+
+	return nil
+}
+
+// change processes a line which has been removed or added.
+func (d *differ) change(op byte, line string) error {
+	if d.hunk == nil {
+		d.hunk = make([]string, 0, len(d.leading)+1)
+		d.startA = d.lineA - len(d.leading)
+		d.startB = d.lineB - len(d.leading)
+		d.countA, d.countB = len(d.leading), len(d.leading)
+		for _, l := range d.leading {
+			d.hunk = append(d.hunk, " "+l)
+		}
+		d.leading = d.leading[:0]
+	}
+
+	d.hunk = append(d.hunk, string(op)+line)
+	d.trailing = 0
+	if op == '-' {
+		d.lineA++
+		d.countA++
+	} else {
+		d.lineB++
+		d.countB++
+	}
+
+	// Large hunks are split, so that memory stays bounded
+	if len(d.hunk) >= d.opts.Window {
+		return d.flush()
+	}
+
+	return nil
+}
+
+// flush writes the hunk being built, if any.
+func (d *differ) flush() error {
+	if d.hunk == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if !d.changed {
+		fmt.Fprintf(&buf, "--- %s\n+++ %s\n", d.a.Name, d.b.Name)
+	}
+	fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(d.startA, d.countA), hunkRange(d.startB, d.countB))
+	for _, line := range d.hunk {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	d.hunk = nil
+	d.trailing = 0
+	d.changed = true
+	_, err := d.w.Write(buf.Bytes())
+
+	return err
+}
+
+// hunkRange formats the range of a hunk in the unified format.
+func hunkRange(start, count int) string {
+	// Empty ranges refer to the line preceding them
+	if count == 0 {
+		start--
+	}
+
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build go1.18
+
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzDiff(f *testing.F) {
+	f.Add([]byte("foo\nbar\n"), []byte("foo\nbaz\n"), 3, 10)
+	f.Add([]byte(""), []byte("foo"), 0, 1)
+	f.Add([]byte("a\nb\nc\n"), []byte("c\nb\na\n"), 1, 2)
+	f.Add([]byte("foo\x00"), []byte("\xff"), 3, 10)
+
+	f.Fuzz(func(t *testing.T, a, b []byte, context, window int) {
+		opts := DiffOptions{
+			MaxSize: 1 << 16,
+			Window:  window % 64,
+			Context: context % 8,
+		}
+
+		var buf bytes.Buffer
+		inputA := DiffInput{Name: "a", Reader: bytes.NewReader(a), Size: int64(len(a))}
+		inputB := DiffInput{Name: "b", Reader: bytes.NewReader(b), Size: -1}
+		changed, err := Diff(&buf, inputA, inputB, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !changed && buf.Len() != 0 {
+			t.Errorf("want no output for unchanged inputs, got %q", buf.String())
+		}
+
+		// An input never differs from itself
+		buf.Reset()
+		inputA.Reader = bytes.NewReader(a)
+		inputB = DiffInput{Name: "b", Reader: bytes.NewReader(a), Size: int64(len(a))}
+		changed, err = Diff(&buf, inputA, inputB, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if changed && !bytes.Contains(buf.Bytes(), []byte("binary files differ")) {
+			t.Errorf("want no diff of input with itself, got %q", buf.String())
+		}
+	})
+}
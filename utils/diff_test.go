@@ -0,0 +1,167 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// diffStrings returns the diff of two strings.
+func diffStrings(t *testing.T, a, b string, opts DiffOptions) (bool, string) {
+	var buf bytes.Buffer
+	changed, err := Diff(
+		&buf,
+		DiffInput{Name: "a", Reader: strings.NewReader(a), Size: int64(len(a))},
+		DiffInput{Name: "b", Reader: strings.NewReader(b), Size: int64(len(b))},
+		opts,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return changed, buf.String()
+}
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		a, b    string
+		opts    DiffOptions
+		changed bool
+		want    string
+	}{
+		{"foo\nbar\n", "foo\nbar\n", DiffOptions{}, false, ""},
+		{"", "", DiffOptions{}, false, ""},
+		{
+			"foo\nbar\nqux\n", "foo\nbaz\nqux\n", DiffOptions{}, true,
+			"--- a\n+++ b\n@@ -1,3 +1,3 @@\n foo\n-bar\n+baz\n qux\n",
+		},
+		{
+			"", "foo\n", DiffOptions{}, true,
+			"--- a\n+++ b\n@@ -0,0 +1 @@\n+foo\n",
+		},
+		{
+			"foo\nbar\n", "foo\n", DiffOptions{}, true,
+			"--- a\n+++ b\n@@ -1,2 +1 @@\n foo\n-bar\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "1\nx\n3\n4\n5\n6\n7\n8\ny\n10\n", DiffOptions{Context: 1}, true,
+			"--- a\n+++ b\n@@ -1,3 +1,3 @@\n 1\n-2\n+x\n 3\n@@ -8,3 +8,3 @@\n 8\n-9\n+y\n 10\n",
+		},
+		{
+			"1\n2\n3\n", "1\n3\n", DiffOptions{Context: -1}, true,
+			"--- a\n+++ b\n@@ -2 +1,0 @@\n-2\n",
+		},
+		{
+			"foo\n", "bar\n", DiffOptions{MaxSize: 2}, true,
+			"--- a\n+++ b\nfiles differ (too large to diff)\n",
+		},
+		{
+			"foo\x00\n", "foo\n", DiffOptions{}, true,
+			"--- a\n+++ b\nbinary files differ\n",
+		},
+		{
+			"foo\n", "\xff\xfe\n", DiffOptions{}, true,
+			"--- a\n+++ b\nbinary files differ\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		changed, got := diffStrings(t, tc.a, tc.b, tc.opts)
+		if changed != tc.changed {
+			t.Errorf("diff of %q and %q: want changed %t, got %t", tc.a, tc.b, tc.changed, changed)
+		}
+
+		if got != tc.want {
+			t.Errorf("diff of %q and %q: want\n%s\ngot\n%s", tc.a, tc.b, tc.want, got)
+		}
+	}
+}
+
+func TestDiffUnknownSize(t *testing.T) {
+	a := strings.Repeat("foo\n", 100)
+	b := strings.Repeat("bar\n", 100)
+
+	var buf bytes.Buffer
+	changed, err := Diff(
+		&buf,
+		DiffInput{Name: "a", Reader: strings.NewReader(a), Size: -1},
+		DiffInput{Name: "b", Reader: strings.NewReader(b), Size: -1},
+		DiffOptions{MaxSize: 100},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !changed || !strings.HasSuffix(buf.String(), "files differ (too large to diff)\n") {
+		t.Errorf("want inputs of unknown size to be reported as too large, got %q", buf.String())
+	}
+}
+
+func TestDiffWindow(t *testing.T) {
+	// Changes spanning more lines than the window are reported
+	// as deletions and additions, but lines in sync afterwards
+	// are still recognized as common lines.
+	var a, b strings.Builder
+	for i := 0; i < 50; i++ {
+		a.WriteString("a\n")
+		b.WriteString("b\n")
+	}
+	a.WriteString("common\n")
+	b.WriteString("common\n")
+
+	_, got := diffStrings(t, a.String()+"x\n", b.String()+"x\n", DiffOptions{Window: 10, Context: -1})
+	if strings.Contains(got, "common") || strings.Count(got, "-a\n") != 50 || strings.Count(got, "+b\n") != 50 {
+		t.Errorf("unexpected diff with small window:\n%s", got)
+	}
+}
+
+func BenchmarkDiff(b *testing.B) {
+	var x, y strings.Builder
+	for i := 0; i < 100000; i++ {
+		line := strings.Repeat("gru", i%20)
+		x.WriteString(line + "\n")
+		if i%100 == 0 {
+			y.WriteString("changed\n")
+			continue
+		}
+		y.WriteString(line + "\n")
+	}
+
+	for i := 0; i < b.N; i++ {
+		_, err := Diff(
+			ioutil.Discard,
+			DiffInput{Name: "a", Reader: strings.NewReader(x.String()), Size: int64(x.Len())},
+			DiffInput{Name: "b", Reader: strings.NewReader(y.String()), Size: int64(y.Len())},
+			DiffOptions{},
+		)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrChecksumMismatch error is returned when fetched content
+// does not match the expected checksum.
+var ErrChecksumMismatch = errors.New("Checksum mismatch")
+
+// ErrNotModified error is returned by FetchConditional when
+// the remote content has not changed.
+var ErrNotModified = errors.New("Not modified")
+
+// fetchTimeout is the timeout for fetching remote content.
+const fetchTimeout = 5 * time.Minute
+
+// FetchError type is returned when remote content cannot be fetched,
+// so that fetch failures can be distinguished from errors when
+// processing the content.
+type FetchError struct {
+	// URL of the content
+	URL string
+
+	// Err is the underlying error
+	Err error
+}
+
+// Error implements the error interface.
+func (fe *FetchError) Error() string {
+	return fmt.Sprintf("unable to fetch %s: %s", fe.URL, fe.Err)
+}
+
+// Unwrap returns the underlying error.
+func (fe *FetchError) Unwrap() error {
+	return fe.Err
+}
+
+// FetchValidators type contains the validators of fetched content,
+// which are sent in conditional requests for the content.
+type FetchValidators struct {
+	// ETag of the content
+	ETag string `json:"etag,omitempty"`
+
+	// LastModified is the modification time of the content
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// IsRemoteURL returns a boolean indicating whether
+// the location is an http://, https:// or s3:// URL.
+func IsRemoteURL(location string) bool {
+	for _, prefix := range []string{"http://", "https://", "s3://"} {
+		if strings.HasPrefix(location, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseChecksum parses a checksum in the form of "algorithm:digest".
+// Checksums without an algorithm are assumed to be sha256.
+func parseChecksum(checksum string) (hash.Hash, string, error) {
+	algorithm, digest := "sha256", checksum
+	if i := strings.Index(checksum, ":"); i >= 0 {
+		algorithm, digest = checksum[:i], checksum[i+1:]
+	}
+
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return h, strings.ToLower(digest), nil
+}
+
+// Fetch fetches remote content into w. Content is fetched over
+// http(s), using the proxy configured in the environment, or from
+// Amazon S3 for s3:// URLs. If a checksum is provided in
+// the form of "algorithm:digest", e.g. "sha256:<digest>", the content
+// is verified against it and ErrChecksumMismatch is returned if it does
+// not match. In that case w has already received the content, so the
+// caller must discard it. Any error is returned as a *FetchError.
+func Fetch(ctx context.Context, url, checksum string, w io.Writer) error {
+	_, err := FetchConditional(ctx, url, checksum, FetchValidators{}, w)
+
+	return err
+}
+
+// FetchConditional fetches remote content into w like Fetch, unless
+// the content has not changed since it was fetched with the given
+// validators, in which case ErrNotModified is returned. The validators
+// of the fetched content are returned, so that they can be stored
+// along with the content.
+func FetchConditional(ctx context.Context, url, checksum string, v FetchValidators, w io.Writer) (FetchValidators, error) {
+	var h hash.Hash
+	var digest string
+	if checksum != "" {
+		var err error
+		h, digest, err = parseChecksum(checksum)
+		if err != nil {
+			return FetchValidators{}, &FetchError{URL: url, Err: err}
+		}
+		w = io.MultiWriter(w, h)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	var req *http.Request
+	var err error
+	if strings.HasPrefix(url, "s3://") {
+		req, err = newS3Request(ctx, url)
+	} else {
+		req, err = http.NewRequest("GET", url, nil)
+	}
+
+	if err != nil {
+		return FetchValidators{}, &FetchError{URL: url, Err: err}
+	}
+
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return FetchValidators{}, &FetchError{URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	conditional := v.ETag != "" || v.LastModified != ""
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		return v, ErrNotModified
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return FetchValidators{}, &FetchError{URL: url, Err: fmt.Errorf("server returned %s", resp.Status)}
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return FetchValidators{}, &FetchError{URL: url, Err: err}
+	}
+
+	if h != nil && fmt.Sprintf("%x", h.Sum(nil)) != digest {
+		return FetchValidators{}, &FetchError{URL: url, Err: ErrChecksumMismatch}
+	}
+
+	validators := FetchValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	return validators, nil
+}
+
+// FetchArchive fetches a gzip compressed tar archive and extracts it
+// into dir. The archive is stored in a temporary file, readable only
+// by the current user, until its checksum has been verified, so that
+// nothing is extracted from archives which do not match.
+func FetchArchive(ctx context.Context, url, checksum, dir string) error {
+	tmp, err := ioutil.TempFile("", "gru-archive")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := Fetch(ctx, url, checksum, tmp); err != nil {
+		return err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := ExtractTarGz(tmp, dir); err != nil {
+		return fmt.Errorf("invalid archive %s: %s", url, err)
+	}
+
+	return nil
+}
+
+// FetchArchiveCached fetches a gzip compressed tar archive with the
+// given checksum and extracts it into a directory below cacheDir,
+// which is named after the checksum and returned. Archives already
+// extracted into the cache are not fetched again. The archive is
+// extracted into a temporary directory first, which is renamed once
+// complete, so that failed runs leave no partial content in the cache.
+func FetchArchiveCached(ctx context.Context, url, checksum, cacheDir string) (string, error) {
+	if checksum == "" {
+		return "", fmt.Errorf("checksum required for caching %s", url)
+	}
+
+	algorithm := "sha256"
+	if i := strings.Index(checksum, ":"); i >= 0 {
+		algorithm = checksum[:i]
+	}
+
+	_, digest, err := parseChecksum(checksum)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(cacheDir, algorithm+"-"+digest)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempDir(cacheDir, ".fetch-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := FetchArchive(ctx, url, checksum, tmp); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		// The archive may have been cached by a concurrent run
+		if _, statErr := os.Stat(dir); statErr == nil {
+			return dir, nil
+		}
+		return "", err
+	}
+
+	return dir, nil
+}
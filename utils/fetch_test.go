@@ -0,0 +1,324 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// tarEntry type represents an entry in a test archive.
+type tarEntry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+}
+
+// newTarGz creates a gzip compressed tar archive of the given entries.
+func newTarGz(t *testing.T, entries []tarEntry) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Mode:     0644,
+			Size:     int64(len(e.content)),
+			Linkname: e.linkname,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestFetch(t *testing.T) {
+	content := []byte("foo = 42\n")
+	digest := fmt.Sprintf("%x", sha256.Sum256(content))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/site.lua", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	testCases := []struct {
+		path     string
+		checksum string
+		wantErr  bool
+	}{
+		{"/site.lua", "", false},
+		{"/site.lua", digest, false},
+		{"/site.lua", "sha256:" + digest, false},
+		{"/site.lua", "sha256:" + digest[1:] + "0", true},
+		{"/missing.lua", "", true},
+	}
+
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		err := Fetch(context.Background(), ts.URL+tc.path, tc.checksum, &buf)
+		if tc.wantErr {
+			if _, ok := err.(*FetchError); !ok {
+				t.Errorf("%s %s: want *FetchError, got %v", tc.path, tc.checksum, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), content) {
+			t.Errorf("want content %q, got %q", content, buf.Bytes())
+		}
+	}
+}
+
+func TestFetchArchive(t *testing.T) {
+	valid := newTarGz(t, []tarEntry{
+		{name: "data/", typeflag: tar.TypeDir},
+		{name: "data/foo", typeflag: tar.TypeReg, content: "foo"},
+		{name: "data/bar", typeflag: tar.TypeSymlink, linkname: "foo"},
+	})
+
+	testCases := []struct {
+		name    string
+		archive []byte
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"absolute", newTarGz(t, []tarEntry{{name: "/etc/foo", typeflag: tar.TypeReg}}), true},
+		{"parent", newTarGz(t, []tarEntry{{name: "../foo", typeflag: tar.TypeReg}}), true},
+		{"symlink", newTarGz(t, []tarEntry{{name: "foo", typeflag: tar.TypeSymlink, linkname: "../../etc"}}), true},
+		{
+			"through-symlink",
+			newTarGz(t, []tarEntry{
+				{name: "foo", typeflag: tar.TypeSymlink, linkname: "bar"},
+				{name: "foo", typeflag: tar.TypeReg, content: "foo"},
+			}),
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(tc.archive)
+		}))
+
+		dir, err := ioutil.TempDir("", "gru-archive")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = FetchArchive(context.Background(), ts.URL, "", dir)
+		ts.Close()
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: want error, got nil", tc.name)
+			}
+			os.RemoveAll(dir)
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "data", "bar"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != "foo" {
+			t.Errorf("%s: want content %q, got %q", tc.name, "foo", data)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFetchArchiveChecksum(t *testing.T) {
+	archive := newTarGz(t, []tarEntry{{name: "foo", typeflag: tar.TypeReg, content: "foo"}})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "gru-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = FetchArchive(context.Background(), ts.URL, "sha256:0000", dir)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("want error %v, got %v", ErrChecksumMismatch, err)
+	}
+
+	// Nothing is extracted from archives with a checksum mismatch
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("want 0 extracted files, got %d", len(entries))
+	}
+}
+
+func TestFetchArchiveCached(t *testing.T) {
+	archive := newTarGz(t, []tarEntry{{name: "site.lua", typeflag: tar.TypeReg, content: "foo"}})
+	checksum := fmt.Sprintf("sha256:%x", sha256.Sum256(archive))
+
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(archive)
+	}))
+	defer ts.Close()
+
+	cacheDir, err := ioutil.TempDir("", "gru-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	if _, err := FetchArchiveCached(context.Background(), ts.URL, "", cacheDir); err == nil {
+		t.Error("want error for archive without checksum")
+	}
+
+	if _, err := FetchArchiveCached(context.Background(), ts.URL, "sha256:0000", cacheDir); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("want error %v, got %v", ErrChecksumMismatch, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		dir, err := FetchArchiveCached(context.Background(), ts.URL, checksum, cacheDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := filepath.Join(cacheDir, strings.Replace(checksum, ":", "-", 1)); dir != want {
+			t.Errorf("want directory %s, got %s", want, dir)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "site.lua"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != "foo" {
+			t.Errorf("want content %q, got %q", "foo", data)
+		}
+	}
+
+	// The mismatching archive and the cached one are fetched once each
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("want 2 requests, got %d", n)
+	}
+
+	// Only the extracted archive is left in the cache
+	entries, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("want 1 cached archive, got %d entries", len(entries))
+	}
+}
+
+func TestFetchS3(t *testing.T) {
+	var path, auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte("foo"))
+	}))
+	defer ts.Close()
+
+	env := map[string]string{
+		"AWS_ACCESS_KEY_ID":           "AKIDEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY":       "secret",
+		"AWS_REGION":                  "eu-west-1",
+		"AWS_ENDPOINT_URL":            ts.URL,
+		"AWS_CONFIG_FILE":             os.DevNull,
+		"AWS_SHARED_CREDENTIALS_FILE": os.DevNull,
+	}
+	for key, value := range env {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Setenv(key, value)
+	}
+
+	var buf bytes.Buffer
+	if err := Fetch(context.Background(), "s3://site/releases/site.tar.gz", "", &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "foo" {
+		t.Errorf("want content %q, got %q", "foo", buf.String())
+	}
+
+	if path != "/site/releases/site.tar.gz" {
+		t.Errorf("want path /site/releases/site.tar.gz, got %s", path)
+	}
+
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/eu-west-1/s3/") {
+		t.Errorf("want signed request, got authorization %q", auth)
+	}
+
+	if _, _, err := parseS3URL("s3://bucket"); err == nil {
+		t.Error("want error for S3 URL without key")
+	}
+}
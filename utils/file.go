@@ -26,23 +26,42 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strconv"
-	"syscall"
 )
 
+// blockSize is the size of the blocks at the beginning and end of
+// large files, which are compared before computing file checksums.
+const blockSize = 4096
+
+// largeFileSize is the size in bytes above which files are compared
+// block-wise before computing their checksums.
+const largeFileSize = 1 << 20
+
 // FileUtil type
 type FileUtil struct {
 	// Path to the file we manage
 	Path string
+
+	// Users is the cache used for looking up users and groups.
+	// If nil, lookups are not cached.
+	Users *UserCache
+
+	// Sparse specifies how holes in sparse files are handled
+	// when copying content. Defaults to SparseNever.
+	Sparse SparseMode
+
+	// FS is the file system on which the file resides. If nil,
+	// the file system of the operating system is used.
+	FS FileSystem
 }
 
 // FileOwner type provides details about the user and group that owns a file
@@ -53,12 +72,17 @@ type FileOwner struct {
 
 // NewFileUtil creates a file utility from the given path
 func NewFileUtil(path string) *FileUtil {
-	return &FileUtil{path}
+	return &FileUtil{Path: path}
+}
+
+// fs returns the file system on which the file resides.
+func (fu *FileUtil) fs() FileSystem {
+	return fileSystem(fu.FS)
 }
 
 // Exists returns a boolean indicating whether the file exists or not
 func (fu *FileUtil) Exists() bool {
-	_, err := os.Stat(fu.Path)
+	_, err := fu.fs().Stat(fu.Path)
 
 	return !os.IsNotExist(err)
 }
@@ -70,7 +94,7 @@ func (fu *FileUtil) Abs() (string, error) {
 
 // Md5 returns the md5 checksum of the file's contents
 func (fu *FileUtil) Md5() (string, error) {
-	buf, err := ioutil.ReadFile(fu.Path)
+	buf, err := ReadFile(fu.FS, fu.Path)
 	if err != nil {
 		return "", err
 	}
@@ -80,7 +104,7 @@ func (fu *FileUtil) Md5() (string, error) {
 
 // Sha1 returns the sha1 checksum of the file's contents
 func (fu *FileUtil) Sha1() (string, error) {
-	buf, err := ioutil.ReadFile(fu.Path)
+	buf, err := ReadFile(fu.FS, fu.Path)
 	if err != nil {
 		return "", err
 	}
@@ -90,7 +114,7 @@ func (fu *FileUtil) Sha1() (string, error) {
 
 // Sha256 returns the sha256 checksum of the file's contents
 func (fu *FileUtil) Sha256() (string, error) {
-	buf, err := ioutil.ReadFile(fu.Path)
+	buf, err := ReadFile(fu.FS, fu.Path)
 	if err != nil {
 		return "", err
 	}
@@ -100,17 +124,17 @@ func (fu *FileUtil) Sha256() (string, error) {
 
 // Remove removes the file
 func (fu *FileUtil) Remove() error {
-	return os.Remove(fu.Path)
+	return fu.fs().Remove(fu.Path)
 }
 
 // Chmod changes the permissions of the file
 func (fu *FileUtil) Chmod(perm os.FileMode) error {
-	return os.Chmod(fu.Path, perm)
+	return fu.fs().Chmod(fu.Path, perm)
 }
 
 // Mode returns the file permission bits
 func (fu *FileUtil) Mode() (os.FileMode, error) {
-	fi, err := os.Stat(fu.Path)
+	fi, err := fu.fs().Stat(fu.Path)
 	if err != nil {
 		return 0, err
 	}
@@ -120,20 +144,22 @@ func (fu *FileUtil) Mode() (os.FileMode, error) {
 
 // Owner retrieves the owner and group for the file
 func (fu *FileUtil) Owner() (*FileOwner, error) {
-	fi, err := os.Stat(fu.Path)
+	fi, err := fu.fs().Stat(fu.Path)
 	if err != nil {
 		return &FileOwner{}, err
 	}
 
-	uid := fi.Sys().(*syscall.Stat_t).Uid
-	gid := fi.Sys().(*syscall.Stat_t).Gid
+	uid, gid, err := fileOwnerIDs(fi)
+	if err != nil {
+		return &FileOwner{}, err
+	}
 
-	u, err := user.LookupId(strconv.FormatInt(int64(uid), 10))
+	u, err := fu.Users.LookupId(uid)
 	if err != nil {
 		return &FileOwner{}, err
 	}
 
-	g, err := user.LookupGroupId(strconv.FormatInt(int64(gid), 10))
+	g, err := fu.Users.LookupGroupId(gid)
 	if err != nil {
 		return &FileOwner{}, err
 	}
@@ -145,31 +171,70 @@ func (fu *FileUtil) Owner() (*FileOwner, error) {
 
 // SetOwner sets the ownership for the file
 func (fu *FileUtil) SetOwner(owner, group string) error {
-	o, err := user.Lookup(owner)
+	if !ownershipSupported && IsOSFileSystem(fu.FS) {
+		return &NotSupportedError{Op: "file ownership"}
+	}
+
+	uid, gid, err := fu.LookupOwnerIDs(owner, group)
 	if err != nil {
 		return err
 	}
 
-	g, err := user.LookupGroup(group)
+	return fu.fs().Chown(fu.Path, uid, gid)
+}
+
+// LookupOwnerIDs returns the user and group ids for the given user and group names.
+func (fu *FileUtil) LookupOwnerIDs(owner, group string) (int, int, error) {
+	o, err := fu.Users.Lookup(owner)
 	if err != nil {
-		return err
+		return 0, 0, err
+	}
+
+	g, err := fu.Users.LookupGroup(group)
+	if err != nil {
+		return 0, 0, err
 	}
 
 	uid, err := strconv.Atoi(o.Uid)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
 	gid, err := strconv.Atoi(g.Gid)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	return os.Chown(fu.Path, uid, gid)
+	return uid, gid, nil
 }
 
-// CopyFrom copies contents from another source to the current file
+// CopyFrom copies contents from another source to the current file.
+// The content is copied to a temporary file first, which is then
+// renamed to the current file, so that the file is replaced atomically.
+// The checksum of the copy is verified against the source before the
+// rename, so that the file is left untouched if verification fails.
+// Both files must reside on the file system of the file utility.
 func (fu *FileUtil) CopyFrom(srcPath string, overwrite bool) error {
+	return fu.copyFrom(srcPath, overwrite, 0, -1, -1)
+}
+
+// CopyFromAs copies contents from another source to the current file
+// the same way as CopyFrom, overwriting the file. The temporary copy
+// is given the mode perm and is owned by uid and gid before it is
+// renamed, so that no other permissions are ever observable. The
+// ownership of the file being replaced is kept if uid and gid are -1.
+func (fu *FileUtil) CopyFromAs(srcPath string, perm os.FileMode, uid, gid int) error {
+	return fu.copyFrom(srcPath, true, perm, uid, gid)
+}
+
+// copyFrom copies contents from another source to the current file.
+// The mode of the copy is perm, unless zero, in which case the mode of
+// the file being replaced or of the source is used.
+func (fu *FileUtil) copyFrom(srcPath string, overwrite bool, perm os.FileMode, uid, gid int) error {
+	if !IsOSFileSystem(fu.FS) {
+		return fu.copyFromFileSystem(srcPath, overwrite, perm, uid, gid)
+	}
+
 	srcInfo, err := os.Stat(srcPath)
 	if err != nil {
 		return err
@@ -188,34 +253,201 @@ func (fu *FileUtil) CopyFrom(srcPath string, overwrite bool) error {
 		mode = dstInfo.Mode()
 	}
 
+	if perm != 0 {
+		mode = perm
+	}
+
 	srcFile, err := os.Open(srcPath)
 	if err != nil {
 		return err
 	}
 	defer srcFile.Close()
 
-	dstFile, err := os.Create(fu.Path)
+	tmp, err := ioutil.TempFile(filepath.Dir(fu.Path), "."+filepath.Base(fu.Path))
 	if err != nil {
 		return err
 	}
-	defer dstFile.Close()
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := copyFile(tmp, srcFile, srcInfo.Size(), fu.Sparse); err != nil {
+		return err
+	}
+
+	want, err := FileSystemChecksum(nil, srcPath, "sha256")
+	if err != nil {
+		return err
+	}
+
+	if err := verifyFile(nil, tmp.Name(), fu.Path, want); err != nil {
+		return err
+	}
+
+	if err := tmp.Chmod(mode); err != nil {
+		return err
+	}
+
+	// Keep the ownership of the file being replaced,
+	// unless the copy should be owned by someone else
+	switch {
+	case uid != -1 || gid != -1:
+		if err := chownFile(tmp.Name(), uid, gid); err != nil {
+			return err
+		}
+	case dstInfo != nil:
+		if err := copyOwner(tmp, dstInfo); err != nil {
+			return err
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), fu.Path)
+}
+
+// copyFromFileSystem copies contents from another source to the current
+// file on a file system other than the one of the operating system.
+// Holes in sparse files are not preserved.
+func (fu *FileUtil) copyFromFileSystem(srcPath string, overwrite bool, perm os.FileMode, uid, gid int) error {
+	fs := fu.fs()
+	srcInfo, err := fs.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+
+	if !srcInfo.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", srcPath)
+	}
+
+	mode := srcInfo.Mode()
+	dstInfo, err := fs.Stat(fu.Path)
+	if !os.IsNotExist(err) {
+		if !overwrite {
+			return fmt.Errorf("%s already exists", fu.Path)
+		}
+		mode = dstInfo.Mode()
+	}
+
+	if perm != 0 {
+		mode = perm
+	}
+
+	data, err := ReadFile(fs, srcPath)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(fu.Path), "."+filepath.Base(fu.Path)+".tmp")
+	if err := WriteFile(fs, tmp, data, mode.Perm()); err != nil {
+		return err
+	}
+	defer fs.Remove(tmp)
+
+	if err := verifyFile(fs, tmp, fu.Path, checksum(data)); err != nil {
+		return err
+	}
+
+	if err := fs.Chmod(tmp, mode); err != nil {
+		return err
+	}
+
+	// Keep the ownership of the file being replaced,
+	// unless the copy should be owned by someone else
+	if uid == -1 && gid == -1 && dstInfo != nil {
+		u, g, err := fileOwnerIDs(dstInfo)
+		if err != nil {
+			return err
+		}
+
+		uid, err = strconv.Atoi(u)
+		if err != nil {
+			return err
+		}
+
+		gid, err = strconv.Atoi(g)
+		if err != nil {
+			return err
+		}
+	}
+
+	if uid != -1 || gid != -1 {
+		if err := fs.Chown(tmp, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	return fs.Rename(tmp, fu.Path)
+}
+
+// fileOwnerIDs returns the user and group ids of a file. File systems
+// other than the one of the operating system provide them using the
+// Sys method of the file information, e.g. MemFileSystem.
+func fileOwnerIDs(fi os.FileInfo) (string, string, error) {
+	if o, ok := fi.Sys().(interface{ OwnerIDs() (int, int) }); ok {
+		uid, gid := o.OwnerIDs()
+		return strconv.Itoa(uid), strconv.Itoa(gid), nil
+	}
+
+	return sysFileOwnerIDs(fi)
+}
+
+// copyOwner changes the ownership of a file to the owner of
+// another file, if they differ.
+func copyOwner(f *os.File, owner os.FileInfo) error {
+	if !ownershipSupported {
+		return nil
+	}
 
-	if _, err := io.Copy(dstFile, srcFile); err != nil {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	uid, gid, err := fileOwnerIDs(fi)
+	if err != nil {
 		return err
 	}
 
-	return os.Chmod(fu.Path, mode)
+	wantUID, wantGID, err := fileOwnerIDs(owner)
+	if err != nil {
+		return err
+	}
+
+	if uid == wantUID && gid == wantGID {
+		return nil
+	}
+
+	u, err := strconv.Atoi(wantUID)
+	if err != nil {
+		return err
+	}
+
+	g, err := strconv.Atoi(wantGID)
+	if err != nil {
+		return err
+	}
+
+	return chownFile(f.Name(), u, g)
 }
 
 // SameContentWith returns a boolean indicating whether the
-// content of the current file is the same as the destination
+// content of the current file is the same as the destination.
+// Checksums of the files are computed only if the cheaper
+// checks of QuickCompare are not conclusive.
 func (fu *FileUtil) SameContentWith(dst string) (bool, error) {
+	same, conclusive, err := fu.QuickCompare(dst)
+	if err != nil || conclusive {
+		return same, err
+	}
+
 	srcMd5, err := fu.Md5()
 	if err != nil {
 		return false, err
 	}
 
-	dstFile := NewFileUtil(dst)
+	dstFile := &FileUtil{Path: dst, FS: fu.FS}
 	dstMd5, err := dstFile.Md5()
 	if err != nil {
 		return false, err
@@ -224,6 +456,42 @@ func (fu *FileUtil) SameContentWith(dst string) (bool, error) {
 	return srcMd5 == dstMd5, nil
 }
 
+// QuickCompare compares the content of the current file with the
+// destination without computing any checksums. Paths referring to the
+// same file have the same content, e.g. bind mounts or links, while
+// files of different sizes differ. The first and last blocks of large
+// files are compared as well. The returned boolean indicating whether
+// the content is the same is conclusive only if the second one is true,
+// otherwise checksums of the files have to be compared.
+func (fu *FileUtil) QuickCompare(dst string) (bool, bool, error) {
+	srcInfo, err := fu.fs().Stat(fu.Path)
+	if err != nil {
+		return false, false, err
+	}
+
+	dstInfo, err := fu.fs().Stat(dst)
+	if err != nil {
+		return false, false, err
+	}
+
+	if os.SameFile(srcInfo, dstInfo) {
+		return true, true, nil
+	}
+
+	if srcInfo.Size() != dstInfo.Size() {
+		return false, true, nil
+	}
+
+	if srcInfo.Size() > largeFileSize && IsOSFileSystem(fu.FS) {
+		same, err := sameBlocks(fu.Path, dst, srcInfo.Size())
+		if err != nil || !same {
+			return false, true, err
+		}
+	}
+
+	return false, false, nil
+}
+
 // SameContent returns a boolean indicating whether two
 // files have the same content
 func SameContent(src, dst string) (bool, error) {
@@ -232,6 +500,40 @@ func SameContent(src, dst string) (bool, error) {
 	return srcFile.SameContentWith(dst)
 }
 
+// sameBlocks compares the first and last blocks of two files
+// of the given size.
+func sameBlocks(src, dst string, size int64) (bool, error) {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Open(dst)
+	if err != nil {
+		return false, err
+	}
+	defer dstFile.Close()
+
+	srcBuf := make([]byte, blockSize)
+	dstBuf := make([]byte, blockSize)
+	for _, offset := range []int64{0, size - blockSize} {
+		if _, err := srcFile.ReadAt(srcBuf, offset); err != nil {
+			return false, err
+		}
+
+		if _, err := dstFile.ReadAt(dstBuf, offset); err != nil {
+			return false, err
+		}
+
+		if !bytes.Equal(srcBuf, dstBuf) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
 // WalkPath walks a path and returns a slice of file names
 // that were found during path traversing
 func WalkPath(root string, skip []string) ([]string, error) {
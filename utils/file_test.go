@@ -0,0 +1,233 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTempFile creates a file with the given content in dir.
+func writeTempFile(t testing.TB, dir, name string, content []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestSameContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-utils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	large := bytes.Repeat([]byte("a"), largeFileSize+blockSize)
+	largeTail := append([]byte{}, large...)
+	largeTail[len(largeTail)-1] = 'b'
+	largeMiddle := append([]byte{}, large...)
+	largeMiddle[len(largeMiddle)/2] = 'b'
+
+	foo := writeTempFile(t, dir, "foo", []byte("foo"))
+	link := filepath.Join(dir, "link")
+	if err := os.Link(foo, link); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		src  string
+		dst  string
+		want bool
+	}{
+		{foo, foo, true},
+		{foo, link, true},
+		{foo, writeTempFile(t, dir, "foo-copy", []byte("foo")), true},
+		{foo, writeTempFile(t, dir, "bar", []byte("bar")), false},
+		{foo, writeTempFile(t, dir, "foobar", []byte("foobar")), false},
+		{
+			writeTempFile(t, dir, "large", large),
+			writeTempFile(t, dir, "large-copy", large),
+			true,
+		},
+		{
+			writeTempFile(t, dir, "large-1", large),
+			writeTempFile(t, dir, "large-tail", largeTail),
+			false,
+		},
+		{
+			writeTempFile(t, dir, "large-2", large),
+			writeTempFile(t, dir, "large-middle", largeMiddle),
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := SameContent(tc.src, tc.dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != tc.want {
+			t.Errorf("SameContent(%q, %q) want %t, got %t", tc.src, tc.dst, tc.want, got)
+		}
+	}
+}
+
+func TestCopyFrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-utils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := writeTempFile(t, dir, "src", bytes.Repeat([]byte("gru"), largeFileSize))
+	dst := NewFileUtil(writeTempFile(t, dir, "dst", []byte("dst")))
+	if err := os.Chmod(dst.Path, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dst.CopyFrom(src, false); err == nil {
+		t.Error("want error when not overwriting existing file")
+	}
+
+	if err := dst.CopyFrom(src, true); err != nil {
+		t.Fatal(err)
+	}
+
+	same, err := SameContent(src, dst.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !same {
+		t.Error("content differs after copying")
+	}
+
+	// The mode of the file being replaced is kept
+	mode, err := dst.Mode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode.Perm() != 0600 {
+		t.Errorf("want mode %#o, got %#o", 0600, mode.Perm())
+	}
+
+	// Copies are given the requested mode instead
+	if err := dst.CopyFromAs(src, 0640, -1, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	mode, err = dst.Mode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode.Perm() != 0640 {
+		t.Errorf("want mode %#o, got %#o", 0640, mode.Perm())
+	}
+
+	// No temporary files are left behind
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Errorf("want 2 files in directory, got %d", len(entries))
+	}
+}
+
+// benchmarkSameContent compares a directory of large identical files
+// with the files returned by dst.
+func benchmarkSameContent(b *testing.B, dst func(dir, src string) string) {
+	dir, err := ioutil.TempDir("", "gru-utils")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("gru"), 8<<20)
+	pairs := make(map[string]string)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		src := writeTempFile(b, dir, name, content)
+		pairs[src] = dst(dir, src)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for src, dst := range pairs {
+			if _, err := SameContent(src, dst); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkSameContentCopies(b *testing.B) {
+	benchmarkSameContent(b, func(dir, src string) string {
+		content, err := ioutil.ReadFile(src)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		return writeTempFile(b, dir, filepath.Base(src)+"-copy", content)
+	})
+}
+
+func BenchmarkSameContentSameFile(b *testing.B) {
+	benchmarkSameContent(b, func(dir, src string) string {
+		link := src + "-link"
+		if err := os.Link(src, link); err != nil {
+			b.Fatal(err)
+		}
+
+		return link
+	})
+}
+
+func BenchmarkSameContentDifferentSize(b *testing.B) {
+	benchmarkSameContent(b, func(dir, src string) string {
+		return writeTempFile(b, dir, filepath.Base(src)+"-small", []byte("gru"))
+	})
+}
+
+func BenchmarkSameContentDifferentTail(b *testing.B) {
+	benchmarkSameContent(b, func(dir, src string) string {
+		content, err := ioutil.ReadFile(src)
+		if err != nil {
+			b.Fatal(err)
+		}
+		content[len(content)-1] = 'x'
+
+		return writeTempFile(b, dir, filepath.Base(src)+"-tail", content)
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileEntry type contains the cached checksums of a file,
+// along with the size and modification time of the file
+// at the time the checksums were computed.
+type fileEntry struct {
+	size    int64
+	modTime time.Time
+	digests map[string]string
+}
+
+// FileCache type caches the checksums of files during a run, so that
+// files checked by multiple resources are not read more than once.
+//
+// Cached checksums are only used while the size and modification time
+// of a file are unchanged. Since modification times may be too coarse
+// to detect all changes, anything modifying files outside of the
+// resources which manage them should invalidate the affected paths.
+//
+// A FileCache is safe for concurrent use. A nil *FileCache
+// computes the checksums without caching.
+type FileCache struct {
+	// FS is the file system on which the cached files reside.
+	// If nil, the file system of the operating system is used.
+	FS FileSystem
+
+	mu      sync.Mutex
+	entries map[string]fileEntry
+}
+
+// NewFileCache creates a new empty cache for file checksums.
+func NewFileCache() *FileCache {
+	return &FileCache{
+		entries: make(map[string]fileEntry),
+	}
+}
+
+// Checksum returns the hex encoded checksum of a file using
+// the given algorithm, computing it if it is not cached.
+func (c *FileCache) Checksum(path, algorithm string) (string, error) {
+	if c == nil {
+		return FileChecksum(path, algorithm)
+	}
+
+	fi, err := fileSystem(c.FS).Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	path = filepath.Clean(path)
+	c.mu.Lock()
+	entry, ok := c.entries[path]
+	if ok && entry.size == fi.Size() && entry.modTime.Equal(fi.ModTime()) {
+		if digest, ok := entry.digests[algorithm]; ok {
+			c.mu.Unlock()
+			return digest, nil
+		}
+	}
+	c.mu.Unlock()
+
+	digest, err := FileSystemChecksum(c.FS, path, algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok = c.entries[path]
+	if !ok || entry.size != fi.Size() || !entry.modTime.Equal(fi.ModTime()) {
+		entry = fileEntry{
+			size:    fi.Size(),
+			modTime: fi.ModTime(),
+			digests: make(map[string]string),
+		}
+		c.entries[path] = entry
+	}
+	entry.digests[algorithm] = digest
+
+	return digest, nil
+}
+
+// InvalidatePath removes the cached checksums for path and,
+// if path is a directory, for all files below it.
+func (c *FileCache) InvalidatePath(path string) {
+	if c == nil {
+		return
+	}
+
+	path = filepath.Clean(path)
+	prefix := path + string(filepath.Separator)
+	if strings.HasSuffix(path, string(filepath.Separator)) {
+		prefix = path
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for p := range c.entries {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(c.entries, p)
+		}
+	}
+}
+
+// Invalidate removes all cached checksums.
+func (c *FileCache) Invalidate() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]fileEntry)
+}
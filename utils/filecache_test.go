@@ -0,0 +1,115 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-filecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	foo := filepath.Join(dir, "sub", "foo")
+	bar := filepath.Join(dir, "bar")
+	if err := os.MkdirAll(filepath.Dir(foo), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The modification time is kept unchanged when rewriting the
+	// files, so that only invalidation causes them to be re-read
+	mtime := time.Unix(1500000000, 0)
+	write := func(path, content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checksum := func(c *FileCache, path string) string {
+		digest, err := c.Checksum(path, "md5")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return digest
+	}
+
+	expect := func(want, got string) {
+		t.Helper()
+		if want != got {
+			t.Errorf("want checksum %s, got %s", want, got)
+		}
+	}
+
+	const (
+		fooMd5 = "acbd18db4cc2f85cedef654fccc4a4d8"
+		barMd5 = "37b51d194a7513e45b56f6524f2d51f2"
+		quxMd5 = "d85b1213473c2fd7c2045020a6b9c62b"
+	)
+
+	c := NewFileCache()
+	write(foo, "foo")
+	write(bar, "bar")
+	expect(fooMd5, checksum(c, foo))
+	expect(barMd5, checksum(c, bar))
+
+	// Changes which keep the size and modification
+	// time are not detected until invalidated
+	write(foo, "qux")
+	write(bar, "qux")
+	expect(fooMd5, checksum(c, foo))
+	expect(barMd5, checksum(c, bar))
+
+	c.InvalidatePath(filepath.Dir(foo))
+	expect(quxMd5, checksum(c, foo))
+	expect(barMd5, checksum(c, bar))
+
+	c.Invalidate()
+	expect(quxMd5, checksum(c, bar))
+
+	// Changes in size are always detected
+	write(foo, "foo\n")
+	expect("d3b07384d113edec49eaa6238ad5ff00", checksum(c, foo))
+
+	// A nil cache does not cache anything
+	var nilCache *FileCache
+	expect(quxMd5, checksum(nilCache, bar))
+	nilCache.InvalidatePath(bar)
+	nilCache.Invalidate()
+
+	if _, err := c.Checksum(filepath.Join(dir, "missing"), "md5"); !os.IsNotExist(err) {
+		t.Errorf("want not exist error, got %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileSystem is the interface type for the file system operations
+// used by resources, so that they can be tested against a fake
+// file system instead of the real one. Errors should be of type
+// *os.PathError or *os.LinkError, like the ones of package os.
+type FileSystem interface {
+	// Stat returns the file information, following symbolic links
+	Stat(name string) (os.FileInfo, error)
+
+	// Lstat returns the file information, without
+	// following symbolic links
+	Lstat(name string) (os.FileInfo, error)
+
+	// Open opens a file for reading
+	Open(name string) (io.ReadCloser, error)
+
+	// Create creates or truncates a file for writing. The
+	// permissions are only used when creating the file.
+	Create(name string, perm os.FileMode) (io.WriteCloser, error)
+
+	// Chmod changes the permissions of a file
+	Chmod(name string, mode os.FileMode) error
+
+	// Chown changes the user and group ids of a file
+	Chown(name string, uid, gid int) error
+
+	// Rename renames a file, replacing any existing file
+	Rename(oldname, newname string) error
+
+	// Remove removes a file or an empty directory
+	Remove(name string) error
+
+	// Symlink creates newname as a symbolic link to oldname
+	Symlink(oldname, newname string) error
+
+	// Readlink returns the target of a symbolic link
+	Readlink(name string) (string, error)
+}
+
+// OSFileSystem type implements FileSystem using the file system
+// of the operating system.
+type OSFileSystem struct{}
+
+// DefaultFileSystem is the file system used when none is given.
+var DefaultFileSystem FileSystem = OSFileSystem{}
+
+// Stat calls os.Stat.
+func (OSFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// Lstat calls os.Lstat.
+func (OSFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+// Open calls os.Open.
+func (OSFileSystem) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// Create opens the file for writing, creating or truncating it.
+func (OSFileSystem) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+// Chmod calls os.Chmod.
+func (OSFileSystem) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+// Chown changes the user and group ids of a file,
+// if supported on the current platform.
+func (OSFileSystem) Chown(name string, uid, gid int) error {
+	return chownFile(name, uid, gid)
+}
+
+// Rename calls os.Rename.
+func (OSFileSystem) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+// Remove calls os.Remove.
+func (OSFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// Symlink calls os.Symlink.
+func (OSFileSystem) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+// Readlink calls os.Readlink.
+func (OSFileSystem) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+// IsOSFileSystem returns a boolean indicating whether fs is the file
+// system of the operating system, or nil, which defaults to it.
+func IsOSFileSystem(fs FileSystem) bool {
+	_, ok := fileSystem(fs).(OSFileSystem)
+
+	return ok
+}
+
+// fileSystem returns fs, or the default file system if fs is nil.
+func fileSystem(fs FileSystem) FileSystem {
+	if fs == nil {
+		return DefaultFileSystem
+	}
+
+	return fs
+}
+
+// ReadFile reads the content of a file from the given file system.
+func ReadFile(fs FileSystem, name string) ([]byte, error) {
+	f, err := fileSystem(fs).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(f)
+}
+
+// WriteFile writes data to a file on the given file system, like
+// ioutil.WriteFile does. The permissions are only used when creating
+// the file.
+func WriteFile(fs FileSystem, name string, data []byte, perm os.FileMode) error {
+	f, err := fileSystem(fs).Create(name, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, bytes.NewReader(data)); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// WriteFileAtomic writes data to a file on the given file system by
+// writing it to a temporary file in the same directory first, which is
+// then renamed to the file, so that the file is replaced atomically.
+// The temporary file is read back and its checksum verified before the
+// rename, so that the file is left untouched if the written content
+// is corrupted, in which case a *VerifyError is returned.
+// The temporary file is created with the given permissions, and its
+// ownership is changed before the rename, unless uid or gid is -1, so
+// that the file never has broader permissions than the final ones.
+func WriteFileAtomic(fs FileSystem, name string, data []byte, perm os.FileMode, uid, gid int) error {
+	fs = fileSystem(fs)
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+"."+hex.EncodeToString(suffix))
+	if err := renameTempFile(fs, tmp, name, data, perm, uid, gid); err != nil {
+		fs.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// renameTempFile writes data to the temporary file tmp and renames it to name.
+func renameTempFile(fs FileSystem, tmp, name string, data []byte, perm os.FileMode, uid, gid int) error {
+	if err := WriteFile(fs, tmp, data, perm); err != nil {
+		return err
+	}
+
+	if err := verifyFile(fs, tmp, name, checksum(data)); err != nil {
+		return err
+	}
+
+	// The permissions used when creating the file are subject to
+	// the umask, so set them explicitly
+	if err := fs.Chmod(tmp, perm); err != nil {
+		return err
+	}
+
+	if uid != -1 || gid != -1 {
+		if err := fs.Chown(tmp, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	return fs.Rename(tmp, name)
+}
+
+// VerifyError type is returned when the checksum of
+// content read back after writing it does not match.
+type VerifyError struct {
+	// Path of the file being written
+	Path string
+
+	// Checksum of the content which was written
+	Want string
+
+	// Checksum of the content read back
+	Got string
+}
+
+// Error implements the error interface.
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("verification of content written to %s failed: checksum is sha256:%s, expected sha256:%s", e.Path, e.Got, e.Want)
+}
+
+// Unwrap returns ErrChecksumMismatch.
+func (e *VerifyError) Unwrap() error {
+	return ErrChecksumMismatch
+}
+
+// checksum returns the hex encoded sha256 checksum of data.
+func checksum(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// verifyFile reads back the file tmp, which is written in place of
+// name, and verifies that its content has the given sha256 checksum.
+func verifyFile(fs FileSystem, tmp, name, want string) error {
+	got, err := FileSystemChecksum(fs, tmp, "sha256")
+	if err != nil {
+		return err
+	}
+
+	if got != want {
+		return &VerifyError{Path: name, Want: want, Got: got}
+	}
+
+	return nil
+}
+
+// FileSystemChecksum returns the hex encoded checksum of a file's
+// contents on the given file system using the given algorithm.
+// The file is read in chunks, so that large files are not loaded
+// into memory.
+func FileSystemChecksum(fs FileSystem, name, algorithm string) (string, error) {
+	if algorithm == GitBlobAlgorithm {
+		return fileSystemGitBlobHash(fs, name)
+	}
+
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := fileSystem(fs).Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// fileSystemGitBlobHash returns the hash of a file's contents as a
+// git blob, which is prefixed with a header containing its size.
+func fileSystemGitBlobHash(fs FileSystem, name string) (string, error) {
+	fi, err := fileSystem(fs).Stat(name)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := fileSystem(fs).Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", fi.Size())
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	if n != fi.Size() {
+		return "", fmt.Errorf("%s changed while being hashed", name)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
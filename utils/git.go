@@ -26,10 +26,22 @@
 package utils
 
 import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
 	"os/exec"
 	"strings"
 )
 
+// GitBlobAlgorithm is the name of the checksum algorithm, which
+// hashes content as a git blob, like git hash-object does.
+const GitBlobAlgorithm = "git"
+
+// ErrNotGitWorkTree error is returned when a
+// directory is not within a git work tree.
+var ErrNotGitWorkTree = errors.New("not a git work tree")
+
 // GitRepo type manages a VCS repository with Git
 type GitRepo struct {
 	// Local path to the repository
@@ -108,3 +120,31 @@ func (gr *GitRepo) IsGitRepo() bool {
 
 	return true
 }
+
+// GitBlobHash returns the hash of content as a git blob.
+func GitBlobHash(data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(data))
+	h.Write(data)
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// GitCommittedBlob returns the hash of the blob committed at HEAD for
+// a path relative to dir. ErrNotGitWorkTree is returned if dir is not
+// within a git work tree, or if git is not installed.
+func GitCommittedBlob(ctx context.Context, dir, path string) (string, error) {
+	spec := CommandSpec{Args: []string{"git", "-C", dir, "rev-parse", "--is-inside-work-tree"}}
+	result, err := RunCommand(ctx, spec)
+	if err != nil || strings.TrimSpace(string(result.Stdout)) != "true" {
+		return "", ErrNotGitWorkTree
+	}
+
+	spec = CommandSpec{Args: []string{"git", "-C", dir, "rev-parse", "--verify", "--quiet", "HEAD:./" + path}}
+	result, err = RunCommand(ctx, spec)
+	if err != nil {
+		return "", fmt.Errorf("%s is not committed", path)
+	}
+
+	return strings.TrimSpace(string(result.Stdout)), nil
+}
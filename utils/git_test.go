@@ -0,0 +1,110 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitBlobHash(t *testing.T) {
+	// Hash as computed by: echo hello | git hash-object --stdin
+	want := "ce013625030ba8dba906f756967f9e9ca394464a"
+	if got := GitBlobHash([]byte("hello\n")); got != want {
+		t.Errorf("want blob hash %s, got %s", want, got)
+	}
+
+	fs := NewMemFileSystem()
+	if err := WriteFile(fs, "/hello", []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FileSystemChecksum(fs, "/hello", GitBlobAlgorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("want file blob hash %s, got %s", want, got)
+	}
+}
+
+func TestGitCommittedBlob(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir, err := ioutil.TempDir("", "gru-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := GitCommittedBlob(context.Background(), dir, "motd"); err != ErrNotGitWorkTree {
+		t.Errorf("want ErrNotGitWorkTree, got %v", err)
+	}
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=gru", "GIT_AUTHOR_EMAIL=gru@example.org",
+			"GIT_COMMITTER_NAME=gru", "GIT_COMMITTER_EMAIL=gru@example.org",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s: %s", args[0], err, out)
+		}
+	}
+
+	site := filepath.Join(dir, "site")
+	if err := os.MkdirAll(filepath.Join(site, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(site, "data", "motd"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	git("init", "--quiet")
+	git("add", ".")
+	git("commit", "--quiet", "-m", "motd")
+
+	// Paths are relative to the site repo within the work tree
+	blob, err := GitCommittedBlob(context.Background(), site, "data/motd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob != GitBlobHash([]byte("hello\n")) {
+		t.Errorf("want committed blob of data/motd, got %s", blob)
+	}
+
+	_, err = GitCommittedBlob(context.Background(), site, "data/missing")
+	if err == nil || !strings.Contains(err.Error(), "not committed") {
+		t.Errorf("want error for uncommitted file, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// gitCommitRegexp matches full Git commit hashes.
+var gitCommitRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// gitSCPRegexp matches scp-like Git locations, e.g. "git@example.org:site.git".
+var gitSCPRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]+@[a-zA-Z0-9.-]+:[^/]`)
+
+// GitSource type represents a Git repository, from which
+// content such as the site repo is fetched at a given ref.
+type GitSource struct {
+	// URL of the repository
+	URL string
+
+	// Ref to fetch, either a branch, a tag or a full commit
+	// hash. Defaults to the HEAD of the repository.
+	Ref string
+
+	// Optional token used to authenticate over http(s). Over
+	// ssh the SSH agent of the current process is used instead.
+	Token string
+
+	// Depth of the fetched history. Zero fetches only the
+	// requested commit and a negative value the full history.
+	Depth int
+}
+
+// IsGitURL returns a boolean indicating whether the location refers
+// to a Git repository, i.e. it uses the git://, ssh:// or git+<scheme>://
+// schemes, is an scp-like location or is an http(s) URL ending in ".git".
+// The location may be suffixed with "#ref".
+func IsGitURL(location string) bool {
+	if i := strings.Index(location, "#"); i >= 0 {
+		location = location[:i]
+	}
+
+	for _, prefix := range []string{"git://", "ssh://", "git+"} {
+		if strings.HasPrefix(location, prefix) {
+			return true
+		}
+	}
+
+	if IsRemoteURL(location) {
+		return strings.HasSuffix(strings.TrimSuffix(location, "/"), ".git")
+	}
+
+	return gitSCPRegexp.MatchString(location)
+}
+
+// ParseGitSource parses a Git location in the form of "url#ref". The
+// "git+" prefix of the scheme, if any, is removed from the URL.
+func ParseGitSource(location string) *GitSource {
+	s := &GitSource{URL: strings.TrimPrefix(location, "git+")}
+	if i := strings.LastIndex(s.URL, "#"); i >= 0 {
+		s.URL, s.Ref = s.URL[:i], s.URL[i+1:]
+	}
+
+	return s
+}
+
+// CacheDir returns the directory below base, in which the
+// repository is cached between runs.
+func (s *GitSource) CacheDir(base string) string {
+	return filepath.Join(base, fmt.Sprintf("%x", sha256.Sum256([]byte(s.URL)))[:16])
+}
+
+// env returns the environment used for Git commands, which
+// disables interactive prompts and passes the token, if any.
+// The token is passed in the environment rather than as an
+// argument, so that it is not visible in the process list.
+func (s *GitSource) env() []string {
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	if os.Getenv("GIT_SSH_COMMAND") == "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+
+	if s.Token != "" && IsRemoteURL(s.URL) {
+		auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + s.Token))
+		env = append(env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+		)
+	}
+
+	return env
+}
+
+// git executes a Git command in dir and returns its standard output.
+func (s *GitSource) git(ctx context.Context, dir string, args ...string) (string, error) {
+	spec := CommandSpec{
+		Args: append([]string{"git"}, args...),
+		Dir:  dir,
+		Env:  s.env(),
+	}
+
+	result, err := RunCommand(ctx, spec)
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s: %s", args[0], err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return strings.TrimSpace(string(result.Stdout)), nil
+}
+
+// Sync fetches the ref of the repository into dir, which is either
+// empty or contains a previous checkout of the repository, and checks
+// it out discarding any local changes. The commit hash of the checkout
+// is returned once verified to be at the requested ref.
+func (s *GitSource) Sync(ctx context.Context, dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", err
+		}
+
+		if _, err := s.git(ctx, dir, "init", "--quiet"); err != nil {
+			return "", err
+		}
+	}
+
+	ref := s.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	// Fetching from the URL rather than a configured remote
+	// handles changes of the URL between runs as well
+	args := []string{"fetch", "--quiet", "--force", "--no-tags"}
+	if s.Depth >= 0 {
+		depth := s.Depth
+		if depth == 0 {
+			depth = 1
+		}
+		args = append(args, fmt.Sprintf("--depth=%d", depth))
+	}
+	args = append(args, s.URL, ref)
+
+	if _, err := s.git(ctx, dir, args...); err != nil {
+		return "", &FetchError{URL: s.URL, Err: err}
+	}
+
+	fetched, err := s.git(ctx, dir, "rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := s.git(ctx, dir, "checkout", "--quiet", "--force", "--detach", fetched); err != nil {
+		return "", err
+	}
+
+	if _, err := s.git(ctx, dir, "clean", "-ffdxq"); err != nil {
+		return "", err
+	}
+
+	head, err := s.git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	if head != fetched || (gitCommitRegexp.MatchString(s.Ref) && head != s.Ref) {
+		return "", fmt.Errorf("%s is at %s, expected %s", dir, head, ref)
+	}
+
+	return head, nil
+}
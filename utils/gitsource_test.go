@@ -0,0 +1,173 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsGitURL(t *testing.T) {
+	tests := []struct {
+		location string
+		want     bool
+	}{
+		{"git@github.com:example/site.git", true},
+		{"git@github.com:example/site.git#v1.0", true},
+		{"ssh://git@example.org/site.git", true},
+		{"git://example.org/site", true},
+		{"git+https://example.org/site", true},
+		{"https://example.org/site.git#main", true},
+		{"https://example.org/site.tar.gz", false},
+		{"/var/lib/gru/site", false},
+		{"site", false},
+	}
+
+	for _, test := range tests {
+		if got := IsGitURL(test.location); got != test.want {
+			t.Errorf("%s: want %t, got %t", test.location, test.want, got)
+		}
+	}
+}
+
+func TestParseGitSource(t *testing.T) {
+	s := ParseGitSource("git+https://example.org/site#release")
+	if s.URL != "https://example.org/site" || s.Ref != "release" {
+		t.Errorf("want https://example.org/site at release, got %s at %s", s.URL, s.Ref)
+	}
+
+	s = ParseGitSource("git@example.org:site.git")
+	if s.URL != "git@example.org:site.git" || s.Ref != "" {
+		t.Errorf("want git@example.org:site.git at HEAD, got %s at %s", s.URL, s.Ref)
+	}
+
+	s.Token = "secret"
+	for _, env := range s.env() {
+		if strings.Contains(env, "Authorization") {
+			t.Errorf("want no token passed over ssh, got %s", env)
+		}
+	}
+
+	s = ParseGitSource("https://example.org/site.git")
+	s.Token = "secret"
+	if env := strings.Join(s.env(), "\n"); !strings.Contains(env, "GIT_CONFIG_VALUE_0=Authorization: Basic ") {
+		t.Errorf("want token passed in the environment, got %q", env)
+	}
+}
+
+func TestGitSourceSync(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir, err := ioutil.TempDir("", "gru-gitsource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	upstream := filepath.Join(dir, "upstream")
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", upstream}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=gru", "GIT_AUTHOR_EMAIL=gru@example.org",
+			"GIT_COMMITTER_NAME=gru", "GIT_COMMITTER_EMAIL=gru@example.org",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s: %s", args[0], err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	commit := func(content string) string {
+		if err := ioutil.WriteFile(filepath.Join(upstream, "site.lua"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "site.lua")
+		git("commit", "--quiet", "-m", content)
+		return git("rev-parse", "HEAD")
+	}
+
+	if err := os.Mkdir(upstream, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "--quiet")
+	first := commit("first")
+	git("tag", "v1")
+	second := commit("second")
+
+	check := func(s *GitSource, cache, want, content string) {
+		got, err := s.Sync(context.Background(), cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Errorf("want commit %s, got %s", want, got)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(cache, "site.lua"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != content {
+			t.Errorf("want content %q, got %q", content, data)
+		}
+	}
+
+	s := ParseGitSource("file://" + upstream)
+	cache := s.CacheDir(filepath.Join(dir, "cache"))
+	check(s, cache, second, "second")
+
+	// Local changes are discarded
+	if err := ioutil.WriteFile(filepath.Join(cache, "site.lua"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cache, "untracked.lua"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s = ParseGitSource("file://" + upstream + "#v1")
+	check(s, cache, first, "first")
+	if _, err := os.Stat(filepath.Join(cache, "untracked.lua")); !os.IsNotExist(err) {
+		t.Error("want untracked files to be removed")
+	}
+
+	s = ParseGitSource("file://" + upstream + "#" + second)
+	check(s, cache, second, "second")
+
+	s = ParseGitSource("file://" + upstream + "#missing")
+	if _, err := s.Sync(context.Background(), cache); err == nil {
+		t.Error("want error for missing ref")
+	}
+}
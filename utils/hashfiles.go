@@ -0,0 +1,189 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"os"
+	"runtime"
+	"sync"
+)
+
+// DefaultHashInFlightBytes is the default limit of the total size
+// of the files being hashed concurrently by HashFiles.
+const DefaultHashInFlightBytes = 256 << 20
+
+// HashOptions type contains settings used when hashing multiple files.
+type HashOptions struct {
+	// Algorithm used for hashing the files.
+	// Defaults to "sha256".
+	Algorithm string
+
+	// Concurrency is the number of files hashed concurrently.
+	// Defaults to the number of CPUs.
+	Concurrency int
+
+	// InFlightBytes limits the total size of the files being
+	// hashed concurrently, so that the page cache is not thrashed.
+	// Files larger than the limit are hashed one at a time.
+	// Defaults to DefaultHashInFlightBytes.
+	InFlightBytes int64
+}
+
+// HashResult type contains the results of hashing multiple files.
+type HashResult struct {
+	// Digests contains the hex encoded digests of the files
+	Digests map[string]string
+
+	// Errors contains the errors encountered for each file
+	Errors map[string]error
+}
+
+// byteLimiter type limits the number of bytes in flight.
+type byteLimiter struct {
+	sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+// acquire waits until n bytes are available and returns the number
+// of bytes acquired, which is capped at the limit. One acquisition
+// always succeeds when nothing else is in flight.
+func (l *byteLimiter) acquire(n int64) int64 {
+	if n > l.limit {
+		n = l.limit
+	}
+
+	l.Lock()
+	for l.used > 0 && l.used+n > l.limit {
+		l.cond.Wait()
+	}
+	l.used += n
+	l.Unlock()
+
+	return n
+}
+
+// release releases n previously acquired bytes.
+func (l *byteLimiter) release(n int64) {
+	l.Lock()
+	l.used -= n
+	l.Unlock()
+	l.cond.Broadcast()
+}
+
+// HashFiles computes the digests of the given files using a bounded
+// number of goroutines. Errors for individual files do not stop the
+// hashing of the remaining files, instead they are returned as part
+// of the result.
+func HashFiles(paths []string, opts HashOptions) *HashResult {
+	algorithm := opts.Algorithm
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU()
+	}
+
+	limiter := &byteLimiter{limit: opts.InFlightBytes}
+	if limiter.limit <= 0 {
+		limiter.limit = DefaultHashInFlightBytes
+	}
+	limiter.cond = sync.NewCond(limiter)
+
+	result := &HashResult{
+		Digests: make(map[string]string),
+		Errors:  make(map[string]error),
+	}
+
+	type job struct {
+		path string
+		size int64
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ch := make(chan job)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range ch {
+				digest, err := FileChecksum(j.path, algorithm)
+				limiter.release(j.size)
+
+				mu.Lock()
+				if err != nil {
+					result.Errors[j.path] = err
+				} else {
+					result.Digests[j.path] = digest
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			mu.Lock()
+			result.Errors[path] = err
+			mu.Unlock()
+			continue
+		}
+
+		ch <- job{path: path, size: limiter.acquire(fi.Size())}
+	}
+	close(ch)
+	wg.Wait()
+
+	return result
+}
+
+// HashTree computes the digests of all regular files in the
+// file tree rooted at root, using the concurrent walker for
+// finding the files and HashFiles for hashing them.
+func HashTree(root string, opts HashOptions) (*HashResult, error) {
+	var mu sync.Mutex
+	paths := make([]string, 0)
+	walkFn := func(path string, info os.FileInfo) error {
+		if info.Mode().IsRegular() {
+			mu.Lock()
+			paths = append(paths, path)
+			mu.Unlock()
+		}
+
+		return nil
+	}
+
+	if err := Walk(root, WalkOptions{Concurrency: opts.Concurrency}, walkFn); err != nil {
+		return nil, err
+	}
+
+	return HashFiles(paths, opts), nil
+}
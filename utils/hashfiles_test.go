@@ -0,0 +1,104 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestHashFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want := make(map[string]string)
+	paths := make([]string, 0)
+	for i := 0; i < 50; i++ {
+		content := []byte(fmt.Sprintf("file %d", i))
+		path := writeTempFile(t, dir, fmt.Sprintf("file-%d", i), content)
+		want[path] = fmt.Sprintf("%x", sha256.Sum256(content))
+		paths = append(paths, path)
+	}
+
+	missing := filepath.Join(dir, "missing")
+	paths = append(paths, missing)
+
+	opts := HashOptions{Concurrency: 4, InFlightBytes: 16}
+	result := HashFiles(paths, opts)
+	if !reflect.DeepEqual(want, result.Digests) {
+		t.Errorf("want digests %v, got %v", want, result.Digests)
+	}
+
+	if len(result.Errors) != 1 {
+		t.Errorf("want 1 error, got %v", result.Errors)
+	}
+
+	if !os.IsNotExist(result.Errors[missing]) {
+		t.Errorf("want not exist error for %s, got %v", missing, result.Errors[missing])
+	}
+
+	// Hashing the tree finds the same files
+	tree, err := HashTree(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, tree.Digests) || len(tree.Errors) != 0 {
+		t.Errorf("want digests %v, got %v, errors %v", want, tree.Digests, tree.Errors)
+	}
+}
+
+func TestByteLimiter(t *testing.T) {
+	l := &byteLimiter{limit: 10}
+	l.cond = sync.NewCond(l)
+
+	// Acquisitions larger than the limit are capped
+	if n := l.acquire(100); n != 10 {
+		t.Errorf("want 10 bytes acquired, got %d", n)
+	}
+
+	done := make(chan int64)
+	go func() {
+		done <- l.acquire(5)
+	}()
+
+	l.release(10)
+	if n := <-done; n != 5 {
+		t.Errorf("want 5 bytes acquired, got %d", n)
+	}
+
+	if l.used != 5 {
+		t.Errorf("want 5 bytes in flight, got %d", l.used)
+	}
+}
@@ -25,6 +25,8 @@
 
 package utils
 
+import "sort"
+
 // List type represents a slice of strings
 type List []string
 
@@ -50,6 +52,26 @@ func (l List) Contains(x string) bool {
 	return false
 }
 
+// SameStrings returns a boolean indicating whether two slices
+// contain the same strings, regardless of their order.
+func SameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	x := append([]string{}, a...)
+	y := append([]string{}, b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
 // String type represents a string
 type String struct {
 	str string
@@ -44,3 +44,28 @@ func TestStringInList(t *testing.T) {
 		t.Errorf("string %q is not in list", s)
 	}
 }
+
+func TestSameStrings(t *testing.T) {
+	testCases := []struct {
+		a, b []string
+		want bool
+	}{
+		{[]string{}, nil, true},
+		{[]string{"foo", "bar"}, []string{"bar", "foo"}, true},
+		{[]string{"foo", "foo", "bar"}, []string{"foo", "bar", "bar"}, false},
+		{[]string{"foo"}, []string{"foo", "bar"}, false},
+	}
+
+	for _, tc := range testCases {
+		if got := SameStrings(tc.a, tc.b); got != tc.want {
+			t.Errorf("SameStrings(%q, %q) = %t, want %t", tc.a, tc.b, got, tc.want)
+		}
+	}
+
+	// The slices are not reordered
+	a := []string{"foo", "bar"}
+	SameStrings(a, []string{"bar", "foo"})
+	if a[0] != "foo" {
+		t.Errorf("want slice to be left unchanged, got %q", a)
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLocked error is returned when a lock is held by another process.
+var ErrLocked = errors.New("Lock is held by another process")
+
+// lockPollInterval is the interval at which a blocking
+// acquire retries to take the lock.
+const lockPollInterval = 100 * time.Millisecond
+
+// LockOwner type contains information about the process holding a lock.
+type LockOwner struct {
+	// PID of the process holding the lock
+	PID int
+
+	// StartTime of the process holding the lock, as reported by
+	// the operating system. Used to detect reused PIDs.
+	StartTime string
+}
+
+// Alive returns whether the process holding the lock is still running.
+func (lo LockOwner) Alive() bool {
+	if !processAlive(lo.PID) {
+		return false
+	}
+
+	// A reused PID has a different start time
+	if lo.StartTime != "" {
+		if start, err := processStartTime(lo.PID); err == nil && start != "" {
+			return start == lo.StartTime
+		}
+	}
+
+	return true
+}
+
+// LockedError type is returned when a lock cannot be
+// acquired, because it is held by another process.
+type LockedError struct {
+	// Path to the lock file
+	Path string
+
+	// Owner of the lock, if known
+	Owner LockOwner
+}
+
+// Error implements the error interface.
+func (le *LockedError) Error() string {
+	if le.Owner.PID == 0 {
+		return fmt.Sprintf("%s: %s", le.Path, ErrLocked)
+	}
+
+	return fmt.Sprintf("%s: %s (pid %d)", le.Path, ErrLocked, le.Owner.PID)
+}
+
+// Is reports whether the error matches ErrLocked.
+func (le *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// FileLock type is an advisory lock on a file, which uses flock(2)
+// on Unix systems. The lock file is created if it does not exist and
+// contains the PID and start time of the process holding the lock.
+// If the process recorded in the lock file is no longer running, the
+// lock is considered stale and the lock file is replaced.
+//
+// Locks are held per FileLock, so two FileLock values for the
+// same path exclude each other, even within a single process.
+type FileLock struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewFileLock creates a new lock using the file at the given path.
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Path returns the path to the lock file.
+func (fl *FileLock) Path() string {
+	return fl.path
+}
+
+// TryLock attempts to acquire the lock without blocking. If the lock
+// is held by another process a *LockedError is returned.
+func (fl *FileLock) TryLock() error {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	if fl.file != nil {
+		return fmt.Errorf("%s: lock is already acquired", fl.path)
+	}
+
+	// Retry if the lock file was replaced while acquiring it,
+	// or if the lock held on it was stale
+	for i := 0; i < 3; i++ {
+		f, err := fl.acquire()
+		if err != nil {
+			return err
+		}
+
+		if f != nil {
+			fl.file = f
+			return nil
+		}
+	}
+
+	return &LockedError{Path: fl.path}
+}
+
+// acquire attempts once to acquire the lock. It returns a nil
+// file if the attempt should be retried.
+func (fl *FileLock) acquire() (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(fl.path), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := openLockFile(fl.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(f); err != nil {
+		defer f.Close()
+		if err != ErrLocked {
+			return nil, err
+		}
+
+		owner, _ := readLockOwner(f)
+		if owner.PID == 0 || owner.Alive() {
+			return nil, &LockedError{Path: fl.path, Owner: owner}
+		}
+
+		// The owner is gone, but the lock is still held, e.g. by a
+		// child process which inherited the file descriptor.
+		// Replace the lock file, unless it was already replaced.
+		if sameLockFile(f, fl.path) {
+			if err := os.Remove(fl.path); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	}
+
+	// The lock file could have been replaced by another process
+	// before we took the lock on it
+	if !sameLockFile(f, fl.path) {
+		unlockFile(f)
+		f.Close()
+		return nil, nil
+	}
+
+	if err := writeLockOwner(f); err != nil {
+		unlockFile(f)
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Acquire acquires the lock, blocking until the lock is available
+// or the context is done. Use a context with a timeout in order
+// to limit the time spent waiting for the lock.
+func (fl *FileLock) Acquire(ctx context.Context) error {
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := fl.TryLock()
+		if err == nil || !errors.Is(err, ErrLocked) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %s", err, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close releases the lock. Closing a lock which is
+// not acquired does nothing.
+func (fl *FileLock) Close() error {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	if fl.file == nil {
+		return nil
+	}
+
+	f := fl.file
+	fl.file = nil
+
+	// Clear the owner, so that the lock file is not
+	// considered stale after it is released
+	f.Truncate(0)
+	if err := unlockFile(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// sameLockFile returns whether the lock file at path
+// is the same file as the open file f.
+func sameLockFile(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	pi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(fi, pi)
+}
+
+// readLockOwner reads the owner of the lock from the lock file.
+func readLockOwner(f *os.File) (LockOwner, error) {
+	var owner LockOwner
+
+	if _, err := f.Seek(0, 0); err != nil {
+		return owner, err
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return owner, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return owner, nil
+	}
+
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return owner, err
+	}
+	owner.PID = pid
+
+	if len(fields) > 1 {
+		owner.StartTime = fields[1]
+	}
+
+	return owner, nil
+}
+
+// writeLockOwner writes the PID and start time of the
+// current process to the lock file.
+func writeLockOwner(f *os.File) error {
+	pid := os.Getpid()
+	start, _ := processStartTime(pid)
+	data := fmt.Sprintf("%d %s\n", pid, start)
+
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err := f.WriteAt([]byte(data), 0); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
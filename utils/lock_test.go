@@ -0,0 +1,175 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build !windows
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// tempLockPath returns the path to a lock file in a temporary directory.
+func tempLockPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "gru-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.Join(dir, "run", "gru.lock"), func() { os.RemoveAll(dir) }
+}
+
+func TestFileLock(t *testing.T) {
+	path, cleanup := tempLockPath(t)
+	defer cleanup()
+
+	first := NewFileLock(path)
+	if err := first.TryLock(); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("want lock file mode 0600, got %s", fi.Mode().Perm())
+	}
+
+	second := NewFileLock(path)
+	err = second.TryLock()
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("want ErrLocked, got %v", err)
+	}
+
+	if le, ok := err.(*LockedError); !ok || le.Owner.PID != os.Getpid() {
+		t.Errorf("want lock owned by pid %d, got %v", os.Getpid(), err)
+	}
+
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := second.TryLock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := second.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing a released lock does nothing
+	if err := second.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFileLockAcquire(t *testing.T) {
+	path, cleanup := tempLockPath(t)
+	defer cleanup()
+
+	first := NewFileLock(path)
+	if err := first.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	second := NewFileLock(path)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := second.Acquire(ctx); err == nil {
+		t.Fatal("want error when lock is held until timeout")
+	}
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("acquire returned before timeout, after %s", elapsed)
+	}
+
+	// Blocking acquire succeeds once the lock is released
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		first.Close()
+	}()
+
+	if err := second.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	second.Close()
+}
+
+func TestFileLockStale(t *testing.T) {
+	path, cleanup := tempLockPath(t)
+	defer cleanup()
+
+	// Get the PID of a process which is no longer running
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	dead := cmd.Process.Pid
+
+	// Hold the lock on behalf of the dead process, as a child
+	// process inheriting the lock file descriptor would do
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(f, "%d\n", dead)
+
+	l := NewFileLock(path)
+	if err := l.TryLock(); err != nil {
+		t.Fatalf("want stale lock to be replaced, got %v", err)
+	}
+	defer l.Close()
+
+	owner, err := readLockOwner(l.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if owner.PID != os.Getpid() || !owner.Alive() {
+		t.Errorf("want lock owned by running pid %d, got %+v", os.Getpid(), owner)
+	}
+}
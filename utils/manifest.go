@@ -0,0 +1,180 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ManifestEntry type represents a file listed in a manifest.
+type ManifestEntry struct {
+	// Path to the file relative to the manifest
+	// root, using slashes as separators
+	Path string
+
+	// Size of the file in bytes
+	Size int64
+
+	// Hex encoded SHA256 checksum of the file
+	Digest string
+}
+
+// Manifest type lists the files in a directory tree with their sizes
+// and checksums, so that the tree can be verified later on.
+//
+// The manifest is written in a simple canonical form, so that it can
+// be signed: one "<sha256> <size> <path>" line per regular file,
+// sorted by path, with each line terminated by a newline.
+type Manifest struct {
+	// Entries sorted by path
+	Entries []ManifestEntry
+}
+
+// GenerateManifest walks the directory tree rooted at root and
+// returns a manifest of all regular files in it.
+func GenerateManifest(root string, opts HashOptions) (*Manifest, error) {
+	opts.Algorithm = "sha256"
+	result, err := HashTree(root, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Errors) > 0 {
+		return nil, &WalkError{Errors: result.Errors}
+	}
+
+	m := &Manifest{Entries: make([]ManifestEntry, 0, len(result.Digests))}
+
+	for path, digest := range result.Digests {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := ManifestEntry{
+			Path:   filepath.ToSlash(rel),
+			Size:   fi.Size(),
+			Digest: digest,
+		}
+		m.Entries = append(m.Entries, entry)
+	}
+
+	sort.Slice(m.Entries, func(i, j int) bool {
+		return m.Entries[i].Path < m.Entries[j].Path
+	})
+
+	return m, nil
+}
+
+// ParseManifest parses a manifest in its canonical form.
+func ParseManifest(r io.Reader) (*Manifest, error) {
+	m := &Manifest{Entries: make([]ManifestEntry, 0)}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 || len(fields[0]) != sha256.Size*2 || fields[2] == "" {
+			return nil, fmt.Errorf("line %d: invalid manifest entry", n)
+		}
+
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("line %d: invalid size '%s'", n, fields[1])
+		}
+
+		entry := ManifestEntry{
+			Path:   fields[2],
+			Size:   size,
+			Digest: fields[0],
+		}
+
+		if k := len(m.Entries); k > 0 && m.Entries[k-1].Path >= entry.Path {
+			return nil, fmt.Errorf("line %d: entries are not sorted by path", n)
+		}
+		m.Entries = append(m.Entries, entry)
+	}
+
+	return m, scanner.Err()
+}
+
+// WriteTo writes the manifest in its canonical form to w.
+func (m *Manifest) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	for _, entry := range m.Entries {
+		fmt.Fprintf(&buf, "%s %d %s\n", entry.Digest, entry.Size, entry.Path)
+	}
+
+	return buf.WriteTo(w)
+}
+
+// Digest returns the hex encoded SHA256 checksum of the
+// manifest in its canonical form, which covers all files
+// listed in it.
+func (m *Manifest) Digest() string {
+	h := sha256.New()
+	m.WriteTo(h)
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// Compare returns the sorted paths, which are either missing from
+// one of the manifests, or differ in size or checksum between them.
+func (m *Manifest) Compare(other *Manifest) []string {
+	entries := make(map[string]ManifestEntry, len(other.Entries))
+	for _, entry := range other.Entries {
+		entries[entry.Path] = entry
+	}
+
+	paths := make([]string, 0)
+	for _, entry := range m.Entries {
+		o, ok := entries[entry.Path]
+		if !ok || o != entry {
+			paths = append(paths, entry.Path)
+		}
+		delete(entries, entry.Path)
+	}
+
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	root, err := ioutil.TempDir("", "gru-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"a":     "foo",
+		"b/c":   "bar",
+		"b/d/e": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := GenerateManifest(root, HashOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae 3 a\n" +
+		"fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9 3 b/c\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 b/d/e\n"
+	if buf.String() != want {
+		t.Errorf("want manifest %q, got %q", want, buf.String())
+	}
+
+	parsed, err := ParseManifest(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(m, parsed) {
+		t.Errorf("want parsed manifest %v, got %v", m, parsed)
+	}
+
+	if m.Digest() != parsed.Digest() {
+		t.Errorf("want digest %s, got %s", m.Digest(), parsed.Digest())
+	}
+
+	if paths := m.Compare(parsed); len(paths) != 0 {
+		t.Errorf("want no differences, got %v", paths)
+	}
+
+	// Modify, add and remove files
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("qux"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "f"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := GenerateManifest(root, HashOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if current.Digest() == m.Digest() {
+		t.Errorf("want digest to change after modifying files")
+	}
+
+	wantPaths := []string{"a", "b/c", "f"}
+	if paths := current.Compare(m); !reflect.DeepEqual(wantPaths, paths) {
+		t.Errorf("want changed paths %v, got %v", wantPaths, paths)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	digest := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+	testCases := []struct {
+		input string
+		valid bool
+	}{
+		{"", true},
+		{digest + " 3 a\n", true},
+		{digest + " 3 a b\n", true},
+		{digest + " 3 a\n" + digest + " 3 b\n", true},
+		{digest + " 3 b\n" + digest + " 3 a\n", false},
+		{digest + " 3 a\n" + digest + " 3 a\n", false},
+		{digest + " -1 a\n", false},
+		{digest + " x a\n", false},
+		{digest + " 3\n", false},
+		{"abc 3 a\n", false},
+		{digest + "  3 a\n", false},
+	}
+
+	for _, tc := range testCases {
+		_, err := ParseManifest(bytes.NewReader([]byte(tc.input)))
+		if tc.valid != (err == nil) {
+			t.Errorf("%q: want valid %t, got error %v", tc.input, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,445 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by the in-memory file system
+var (
+	errIsDir       = errors.New("is a directory")
+	errNotDir      = errors.New("not a directory")
+	errNotEmpty    = errors.New("directory not empty")
+	errNotSymlink  = errors.New("not a symbolic link")
+	errTooManyLink = errors.New("too many levels of symbolic links")
+)
+
+// memMaxSymlinks is the maximum number of symbolic
+// links followed when resolving a path.
+const memMaxSymlinks = 40
+
+// memFile type represents a file in the in-memory file system.
+type memFile struct {
+	data    []byte
+	mode    os.FileMode
+	uid     int
+	gid     int
+	target  string
+	modTime time.Time
+}
+
+// MemFileOwner type contains the ownership of a file in the in-memory
+// file system. It is returned by the Sys method of its file information.
+type MemFileOwner struct {
+	UID int
+	GID int
+}
+
+// OwnerIDs returns the user and group ids of the file.
+func (o *MemFileOwner) OwnerIDs() (int, int) {
+	return o.UID, o.GID
+}
+
+// memFileInfo type implements os.FileInfo for the in-memory file system.
+type memFileInfo struct {
+	name string
+	file memFile
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return int64(len(fi.file.data)) }
+func (fi *memFileInfo) Mode() os.FileMode  { return fi.file.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.file.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.file.mode.IsDir() }
+func (fi *memFileInfo) Sys() interface{} {
+	return &MemFileOwner{UID: fi.file.uid, GID: fi.file.gid}
+}
+
+// MemFileSystem type is an in-memory implementation of FileSystem,
+// which is meant to be used by tests. Symbolic links are only
+// followed in the last component of paths.
+//
+// A MemFileSystem is safe for concurrent use.
+type MemFileSystem struct {
+	// UID is the user id of files created on the file system
+	UID int
+
+	// GID is the group id of files created on the file system
+	GID int
+
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+// NewMemFileSystem creates a new in-memory file system, which contains
+// only the root directory. Files created on it are owned by the
+// current user.
+func NewMemFileSystem() *MemFileSystem {
+	m := &MemFileSystem{
+		UID:   os.Getuid(),
+		GID:   os.Getgid(),
+		files: make(map[string]*memFile),
+	}
+
+	root := filepath.VolumeName(os.TempDir()) + string(filepath.Separator)
+	m.files[root] = &memFile{mode: os.ModeDir | 0755, uid: m.UID, gid: m.GID, modTime: time.Now()}
+
+	return m
+}
+
+// MkdirAll creates a directory and any missing parents.
+func (m *MemFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	for _, dir := range parentDirs(name) {
+		f, ok := m.files[dir]
+		if !ok {
+			m.files[dir] = &memFile{mode: os.ModeDir | perm.Perm(), uid: m.UID, gid: m.GID, modTime: time.Now()}
+			continue
+		}
+
+		if !f.mode.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: dir, Err: errNotDir}
+		}
+	}
+
+	return nil
+}
+
+// Paths returns the sorted paths of all files in the file system.
+func (m *MemFileSystem) Paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := make([]string, 0, len(m.files))
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// parentDirs returns the directories leading to name, including name.
+func parentDirs(name string) []string {
+	var dirs []string
+	for dir := name; ; dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	return dirs
+}
+
+// lookup returns the file with the given path, following
+// symbolic links if follow is true. It returns the resolved
+// path along with the file. The lock must be held.
+func (m *MemFileSystem) lookup(op, name string, follow bool) (string, *memFile, error) {
+	name = filepath.Clean(name)
+	for i := 0; i <= memMaxSymlinks; i++ {
+		f, ok := m.files[name]
+		if !ok {
+			return name, nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+
+		if !follow || f.mode&os.ModeSymlink == 0 {
+			return name, f, nil
+		}
+
+		target := f.target
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(name), target)
+		}
+		name = filepath.Clean(target)
+	}
+
+	return name, nil, &os.PathError{Op: op, Path: name, Err: errTooManyLink}
+}
+
+// checkParent checks that the parent of name is a directory.
+// The lock must be held.
+func (m *MemFileSystem) checkParent(op, name string) error {
+	_, parent, err := m.lookup(op, filepath.Dir(name), true)
+	if err != nil {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+
+	if !parent.mode.IsDir() {
+		return &os.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+
+	return nil
+}
+
+// hasChildren returns a boolean indicating whether
+// a directory is not empty. The lock must be held.
+func (m *MemFileSystem) hasChildren(dir string) bool {
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+	for path := range m.files {
+		if path != dir && strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stat returns the file information for name.
+func (m *MemFileSystem) stat(op, name string, follow bool) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, f, err := m.lookup(op, name, follow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memFileInfo{name: filepath.Base(name), file: *f}, nil
+}
+
+// Stat returns the file information, following symbolic links.
+func (m *MemFileSystem) Stat(name string) (os.FileInfo, error) {
+	return m.stat("stat", name, true)
+}
+
+// Lstat returns the file information, without following symbolic links.
+func (m *MemFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return m.stat("lstat", name, false)
+}
+
+// Open opens a file for reading. The content of the
+// file at the time of opening it is returned.
+func (m *MemFileSystem) Open(name string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, f, err := m.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.mode.IsDir() {
+		return nil, &os.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(append([]byte(nil), f.data...))), nil
+}
+
+// memWriter type writes to a file in the in-memory file system.
+type memWriter struct {
+	fs   *MemFileSystem
+	file *memFile
+}
+
+// Write appends data to the file.
+func (w *memWriter) Write(p []byte) (int, error) {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+
+	w.file.data = append(w.file.data, p...)
+	w.file.modTime = time.Now()
+
+	return len(p), nil
+}
+
+// Close closes the file.
+func (w *memWriter) Close() error {
+	return nil
+}
+
+// Create creates or truncates a file for writing.
+func (m *MemFileSystem) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path, f, err := m.lookup("open", name, true)
+	switch {
+	case err == nil && f.mode.IsDir():
+		return nil, &os.PathError{Op: "open", Path: name, Err: errIsDir}
+	case err == nil:
+		f.data = nil
+		f.modTime = time.Now()
+	case os.IsNotExist(err):
+		if err := m.checkParent("open", path); err != nil {
+			return nil, err
+		}
+		f = &memFile{mode: perm.Perm(), uid: m.UID, gid: m.GID, modTime: time.Now()}
+		m.files[path] = f
+	default:
+		return nil, err
+	}
+
+	return &memWriter{fs: m, file: f}, nil
+}
+
+// Chmod changes the permissions of a file.
+func (m *MemFileSystem) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, f, err := m.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	f.mode = f.mode&os.ModeType | mode.Perm()
+
+	return nil
+}
+
+// Chown changes the user and group ids of a file.
+// A negative id leaves the corresponding id unchanged.
+func (m *MemFileSystem) Chown(name string, uid, gid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, f, err := m.lookup("chown", name, true)
+	if err != nil {
+		return err
+	}
+
+	if uid >= 0 {
+		f.uid = uid
+	}
+	if gid >= 0 {
+		f.gid = gid
+	}
+
+	return nil
+}
+
+// Rename renames a file, replacing any existing file.
+func (m *MemFileSystem) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldname = filepath.Clean(oldname)
+	newname = filepath.Clean(newname)
+	_, f, err := m.lookup("rename", oldname, false)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+
+	if err := m.checkParent("rename", newname); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err.(*os.PathError).Err}
+	}
+
+	if existing, ok := m.files[newname]; ok && existing.mode.IsDir() && m.hasChildren(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errNotEmpty}
+	}
+
+	// Move the directory contents as well
+	prefix := oldname + string(filepath.Separator)
+	moved := make(map[string]*memFile)
+	for path, child := range m.files {
+		if strings.HasPrefix(path, prefix) {
+			delete(m.files, path)
+			moved[filepath.Join(newname, strings.TrimPrefix(path, prefix))] = child
+		}
+	}
+
+	for path, child := range moved {
+		m.files[path] = child
+	}
+
+	delete(m.files, oldname)
+	m.files[newname] = f
+
+	return nil
+}
+
+// Remove removes a file or an empty directory.
+func (m *MemFileSystem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path, f, err := m.lookup("remove", name, false)
+	if err != nil {
+		return err
+	}
+
+	if f.mode.IsDir() && m.hasChildren(path) {
+		return &os.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	delete(m.files, path)
+
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname.
+func (m *MemFileSystem) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	newname = filepath.Clean(newname)
+	if _, ok := m.files[newname]; ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+
+	if err := m.checkParent("symlink", newname); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err.(*os.PathError).Err}
+	}
+
+	m.files[newname] = &memFile{
+		mode:    os.ModeSymlink | 0777,
+		uid:     m.UID,
+		gid:     m.GID,
+		target:  oldname,
+		modTime: time.Now(),
+	}
+
+	return nil
+}
+
+// Readlink returns the target of a symbolic link.
+func (m *MemFileSystem) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, f, err := m.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+
+	if f.mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: errNotSymlink}
+	}
+
+	return f.target, nil
+}
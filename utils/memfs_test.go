@@ -0,0 +1,183 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMemFileSystem(t *testing.T) {
+	fs := NewMemFileSystem()
+	if err := fs.MkdirAll("/srv/data", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(fs, "/srv/data/foo", []byte("foo"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(fs, "/missing/foo", []byte("foo"), 0640); !os.IsNotExist(err) {
+		t.Errorf("want not exist error for missing parent, got %v", err)
+	}
+
+	if err := fs.Symlink("foo", "/srv/data/link"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Symlink("foo", "/srv/data/link"); !os.IsExist(err) {
+		t.Errorf("want exist error, got %v", err)
+	}
+
+	target, err := fs.Readlink("/srv/data/link")
+	if err != nil || target != "foo" {
+		t.Errorf("want link target foo, got %q, %v", target, err)
+	}
+
+	// Stat follows symbolic links, while Lstat does not
+	fi, err := fs.Stat("/srv/data/link")
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != 3 || fi.Mode().Perm() != 0640 {
+		t.Errorf("want regular file of 3 bytes with mode 0640, got %v, %v", fi, err)
+	}
+
+	fi, err = fs.Lstat("/srv/data/link")
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("want symbolic link, got %v, %v", fi, err)
+	}
+
+	content, err := ReadFile(fs, "/srv/data/link")
+	if err != nil || string(content) != "foo" {
+		t.Errorf("want content foo, got %q, %v", content, err)
+	}
+
+	if err := fs.Remove("/srv/data"); err == nil {
+		t.Error("want error when removing non-empty directory")
+	}
+
+	if err := fs.Rename("/srv/data", "/srv/old"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/", "/srv", "/srv/old", "/srv/old/foo", "/srv/old/link"}
+	if got := fs.Paths(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want paths %q, got %q", want, got)
+	}
+
+	if _, err := fs.Stat("/srv/data/foo"); !os.IsNotExist(err) {
+		t.Errorf("want not exist error, got %v", err)
+	}
+}
+
+func TestFileUtilMemFileSystem(t *testing.T) {
+	fs := NewMemFileSystem()
+	fs.UID, fs.GID = 1000, 1000
+	if err := fs.MkdirAll("/srv", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(fs, "/srv/src", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(fs, "/srv/dst", []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Chown("/srv/dst", 2000, 2000); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := &FileUtil{Path: "/srv/dst", FS: fs}
+	if err := dst.CopyFrom("/srv/src", false); err == nil {
+		t.Error("want error when not overwriting existing file")
+	}
+
+	// The mode and ownership of the replaced file are kept
+	if err := dst.CopyFrom("/srv/src", true); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := fs.Stat("/srv/dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Mode() != 0600 {
+		t.Errorf("want mode 0600, got %s", fi.Mode())
+	}
+
+	uid, gid, err := fileOwnerIDs(fi)
+	if err != nil || uid != "2000" || gid != "2000" {
+		t.Errorf("want ownership 2000:2000, got %s:%s, %v", uid, gid, err)
+	}
+
+	same, err := dst.SameContentWith("/srv/src")
+	if err != nil || !same {
+		t.Errorf("want same content, got %t, %v", same, err)
+	}
+
+	// Copies are given the requested mode and ownership instead
+	if err := dst.CopyFromAs("/srv/src", 0640, 3000, 3000); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err = fs.Stat("/srv/dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Mode() != 0640 {
+		t.Errorf("want mode 0640, got %s", fi.Mode())
+	}
+
+	uid, gid, err = fileOwnerIDs(fi)
+	if err != nil || uid != "3000" || gid != "3000" {
+		t.Errorf("want ownership 3000:3000, got %s:%s, %v", uid, gid, err)
+	}
+
+	want := []string{"/", "/srv", "/srv/dst", "/srv/src"}
+	if got := fs.Paths(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want paths %q, got %q", want, got)
+	}
+
+	if err := dst.Chmod(0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mode, err := dst.Mode()
+	if err != nil || mode != 0644 {
+		t.Errorf("want mode 0644, got %s, %v", mode, err)
+	}
+
+	if err := dst.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	if dst.Exists() {
+		t.Error("want file to be removed")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+// MemUserResolver type is a UserResolver, which resolves users and
+// groups from memory. It is meant for testing resources managing
+// file ownership without depending on the users of the system.
+//
+// A MemUserResolver is safe for concurrent use.
+type MemUserResolver struct {
+	mu     sync.RWMutex
+	users  []*user.User
+	groups []*user.Group
+
+	// CurrentUID is the user id of the current user
+	CurrentUID string
+}
+
+// NewMemUserResolver creates a new in-memory resolver, which knows the
+// root user and group only. The root user is the current user.
+func NewMemUserResolver() *MemUserResolver {
+	r := &MemUserResolver{CurrentUID: "0"}
+	r.AddGroup("root", 0)
+	r.AddUser("root", 0, 0)
+
+	return r
+}
+
+// AddUser adds a user with the given name, user id and primary group id.
+func (r *MemUserResolver) AddUser(name string, uid, gid int) *user.User {
+	u := &user.User{
+		Username: name,
+		Uid:      strconv.Itoa(uid),
+		Gid:      strconv.Itoa(gid),
+		Name:     name,
+		HomeDir:  "/home/" + name,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users = append(r.users, u)
+
+	return u
+}
+
+// AddGroup adds a group with the given name and group id.
+func (r *MemUserResolver) AddGroup(name string, gid int) *user.Group {
+	g := &user.Group{
+		Name: name,
+		Gid:  strconv.Itoa(gid),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.groups = append(r.groups, g)
+
+	return g
+}
+
+// findUser returns the first user matching f, if any.
+func (r *MemUserResolver) findUser(f func(u *user.User) bool) *user.User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if f(u) {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// findGroup returns the first group matching f, if any.
+func (r *MemUserResolver) findGroup(f func(g *user.Group) bool) *user.Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, g := range r.groups {
+		if f(g) {
+			return g
+		}
+	}
+
+	return nil
+}
+
+// Current returns the current user.
+func (r *MemUserResolver) Current() (*user.User, error) {
+	return r.LookupId(r.CurrentUID)
+}
+
+// LookupId looks up a user by user id.
+func (r *MemUserResolver) LookupId(uid string) (*user.User, error) {
+	if u := r.findUser(func(u *user.User) bool { return u.Uid == uid }); u != nil {
+		return u, nil
+	}
+
+	id, err := strconv.Atoi(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, user.UnknownUserIdError(id)
+}
+
+// Lookup looks up a user by username.
+func (r *MemUserResolver) Lookup(username string) (*user.User, error) {
+	if u := r.findUser(func(u *user.User) bool { return u.Username == username }); u != nil {
+		return u, nil
+	}
+
+	return nil, user.UnknownUserError(username)
+}
+
+// LookupGroupId looks up a group by group id.
+func (r *MemUserResolver) LookupGroupId(gid string) (*user.Group, error) {
+	if g := r.findGroup(func(g *user.Group) bool { return g.Gid == gid }); g != nil {
+		return g, nil
+	}
+
+	return nil, user.UnknownGroupIdError(gid)
+}
+
+// LookupGroup looks up a group by name.
+func (r *MemUserResolver) LookupGroup(name string) (*user.Group, error) {
+	if g := r.findGroup(func(g *user.Group) bool { return g.Name == name }); g != nil {
+		return g, nil
+	}
+
+	return nil, user.UnknownGroupError(name)
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Unix special permission bits, as used in numeric modes.
+const (
+	unixSetuid = 04000
+	unixSetgid = 02000
+	unixSticky = 01000
+)
+
+// fileModeMask contains the bits of os.FileMode,
+// which can be represented in a numeric mode.
+const fileModeMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// ParseFileMode parses a file mode, which is one of:
+//
+// An integer, which is the numeric value of the mode, e.g. 420 or
+// tonumber("0644", 8) in Lua. Integers are never re-read as octal
+// digits, so 644 is the mode 01204 and not 0644.
+//
+// A string of octal digits with or without a leading zero, e.g.
+// "644", "0644" or "4755". A "0o" prefix is also accepted.
+//
+// A symbolic string, either in the form used by ls(1), e.g.
+// "rwxr-xr-x" or "-rwsr-xr-x", or in the form used by chmod(1),
+// e.g. "u=rwx,g=rx,o=rx". Symbolic clauses are applied in order
+// starting from an empty mode, so "a=r,u+w" is the mode 0644.
+//
+// The special bits in numeric modes are converted
+// to the respective os.FileMode flags.
+func ParseFileMode(v interface{}) (os.FileMode, error) {
+	switch v := v.(type) {
+	case os.FileMode:
+		if v&^fileModeMask != 0 {
+			return 0, fmt.Errorf("invalid file mode %s", v)
+		}
+		return v, nil
+	case int:
+		return parseNumericMode(int64(v))
+	case int64:
+		return parseNumericMode(v)
+	case uint32:
+		return parseNumericMode(int64(v))
+	case float64:
+		// Lua numbers are floats
+		if v != math.Trunc(v) || v < 0 || v > math.MaxUint32 {
+			return 0, fmt.Errorf("invalid file mode %v", v)
+		}
+		return parseNumericMode(int64(v))
+	case string:
+		return parseModeString(v)
+	}
+
+	return 0, fmt.Errorf("invalid file mode type %T", v)
+}
+
+// parseNumericMode converts a numeric mode, which
+// may include the special bits, to os.FileMode.
+func parseNumericMode(v int64) (os.FileMode, error) {
+	if v < 0 || v > 07777 {
+		return 0, fmt.Errorf("invalid file mode %#o", v)
+	}
+
+	return FileModeFromUnix(uint32(v)), nil
+}
+
+// parseModeString parses an octal or symbolic mode.
+func parseModeString(s string) (os.FileMode, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("invalid file mode '%s'", s)
+	}
+
+	if s[0] >= '0' && s[0] <= '9' {
+		digits := strings.TrimPrefix(strings.TrimPrefix(s, "0o"), "0O")
+		v, err := strconv.ParseUint(digits, 8, 32)
+		if err != nil || v > 07777 {
+			return 0, fmt.Errorf("invalid file mode '%s'", s)
+		}
+		return FileModeFromUnix(uint32(v)), nil
+	}
+
+	if isLsMode(s) {
+		return parseLsMode(s)
+	}
+
+	return parseChmodMode(s)
+}
+
+// isLsMode returns a boolean indicating whether
+// the mode is in the form used by ls(1).
+func isLsMode(s string) bool {
+	if len(s) == 10 && strings.IndexByte("-dlcbps", s[0]) >= 0 {
+		s = s[1:]
+	}
+
+	if len(s) != 9 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte("rwxsStT-", s[i]) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseLsMode parses a mode in the form used by ls(1),
+// e.g. "rwxr-xr-x", optionally preceded by a file type
+// character, e.g. "-rwsr-xr-x".
+func parseLsMode(s string) (os.FileMode, error) {
+	orig := s
+	if len(s) == 10 {
+		s = s[1:]
+	}
+
+	var mode uint32
+	for i := 0; i < 9; i++ {
+		shift := uint(8 - i)
+		c := s[i]
+		switch {
+		case c == "rwxrwxrwx"[i]:
+			mode |= 1 << shift
+		case c == '-':
+		case i%3 == 2:
+			// The execute position also shows the special bits
+			special := [...]uint32{unixSetuid, unixSetgid, unixSticky}[i/3]
+			lower, upper := "sst"[i/3], "SST"[i/3]
+			switch c {
+			case lower:
+				mode |= special | 1<<shift
+			case upper:
+				mode |= special
+			default:
+				return 0, fmt.Errorf("invalid file mode '%s'", orig)
+			}
+		default:
+			return 0, fmt.Errorf("invalid file mode '%s'", orig)
+		}
+	}
+
+	return FileModeFromUnix(mode), nil
+}
+
+// parseChmodMode parses a symbolic mode in the form used by
+// chmod(1), e.g. "u=rwx,go=rx". Clauses are applied in order
+// starting from an empty mode.
+func parseChmodMode(s string) (os.FileMode, error) {
+	var mode uint32
+	for _, clause := range strings.Split(s, ",") {
+		i := strings.IndexAny(clause, "=+-")
+		if i < 0 {
+			return 0, fmt.Errorf("invalid file mode '%s'", s)
+		}
+
+		who := clause[:i]
+		if who == "" {
+			who = "a"
+		}
+
+		var whoMask uint32
+		for _, c := range who {
+			switch c {
+			case 'u':
+				whoMask |= 04700
+			case 'g':
+				whoMask |= 02070
+			case 'o':
+				whoMask |= 01007
+			case 'a':
+				whoMask |= 07777
+			default:
+				return 0, fmt.Errorf("invalid file mode '%s'", s)
+			}
+		}
+
+		// Multiple operations may follow, e.g. "u=rw+x"
+		rest := clause[i:]
+		for rest != "" {
+			op := rest[0]
+			j := strings.IndexAny(rest[1:], "=+-")
+			perms := rest[1:]
+			if j >= 0 {
+				perms = rest[1 : j+1]
+			}
+
+			var bits uint32
+			for _, c := range perms {
+				switch c {
+				case 'r':
+					bits |= 0444
+				case 'w':
+					bits |= 0222
+				case 'x':
+					bits |= 0111
+				case 's':
+					bits |= unixSetuid | unixSetgid
+				case 't':
+					bits |= unixSticky
+				default:
+					return 0, fmt.Errorf("invalid file mode '%s'", s)
+				}
+			}
+			bits &= whoMask
+
+			switch op {
+			case '=':
+				mode = mode&^whoMask | bits
+			case '+':
+				mode |= bits
+			case '-':
+				mode &^= bits
+			}
+
+			if j < 0 {
+				break
+			}
+			rest = rest[j+1:]
+		}
+	}
+
+	return FileModeFromUnix(mode), nil
+}
+
+// FormatFileMode formats a file mode in its canonical octal
+// form, e.g. "0644", or "04755" when special bits are set.
+func FormatFileMode(mode os.FileMode) string {
+	v := FileModeToUnix(mode)
+	if v > 0777 {
+		return fmt.Sprintf("0%o", v)
+	}
+
+	return fmt.Sprintf("%04o", v)
+}
+
+// FileModeFromUnix converts a numeric mode, which may include the
+// setuid, setgid and sticky bits, to os.FileMode. Bits other than
+// the permission and special bits are ignored.
+func FileModeFromUnix(v uint32) os.FileMode {
+	mode := os.FileMode(v) & os.ModePerm
+	if v&unixSetuid != 0 {
+		mode |= os.ModeSetuid
+	}
+
+	if v&unixSetgid != 0 {
+		mode |= os.ModeSetgid
+	}
+
+	if v&unixSticky != 0 {
+		mode |= os.ModeSticky
+	}
+
+	return mode
+}
+
+// FileModeToUnix converts os.FileMode to a numeric mode including
+// the setuid, setgid and sticky bits. The file type and other
+// flags of os.FileMode are ignored.
+func FileModeToUnix(mode os.FileMode) uint32 {
+	v := uint32(mode & os.ModePerm)
+	if mode&os.ModeSetuid != 0 {
+		v |= unixSetuid
+	}
+
+	if mode&os.ModeSetgid != 0 {
+		v |= unixSetgid
+	}
+
+	if mode&os.ModeSticky != 0 {
+		v |= unixSticky
+	}
+
+	return v
+}
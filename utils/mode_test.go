@@ -0,0 +1,218 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseFileMode(t *testing.T) {
+	testCases := []struct {
+		v    interface{}
+		want os.FileMode
+		err  bool
+	}{
+		// Numeric values
+		{0644, 0644, false},
+		{420, 0644, false},
+		{0, 0, false},
+		{0777, 0777, false},
+		{644, 01204&0777 | os.ModeSticky, false},
+		{04755, 0755 | os.ModeSetuid, false},
+		{02755, 0755 | os.ModeSetgid, false},
+		{01777, 0777 | os.ModeSticky, false},
+		{07777, 0777 | os.ModeSetuid | os.ModeSetgid | os.ModeSticky, false},
+		{010000, 0, true},
+		{-1, 0, true},
+		{int64(0600), 0600, false},
+		{int64(-0600), 0, true},
+		{uint32(0600), 0600, false},
+		{float64(0644), 0644, false},
+		{float64(04755), 0755 | os.ModeSetuid, false},
+		{420.5, 0, true},
+		{-420.0, 0, true},
+		{1e20, 0, true},
+		{os.FileMode(0644), 0644, false},
+		{0755 | os.ModeSetuid, 0755 | os.ModeSetuid, false},
+		{os.ModeDir | 0755, 0, true},
+
+		// Octal strings
+		{"644", 0644, false},
+		{"0644", 0644, false},
+		{"00644", 0644, false},
+		{"0o644", 0644, false},
+		{"0O644", 0644, false},
+		{" 0644 ", 0644, false},
+		{"0", 0, false},
+		{"755", 0755, false},
+		{"4755", 0755 | os.ModeSetuid, false},
+		{"04755", 0755 | os.ModeSetuid, false},
+		{"2775", 0775 | os.ModeSetgid, false},
+		{"1777", 0777 | os.ModeSticky, false},
+		{"6755", 0755 | os.ModeSetuid | os.ModeSetgid, false},
+		{"7777", 0777 | os.ModeSetuid | os.ModeSetgid | os.ModeSticky, false},
+		{"10000", 0, true},
+		{"0o", 0, true},
+		{"0x1a4", 0, true},
+		{"0648", 0, true},
+		{"9", 0, true},
+		{"", 0, true},
+		{"   ", 0, true},
+
+		// Symbolic strings in the form used by ls(1)
+		{"rw-r--r--", 0644, false},
+		{"rwxr-xr-x", 0755, false},
+		{"---------", 0, false},
+		{"rwxrwxrwx", 0777, false},
+		{"-rw-r--r--", 0644, false},
+		{"drwxr-xr-x", 0755, false},
+		{"rwsr-xr-x", 0755 | os.ModeSetuid, false},
+		{"rwSr--r--", 0644 | os.ModeSetuid, false},
+		{"rwxr-sr-x", 0755 | os.ModeSetgid, false},
+		{"rw-r-Sr--", 0644 | os.ModeSetgid, false},
+		{"rwxrwxrwt", 0777 | os.ModeSticky, false},
+		{"rwxrwxrwT", 0776 | os.ModeSticky, false},
+		{"rwsr-sr-t", 0755 | os.ModeSetuid | os.ModeSetgid | os.ModeSticky, false},
+		{"wr-r--r--", 0, true},
+		{"rw-r--r-s", 0, true},
+		{"rwtr--r--", 0, true},
+		{"xrwxr-xr-x", 0, true},
+
+		// Symbolic strings in the form used by chmod(1)
+		{"u=rw,g=r,o=r", 0644, false},
+		{"u=rwx,g=rx,o=rx", 0755, false},
+		{"u=rwx,go=rx", 0755, false},
+		{"a=r,u+w", 0644, false},
+		{"=r,u+w", 0644, false},
+		{"a=rwx,o-w", 0775, false},
+		{"ugo=rwx", 0777, false},
+		{"u=rw+x", 0700, false},
+		{"u=rwx,g=rx,o=", 0750, false},
+		{"u+r", 0400, false},
+		{"u-r", 0, false},
+		{"u=rwxs,go=rx", 0755 | os.ModeSetuid, false},
+		{"g=rxs,u=rwx", 0750 | os.ModeSetgid, false},
+		{"a=rwx,+t", 0777 | os.ModeSticky, false},
+		{"a=rwx,o+t", 0777 | os.ModeSticky, false},
+		{"u=rwx,u+t", 0700, false},
+		{"a=rwxst", 0777 | os.ModeSetuid | os.ModeSetgid | os.ModeSticky, false},
+		{"a=rwxst,u-s", 0777 | os.ModeSetgid | os.ModeSticky, false},
+		{"u=rwz", 0, true},
+		{"x=rw", 0, true},
+		{"u=rw,", 0, true},
+		{"urw", 0, true},
+
+		// Unsupported types
+		{nil, 0, true},
+		{true, 0, true},
+		{[]string{"0644"}, 0, true},
+	}
+
+	for _, tc := range testCases {
+		got, err := ParseFileMode(tc.v)
+		if tc.err != (err != nil) {
+			t.Errorf("mode %#v: want error %t, got %v", tc.v, tc.err, err)
+			continue
+		}
+
+		if got != tc.want {
+			t.Errorf("mode %#v: want %s, got %s", tc.v, tc.want, got)
+		}
+	}
+}
+
+func TestFormatFileMode(t *testing.T) {
+	testCases := []struct {
+		mode os.FileMode
+		want string
+	}{
+		{0, "0000"},
+		{0644, "0644"},
+		{0755, "0755"},
+		{0777, "0777"},
+		{0007, "0007"},
+		{0755 | os.ModeSetuid, "04755"},
+		{0755 | os.ModeSetgid, "02755"},
+		{0777 | os.ModeSticky, "01777"},
+		{0755 | os.ModeSetuid | os.ModeSetgid, "06755"},
+		{0777 | os.ModeSetuid | os.ModeSetgid | os.ModeSticky, "07777"},
+		{os.ModeSetuid, "04000"},
+		{os.ModeDir | 0755, "0755"},
+		{os.ModeSymlink | 0777, "0777"},
+		{os.ModeDir | os.ModeSticky | 0777, "01777"},
+	}
+
+	for _, tc := range testCases {
+		got := FormatFileMode(tc.mode)
+		if got != tc.want {
+			t.Errorf("mode %s: want %s, got %s", tc.mode, tc.want, got)
+		}
+	}
+}
+
+func TestFileModeUnixConversion(t *testing.T) {
+	testCases := []struct {
+		unix uint32
+		mode os.FileMode
+	}{
+		{0, 0},
+		{0644, 0644},
+		{0777, 0777},
+		{04000, os.ModeSetuid},
+		{02000, os.ModeSetgid},
+		{01000, os.ModeSticky},
+		{04755, 0755 | os.ModeSetuid},
+		{02775, 0775 | os.ModeSetgid},
+		{01777, 0777 | os.ModeSticky},
+		{07777, 0777 | os.ModeSetuid | os.ModeSetgid | os.ModeSticky},
+	}
+
+	for _, tc := range testCases {
+		if got := FileModeFromUnix(tc.unix); got != tc.mode {
+			t.Errorf("FileModeFromUnix(%#o): want %s, got %s", tc.unix, tc.mode, got)
+		}
+
+		if got := FileModeToUnix(tc.mode); got != tc.unix {
+			t.Errorf("FileModeToUnix(%s): want %#o, got %#o", tc.mode, tc.unix, got)
+		}
+
+		// Round trips through the formatted and parsed forms
+		mode, err := ParseFileMode(FormatFileMode(tc.mode))
+		if err != nil || mode != tc.mode {
+			t.Errorf("round trip of %s: got %s, %v", tc.mode, mode, err)
+		}
+	}
+
+	// Bits outside the permission and special bits are ignored
+	if got := FileModeFromUnix(0100644); got != 0644 {
+		t.Errorf("FileModeFromUnix(0100644): want -rw-r--r--, got %s", got)
+	}
+
+	if got := FileModeToUnix(os.ModeDir | os.ModeSetgid | 0755); got != 02755 {
+		t.Errorf("FileModeToUnix(dir with setgid): want 02755, got %#o", got)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build !windows
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"testing"
+)
+
+func TestFileOwner(t *testing.T) {
+	f, err := ioutil.TempFile("", "gru-owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uid, _, err := fileOwnerIDs(fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uid != current.Uid {
+		t.Errorf("want uid %s, got %s", current.Uid, uid)
+	}
+
+	fu := NewFileUtil(f.Name())
+	owner, err := fu.Owner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if owner.User.Username != current.Username {
+		t.Errorf("want owner %s, got %s", current.Username, owner.User.Username)
+	}
+
+	// Setting the ownership to the current owner is always permitted
+	if err := fu.SetOwner(owner.User.Username, owner.Group.Name); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build !windows
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// ownershipSupported specifies whether file ownership
+// can be managed on the current platform.
+const ownershipSupported = true
+
+// sysFileOwnerIDs returns the user and group ids of a file.
+// The uid and gid fields of syscall.Stat_t are uint32 on
+// Linux, the BSDs and Darwin, while the rest of the
+// structure differs between them.
+func sysFileOwnerIDs(fi os.FileInfo) (string, string, error) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", "", fmt.Errorf("unable to get owner of %s", fi.Name())
+	}
+
+	uid := strconv.FormatUint(uint64(st.Uid), 10)
+	gid := strconv.FormatUint(uint64(st.Gid), 10)
+
+	return uid, gid, nil
+}
+
+// chownFile changes the user and group ids of a file.
+func chownFile(path string, uid, gid int) error {
+	return os.Chown(path, uid, gid)
+}
+
+// lchownFile changes the user and group ids of a file,
+// without following symbolic links.
+func lchownFile(path string, uid, gid int) error {
+	return os.Lchown(path, uid, gid)
+}
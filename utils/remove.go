@@ -0,0 +1,177 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultRemoveMinDepth is the default minimum number of path
+// components of paths removed by SafeRemoveAll, e.g. "/srv/www".
+const DefaultRemoveMinDepth = 2
+
+// ErrPathSwapped error is returned by SafeRemoveAll when a directory
+// has been replaced, e.g. by a symbolic link, while being removed.
+var ErrPathSwapped = errors.New("path has been replaced during removal")
+
+// RemoveOptions type contains the guards used by SafeRemoveAll.
+type RemoveOptions struct {
+	// MinDepth is the minimum number of path components of the
+	// path to be removed, so that e.g. "/etc" is not removed by
+	// accident. Defaults to DefaultRemoveMinDepth.
+	MinDepth int
+
+	// AllowedRoot is an optional directory, within which
+	// the resolved path to be removed must be.
+	AllowedRoot string
+
+	// Protected contains paths which must not be removed,
+	// neither directly nor by removing any of their parents,
+	// e.g. the site repo.
+	Protected []string
+}
+
+// RemoveResult type contains the number of entries removed.
+type RemoveResult struct {
+	// Files is the number of removed files, including links
+	Files int
+
+	// Dirs is the number of removed directories
+	Dirs int
+}
+
+// SafeRemoveAll removes path and any children it contains, similar
+// to os.RemoveAll, after checking it against the guards in opts.
+// The root directory is never removed.
+//
+// Directories are opened without following symbolic links and their
+// entries are removed relative to the opened directories, so that a
+// directory replaced by a symbolic link during the removal does not
+// cause files outside of it to be removed. A symbolic link given as
+// path is removed itself, without removing its target.
+//
+// It returns the number of removed entries, which is non-zero
+// even if an error occurs after some entries have been removed.
+func SafeRemoveAll(path string, opts RemoveOptions) (RemoveResult, error) {
+	var result RemoveResult
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return result, err
+	}
+
+	if err := checkRemove(abs, opts); err != nil {
+		return result, err
+	}
+
+	fi, err := os.Lstat(abs)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	if !fi.IsDir() {
+		if err := os.Remove(abs); err != nil {
+			return result, err
+		}
+		result.Files++
+
+		return result, nil
+	}
+
+	err = removeDir(abs, fi, &result)
+
+	return result, err
+}
+
+// checkRemove checks whether the absolute path may be removed.
+func checkRemove(path string, opts RemoveOptions) error {
+	minDepth := opts.MinDepth
+	if minDepth < 1 {
+		minDepth = DefaultRemoveMinDepth
+	}
+
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range []string{path, resolved} {
+		if pathDepth(p) == 0 {
+			return fmt.Errorf("refusing to remove %s: path is the root directory", path)
+		}
+
+		if pathDepth(p) < minDepth {
+			return fmt.Errorf("refusing to remove %s: path has less than %d components", path, minDepth)
+		}
+	}
+
+	if opts.AllowedRoot != "" {
+		root, err := resolvePath(opts.AllowedRoot)
+		if err != nil {
+			return err
+		}
+
+		if !isWithin(root, resolved) {
+			return fmt.Errorf("refusing to remove %s: path is outside of %s", path, opts.AllowedRoot)
+		}
+	}
+
+	for _, protected := range opts.Protected {
+		if protected == "" {
+			continue
+		}
+
+		p, err := resolvePath(protected)
+		if err != nil {
+			return err
+		}
+
+		if isWithin(resolved, p) {
+			return fmt.Errorf("refusing to remove %s: path contains protected path %s", path, protected)
+		}
+	}
+
+	return nil
+}
+
+// pathDepth returns the number of components of an absolute path.
+func pathDepth(path string) int {
+	path = filepath.Clean(path)
+	path = strings.Trim(filepath.ToSlash(path[len(filepath.VolumeName(path)):]), "/")
+	if path == "" {
+		return 0
+	}
+
+	return len(strings.Split(path, "/"))
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSafeRemoveAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-remove")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outside := filepath.Join(dir, "outside")
+	tree := filepath.Join(dir, "tree")
+	for _, d := range []string{outside, filepath.Join(tree, "a", "b"), filepath.Join(tree, "c")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, f := range []string{filepath.Join(outside, "keep"), filepath.Join(tree, "foo"), filepath.Join(tree, "a", "b", "bar")} {
+		if err := ioutil.WriteFile(f, []byte("foo"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink(outside, filepath.Join(tree, "a", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A link given as path is removed itself
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(tree, link); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := SafeRemoveAll(link, RemoveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result != (RemoveResult{Files: 1}) {
+		t.Errorf("want one removed link, got %+v", result)
+	}
+
+	if _, err := os.Stat(filepath.Join(tree, "foo")); err != nil {
+		t.Errorf("want link target to be kept, got %s", err)
+	}
+
+	result, err = SafeRemoveAll(tree, RemoveOptions{AllowedRoot: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// foo, bar and the link; tree, a, b and c
+	if result != (RemoveResult{Files: 3, Dirs: 4}) {
+		t.Errorf("want 3 files and 4 directories removed, got %+v", result)
+	}
+
+	if _, err := os.Lstat(tree); !os.IsNotExist(err) {
+		t.Errorf("want tree to be removed, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "keep")); err != nil {
+		t.Errorf("want files outside of tree to be kept, got %s", err)
+	}
+
+	// Missing paths are not an error
+	result, err = SafeRemoveAll(tree, RemoveOptions{})
+	if err != nil || result != (RemoveResult{}) {
+		t.Errorf("want nothing removed for missing path, got %+v, %v", result, err)
+	}
+}
+
+func TestSafeRemoveAllGuards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-remove")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	site := filepath.Join(dir, "site")
+	other := filepath.Join(dir, "other")
+	for _, d := range []string{filepath.Join(site, "data"), other} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	escape := filepath.Join(site, "escape")
+	if err := os.Symlink(other, escape); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		path string
+		opts RemoveOptions
+		want string
+	}{
+		{"/", RemoveOptions{}, "root directory"},
+		{"/tmp", RemoveOptions{}, "less than 2 components"},
+		{other, RemoveOptions{MinDepth: 100}, "less than 100 components"},
+		{other, RemoveOptions{AllowedRoot: site}, "outside of"},
+		{filepath.Join(escape, "."), RemoveOptions{AllowedRoot: site}, "outside of"},
+		{site, RemoveOptions{Protected: []string{site}}, "protected path"},
+		{dir, RemoveOptions{Protected: []string{filepath.Join(site, "data")}}, "protected path"},
+	}
+
+	for _, tc := range testCases {
+		_, err := SafeRemoveAll(tc.path, tc.opts)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: want error containing %q, got %v", tc.path, tc.want, err)
+		}
+	}
+
+	for _, d := range []string{filepath.Join(site, "data"), other} {
+		if _, err := os.Stat(d); err != nil {
+			t.Errorf("want %s to be kept, got %s", d, err)
+		}
+	}
+
+	// Directories replaced after being checked are not removed
+	fi, err := os.Lstat(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result RemoveResult
+	err = removeDir(filepath.Join(site, "data"), fi, &result)
+	if perr, ok := err.(*os.PathError); !ok || perr.Err != ErrPathSwapped {
+		t.Errorf("want swapped path error, got %v", err)
+	}
+}
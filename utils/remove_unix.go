@@ -0,0 +1,143 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build !windows
+
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// removeDir removes the directory at path, which is described by
+// fi, and all of its children relative to the opened directories.
+func removeDir(path string, fi os.FileInfo, result *RemoveResult) error {
+	parent, err := unix.Open(filepath.Dir(path), unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: filepath.Dir(path), Err: err}
+	}
+	defer unix.Close(parent)
+
+	name := filepath.Base(path)
+	fd, err := openDirAt(parent, name)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+
+	// Make sure the opened directory is the one checked earlier
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		unix.Close(fd)
+		return &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+
+	if sys, ok := fi.Sys().(*syscall.Stat_t); !ok || uint64(sys.Dev) != uint64(st.Dev) || uint64(sys.Ino) != uint64(st.Ino) {
+		unix.Close(fd)
+		return &os.PathError{Op: "remove", Path: path, Err: ErrPathSwapped}
+	}
+
+	if err := removeChildren(fd, path, result); err != nil {
+		return err
+	}
+
+	if err := unix.Unlinkat(parent, name, unix.AT_REMOVEDIR); err != nil {
+		return &os.PathError{Op: "remove", Path: path, Err: err}
+	}
+	result.Dirs++
+
+	return nil
+}
+
+// openDirAt opens the directory name relative to the directory
+// fd, failing if name is not a directory or is a symbolic link.
+func openDirAt(fd int, name string) (int, error) {
+	return unix.Openat(fd, name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+}
+
+// removeChildren removes all entries of the directory fd, which is
+// closed afterwards. The path is only used for error messages.
+func removeChildren(fd int, path string, result *RemoveResult) error {
+	dir := os.NewFile(uintptr(fd), path)
+	defer dir.Close()
+
+	for {
+		names, err := dir.Readdirnames(128)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			if err := removeAt(fd, name, filepath.Join(path, name), result); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// removeAt removes the entry name of the directory fd
+// and, if it is a directory, all of its children.
+func removeAt(fd int, name, path string, result *RemoveResult) error {
+	err := unix.Unlinkat(fd, name, 0)
+	if err == nil {
+		result.Files++
+		return nil
+	}
+
+	if err == unix.ENOENT {
+		return nil
+	}
+
+	// Directories cannot be unlinked, depending on the
+	// system either EISDIR or EPERM is returned for them
+	if err != unix.EISDIR && err != unix.EPERM {
+		return &os.PathError{Op: "remove", Path: path, Err: err}
+	}
+
+	child, oerr := openDirAt(fd, name)
+	if oerr != nil {
+		// Not a directory, report the original error
+		return &os.PathError{Op: "remove", Path: path, Err: err}
+	}
+
+	if err := removeChildren(child, path, result); err != nil {
+		return err
+	}
+
+	if err := unix.Unlinkat(fd, name, unix.AT_REMOVEDIR); err != nil {
+		return &os.PathError{Op: "remove", Path: path, Err: err}
+	}
+	result.Dirs++
+
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Logger is the interface used for logging events.
+// It is satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Policy type contains the settings used when retrying operations.
+type Policy struct {
+	// Attempts is the maximum number of attempts, including
+	// the first one. Values less than one mean a single attempt.
+	Attempts int
+
+	// InitialInterval is the time to wait after the first
+	// failed attempt.
+	InitialInterval time.Duration
+
+	// MaxInterval is the maximum time to wait between attempts.
+	// A zero value means no limit.
+	MaxInterval time.Duration
+
+	// Multiplier is the factor by which the interval grows
+	// after each failed attempt. Values less than one are
+	// treated as one, i.e. a constant interval.
+	Multiplier float64
+
+	// Jitter is the fraction by which each interval is randomized,
+	// e.g. a value of 0.2 results in intervals within 20% of
+	// the computed value.
+	Jitter float64
+
+	// Retryable returns whether an error should be retried.
+	// If nil, all errors are retried.
+	Retryable func(err error) bool
+
+	// Logger is used to log failed attempts. If nil,
+	// nothing is logged.
+	Logger Logger
+}
+
+// DefaultPolicy is the default policy used for retrying operations.
+var DefaultPolicy = Policy{
+	Attempts:        3,
+	InitialInterval: time.Second,
+	MaxInterval:     30 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+// RetryError type is returned when an operation did not
+// succeed after being retried.
+type RetryError struct {
+	// Attempts is the number of attempts made
+	Attempts int
+
+	// Err is the error returned by the last attempt
+	Err error
+
+	// Context is the context error, if retrying was
+	// stopped because the context was done
+	Context error
+}
+
+// Error implements the error interface.
+func (re *RetryError) Error() string {
+	if re.Context != nil {
+		return fmt.Sprintf("giving up after %d attempt(s): %s: %s", re.Attempts, re.Context, re.Err)
+	}
+
+	return fmt.Sprintf("giving up after %d attempt(s): %s", re.Attempts, re.Err)
+}
+
+// Unwrap returns the error of the last attempt.
+func (re *RetryError) Unwrap() error {
+	return re.Err
+}
+
+// interval returns the time to wait after the given
+// number of failed attempts, without jitter.
+func (p Policy) interval(failed int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	d := float64(p.InitialInterval)
+	for i := 1; i < failed; i++ {
+		d *= multiplier
+		if p.MaxInterval > 0 && d >= float64(p.MaxInterval) {
+			return p.MaxInterval
+		}
+	}
+
+	if p.MaxInterval > 0 && d > float64(p.MaxInterval) {
+		return p.MaxInterval
+	}
+
+	return time.Duration(d)
+}
+
+// jitter randomizes the interval d according to the policy.
+func (p Policy) jitter(d time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return d
+	}
+
+	delta := p.Jitter * float64(d)
+
+	return time.Duration(float64(d) - delta + rand.Float64()*2*delta)
+}
+
+// Retry calls fn until it succeeds, the policy attempts are
+// exhausted, fn returns an error which is not retryable, or the
+// context is done. The context is checked before each attempt and
+// while waiting between attempts. If fn does not succeed a
+// *RetryError wrapping the last error is returned.
+func Retry(ctx context.Context, p Policy, fn func() error) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return &RetryError{Attempts: attempt - 1, Err: err, Context: ctxErr}
+		}
+
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		if p.Retryable != nil && !p.Retryable(err) {
+			return &RetryError{Attempts: attempt, Err: err}
+		}
+
+		if attempt >= attempts {
+			return &RetryError{Attempts: attempt, Err: err}
+		}
+
+		wait := p.jitter(p.interval(attempt))
+		if p.Logger != nil {
+			p.Logger.Printf("attempt %d/%d failed: %s, retrying in %s\n", attempt, attempts, err, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &RetryError{Attempts: attempt, Err: err, Context: ctx.Err()}
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPolicy returns a policy with short intervals for tests.
+func testPolicy(attempts int) Policy {
+	return Policy{
+		Attempts:        attempts,
+		InitialInterval: time.Millisecond,
+		MaxInterval:     5 * time.Millisecond,
+		Multiplier:      2,
+	}
+}
+
+func TestRetrySuccess(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), testPolicy(5), func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 3 {
+		t.Errorf("want 3 calls, got %d", calls)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	failure := errors.New("permanent failure")
+	calls := 0
+	err := Retry(context.Background(), testPolicy(4), func() error {
+		calls++
+		return failure
+	})
+
+	re, ok := err.(*RetryError)
+	if !ok {
+		t.Fatalf("want *RetryError, got %T", err)
+	}
+
+	if calls != 4 || re.Attempts != 4 {
+		t.Errorf("want 4 attempts, got %d calls and %d attempts", calls, re.Attempts)
+	}
+
+	if !errors.Is(err, failure) {
+		t.Errorf("want error wrapping %q, got %q", failure, err)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	fatal := errors.New("fatal")
+	p := testPolicy(5)
+	p.Retryable = func(err error) bool {
+		return err != fatal
+	}
+
+	calls := 0
+	err := Retry(context.Background(), p, func() error {
+		calls++
+		if calls == 2 {
+			return fatal
+		}
+		return errors.New("temporary failure")
+	})
+
+	if calls != 2 {
+		t.Errorf("want 2 calls, got %d", calls)
+	}
+
+	if re, ok := err.(*RetryError); !ok || re.Attempts != 2 || re.Err != fatal {
+		t.Errorf("want fatal error after 2 attempts, got %v", err)
+	}
+}
+
+func TestRetryContext(t *testing.T) {
+	p := testPolicy(10)
+	p.InitialInterval = time.Hour
+	p.MaxInterval = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := Retry(ctx, p, func() error {
+		return errors.New("temporary failure")
+	})
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("retry did not stop when context was done, took %s", elapsed)
+	}
+
+	re, ok := err.(*RetryError)
+	if !ok {
+		t.Fatalf("want *RetryError, got %T", err)
+	}
+
+	if re.Attempts != 1 || re.Context != context.DeadlineExceeded {
+		t.Errorf("want 1 attempt and deadline exceeded, got %d attempts and %v", re.Attempts, re.Context)
+	}
+
+	// No attempts are made with a context which is already done
+	calls := 0
+	err = Retry(ctx, p, func() error {
+		calls++
+		return nil
+	})
+
+	if calls != 0 || err == nil {
+		t.Errorf("want no calls and an error, got %d calls and %v", calls, err)
+	}
+}
+
+func TestRetryInterval(t *testing.T) {
+	p := Policy{
+		InitialInterval: time.Second,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+	}
+
+	want := []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		10 * time.Second,
+		10 * time.Second,
+	}
+
+	for i, d := range want {
+		if got := p.interval(i + 1); got != d {
+			t.Errorf("interval after %d failed attempts: want %s, got %s", i+1, d, got)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.jitter(time.Second); got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Fatalf("jittered interval %s out of range", got)
+		}
+	}
+}
+
+func TestRetryLogger(t *testing.T) {
+	var buf bytes.Buffer
+	p := testPolicy(3)
+	p.Logger = log.New(&buf, "", 0)
+
+	Retry(context.Background(), p, func() error {
+		return errors.New("temporary failure")
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 logged attempts, got %q", buf.String())
+	}
+
+	if !strings.HasPrefix(lines[0], "attempt 1/3 failed: temporary failure") {
+		t.Errorf("unexpected log line %q", lines[0])
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// s3DefaultRegion is the region used for S3 if none is configured.
+const s3DefaultRegion = "us-east-1"
+
+// parseS3URL returns the bucket and key of an s3://bucket/key URL.
+func parseS3URL(location string) (string, string, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", "", err
+	}
+
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != "s3" || u.Host == "" || key == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %s", location)
+	}
+
+	return u.Host, key, nil
+}
+
+// newS3Request creates a signed request for getting an object from
+// Amazon S3 given as "s3://bucket/key". The credentials and region
+// are loaded the same way as by the AWS CLI, e.g. from the environment,
+// the shared configuration files or the instance profile. The
+// AWS_ENDPOINT_URL environment variable may be used to get the object
+// from an S3 compatible service instead.
+func newS3Request(ctx context.Context, location string) (*http.Request, error) {
+	bucket, key, err := parseS3URL(location)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+
+	// Custom endpoints use path-style URLs, since
+	// they may not support bucket subdomains
+	u := &url.URL{
+		Scheme: "https",
+		Host:   fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, region),
+		Path:   "/" + key,
+	}
+	if endpoint := aws.ToString(cfg.BaseEndpoint); endpoint != "" {
+		u, err = url.Parse(strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/" + key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Credentials == nil {
+		return nil, fmt.Errorf("no AWS credentials found for %s", location)
+	}
+
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The payload of GET requests is empty, so it is not signed
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signer := v4.NewSigner(func(o *v4.SignerOptions) {
+		o.DisableURIPathEscaping = true
+	})
+	if err := signer.SignHTTP(ctx, creds, req, payloadHash, "s3", region, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PathEscapeError type is returned by SecureJoin when
+// a path resolves to a location outside of the root.
+type PathEscapeError struct {
+	// Root directory
+	Root string
+
+	// Path which escapes the root directory
+	Path string
+}
+
+// Error implements the error interface.
+func (e *PathEscapeError) Error() string {
+	return fmt.Sprintf("path %s is outside of %s", e.Path, e.Root)
+}
+
+// SecureJoin joins root and the relative path rel, and returns the
+// result with all symbolic links resolved. An error of type
+// *PathEscapeError is returned if rel is absolute, or if the result
+// is outside of root, either because of ".." components or because
+// of symbolic links inside root pointing outside of it.
+//
+// Components of the result which do not exist yet are not resolved,
+// so the result may be used for creating new files under root.
+func SecureJoin(root, rel string) (string, error) {
+	if filepath.IsAbs(rel) || strings.HasPrefix(rel, "/") {
+		return "", &PathEscapeError{Root: root, Path: rel}
+	}
+
+	resolvedRoot, err := resolvePath(root)
+	if err != nil {
+		return "", err
+	}
+
+	// Reject ".." components escaping root before touching the
+	// file system, so that nothing outside of root is inspected
+	path := filepath.Join(resolvedRoot, rel)
+	if !isWithin(resolvedRoot, path) {
+		return "", &PathEscapeError{Root: root, Path: rel}
+	}
+
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !isWithin(resolvedRoot, resolved) {
+		return "", &PathEscapeError{Root: root, Path: rel}
+	}
+
+	return resolved, nil
+}
+
+// maxSymlinks is the maximum number of symbolic links
+// followed when resolving a path, so that loops are detected.
+const maxSymlinks = 255
+
+// resolvePath resolves the symbolic links in the longest existing
+// prefix of path and appends the remaining components to it.
+// Dangling symbolic links are followed as well, so that the
+// result is where a file created at path would end up.
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	missing := make([]string, 0)
+	for links := 0; ; {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			parts := append([]string{resolved}, missing...)
+			return filepath.Join(parts...), nil
+		}
+
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		// A dangling symbolic link
+		if fi, lerr := os.Lstat(path); lerr == nil && fi.Mode()&os.ModeSymlink != 0 {
+			if links++; links > maxSymlinks {
+				return "", fmt.Errorf("too many links in %s", path)
+			}
+
+			target, err := os.Readlink(path)
+			if err != nil {
+				return "", err
+			}
+
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(path), target)
+			}
+			path = filepath.Clean(target)
+			continue
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecureJoin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-securejoin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Resolve the temporary directory itself, e.g. /tmp may be a link
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(dir, "site")
+	data := filepath.Join(root, "data")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(data, "sub"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		filepath.Join(data, "inside"):      "sub",
+		filepath.Join(data, "escape"):      outside,
+		filepath.Join(data, "relescape"):   "../../outside",
+		filepath.Join(data, "dangling"):    filepath.Join(outside, "missing"),
+		filepath.Join(data, "loop"):        "loop",
+		filepath.Join(data, "sub", "back"): "..",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		rel  string
+		want string
+	}{
+		{"", root},
+		{"data", data},
+		{"data/sub/file", filepath.Join(data, "sub", "file")},
+		{"data/missing/file", filepath.Join(data, "missing", "file")},
+		{"data/../data/sub", filepath.Join(data, "sub")},
+		{"data/inside/file", filepath.Join(data, "sub", "file")},
+		{"data/sub/back/sub", filepath.Join(data, "sub")},
+	}
+
+	for _, tc := range testCases {
+		got, err := SecureJoin(root, tc.rel)
+		if err != nil {
+			t.Errorf("%q: %s", tc.rel, err)
+			continue
+		}
+
+		if got != tc.want {
+			t.Errorf("%q: want %s, got %s", tc.rel, tc.want, got)
+		}
+	}
+
+	escapes := []string{
+		"..",
+		"../outside",
+		"data/../../outside",
+		"data/sub/../../../outside",
+		"../../../../etc/shadow",
+		"/etc/shadow",
+		outside,
+		"data/escape",
+		"data/escape/file",
+		"data/relescape/file",
+		"data/dangling",
+	}
+
+	for _, rel := range escapes {
+		_, err := SecureJoin(root, rel)
+		if _, ok := err.(*PathEscapeError); !ok {
+			t.Errorf("%q: want path escape error, got %v", rel, err)
+		}
+	}
+
+	if _, err := SecureJoin(root, "data/loop"); err == nil {
+		t.Error("want error for symbolic link loop")
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SourceCache type caches remote content in a local directory, so
+// that it can be fetched ahead of time, e.g. concurrently before
+// any resources are processed. Entries are keyed by the URL and
+// checksum of the content, and are only stored once the content
+// has been verified against the checksum.
+//
+// Conditional caches keep content between runs instead. Entries
+// are keyed by the URL only, and the content is revalidated using
+// conditional requests the first time it is used by the cache, so
+// that it is only downloaded again if the remote content changed.
+//
+// A SourceCache is safe for concurrent use.
+type SourceCache struct {
+	// Dir is the directory in which the content is stored
+	Dir string
+
+	// Conditional is true if content is revalidated
+	// using conditional requests
+	Conditional bool
+
+	mu        sync.Mutex
+	validated map[string]bool
+}
+
+// NewSourceCache creates a new cache storing content in dir.
+func NewSourceCache(dir string) *SourceCache {
+	return &SourceCache{Dir: dir}
+}
+
+// NewConditionalSourceCache creates a new cache storing content in
+// dir, which is revalidated using conditional requests.
+func NewConditionalSourceCache(dir string) *SourceCache {
+	return &SourceCache{
+		Dir:         dir,
+		Conditional: true,
+		validated:   make(map[string]bool),
+	}
+}
+
+// Path returns the path at which the content of
+// url with the given checksum is cached.
+func (c *SourceCache) Path(url, checksum string) string {
+	key := url + "\n" + checksum
+	if c.Conditional {
+		key = url
+	}
+
+	return filepath.Join(c.Dir, fmt.Sprintf("%x", sha256.Sum256([]byte(key))))
+}
+
+// Lookup returns the path to the cached content of url with
+// the given checksum, and a boolean indicating whether the
+// content is cached. Content of conditional caches is only
+// returned once it has been revalidated.
+func (c *SourceCache) Lookup(url, checksum string) (string, bool) {
+	if c.Conditional {
+		c.mu.Lock()
+		ok := c.validated[url+"\n"+checksum]
+		c.mu.Unlock()
+		if !ok {
+			return "", false
+		}
+	}
+
+	path := c.Path(url, checksum)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+
+	return path, true
+}
+
+// Fetch returns the path to the cached content of url with the given
+// checksum, fetching the content first if it is not cached yet. The
+// checksum is in the form used by the Fetch function.
+func (c *SourceCache) Fetch(ctx context.Context, url, checksum string) (string, error) {
+	if path, ok := c.Lookup(url, checksum); ok {
+		return path, nil
+	}
+
+	if c.Conditional {
+		return c.revalidate(ctx, url, checksum)
+	}
+
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempFile(c.Dir, ".fetch")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := Fetch(ctx, url, checksum, tmp); err != nil {
+		tmp.Close()
+		return "", err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	// Concurrent fetches of the same content replace
+	// each other atomically, so readers never see
+	// partially written content
+	path := c.Path(url, checksum)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// revalidate returns the path to the cached content of url, which is
+// downloaded again if the remote content changed since it was cached.
+// The validators of the content are stored next to it.
+func (c *SourceCache) revalidate(ctx context.Context, url, checksum string) (string, error) {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return "", err
+	}
+
+	path := c.Path(url, checksum)
+	metaPath := path + ".meta"
+
+	// Validators are only sent if the content is cached
+	var v FetchValidators
+	if _, err := os.Stat(path); err == nil {
+		if data, err := ioutil.ReadFile(metaPath); err == nil {
+			json.Unmarshal(data, &v)
+		}
+	}
+
+	tmp, err := ioutil.TempFile(c.Dir, ".fetch")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	v, err = FetchConditional(ctx, url, checksum, v, tmp)
+	switch {
+	case err == ErrNotModified:
+		tmp.Close()
+		if err := verifyChecksum(path, checksum); err != nil {
+			return "", &FetchError{URL: url, Err: err}
+		}
+	case err != nil:
+		tmp.Close()
+		return "", err
+	default:
+		if err := tmp.Close(); err != nil {
+			return "", err
+		}
+
+		// The validators are removed first, so that they never
+		// refer to content other than the cached one
+		if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			return "", err
+		}
+
+		if v.ETag != "" || v.LastModified != "" {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+
+			if err := WriteFileAtomic(nil, metaPath, data, 0600, -1, -1); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.validated[url+"\n"+checksum] = true
+	c.mu.Unlock()
+
+	return path, nil
+}
+
+// verifyChecksum verifies the content of the file against
+// the checksum, if any, returning ErrChecksumMismatch if it
+// does not match.
+func verifyChecksum(path, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+
+	h, digest, err := parseChecksum(checksum)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	if fmt.Sprintf("%x", h.Sum(nil)) != digest {
+		return ErrChecksumMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSourceCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-sourcecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := []byte("foo = 42\n")
+	digest := fmt.Sprintf("%x", sha256.Sum256(content))
+
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(content)
+	}))
+	defer ts.Close()
+
+	c := NewSourceCache(dir)
+	url := ts.URL + "/foo"
+	if _, ok := c.Lookup(url, digest); ok {
+		t.Fatal("want empty cache")
+	}
+
+	for i := 0; i < 2; i++ {
+		path, err := c.Fetch(context.Background(), url, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != string(content) {
+			t.Errorf("want content %q, got %q", content, data)
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("want content to be fetched once, got %d requests", n)
+	}
+
+	// Checksums are part of the key and mismatches are not cached
+	if c.Path(url, digest) == c.Path(url, "") {
+		t.Error("want different paths for different checksums")
+	}
+
+	if _, err := c.Fetch(context.Background(), url, "sha256:"+digest[1:]+"0"); err == nil {
+		t.Error("want checksum mismatch error")
+	}
+
+	if _, ok := c.Lookup(url, "sha256:"+digest[1:]+"0"); ok {
+		t.Error("want mismatched content not to be cached")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Errorf("want one cached file, got %d", len(files))
+	}
+}
+
+func TestConditionalSourceCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-sourcecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	content := "foo = 42\n"
+	etag := `"v1"`
+	status := http.StatusOK
+	var downloads, notModified int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		downloads++
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(content))
+	}))
+	defer ts.Close()
+
+	url := ts.URL + "/foo"
+	fetch := func(c *SourceCache, checksum string) (string, error) {
+		path, err := c.Fetch(context.Background(), url, checksum)
+		if err != nil {
+			return "", err
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(data), nil
+	}
+
+	// Content is revalidated once per cache, i.e. once per run
+	c := NewConditionalSourceCache(dir)
+	for i := 0; i < 2; i++ {
+		data, err := fetch(c, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data != content {
+			t.Errorf("want content %q, got %q", content, data)
+		}
+	}
+
+	if downloads != 1 || notModified != 0 {
+		t.Errorf("want one download, got %d downloads and %d not modified", downloads, notModified)
+	}
+
+	// Unchanged content is not downloaded again in the next run
+	digest := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	c = NewConditionalSourceCache(dir)
+	if _, err := fetch(c, digest); err != nil {
+		t.Fatal(err)
+	}
+	if downloads != 1 || notModified != 1 {
+		t.Errorf("want content not modified, got %d downloads and %d not modified", downloads, notModified)
+	}
+
+	// Cached content is verified against the checksum
+	c = NewConditionalSourceCache(dir)
+	if _, err := fetch(c, "sha256:"+digest[1:]+"0"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("want checksum mismatch error, got %v", err)
+	}
+
+	// Changed content is downloaded again
+	mu.Lock()
+	content, etag = "foo = 43\n", `"v2"`
+	mu.Unlock()
+
+	c = NewConditionalSourceCache(dir)
+	data, err := fetch(c, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != content || downloads != 2 {
+		t.Errorf("want changed content downloaded, got %q after %d downloads", data, downloads)
+	}
+
+	// Other statuses are errors
+	mu.Lock()
+	status = http.StatusInternalServerError
+	mu.Unlock()
+
+	c = NewConditionalSourceCache(dir)
+	if _, err := fetch(c, ""); err == nil {
+		t.Error("want error for internal server error")
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// SparseMode type specifies how holes in sparse files are handled
+// when copying file content.
+type SparseMode int
+
+const (
+	// SparseNever copies the content as is, which
+	// materializes any holes at the destination.
+	SparseNever SparseMode = iota
+
+	// SparseAuto reproduces the holes of the source file at the
+	// destination, if holes can be detected on the current platform
+	// and filesystem.
+	SparseAuto
+
+	// SparseAlways reproduces the holes of the source file at the
+	// destination. Where holes cannot be detected, blocks of
+	// zeros are skipped instead, creating holes at the destination.
+	SparseAlways
+)
+
+// sparseBlockSize is the size of the blocks checked for zeros,
+// when holes cannot be detected.
+const sparseBlockSize = 64 << 10
+
+// dataSegment type is a region of a file containing data.
+type dataSegment struct {
+	offset int64
+	length int64
+}
+
+// copyContent copies size bytes of content from src to dst, handling
+// holes in the source file according to the given sparse mode.
+// Holes are always read back as zeros, so checksums of the source
+// and destination files match regardless of the sparse mode.
+func copyContent(dst, src *os.File, size int64, mode SparseMode) error {
+	if mode == SparseNever {
+		return copyN(dst, src, size)
+	}
+
+	segments, err := dataSegments(src, size)
+	if err == nil {
+		return copySegments(dst, src, size, segments)
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if mode == SparseAlways {
+		return copySkippingZeros(dst, src, size)
+	}
+
+	return copyN(dst, src, size)
+}
+
+// copySegments copies the data segments from src to dst and
+// extends dst to size, leaving holes in between.
+func copySegments(dst, src *os.File, size int64, segments []dataSegment) error {
+	for _, s := range segments {
+		if _, err := src.Seek(s.offset, io.SeekStart); err != nil {
+			return err
+		}
+
+		if _, err := dst.Seek(s.offset, io.SeekStart); err != nil {
+			return err
+		}
+
+		if err := copyN(dst, src, s.length); err != nil {
+			return err
+		}
+	}
+
+	return dst.Truncate(size)
+}
+
+// copySkippingZeros copies size bytes from src to dst, seeking
+// over blocks of zeros instead of writing them.
+func copySkippingZeros(dst, src *os.File, size int64) error {
+	buf := make([]byte, sparseBlockSize)
+	zeros := make([]byte, sparseBlockSize)
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			if bytes.Equal(buf[:n], zeros[:n]) {
+				if _, err := dst.Seek(int64(n), io.SeekCurrent); err != nil {
+					return err
+				}
+			} else if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return dst.Truncate(size)
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build linux
+
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// allocatedBytes returns the number of bytes allocated on disk for a file.
+func allocatedBytes(t *testing.T, path string) int64 {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		t.Fatal(err)
+	}
+
+	return st.Blocks * 512
+}
+
+func TestCopySparse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A file with data at the beginning and in the middle,
+	// followed by a trailing hole
+	const size = 8 << 20
+	data := bytes.Repeat([]byte("gru"), 4096)
+	src := filepath.Join(dir, "src")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, offset := range []int64{0, size / 2} {
+		if _, err := f.WriteAt(data, offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	srcUtil := NewFileUtil(src)
+	want, err := srcUtil.Sha256()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sparseFS := allocatedBytes(t, src) < size
+	for _, mode := range []SparseMode{SparseNever, SparseAuto, SparseAlways} {
+		dst := NewFileUtil(filepath.Join(dir, "dst"))
+		dst.Sparse = mode
+		if err := dst.CopyFrom(src, true); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := dst.Sha256()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Errorf("sparse mode %d: want checksum %s, got %s", mode, want, got)
+		}
+
+		allocated := allocatedBytes(t, dst.Path)
+		if sparseFS && mode != SparseNever && allocated >= size {
+			t.Errorf("sparse mode %d: want holes at destination, got %d bytes allocated", mode, allocated)
+		}
+	}
+}
+
+func TestCopySkippingZeros(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := make([]byte, 3*sparseBlockSize+100)
+	copy(content[sparseBlockSize:], "gru")
+	content[len(content)-1] = 'x'
+	src, err := os.Open(writeTempFile(t, dir, "src", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(filepath.Join(dir, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	if err := copySkippingZeros(dst, src, int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(dst.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, content) {
+		t.Error("content differs after skipping zeros")
+	}
+}
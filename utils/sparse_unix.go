@@ -0,0 +1,66 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// +build linux freebsd darwin
+
+package utils
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// dataSegments returns the data segments of a file using
+// SEEK_DATA and SEEK_HOLE. An error is returned if holes
+// cannot be detected on the filesystem of the file.
+func dataSegments(f *os.File, size int64) ([]dataSegment, error) {
+	segments := make([]dataSegment, 0)
+	for offset := int64(0); offset < size; {
+		start, err := f.Seek(offset, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			// No more data until the end of file
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := f.Seek(start, seekHole)
+		if err != nil {
+			return nil, err
+		}
+
+		if end > size {
+			end = size
+		}
+
+		segments = append(segments, dataSegment{offset: start, length: end - start})
+		offset = end
+	}
+
+	return segments, nil
+}
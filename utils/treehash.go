@@ -0,0 +1,223 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TreeEntry type represents a file, directory or
+// symbolic link in the checksum of a file tree.
+type TreeEntry struct {
+	// Mode of the entry, including its type
+	Mode os.FileMode `json:"mode"`
+
+	// Digest of the entry. The digest of a file is the checksum of
+	// its content, of a symbolic link the checksum of its target,
+	// and of a directory the checksum of its entries.
+	Digest string `json:"digest"`
+}
+
+// TreeChecksum type contains the Merkle-style checksum of a file tree,
+// in which the digest of each directory covers the names, modes and
+// digests of its entries, so that the digest of the root directory
+// changes whenever any path in the tree changes.
+type TreeChecksum struct {
+	// Algorithm used for computing the digests
+	Algorithm string `json:"algorithm"`
+
+	// Digest of the whole tree
+	Digest string `json:"digest"`
+
+	// Entries contains the entries of the tree keyed by their path
+	// relative to the root, using slashes as separators. The root
+	// itself is keyed by ".".
+	Entries map[string]TreeEntry `json:"entries"`
+}
+
+// ComputeTreeChecksum computes the checksum of the file tree rooted at
+// root. Files are hashed concurrently using HashFiles. Paths matching
+// the exclude patterns, which use the syntax of filepath.Match, are
+// left out of the checksum.
+func ComputeTreeChecksum(root string, exclude []string, opts HashOptions) (*TreeChecksum, error) {
+	if opts.Algorithm == "" {
+		opts.Algorithm = "sha256"
+	}
+
+	if _, err := NewHash(opts.Algorithm); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	infos := make(map[string]os.FileInfo)
+	files := make([]string, 0)
+	walkFn := func(path string, info os.FileInfo) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		infos[path] = info
+		if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+
+		return nil
+	}
+
+	walkOpts := WalkOptions{
+		Concurrency: opts.Concurrency,
+		Exclude:     exclude,
+	}
+	if err := Walk(root, walkOpts, walkFn); err != nil {
+		return nil, err
+	}
+
+	result := HashFiles(files, opts)
+	for _, path := range files {
+		if err := result.Errors[path]; err != nil {
+			return nil, err
+		}
+	}
+
+	tc := &TreeChecksum{
+		Algorithm: opts.Algorithm,
+		Entries:   make(map[string]TreeEntry, len(infos)),
+	}
+
+	rels := make(map[string]string, len(infos))
+	paths := make([]string, 0, len(infos))
+	for path := range infos {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, err
+		}
+		rels[path] = filepath.ToSlash(rel)
+		paths = append(paths, path)
+	}
+
+	// Directories are hashed after their entries, so
+	// that deeper paths are processed first
+	depth := func(rel string) int {
+		if rel == "." {
+			return 0
+		}
+		return strings.Count(rel, "/") + 1
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		di, dj := depth(rels[paths[i]]), depth(rels[paths[j]])
+		if di != dj {
+			return di > dj
+		}
+		return paths[i] < paths[j]
+	})
+
+	children := make(map[string][]string)
+	for _, path := range paths {
+		info := infos[path]
+		rel := rels[path]
+
+		var digest string
+		switch {
+		case info.Mode().IsRegular():
+			digest = result.Digests[path]
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return nil, err
+			}
+			digest = stringChecksum(opts.Algorithm, target)
+		case info.IsDir():
+			sort.Strings(children[rel])
+			digest = stringChecksum(opts.Algorithm, strings.Join(children[rel], ""))
+		default:
+			// Devices, sockets and pipes have no content
+			digest = stringChecksum(opts.Algorithm, "")
+		}
+
+		mode := info.Mode() & (os.ModeType | fileModeMask)
+		tc.Entries[rel] = TreeEntry{Mode: mode, Digest: digest}
+
+		if rel != "." {
+			parent := "."
+			if i := strings.LastIndex(rel, "/"); i >= 0 {
+				parent = rel[:i]
+			}
+			line := fmt.Sprintf("%s %o %s\n", info.Name(), uint32(mode), digest)
+			children[parent] = append(children[parent], line)
+		}
+	}
+	tc.Digest = tc.Entries["."].Digest
+
+	return tc, nil
+}
+
+// Changed returns the sorted paths, which have been added, removed
+// or modified in the tree since the baseline checksum was computed.
+// Directories are reported only if their own mode has changed, or if
+// they have been added or removed, but not when their entries change.
+func (tc *TreeChecksum) Changed(baseline *TreeChecksum) []string {
+	changed := make([]string, 0)
+	if tc.Digest == baseline.Digest && tc.Algorithm == baseline.Algorithm {
+		return changed
+	}
+
+	for path, entry := range tc.Entries {
+		old, ok := baseline.Entries[path]
+		switch {
+		case !ok:
+			changed = append(changed, path)
+		case entry.Mode != old.Mode:
+			changed = append(changed, path)
+		case entry.Mode.IsDir():
+		case entry.Digest != old.Digest || tc.Algorithm != baseline.Algorithm:
+			changed = append(changed, path)
+		}
+	}
+
+	for path := range baseline.Entries {
+		if _, ok := tc.Entries[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed
+}
+
+// stringChecksum returns the hex encoded checksum of a string.
+func stringChecksum(algorithm, s string) string {
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return ""
+	}
+	h.Write([]byte(s))
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
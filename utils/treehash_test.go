@@ -0,0 +1,148 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTreeChecksum(t *testing.T) {
+	root, err := ioutil.TempDir("", "gru-treehash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"a":       "foo",
+		"b/c":     "bar",
+		"b/d/e":   "qux",
+		"f.cache": "ignored",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink("a", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	exclude := []string{"*.cache"}
+	baseline, err := ComputeTreeChecksum(root, exclude, HashOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantPaths := []string{".", "a", "b", "b/c", "b/d", "b/d/e", "link"}
+	gotPaths := make([]string, 0)
+	for path := range baseline.Entries {
+		gotPaths = append(gotPaths, path)
+	}
+	if !reflect.DeepEqual(wantPaths, sortedStrings(gotPaths)) {
+		t.Errorf("want paths %v, got %v", wantPaths, sortedStrings(gotPaths))
+	}
+
+	if baseline.Entries["a"].Digest != "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae" {
+		t.Errorf("unexpected digest for a: %s", baseline.Entries["a"].Digest)
+	}
+
+	// The checksum is stable
+	again, err := ComputeTreeChecksum(root+string(filepath.Separator), exclude, HashOptions{Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again.Digest != baseline.Digest || len(again.Changed(baseline)) != 0 {
+		t.Errorf("want stable checksum, got %s and %s", baseline.Digest, again.Digest)
+	}
+
+	// Excluded files do not affect the checksum
+	if err := ioutil.WriteFile(filepath.Join(root, "f.cache"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Content, mode and additions and removals of paths are detected
+	if err := ioutil.WriteFile(filepath.Join(root, "b/d/e"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(filepath.Join(root, "b/c"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(root, "a")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "b/g"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("b", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := ComputeTreeChecksum(root, exclude, HashOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if current.Digest == baseline.Digest {
+		t.Error("want checksum to change")
+	}
+
+	want := []string{"a", "b/c", "b/d/e", "b/g", "link"}
+	if got := current.Changed(baseline); !reflect.DeepEqual(want, got) {
+		t.Errorf("want changed paths %v, got %v", want, got)
+	}
+
+	if _, err := ComputeTreeChecksum(root, nil, HashOptions{Algorithm: "crc32"}); err == nil {
+		t.Error("want error for unknown algorithm")
+	}
+}
+
+// sortedStrings returns a sorted copy of a slice.
+func sortedStrings(s []string) []string {
+	sorted := append([]string{}, s...)
+	sort.Strings(sorted)
+
+	return sorted
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// RebootRequiredFile is the file created on Debian-based
+// systems when a reboot is required to complete updates.
+var RebootRequiredFile = "/var/run/reboot-required"
+
+// PendingUpdates type contains the package updates, which
+// are available, but not yet installed on the system.
+type PendingUpdates struct {
+	// Manager is the package manager the updates were
+	// collected from, e.g. "apt" or "dnf"
+	Manager string `json:"manager"`
+
+	// Packages contains the sorted names of upgradable packages
+	Packages []string `json:"packages"`
+
+	// Security contains the sorted names of upgradable packages
+	// with security updates, if the package manager exposes them
+	Security []string `json:"security"`
+
+	// RebootRequired specifies whether a reboot is pending
+	// in order to complete previously installed updates
+	RebootRequired bool `json:"reboot_required"`
+}
+
+// CollectPendingUpdates collects the pending package updates using
+// apt or dnf, whichever is available. Nothing is changed on the system,
+// although the package metadata may be refreshed by the package manager.
+func CollectPendingUpdates(ctx context.Context) (*PendingUpdates, error) {
+	u, err := aptPendingUpdates(ctx)
+	if err == ErrCommandNotFound {
+		u, err = dnfPendingUpdates(ctx)
+	}
+	if err == ErrCommandNotFound {
+		return nil, &NotSupportedError{Op: "collecting pending updates"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(u.Packages)
+	sort.Strings(u.Security)
+
+	return u, nil
+}
+
+// aptPendingUpdates collects the pending updates using apt. Packages
+// from a "-security" suite are reported as security updates, e.g.
+//
+//   openssl/jammy-updates,jammy-security 3.0.2-0ubuntu1.10 amd64 [upgradable from: 3.0.2-0ubuntu1.9]
+func aptPendingUpdates(ctx context.Context) (*PendingUpdates, error) {
+	spec := CommandSpec{
+		Args: []string{"apt", "list", "--upgradable"},
+		Env:  []string{"LC_ALL=C"},
+	}
+	result, err := RunCommand(ctx, spec)
+	if err == ErrCommandNotFound {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("apt failed: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	u := &PendingUpdates{
+		Manager:  "apt",
+		Packages: make([]string, 0),
+		Security: make([]string, 0),
+	}
+
+	for _, line := range strings.Split(string(result.Stdout), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.Contains(fields[0], "/") {
+			continue
+		}
+
+		kv := strings.SplitN(fields[0], "/", 2)
+		u.Packages = append(u.Packages, kv[0])
+		for _, suite := range strings.Split(kv[1], ",") {
+			if strings.HasSuffix(suite, "-security") {
+				u.Security = append(u.Security, kv[0])
+				break
+			}
+		}
+	}
+
+	if _, err := os.Stat(RebootRequiredFile); err == nil {
+		u.RebootRequired = true
+	}
+
+	return u, nil
+}
+
+// dnfPendingUpdates collects the pending updates using dnf, which
+// exits with status 100 if updates are available. Whether a reboot
+// is pending is determined using needs-restarting, if installed.
+func dnfPendingUpdates(ctx context.Context) (*PendingUpdates, error) {
+	packages, err := dnfCheckUpdate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	security, err := dnfCheckUpdate(ctx, "--security")
+	if err != nil {
+		return nil, err
+	}
+
+	u := &PendingUpdates{
+		Manager:  "dnf",
+		Packages: packages,
+		Security: security,
+	}
+
+	spec := CommandSpec{Args: []string{"needs-restarting", "-r"}}
+	result, err := RunCommand(ctx, spec)
+	switch {
+	case err == nil, err == ErrCommandNotFound:
+	case result.ExitCode == 1:
+		u.RebootRequired = true
+	default:
+		return nil, fmt.Errorf("needs-restarting failed: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return u, nil
+}
+
+// dnfCheckUpdate returns the names of the packages
+// reported by dnf check-update with the given options.
+func dnfCheckUpdate(ctx context.Context, opts ...string) ([]string, error) {
+	spec := CommandSpec{
+		Args: append([]string{"dnf", "-q", "check-update"}, opts...),
+		Env:  []string{"LC_ALL=C"},
+	}
+	result, err := RunCommand(ctx, spec)
+	if err == ErrCommandNotFound {
+		return nil, err
+	}
+	if err != nil && result.ExitCode != 100 {
+		return nil, fmt.Errorf("dnf failed: %s: %s", err, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	packages := make([]string, 0)
+	for _, line := range strings.Split(string(result.Stdout), "\n") {
+		// Obsoleted packages are listed after the updates
+		if strings.HasPrefix(line, "Obsoleting") {
+			break
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasPrefix(line, " ") {
+			continue
+		}
+
+		name := fields[0]
+		if i := strings.LastIndex(name, "."); i != -1 {
+			name = name[:i]
+		}
+		packages = append(packages, name)
+	}
+
+	return packages, nil
+}
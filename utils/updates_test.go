@@ -0,0 +1,144 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useCommands makes commands return the given output, keyed by
+// their arguments, and returns a function restoring the previous
+// command runner. Commands without output are not found.
+func useCommands(outputs map[string]CommandResult) func() {
+	runner := func(ctx context.Context, spec CommandSpec) (CommandResult, error) {
+		result, ok := outputs[strings.Join(spec.Args, " ")]
+		switch {
+		case !ok:
+			return CommandResult{ExitCode: -1}, ErrCommandNotFound
+		case result.ExitCode != 0:
+			return result, errors.New("exit status")
+		}
+		return result, nil
+	}
+
+	defaultRunner := DefaultCommandRunner
+	DefaultCommandRunner = CommandRunnerFunc(runner)
+
+	return func() { DefaultCommandRunner = defaultRunner }
+}
+
+func TestCollectPendingUpdatesApt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-updates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defaultRebootRequiredFile := RebootRequiredFile
+	RebootRequiredFile = filepath.Join(dir, "reboot-required")
+	defer func() { RebootRequiredFile = defaultRebootRequiredFile }()
+
+	out := `Listing...
+openssl/jammy-updates,jammy-security 3.0.2-0ubuntu1.10 amd64 [upgradable from: 3.0.2-0ubuntu1.9]
+curl/jammy-updates 7.81.0-1ubuntu1.14 amd64 [upgradable from: 7.81.0-1ubuntu1.13]
+`
+	defer useCommands(map[string]CommandResult{
+		"apt list --upgradable": {Stdout: []byte(out)},
+	})()
+
+	u, err := CollectPendingUpdates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &PendingUpdates{
+		Manager:  "apt",
+		Packages: []string{"curl", "openssl"},
+		Security: []string{"openssl"},
+	}
+	if !reflect.DeepEqual(want, u) {
+		t.Errorf("want %+v, got %+v", want, u)
+	}
+
+	if err := ioutil.WriteFile(RebootRequiredFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err = CollectPendingUpdates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !u.RebootRequired {
+		t.Error("want reboot required")
+	}
+}
+
+func TestCollectPendingUpdatesDnf(t *testing.T) {
+	out := `
+kernel.x86_64                     6.5.6-200.fc38          updates
+openssl-libs.x86_64               1:3.0.9-2.fc38          updates
+Obsoleting Packages
+grub2-tools.x86_64                1:2.06-100.fc38         updates
+    grub2-tools.x86_64            1:2.06-95.fc38          @updates
+`
+	security := "openssl-libs.x86_64               1:3.0.9-2.fc38          updates\n"
+	defer useCommands(map[string]CommandResult{
+		"dnf -q check-update":            {ExitCode: 100, Stdout: []byte(out)},
+		"dnf -q check-update --security": {ExitCode: 100, Stdout: []byte(security)},
+		"needs-restarting -r":            {ExitCode: 1},
+	})()
+
+	u, err := CollectPendingUpdates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &PendingUpdates{
+		Manager:        "dnf",
+		Packages:       []string{"kernel", "openssl-libs"},
+		Security:       []string{"openssl-libs"},
+		RebootRequired: true,
+	}
+	if !reflect.DeepEqual(want, u) {
+		t.Errorf("want %+v, got %+v", want, u)
+	}
+}
+
+func TestCollectPendingUpdatesNotSupported(t *testing.T) {
+	defer useCommands(nil)()
+
+	if _, err := CollectPendingUpdates(context.Background()); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("want ErrNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"os/user"
+	"sync"
+)
+
+// userEntry type contains the cached result of a user lookup.
+type userEntry struct {
+	user *user.User
+	err  error
+}
+
+// groupEntry type contains the cached result of a group lookup.
+type groupEntry struct {
+	group *user.Group
+	err   error
+}
+
+// UserCache type caches lookups of users and groups, which may be
+// expensive on systems using a remote user database, e.g. LDAP.
+// Lookups for unknown users and groups are cached as well.
+// Other errors are not cached, so that they can be retried.
+//
+// A UserCache is safe for concurrent use. A nil *UserCache
+// performs the lookups using the DefaultUserResolver without caching.
+type UserCache struct {
+	// Resolver used for the lookups. If nil, the
+	// DefaultUserResolver is used.
+	Resolver UserResolver
+
+	mu           sync.RWMutex
+	current      *user.User
+	usersByID    map[string]userEntry
+	usersByName  map[string]userEntry
+	groupsByID   map[string]groupEntry
+	groupsByName map[string]groupEntry
+}
+
+// NewUserCache creates a new empty cache for users and groups.
+func NewUserCache() *UserCache {
+	return &UserCache{
+		usersByID:    make(map[string]userEntry),
+		usersByName:  make(map[string]userEntry),
+		groupsByID:   make(map[string]groupEntry),
+		groupsByName: make(map[string]groupEntry),
+	}
+}
+
+// isUnknown returns a boolean indicating whether the error is
+// returned because a user or group does not exist.
+func isUnknown(err error) bool {
+	switch err.(type) {
+	case user.UnknownUserError, user.UnknownUserIdError, user.UnknownGroupError, user.UnknownGroupIdError:
+		return true
+	}
+
+	return false
+}
+
+// resolver returns the resolver used for the lookups.
+func (uc *UserCache) resolver() UserResolver {
+	if uc == nil {
+		return DefaultUserResolver
+	}
+
+	return userResolver(uc.Resolver)
+}
+
+// Prime caches the current user and its primary group.
+func (uc *UserCache) Prime() error {
+	u, err := uc.Current()
+	if err != nil {
+		return err
+	}
+
+	_, err = uc.LookupGroupId(u.Gid)
+
+	return err
+}
+
+// Current returns the current user.
+func (uc *UserCache) Current() (*user.User, error) {
+	if uc == nil {
+		return uc.resolver().Current()
+	}
+
+	uc.mu.RLock()
+	current := uc.current
+	uc.mu.RUnlock()
+	if current != nil {
+		return current, nil
+	}
+
+	u, err := uc.resolver().Current()
+	if err != nil {
+		return nil, err
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.current = u
+	uc.usersByID[u.Uid] = userEntry{user: u}
+	uc.usersByName[u.Username] = userEntry{user: u}
+
+	return u, nil
+}
+
+// LookupId looks up a user by user id.
+func (uc *UserCache) LookupId(uid string) (*user.User, error) {
+	if uc == nil {
+		return uc.resolver().LookupId(uid)
+	}
+
+	return uc.lookupUser(uc.usersByID, uid, uc.resolver().LookupId)
+}
+
+// Lookup looks up a user by username.
+func (uc *UserCache) Lookup(username string) (*user.User, error) {
+	if uc == nil {
+		return uc.resolver().Lookup(username)
+	}
+
+	return uc.lookupUser(uc.usersByName, username, uc.resolver().Lookup)
+}
+
+// LookupGroupId looks up a group by group id.
+func (uc *UserCache) LookupGroupId(gid string) (*user.Group, error) {
+	if uc == nil {
+		return uc.resolver().LookupGroupId(gid)
+	}
+
+	return uc.lookupGroup(uc.groupsByID, gid, uc.resolver().LookupGroupId)
+}
+
+// LookupGroup looks up a group by name.
+func (uc *UserCache) LookupGroup(name string) (*user.Group, error) {
+	if uc == nil {
+		return uc.resolver().LookupGroup(name)
+	}
+
+	return uc.lookupGroup(uc.groupsByName, name, uc.resolver().LookupGroup)
+}
+
+// lookupUser returns the cached user for key, or looks it up and
+// caches the result in both the user id and username caches.
+func (uc *UserCache) lookupUser(cache map[string]userEntry, key string, lookup func(string) (*user.User, error)) (*user.User, error) {
+	uc.mu.RLock()
+	entry, ok := cache[key]
+	uc.mu.RUnlock()
+	if ok {
+		return entry.user, entry.err
+	}
+
+	u, err := lookup(key)
+	if err != nil && !isUnknown(err) {
+		return nil, err
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	cache[key] = userEntry{user: u, err: err}
+	if u != nil {
+		uc.usersByID[u.Uid] = userEntry{user: u}
+		uc.usersByName[u.Username] = userEntry{user: u}
+	}
+
+	return u, err
+}
+
+// lookupGroup returns the cached group for key, or looks it up and
+// caches the result in both the group id and name caches.
+func (uc *UserCache) lookupGroup(cache map[string]groupEntry, key string, lookup func(string) (*user.Group, error)) (*user.Group, error) {
+	uc.mu.RLock()
+	entry, ok := cache[key]
+	uc.mu.RUnlock()
+	if ok {
+		return entry.group, entry.err
+	}
+
+	g, err := lookup(key)
+	if err != nil && !isUnknown(err) {
+		return nil, err
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	cache[key] = groupEntry{group: g, err: err}
+	if g != nil {
+		uc.groupsByID[g.Gid] = groupEntry{group: g}
+		uc.groupsByName[g.Name] = groupEntry{group: g}
+	}
+
+	return g, err
+}
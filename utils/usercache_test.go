@@ -0,0 +1,130 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"os/user"
+	"sync"
+	"testing"
+)
+
+func TestUserCache(t *testing.T) {
+	uc := NewUserCache()
+	if err := uc.Prime(); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := uc.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Priming caches the current user by id and name
+	byID, err := uc.LookupId(current.Uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byName, err := uc.Lookup(current.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if byID != current || byName != current {
+		t.Error("want cached current user to be returned")
+	}
+
+	group, err := uc.LookupGroupId(current.Gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := uc.groupsByName[group.Name]; !ok {
+		t.Errorf("want group %s to be cached by name", group.Name)
+	}
+}
+
+func TestUserCacheUnknown(t *testing.T) {
+	uc := NewUserCache()
+
+	const name = "gru-no-such-user"
+	for i := 0; i < 2; i++ {
+		if _, err := uc.Lookup(name); err == nil {
+			t.Fatalf("want error for unknown user %s", name)
+		} else if _, ok := err.(user.UnknownUserError); !ok {
+			t.Skipf("user lookup returned %T, unable to test negative caching", err)
+		}
+	}
+
+	if entry, ok := uc.usersByName[name]; !ok || entry.err == nil {
+		t.Errorf("want unknown user %s to be cached", name)
+	}
+
+	const group = "gru-no-such-group"
+	if _, err := uc.LookupGroup(group); err == nil {
+		t.Fatalf("want error for unknown group %s", group)
+	}
+
+	if _, ok := uc.groupsByName[group]; !ok {
+		t.Errorf("want unknown group %s to be cached", group)
+	}
+}
+
+func TestUserCacheConcurrent(t *testing.T) {
+	uc := NewUserCache()
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := uc.LookupId(current.Uid); err != nil {
+				t.Error(err)
+			}
+			if _, err := uc.LookupGroupId(current.Gid); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestUserCacheNil(t *testing.T) {
+	var uc *UserCache
+
+	u, err := uc.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := uc.LookupId(u.Uid); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// UserResolver is the interface type for looking up users and groups,
+// so that they can be resolved using a directory service, which is
+// not visible to the os/user package, e.g. LDAP or SSSD in builds
+// without cgo.
+//
+// Implementations return the errors of the os/user package, e.g.
+// user.UnknownUserError, for users and groups which do not exist.
+type UserResolver interface {
+	// Current returns the current user
+	Current() (*user.User, error)
+
+	// LookupId looks up a user by user id
+	LookupId(uid string) (*user.User, error)
+
+	// Lookup looks up a user by username
+	Lookup(username string) (*user.User, error)
+
+	// LookupGroupId looks up a group by group id
+	LookupGroupId(gid string) (*user.Group, error)
+
+	// LookupGroup looks up a group by name
+	LookupGroup(name string) (*user.Group, error)
+}
+
+// OSUserResolver type looks up users and groups using the os/user package.
+type OSUserResolver struct{}
+
+// Current returns the current user.
+func (OSUserResolver) Current() (*user.User, error) {
+	return user.Current()
+}
+
+// LookupId looks up a user by user id.
+func (OSUserResolver) LookupId(uid string) (*user.User, error) {
+	return user.LookupId(uid)
+}
+
+// Lookup looks up a user by username.
+func (OSUserResolver) Lookup(username string) (*user.User, error) {
+	return user.Lookup(username)
+}
+
+// LookupGroupId looks up a group by group id.
+func (OSUserResolver) LookupGroupId(gid string) (*user.Group, error) {
+	return user.LookupGroupId(gid)
+}
+
+// LookupGroup looks up a group by name.
+func (OSUserResolver) LookupGroup(name string) (*user.Group, error) {
+	return user.LookupGroup(name)
+}
+
+// DefaultUserResolver is the UserResolver used
+// when no other resolver is configured.
+var DefaultUserResolver UserResolver = OSUserResolver{}
+
+// userResolver returns r, or the DefaultUserResolver if r is nil.
+func userResolver(r UserResolver) UserResolver {
+	if r == nil {
+		return DefaultUserResolver
+	}
+
+	return r
+}
+
+// GetentUserResolver type looks up users and groups using getent(1),
+// which queries all databases configured in nsswitch.conf(5), e.g.
+// LDAP or SSSD, even if the os/user package can only read the
+// local /etc/passwd and /etc/group files.
+type GetentUserResolver struct{}
+
+// getent executes getent(1) for the given database and key and returns
+// the fields of the entry, or a nil slice if the entry does not exist.
+func (GetentUserResolver) getent(database, key string) ([]string, error) {
+	spec := CommandSpec{Args: []string{"getent", database, key}}
+	result, err := RunCommand(context.Background(), spec)
+
+	// Exit code 2 means that the key could not be found
+	if result.ExitCode == 2 {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("getent %s %s: %s", database, key, err)
+	}
+
+	line := strings.SplitN(strings.TrimSpace(string(result.Stdout)), "\n", 2)[0]
+
+	return strings.Split(line, ":"), nil
+}
+
+// user looks up a user by name or user id.
+func (r GetentUserResolver) user(key string) (*user.User, []string, error) {
+	fields, err := r.getent("passwd", key)
+	if err != nil || fields == nil {
+		return nil, fields, err
+	}
+
+	if len(fields) != 7 {
+		return nil, nil, fmt.Errorf("invalid passwd entry for %s", key)
+	}
+
+	u := &user.User{
+		Username: fields[0],
+		Uid:      fields[2],
+		Gid:      fields[3],
+		Name:     strings.SplitN(fields[4], ",", 2)[0],
+		HomeDir:  fields[5],
+	}
+
+	return u, fields, nil
+}
+
+// group looks up a group by name or group id.
+func (r GetentUserResolver) group(key string) (*user.Group, error) {
+	fields, err := r.getent("group", key)
+	if err != nil || fields == nil {
+		return nil, err
+	}
+
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("invalid group entry for %s", key)
+	}
+
+	return &user.Group{Name: fields[0], Gid: fields[2]}, nil
+}
+
+// Current returns the current user.
+func (r GetentUserResolver) Current() (*user.User, error) {
+	return r.LookupId(strconv.Itoa(os.Getuid()))
+}
+
+// LookupId looks up a user by user id.
+func (r GetentUserResolver) LookupId(uid string) (*user.User, error) {
+	id, err := strconv.Atoi(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	u, fields, err := r.user(uid)
+	if err == nil && fields == nil {
+		return nil, user.UnknownUserIdError(id)
+	}
+
+	return u, err
+}
+
+// Lookup looks up a user by username.
+func (r GetentUserResolver) Lookup(username string) (*user.User, error) {
+	// getent treats numeric keys as ids
+	if _, err := strconv.Atoi(username); err == nil {
+		return nil, user.UnknownUserError(username)
+	}
+
+	u, fields, err := r.user(username)
+	if err == nil && fields == nil {
+		return nil, user.UnknownUserError(username)
+	}
+
+	return u, err
+}
+
+// LookupGroupId looks up a group by group id.
+func (r GetentUserResolver) LookupGroupId(gid string) (*user.Group, error) {
+	if _, err := strconv.Atoi(gid); err != nil {
+		return nil, err
+	}
+
+	g, err := r.group(gid)
+	if err == nil && g == nil {
+		return nil, user.UnknownGroupIdError(gid)
+	}
+
+	return g, err
+}
+
+// LookupGroup looks up a group by name.
+func (r GetentUserResolver) LookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return nil, user.UnknownGroupError(name)
+	}
+
+	g, err := r.group(name)
+	if err == nil && g == nil {
+		return nil, user.UnknownGroupError(name)
+	}
+
+	return g, err
+}
+
+// ParseUserResolver returns the resolver with the given
+// name, which is either "os" or "getent".
+func ParseUserResolver(name string) (UserResolver, error) {
+	switch name {
+	case "os":
+		return OSUserResolver{}, nil
+	case "getent":
+		return GetentUserResolver{}, nil
+	}
+
+	return nil, fmt.Errorf("Invalid user resolver '%s'", name)
+}
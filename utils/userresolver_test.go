@@ -0,0 +1,154 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"os/user"
+	"testing"
+)
+
+func TestUserCacheResolver(t *testing.T) {
+	r := NewMemUserResolver()
+	r.AddGroup("ldap-admins", 5000)
+	r.AddUser("alice", 5001, 5000)
+
+	uc := NewUserCache()
+	uc.Resolver = r
+	if err := uc.Prime(); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := uc.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if current.Username != "root" {
+		t.Errorf("want current user root, got %s", current.Username)
+	}
+
+	u, err := uc.Lookup("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Uid != "5001" || u.Gid != "5000" {
+		t.Errorf("want uid 5001 and gid 5000, got %s and %s", u.Uid, u.Gid)
+	}
+
+	g, err := uc.LookupGroupId("5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g.Name != "ldap-admins" {
+		t.Errorf("want group ldap-admins, got %s", g.Name)
+	}
+
+	if _, err := uc.LookupId("5002"); err == nil {
+		t.Error("want error for unknown user id")
+	} else if _, ok := err.(user.UnknownUserIdError); !ok {
+		t.Errorf("want user.UnknownUserIdError, got %T", err)
+	}
+
+	// Users added later are not seen, since unknown users are cached
+	r.AddUser("bob", 5002, 5000)
+	if _, err := uc.LookupId("5002"); err == nil {
+		t.Error("want unknown user to be cached")
+	}
+}
+
+func TestGetentUserResolver(t *testing.T) {
+	entries := map[string]string{
+		"passwd alice": "alice:*:5001:5000:Alice Doe,,,:/home/alice:/bin/sh\n",
+		"passwd 5001":  "alice:*:5001:5000:Alice Doe,,,:/home/alice:/bin/sh\n",
+		"group admins": "admins:*:5000:alice,bob\n",
+		"group 5000":   "admins:*:5000:alice,bob\n",
+	}
+
+	var commands int
+	runner := func(ctx context.Context, spec CommandSpec) (CommandResult, error) {
+		commands++
+		if entry, ok := entries[spec.Args[1]+" "+spec.Args[2]]; ok {
+			return CommandResult{Stdout: []byte(entry)}, nil
+		}
+		return CommandResult{ExitCode: 2}, errors.New("exit status 2")
+	}
+
+	defaultRunner := DefaultCommandRunner
+	DefaultCommandRunner = CommandRunnerFunc(runner)
+	defer func() { DefaultCommandRunner = defaultRunner }()
+
+	var r GetentUserResolver
+	for _, f := range []func() (*user.User, error){
+		func() (*user.User, error) { return r.Lookup("alice") },
+		func() (*user.User, error) { return r.LookupId("5001") },
+	} {
+		u, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := user.User{Username: "alice", Uid: "5001", Gid: "5000", Name: "Alice Doe", HomeDir: "/home/alice"}
+		if *u != want {
+			t.Errorf("want user %v, got %v", want, *u)
+		}
+	}
+
+	for _, f := range []func() (*user.Group, error){
+		func() (*user.Group, error) { return r.LookupGroup("admins") },
+		func() (*user.Group, error) { return r.LookupGroupId("5000") },
+	} {
+		g, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if g.Name != "admins" || g.Gid != "5000" {
+			t.Errorf("want group admins with gid 5000, got %s with gid %s", g.Name, g.Gid)
+		}
+	}
+
+	if _, err := r.Lookup("bob"); !isUnknown(err) {
+		t.Errorf("want unknown user error, got %v", err)
+	}
+
+	if _, err := r.LookupGroupId("5001"); !isUnknown(err) {
+		t.Errorf("want unknown group error, got %v", err)
+	}
+
+	// Numeric names are not looked up as ids
+	commands = 0
+	if _, err := r.Lookup("5001"); !isUnknown(err) {
+		t.Errorf("want unknown user error, got %v", err)
+	}
+
+	if commands != 0 {
+		t.Errorf("want no getent commands for numeric user names, got %d", commands)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// WalkFunc is the type of the function called for each file or
+// directory visited by Walk. Returning filepath.SkipDir for a
+// directory skips the directory's contents.
+type WalkFunc func(path string, info os.FileInfo) error
+
+// WalkOptions type contains settings used when walking a path.
+type WalkOptions struct {
+	// Concurrency is the number of goroutines used for walking
+	// directories. Defaults to the number of CPUs.
+	Concurrency int
+
+	// Exclude contains patterns matched against the names of files
+	// and directories in order to skip them.
+	// Patterns use the syntax of filepath.Match.
+	Exclude []string
+}
+
+// WalkError type contains the errors encountered while walking a path.
+type WalkError struct {
+	// Errors contains the errors encountered for each path
+	Errors map[string]error
+}
+
+// Error implements the error interface.
+func (we *WalkError) Error() string {
+	paths := make([]string, 0, len(we.Errors))
+	for path := range we.Errors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	msgs := make([]string, len(paths))
+	for i, path := range paths {
+		msgs[i] = fmt.Sprintf("%s: %s", path, we.Errors[path])
+	}
+
+	return fmt.Sprintf("%d errors while walking path: %s", len(msgs), strings.Join(msgs, "; "))
+}
+
+// walker type walks directories using a bounded number of goroutines.
+type walker struct {
+	sync.Mutex
+
+	// Signals that directories have been queued or that walking is done
+	cond *sync.Cond
+
+	// Directories waiting to be walked
+	queue []string
+
+	// Number of directories queued or being walked
+	pending int
+
+	errors  map[string]error
+	fn      WalkFunc
+	exclude []string
+}
+
+// Walk walks the file tree rooted at root, calling fn for each file or
+// directory in the tree, including root. Directories are walked
+// concurrently, but a directory is always visited before its contents.
+// Symbolic links are never followed. Errors for individual entries do
+// not stop the walk, instead they are collected and returned
+// as a *WalkError once done.
+func Walk(root string, opts WalkOptions, fn WalkFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(root, info); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	if !info.IsDir() {
+		return nil
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU()
+	}
+
+	w := &walker{
+		queue:   []string{root},
+		pending: 1,
+		errors:  make(map[string]error),
+		fn:      fn,
+		exclude: opts.Exclude,
+	}
+	w.cond = sync.NewCond(w)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+	wg.Wait()
+
+	if len(w.errors) > 0 {
+		return &WalkError{Errors: w.errors}
+	}
+
+	return nil
+}
+
+// work walks queued directories until there are no more left.
+func (w *walker) work() {
+	for {
+		w.Lock()
+		for len(w.queue) == 0 && w.pending > 0 {
+			w.cond.Wait()
+		}
+
+		if w.pending == 0 {
+			w.Unlock()
+			return
+		}
+
+		dir := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+		w.Unlock()
+
+		w.walkDir(dir)
+
+		w.Lock()
+		w.pending--
+		if w.pending == 0 {
+			w.cond.Broadcast()
+		}
+		w.Unlock()
+	}
+}
+
+// walkDir visits the contents of a directory and queues
+// any sub-directories to be walked.
+func (w *walker) walkDir(dir string) {
+	f, err := os.Open(dir)
+	if err != nil {
+		w.addError(dir, err)
+		return
+	}
+
+	// Readdir uses lstat(2), so symbolic links are not followed
+	entries, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		w.addError(dir, err)
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	for _, info := range entries {
+		if w.isExcluded(info.Name()) {
+			continue
+		}
+
+		path := filepath.Join(dir, info.Name())
+		if err := w.fn(path, info); err != nil {
+			if err != filepath.SkipDir {
+				w.addError(path, err)
+			}
+			continue
+		}
+
+		if info.IsDir() {
+			w.Lock()
+			w.queue = append(w.queue, path)
+			w.pending++
+			w.cond.Signal()
+			w.Unlock()
+		}
+	}
+}
+
+// isExcluded returns a boolean indicating whether the
+// given name matches any of the exclude patterns.
+func (w *walker) isExcluded(name string) bool {
+	for _, pattern := range w.exclude {
+		if matched, _ := filepath.Match(pattern, name); matched || pattern == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addError records an error for the given path.
+func (w *walker) addError(path string, err error) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.errors[path] = err
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2015-2017 Marin Atanasov Nikolov <dnaeon@gmail.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in this position and unchanged.
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR(S) ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+// OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE AUTHOR(S) BE LIABLE FOR ANY DIRECT, INDIRECT,
+// INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF
+// THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utils
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// makeTree creates a directory tree for walking
+func makeTree(t *testing.T) string {
+	root, err := ioutil.TempDir("", "gru-walk")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dirs := []string{"a/b/c", "a/d", "e", ".git/objects"}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := []string{"a/foo", "a/b/bar", "a/b/c/qux", "e/baz", ".git/HEAD"}
+	for _, file := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, file), []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Symbolic links to directories should not be followed
+	if err := os.Symlink(filepath.Join(root, "a"), filepath.Join(root, "e", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
+
+func TestWalk(t *testing.T) {
+	root := makeTree(t)
+	defer os.RemoveAll(root)
+
+	var mu sync.Mutex
+	visited := make(map[string]int)
+	walkFn := func(path string, info os.FileInfo) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		// Parents must be visited before their children
+		if parent := filepath.Dir(rel); rel != "." {
+			if _, ok := visited[parent]; !ok {
+				t.Errorf("%s visited before its parent", rel)
+			}
+		}
+		visited[rel] = len(visited)
+
+		return nil
+	}
+
+	opts := WalkOptions{
+		Concurrency: 4,
+		Exclude:     []string{".git"},
+	}
+
+	if err := Walk(root, opts, walkFn); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for rel := range visited {
+		got = append(got, rel)
+	}
+	sort.Strings(got)
+
+	want := []string{".", "a", "a/b", "a/b/bar", "a/b/c", "a/b/c/qux", "a/d", "a/foo", "e", "e/baz", "e/link"}
+	if !sameStrings(want, got) {
+		t.Errorf("want visited %v, got %v", want, got)
+	}
+}
+
+func TestWalkErrors(t *testing.T) {
+	root := makeTree(t)
+	defer os.RemoveAll(root)
+
+	errFailed := errors.New("failed")
+	walkFn := func(path string, info os.FileInfo) error {
+		switch info.Name() {
+		case "foo", "baz":
+			return errFailed
+		case "b":
+			return filepath.SkipDir
+		}
+		return nil
+	}
+
+	err := Walk(root, WalkOptions{}, walkFn)
+	walkErr, ok := err.(*WalkError)
+	if !ok {
+		t.Fatalf("want *WalkError, got %v", err)
+	}
+
+	if len(walkErr.Errors) != 2 {
+		t.Errorf("want 2 errors, got %d: %s", len(walkErr.Errors), walkErr)
+	}
+
+	for _, rel := range []string{"a/foo", "e/baz"} {
+		if walkErr.Errors[filepath.Join(root, rel)] != errFailed {
+			t.Errorf("no error recorded for %s", rel)
+		}
+	}
+}
+
+// sameStrings returns a boolean indicating whether
+// two sorted slices are equal.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}